@@ -66,6 +66,35 @@ func (l *List) AddNodeTail(value interface{}) *List {
 	return l
 }
 
+// InsertNode 在oldNode之后(after为true)或者之前插入一个新节点
+func (l *List) InsertNode(oldNode *ListNode, value interface{}, after bool) *List {
+	node := &ListNode{
+		value: value,
+	}
+	if after {
+		node.prev = oldNode
+		node.next = oldNode.next
+		if l.tail == oldNode {
+			l.tail = node
+		}
+	} else {
+		node.next = oldNode
+		node.prev = oldNode.prev
+		if l.head == oldNode {
+			l.head = node
+		}
+	}
+	if node.prev != nil {
+		node.prev.next = node
+	}
+	if node.next != nil {
+		node.next.prev = node
+	}
+
+	l.len++
+	return l
+}
+
 func (l *List) DelNode(node *ListNode) {
 	if node.prev != nil {
 		node.prev.next = node.next
@@ -81,6 +110,21 @@ func (l *List) DelNode(node *ListNode) {
 	l.len--
 }
 
+// SearchKey 查找value等于key的节点，设置了match方法时使用match比较，没有找到返回nil
+func (l *List) SearchKey(key interface{}) *ListNode {
+	iter := l.Rewind()
+	for node := iter.Next(); node != nil; node = iter.Next() {
+		if l.match != nil {
+			if l.match(node.value, key) != 0 {
+				return node
+			}
+		} else if node.value == key {
+			return node
+		}
+	}
+	return nil
+}
+
 func (l *List) Last() *ListNode {
 	return l.tail
 }
@@ -21,6 +21,10 @@ func (n *ListNode) Next() *ListNode {
 	return n.next
 }
 
+func (n *ListNode) Prev() *ListNode {
+	return n.prev
+}
+
 const (
 	alStartHead = 0
 	alStartTail = 1
@@ -0,0 +1,954 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"unsafe"
+
+	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+)
+
+/* -----------------------------------------------------------------------------
+ * Helpers and low level bit functions.
+ * -------------------------------------------------------------------------- */
+
+// redisPopcount 计算s中被设置为1的bit数量
+func redisPopcount(s []byte) int64 {
+	var count int64
+	for len(s) >= 8 {
+		count += int64(bits.OnesCount64(uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24 |
+			uint64(s[4])<<32 | uint64(s[5])<<40 | uint64(s[6])<<48 | uint64(s[7])<<56))
+		s = s[8:]
+	}
+	for _, b := range s {
+		count += int64(bits.OnesCount8(b))
+	}
+	return count
+}
+
+// redisBitpos 返回s中第一个值为bit的位置。
+// 找0的时候如果全是1，返回第一个越界的位置（len(s)*8），即把字符串右边看作是无限的0；
+// 找1的时候如果全是0，返回-1
+func redisBitpos(s []byte, bit int) int64 {
+	var skipval byte
+	if bit == 0 {
+		skipval = 0xff
+	}
+
+	for i, b := range s {
+		if b == skipval {
+			continue
+		}
+		if bit == 0 {
+			b = ^b
+		}
+		return int64(i)*8 + int64(bits.LeadingZeros8(b))
+	}
+
+	if bit == 1 {
+		return -1
+	}
+	return int64(len(s)) * 8
+}
+
+// setUnsignedBitfield 从offset开始把bits位的无符号整数value写入p，高位在前。
+// 调用者需要保证p足够长
+func setUnsignedBitfield(p []byte, offset uint64, bits int, value uint64) {
+	for j := 0; j < bits; j++ {
+		bitval := (value >> uint(bits-1-j)) & 1
+		bytepos := offset >> 3
+		bit := 7 - (offset & 0x7)
+		byteval := p[bytepos]
+		byteval &= ^(1 << bit)
+		byteval |= uint8(bitval << bit)
+		p[bytepos] = byteval
+		offset++
+	}
+}
+
+func setSignedBitfield(p []byte, offset uint64, bits int, value int64) {
+	setUnsignedBitfield(p, offset, bits, uint64(value))
+}
+
+// getUnsignedBitfield 从offset开始读取bits位的无符号整数
+func getUnsignedBitfield(p []byte, offset uint64, bits int) uint64 {
+	var value uint64
+	for j := 0; j < bits; j++ {
+		bytepos := offset >> 3
+		bit := 7 - (offset & 0x7)
+		bitval := (uint64(p[bytepos]) >> bit) & 1
+		value = (value << 1) | bitval
+		offset++
+	}
+	return value
+}
+
+// getSignedBitfield 从offset开始读取bits位的有符号整数，最高位是符号位
+func getSignedBitfield(p []byte, offset uint64, bits int) int64 {
+	value := int64(getUnsignedBitfield(p, offset, bits))
+
+	// 最高位为1时，把它扩展到所有的高位，得到补码表示的负数
+	if bits < 64 && value&(int64(1)<<(bits-1)) != 0 {
+		value |= -1 << bits
+	}
+	return value
+}
+
+const (
+	bitfieldOpGet = iota
+	bitfieldOpSet
+	bitfieldOpIncrby
+)
+
+const (
+	bfOverflowWrap = iota
+	bfOverflowSat
+	bfOverflowFail
+)
+
+// checkUnsignedBitfieldOverflow 检查value加上incr之后是否超出bits位无符号整数的范围。
+// 向上溢出返回1，向下溢出返回-1，没有溢出返回0。
+// 溢出时如果limit不为nil，根据owtype把WRAP或者SAT的结果写到limit中
+func checkUnsignedBitfieldOverflow(value uint64, incr int64, bits int, owtype int, limit *uint64) int {
+	max := uint64(math.MaxUint64)
+	if bits != 64 {
+		max = (uint64(1) << bits) - 1
+	}
+	maxincr := int64(max - value)
+	minincr := -int64(value)
+
+	if value > max || (incr > 0 && incr > maxincr) {
+		if limit != nil {
+			if owtype == bfOverflowWrap {
+				*limit = wrapUnsignedBitfield(value, incr, bits)
+			} else if owtype == bfOverflowSat {
+				*limit = max
+			}
+		}
+		return 1
+	} else if incr < 0 && incr < minincr {
+		if limit != nil {
+			if owtype == bfOverflowWrap {
+				*limit = wrapUnsignedBitfield(value, incr, bits)
+			} else if owtype == bfOverflowSat {
+				*limit = 0
+			}
+		}
+		return -1
+	}
+	return 0
+}
+
+func wrapUnsignedBitfield(value uint64, incr int64, bits int) uint64 {
+	mask := uint64(math.MaxUint64) << bits
+	return (value + uint64(incr)) & ^mask
+}
+
+// checkSignedBitfieldOverflow 同checkUnsignedBitfieldOverflow，用于bits位的有符号整数
+func checkSignedBitfieldOverflow(value int64, incr int64, bits int, owtype int, limit *int64) int {
+	max := int64(math.MaxInt64)
+	if bits != 64 {
+		max = (int64(1) << (bits - 1)) - 1
+	}
+	min := -max - 1
+
+	// maxincr和minincr可能会溢出，但是只有在检查过value的范围之后才会使用，那时不会溢出
+	maxincr := int64(uint64(max) - uint64(value))
+	minincr := min - value
+
+	if value > max || (bits != 64 && incr > maxincr) || (value >= 0 && incr > 0 && incr > maxincr) {
+		if limit != nil {
+			if owtype == bfOverflowWrap {
+				*limit = wrapSignedBitfield(value, incr, bits)
+			} else if owtype == bfOverflowSat {
+				*limit = max
+			}
+		}
+		return 1
+	} else if value < min || (bits != 64 && incr < minincr) || (value < 0 && incr < 0 && incr < minincr) {
+		if limit != nil {
+			if owtype == bfOverflowWrap {
+				*limit = wrapSignedBitfield(value, incr, bits)
+			} else if owtype == bfOverflowSat {
+				*limit = min
+			}
+		}
+		return -1
+	}
+	return 0
+}
+
+func wrapSignedBitfield(value int64, incr int64, bits int) int64 {
+	msb := uint64(1) << (bits - 1)
+	// 用无符号数做加法
+	c := uint64(value) + uint64(incr)
+
+	// 符号位为1时扩展到所有的高位，否则把高位清零
+	if bits < 64 {
+		mask := uint64(math.MaxUint64) << bits
+		if c&msb != 0 {
+			c |= mask
+		} else {
+			c &= ^mask
+		}
+	}
+	return int64(c)
+}
+
+/* -----------------------------------------------------------------------------
+ * Bits related string commands: GETBIT, SETBIT, BITCOUNT, BITOP.
+ * -------------------------------------------------------------------------- */
+
+const (
+	bitopAnd = iota
+	bitopOr
+	bitopXor
+	bitopNot
+)
+
+const (
+	bitfieldFlagNone     = 0
+	bitfieldFlagReadonly = 1 << 0
+)
+
+// getBitOffsetFromArgument 解析bit的偏移量，偏移量换算成字节之后不能超过proto-max-bulk-len。
+// hash为true并且bits大于0时支持BITFIELD的#<offset>形式，偏移量要乘以bits
+func getBitOffsetFromArgument(c *Client, o *robj, offset *uint64, hash bool, bits int) error {
+	const errMsg = "bit offset is not an integer or out of range"
+	p := (*sds.SDS)(o.ptr).BufData(0)
+
+	usehash := 0
+	if len(p) > 0 && p[0] == '#' && hash && bits > 0 {
+		usehash = 1
+	}
+
+	var loffset int64
+	if !util.String2Int64(p[usehash:], &loffset) {
+		addReplyError(c, errMsg)
+		return C_ERR
+	}
+
+	if usehash == 1 {
+		loffset *= int64(bits)
+	}
+
+	if loffset < 0 || (c.flags&CLIENT_MASTER == 0 && loffset>>3 >= server.protoMaxBulkLen) {
+		addReplyError(c, errMsg)
+		return C_ERR
+	}
+
+	*offset = uint64(loffset)
+	return C_OK
+}
+
+// getBitfieldTypeFromArgument 解析BITFIELD的类型，i1~i64或者u1~u63
+func getBitfieldTypeFromArgument(c *Client, o *robj, sign *bool, bits *int) error {
+	const errMsg = "Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."
+	p := (*sds.SDS)(o.ptr).BufData(0)
+
+	if len(p) > 0 && p[0] == 'i' {
+		*sign = true
+	} else if len(p) > 0 && p[0] == 'u' {
+		*sign = false
+	} else {
+		addReplyError(c, errMsg)
+		return C_ERR
+	}
+
+	var llbits int64
+	if !util.String2Int64(p[1:], &llbits) ||
+		llbits < 1 ||
+		(*sign && llbits > 64) ||
+		(!*sign && llbits > 63) {
+		addReplyError(c, errMsg)
+		return C_ERR
+	}
+	*bits = int(llbits)
+	return C_OK
+}
+
+// lookupStringForBitCommand 查找或者创建用于写bit的字符串对象，并保证字符串至少能容纳maxbit。
+// key的类型不对时回复错误并返回nil。key是新创建的或者字符串变长了，dirty为true
+func lookupStringForBitCommand(c *Client, maxbit uint64, dirty *bool) *robj {
+	bytepos := int(maxbit >> 3)
+	o := c.db.lookupKeyWrite(c.argv[1])
+	if o != nil && o.checkType(c, ObjString) {
+		return nil
+	}
+	if dirty != nil {
+		*dirty = false
+	}
+
+	if o == nil {
+		o = createObject(ObjString, sds.NewLen(make([]byte, bytepos+1)))
+		c.db.dbAdd(c.argv[1], o)
+		if dirty != nil {
+			*dirty = true
+		}
+	} else {
+		o = c.db.dbUnshareStringValue(c.argv[1], o)
+		oldlen := sds.Len(*(*sds.SDS)(o.ptr))
+		s := sds.GrowZero(*(*sds.SDS)(o.ptr), bytepos+1)
+		o.ptr = unsafe.Pointer(&s)
+		if dirty != nil && oldlen != sds.Len(s) {
+			*dirty = true
+		}
+	}
+	return o
+}
+
+// getObjectReadOnlyString 返回字符串对象的内容，整数编码的对象转换成字符串，o为nil时返回nil
+func getObjectReadOnlyString(o *robj) []byte {
+	if o == nil {
+		return nil
+	}
+	if o.getType() != ObjString {
+		panic("getObjectReadOnlyString against non string object")
+	}
+	if o.getEncoding() == ObjEncodingInt {
+		return util.String2Bytes(strconv.Itoa(*(*int)(o.ptr)))
+	}
+	return (*sds.SDS)(o.ptr).BufData(0)
+}
+
+// SETBIT <key> <offset> <bit>
+func setbitCommand(c *Client) {
+	const errMsg = "bit is not an integer or out of range"
+
+	var bitoffset uint64
+	if getBitOffsetFromArgument(c, c.argv[2], &bitoffset, false, 0) != C_OK {
+		return
+	}
+
+	var on int64
+	if c.argv[3].getLongLongFromObjectOrReply(c, &on, errMsg) != C_OK {
+		return
+	}
+
+	// bit只能是0或者1
+	if on&^1 != 0 {
+		addReplyError(c, errMsg)
+		return
+	}
+
+	var dirty bool
+	o := lookupStringForBitCommand(c, bitoffset, &dirty)
+	if o == nil {
+		return
+	}
+
+	// 获取原来的值
+	p := (*sds.SDS)(o.ptr).BufData(0)
+	bytepos := bitoffset >> 3
+	byteval := p[bytepos]
+	bit := 7 - (bitoffset & 0x7)
+	bitval := (byteval >> bit) & 1
+
+	// key是新创建的、字符串变长了或者bit的值发生了变化
+	if dirty || int64(bitval) != on {
+		byteval &= ^(1 << bit)
+		byteval |= uint8(on&0x1) << bit
+		p[bytepos] = byteval
+		signalModifiedKey(c, c.db, c.argv[1])
+		notifyKeySpaceEvent(notifyString, "setbit", c.argv[1], c.db.id)
+		server.dirty++
+	}
+
+	// 返回原来的值
+	if bitval != 0 {
+		addReply(c, shared.cone)
+	} else {
+		addReply(c, shared.czero)
+	}
+}
+
+// GETBIT <key> <offset>
+func getbitCommand(c *Client) {
+	var bitoffset uint64
+	if getBitOffsetFromArgument(c, c.argv[2], &bitoffset, false, 0) != C_OK {
+		return
+	}
+
+	var o *robj
+	if o = lookupKeyReadOrReply(c, c.argv[1], shared.czero); o == nil || o.checkType(c, ObjString) {
+		return
+	}
+
+	p := getObjectReadOnlyString(o)
+	bytepos := bitoffset >> 3
+	bit := 7 - (bitoffset & 0x7)
+	var bitval byte
+	if bytepos < uint64(len(p)) {
+		bitval = (p[bytepos] >> bit) & 1
+	}
+
+	if bitval != 0 {
+		addReply(c, shared.cone)
+	} else {
+		addReply(c, shared.czero)
+	}
+}
+
+// BITOP op_name target_key src_key1 src_key2 src_key3 ... src_keyN
+func bitopCommand(c *Client) {
+	opname := (*sds.SDS)(c.argv[1].ptr).BufData(0)
+	targetkey := c.argv[2]
+
+	// 解析操作类型
+	var op int
+	if util.StrCaseCmp(opname, "and") {
+		op = bitopAnd
+	} else if util.StrCaseCmp(opname, "or") {
+		op = bitopOr
+	} else if util.StrCaseCmp(opname, "xor") {
+		op = bitopXor
+	} else if util.StrCaseCmp(opname, "not") {
+		op = bitopNot
+	} else {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+
+	// NOT只能有一个源key
+	if op == bitopNot && c.argc != 4 {
+		addReplyError(c, "BITOP NOT must be called with a single source key.")
+		return
+	}
+
+	// 查找所有的源key，不存在的key当作空字符串
+	numkeys := c.argc - 3
+	src := make([][]byte, numkeys)
+	maxlen := 0
+	for j := 0; j < numkeys; j++ {
+		o := c.db.lookupKeyRead(c.argv[j+3])
+		if o == nil {
+			continue
+		}
+		if o.checkType(c, ObjString) {
+			return
+		}
+		src[j] = getObjectReadOnlyString(o)
+		if len(src[j]) > maxlen {
+			maxlen = len(src[j])
+		}
+	}
+
+	// 至少有一个字符串不为空时才需要计算，长度不足的字符串用0补齐
+	var res []byte
+	if maxlen > 0 {
+		res = make([]byte, maxlen)
+		for i := 0; i < maxlen; i++ {
+			var output byte
+			if i < len(src[0]) {
+				output = src[0][i]
+			}
+			if op == bitopNot {
+				output = ^output
+			}
+			for j := 1; j < numkeys; j++ {
+				var b byte
+				if i < len(src[j]) {
+					b = src[j][i]
+				}
+				switch op {
+				case bitopAnd:
+					output &= b
+				case bitopOr:
+					output |= b
+				case bitopXor:
+					output ^= b
+				}
+			}
+			res[i] = output
+		}
+	}
+
+	// 保存结果，结果为空时删除目标key
+	if maxlen > 0 {
+		o := createObject(ObjString, sds.NewLen(res))
+		c.db.genericSetKey(c, targetkey, o, false, true)
+		notifyKeySpaceEvent(notifyString, "set", targetkey, c.db.id)
+		o.decrRefCount()
+		server.dirty++
+	} else if dbDelete(c.db, targetkey) {
+		signalModifiedKey(c, c.db, targetkey)
+		notifyKeySpaceEvent(notifyGeneric, "del", targetkey, c.db.id)
+		server.dirty++
+	}
+	addReplyLongLong(c, maxlen)
+}
+
+// bitRangeFromArguments 把BITCOUNT/BITPOS的start和end转换成字节下标，isbit为true时start和end是bit下标，
+// 这时额外返回首尾两个字节中不在范围内的bit的掩码。end不能超过字符串的末尾
+func bitRangeFromArguments(start, end, strlen int64, isbit bool) (int64, int64, byte, byte) {
+	var firstByteNegMask, lastByteNegMask byte
+
+	totlen := strlen
+	if isbit {
+		totlen <<= 3
+	}
+	if start < 0 {
+		start = totlen + start
+	}
+	if end < 0 {
+		end = totlen + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= totlen {
+		end = totlen - 1
+	}
+	if isbit && start <= end {
+		// 转换成字节下标之前，记下首尾字节中不在范围内的bit
+		firstByteNegMask = ^byte((1 << (8 - (start & 7))) - 1)
+		lastByteNegMask = byte((1 << (7 - (end & 7))) - 1)
+		start >>= 3
+		end >>= 3
+	}
+	return start, end, firstByteNegMask, lastByteNegMask
+}
+
+// parseBitRangeUnit 解析BITCOUNT/BITPOS的BYTE|BIT参数
+func parseBitRangeUnit(c *Client, o *robj, isbit *bool) error {
+	unit := (*sds.SDS)(o.ptr).BufData(0)
+	if util.StrCaseCmp(unit, "bit") {
+		*isbit = true
+	} else if util.StrCaseCmp(unit, "byte") {
+		*isbit = false
+	} else {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return C_ERR
+	}
+	return C_OK
+}
+
+// BITCOUNT key [start end [BIT|BYTE]]
+func bitcountCommand(c *Client) {
+	var start, end int64
+	var isbit bool
+	var firstByteNegMask, lastByteNegMask byte
+	var o *robj
+	var p []byte
+
+	if c.argc == 4 || c.argc == 5 {
+		if c.argv[2].getLongLongFromObjectOrReply(c, &start, "") != C_OK ||
+			c.argv[3].getLongLongFromObjectOrReply(c, &end, "") != C_OK {
+			return
+		}
+		if c.argc == 5 && parseBitRangeUnit(c, c.argv[4], &isbit) != C_OK {
+			return
+		}
+
+		o = c.db.lookupKeyRead(c.argv[1])
+		if o != nil && o.checkType(c, ObjString) {
+			return
+		}
+		p = getObjectReadOnlyString(o)
+
+		// 两个都是负数并且start > end，范围一定为空
+		if start < 0 && end < 0 && start > end {
+			addReply(c, shared.czero)
+			return
+		}
+		start, end, firstByteNegMask, lastByteNegMask = bitRangeFromArguments(start, end, int64(len(p)), isbit)
+	} else if c.argc == 2 {
+		o = c.db.lookupKeyRead(c.argv[1])
+		if o != nil && o.checkType(c, ObjString) {
+			return
+		}
+		p = getObjectReadOnlyString(o)
+		// 整个字符串
+		start = 0
+		end = int64(len(p)) - 1
+	} else {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+
+	// key不存在时返回0
+	if o == nil {
+		addReply(c, shared.czero)
+		return
+	}
+
+	// 此时end >= 0 && end < strlen，只有start > end时结果为0
+	if start > end {
+		addReply(c, shared.czero)
+		return
+	}
+
+	count := redisPopcount(p[start : end+1])
+	if firstByteNegMask != 0 || lastByteNegMask != 0 {
+		// 减去首尾字节中不在范围内的bit
+		var firstlast [2]byte
+		if firstByteNegMask != 0 {
+			firstlast[0] = p[start] & firstByteNegMask
+		}
+		if lastByteNegMask != 0 {
+			firstlast[1] = p[end] & lastByteNegMask
+		}
+		count -= redisPopcount(firstlast[:])
+	}
+	addReplyLongLong(c, int(count))
+}
+
+// BITPOS key bit [start [end [BIT|BYTE]]]
+func bitposCommand(c *Client) {
+	var start, end int64
+	var isbit, endGiven bool
+	var firstByteNegMask, lastByteNegMask byte
+	var o *robj
+	var p []byte
+
+	// 要找的是0还是1
+	var bit int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &bit, "") != C_OK {
+		return
+	}
+	if bit != 0 && bit != 1 {
+		addReplyError(c, "The bit argument must be 1 or 0.")
+		return
+	}
+
+	if c.argc == 4 || c.argc == 5 || c.argc == 6 {
+		if c.argv[3].getLongLongFromObjectOrReply(c, &start, "") != C_OK {
+			return
+		}
+		if c.argc == 6 && parseBitRangeUnit(c, c.argv[5], &isbit) != C_OK {
+			return
+		}
+		if c.argc >= 5 {
+			if c.argv[4].getLongLongFromObjectOrReply(c, &end, "") != C_OK {
+				return
+			}
+			endGiven = true
+		}
+
+		o = c.db.lookupKeyRead(c.argv[1])
+		if o != nil && o.checkType(c, ObjString) {
+			return
+		}
+		p = getObjectReadOnlyString(o)
+
+		if !endGiven {
+			end = int64(len(p)) - 1
+		}
+		start, end, firstByteNegMask, lastByteNegMask = bitRangeFromArguments(start, end, int64(len(p)), isbit)
+	} else if c.argc == 3 {
+		o = c.db.lookupKeyRead(c.argv[1])
+		if o != nil && o.checkType(c, ObjString) {
+			return
+		}
+		p = getObjectReadOnlyString(o)
+		// 整个字符串
+		start = 0
+		end = int64(len(p)) - 1
+	} else {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+
+	// key不存在时看作是无限长的0，找0返回0，找1返回-1
+	if o == nil {
+		if bit == 1 {
+			addReplyLongLong(c, -1)
+		} else {
+			addReplyLongLong(c, 0)
+		}
+		return
+	}
+
+	// 空的范围里既没有0也没有1
+	if start > end {
+		addReplyLongLong(c, -1)
+		return
+	}
+
+	bytes := end - start + 1
+	pos := bitposInRange(p, start, end, int(bit), firstByteNegMask, lastByteNegMask)
+
+	// 找0并且指定了end的时候，不能把范围右边看作是0，
+	// redisBitpos返回范围之外的第一个bit时说明范围内没有0
+	if endGiven && bit == 0 && pos == bytes<<3 {
+		addReplyLongLong(c, -1)
+		return
+	}
+	if pos != -1 {
+		pos += start << 3
+	}
+	addReplyLongLong(c, int(pos))
+}
+
+// bitposInRange 在p[start:end+1]中查找bit，首尾字节中不在范围内的bit由掩码屏蔽。
+// 返回值是相对于start字节的bit位置，含义同redisBitpos
+func bitposInRange(p []byte, start, end int64, bit int, firstByteNegMask, lastByteNegMask byte) int64 {
+	// 把不在范围内的bit设置成与要找的bit相反的值
+	maskByte := func(b, mask byte) byte {
+		if bit == 1 {
+			return b & ^mask
+		}
+		return b | mask
+	}
+
+	bytes := end - start + 1
+	var skipped int64
+	if firstByteNegMask != 0 {
+		tmpchar := maskByte(p[start], firstByteNegMask)
+		// 只有一个字节
+		if lastByteNegMask != 0 && bytes == 1 {
+			tmpchar = maskByte(tmpchar, lastByteNegMask)
+		}
+		pos := redisBitpos([]byte{tmpchar}, bit)
+		if bytes == 1 || (pos != -1 && pos != 8) {
+			return pos
+		}
+		start++
+		bytes--
+		skipped = 8
+	}
+
+	// 最后一个字节有不在范围内的bit，单独处理
+	curbytes := bytes
+	if lastByteNegMask != 0 {
+		curbytes--
+	}
+	if curbytes > 0 {
+		pos := redisBitpos(p[start:start+curbytes], bit)
+		if bytes == curbytes || (pos != -1 && pos != curbytes<<3) {
+			if pos != -1 {
+				pos += skipped
+			}
+			return pos
+		}
+		skipped += curbytes << 3
+	}
+
+	pos := redisBitpos([]byte{maskByte(p[end], lastByteNegMask)}, bit)
+	if pos != -1 {
+		pos += skipped
+	}
+	return pos
+}
+
+// bitfieldOp BITFIELD的一个操作
+type bitfieldOp struct {
+	offset uint64 // bitfield的偏移量
+	i64    int64  // INCRBY的增量或者SET的值
+	opcode int    // 操作类型
+	owtype int    // 溢出的处理方式
+	bits   int    // bitfield的位数
+	sign   bool   // 是否有符号
+}
+
+// bitfieldGeneric 实现BITFIELD和BITFIELD_RO，flags为bitfieldFlagReadonly时只允许GET
+func bitfieldGeneric(c *Client, flags int) {
+	var ops []bitfieldOp
+	owtype := bfOverflowWrap
+	readonly := true
+	var highestWriteOffset uint64
+
+	for j := 2; j < c.argc; j++ {
+		remargs := c.argc - j - 1 // 除了当前参数还剩下的参数个数
+		subcmd := (*sds.SDS)(c.argv[j].ptr).BufData(0)
+		var opcode int
+		var i64 int64
+		var sign bool
+		var bits int
+
+		if util.StrCaseCmp(subcmd, "get") && remargs >= 2 {
+			opcode = bitfieldOpGet
+		} else if util.StrCaseCmp(subcmd, "set") && remargs >= 3 {
+			opcode = bitfieldOpSet
+		} else if util.StrCaseCmp(subcmd, "incrby") && remargs >= 3 {
+			opcode = bitfieldOpIncrby
+		} else if util.StrCaseCmp(subcmd, "overflow") && remargs >= 1 {
+			owtypename := (*sds.SDS)(c.argv[j+1].ptr).BufData(0)
+			j++
+			if util.StrCaseCmp(owtypename, "wrap") {
+				owtype = bfOverflowWrap
+			} else if util.StrCaseCmp(owtypename, "sat") {
+				owtype = bfOverflowSat
+			} else if util.StrCaseCmp(owtypename, "fail") {
+				owtype = bfOverflowFail
+			} else {
+				addReplyError(c, "Invalid OVERFLOW type specified")
+				return
+			}
+			continue
+		} else {
+			addReplyErrorObject(c, shared.syntaxErr)
+			return
+		}
+
+		// 所有的操作都有类型和偏移量参数
+		if getBitfieldTypeFromArgument(c, c.argv[j+1], &sign, &bits) != C_OK {
+			return
+		}
+
+		var bitoffset uint64
+		if getBitOffsetFromArgument(c, c.argv[j+2], &bitoffset, true, bits) != C_OK {
+			return
+		}
+
+		if opcode != bitfieldOpGet {
+			readonly = false
+			if highestWriteOffset < bitoffset+uint64(bits)-1 {
+				highestWriteOffset = bitoffset + uint64(bits) - 1
+			}
+			// SET和INCRBY还需要一个参数
+			if c.argv[j+3].getLongLongFromObjectOrReply(c, &i64, "") != C_OK {
+				return
+			}
+		}
+
+		ops = append(ops, bitfieldOp{
+			offset: bitoffset,
+			i64:    i64,
+			opcode: opcode,
+			owtype: owtype,
+			bits:   bits,
+			sign:   sign,
+		})
+
+		if opcode == bitfieldOpGet {
+			j += 2
+		} else {
+			j += 3
+		}
+	}
+
+	var o *robj
+	var dirty bool
+	if readonly {
+		// 只读的时候key可以不存在，但是类型不对要报错
+		o = c.db.lookupKeyRead(c.argv[1])
+		if o != nil && o.checkType(c, ObjString) {
+			return
+		}
+	} else {
+		if flags&bitfieldFlagReadonly != 0 {
+			addReplyError(c, "BITFIELD_RO only supports the GET subcommand")
+			return
+		}
+
+		// 字符串要能容纳写入的最高位
+		if o = lookupStringForBitCommand(c, highestWriteOffset, &dirty); o == nil {
+			return
+		}
+	}
+
+	addReplyArrayLen(c, len(ops))
+
+	changes := 0
+	for i := range ops {
+		thisop := &ops[i]
+
+		if thisop.opcode == bitfieldOpSet || thisop.opcode == bitfieldOpIncrby {
+			// SET需要返回原来的值，所以和INCRBY一样先读后写
+			p := (*sds.SDS)(o.ptr).BufData(0)
+			if thisop.sign {
+				var newval, wrapped, retval int64
+				oldval := getSignedBitfield(p, thisop.offset, thisop.bits)
+
+				var overflow int
+				if thisop.opcode == bitfieldOpIncrby {
+					overflow = checkSignedBitfieldOverflow(oldval, thisop.i64, thisop.bits, thisop.owtype, &wrapped)
+					if overflow != 0 {
+						newval = wrapped
+					} else {
+						newval = oldval + thisop.i64
+					}
+					retval = newval
+				} else {
+					newval = thisop.i64
+					overflow = checkSignedBitfieldOverflow(newval, 0, thisop.bits, thisop.owtype, &wrapped)
+					if overflow != 0 {
+						newval = wrapped
+					}
+					retval = oldval
+				}
+
+				// 溢出的处理方式是FAIL时，不写入并且返回NULL
+				if !(overflow != 0 && thisop.owtype == bfOverflowFail) {
+					addReplyLongLong(c, int(retval))
+					setSignedBitfield(p, thisop.offset, thisop.bits, newval)
+					if dirty || oldval != newval {
+						changes++
+					}
+				} else {
+					addReplyNull(c)
+				}
+			} else {
+				var newval, wrapped, retval uint64
+				oldval := getUnsignedBitfield(p, thisop.offset, thisop.bits)
+
+				var overflow int
+				if thisop.opcode == bitfieldOpIncrby {
+					newval = oldval + uint64(thisop.i64)
+					overflow = checkUnsignedBitfieldOverflow(oldval, thisop.i64, thisop.bits, thisop.owtype, &wrapped)
+					if overflow != 0 {
+						newval = wrapped
+					}
+					retval = newval
+				} else {
+					newval = uint64(thisop.i64)
+					overflow = checkUnsignedBitfieldOverflow(newval, 0, thisop.bits, thisop.owtype, &wrapped)
+					if overflow != 0 {
+						newval = wrapped
+					}
+					retval = oldval
+				}
+
+				// 溢出的处理方式是FAIL时，不写入并且返回NULL
+				if !(overflow != 0 && thisop.owtype == bfOverflowFail) {
+					addReplyLongLong(c, int(retval))
+					setUnsignedBitfield(p, thisop.offset, thisop.bits, newval)
+					if dirty || oldval != newval {
+						changes++
+					}
+				} else {
+					addReplyNull(c)
+				}
+			}
+		} else {
+			// GET的时候把最多9个字节复制到本地的缓冲区，不足的部分用0补齐，
+			// 这样在字符串的边界上也可以直接读取64位的整数
+			var buf [9]byte
+			src := getObjectReadOnlyString(o)
+			bytepos := thisop.offset >> 3
+			for k := uint64(0); k < 9 && bytepos+k < uint64(len(src)); k++ {
+				buf[k] = src[bytepos+k]
+			}
+
+			if thisop.sign {
+				val := getSignedBitfield(buf[:], thisop.offset-bytepos*8, thisop.bits)
+				addReplyLongLong(c, int(val))
+			} else {
+				val := getUnsignedBitfield(buf[:], thisop.offset-bytepos*8, thisop.bits)
+				addReplyLongLong(c, int(val))
+			}
+		}
+	}
+
+	if changes > 0 {
+		signalModifiedKey(c, c.db, c.argv[1])
+		notifyKeySpaceEvent(notifyString, "setbit", c.argv[1], c.db.id)
+		server.dirty += changes
+	}
+}
+
+// BITFIELD key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL]
+func bitfieldCommand(c *Client) {
+	bitfieldGeneric(c, bitfieldFlagNone)
+}
+
+// BITFIELD_RO key [GET type offset] ...
+func bitfieldroCommand(c *Client) {
+	bitfieldGeneric(c, bitfieldFlagReadonly)
+}
@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+func TestBitCommands(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"setbit b 7 1", ":0"},
+		{"setbit b 7 1", ":1"},
+		{"getbit b 7", ":1"},
+		{"getbit b 100", ":0"},
+		{"getbit nokey 0", ":0"},
+		{"setbit b 16 1", ":0"},
+		{"strlen b", ":3"},
+		{"setbit b -1 1", "-ERR bit offset is not an integer or out of range"},
+		{"setbit b 4294967296 1", "-ERR bit offset is not an integer or out of range"},
+		{"setbit b 0 2", "-ERR bit is not an integer or out of range"},
+
+		{"set s foobar", "+OK"},
+		{"bitcount s", ":26"},
+		{"bitcount s 0 0", ":4"},
+		{"bitcount s 1 1", ":6"},
+		{"bitcount s -2 -1", ":7"},
+		{"bitcount s 5 100", ":4"},
+		{"bitcount s 3 1", ":0"},
+		{"bitcount s 5 30 bit", ":17"},
+		{"bitcount nokey", ":0"},
+		{"bitcount s 0", "-ERR syntax error"},
+
+		{"set p \xff\xf0\x00", "+OK"},
+		{"bitpos p 0", ":12"},
+		{"bitpos p 1 2", ":-1"},
+		{"bitpos p 1 -1", ":-1"},
+		{"bitpos p 0 8 -1 bit", ":12"},
+		{"bitpos nokey 0", ":0"},
+		{"bitpos nokey 1", ":-1"},
+		{"set ones \xff\xff", "+OK"},
+		{"bitpos ones 0", ":16"},
+		{"bitpos ones 0 0 -1", ":-1"},
+
+		{"set a abc", "+OK"},
+		{"set b2 ab", "+OK"},
+		{"bitop and dst a b2", ":3"},
+		{"get dst", "ab\x00"},
+		{"bitop or dst a b2", ":3"},
+		{"get dst", "abc"},
+		{"bitop xor dst a a", ":3"},
+		{"get dst", "\x00\x00\x00"},
+		{"bitop not dst b2", ":2"},
+		{"get dst", "\x9e\x9d"},
+		{"bitop not dst a b2", "-ERR BITOP NOT must be called with a single source key."},
+		{"bitop and dst nokey", ":0"},
+		{"exists dst", ":0"},
+		{"bitop and a a", ":3"},
+		{"get a", "abc"},
+		{"rpush l x", ":1"},
+		{"bitop or dst a l", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"bitop nand dst a", "-ERR syntax error"},
+	})
+
+	server.protoMaxBulkLen = 8
+	testRun(t, c, []testCase{
+		{"setbit big 64 1", "-ERR bit offset is not an integer or out of range"},
+		{"setbit big 63 1", ":0"},
+	})
+}
+
+func TestBitfieldCommand(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"bitfield bf set u8 0 255 get u8 0", "[:0 :255]"},
+		{"bitfield bf incrby u8 0 10", "[:9]"},
+		{"bitfield bf overflow sat incrby u8 0 300", "[:255]"},
+		{"bitfield bf overflow fail incrby u8 0 1 get u8 0", "[(nil) :255]"},
+		{"bitfield bf set i8 8 -128 incrby i8 8 -1", "[:0 :127]"},
+		{"bitfield bf overflow sat incrby i8 8 10 incrby i8 8 -300", "[:127 :-128]"},
+		{"bitfield bf get u4 0 get u4 4 get i16 0", "[:15 :15 :-128]"},
+		{"bitfield bf set u8 #2 7 get u8 16", "[:0 :7]"},
+		{"bitfield bf get i64 0", "[:-36021100437569536]"},
+		{"bitfield nokey get u8 100", "[:0]"},
+		{"exists nokey", ":0"},
+		{"bitfield bf", "[]"},
+		{"bitfield bf get u64 0", "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."},
+		{"bitfield bf get i65 0", "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."},
+		{"bitfield bf get u8 -1", "-ERR bit offset is not an integer or out of range"},
+		{"bitfield bf overflow none", "-ERR Invalid OVERFLOW type specified"},
+		{"bitfield bf set u8 0", "-ERR syntax error"},
+		{"bitfield_ro bf get u8 0", "[:255]"},
+		{"bitfield_ro bf set u8 0 1", "-ERR BITFIELD_RO only supports the GET subcommand"},
+	})
+}
@@ -1,18 +1,361 @@
 package main
 
-import "unsafe"
+import (
+	"github.com/pengdafu/redis-golang/adlist"
+	"github.com/pengdafu/redis-golang/dict"
+	"github.com/pengdafu/redis-golang/sds"
+	"unsafe"
+)
 
 type readyList struct {
 	db  *redisDb
 	key *robj
 }
 
+// blockClient 把客户端设置为阻塞状态，btype为BLOCKED_*
+func blockClient(c *Client, btype int) {
+	c.flags |= CLIENT_BLOCKED
+	c.bType = btype
+	server.blockedClients++
+	server.blockedClientsByType[btype]++
+	addClientToTimeoutTable(c)
+}
+
+// unblockClient 解除客户端的阻塞，并把客户端放到server.unblockedClients中，
+// 以便在beforeSleep中继续处理querybuf中积压的命令
+func unblockClient(c *Client) {
+	if c.bType == BLOCKED_LIST ||
+		c.bType == BLOCKED_ZSET ||
+		c.bType == BLOCKED_STREAM {
+		unblockClientWaitingData(c)
+	} else {
+		panic("Unknown btype in unblockClient().")
+	}
+
+	server.blockedClients--
+	server.blockedClientsByType[c.bType]--
+	c.flags &= ^CLIENT_BLOCKED
+	c.bType = BLOCKED_NONE
+	removeClientFromTimeoutTable(c)
+	queueClientForReprocessing(c)
+}
+
+// queueClientForReprocessing 把客户端加入server.unblockedClients
+func queueClientForReprocessing(c *Client) {
+	if c.flags&CLIENT_UNBLOCKED == 0 {
+		c.flags |= CLIENT_UNBLOCKED
+		server.unblockedClients.AddNodeTail(c)
+	}
+}
+
+// processUnblockedClients 处理在阻塞期间积压在querybuf中的命令
+func processUnblockedClients() {
+	for server.unblockedClients.Len() > 0 {
+		ln := server.unblockedClients.First()
+		c := ln.NodeValue().(*Client)
+		server.unblockedClients.DelNode(ln)
+		c.flags &= ^CLIENT_UNBLOCKED
+
+		// 处理命令的过程中客户端可能又被阻塞了
+		if c.flags&CLIENT_BLOCKED == 0 {
+			if c.qbPos < sds.Len(c.querybuf) {
+				processInputBuffer(c)
+			}
+		}
+	}
+}
+
+// replyToBlockedClientTimedOut 阻塞超时的时候回复客户端
+func replyToBlockedClientTimedOut(c *Client) {
+	if c.bType == BLOCKED_LIST ||
+		c.bType == BLOCKED_ZSET ||
+		c.bType == BLOCKED_STREAM {
+		addReply(c, shared.nullArray[c.resp])
+	} else {
+		panic("Unknown btype in replyToBlockedClientTimedOut().")
+	}
+}
+
+// serveClientBlockedOnList 服务一个阻塞在list上的客户端，o不能为空。
+// dstkey为nil时是BLPOP/BRPOP/BLMPOP，否则是BLMOVE。list为空被删除时deleted为true
+func serveClientBlockedOnList(receiver *Client, o, key, dstkey *robj, wherefrom, whereto int) (deleted bool) {
+	var value *robj
+
+	if dstkey == nil {
+		if receiver.bpop.count > 0 {
+			// BLMPOP，一次弹出多个元素
+			return listPopRangeAndReplyWithKey(receiver, o, key, wherefrom, receiver.bpop.count)
+		}
+
+		// BLPOP/BRPOP
+		value = listTypePop(o, wherefrom)
+		addReplyArrayLen(receiver, 2)
+		addReplyBulk(receiver, key)
+		addReplyBulk(receiver, value)
+
+		event := "rpop"
+		if wherefrom == listHead {
+			event = "lpop"
+		}
+		notifyKeySpaceEvent(notifyList, event, key, receiver.db.id)
+	} else {
+		// BLMOVE，目标key类型不对时checkType会给客户端回复错误
+		dstobj := receiver.db.lookupKeyWrite(dstkey)
+		if dstobj == nil || !dstobj.checkType(receiver, ObjList) {
+			value = listTypePop(o, wherefrom)
+			lmoveHandlePush(receiver, dstkey, dstobj, value, whereto)
+
+			event := "rpop"
+			if wherefrom == listHead {
+				event = "lpop"
+			}
+			notifyKeySpaceEvent(notifyList, event, key, receiver.db.id)
+		}
+	}
+
+	// BLMOVE的目标key类型不对时什么都没有弹出
+	if value == nil {
+		return false
+	}
+	value.decrRefCount()
+
+	if listTypeLength(o) == 0 {
+		dbDelete(receiver.db, key)
+		notifyKeySpaceEvent(notifyGeneric, "del", key, receiver.db.id)
+		deleted = true
+	}
+	signalModifiedKey(receiver, receiver.db, key)
+	server.dirty++
+	return deleted
+}
+
+// serveClientsBlockedOnListKey 按照阻塞的先后顺序服务阻塞在rl.key上的客户端，直到list为空
+func serveClientsBlockedOnListKey(o *robj, rl *readyList) {
+	if server.blockedClientsByType[BLOCKED_LIST] == 0 {
+		return
+	}
+
+	de := rl.db.blockingKeys.Find(unsafe.Pointer(rl.key))
+	if de == nil {
+		return
+	}
+
+	clients := (*adlist.List)(dict.GetVal(de))
+	iter := clients.Rewind()
+	for ln := iter.Next(); ln != nil; ln = iter.Next() {
+		receiver := ln.NodeValue().(*Client)
+		if receiver.bType != BLOCKED_LIST {
+			continue
+		}
+
+		dstkey := receiver.bpop.target
+		wherefrom := receiver.bpop.listPos.wherefrom
+		whereto := receiver.bpop.listPos.whereto
+
+		// unblockClient会释放receiver.bpop.target
+		if dstkey != nil {
+			dstkey.incrRefCount()
+		}
+		deleted := serveClientBlockedOnList(receiver, o, rl.key, dstkey, wherefrom, whereto)
+		unblockClient(receiver)
+		if dstkey != nil {
+			dstkey.decrRefCount()
+		}
+
+		// list已经为空并且被删除了
+		if deleted {
+			break
+		}
+	}
+}
+
+// serveClientsBlockedOnStreamKey 把新的元素发送给阻塞在rl.key上，并且等待的ID比stream最后一个ID小的客户端
+func serveClientsBlockedOnStreamKey(o *robj, rl *readyList) {
+	de := rl.db.blockingKeys.Find(unsafe.Pointer(rl.key))
+	if de == nil {
+		return
+	}
+	s := (*stream)(o.ptr)
+
+	clients := (*adlist.List)(dict.GetVal(de))
+	iter := clients.Rewind()
+	for ln := iter.Next(); ln != nil; ln = iter.Next() {
+		receiver := ln.NodeValue().(*Client)
+		if receiver.bType != BLOCKED_STREAM {
+			continue
+		}
+		gt := (*streamID)(receiver.bpop.keys.FetchValue(unsafe.Pointer(rl.key)))
+
+		// XREADGROUP阻塞时等待的是">"，需要使用消费组当前的lastID，
+		// 因为服务同一个消费组的其它客户端时会修改它
+		var group *streamCG
+		if receiver.bpop.xReadGroup != nil {
+			group = streamLookupCG(s, *(*sds.SDS)(receiver.bpop.xReadGroup.ptr))
+			if group == nil {
+				addReplyError(receiver, "-NOGROUP the consumer group this client was blocked on no longer exists")
+				unblockClient(receiver)
+				continue
+			}
+			*gt = group.lastID
+		}
+
+		if streamCompareID(&s.lastID, gt) <= 0 {
+			continue
+		}
+		start := *gt
+		streamIncrID(&start)
+
+		var consumer *streamConsumer
+		flags := 0
+		if group != nil {
+			if receiver.bpop.xReadGroupNoAck != 0 {
+				flags |= streamRwrNoAck
+			}
+			name := *(*sds.SDS)(receiver.bpop.xReadConsumer.ptr)
+			if consumer = streamLookupConsumer(group, name, true); consumer == nil {
+				consumer = streamCreateConsumer(group, name, rl.key, rl.db.id)
+			}
+		}
+
+		// 只有一个key，回复一个只有一个元素的数组(RESP3为map)
+		if receiver.resp == 2 {
+			addReplyArrayLen(receiver, 1)
+			addReplyArrayLen(receiver, 2)
+		} else {
+			addReplyMapLen(receiver, 1)
+		}
+		addReplyBulk(receiver, rl.key)
+		streamReplyWithRange(receiver, s, &start, nil, int64(receiver.bpop.xReadCount), false, group, consumer, flags)
+
+		// unblockClient之后gt和receiver.bpop中的其它字段都不能再使用了
+		unblockClient(receiver)
+	}
+}
+
+// handleClientsBlockedOnKeys 服务阻塞在server.readyKeys中的key上的客户端。
+// 在每个命令执行之后以及beforeSleep中调用。服务客户端的过程中可能会产生新的就绪key（比如BLMOVE），
+// 所以要一直循环直到server.readyKeys为空
+func handleClientsBlockedOnKeys() {
+	for server.readyKeys.Len() != 0 {
+		l := server.readyKeys
+		server.readyKeys = adlist.Create()
+
+		// 服务客户端期间不让key过期，保证看到的数据是一致的
+		server.fixedTimeExpire++
+		updateCachedTime(0)
+
+		for l.Len() != 0 {
+			ln := l.First()
+			rl := ln.NodeValue().(*readyList)
+
+			// 先从db.readyKeys中删除，后续针对这个key的操作可以再次加入
+			rl.db.readyKeys.Delete(unsafe.Pointer(rl.key))
+
+			o := rl.db.lookupKeyWrite(rl.key)
+			if o != nil {
+				if o.getType() == ObjList {
+					serveClientsBlockedOnListKey(o, rl)
+				} else if o.getType() == ObjStream {
+					serveClientsBlockedOnStreamKey(o, rl)
+				}
+			}
+
+			rl.key.decrRefCount()
+			l.DelNode(ln)
+		}
+		server.fixedTimeExpire--
+		l.Release()
+	}
+}
+
+// blockForKeys 把客户端阻塞在keys上，直到有数据或者超时。
+// timeout为毫秒时间戳，0表示永不超时；target是BLMOVE的目标key；listPos是弹出和推入的位置；
+// count是BLMPOP一次弹出的元素个数；ids是XREAD在每个key上等待的ID，只返回比它大的元素
+func blockForKeys(c *Client, btype int, keys []*robj, count int, timeout int64, target *robj, listPos *blockPos, ids []streamID) {
+	c.bpop.timeout = timeout
+	c.bpop.target = target
+	c.bpop.count = count
+	if listPos != nil {
+		c.bpop.listPos = *listPos
+	}
+	if target != nil {
+		target.incrRefCount()
+	}
+
+	for j, key := range keys {
+		// stream需要记录等待的ID
+		var kid unsafe.Pointer
+		if btype == BLOCKED_STREAM {
+			id := ids[j]
+			kid = unsafe.Pointer(&id)
+		}
+
+		// 同一个key只阻塞一次
+		if !c.bpop.keys.Add(unsafe.Pointer(key), kid) {
+			continue
+		}
+		key.incrRefCount()
+
+		// 在db.blockingKeys中记录key上阻塞的客户端
+		var l *adlist.List
+		de := c.db.blockingKeys.Find(unsafe.Pointer(key))
+		if de == nil {
+			l = adlist.Create()
+			c.db.blockingKeys.Add(unsafe.Pointer(key), unsafe.Pointer(l))
+			key.incrRefCount()
+		} else {
+			l = (*adlist.List)(dict.GetVal(de))
+		}
+		l.AddNodeTail(c)
+	}
+	blockClient(c, btype)
+}
+
+// unblockClientWaitingData 把客户端从阻塞的key上移除
+func unblockClientWaitingData(c *Client) {
+	if c.bpop.keys.Size() == 0 {
+		return
+	}
+
+	di := c.bpop.keys.GetIterator()
+	for de := di.Next(); de != nil; de = di.Next() {
+		key := (*robj)(dict.GetKey(de))
+
+		l := (*adlist.List)(c.db.blockingKeys.FetchValue(unsafe.Pointer(key)))
+		if l == nil {
+			panic("blocking key without clients")
+		}
+		l.DelNode(l.SearchKey(c))
+		// 没有客户端阻塞在key上了，删除key
+		if l.Len() == 0 {
+			c.db.blockingKeys.Delete(unsafe.Pointer(key))
+		}
+	}
+	di.Release()
+	c.bpop.keys = dict.Create(objectKeyPointValueDictType, nil)
+
+	if c.bpop.target != nil {
+		c.bpop.target.decrRefCount()
+		c.bpop.target = nil
+	}
+	if c.bpop.xReadGroup != nil {
+		c.bpop.xReadGroup.decrRefCount()
+		c.bpop.xReadConsumer.decrRefCount()
+		c.bpop.xReadGroup = nil
+		c.bpop.xReadConsumer = nil
+	}
+}
+
+// signalKeyAsReady 如果有客户端阻塞在key上，把key放到server.readyKeys中，
+// 由handleClientsBlockedOnKeys统一处理
 func signalKeyAsReady(db *redisDb, key *robj) {
-	if db.blockingKeys.FetchValue(unsafe.Pointer(key)) == nil {
+	// 没有客户端阻塞在这个key上
+	if db.blockingKeys.Find(unsafe.Pointer(key)) == nil {
 		return
 	}
 
-	if db.readyKeys.FetchValue(unsafe.Pointer(key)) != nil {
+	// 已经在就绪队列中了
+	if db.readyKeys.Find(unsafe.Pointer(key)) != nil {
 		return
 	}
 
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestBlockingPopServeOrder(t *testing.T) {
+	testServerInit()
+	c1, c2, c3, c4 := testClient(), testClient(), testClient(), testClient()
+
+	// 先阻塞的客户端先被服务
+	for _, c := range []*Client{c1, c2, c3} {
+		if reply := testCommand(c, "blpop", "nokey", "list", "0"); reply != "" || c.flags&CLIENT_BLOCKED == 0 {
+			t.Fatalf("client should be blocked, got %q", reply)
+		}
+	}
+	if server.blockedClients != 3 {
+		t.Fatalf("expect 3 blocked clients, got %d", server.blockedClients)
+	}
+
+	dirty := server.dirty
+	testRun(t, c4, []testCase{{"rpush list a b", ":2"}})
+	if reply := testReply(c1); reply != "[list a]" {
+		t.Fatalf("c1: expect [list a], got %q", reply)
+	}
+	if reply := testReply(c2); reply != "[list b]" {
+		t.Fatalf("c2: expect [list b], got %q", reply)
+	}
+	if reply := testReply(c3); reply != "" || c3.flags&CLIENT_BLOCKED == 0 {
+		t.Fatalf("c3 should still be blocked, got %q", reply)
+	}
+	// RPUSH和两次弹出
+	if server.dirty != dirty+4 {
+		t.Fatalf("expect dirty %d, got %d", dirty+4, server.dirty)
+	}
+	testRun(t, c4, []testCase{{"exists list", ":0"}})
+
+	// BLMOVE推入目标list之后，阻塞在目标list上的客户端也会被服务
+	testRun(t, c1, []testCase{{"blmove src dst right left 0", ""}})
+	testRun(t, c2, []testCase{{"blpop dst 0", ""}})
+	testRun(t, c4, []testCase{
+		{"rpush src x y", ":2"},
+		{"lrange src 0 -1", "[x]"},
+		{"lrange dst 0 -1", "[]"},
+	})
+	if reply := testReply(c1); reply != "y" {
+		t.Fatalf("c1: expect y, got %q", reply)
+	}
+	if reply := testReply(c2); reply != "[dst y]" {
+		t.Fatalf("c2: expect [dst y], got %q", reply)
+	}
+
+	// BLMPOP一次弹出多个元素
+	testRun(t, c2, []testCase{{"blmpop 0 2 nokey list2 right count 2", ""}})
+	testRun(t, c4, []testCase{{"lpush list2 a b c", ":3"}})
+	if reply := testReply(c2); reply != "[list2 [a b]]" {
+		t.Fatalf("c2: expect [list2 [a b]], got %q", reply)
+	}
+
+	// 目标key类型不对时回复错误，源list保持不变
+	testRun(t, c1, []testCase{{"blmove src2 str left left 0", ""}})
+	testRun(t, c4, []testCase{
+		{"set str x", "+OK"},
+		{"rpush src2 a", ":1"},
+		{"lrange src2 0 -1", "[a]"},
+		{"rpush list c", ":1"},
+	})
+	if reply := testReply(c1); reply != "-WRONGTYPE Operation against a key holding the wrong kind of value" {
+		t.Fatalf("c1: unexpected reply %q", reply)
+	}
+	if reply := testReply(c3); reply != "[list c]" {
+		t.Fatalf("c3: expect [list c], got %q", reply)
+	}
+
+	if server.blockedClients != 0 || server.db[0].blockingKeys.Size() != 0 {
+		t.Fatalf("all clients should be unblocked, %d blocked on %d keys",
+			server.blockedClients, server.db[0].blockingKeys.Size())
+	}
+}
+
+func TestBlockingPopTimeout(t *testing.T) {
+	testServerInit()
+	c1, c2, c3 := testClient(), testClient(), testClient()
+
+	testRun(t, c1, []testCase{{"blpop list 0.01", ""}})
+	testRun(t, c2, []testCase{{"brpop list 100", ""}})
+	testRun(t, c3, []testCase{{"blpop list 0", ""}})
+	// 永不超时的客户端不在超时表中
+	if raxSize(server.clientsTimeoutTable) != 2 {
+		t.Fatalf("expect 2 clients in timeout table, got %d", raxSize(server.clientsTimeoutTable))
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	handleBlockedClientsTimeout()
+	if reply := testReply(c1); reply != "(nil)" || c1.flags&CLIENT_BLOCKED > 0 {
+		t.Fatalf("c1 should time out, got %q", reply)
+	}
+	if c2.flags&CLIENT_BLOCKED == 0 || c3.flags&CLIENT_BLOCKED == 0 {
+		t.Fatal("c2 and c3 should still be blocked")
+	}
+	if raxSize(server.clientsTimeoutTable) != 1 || c1.flags&CLIENT_IN_TO_TABLE > 0 {
+		t.Fatal("c1 should be removed from timeout table")
+	}
+
+	// 被服务的客户端也要从超时表中移除
+	testRun(t, testClient(), []testCase{{"rpush list a b", ":2"}})
+	if reply := testReply(c2); reply != "[list b]" {
+		t.Fatalf("c2: expect [list b], got %q", reply)
+	}
+	if reply := testReply(c3); reply != "[list a]" {
+		t.Fatalf("c3: expect [list a], got %q", reply)
+	}
+	if raxSize(server.clientsTimeoutTable) != 0 {
+		t.Fatalf("timeout table should be empty, got %d", raxSize(server.clientsTimeoutTable))
+	}
+
+	testRun(t, c1, []testCase{
+		{"blpop list -1", "-ERR timeout is negative"},
+		{"blpop list x", "-ERR timeout is not a float or out of range"},
+		{"blmove a b up left 0", "-ERR syntax error"},
+	})
+}
+
+func TestBlockedClientFree(t *testing.T) {
+	testServerInit()
+	c1, c2 := testClient(), testClient()
+
+	testRun(t, c1, []testCase{{"blpop list other 10", ""}})
+	testRun(t, c2, []testCase{{"blpop list 0", ""}})
+	freeClientAsync(c1)
+
+	db := server.db[0]
+	if db.blockingKeys.Find(unsafe.Pointer(createStringObject("other"))) != nil {
+		t.Fatal("freed client should be removed from blocking keys")
+	}
+	if server.blockedClients != 1 || raxSize(server.clientsTimeoutTable) != 0 {
+		t.Fatalf("expect 1 blocked client and empty timeout table, got %d and %d",
+			server.blockedClients, raxSize(server.clientsTimeoutTable))
+	}
+
+	// 只有c2被服务
+	testRun(t, testClient(), []testCase{{"rpush list a b", ":2"}})
+	if reply := testReply(c2); reply != "[list a]" {
+		t.Fatalf("c2: expect [list a], got %q", reply)
+	}
+	testRun(t, c2, []testCase{{"lrange list 0 -1", "[b]"}})
+}
+
+func TestBlockingPopServedByMove(t *testing.T) {
+	testServerInit()
+	c1, c2, c3 := testClient(), testClient(), testClient()
+
+	// LMOVE推入空的目标list时唤醒阻塞在目标list上的客户端
+	testRun(t, c1, []testCase{{"blpop dst 0", ""}})
+	testRun(t, c3, []testCase{
+		{"rpush src a b", ":2"},
+		{"lmove src dst left right", "a"},
+	})
+	if reply := testReply(c1); reply != "[dst a]" {
+		t.Fatalf("c1: expect [dst a], got %q", reply)
+	}
+	testRun(t, c3, []testCase{{"exists dst", ":0"}})
+
+	// RPOPLPUSH同样会唤醒，被唤醒的客户端的BLMOVE又可以唤醒下一个
+	testRun(t, c1, []testCase{{"blmove dst dst2 left left 0", ""}})
+	testRun(t, c2, []testCase{{"brpop dst2 0", ""}})
+	testRun(t, c3, []testCase{{"rpoplpush src dst", "b"}})
+	if reply := testReply(c1); reply != "b" {
+		t.Fatalf("c1: expect b, got %q", reply)
+	}
+	if reply := testReply(c2); reply != "[dst2 b]" {
+		t.Fatalf("c2: expect [dst2 b], got %q", reply)
+	}
+	testRun(t, c3, []testCase{{"exists src dst dst2", ":0"}})
+
+	// 空字符串元素
+	testRun(t, c1, []testCase{{"blpop e 0", ""}})
+	testRun(t, c2, []testCase{{"blmove e2 e3 right left 0", ""}})
+	if reply := testCommand(c3, "rpush", "e", "", "x"); reply != ":2" {
+		t.Fatalf("expect :2, got %q", reply)
+	}
+	if reply := testReply(c1); reply != "[e ]" {
+		t.Fatalf("c1: expect [e ], got %q", reply)
+	}
+	if reply := testCommand(c3, "rpush", "e2", ""); reply != ":1" {
+		t.Fatalf("expect :1, got %q", reply)
+	}
+	if reply := testReply(c2); reply != "" || c2.flags&CLIENT_BLOCKED > 0 {
+		t.Fatalf("c2: expect empty string, got %q", reply)
+	}
+	testRun(t, c3, []testCase{
+		{"llen e3", ":1"},
+		{"lpop e3", ""},
+		{"lrange e 0 -1", "[x]"},
+	})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// configType 不同类型的配置项如何解析、校验和输出值
+type configType interface {
+	init()                            // 设置默认值
+	set(val string, err *string) bool // 解析并设置新的值，失败时通过err返回原因
+	get() string                      // 以配置文件中的格式返回当前值
+}
+
+// standardConfig 一个可以通过配置文件和CONFIG GET/SET修改的配置项
+type standardConfig struct {
+	name string
+	data configType
+}
+
+// boolConfig yes/no类型的配置项。server会被重新创建，所以通过函数取得字段的地址
+type boolConfig struct {
+	config     func() *bool
+	defaultVal bool
+}
+
+func (b *boolConfig) init() {
+	*b.config() = b.defaultVal
+}
+
+func (b *boolConfig) set(val string, err *string) bool {
+	switch {
+	case util.StrCaseCmp(val, "yes"):
+		*b.config() = true
+	case util.StrCaseCmp(val, "no"):
+		*b.config() = false
+	default:
+		*err = "argument must be 'yes' or 'no'"
+		return false
+	}
+	return true
+}
+
+func (b *boolConfig) get() string {
+	if *b.config() {
+		return "yes"
+	}
+	return "no"
+}
+
+func createBoolConfig(name string, config func() *bool, defaultVal bool) standardConfig {
+	return standardConfig{name: name, data: &boolConfig{config: config, defaultVal: defaultVal}}
+}
+
+// configEnum 枚举类型配置项的一个取值
+type configEnum struct {
+	name string
+	val  int
+}
+
+// enumConfig 从固定的几个取值中选择一个的配置项
+type enumConfig struct {
+	config     func() *int
+	enum       []configEnum
+	defaultVal int
+}
+
+func (e *enumConfig) init() {
+	*e.config() = e.defaultVal
+}
+
+func (e *enumConfig) set(val string, err *string) bool {
+	for _, ev := range e.enum {
+		if util.StrCaseCmp(val, ev.name) {
+			*e.config() = ev.val
+			return true
+		}
+	}
+	names := make([]string, len(e.enum))
+	for i, ev := range e.enum {
+		names[i] = "'" + ev.name + "'"
+	}
+	*err = "argument(s) must be one of the following: " + strings.Join(names, ", ")
+	return false
+}
+
+func (e *enumConfig) get() string {
+	for _, ev := range e.enum {
+		if ev.val == *e.config() {
+			return ev.name
+		}
+	}
+	return "unknown"
+}
+
+func createEnumConfig(name string, config func() *int, enum []configEnum, defaultVal int) standardConfig {
+	return standardConfig{name: name, data: &enumConfig{config: config, enum: enum, defaultVal: defaultVal}}
+}
+
+// intConfig 取值范围在[lower, upper]之间的整数配置项
+type intConfig struct {
+	config       func() *int
+	lower, upper int
+	defaultVal   int
+}
+
+func (n *intConfig) init() {
+	*n.config() = n.defaultVal
+}
+
+func (n *intConfig) set(val string, err *string) bool {
+	ll, e := strconv.ParseInt(val, 10, 64)
+	if e != nil {
+		*err = "argument couldn't be parsed into an integer"
+		return false
+	}
+	if ll < int64(n.lower) || ll > int64(n.upper) {
+		*err = fmt.Sprintf("argument must be between %d and %d inclusive", n.lower, n.upper)
+		return false
+	}
+	*n.config() = int(ll)
+	return true
+}
+
+func (n *intConfig) get() string {
+	return strconv.Itoa(*n.config())
+}
+
+func createIntConfig(name string, config func() *int, lower, upper, defaultVal int) standardConfig {
+	return standardConfig{name: name, data: &intConfig{config: config, lower: lower, upper: upper, defaultVal: defaultVal}}
+}
+
+var maxmemoryPolicyEnum = []configEnum{
+	{"volatile-lru", MaxMemoryVolatileLru},
+	{"volatile-lfu", MaxMemoryVolatileLfu},
+	{"volatile-random", MaxMemoryVolatileRandom},
+	{"volatile-ttl", MaxMemoryVolatileTtl},
+	{"allkeys-lru", MaxMemoryAllKeysLru},
+	{"allkeys-lfu", MaxMemoryAllKeysLfu},
+	{"allkeys-random", MaxMemoryAllKeysRandom},
+	{"noeviction", MaxMemoryNoEviction},
+}
+
+var configs = []standardConfig{
+	createBoolConfig("lazyfree-lazy-expire", func() *bool { return &server.lazyFreeLazyExpire }, false),
+	createBoolConfig("lazyfree-lazy-server-del", func() *bool { return &server.lazyFreeLazyServerDel }, false),
+	createBoolConfig("lazyfree-lazy-user-del", func() *bool { return &server.lazyFreeLazyUserDel }, false),
+	createBoolConfig("lazyfree-lazy-user-flush", func() *bool { return &server.lazyFreeLazyUserFlush }, false),
+	createEnumConfig("maxmemory-policy", func() *int { return &server.maxMemoryPolicy }, maxmemoryPolicyEnum, MaxMemoryNoEviction),
+	createIntConfig("lfu-log-factor", func() *int { return &server.lfuLogFactor }, 0, math.MaxInt32, 10),
+	createIntConfig("lfu-decay-time", func() *int { return &server.lfuDecayTime }, 0, math.MaxInt32, 1),
+}
+
+// initConfigValues 把所有的配置项设置成默认值
+func initConfigValues() {
+	for i := range configs {
+		configs[i].data.init()
+	}
+}
+
+// lookupConfig 按名字查找配置项，名字不区分大小写
+func lookupConfig(name string) *standardConfig {
+	for i := range configs {
+		if util.StrCaseCmp(name, configs[i].name) {
+			return &configs[i]
+		}
+	}
+	return nil
+}
+
+// loadServerConfig 加载配置文件，每行是一个配置项和它的值，#开头的行是注释。
+// 配置文件有错误时直接退出
+func loadServerConfig(filename string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Printf("Fatal error, can't open config file '%s': %v", filename, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for linenum := 1; scanner.Scan(); linenum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		argv := strings.Fields(line)
+		var errMsg string
+		if config := lookupConfig(argv[0]); config == nil {
+			errMsg = "Bad directive or wrong number of arguments"
+		} else if len(argv) != 2 {
+			errMsg = "wrong number of arguments"
+		} else {
+			config.data.set(argv[1], &errMsg)
+		}
+		if errMsg != "" {
+			log.Printf("*** FATAL CONFIG FILE ERROR ***\nReading the configuration file, at line %d\n>>> '%s'\n%s",
+				linenum, line, errMsg)
+			os.Exit(1)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Fatal error, can't read config file '%s': %v", filename, err)
+		os.Exit(1)
+	}
+}
+
+// configGetCommand CONFIG GET parameter [parameter ...]，参数支持glob风格的模式
+func configGetCommand(c *Client) {
+	matches := make(map[*standardConfig]bool)
+	var replies []*standardConfig
+	for i := 2; i < c.argc; i++ {
+		pattern := (*sds.SDS)(c.argv[i].ptr).BufData(0)
+		for j := range configs {
+			config := &configs[j]
+			if matches[config] || !util.StringMatchLen(pattern, []byte(config.name), true) {
+				continue
+			}
+			matches[config] = true
+			replies = append(replies, config)
+		}
+	}
+
+	addReplyMapLen(c, len(replies))
+	for _, config := range replies {
+		addReplyBulkCString(c, config.name)
+		addReplyBulkCString(c, config.data.get())
+	}
+}
+
+// configSetCommand CONFIG SET parameter value [parameter value ...]。
+// 任何一个配置项设置失败时，已经设置的配置项恢复成原来的值
+func configSetCommand(c *Client) {
+	if c.argc < 4 || c.argc%2 != 0 {
+		addReplySubcommandSyntaxError(c)
+		return
+	}
+
+	n := (c.argc - 2) / 2
+	setConfigs := make([]*standardConfig, n)
+	newVals := make([]string, n)
+	oldVals := make([]string, n)
+	for i := 0; i < n; i++ {
+		name := string((*sds.SDS)(c.argv[2+i*2].ptr).BufData(0))
+		config := lookupConfig(name)
+		if config == nil {
+			addReplyErrorFormat(c, "Unknown option or number of arguments for CONFIG SET - '%s'", name)
+			return
+		}
+		for j := 0; j < i; j++ {
+			if setConfigs[j] == config {
+				addReplyErrorFormat(c, "CONFIG SET failed (possibly related to argument '%s') - duplicate parameter", name)
+				return
+			}
+		}
+		setConfigs[i] = config
+		newVals[i] = string((*sds.SDS)(c.argv[3+i*2].ptr).BufData(0))
+		oldVals[i] = config.data.get()
+	}
+
+	for i, config := range setConfigs {
+		var errMsg string
+		if !config.data.set(newVals[i], &errMsg) {
+			var ignored string
+			for j := 0; j < i; j++ {
+				setConfigs[j].data.set(oldVals[j], &ignored)
+			}
+			addReplyErrorFormat(c, "CONFIG SET failed (possibly related to argument '%s') - %s", config.name, errMsg)
+			return
+		}
+	}
+	addReply(c, shared.ok)
+}
+
+// CONFIG <subcommand> [<arg> ...]
+func configCommand(c *Client) {
+	opt := (*sds.SDS)(c.argv[1].ptr).BufData(0)
+	if c.argc == 2 && util.StrCaseCmp(opt, "help") {
+		addReplyHelp(c, []string{
+			"GET <pattern>",
+			"    Return parameters matching the glob-like <pattern> and their values.",
+			"SET <directive> <value>",
+			"    Set the configuration <directive> to <value>.",
+		})
+	} else if util.StrCaseCmp(opt, "get") && c.argc >= 3 {
+		configGetCommand(c)
+	} else if util.StrCaseCmp(opt, "set") {
+		configSetCommand(c)
+	} else {
+		addReplySubcommandSyntaxError(c)
+	}
+}
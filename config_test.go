@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/pengdafu/redis-golang/dict"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestConfigCommand(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"config get lazyfree-lazy-expire", "[lazyfree-lazy-expire no]"},
+		{"config get nomatch*", "[]"},
+		{"config get lazyfree-lazy-user-* LAZYFREE-LAZY-USER-DEL",
+			"[lazyfree-lazy-user-del no lazyfree-lazy-user-flush no]"},
+		{"config set lazyfree-lazy-expire yes", "+OK"},
+		{"config set LAZYFREE-LAZY-USER-DEL Yes lazyfree-lazy-user-flush yes", "+OK"},
+		{"config get lazyfree-lazy-*", "[lazyfree-lazy-expire yes lazyfree-lazy-server-del no " +
+			"lazyfree-lazy-user-del yes lazyfree-lazy-user-flush yes]"},
+
+		// 任何一个失败时，整个CONFIG SET都不生效
+		{"config set lazyfree-lazy-server-del yes lazyfree-lazy-expire maybe",
+			"-ERR CONFIG SET failed (possibly related to argument 'lazyfree-lazy-expire') - argument must be 'yes' or 'no'"},
+		{"config get lazyfree-lazy-server-del", "[lazyfree-lazy-server-del no]"},
+		{"config set lazyfree-lazy-expire no lazyfree-lazy-expire yes",
+			"-ERR CONFIG SET failed (possibly related to argument 'lazyfree-lazy-expire') - duplicate parameter"},
+		{"config set nosuchconfig yes", "-ERR Unknown option or number of arguments for CONFIG SET - 'nosuchconfig'"},
+		{"config set lazyfree-lazy-expire", "-ERR unknown subcommand or wrong number of arguments for 'set'. Try CONFIG HELP."},
+		{"config get", "-ERR unknown subcommand or wrong number of arguments for 'get'. Try CONFIG HELP."},
+		{"config nosuchsub", "-ERR unknown subcommand or wrong number of arguments for 'nosuchsub'. Try CONFIG HELP."},
+	})
+	if !server.lazyFreeLazyExpire || !server.lazyFreeLazyUserDel || !server.lazyFreeLazyUserFlush || server.lazyFreeLazyServerDel {
+		t.Fatal("CONFIG SET should update server fields")
+	}
+
+	// 重新初始化时恢复默认值
+	testServerInit()
+	if server.lazyFreeLazyExpire || server.lazyFreeLazyUserDel {
+		t.Fatal("initServerConfig should reset configs to default values")
+	}
+}
+
+func TestLoadServerConfig(t *testing.T) {
+	testServerInit()
+	filename := filepath.Join(t.TempDir(), "redis.conf")
+	conf := "# lazyfree\n\nlazyfree-lazy-user-del yes\n  LAZYFREE-LAZY-EXPIRE   yes\nlazyfree-lazy-user-flush no\n"
+	if err := os.WriteFile(filename, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loadServerConfig(filename)
+	if !server.lazyFreeLazyUserDel || !server.lazyFreeLazyExpire || server.lazyFreeLazyUserFlush {
+		t.Fatal("config file should update server fields")
+	}
+}
+
+func TestLazyfreeUserDel(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	for i := 0; i < 200; i++ {
+		testCommand(c, "hset", "h", "f"+strconv.Itoa(i), "v")
+	}
+	testRun(t, c, []testCase{
+		{"hexpire h 100 fields 1 f0", "[:1]"},
+		{"object encoding h", "hashtable"},
+	})
+	o := c.db.lookupKeyRead(createStringObject("h"))
+	ht, fe := (*dict.Dict)(o.ptr), hashTypeFieldExpires(o)
+
+	// DEL在lazyfree-lazy-user-del打开时和UNLINK一样在后台释放value
+	freed := lazyfreeGetFreedObjectsCount()
+	testRun(t, c, []testCase{
+		{"config set lazyfree-lazy-user-del yes", "+OK"},
+		{"del h", ":1"},
+	})
+	lazyfreeWait(t)
+	if n := lazyfreeGetFreedObjectsCount() - freed; n != 1 {
+		t.Fatalf("expect 1 object freed in background, got %d", n)
+	}
+	if o.ptr != nil || ht.Size() != 0 || fe.Size() != 0 {
+		t.Fatal("lazyfree worker should release the hash table and field expires")
+	}
+
+	// 关闭之后DEL在主线程中直接删除
+	testRun(t, c, []testCase{
+		{"config set lazyfree-lazy-user-del no", "+OK"},
+		{"sadd s a", ":1"},
+		{"del s", ":1"},
+	})
+	if n := lazyfreeGetFreedObjectsCount() - freed; n != 1 {
+		t.Fatalf("expect no more objects freed in background, got %d", n-1)
+	}
+}
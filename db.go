@@ -3,20 +3,26 @@ package main
 import (
 	"github.com/pengdafu/redis-golang/adlist"
 	"github.com/pengdafu/redis-golang/dict"
+	"github.com/pengdafu/redis-golang/intset"
+	"github.com/pengdafu/redis-golang/listpack"
 	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+	"strconv"
 	"unsafe"
 )
 
 type redisDb struct {
-	dict          *dict.Dict
-	expires       *dict.Dict
-	blockingKeys  *dict.Dict
-	readyKeys     *dict.Dict
-	watchedKeys   *dict.Dict
-	id            int
-	avgTTL        int64
-	expiresCursor uint64
-	defragLater   *adlist.List
+	dict           *dict.Dict
+	expires        *dict.Dict
+	hexpires       *dict.Dict // 有field设置了过期时间的hash的key
+	blockingKeys   *dict.Dict
+	readyKeys      *dict.Dict
+	watchedKeys    *dict.Dict
+	id             int
+	avgTTL         int64
+	expiresCursor  uint64
+	hexpiresCursor uint64
+	defragLater    *adlist.List
 }
 
 func selectDb(c *Client, id int) error {
@@ -141,8 +147,11 @@ func signalModifiedKey(c *Client, db *redisDb, key *robj) {
 
 }
 
+// updateLFU 访问key时更新LFU数据：先按照时间衰减计数，再按照概率增加计数
 func updateLFU(val *robj) {
-	// todo
+	counter := LFUDecrAndReturn(val)
+	counter = LFULogIncr(counter)
+	val.setLru(uint32(LFUGetTimeInMinutes())<<8 | counter)
 }
 
 func (db *redisDb) genericSetKey(c *Client, key, val *robj, keepTtl, signal bool) {
@@ -160,6 +169,21 @@ func (db *redisDb) genericSetKey(c *Client, key, val *robj, keepTtl, signal bool
 	}
 }
 
+// dbUnshareStringValue 在原地修改字符串对象之前调用，如果对象是共享的或者不是raw编码，
+// 复制一个raw编码的对象替换掉原来的值并返回
+func (db *redisDb) dbUnshareStringValue(key, o *robj) *robj {
+	if o.getType() != ObjString {
+		panic("dbUnshareStringValue against non string object")
+	}
+	if o.refCount != 1 || o.getEncoding() != ObjEncodingRaw {
+		decoded := o.getDecodedObject()
+		o = createRawStringObject((*sds.SDS)(decoded.ptr).BufData(0))
+		decoded.decrRefCount()
+		db.dbOverwrite(key, o)
+	}
+	return o
+}
+
 func (db *redisDb) dbOverwrite(key, val *robj) {
 	de := db.dict.Find(key.ptr)
 	old := (*robj)(dict.GetVal(de))
@@ -168,10 +192,11 @@ func (db *redisDb) dbOverwrite(key, val *robj) {
 	}
 
 	db.dict.SetVal(de, unsafe.Pointer(val))
+	db.trackHashFieldExpires(key, val)
 }
 
-func (db *redisDb) removeExpire(key *robj) {
-	db.expires.Delete(key.ptr)
+func (db *redisDb) removeExpire(key *robj) bool {
+	return db.expires.Delete(key.ptr)
 }
 
 // todo
@@ -182,6 +207,7 @@ func (db *redisDb) signalModifiedKey(c *Client, key *robj) {
 func (db *redisDb) dbAdd(key, val *robj) {
 	dup := sds.Dup(*(*sds.SDS)(key.ptr))
 	db.dict.Add(unsafe.Pointer(&dup), unsafe.Pointer(val))
+	db.trackHashFieldExpires(key, val)
 
 	if val.getType() == ObjList ||
 		val.getType() == ObjZSet ||
@@ -217,6 +243,18 @@ func (db *redisDb) setExpire(c *Client, key *robj, when int64) {
 	//}
 }
 
+// trackHashFieldExpires val是有field设置了过期时间的hash时，把key记录到db.hexpires中，
+// activeExpireCycle会定期检查这些key
+func (db *redisDb) trackHashFieldExpires(key, val *robj) {
+	if val.getType() != ObjHash || hashTypeFieldExpires(val) == nil {
+		return
+	}
+	if db.hexpires.Find(key.ptr) == nil {
+		dup := sds.Dup(*(*sds.SDS)(key.ptr))
+		db.hexpires.Add(unsafe.Pointer(&dup), nil)
+	}
+}
+
 func lookupKeyReadOrReply(c *Client, key, reply *robj) *robj {
 	o := c.db.lookupKeyRead(key)
 	if o == nil {
@@ -237,10 +275,17 @@ func (db *redisDb) lookupKeyRead(key *robj) *robj {
 	return db.lookupKeyWriteWithFlags(key, lookupNone)
 }
 
+func (db *redisDb) lookupKeyReadWithFlags(key *robj, flags int) *robj {
+	return db.lookupKeyWriteWithFlags(key, flags)
+}
+
 func dbSyncDelete(db *redisDb, key *robj) bool {
 	if db.expires.Size() > 0 {
 		db.expires.Delete(key.ptr)
 	}
+	if db.hexpires.Size() > 0 {
+		db.hexpires.Delete(key.ptr)
+	}
 	if db.dict.Delete(key.ptr) {
 		if server.clusterEnabled {
 			slotToKeyDel(key.ptr)
@@ -258,6 +303,82 @@ func dbDelete(db *redisDb, key *robj) bool {
 	}
 }
 
+// emptyData的flags
+const (
+	emptyDbNoFlags   = 0
+	emptyDbAsyncFlag = 1 << 0 // 在后台goroutine中释放数据
+)
+
+// emptyDbStructure 清空dbnum对应的db，dbnum为-1时清空所有的db，返回删除的key的数量
+func emptyDbStructure(dbarray []*redisDb, dbnum int, async bool, callback func()) int64 {
+	removed := int64(0)
+	startdb, enddb := dbnum, dbnum
+	if dbnum == -1 {
+		startdb, enddb = 0, server.dbnum-1
+	}
+
+	for j := startdb; j <= enddb; j++ {
+		db := dbarray[j]
+		removed += db.dict.Size()
+		if async {
+			emptyDbAsync(db)
+		} else {
+			db.dict.Empty(callback)
+			db.expires.Empty(callback)
+			db.hexpires.Empty(callback)
+		}
+		db.avgTTL = 0
+		db.expiresCursor = 0
+		db.hexpiresCursor = 0
+	}
+	return removed
+}
+
+// emptyData 清空dbnum对应的db，dbnum为-1时清空所有的db。
+// 返回删除的key的数量，dbnum不合法时返回-1
+func emptyData(dbnum int, flags int, callback func()) int64 {
+	if dbnum < -1 || dbnum >= server.dbnum {
+		return -1
+	}
+
+	return emptyDbStructure(server.db, dbnum, flags&emptyDbAsyncFlag != 0, callback)
+}
+
+// dbSwapDatabases 交换两个db中的数据，阻塞的客户端、WATCH的key仍然留在原来的db中
+func dbSwapDatabases(id1, id2 int) error {
+	if id1 < 0 || id1 >= server.dbnum || id2 < 0 || id2 >= server.dbnum {
+		return C_ERR
+	}
+	if id1 == id2 {
+		return C_OK
+	}
+
+	db1, db2 := server.db[id1], server.db[id2]
+	db1.dict, db2.dict = db2.dict, db1.dict
+	db1.expires, db2.expires = db2.expires, db1.expires
+	db1.hexpires, db2.hexpires = db2.hexpires, db1.hexpires
+	db1.avgTTL, db2.avgTTL = db2.avgTTL, db1.avgTTL
+	db1.expiresCursor, db2.expiresCursor = db2.expiresCursor, db1.expiresCursor
+	db1.hexpiresCursor, db2.hexpiresCursor = db2.hexpiresCursor, db1.hexpiresCursor
+
+	// 交换之后阻塞等待的key可能在另一个db中已经存在了，需要唤醒这些客户端
+	scanDatabaseForReadyKeys(db1)
+	scanDatabaseForReadyKeys(db2)
+	return C_OK
+}
+
+// scanDatabaseForReadyKeys 把db中有客户端阻塞等待并且已经存在的key标记为就绪
+func scanDatabaseForReadyKeys(db *redisDb) {
+	di := db.blockingKeys.GetSafeIterator()
+	for de := di.Next(); de != nil; de = di.Next() {
+		key := (*robj)(dict.GetKey(de))
+		if db.dict.Find(key.ptr) != nil {
+			signalKeyAsReady(db, key)
+		}
+	}
+	di.Release()
+}
+
 /* ------ */
 
 func selectCommand(c *Client) {
@@ -277,3 +398,655 @@ func selectCommand(c *Client) {
 	}
 	addReply(c, shared.ok)
 }
+
+// dbRandomKey 随机返回一个没有过期的key，db为空时返回nil
+func dbRandomKey(db *redisDb) *robj {
+	maxtries := 100
+	allvolatile := db.dict.Size() == db.expires.Size()
+
+	for {
+		de := db.dict.GetFairRandomKey()
+		if de == nil {
+			return nil
+		}
+
+		key := *(*sds.SDS)(dict.GetKey(de))
+		keyobj := createStringObject(util.Bytes2String(key.BufData(0)))
+		if db.expires.Find(unsafe.Pointer(&key)) != nil {
+			// 从节点不会删除过期的key，如果所有的key都设置了过期时间，
+			// 可能全部都已经过期了，尝试一定次数之后直接返回，避免死循环
+			maxtries--
+			if allvolatile && server.masterhost != "" && maxtries == 0 {
+				return keyobj
+			}
+			if db.expireIfNeeded(keyobj) {
+				keyobj.decrRefCount()
+				continue
+			}
+		}
+		return keyobj
+	}
+}
+
+// EXISTS key [key ...]
+func existsCommand(c *Client) {
+	count := 0
+	for j := 1; j < c.argc; j++ {
+		if c.db.lookupKeyReadWithFlags(c.argv[j], lookupNoTouch) != nil {
+			count++
+		}
+	}
+	addReplyLongLong(c, count)
+}
+
+// RANDOMKEY
+func randomkeyCommand(c *Client) {
+	key := dbRandomKey(c.db)
+	if key == nil {
+		addReplyNull(c)
+		return
+	}
+	addReplyBulk(c, key)
+	key.decrRefCount()
+}
+
+// KEYS pattern
+func keysCommand(c *Client) {
+	pattern := (*sds.SDS)(c.argv[1].ptr).BufData(0)
+	allkeys := len(pattern) == 1 && pattern[0] == '*'
+	numkeys := 0
+	replylen := addReplyDeferredLen(c)
+
+	di := c.db.dict.GetIterator()
+	for de := di.Next(); de != nil; de = di.Next() {
+		key := (*sds.SDS)(dict.GetKey(de)).BufData(0)
+		if allkeys || util.StringMatchLen(pattern, key, false) {
+			keyobj := createStringObject(util.Bytes2String(key))
+			if !c.db.keyIsExpired(keyobj) {
+				addReplyBulk(c, keyobj)
+				numkeys++
+			}
+			keyobj.decrRefCount()
+		}
+	}
+	di.Release()
+	setDeferredArrayLen(c, replylen, numkeys)
+}
+
+// getObjectTypeName 返回TYPE命令使用的类型名称，o为nil时返回none
+func getObjectTypeName(o *robj) string {
+	if o == nil {
+		return "none"
+	}
+	switch o.getType() {
+	case ObjString:
+		return "string"
+	case ObjList:
+		return "list"
+	case ObjSet:
+		return "set"
+	case ObjZSet:
+		return "zset"
+	case ObjHash:
+		return "hash"
+	case ObjStream:
+		return "stream"
+	case ObjModule:
+		return "module"
+	default:
+		return "unknown"
+	}
+}
+
+// parseScanCursorOrReply 解析SCAN的游标，游标是无符号整数
+func parseScanCursorOrReply(c *Client, o *robj, cursor *uint64) error {
+	buf := (*sds.SDS)(o.ptr).BufData(0)
+	v, err := strconv.ParseUint(util.Bytes2String(buf), 10, 64)
+	if err != nil {
+		addReplyError(c, "invalid cursor")
+		return C_ERR
+	}
+	*cursor = v
+	return C_OK
+}
+
+// scanCallback 把dict中的元素添加到keys中，hash和zset同时添加value
+func scanCallback(keys *[]*robj, o *robj, de *dict.Entry) {
+	var key, val *robj
+
+	if o == nil {
+		key = createRawStringObject((*sds.SDS)(dict.GetKey(de)).BufData(0))
+	} else if o.getType() == ObjSet {
+		key = createRawStringObject((*sds.SDS)(dict.GetKey(de)).BufData(0))
+	} else if o.getType() == ObjHash {
+		field := *(*sds.SDS)(dict.GetKey(de))
+		// 已经过期的field不返回
+		if hashTypeFieldIsExpired(o, field) {
+			return
+		}
+		key = createRawStringObject(field.BufData(0))
+		val = createRawStringObject((*sds.SDS)(dict.GetVal(de)).BufData(0))
+	} else if o.getType() == ObjZSet {
+		key = createRawStringObject((*sds.SDS)(dict.GetKey(de)).BufData(0))
+		val = createStringObjectFromLongDouble(*(*float64)(dict.GetVal(de)), false)
+	} else {
+		panic("Type not handled in SCAN callback.")
+	}
+
+	*keys = append(*keys, key)
+	if val != nil {
+		*keys = append(*keys, val)
+	}
+}
+
+// scanGenericCommand 实现SCAN、HSCAN、SSCAN和ZSCAN，o为nil时遍历当前db，
+// 否则o必须是set、zset或者hash。listpack和intset编码的对象元素很少，一次全部返回
+func scanGenericCommand(c *Client, o *robj, cursor uint64) {
+	var keys []*robj
+	count := int64(10)
+	var pat []byte
+	var typename []byte
+	usePattern := false
+
+	if o != nil && o.getType() != ObjSet && o.getType() != ObjHash && o.getType() != ObjZSet {
+		panic("scanGenericCommand against wrong type")
+	}
+
+	// 第一个选项的下标，前一个是游标
+	i := 2
+	if o != nil {
+		i = 3
+	}
+
+	// 1. 解析选项
+	for i < c.argc {
+		j := c.argc - i
+		opt := (*sds.SDS)(c.argv[i].ptr).BufData(0)
+		if util.StrCaseCmp(opt, "count") && j >= 2 {
+			if c.argv[i+1].getLongLongFromObjectOrReply(c, &count, "") != C_OK {
+				return
+			}
+			if count < 1 {
+				addReplyErrorObject(c, shared.syntaxErr)
+				return
+			}
+			i += 2
+		} else if util.StrCaseCmp(opt, "match") && j >= 2 {
+			pat = (*sds.SDS)(c.argv[i+1].ptr).BufData(0)
+			// "*"总是匹配，相当于没有指定
+			usePattern = !(len(pat) == 1 && pat[0] == '*')
+			i += 2
+		} else if util.StrCaseCmp(opt, "type") && o == nil && j >= 2 {
+			// 只有SCAN支持TYPE
+			typename = (*sds.SDS)(c.argv[i+1].ptr).BufData(0)
+			i += 2
+		} else {
+			addReplyErrorObject(c, shared.syntaxErr)
+			return
+		}
+	}
+
+	// 2. 遍历
+	var ht *dict.Dict
+	if o == nil {
+		ht = c.db.dict
+	} else if o.getType() == ObjSet && o.getEncoding() == ObjEncodingHt {
+		ht = (*dict.Dict)(o.ptr)
+	} else if o.getType() == ObjHash && o.getEncoding() == ObjEncodingHt {
+		ht = (*dict.Dict)(o.ptr)
+		count *= 2 // 同时返回field和value
+	} else if o.getType() == ObjZSet && o.getEncoding() == ObjEncodingSkipList {
+		ht = (*zset)(o.ptr).dict
+		count *= 2 // 同时返回member和score
+	}
+
+	if ht != nil {
+		// 最多遍历count*10个bucket，避免dict很稀疏的时候阻塞太久，代价是可能返回很少甚至没有元素
+		maxiterations := count * 10
+		for {
+			cursor = ht.Scan(cursor, func(de *dict.Entry) {
+				scanCallback(&keys, o, de)
+			})
+			maxiterations--
+			if cursor == 0 || maxiterations == 0 || int64(len(keys)) >= count {
+				break
+			}
+		}
+	} else if o.getType() == ObjSet && o.getEncoding() == ObjEncodingIntSet {
+		is := (*intset.IntSet)(o.ptr)
+		var ll int64
+		for pos := 0; is.Get(pos, &ll); pos++ {
+			keys = append(keys, createStringObjectFromLongLongWithOptions(ll, 0))
+		}
+		cursor = 0
+	} else if o.getEncoding() == ObjEncodingListPack {
+		lp := *(*[]byte)(o.ptr)
+		for p := listpack.First(lp); p != nil; p = listpack.Next(lp, p) {
+			keys = append(keys, createRawStringObject(listpackGetObject(p).BufData(0)))
+		}
+		cursor = 0
+	} else {
+		panic("Not handled encoding in SCAN.")
+	}
+
+	// 3. 过滤，hash和zset的元素是成对的，过滤掉key的时候value也要一起过滤
+	pairs := o != nil && (o.getType() == ObjZSet || o.getType() == ObjHash)
+	filtered := keys[:0]
+	for k := 0; k < len(keys); k++ {
+		kobj := keys[k]
+		filter := false
+
+		// 不匹配MATCH
+		if usePattern {
+			var buf []byte
+			if kobj.sdsEncodedObject() {
+				buf = (*sds.SDS)(kobj.ptr).BufData(0)
+			} else {
+				buf = []byte(strconv.FormatInt(int64(*(*int)(kobj.ptr)), 10))
+			}
+			if !util.StringMatchLen(pat, buf, false) {
+				filter = true
+			}
+		}
+
+		// 不是TYPE指定的类型
+		if !filter && o == nil && typename != nil {
+			typecheck := c.db.lookupKey(kobj, lookupNoTouch)
+			if !util.StrCaseCmp(typename, getObjectTypeName(typecheck)) {
+				filter = true
+			}
+		}
+
+		// 已经过期的key
+		if !filter && o == nil && c.db.expireIfNeeded(kobj) {
+			filter = true
+		}
+
+		if !filter {
+			filtered = append(filtered, kobj)
+		} else {
+			kobj.decrRefCount()
+		}
+
+		if pairs {
+			k++
+			if !filter {
+				filtered = append(filtered, keys[k])
+			} else {
+				keys[k].decrRefCount()
+			}
+		}
+	}
+	keys = filtered
+
+	// 4. 回复
+	addReplyArrayLen(c, 2)
+	addReplyBulkCString(c, strconv.FormatUint(cursor, 10))
+
+	addReplyArrayLen(c, len(keys))
+	for _, kobj := range keys {
+		addReplyBulk(c, kobj)
+		kobj.decrRefCount()
+	}
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func scanCommand(c *Client) {
+	var cursor uint64
+	if parseScanCursorOrReply(c, c.argv[1], &cursor) != C_OK {
+		return
+	}
+	scanGenericCommand(c, nil, cursor)
+}
+
+// DBSIZE
+func dbsizeCommand(c *Client) {
+	addReplyLongLong(c, int(c.db.dict.Size()))
+}
+
+// TYPE key
+func typeCommand(c *Client) {
+	o := c.db.lookupKeyReadWithFlags(c.argv[1], lookupNoTouch)
+	addReplyStatus(c, getObjectTypeName(o))
+}
+
+// renameGenericCommand 实现RENAME和RENAMENX，key的过期时间会转移到新的key上
+func renameGenericCommand(c *Client, nx bool) {
+	// 源key和目标key相同时，只需要检查key是否存在
+	samekey := sds.Cmp(*(*sds.SDS)(c.argv[1].ptr), *(*sds.SDS)(c.argv[2].ptr)) == 0
+
+	o := lookupKeyWriteOrReply(c, c.argv[1], shared.noKeyErr)
+	if o == nil {
+		return
+	}
+
+	if samekey {
+		if nx {
+			addReply(c, shared.czero)
+		} else {
+			addReply(c, shared.ok)
+		}
+		return
+	}
+
+	o.incrRefCount()
+	expire := c.db.getExpire(c.argv[1])
+	if c.db.lookupKeyWrite(c.argv[2]) != nil {
+		if nx {
+			o.decrRefCount()
+			addReply(c, shared.czero)
+			return
+		}
+		// 目标key存在时先删除，它的过期时间也会一起删除
+		dbDelete(c.db, c.argv[2])
+	}
+	c.db.dbAdd(c.argv[2], o)
+	if expire != -1 {
+		c.db.setExpire(c, c.argv[2], expire)
+	}
+	dbDelete(c.db, c.argv[1])
+	signalModifiedKey(c, c.db, c.argv[1])
+	signalModifiedKey(c, c.db, c.argv[2])
+	notifyKeySpaceEvent(notifyGeneric, "rename_from", c.argv[1], c.db.id)
+	notifyKeySpaceEvent(notifyGeneric, "rename_to", c.argv[2], c.db.id)
+	server.dirty++
+	if nx {
+		addReply(c, shared.cone)
+	} else {
+		addReply(c, shared.ok)
+	}
+}
+
+// RENAME key newkey
+func renameCommand(c *Client) {
+	renameGenericCommand(c, false)
+}
+
+// RENAMENX key newkey
+func renamenxCommand(c *Client) {
+	renameGenericCommand(c, true)
+}
+
+// MOVE key db
+func moveCommand(c *Client) {
+	if server.clusterEnabled {
+		addReplyError(c, "MOVE is not allowed in cluster mode")
+		return
+	}
+
+	// 获取源db和目标db
+	src := c.db
+	srcid := c.db.id
+	var dbid int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &dbid, "") != C_OK {
+		return
+	}
+	if selectDb(c, int(dbid)) == C_ERR {
+		addReplyError(c, "DB index is out of range")
+		return
+	}
+	dst := c.db
+	selectDb(c, srcid)
+
+	if src == dst {
+		addReplyErrorObject(c, shared.sameObjectErr)
+		return
+	}
+
+	o := c.db.lookupKeyWrite(c.argv[1])
+	if o == nil {
+		addReply(c, shared.czero)
+		return
+	}
+	expire := c.db.getExpire(c.argv[1])
+
+	// 目标db中已经存在这个key时不做任何操作
+	if dst.lookupKeyWrite(c.argv[1]) != nil {
+		addReply(c, shared.czero)
+		return
+	}
+	dst.dbAdd(c.argv[1], o)
+	if expire != -1 {
+		dst.setExpire(c, c.argv[1], expire)
+	}
+	o.incrRefCount()
+
+	dbDelete(src, c.argv[1])
+	signalModifiedKey(c, src, c.argv[1])
+	signalModifiedKey(c, dst, c.argv[1])
+	notifyKeySpaceEvent(notifyGeneric, "move_from", c.argv[1], src.id)
+	notifyKeySpaceEvent(notifyGeneric, "move_to", c.argv[1], dst.id)
+	server.dirty++
+	addReply(c, shared.cone)
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func copyCommand(c *Client) {
+	srcid := c.db.id
+	dbid := int64(c.db.id)
+	replace := false
+
+	for j := 3; j < c.argc; j++ {
+		additional := c.argc - j - 1
+		opt := (*sds.SDS)(c.argv[j].ptr).BufData(0)
+		if util.StrCaseCmp(opt, "replace") {
+			replace = true
+		} else if util.StrCaseCmp(opt, "db") && additional >= 1 {
+			if c.argv[j+1].getLongLongFromObjectOrReply(c, &dbid, "") != C_OK {
+				return
+			}
+			if selectDb(c, int(dbid)) == C_ERR {
+				addReplyError(c, "DB index is out of range")
+				return
+			}
+			selectDb(c, srcid)
+			j++
+		} else {
+			addReplyErrorObject(c, shared.syntaxErr)
+			return
+		}
+	}
+
+	if server.clusterEnabled && (srcid != 0 || dbid != 0) {
+		addReplyError(c, "Copying to another database is not allowed in cluster mode")
+		return
+	}
+
+	src := c.db
+	dst := server.db[dbid]
+	key := c.argv[1]
+	newkey := c.argv[2]
+	if src == dst && sds.Cmp(*(*sds.SDS)(key.ptr), *(*sds.SDS)(newkey.ptr)) == 0 {
+		addReplyErrorObject(c, shared.sameObjectErr)
+		return
+	}
+
+	o := src.lookupKeyRead(key)
+	if o == nil {
+		addReply(c, shared.czero)
+		return
+	}
+	expire := src.getExpire(key)
+
+	// 目标key存在时，只有指定了REPLACE才会覆盖
+	del := false
+	if dst.lookupKeyWrite(newkey) != nil {
+		if !replace {
+			addReply(c, shared.czero)
+			return
+		}
+		del = true
+	}
+
+	var newobj *robj
+	switch o.getType() {
+	case ObjString:
+		newobj = o.dupStringObject()
+	case ObjList:
+		newobj = listTypeDup(o)
+	case ObjSet:
+		newobj = setTypeDup(o)
+	case ObjZSet:
+		newobj = zsetDup(o)
+	case ObjHash:
+		newobj = hashTypeDup(o)
+	case ObjStream:
+		newobj = streamDup(o)
+	default:
+		addReplyError(c, "Copying module type object is not supported")
+		return
+	}
+
+	if del {
+		dbDelete(dst, newkey)
+	}
+	dst.dbAdd(newkey, newobj)
+	if expire != -1 {
+		dst.setExpire(c, newkey, expire)
+	}
+
+	signalModifiedKey(c, dst, newkey)
+	notifyKeySpaceEvent(notifyGeneric, "copy_to", newkey, dst.id)
+	server.dirty++
+	addReply(c, shared.cone)
+}
+
+// TOUCH key [key ...]
+func touchCommand(c *Client) {
+	touched := 0
+	for j := 1; j < c.argc; j++ {
+		if c.db.lookupKeyRead(c.argv[j]) != nil {
+			touched++
+		}
+	}
+	addReplyLongLong(c, touched)
+}
+
+// getFlushCommandFlags 解析FLUSHDB和FLUSHALL的SYNC/ASYNC参数
+func getFlushCommandFlags(c *Client, flags *int) error {
+	if c.argc == 2 {
+		opt := (*sds.SDS)(c.argv[1].ptr).BufData(0)
+		if util.StrCaseCmp(opt, "sync") {
+			*flags = emptyDbNoFlags
+		} else if util.StrCaseCmp(opt, "async") {
+			*flags = emptyDbAsyncFlag
+		} else {
+			addReplyErrorObject(c, shared.syntaxErr)
+			return C_ERR
+		}
+	} else if c.argc == 1 {
+		*flags = emptyDbNoFlags
+		if server.lazyFreeLazyUserFlush {
+			*flags = emptyDbAsyncFlag
+		}
+	} else {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return C_ERR
+	}
+	return C_OK
+}
+
+// FLUSHDB [ASYNC | SYNC]
+func flushdbCommand(c *Client) {
+	var flags int
+	if getFlushCommandFlags(c, &flags) != C_OK {
+		return
+	}
+	server.dirty += int(emptyData(c.db.id, flags, nil))
+	addReply(c, shared.ok)
+}
+
+// FLUSHALL [ASYNC | SYNC]
+func flushallCommand(c *Client) {
+	var flags int
+	if getFlushCommandFlags(c, &flags) != C_OK {
+		return
+	}
+	server.dirty += int(emptyData(-1, flags, nil))
+	server.dirty++
+	addReply(c, shared.ok)
+}
+
+// SWAPDB index1 index2
+func swapdbCommand(c *Client) {
+	if server.clusterEnabled {
+		addReplyError(c, "SWAPDB is not allowed in cluster mode")
+		return
+	}
+
+	var id1, id2 int64
+	if c.argv[1].getLongLongFromObjectOrReply(c, &id1, "invalid first DB index") != C_OK {
+		return
+	}
+	if c.argv[2].getLongLongFromObjectOrReply(c, &id2, "invalid second DB index") != C_OK {
+		return
+	}
+
+	if dbSwapDatabases(int(id1), int(id2)) != C_OK {
+		addReplyError(c, "DB index is out of range")
+		return
+	}
+	server.dirty++
+	addReply(c, shared.ok)
+}
+
+/*-----------------------------------------------------------------------------
+ * API to get key arguments from commands
+ *----------------------------------------------------------------------------*/
+
+// getKeysPrepareResult 准备保存numkeys个key下标的空间，key少时直接使用keysBuf
+func getKeysPrepareResult(result *getKeysResult, numkeys int) []int {
+	if numkeys > MaxKeysBuffer {
+		result.keys = make([]int, numkeys)
+	} else {
+		result.keys = result.keysBuf[:numkeys]
+	}
+	result.size = len(result.keys)
+	return result.keys
+}
+
+// genericGetKeys 从argv[keyCountIdx]读取key的数量，key从firstKey开始，
+// storeKeyOfs不为0时表示目标key的下标
+func genericGetKeys(storeKeyOfs, keyCountIdx, firstKey, keyStep int, argv []*robj, argc int) *getKeysResult {
+	result := new(getKeysResult)
+
+	var num int64
+	if argv[keyCountIdx].getLongLongFromObject(&num) != C_OK ||
+		num < 1 || num > int64((argc-firstKey)/keyStep) {
+		return result
+	}
+
+	numkeys := int(num)
+	if storeKeyOfs > 0 {
+		numkeys++
+	}
+	keys := getKeysPrepareResult(result, numkeys)
+	for i := 0; i < int(num); i++ {
+		keys[i] = firstKey + i*keyStep
+	}
+	if storeKeyOfs > 0 {
+		keys[num] = storeKeyOfs
+	}
+	result.numKeys = numkeys
+	return result
+}
+
+func zunionInterDiffStoreGetKeys(cmd *redisCommand, argv []*robj, argc int) (*getKeysResult, error) {
+	return genericGetKeys(1, 2, 3, 1, argv, argc), nil
+}
+
+func lmpopGetKeys(cmd *redisCommand, argv []*robj, argc int) (*getKeysResult, error) {
+	return genericGetKeys(0, 1, 2, 1, argv, argc), nil
+}
+
+func blmpopGetKeys(cmd *redisCommand, argv []*robj, argc int) (*getKeysResult, error) {
+	return genericGetKeys(0, 2, 3, 1, argv, argc), nil
+}
+
+func zunionInterDiffGetKeys(cmd *redisCommand, argv []*robj, argc int) (*getKeysResult, error) {
+	return genericGetKeys(0, 1, 2, 1, argv, argc), nil
+}
+
+func sintercardGetKeys(cmd *redisCommand, argv []*robj, argc int) (*getKeysResult, error) {
+	return genericGetKeys(0, 1, 2, 1, argv, argc), nil
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRenameCommands(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"set a 1", "+OK"},
+		{"pexpire a 100000", ":1"},
+		{"rename a a", "+OK"},
+		{"ttl a", ":100"},
+		{"rename nokey b", "-ERR no such key"},
+		{"rename nokey nokey", "-ERR no such key"},
+
+		// 过期时间跟随key转移，覆盖目标key时目标key原来的过期时间被丢弃
+		{"set b 2", "+OK"},
+		{"expire b 50", ":1"},
+		{"rename a b", "+OK"},
+		{"exists a", ":0"},
+		{"get b", "1"},
+		{"ttl b", ":100"},
+		{"set c 3", "+OK"},
+		{"rename c b", "+OK"},
+		{"ttl b", ":-1"},
+
+		{"renamenx b b", ":0"},
+		{"set d 4", "+OK"},
+		{"renamenx b d", ":0"},
+		{"get d", "4"},
+		{"renamenx b e", ":1"},
+		{"get e", "3"},
+		{"renamenx nokey f", "-ERR no such key"},
+
+		{"rpush l a b", ":2"},
+		{"rename l l2", "+OK"},
+		{"lrange l2 0 -1", "[a b]"},
+	})
+}
+
+func TestMoveCommand(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"set a 1", "+OK"},
+		{"expire a 100", ":1"},
+		{"move a 0", "-ERR source and destination objects are the same"},
+		{"move a x", "-ERR value is not an integer or out of range"},
+		{"move a 16", "-ERR DB index is out of range"},
+		{"move a -1", "-ERR DB index is out of range"},
+		{"move nokey 1", ":0"},
+		{"move a 1", ":1"},
+		{"exists a", ":0"},
+		{"select 1", "+OK"},
+		{"get a", "1"},
+		{"ttl a", ":100"},
+
+		// 目标db中已经存在时不移动
+		{"set b x", "+OK"},
+		{"select 0", "+OK"},
+		{"set b y", "+OK"},
+		{"move b 1", ":0"},
+		{"get b", "y"},
+	})
+}
+
+func TestCopyCommand(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"set a 1", "+OK"},
+		{"expire a 100", ":1"},
+		{"copy a a", "-ERR source and destination objects are the same"},
+		{"copy a a db 0", "-ERR source and destination objects are the same"},
+		{"copy nokey b", ":0"},
+		{"copy a b", ":1"},
+		{"ttl b", ":100"},
+		{"set c 2", "+OK"},
+		{"copy a c", ":0"},
+		{"get c", "2"},
+		{"copy a c replace", ":1"},
+		{"get c", "1"},
+		{"copy a c db x", "-ERR value is not an integer or out of range"},
+		{"copy a c db 16", "-ERR DB index is out of range"},
+		{"copy a c badopt", "-ERR syntax error"},
+
+		// 复制到其它db，REPLACE时同名的key也可以复制
+		{"copy a a db 1", ":1"},
+		{"copy a a db 1", ":0"},
+		{"copy a a db 1 replace", ":1"},
+		{"select 1", "+OK"},
+		{"get a", "1"},
+		{"select 0", "+OK"},
+
+		// 复制的是值的副本，修改副本不影响源key
+		{"rpush l a b", ":2"},
+		{"copy l l2", ":1"},
+		{"rpush l2 c", ":3"},
+		{"lrange l 0 -1", "[a b]"},
+		{"hset h f v", ":1"},
+		{"copy h h2", ":1"},
+		{"hset h2 f w", ":0"},
+		{"hget h f", "v"},
+		{"sadd s x", ":1"},
+		{"copy s s2", ":1"},
+		{"srem s2 x", ":1"},
+		{"scard s", ":1"},
+		{"zadd z 1 x", ":1"},
+		{"copy z z2", ":1"},
+		{"zincrby z2 1 x", "2"},
+		{"zscore z x", "1"},
+	})
+}
+
+func TestKeysCommands(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"mset a 1 b 2 ab 3 hello 4", "+OK"},
+		{"exists a a nokey b", ":3"},
+		{"exists nokey", ":0"},
+		{"touch a b nokey", ":2"},
+		{"dbsize", ":4"},
+		{"del a a nokey", ":1"},
+		{"unlink b nokey", ":1"},
+		{"dbsize", ":2"},
+		{"type ab", "+string"},
+		{"type nokey", "+none"},
+	})
+
+	tests := []struct {
+		pattern string
+		expect  string
+	}{
+		{"*", "[ab hello]"},
+		{"a*", "[ab]"},
+		{"?", "[]"},
+		{"h?llo", "[hello]"},
+		{"[ah]*", "[ab hello]"},
+		{"[^a]*", "[hello]"},
+		{"nomatch*", "[]"},
+	}
+	for _, tt := range tests {
+		keys := strings.Fields(strings.Trim(testCommand(c, "keys", tt.pattern), "[]"))
+		sort.Strings(keys)
+		if reply := "[" + strings.Join(keys, " ") + "]"; reply != tt.expect {
+			t.Errorf("keys %s: expect %q, got %q", tt.pattern, tt.expect, reply)
+		}
+	}
+
+	testRun(t, c, []testCase{
+		{"flushdb", "+OK"},
+		{"randomkey", "(nil)"},
+		{"set a 1", "+OK"},
+		{"randomkey", "a"},
+	})
+}
+
+// scanReply 把SCAN类命令的回复拆分成游标和元素
+func scanReply(t *testing.T, reply string) (string, []string) {
+	t.Helper()
+	i := strings.Index(reply, " [")
+	if !strings.HasPrefix(reply, "[") || i < 0 || !strings.HasSuffix(reply, "]]") {
+		t.Fatalf("unexpected scan reply %q", reply)
+	}
+	return reply[1:i], strings.Fields(reply[i+2 : len(reply)-2])
+}
+
+// scanAll 从游标0开始一直执行到游标回到0，between在每两次调用之间执行，返回所有的元素
+func scanAll(t *testing.T, c *Client, between func(), args ...string) []string {
+	t.Helper()
+	var items []string
+	cursor := "0"
+	for {
+		var argv []string
+		if args[0] == "scan" {
+			argv = append([]string{"scan", cursor}, args[1:]...)
+		} else {
+			argv = append([]string{args[0], args[1], cursor}, args[2:]...)
+		}
+		var batch []string
+		cursor, batch = scanReply(t, testCommand(c, argv...))
+		items = append(items, batch...)
+		if cursor == "0" {
+			return items
+		}
+		if between != nil {
+			between()
+		}
+	}
+}
+
+// checkScanKeys 检查每个key正好出现一次
+func checkScanKeys(t *testing.T, items []string, expect map[string]bool) {
+	t.Helper()
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if seen[item] {
+			t.Fatalf("key %q returned more than once", item)
+		}
+		if !expect[item] {
+			t.Fatalf("unexpected key %q", item)
+		}
+		seen[item] = true
+	}
+	if len(seen) != len(expect) {
+		t.Fatalf("expect %d keys, got %d", len(expect), len(seen))
+	}
+}
+
+func TestScanCommand(t *testing.T) {
+	testServerInit()
+	c := testClient()
+
+	keys := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		key := "key:" + strconv.Itoa(i)
+		testCommand(c, "set", key, "v")
+		keys[key] = true
+	}
+	for _, count := range []string{"1", "10", "100", "10000"} {
+		checkScanKeys(t, scanAll(t, c, nil, "scan", "count", count), keys)
+	}
+
+	// MATCH
+	match := make(map[string]bool)
+	for key := range keys {
+		if strings.HasPrefix(key, "key:1") {
+			match[key] = true
+		}
+	}
+	checkScanKeys(t, scanAll(t, c, nil, "scan", "match", "key:1*"), match)
+	checkScanKeys(t, scanAll(t, c, nil, "scan", "match", "*", "count", "50"), keys)
+	checkScanKeys(t, scanAll(t, c, nil, "scan", "match", "nomatch*"), map[string]bool{})
+
+	// TYPE
+	testRun(t, c, []testCase{
+		{"rpush list a", ":1"},
+		{"sadd set a", ":1"},
+		{"hset hash f v", ":1"},
+	})
+	checkScanKeys(t, scanAll(t, c, nil, "scan", "type", "list"), map[string]bool{"list": true})
+	checkScanKeys(t, scanAll(t, c, nil, "scan", "type", "SET", "count", "100"), map[string]bool{"set": true})
+	checkScanKeys(t, scanAll(t, c, nil, "scan", "type", "hash", "match", "h*"), map[string]bool{"hash": true})
+	checkScanKeys(t, scanAll(t, c, nil, "scan", "type", "string", "match", "key:1*"), match)
+	checkScanKeys(t, scanAll(t, c, nil, "scan", "type", "zset"), map[string]bool{})
+
+	testRun(t, c, []testCase{
+		{"scan x", "-ERR invalid cursor"},
+		{"scan -1", "-ERR invalid cursor"},
+		{"scan 18446744073709551616", "-ERR invalid cursor"},
+		{"scan 0 count 0", "-ERR syntax error"},
+		{"scan 0 count x", "-ERR value is not an integer or out of range"},
+		{"scan 0 count", "-ERR syntax error"},
+		{"scan 0 unknown 1", "-ERR syntax error"},
+	})
+}
+
+func TestScanWhileRehashing(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	d := server.db[0].dict
+
+	// 添加key直到dict开始扩容
+	keys := make(map[string]bool)
+	for i := 0; len(keys) < 100 || !d.IsRehashing(); i++ {
+		key := "key:" + strconv.Itoa(i)
+		testCommand(c, "set", key, "v")
+		keys[key] = true
+	}
+
+	// 每次SCAN之间查找key推进rehash，SCAN的前半段在rehash中，后半段在rehash结束之后
+	rehashing, rehashed := 0, 0
+	items := scanAll(t, c, func() {
+		if d.IsRehashing() {
+			rehashing++
+		} else {
+			rehashed++
+		}
+		for i := 0; i < 8; i++ {
+			testCommand(c, "exists", "key:0")
+		}
+	}, "scan", "count", "5")
+	checkScanKeys(t, items, keys)
+	if rehashing == 0 || rehashed == 0 {
+		t.Fatalf("scan should cross the end of rehashing, rehashing %d, rehashed %d", rehashing, rehashed)
+	}
+}
+
+func TestScanTypeCommands(t *testing.T) {
+	testServerInit()
+	c := testClient()
+
+	// listpack和intset编码时一次返回所有的元素，游标是0
+	testRun(t, c, []testCase{
+		{"hset h a 1 b 2 c 3", ":3"},
+		{"object encoding h", "listpack"},
+		{"hscan h 0 count 1", "[0 [a 1 b 2 c 3]]"},
+		{"hscan h 0 match b", "[0 [b 2]]"},
+		{"sadd ints 1 2 3", ":3"},
+		{"object encoding ints", "intset"},
+		{"sscan ints 0 count 1", "[0 [1 2 3]]"},
+		{"sscan ints 0 match 2*", "[0 [2]]"},
+		{"sadd s a b c", ":3"},
+		{"object encoding s", "listpack"},
+		{"sscan s 0 count 1", "[0 [a b c]]"},
+		{"zadd z 1 a 2 b 3 c", ":3"},
+		{"object encoding z", "listpack"},
+		{"zscan z 0 count 1", "[0 [a 1 b 2 c 3]]"},
+		{"zscan z 0 match c", "[0 [c 3]]"},
+
+		{"hscan nokey 0", "[0 []]"},
+		{"sscan nokey 0", "[0 []]"},
+		{"zscan nokey 0", "[0 []]"},
+
+		{"hscan h x", "-ERR invalid cursor"},
+		{"sscan s -1", "-ERR invalid cursor"},
+		{"zscan z 1.5", "-ERR invalid cursor"},
+		{"hscan h 0 type string", "-ERR syntax error"},
+		{"sscan s 0 count 0", "-ERR syntax error"},
+		{"set str x", "+OK"},
+		{"hscan str 0", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"sscan str 0", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"zscan str 0", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+	})
+
+	// hashtable和skiplist编码时需要多次SCAN，hash和zset的元素是成对返回的
+	hash := []string{"hset", "bigh"}
+	set := []string{"sadd", "bigs"}
+	zset := []string{"zadd", "bigz"}
+	members := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		m := "m" + strconv.Itoa(i)
+		hash = append(hash, m, "v"+m)
+		set = append(set, m)
+		zset = append(zset, strconv.Itoa(i), m)
+		members[m] = true
+	}
+	testCommand(c, hash...)
+	testCommand(c, set...)
+	testCommand(c, zset...)
+	testRun(t, c, []testCase{
+		{"object encoding bigh", "hashtable"},
+		{"object encoding bigs", "hashtable"},
+		{"object encoding bigz", "skiplist"},
+	})
+
+	checkScanKeys(t, scanAll(t, c, nil, "sscan", "bigs", "count", "7"), members)
+	for _, args := range [][]string{{"hscan", "bigh", "count", "7"}, {"zscan", "bigz"}} {
+		items := scanAll(t, c, nil, args...)
+		fields := make([]string, 0, len(items)/2)
+		for i := 0; i+1 < len(items); i += 2 {
+			fields = append(fields, items[i])
+			if args[0] == "hscan" && items[i+1] != "v"+items[i] {
+				t.Fatalf("hscan: field %s has value %s", items[i], items[i+1])
+			}
+			if args[0] == "zscan" && "m"+items[i+1] != items[i] {
+				t.Fatalf("zscan: member %s has score %s", items[i], items[i+1])
+			}
+		}
+		checkScanKeys(t, fields, members)
+	}
+
+	match := map[string]bool{"m1": true, "m10": true, "m100": true}
+	for i := 11; i < 20; i++ {
+		match["m"+strconv.Itoa(i)] = true
+	}
+	for i := 101; i < 200; i++ {
+		match["m"+strconv.Itoa(i)] = true
+	}
+	checkScanKeys(t, scanAll(t, c, nil, "sscan", "bigs", "match", "m1*"), match)
+}
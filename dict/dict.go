@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"github.com/pengdafu/redis-golang/util"
 	"math"
+	"math/bits"
+	"math/rand"
 	"unsafe"
 )
 
@@ -22,6 +24,7 @@ type Dict struct {
 	ht        [2]dictHt
 	rehashIdx int64 // -1 表示没有进行rehash
 	iterators uint64
+	metadata  interface{} // 使用者附加在dict上的数据
 }
 
 type Type struct {
@@ -224,28 +227,29 @@ func siphash(key []byte, message []byte) uint64 {
 		tmpMessage = tmpMessage[8:]
 	}
 
-	m := b | uint64(message[0])<<48
-	switch len(message) {
+	// 剩下不足8个字节的部分和消息长度一起组成最后一个块，空消息只有长度
+	m := b
+	switch len(tmpMessage) {
 	case 7:
-		m |= uint64(message[6]) << 48
+		m |= uint64(tmpMessage[6]) << 48
 		fallthrough
 	case 6:
-		m |= uint64(message[5]) << 40
+		m |= uint64(tmpMessage[5]) << 40
 		fallthrough
 	case 5:
-		m |= uint64(message[4]) << 32
+		m |= uint64(tmpMessage[4]) << 32
 		fallthrough
 	case 4:
-		m |= uint64(message[3]) << 24
+		m |= uint64(tmpMessage[3]) << 24
 		fallthrough
 	case 3:
-		m |= uint64(message[2]) << 16
+		m |= uint64(tmpMessage[2]) << 16
 		fallthrough
 	case 2:
-		m |= uint64(message[1]) << 8
+		m |= uint64(tmpMessage[1]) << 8
 		fallthrough
 	case 1:
-		m |= uint64(message[0])
+		m |= uint64(tmpMessage[0])
 	}
 
 	v3 ^= m
@@ -262,22 +266,22 @@ func siphash(key []byte, message []byte) uint64 {
 	return v0 ^ v1 ^ v2 ^ v3
 }
 
-// sipRound is a helper function that performs one round of SipHash-2-4
 // sipRound is a helper function that performs one round of SipHash-2-4
 func sipRound(v0, v1, v2, v3 *uint64) {
 	*v0 += *v1
-	*v1 = (*v1 << 13) | (*v1 >> 51)
-	*v2 += *v3
-	*v3 = (*v3 << 16) | (*v3 >> 48)
+	*v1 = bits.RotateLeft64(*v1, 13)
 	*v1 ^= *v0
+	*v0 = bits.RotateLeft64(*v0, 32)
+	*v2 += *v3
+	*v3 = bits.RotateLeft64(*v3, 16)
 	*v3 ^= *v2
-	*v0 = (*v0 << 32) | (*v0 >> 32)
+	*v0 += *v3
+	*v3 = bits.RotateLeft64(*v3, 21)
+	*v3 ^= *v0
 	*v2 += *v1
-	*v1 = (*v1 << 17) | (*v1 >> 47)
-	*v3 += *v0
-	*v0 = (*v0 << 21) | (*v0 >> 43)
-	*v2 ^= *v1
-	*v1 = (*v1 << 32) | (*v1 >> 32)
+	*v1 = bits.RotateLeft64(*v1, 17)
+	*v1 ^= *v2
+	*v2 = bits.RotateLeft64(*v2, 32)
 }
 
 // siphash_nocase is a function that takes in a key and a message and returns a 64-bit hash,
@@ -426,6 +430,38 @@ func (dict *Dict) GenericDelete(key unsafe.Pointer, nofree bool) *Entry {
 	return nil
 }
 
+// Unlink 从dict中删除key并返回对应的entry，但是不释放entry，调用者可以继续使用它
+func (dict *Dict) Unlink(key unsafe.Pointer) *Entry {
+	return dict.GenericDelete(key, true)
+}
+
+// clear 删除table中所有的entry，每遍历65536个bucket调用一次callback
+func (dict *Dict) clear(table int, callback func()) {
+	ht := &dict.ht[table]
+	for i := int64(0); i < ht.size && ht.used > 0; i++ {
+		if callback != nil && i&65535 == 0 {
+			callback()
+		}
+		he := ht.table[i]
+		for he != nil {
+			next := he.next
+			he.next = nil
+			ht.used--
+			he = next
+		}
+		ht.table[i] = nil
+	}
+	ht.reset()
+}
+
+// Empty 删除dict中所有的entry，callback不为nil时在遍历的过程中会被周期性的调用
+func (dict *Dict) Empty(callback func()) {
+	dict.clear(0, callback)
+	dict.clear(1, callback)
+	dict.rehashIdx = -1
+	dict.iterators = 0
+}
+
 func (dict *Dict) AddOrFind(key unsafe.Pointer) *Entry {
 	existing := &Entry{}
 	entry := dict.AddRaw(key, &existing)
@@ -475,6 +511,16 @@ func (dict *Dict) Slots() int64 {
 	return dict.ht[0].size + dict.ht[1].size
 }
 
+// Metadata 返回附加在dict上的数据
+func (dict *Dict) Metadata() interface{} {
+	return dict.metadata
+}
+
+// SetMetadata 在dict上附加数据，dict本身不会使用它
+func (dict *Dict) SetMetadata(m interface{}) {
+	dict.metadata = m
+}
+
 func (dict *Dict) GetIterator() *Iterator {
 	iter := new(Iterator)
 	iter.d = dict
@@ -486,6 +532,13 @@ func (dict *Dict) GetIterator() *Iterator {
 	return iter
 }
 
+// GetSafeIterator 返回安全的迭代器，迭代期间可以修改dict，也不会进行rehash
+func (dict *Dict) GetSafeIterator() *Iterator {
+	iter := dict.GetIterator()
+	iter.safe = true
+	return iter
+}
+
 func (dict *Dict) Expand(size int64) bool {
 	if dict.IsRehashing() || dict.ht[0].used > size {
 		return false
@@ -508,3 +561,211 @@ func (dict *Dict) Expand(size int64) bool {
 	dict.rehashIdx = 0
 	return true
 }
+
+// GetRandomKey 随机返回一个entry，dict为空时返回nil。
+// 先随机选择一个非空的bucket，再从bucket的链表中随机选择一个entry，
+// 所以链表长度不同的entry被选中的概率并不完全相同
+func (dict *Dict) GetRandomKey() *Entry {
+	if dict.Size() == 0 {
+		return nil
+	}
+	if dict.IsRehashing() {
+		dict.rehashStep()
+	}
+
+	var he *Entry
+	if dict.IsRehashing() {
+		// 0到rehashIdx-1的bucket一定是空的
+		for he == nil {
+			h := dict.rehashIdx + rand.Int63n(dict.Slots()-dict.rehashIdx)
+			if h >= dict.ht[0].size {
+				he = dict.ht[1].table[h-dict.ht[0].size]
+			} else {
+				he = dict.ht[0].table[h]
+			}
+		}
+	} else {
+		for he == nil {
+			h := rand.Uint64() & dict.ht[0].sizeMask
+			he = dict.ht[0].table[h]
+		}
+	}
+
+	// 从bucket的链表中随机选择一个entry
+	listlen := 0
+	for orighe := he; orighe != nil; orighe = orighe.next {
+		listlen++
+	}
+	for listele := rand.Intn(listlen); listele > 0; listele-- {
+		he = he.next
+	}
+	return he
+}
+
+// GetSomeKeys 从dict中随机采样最多count个entry保存到des中，返回实际采样的个数。
+// 从一个随机的位置开始连续遍历bucket，所以速度比多次调用GetRandomKey快很多，
+// 但是不保证返回的entry互不相邻，也不保证一定返回count个，适合只需要"差不多随机"的采样场景。
+// rehash过程中会同时遍历两个表
+func (dict *Dict) GetSomeKeys(des []*Entry, count int) int {
+	if dict.Size() < int64(count) {
+		count = int(dict.Size())
+	}
+	maxSteps := count * 10
+
+	// 做和count成比例的rehash
+	for j := 0; j < count; j++ {
+		if !dict.IsRehashing() {
+			break
+		}
+		dict.rehashStep()
+	}
+
+	tables := 1
+	if dict.IsRehashing() {
+		tables = 2
+	}
+	maxSizeMask := dict.ht[0].sizeMask
+	if tables > 1 && maxSizeMask < dict.ht[1].sizeMask {
+		maxSizeMask = dict.ht[1].sizeMask
+	}
+
+	// 从较大的表中随机选择一个起点
+	i := rand.Uint64() & maxSizeMask
+	emptyLen := 0 // 连续遇到的空bucket个数
+	stored := 0
+	for ; stored < count && maxSteps > 0; maxSteps-- {
+		for j := 0; j < tables; j++ {
+			// rehash时ht[0]中下标小于rehashIdx的bucket一定是空的，可以跳过。
+			// 如果下标同时超出了ht[1]的范围(从大表缩小到小表)，两个表在rehashIdx之前都没有元素，直接跳到rehashIdx
+			if tables == 2 && j == 0 && i < uint64(dict.rehashIdx) {
+				if i >= uint64(dict.ht[1].size) {
+					i = uint64(dict.rehashIdx)
+				} else {
+					continue
+				}
+			}
+			if i >= uint64(dict.ht[j].size) {
+				continue
+			}
+			he := dict.ht[j].table[i]
+
+			// 连续的空bucket达到count个(至少5个)时，换一个随机的位置继续
+			if he == nil {
+				emptyLen++
+				if emptyLen >= 5 && emptyLen > count {
+					i = rand.Uint64() & maxSizeMask
+					emptyLen = 0
+				}
+			} else {
+				emptyLen = 0
+				for ; he != nil; he = he.next {
+					des[stored] = he
+					stored++
+					if stored == count {
+						return stored
+					}
+				}
+			}
+		}
+		i = (i + 1) & maxSizeMask
+	}
+	return stored
+}
+
+// getFairNumEntries GetFairRandomKey每次采样的entry个数
+const getFairNumEntries = 15
+
+// GetFairRandomKey 和GetRandomKey一样随机返回一个entry，但是分布更加均匀。
+// GetRandomKey先选bucket再选entry，链表较长的bucket中的entry被选中的概率更低；
+// 这里先用GetSomeKeys采样一批entry，再从中随机选择一个
+func (dict *Dict) GetFairRandomKey() *Entry {
+	var entries [getFairNumEntries]*Entry
+	count := dict.GetSomeKeys(entries[:], getFairNumEntries)
+	// GetSomeKeys可能一个entry都找不到，这时退化为GetRandomKey，它至少能返回一个entry
+	if count == 0 {
+		return dict.GetRandomKey()
+	}
+	return entries[rand.Intn(count)]
+}
+
+// rev 反转v的所有bit
+func rev(v uint64) uint64 {
+	return bits.Reverse64(v)
+}
+
+// Scan 从游标v开始遍历dict，每次遍历一个bucket，对bucket中的每个entry调用fn，返回下一次调用的游标，
+// 返回0表示遍历结束。第一次调用时v传0。
+//
+// 游标的高位在每次调用后递增，也就是把游标的bit反转之后加一再反转回来。
+// 表的大小总是2的幂，bucket的下标是hash & mask，表扩容时，一个bucket中的元素会被分配到
+// 大表中低位相同的几个bucket中，缩容时则相反。因为是从高位开始递增，扩容或者缩容之后，
+// 已经遍历过的bucket对应的新bucket的游标都比当前游标小，所以：
+//   - 遍历开始时存在并且一直没有被删除的元素一定会被返回
+//   - 元素可能会被返回多次(缩容的时候)，调用者需要自己处理
+//
+// rehash的过程中，先遍历小表中游标对应的bucket，再遍历大表中所有由它扩展出来的bucket
+func (dict *Dict) Scan(v uint64, fn func(de *Entry)) uint64 {
+	if dict.Size() == 0 {
+		return 0
+	}
+
+	// 在fn中查找dict时不能进行rehash
+	dict.iterators++
+
+	if !dict.IsRehashing() {
+		t0 := &dict.ht[0]
+		m0 := t0.sizeMask
+
+		for de := t0.table[v&m0]; de != nil; {
+			next := de.next
+			fn(de)
+			de = next
+		}
+
+		// 把mask之外的bit都置为1，这样反转之后加一，进位只会发生在mask之内
+		v |= ^m0
+
+		v = rev(v)
+		v++
+		v = rev(v)
+	} else {
+		t0 := &dict.ht[0]
+		t1 := &dict.ht[1]
+
+		// 保证t0是小表，t1是大表
+		if t0.size > t1.size {
+			t0, t1 = t1, t0
+		}
+
+		m0 := t0.sizeMask
+		m1 := t1.sizeMask
+
+		for de := t0.table[v&m0]; de != nil; {
+			next := de.next
+			fn(de)
+			de = next
+		}
+
+		// 遍历大表中由小表的bucket扩展出来的所有bucket
+		for {
+			for de := t1.table[v&m1]; de != nil; {
+				next := de.next
+				fn(de)
+				de = next
+			}
+
+			v |= ^m1
+			v = rev(v)
+			v++
+			v = rev(v)
+
+			// 只在小表mask之外的bit上递增
+			if v&(m0^m1) == 0 {
+				break
+			}
+		}
+	}
+
+	dict.iterators--
+	return v
+}
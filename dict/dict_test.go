@@ -36,3 +36,158 @@ func TestCreate(t *testing.T) {
 		fmt.Println(string(*(*[]byte)(d.FetchValue(unsafe.Pointer(&keys[i])))))
 	}
 }
+
+func TestGetSomeKeys(t *testing.T) {
+	// 不在rehash并且bucket个数不超过元素个数+1时，连续的空bucket不会触发随机跳转，
+	// 一次顺序遍历就能拿到所有的entry，并且不会重复
+	small := Create(typ, nil)
+	smallKeys := make([][]byte, 16)
+	for i := range smallKeys {
+		smallKeys[i] = []byte(fmt.Sprintf("small%d", i))
+		small.Add(unsafe.Pointer(&smallKeys[i]), nil)
+	}
+	for small.IsRehashing() {
+		small.rehashStep()
+	}
+	if small.ht[0].size > int64(len(smallKeys)+1) {
+		t.Fatalf("unexpected table size %d", small.ht[0].size)
+	}
+	des := make([]*Entry, 50)
+	if n := small.GetSomeKeys(des, len(des)); n != len(smallKeys) {
+		t.Fatalf("expected %d entries, got %d", len(smallKeys), n)
+	}
+	seen := make(map[string]bool)
+	for _, de := range des[:len(smallKeys)] {
+		key := string(*(*[]byte)(GetKey(de)))
+		if seen[key] {
+			t.Fatalf("entry %s sampled twice", key)
+		}
+		seen[key] = true
+	}
+
+	d := Create(typ, nil)
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+		d.Add(unsafe.Pointer(&keys[i]), nil)
+	}
+
+	// 扩容后dict处于rehash状态，采样需要同时覆盖两个表
+	d.Expand(4096)
+	if !d.IsRehashing() {
+		t.Fatal("dict should be rehashing after expand")
+	}
+
+	// 大表中几乎都是空的bucket，单次采样可能一个都找不到；
+	// 随机跳转之后也可能再次遍历到同一个bucket，所以这里不检查重复
+	total := 0
+	for round := 0; round < 20; round++ {
+		n := d.GetSomeKeys(des, len(des))
+		if n > len(des) {
+			t.Fatalf("unexpected sample count %d", n)
+		}
+		total += n
+		for _, de := range des[:n] {
+			if d.Find(GetKey(de)) != de {
+				t.Fatalf("sampled entry %s is not in dict", string(*(*[]byte)(GetKey(de))))
+			}
+		}
+	}
+	if total == 0 {
+		t.Fatal("GetSomeKeys never returned any entry")
+	}
+
+	if de := d.GetFairRandomKey(); de == nil || d.Find(GetKey(de)) != de {
+		t.Fatal("GetFairRandomKey should return an entry of the dict")
+	}
+}
+
+func TestScan(t *testing.T) {
+	SetHashFunctionSeed(util.GetRandomBytes(16))
+	d := Create(typ, nil)
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+		d.Add(unsafe.Pointer(&keys[i]), nil)
+	}
+
+	// 遍历的过程中不断添加元素触发扩容和rehash，原来的元素都必须被返回
+	seen := make(map[string]bool)
+	extra := 0
+	var cursor uint64
+	for {
+		cursor = d.Scan(cursor, func(de *Entry) {
+			seen[string(*(*[]byte)(GetKey(de)))] = true
+		})
+		for i := 0; i < 20 && extra < 3000; i++ {
+			k := []byte(fmt.Sprintf("extra%d", extra))
+			extra++
+			d.Add(unsafe.Pointer(&k), nil)
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for i := range keys {
+		if !seen[string(keys[i])] {
+			t.Fatalf("%s not returned by scan", keys[i])
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	SetHashFunctionSeed(util.GetRandomBytes(16))
+	d := Create(typ, nil)
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+		d.Add(unsafe.Pointer(&keys[i]), nil)
+	}
+	d.Expand(4096)
+
+	d.Empty(nil)
+	if d.Size() != 0 || d.IsRehashing() {
+		t.Fatalf("dict should be empty, size %d", d.Size())
+	}
+	if d.Find(unsafe.Pointer(&keys[0])) != nil {
+		t.Fatal("key found after Empty")
+	}
+
+	// 清空之后可以继续使用
+	d.Add(unsafe.Pointer(&keys[0]), nil)
+	if d.Unlink(unsafe.Pointer(&keys[0])) == nil || d.Size() != 0 {
+		t.Fatal("Unlink should remove the key")
+	}
+}
+
+func TestSiphash(t *testing.T) {
+	// SipHash-2-4论文中的测试向量：key为00..0f，消息为00..len-1
+	key := make([]byte, 16)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	vectors := map[int]uint64{
+		0:  0x726fdb47dd0e0e31,
+		1:  0x74f839c593dc67fd,
+		7:  0xab0200f58b01d137,
+		8:  0x93f5f5799a932462,
+		15: 0xa129ca6149be45e5,
+	}
+	for n, expect := range vectors {
+		message := make([]byte, n)
+		for i := range message {
+			message[i] = byte(i)
+		}
+		if h := siphash(key, message); h != expect {
+			t.Errorf("len %d: expect %#x, got %#x", n, expect, h)
+		}
+	}
+
+	if siphash(key, nil) != siphash(key, []byte{}) {
+		t.Error("nil and empty message should have the same hash")
+	}
+	if siphash_nocase(key, []byte("AbC")) != siphash(key, []byte("abc")) {
+		t.Error("siphash_nocase should ignore case")
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
-import "time"
+import (
+	"math/rand"
+	"time"
+)
 
 const (
 	LfuInitVal = 5
@@ -28,3 +31,48 @@ func LRU_CLOCK() uint32 {
 func getLRUClock() uint32 {
 	return uint32((time.Now().UnixMilli() / LruClockResolution) & LruClockMax)
 }
+
+// LFUTimeElapsed 返回距离ldt经过了多少分钟，分钟数只有16位，需要处理回绕
+func LFUTimeElapsed(ldt uint32) uint32 {
+	now := uint32(LFUGetTimeInMinutes())
+	if now >= ldt {
+		return now - ldt
+	}
+	return 65535 - ldt + now
+}
+
+// LFULogIncr 按照对数的概率增加访问计数，计数越大增加的概率越小，最大为255
+func LFULogIncr(counter uint32) uint32 {
+	if counter == 255 {
+		return 255
+	}
+	r := rand.Float64()
+	baseval := float64(counter) - LfuInitVal
+	if baseval < 0 {
+		baseval = 0
+	}
+	p := 1.0 / (baseval*float64(server.lfuLogFactor) + 1)
+	if r < p {
+		counter++
+	}
+	return counter
+}
+
+// LFUDecrAndReturn 返回按照经过的时间衰减之后的访问计数，每lfu-decay-time分钟减1，
+// 不会修改对象保存的计数
+func LFUDecrAndReturn(o *robj) uint32 {
+	ldt := o.getLru() >> 8
+	counter := o.getLru() & 255
+	var numPeriods uint32
+	if server.lfuDecayTime > 0 {
+		numPeriods = LFUTimeElapsed(ldt) / uint32(server.lfuDecayTime)
+	}
+	if numPeriods > 0 {
+		if numPeriods > counter {
+			counter = 0
+		} else {
+			counter -= numPeriods
+		}
+	}
+	return counter
+}
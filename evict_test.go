@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestLFULogIncr(t *testing.T) {
+	testServerInit()
+
+	if counter := LFULogIncr(255); counter != 255 {
+		t.Fatalf("counter should saturate at 255, got %d", counter)
+	}
+	// 不超过初始值时每次访问都增加
+	for counter := uint32(0); counter <= LfuInitVal; counter++ {
+		if incr := LFULogIncr(counter); incr != counter+1 {
+			t.Fatalf("counter %d: expect %d, got %d", counter, counter+1, incr)
+		}
+	}
+
+	// 计数越大增加的概率越小，p = 1/((200-5)*10+1)
+	var hits int
+	for i := 0; i < 1000; i++ {
+		if LFULogIncr(200) == 201 {
+			hits++
+		}
+	}
+	if hits > 20 {
+		t.Fatalf("counter 200 incremented %d times out of 1000", hits)
+	}
+
+	// lfu-log-factor为0时每次访问都增加
+	server.lfuLogFactor = 0
+	if counter := LFULogIncr(200); counter != 201 {
+		t.Fatalf("expect 201 with lfu-log-factor 0, got %d", counter)
+	}
+}
+
+func TestLFUDecrAndReturn(t *testing.T) {
+	testServerInit()
+	server.unixtime = 1000 * 60 // 第1000分钟
+
+	tests := []struct {
+		elapsed   uint32 // 距离上次衰减经过的分钟数
+		counter   uint32
+		decayTime int
+		expect    uint32
+	}{
+		{0, 10, 1, 10},
+		{3, 10, 1, 7},
+		{3, 10, 2, 9},
+		{3, 10, 0, 10},
+		{20, 10, 1, 0},
+		{10, 10, 1, 0},
+		{2000, 255, 10, 56}, // 分钟数回绕，和Redis一样按65535计算，少算1分钟
+	}
+	for _, tt := range tests {
+		server.lfuDecayTime = tt.decayTime
+		o := createStringObject("v")
+		ldt := (uint32(LFUGetTimeInMinutes()) - tt.elapsed) & 65535
+		o.setLru(ldt<<8 | tt.counter)
+		if counter := LFUDecrAndReturn(o); counter != tt.expect {
+			t.Errorf("elapsed %d counter %d decay %d: expect %d, got %d",
+				tt.elapsed, tt.counter, tt.decayTime, tt.expect, counter)
+		}
+		// 只返回衰减后的值，不修改对象
+		if o.getLru() != ldt<<8|tt.counter {
+			t.Errorf("LFUDecrAndReturn should not modify the object")
+		}
+	}
+}
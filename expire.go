@@ -3,12 +3,23 @@ package main
 import (
 	"github.com/pengdafu/redis-golang/dict"
 	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+	"math"
 )
 
 const (
 	activeExpireCycleSlow = iota
 	activeExpireCycleFast
 )
+
+// EXPIRE类命令的NX/XX/GT/LT条件
+const (
+	expireNx = 1 << iota // 没有过期时间时才设置
+	expireXx             // 已经有过期时间时才设置
+	expireGt             // 新的过期时间大于当前的过期时间时才设置，没有过期时间当作无限大
+	expireLt             // 新的过期时间小于当前的过期时间时才设置
+)
+
 const (
 	activeExpireCycleKeysPerLoop     = 20
 	activeExpireCycleFastDuration    = 1000 // microseconds
@@ -65,6 +76,7 @@ func activeExpireCycle(typ int) {
 		var expired, sampled int64
 		db := server.db[currentDb%server.dbnum]
 		currentDb++
+		activeExpireHashFields(db, configKeysPerLoop)
 		for sampled == 0 || expired*100/sampled > int64(configCycleAcceptableStale) {
 			iteration++
 			var num, slots int64
@@ -138,6 +150,36 @@ func activeExpireCycle(typ int) {
 	}
 }
 
+// activeExpireHashFields 抽样检查设置了field过期时间的hash，回收其中已经过期的field
+func activeExpireHashFields(db *redisDb, num int64) {
+	if db.hexpires.Size() == 0 {
+		return
+	}
+
+	now := mstime()
+	sampled := int64(0)
+	maxBuckets := num * 20
+	for checkedBuckets := int64(0); sampled < num && checkedBuckets < maxBuckets; checkedBuckets++ {
+		for table := 0; table < 2; table++ {
+			if table == 1 && !db.hexpires.IsRehashing() {
+				break
+			}
+
+			idx := db.hexpiresCursor & db.hexpires.SizeMask(table)
+			de := db.hexpires.DictEntry(table, idx)
+			for de != nil {
+				e := de
+				de = de.Next()
+				keyObj := createObject(ObjString, *(*sds.SDS)(dict.GetKey(e)))
+				hashTypeActiveExpire(db, keyObj, now)
+				keyObj.decrRefCount()
+				sampled++
+			}
+		}
+		db.hexpiresCursor++
+	}
+}
+
 func expireSlaveKeys() {
 
 }
@@ -162,10 +204,38 @@ func activeExpireCycleTryExpire(db *redisDb, de *dict.Entry, now int64) bool {
 	return false
 }
 
-func expireCommand(c *Client) {
-	expireGenericCommand(c, mstime(), unitSeconds)
+// parseExtendedExpireArgumentsOrReply 解析EXPIRE类命令的NX/XX/GT/LT选项
+func parseExtendedExpireArgumentsOrReply(c *Client, flags *int) error {
+	for j := 3; j < c.argc; j++ {
+		opt := (*sds.SDS)(c.argv[j].ptr).BufData(0)
+		switch {
+		case util.StrCaseCmp(opt, "nx"):
+			*flags |= expireNx
+		case util.StrCaseCmp(opt, "xx"):
+			*flags |= expireXx
+		case util.StrCaseCmp(opt, "gt"):
+			*flags |= expireGt
+		case util.StrCaseCmp(opt, "lt"):
+			*flags |= expireLt
+		default:
+			addReplyErrorFormat(c, "Unsupported option %s", opt)
+			return C_ERR
+		}
+	}
+
+	if *flags&expireNx > 0 && *flags&(expireXx|expireGt|expireLt) > 0 {
+		addReplyError(c, "NX and XX, GT or LT options at the same time are not compatible")
+		return C_ERR
+	}
+	if *flags&expireGt > 0 && *flags&expireLt > 0 {
+		addReplyError(c, "GT and LT options at the same time are not compatible")
+		return C_ERR
+	}
+	return C_OK
 }
 
+// expireGenericCommand 实现EXPIRE/PEXPIRE/EXPIREAT/PEXPIREAT，basetime为0时是绝对时间。
+// 过期时间允许是负数，这时key会被直接删除
 func expireGenericCommand(c *Client, basetime int64, unit int) {
 	key := c.argv[1]
 	param := c.argv[2]
@@ -174,15 +244,36 @@ func expireGenericCommand(c *Client, basetime int64, unit int) {
 	if err := param.getLongLongFromObjectOrReply(c, &when, ""); err != C_OK {
 		return
 	}
+
+	var flag int
+	if parseExtendedExpireArgumentsOrReply(c, &flag) != C_OK {
+		return
+	}
+
+	// 单位转换和加上basetime时都可能溢出
 	if unit == unitSeconds {
+		if when > math.MaxInt64/1000 || when < math.MinInt64/1000 {
+			addReplyErrorFormat(c, "invalid expire time in '%s' command", c.cmd.name)
+			return
+		}
 		when *= 1000
 	}
+	if when > math.MaxInt64-basetime {
+		addReplyErrorFormat(c, "invalid expire time in '%s' command", c.cmd.name)
+		return
+	}
 	when += basetime
+
 	if c.db.lookupKeyWrite(key) == nil {
 		addReply(c, shared.czero)
 		return
 	}
 
+	if flag != 0 && !expireConditionMet(flag, c.db.getExpire(key), when) {
+		addReply(c, shared.czero)
+		return
+	}
+
 	if checkAlreadyExpired(when) {
 		var aux *robj
 		deleteFn := dbASyncDelete
@@ -207,12 +298,124 @@ func expireGenericCommand(c *Client, basetime int64, unit int) {
 	} else {
 		c.db.setExpire(c, key, when)
 		addReply(c, shared.cone)
+
+		// 以PEXPIREAT的形式传播绝对时间
+		if c.cmd.name != "pexpireat" {
+			rewriteClientCommandArgument(c, 0, shared.pexpireat)
+		}
+		if basetime != 0 || unit == unitSeconds {
+			whenObj := createStringObjectFromLongLongWithOptions(when, 0)
+			rewriteClientCommandArgument(c, 2, whenObj)
+			whenObj.decrRefCount()
+		}
 		signalModifiedKey(c, c.db, key)
 		notifyKeySpaceEvent(notifyGeneric, "expire", key, c.db.id)
 		server.dirty++
 	}
 }
 
+// EXPIRE key seconds [NX | XX | GT | LT]
+func expireCommand(c *Client) {
+	expireGenericCommand(c, mstime(), unitSeconds)
+}
+
+// EXPIREAT key unix-time-seconds [NX | XX | GT | LT]
+func expireatCommand(c *Client) {
+	expireGenericCommand(c, 0, unitSeconds)
+}
+
+// PEXPIRE key milliseconds [NX | XX | GT | LT]
+func pexpireCommand(c *Client) {
+	expireGenericCommand(c, mstime(), unitMilliSeconds)
+}
+
+// PEXPIREAT key unix-time-milliseconds [NX | XX | GT | LT]
+func pexpireatCommand(c *Client) {
+	expireGenericCommand(c, 0, unitMilliSeconds)
+}
+
+// ttlGenericCommand 实现TTL/PTTL/EXPIRETIME/PEXPIRETIME，outputAbs为true时返回绝对时间。
+// key不存在时返回-2，没有过期时间时返回-1
+func ttlGenericCommand(c *Client, outputMs, outputAbs bool) {
+	if c.db.lookupKeyReadWithFlags(c.argv[1], lookupNoTouch) == nil {
+		addReplyLongLong(c, -2)
+		return
+	}
+
+	ttl := int64(-1)
+	expire := c.db.getExpire(c.argv[1])
+	if expire != -1 {
+		ttl = expire
+		if !outputAbs {
+			ttl = expire - mstime()
+		}
+		if ttl < 0 {
+			ttl = 0
+		}
+	}
+	if ttl == -1 {
+		addReplyLongLong(c, -1)
+	} else if outputMs {
+		addReplyLongLong(c, int(ttl))
+	} else {
+		addReplyLongLong(c, int((ttl+500)/1000))
+	}
+}
+
+// TTL key
+func ttlCommand(c *Client) {
+	ttlGenericCommand(c, false, false)
+}
+
+// PTTL key
+func pttlCommand(c *Client) {
+	ttlGenericCommand(c, true, false)
+}
+
+// EXPIRETIME key
+func expiretimeCommand(c *Client) {
+	ttlGenericCommand(c, false, true)
+}
+
+// PEXPIRETIME key
+func pexpiretimeCommand(c *Client) {
+	ttlGenericCommand(c, true, true)
+}
+
+// PERSIST key
+func persistCommand(c *Client) {
+	if c.db.lookupKeyWrite(c.argv[1]) == nil {
+		addReply(c, shared.czero)
+		return
+	}
+	if !c.db.removeExpire(c.argv[1]) {
+		addReply(c, shared.czero)
+		return
+	}
+	signalModifiedKey(c, c.db, c.argv[1])
+	notifyKeySpaceEvent(notifyGeneric, "persist", c.argv[1], c.db.id)
+	addReply(c, shared.cone)
+	server.dirty++
+}
+
+// expireConditionMet 检查NX/XX/GT/LT条件是否满足，current为-1表示当前没有过期时间，
+// XX可以和GT或者LT一起使用
+func expireConditionMet(flag int, current, when int64) bool {
+	if flag&expireNx > 0 && current != -1 {
+		return false
+	}
+	if flag&expireXx > 0 && current == -1 {
+		return false
+	}
+	if flag&expireGt > 0 && (current == -1 || when <= current) {
+		return false
+	}
+	if flag&expireLt > 0 && current != -1 && when >= current {
+		return false
+	}
+	return true
+}
+
 func checkAlreadyExpired(when int64) bool {
 	return when <= mstime() && !server.loading && server.masterhost == ""
 }
@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+func TestExpireOptions(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"set k v", "+OK"},
+		{"expire nokey 100", ":0"},
+		{"expire k notanumber badopt", "-ERR value is not an integer or out of range"},
+		{"expire k 100 badopt", "-ERR Unsupported option badopt"},
+		{"expire k 100 nx xx", "-ERR NX and XX, GT or LT options at the same time are not compatible"},
+		{"expire k 100 nx gt", "-ERR NX and XX, GT or LT options at the same time are not compatible"},
+		{"expire k 100 gt lt", "-ERR GT and LT options at the same time are not compatible"},
+
+		// 没有过期时间时，XX和GT不满足，LT把它当作无限大所以满足
+		{"expire k 100 xx", ":0"},
+		{"expire k 100 gt", ":0"},
+		{"ttl k", ":-1"},
+		{"expire k 100 nx", ":1"},
+		{"expire k 200 nx", ":0"},
+		{"ttl k", ":100"},
+		{"expire k 200 xx", ":1"},
+		{"expire k 100 gt", ":0"},
+		{"expire k 300 gt", ":1"},
+		{"expire k 400 lt", ":0"},
+		{"expire k 150 lt", ":1"},
+		{"expire k 300 xx gt", ":1"},
+		{"expire k 100 xx lt", ":1"},
+		{"ttl k", ":100"},
+		{"persist k", ":1"},
+		{"expire k 100 lt", ":1"},
+		{"persist k", ":1"},
+		{"persist k", ":0"},
+		{"persist nokey", ":0"},
+
+		// 已经过去的时间直接删除key
+		{"expire k -1", ":1"},
+		{"exists k", ":0"},
+		{"set k v", "+OK"},
+		{"pexpireat k 1", ":1"},
+		{"exists k", ":0"},
+	})
+}
+
+func TestExpireOverflow(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"set k v", "+OK"},
+		{"expire k 9223372036854775807", "-ERR invalid expire time in 'expire' command"},
+		{"expire k -9223372036854775808", "-ERR invalid expire time in 'expire' command"},
+		{"expireat k 9223372036854775807", "-ERR invalid expire time in 'expireat' command"},
+		{"pexpire k 9223372036854775807", "-ERR invalid expire time in 'pexpire' command"},
+		{"expire k 9223372036854775808", "-ERR value is not an integer or out of range"},
+		{"pexpireat k 9223372036854775807", ":1"},
+		{"pexpiretime k", ":9223372036854775807"},
+	})
+}
+
+func TestTtlCommands(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"ttl nokey", ":-2"},
+		{"pttl nokey", ":-2"},
+		{"expiretime nokey", ":-2"},
+		{"pexpiretime nokey", ":-2"},
+		{"set k v", "+OK"},
+		{"ttl k", ":-1"},
+		{"pttl k", ":-1"},
+		{"expiretime k", ":-1"},
+		{"pexpiretime k", ":-1"},
+
+		{"expireat k 4102444800", ":1"},
+		{"expiretime k", ":4102444800"},
+		{"pexpiretime k", ":4102444800000"},
+		{"pexpireat k 4102444800123", ":1"},
+		{"expiretime k", ":4102444800"},
+		{"pexpiretime k", ":4102444800123"},
+		{"expire k 100", ":1"},
+		{"ttl k", ":100"},
+
+		// 覆盖写入会清除过期时间
+		{"set k v2", "+OK"},
+		{"ttl k", ":-1"},
+	})
+}
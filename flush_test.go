@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// lazyfreeWait 等待后台goroutine释放完所有的对象
+func lazyfreeWait(t *testing.T) {
+	t.Helper()
+	for i := 0; lazyfreeGetPendingObjectsCount() != 0; i++ {
+		if i == 1000 {
+			t.Fatalf("%d objects still pending", lazyfreeGetPendingObjectsCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlushCommands(t *testing.T) {
+	for _, opt := range []string{"", "sync", "async"} {
+		testServerInit()
+		c := testClient()
+		flush := func(cmd string) string {
+			if opt == "" {
+				return testCommand(c, cmd)
+			}
+			return testCommand(c, cmd, opt)
+		}
+
+		testRun(t, c, []testCase{
+			{"mset a 1 b 2", "+OK"},
+			{"expire a 100", ":1"},
+			{"select 1", "+OK"},
+			{"set c 3", "+OK"},
+			{"select 0", "+OK"},
+		})
+		dirty := server.dirty
+		if reply := flush("flushdb"); reply != "+OK" {
+			t.Fatalf("flushdb %s: unexpected reply %q", opt, reply)
+		}
+		if server.dirty != dirty+2 {
+			t.Fatalf("flushdb %s: expect dirty %d, got %d", opt, dirty+2, server.dirty)
+		}
+		testRun(t, c, []testCase{
+			{"dbsize", ":0"},
+			{"ttl a", ":-2"},
+			{"set a 1", "+OK"},
+			{"ttl a", ":-1"},
+			{"select 1", "+OK"},
+			{"dbsize", ":1"},
+		})
+
+		if reply := flush("flushall"); reply != "+OK" {
+			t.Fatalf("flushall %s: unexpected reply %q", opt, reply)
+		}
+		testRun(t, c, []testCase{
+			{"dbsize", ":0"},
+			{"select 0", "+OK"},
+			{"dbsize", ":0"},
+		})
+		lazyfreeWait(t)
+	}
+
+	testRun(t, testClient(), []testCase{
+		{"flushdb badopt", "-ERR syntax error"},
+		{"flushall sync async", "-ERR syntax error"},
+	})
+}
+
+func TestLazyfreeWorker(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	for i := 0; i < 200; i++ {
+		testCommand(c, "sadd", "set", "m"+strconv.Itoa(i))
+	}
+	testRun(t, c, []testCase{
+		{"set str x", "+OK"},
+		{"object encoding set", "hashtable"},
+	})
+
+	// 释放代价大的value交给后台释放，小对象直接释放
+	freed := lazyfreeGetFreedObjectsCount()
+	testRun(t, c, []testCase{{"unlink set str nokey", ":2"}})
+	lazyfreeWait(t)
+	if n := lazyfreeGetFreedObjectsCount() - freed; n != 1 {
+		t.Fatalf("expect 1 object freed in background, got %d", n)
+	}
+
+	// FLUSHALL ASYNC在后台释放所有的key
+	freed = lazyfreeGetFreedObjectsCount()
+	testRun(t, c, []testCase{
+		{"select 1", "+OK"},
+		{"mset a 1 b 2", "+OK"},
+		{"flushall async", "+OK"},
+		{"dbsize", ":0"},
+	})
+	lazyfreeWait(t)
+	if n := lazyfreeGetFreedObjectsCount() - freed; n != 2 {
+		t.Fatalf("expect 2 objects freed in background, got %d", n)
+	}
+}
+
+func TestSwapdbCommand(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"set a 0", "+OK"},
+		{"expire a 100", ":1"},
+		{"select 1", "+OK"},
+		{"set b 1", "+OK"},
+		{"swapdb 0 1", "+OK"},
+		{"get a", "0"},
+		{"ttl a", ":100"},
+		{"exists b", ":0"},
+		{"select 0", "+OK"},
+		{"get b", "1"},
+		{"swapdb 0 0", "+OK"},
+		{"get b", "1"},
+		{"swapdb 0 16", "-ERR DB index is out of range"},
+		{"swapdb -1 0", "-ERR DB index is out of range"},
+		{"swapdb x 0", "-ERR invalid first DB index"},
+		{"swapdb 0 x", "-ERR invalid second DB index"},
+	})
+
+	// 阻塞的客户端留在原来的db中，交换进来的db中存在它等待的key时被唤醒
+	blocked := testClient()
+	testRun(t, blocked, []testCase{{"blpop list 0", ""}})
+	testRun(t, c, []testCase{
+		{"select 1", "+OK"},
+		{"rpush list x y", ":2"},
+		{"swapdb 0 1", "+OK"},
+	})
+	if reply := testReply(blocked); reply != "[list x]" {
+		t.Fatalf("blocked client: expect [list x], got %q", reply)
+	}
+	testRun(t, c, []testCase{
+		{"select 0", "+OK"},
+		{"lrange list 0 -1", "[y]"},
+	})
+}
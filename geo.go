@@ -0,0 +1,742 @@
+package main
+
+import (
+	"github.com/pengdafu/redis-golang/geohash"
+	"github.com/pengdafu/redis-golang/listpack"
+	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+	"sort"
+	"strconv"
+	"unsafe"
+)
+
+// geo命令建立在有序集合之上，经纬度编码成52位的geohash作为score，
+// 范围搜索时先计算出需要搜索的9个geohash格子，每个格子对应score的一个区间
+
+const (
+	sortNone = iota
+	sortAsc
+	sortDesc
+)
+
+const (
+	radiusCoords   = 1 << iota // GEORADIUS，以经纬度为中心
+	radiusMember               // GEORADIUSBYMEMBER，以成员为中心
+	radiusNoStore              // _RO，不支持STORE
+	geoSearch                  // GEOSEARCH
+	geoSearchStore             // GEOSEARCHSTORE
+)
+
+type geoPoint struct {
+	longitude, latitude float64
+	dist                float64
+	score               float64
+	member              sds.SDS
+}
+
+// decodeGeohash 把score解码成经纬度
+func decodeGeohash(bits float64, xy *[2]float64) bool {
+	hash := geohash.Bits{Bits: uint64(bits), Step: geohash.StepMax}
+	return geohash.DecodeToLongLatWGS84(hash, xy)
+}
+
+// extractLongLatOrReply 从argv中解析经度和纬度
+func extractLongLatOrReply(c *Client, argv []*robj, xy *[2]float64) error {
+	for i := 0; i < 2; i++ {
+		if argv[i].getDoubleFromObjectOrReply(c, &xy[i], "") != C_OK {
+			return C_ERR
+		}
+	}
+	if xy[0] < geohash.LongMin || xy[0] > geohash.LongMax ||
+		xy[1] < geohash.LatMin || xy[1] > geohash.LatMax {
+		addReplyErrorFormat(c, "invalid longitude,latitude pair %f,%f", xy[0], xy[1])
+		return C_ERR
+	}
+	return C_OK
+}
+
+// longLatFromMember 获取成员的经纬度
+func longLatFromMember(zobj *robj, member *robj, xy *[2]float64) error {
+	var score float64
+	if zsetScore(zobj, *(*sds.SDS)(member.ptr), &score) != C_OK {
+		return C_ERR
+	}
+	if !decodeGeohash(score, xy) {
+		return C_ERR
+	}
+	return C_OK
+}
+
+// extractUnitOrReply 返回单位转换成米的倍数，单位不支持时返回-1
+func extractUnitOrReply(c *Client, unit *robj) float64 {
+	u := argvBytes(unit)
+	if util.StrCaseCmp(u, "m") {
+		return 1
+	} else if util.StrCaseCmp(u, "km") {
+		return 1000
+	} else if util.StrCaseCmp(u, "ft") {
+		return 0.3048
+	} else if util.StrCaseCmp(u, "mi") {
+		return 1609.34
+	}
+	addReplyError(c, "unsupported unit provided. please use M, KM, FT, MI")
+	return -1
+}
+
+// extractDistanceOrReply 解析 radius unit
+func extractDistanceOrReply(c *Client, argv []*robj, conversion, radius *float64) error {
+	var distance float64
+	if argv[0].getDoubleFromObjectOrReply(c, &distance, "need numeric radius") != C_OK {
+		return C_ERR
+	}
+	if distance < 0 {
+		addReplyError(c, "radius cannot be negative")
+		return C_ERR
+	}
+	*radius = distance
+
+	toMeters := extractUnitOrReply(c, argv[1])
+	if toMeters < 0 {
+		return C_ERR
+	}
+	*conversion = toMeters
+	return C_OK
+}
+
+// extractBoxOrReply 解析 width height unit
+func extractBoxOrReply(c *Client, argv []*robj, conversion, width, height *float64) error {
+	var h, w float64
+	if argv[0].getDoubleFromObjectOrReply(c, &w, "need numeric width") != C_OK ||
+		argv[1].getDoubleFromObjectOrReply(c, &h, "need numeric height") != C_OK {
+		return C_ERR
+	}
+	if h < 0 || w < 0 {
+		addReplyError(c, "height or width cannot be negative")
+		return C_ERR
+	}
+	*height = h
+	*width = w
+
+	toMeters := extractUnitOrReply(c, argv[2])
+	if toMeters < 0 {
+		return C_ERR
+	}
+	*conversion = toMeters
+	return C_OK
+}
+
+// addReplyDoubleDistance 距离固定保留4位小数
+func addReplyDoubleDistance(c *Client, d float64) {
+	addReplyBulkCString(c, strconv.FormatFloat(d, 'f', 4, 64))
+}
+
+// geoAppendIfWithinShape 成员在搜索区域内时添加到ga中
+func geoAppendIfWithinShape(ga *[]geoPoint, shape *geohash.Shape, score float64, member sds.SDS) bool {
+	var distance float64
+	var xy [2]float64
+	if !decodeGeohash(score, &xy) {
+		return false
+	}
+
+	if shape.Type == geohash.CircularType {
+		if !geohash.GetDistanceIfInRadiusWGS84(shape.XY[0], shape.XY[1], xy[0], xy[1],
+			shape.Radius*shape.Conversion, &distance) {
+			return false
+		}
+	} else if shape.Type == geohash.RectangleType {
+		if !geohash.GetDistanceIfInRectangle(shape.Width*shape.Conversion, shape.Height*shape.Conversion,
+			shape.XY[0], shape.XY[1], xy[0], xy[1], &distance) {
+			return false
+		}
+	}
+
+	*ga = append(*ga, geoPoint{
+		longitude: xy[0],
+		latitude:  xy[1],
+		dist:      distance,
+		score:     score,
+		member:    member,
+	})
+	return true
+}
+
+// geoGetPointsInRange 把score在[min, max)之间并且在搜索区域内的成员添加到ga中，
+// limit不为0时，找到limit个成员之后就停止，返回添加的个数
+func geoGetPointsInRange(zobj *robj, min, max float64, shape *geohash.Shape, ga *[]geoPoint, limit int) int {
+	r := zrangespec{min: min, max: max, minex: false, maxex: true}
+	origincount := len(*ga)
+
+	if zobj.getEncoding() == ObjEncodingListPack {
+		zl := *(*[]byte)(zobj.ptr)
+		eptr := zzlFirstInRange(zl, &r)
+		if eptr == nil {
+			return 0
+		}
+		sptr := listpack.Next(zl, eptr)
+		for eptr != nil {
+			score := zzlGetScore(sptr)
+			// 超过了最大值，后面的都不会在范围内了
+			if !zslValueLteMax(score, &r) {
+				break
+			}
+			geoAppendIfWithinShape(ga, shape, score, listpackGetObject(eptr))
+			if len(*ga) > 0 && limit > 0 && len(*ga) >= limit {
+				break
+			}
+			zzlNext(zl, &eptr, &sptr)
+		}
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		zsl := (*zset)(zobj.ptr).zsl
+		ln := zslFirstInRange(zsl, &r)
+		if ln == nil {
+			return 0
+		}
+		for ln != nil {
+			if !zslValueLteMax(ln.score, &r) {
+				break
+			}
+			geoAppendIfWithinShape(ga, shape, ln.score, sds.Dup(ln.ele))
+			if len(*ga) > 0 && limit > 0 && len(*ga) >= limit {
+				break
+			}
+			ln = ln.level[0].forward
+		}
+	}
+	return len(*ga) - origincount
+}
+
+// scoresOfGeoHashBox 计算hash格子对应的score区间，[min, max)
+func scoresOfGeoHashBox(hash geohash.Bits) (min, max uint64) {
+	min = geohash.Align52Bits(hash)
+	hash.Bits++
+	max = geohash.Align52Bits(hash)
+	return
+}
+
+// membersOfGeoHashBox 搜索一个hash格子内的成员
+func membersOfGeoHashBox(zobj *robj, hash geohash.Bits, ga *[]geoPoint, shape *geohash.Shape, limit int) int {
+	min, max := scoresOfGeoHashBox(hash)
+	return geoGetPointsInRange(zobj, float64(min), float64(max), shape, ga, limit)
+}
+
+// membersOfAllNeighbors 搜索中心格子以及周围的8个格子
+func membersOfAllNeighbors(zobj *robj, n *geohash.Radius, shape *geohash.Shape, ga *[]geoPoint, limit int) int {
+	neighbors := [9]geohash.Bits{
+		n.Hash,
+		n.Neighbors.North,
+		n.Neighbors.South,
+		n.Neighbors.East,
+		n.Neighbors.West,
+		n.Neighbors.NorthEast,
+		n.Neighbors.NorthWest,
+		n.Neighbors.SouthEast,
+		n.Neighbors.SouthWest,
+	}
+
+	count, lastProcessed := 0, 0
+	for i := range neighbors {
+		if neighbors[i].IsZero() {
+			continue
+		}
+
+		// 半径很大的时候相邻的格子可能是同一个，跳过和上一个相同的格子，避免重复的结果
+		if lastProcessed > 0 && neighbors[i] == neighbors[lastProcessed] {
+			continue
+		}
+		if len(*ga) > 0 && limit > 0 && len(*ga) >= limit {
+			break
+		}
+		count += membersOfGeoHashBox(zobj, neighbors[i], ga, shape, limit)
+		lastProcessed = i
+	}
+	return count
+}
+
+/* ====================================================================
+ * Commands
+ * ==================================================================== */
+
+// GEOADD key [CH] [NX|XX] long lat name [long2 lat2 name2 ... longN latN nameN]
+func geoaddCommand(c *Client) {
+	xx, nx := false, false
+	longidx := 2
+
+	for longidx < c.argc {
+		opt := argvBytes(c.argv[longidx])
+		if util.StrCaseCmp(opt, "nx") {
+			nx = true
+		} else if util.StrCaseCmp(opt, "xx") {
+			xx = true
+		} else if util.StrCaseCmp(opt, "ch") {
+			// 交给ZADD处理
+		} else {
+			break
+		}
+		longidx++
+	}
+
+	if (c.argc-longidx)%3 != 0 || (xx && nx) {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+
+	// 转换成 ZADD key [CH] [NX|XX] score ele ... 执行
+	elements := (c.argc - longidx) / 3
+	argc := longidx + elements*2
+	argv := make([]*robj, argc)
+	argv[0] = createStringObject("zadd")
+	for i := 1; i < longidx; i++ {
+		argv[i] = c.argv[i]
+		argv[i].incrRefCount()
+	}
+
+	for i := 0; i < elements; i++ {
+		var xy [2]float64
+		if extractLongLatOrReply(c, c.argv[longidx+i*3:], &xy) != C_OK {
+			return
+		}
+
+		var hash geohash.Bits
+		geohash.EncodeWGS84(xy[0], xy[1], geohash.StepMax, &hash)
+		bits := geohash.Align52Bits(hash)
+		val := c.argv[longidx+i*3+2]
+		argv[longidx+i*2] = createStringObject(strconv.FormatUint(bits, 10))
+		argv[longidx+1+i*2] = val
+		val.incrRefCount()
+	}
+
+	rewriteClientCommandVector(c, argc, argv...)
+	zaddCommand(c)
+}
+
+// georadiusGeneric 实现所有的范围搜索命令，srcKeyIndex是有序集合key的下标
+//
+//	GEORADIUS key x y radius unit [WITHDIST] [WITHHASH] [WITHCOORD] [ASC|DESC] [COUNT count [ANY]] [STORE key] [STOREDIST key]
+//	GEORADIUSBYMEMBER key member radius unit ... options ...
+//	GEOSEARCH key [FROMMEMBER member] [FROMLONLAT long lat] [BYRADIUS radius unit] [BYBOX width height unit]
+//	          [WITHCOORD] [WITHDIST] [WITHHASH] [COUNT count [ANY]] [ASC|DESC]
+//	GEOSEARCHSTORE dest_key src_key [FROMMEMBER member] [FROMLONLAT long lat] [BYRADIUS radius unit]
+//	          [BYBOX width height unit] [COUNT count [ANY]] [ASC|DESC] [STOREDIST]
+func georadiusGeneric(c *Client, srcKeyIndex int, flags int) {
+	var storekey *robj
+	storedist := false // STORE保存geohash，STOREDIST保存距离
+
+	zobj := c.db.lookupKeyRead(c.argv[srcKeyIndex])
+	if zobj != nil && zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	// 解析中心点以及搜索区域
+	var baseArgs int
+	var shape geohash.Shape
+	if flags&radiusCoords > 0 {
+		baseArgs = 6
+		shape.Type = geohash.CircularType
+		if extractLongLatOrReply(c, c.argv[2:], &shape.XY) != C_OK {
+			return
+		}
+		if extractDistanceOrReply(c, c.argv[baseArgs-2:], &shape.Conversion, &shape.Radius) != C_OK {
+			return
+		}
+	} else if flags&radiusMember > 0 && zobj == nil {
+		// key不存在，仍然需要解析参数，才知道是否有STORE
+		baseArgs = 5
+	} else if flags&radiusMember > 0 {
+		baseArgs = 5
+		shape.Type = geohash.CircularType
+		if longLatFromMember(zobj, c.argv[2], &shape.XY) != C_OK {
+			addReplyError(c, "could not decode requested zset member")
+			return
+		}
+		if extractDistanceOrReply(c, c.argv[baseArgs-2:], &shape.Conversion, &shape.Radius) != C_OK {
+			return
+		}
+	} else if flags&geoSearch > 0 {
+		baseArgs = 2
+		if flags&geoSearchStore > 0 {
+			baseArgs = 3
+			storekey = c.argv[1]
+		}
+	} else {
+		addReplyError(c, "Unknown georadius search type")
+		return
+	}
+
+	// 解析可选参数
+	withdist, withhash, withcoords := false, false, false
+	frommember, fromloc, byradius, bybox := false, false, false, false
+	sorting := sortNone
+	anyFlag := false // 找到足够的结果之后就停止搜索
+	var count int64  // 最多返回的个数，0表示不限制
+	if c.argc > baseArgs {
+		remaining := c.argc - baseArgs
+		for i := 0; i < remaining; i++ {
+			arg := argvBytes(c.argv[baseArgs+i])
+			if util.StrCaseCmp(arg, "withdist") {
+				withdist = true
+			} else if util.StrCaseCmp(arg, "withhash") {
+				withhash = true
+			} else if util.StrCaseCmp(arg, "withcoord") {
+				withcoords = true
+			} else if util.StrCaseCmp(arg, "any") {
+				anyFlag = true
+			} else if util.StrCaseCmp(arg, "asc") {
+				sorting = sortAsc
+			} else if util.StrCaseCmp(arg, "desc") {
+				sorting = sortDesc
+			} else if util.StrCaseCmp(arg, "count") && i+1 < remaining {
+				if c.argv[baseArgs+i+1].getLongLongFromObjectOrReply(c, &count, "") != C_OK {
+					return
+				}
+				if count <= 0 {
+					addReplyError(c, "COUNT must be > 0")
+					return
+				}
+				i++
+			} else if (util.StrCaseCmp(arg, "store") || util.StrCaseCmp(arg, "storedist")) &&
+				i+1 < remaining && flags&radiusNoStore == 0 && flags&geoSearch == 0 {
+				storekey = c.argv[baseArgs+i+1]
+				storedist = util.StrCaseCmp(arg, "storedist")
+				i++
+			} else if util.StrCaseCmp(arg, "storedist") && flags&geoSearch > 0 && flags&geoSearchStore > 0 {
+				storedist = true
+			} else if util.StrCaseCmp(arg, "frommember") && i+1 < remaining && flags&geoSearch > 0 && !fromloc {
+				// key不存在时继续解析参数，最后再返回
+				if zobj == nil {
+					frommember = true
+					i++
+					continue
+				}
+				if longLatFromMember(zobj, c.argv[baseArgs+i+1], &shape.XY) != C_OK {
+					addReplyError(c, "could not decode requested zset member")
+					return
+				}
+				frommember = true
+				i++
+			} else if util.StrCaseCmp(arg, "fromlonlat") && i+2 < remaining && flags&geoSearch > 0 && !frommember {
+				if extractLongLatOrReply(c, c.argv[baseArgs+i+1:], &shape.XY) != C_OK {
+					return
+				}
+				fromloc = true
+				i += 2
+			} else if util.StrCaseCmp(arg, "byradius") && i+2 < remaining && flags&geoSearch > 0 && !bybox {
+				if extractDistanceOrReply(c, c.argv[baseArgs+i+1:], &shape.Conversion, &shape.Radius) != C_OK {
+					return
+				}
+				shape.Type = geohash.CircularType
+				byradius = true
+				i += 2
+			} else if util.StrCaseCmp(arg, "bybox") && i+3 < remaining && flags&geoSearch > 0 && !byradius {
+				if extractBoxOrReply(c, c.argv[baseArgs+i+1:], &shape.Conversion, &shape.Width, &shape.Height) != C_OK {
+					return
+				}
+				shape.Type = geohash.RectangleType
+				bybox = true
+				i += 3
+			} else {
+				addReplyErrorObject(c, shared.syntaxErr)
+				return
+			}
+		}
+	}
+
+	// STORE和STOREDIST不能和WITH*一起使用
+	if storekey != nil && (withdist || withhash || withcoords) {
+		opt := "STORE option in GEORADIUS"
+		if flags&geoSearchStore > 0 {
+			opt = "GEOSEARCHSTORE"
+		}
+		addReplyErrorFormat(c, "%s is not compatible with WITHDIST, WITHHASH and WITHCOORD options", opt)
+		return
+	}
+
+	if flags&geoSearch > 0 && !(frommember || fromloc) {
+		addReplyErrorFormat(c, "exactly one of FROMMEMBER or FROMLONLAT can be specified for %s", argvBytes(c.argv[0]))
+		return
+	}
+
+	if flags&geoSearch > 0 && !(byradius || bybox) {
+		addReplyErrorFormat(c, "exactly one of BYRADIUS and BYBOX can be specified for %s", argvBytes(c.argv[0]))
+		return
+	}
+
+	if anyFlag && count == 0 {
+		addReplyError(c, "the ANY argument requires COUNT argument")
+		return
+	}
+
+	// key不存在
+	if zobj == nil {
+		if storekey != nil {
+			// 删除目标key并且返回0
+			if dbDelete(c.db, storekey) {
+				signalModifiedKey(c, c.db, storekey)
+				notifyKeySpaceEvent(notifyGeneric, "del", storekey, c.db.id)
+				server.dirty++
+			}
+			addReply(c, shared.czero)
+		} else {
+			addReply(c, shared.emptyArray)
+		}
+		return
+	}
+
+	// 需要排序之后才能返回最近的count个结果，ANY则不需要
+	if count != 0 && sorting == sortNone && !anyFlag {
+		sorting = sortAsc
+	}
+
+	// 计算需要搜索的格子，然后搜索
+	georadius := geohash.CalculateAreasByShapeWGS84(&shape)
+	var ga []geoPoint
+	limit := 0
+	if anyFlag {
+		limit = int(count)
+	}
+	membersOfAllNeighbors(zobj, &georadius, &shape, &ga, limit)
+
+	// 没有找到
+	if len(ga) == 0 && storekey == nil {
+		addReply(c, shared.emptyArray)
+		return
+	}
+
+	resultLength := len(ga)
+	returnedItems := resultLength
+	if count != 0 && int64(resultLength) > count {
+		returnedItems = int(count)
+	}
+
+	if sorting == sortAsc {
+		sortGeoPoints(ga, func(a, b float64) bool { return a < b })
+	} else if sorting == sortDesc {
+		sortGeoPoints(ga, func(a, b float64) bool { return a > b })
+	}
+
+	if storekey == nil {
+		// 每个结果都是一个数组，包含成员以及WITH*选项要求的内容
+		optionLength := 0
+		if withdist {
+			optionLength++
+		}
+		if withcoords {
+			optionLength++
+		}
+		if withhash {
+			optionLength++
+		}
+
+		addReplyArrayLen(c, returnedItems)
+		for i := 0; i < returnedItems; i++ {
+			gp := &ga[i]
+			gp.dist /= shape.Conversion // 转换成请求的单位
+
+			if optionLength > 0 {
+				addReplyArrayLen(c, optionLength+1)
+			}
+
+			member := gp.member.BufData(0)
+			addReplyBulkBuffer(c, member, len(member))
+
+			if withdist {
+				addReplyDoubleDistance(c, gp.dist)
+			}
+			if withhash {
+				addReplyLongLong(c, int(gp.score))
+			}
+			if withcoords {
+				addReplyArrayLen(c, 2)
+				addReplyHumanLongDouble(c, gp.longitude)
+				addReplyHumanLongDouble(c, gp.latitude)
+			}
+		}
+	} else {
+		// 保存结果到有序集合中
+		var dstobj *robj
+		var zs *zset
+		maxelelen := 0
+
+		if returnedItems > 0 {
+			dstobj = createZsetObject()
+			zs = (*zset)(dstobj.ptr)
+		}
+
+		for i := 0; i < returnedItems; i++ {
+			gp := &ga[i]
+			gp.dist /= shape.Conversion
+			score := gp.score
+			if storedist {
+				score = gp.dist
+			}
+			if elelen := sds.Len(gp.member); maxelelen < elelen {
+				maxelelen = elelen
+			}
+
+			member := gp.member
+			znode := zslInsert(zs.zsl, score, member)
+			if !zs.dict.Add(unsafe.Pointer(&member), unsafe.Pointer(&znode.score)) {
+				panic("geo: duplicated member")
+			}
+		}
+
+		if returnedItems > 0 {
+			zsetConvertToListpackIfNeeded(dstobj, maxelelen)
+			c.db.genericSetKey(c, storekey, dstobj, false, true)
+			dstobj.decrRefCount()
+			event := "georadiusstore"
+			if flags&geoSearch > 0 {
+				event = "geosearchstore"
+			}
+			notifyKeySpaceEvent(notifyZset, event, storekey, c.db.id)
+			server.dirty += returnedItems
+		} else if dbDelete(c.db, storekey) {
+			signalModifiedKey(c, c.db, storekey)
+			notifyKeySpaceEvent(notifyGeneric, "del", storekey, c.db.id)
+			server.dirty++
+		}
+		addReplyLongLong(c, returnedItems)
+	}
+}
+
+// sortGeoPoints 按距离排序
+func sortGeoPoints(ga []geoPoint, less func(a, b float64) bool) {
+	sort.Slice(ga, func(i, j int) bool {
+		return less(ga[i].dist, ga[j].dist)
+	})
+}
+
+// GEORADIUS wrapper function.
+func georadiusCommand(c *Client) {
+	georadiusGeneric(c, 1, radiusCoords)
+}
+
+// GEORADIUSBYMEMBER wrapper function.
+func georadiusbymemberCommand(c *Client) {
+	georadiusGeneric(c, 1, radiusMember)
+}
+
+// GEORADIUS_RO wrapper function.
+func georadiusroCommand(c *Client) {
+	georadiusGeneric(c, 1, radiusCoords|radiusNoStore)
+}
+
+// GEORADIUSBYMEMBER_RO wrapper function.
+func georadiusbymemberroCommand(c *Client) {
+	georadiusGeneric(c, 1, radiusMember|radiusNoStore)
+}
+
+func geosearchCommand(c *Client) {
+	georadiusGeneric(c, 1, geoSearch)
+}
+
+func geosearchstoreCommand(c *Client) {
+	georadiusGeneric(c, 2, geoSearch|geoSearchStore)
+}
+
+// GEOHASH key ele1 ele2 ... eleN
+//
+// 返回标准的11个字符的geohash字符串
+func geohashCommand(c *Client) {
+	const geoalphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+	zobj := c.db.lookupKeyRead(c.argv[1])
+	if zobj != nil && zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	addReplyArrayLen(c, c.argc-2)
+	for j := 2; j < c.argc; j++ {
+		var score float64
+		if zobj == nil || zsetScore(zobj, *(*sds.SDS)(c.argv[j].ptr), &score) != C_OK {
+			addReplyNull(c)
+			continue
+		}
+
+		// 内部使用的纬度范围是-85到85，标准的geohash使用的是-90到90，
+		// 所以需要先解码再用标准的范围重新编码
+		var xy [2]float64
+		if !decodeGeohash(score, &xy) {
+			addReplyNull(c)
+			continue
+		}
+
+		var hash geohash.Bits
+		geohash.Encode(geohash.Range{Min: -180, Max: 180}, geohash.Range{Min: -90, Max: 90},
+			xy[0], xy[1], 26, &hash)
+
+		var buf [11]byte
+		for i := 0; i < 11; i++ {
+			idx := 0
+			// 只有52位，为了兼容输出11个字符，最后一个字符当做0
+			if i != 10 {
+				idx = int((hash.Bits >> (52 - (i+1)*5)) & 0x1f)
+			}
+			buf[i] = geoalphabet[idx]
+		}
+		addReplyBulkBuffer(c, buf[:], len(buf))
+	}
+}
+
+// GEOPOS key ele1 ele2 ... eleN
+//
+// 返回成员的经纬度，成员不存在时返回null
+func geoposCommand(c *Client) {
+	zobj := c.db.lookupKeyRead(c.argv[1])
+	if zobj != nil && zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	addReplyArrayLen(c, c.argc-2)
+	for j := 2; j < c.argc; j++ {
+		var score float64
+		if zobj == nil || zsetScore(zobj, *(*sds.SDS)(c.argv[j].ptr), &score) != C_OK {
+			addReply(c, shared.nullArray[c.resp])
+			continue
+		}
+
+		var xy [2]float64
+		if !decodeGeohash(score, &xy) {
+			addReply(c, shared.nullArray[c.resp])
+			continue
+		}
+		addReplyArrayLen(c, 2)
+		addReplyHumanLongDouble(c, xy[0])
+		addReplyHumanLongDouble(c, xy[1])
+	}
+}
+
+// GEODIST key ele1 ele2 [unit]
+//
+// 返回两个成员之间的距离，默认单位是米
+func geodistCommand(c *Client) {
+	toMeter := float64(1)
+
+	if c.argc == 5 {
+		toMeter = extractUnitOrReply(c, c.argv[4])
+		if toMeter < 0 {
+			return
+		}
+	} else if c.argc > 5 {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+
+	zobj := lookupKeyReadOrReply(c, c.argv[1], shared.null[c.resp])
+	if zobj == nil || zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	var score1, score2 float64
+	if zsetScore(zobj, *(*sds.SDS)(c.argv[2].ptr), &score1) != C_OK ||
+		zsetScore(zobj, *(*sds.SDS)(c.argv[3].ptr), &score2) != C_OK {
+		addReplyNull(c)
+		return
+	}
+
+	var xy1, xy2 [2]float64
+	if !decodeGeohash(score1, &xy1) || !decodeGeohash(score2, &xy2) {
+		addReplyNull(c)
+		return
+	}
+	addReplyDoubleDistance(c, geohash.GetDistance(xy1[0], xy1[1], xy2[0], xy2[1])/toMeter)
+}
@@ -0,0 +1,155 @@
+package main
+
+import "testing"
+
+const (
+	palermoPos = "[13.361389338970184 38.1155563954963]"
+	cataniaPos = "[15.087267458438873 37.50266842333162]"
+)
+
+func TestGeoaddCommand(t *testing.T) {
+	testServerInit()
+	testRun(t, testClient(), []testCase{
+		{"geoadd Sicily 13.361389 38.115556 Palermo 15.087269 37.502669 Catania", ":2"},
+		// NX只添加新的元素，不更新已经存在的元素
+		{"geoadd Sicily NX 0 0 Palermo 12.758489 38.788135 edge1", ":1"},
+		{"geopos Sicily Palermo", "[" + palermoPos + "]"},
+		// XX只更新已经存在的元素，CH返回变化的元素个数
+		{"geoadd Sicily XX 15 37.5 Catania 1 1 nomember", ":0"},
+		{"geoadd Sicily XX CH 13.361389 38.115556 Palermo 15.087269 37.502669 Catania 1 1 nomember", ":1"},
+		{"geopos Sicily Catania nomember", "[" + cataniaPos + " (nil)]"},
+		{"geoadd Sicily CH 13.361389 38.115556 Palermo", ":0"},
+		{"zcard Sicily", ":3"},
+
+		{"geoadd Sicily XX NX 1 1 a", "-ERR syntax error"},
+		{"geoadd Sicily 1 1 a 2", "-ERR syntax error"},
+		{"geoadd Sicily 200 1 a", "-ERR invalid longitude,latitude pair 200.000000,1.000000"},
+		{"geoadd Sicily 1 86 a", "-ERR invalid longitude,latitude pair 1.000000,86.000000"},
+		{"set str x", "+OK"},
+		{"geoadd str 1 1 a", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+	})
+}
+
+func TestGeoQueryCommands(t *testing.T) {
+	testServerInit()
+	testRun(t, testClient(), []testCase{
+		{"geoadd Sicily 13.361389 38.115556 Palermo 15.087269 37.502669 Catania", ":2"},
+
+		{"geodist Sicily Palermo Catania", "166274.1516"},
+		{"geodist Sicily Palermo Catania m", "166274.1516"},
+		{"geodist Sicily Palermo Catania KM", "166.2742"},
+		{"geodist Sicily Palermo Catania mi", "103.3182"},
+		{"geodist Sicily Palermo Catania ft", "545518.8700"},
+		{"geodist Sicily Palermo Palermo", "0.0000"},
+		{"geodist Sicily Palermo Catania parsec", "-ERR unsupported unit provided. please use M, KM, FT, MI"},
+		{"geodist Sicily Palermo nomember", "(nil)"},
+		{"geodist nokey Palermo Catania", "(nil)"},
+
+		{"geopos Sicily Palermo Catania nomember", "[" + palermoPos + " " + cataniaPos + " (nil)]"},
+		{"geopos nokey Palermo", "[(nil)]"},
+		{"geohash Sicily Palermo Catania nomember", "[sqc8b49rny0 sqdtr74hyu0 (nil)]"},
+		{"geohash nokey Palermo", "[(nil)]"},
+
+		{"set str x", "+OK"},
+		{"geopos str a", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"geodist str a b", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+	})
+}
+
+func TestGeosearchCommand(t *testing.T) {
+	testServerInit()
+	testRun(t, testClient(), []testCase{
+		{"geoadd Sicily 13.361389 38.115556 Palermo 15.087269 37.502669 Catania", ":2"},
+		{"geoadd Sicily 12.758489 38.788135 edge1 2.349014 48.864716 Paris", ":2"},
+
+		// FROMLONLAT BYRADIUS
+		{"geosearch Sicily FROMLONLAT 15 37 BYRADIUS 200 km ASC", "[Catania Palermo]"},
+		{"geosearch Sicily FROMLONLAT 15 37 BYRADIUS 200 km DESC", "[Palermo Catania]"},
+		{"geosearch Sicily FROMLONLAT 15 37 BYRADIUS 200000 m ASC WITHDIST", "[[Catania 56441.2579] [Palermo 190442.4298]]"},
+		{"geosearch Sicily FROMLONLAT 15 37 BYRADIUS 200 km ASC WITHCOORD WITHDIST WITHHASH",
+			"[[Catania 56.4413 :3479447370796909 " + cataniaPos + "] [Palermo 190.4424 :3479099956230698 " + palermoPos + "]]"},
+		{"geosearch Sicily FROMLONLAT 15 37 BYRADIUS 200 km ASC COUNT 1", "[Catania]"},
+		{"geosearch Sicily FROMLONLAT 15 37 BYRADIUS 200 km DESC COUNT 1 WITHDIST", "[[Palermo 190.4424]]"},
+		{"geosearch Sicily FROMLONLAT 15 37 BYRADIUS 50 km", "[]"},
+		{"geosearch nokey FROMLONLAT 15 37 BYRADIUS 200 km", "[]"},
+
+		// FROMMEMBER BYBOX，宽高是矩形的边长
+		{"geosearch Sicily FROMMEMBER Palermo BYBOX 400 400 km ASC WITHDIST", "[[Palermo 0.0000] [edge1 91.4007] [Catania 166.2742]]"},
+		{"geosearch Sicily FROMMEMBER Palermo BYBOX 400 400 km DESC", "[Catania edge1 Palermo]"},
+		{"geosearch Sicily FROMMEMBER Palermo BYBOX 200 200 km ASC", "[Palermo edge1]"},
+		{"geosearch Sicily FROMMEMBER Palermo BYBOX 100 100 km ASC", "[Palermo]"},
+		{"geosearch Sicily FROMMEMBER Palermo BYRADIUS 100 km ASC", "[Palermo edge1]"},
+		{"geosearch Sicily FROMLONLAT 15 37 BYBOX 200 200 km COUNT 1 ANY WITHDIST", "[[Catania 56.4413]]"},
+
+		{"geosearch Sicily FROMLONLAT 15 37 BYRADIUS 200 km ANY", "-ERR the ANY argument requires COUNT argument"},
+		{"geosearch Sicily FROMLONLAT 15 37 BYRADIUS 200 km COUNT 0", "-ERR COUNT must be > 0"},
+		{"geosearch Sicily FROMLONLAT 15 37 BYRADIUS -1 km", "-ERR radius cannot be negative"},
+		{"geosearch Sicily FROMLONLAT 15 37 BYRADIUS 1 parsec", "-ERR unsupported unit provided. please use M, KM, FT, MI"},
+		{"geosearch Sicily FROMMEMBER nomember BYBOX 100 100 km", "-ERR could not decode requested zset member"},
+		{"geosearch Sicily FROMMEMBER Palermo FROMLONLAT 1 1 BYBOX 100 100 km", "-ERR syntax error"},
+		{"geosearch Sicily FROMMEMBER Palermo BYRADIUS 10 km BYBOX 1 1 km", "-ERR syntax error"},
+		{"geosearch Sicily FROMMEMBER Palermo BYRADIUS 10 km STORE dst", "-ERR syntax error"},
+		{"geosearch Sicily FROMMEMBER Palermo COUNT 1 ASC", "-ERR exactly one of BYRADIUS and BYBOX can be specified for geosearch"},
+		{"geosearch Sicily BYRADIUS 10 km ASC COUNT 1", "-ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for geosearch"},
+		{"set str x", "+OK"},
+		{"geosearch str FROMLONLAT 1 1 BYRADIUS 1 km", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+	})
+}
+
+func TestGeosearchstoreCommand(t *testing.T) {
+	testServerInit()
+	testRun(t, testClient(), []testCase{
+		{"geoadd Sicily 13.361389 38.115556 Palermo 15.087269 37.502669 Catania", ":2"},
+		{"geoadd Sicily 2.349014 48.864716 Paris", ":1"},
+
+		// 默认保存geohash作为分数，目标key可以直接用GEO命令查询
+		{"geosearchstore dst Sicily FROMLONLAT 15 37 BYRADIUS 200 km ASC", ":2"},
+		{"zrange dst 0 -1 withscores", "[Palermo 3479099956230698 Catania 3479447370796909]"},
+		{"geopos dst Palermo", "[" + palermoPos + "]"},
+		{"geosearchstore dst Sicily FROMLONLAT 15 37 BYRADIUS 200 km DESC COUNT 1", ":1"},
+		{"zrange dst 0 -1", "[Palermo]"},
+
+		// STOREDIST保存以请求的单位表示的距离
+		{"geosearchstore dst2 Sicily FROMLONLAT 15 37 BYRADIUS 200 km ASC STOREDIST", ":2"},
+		{"zrange dst2 0 -1 withscores", "[Catania 56.441257870158204 Palermo 190.44242984775781]"},
+		{"geosearchstore dst2 Sicily FROMMEMBER Palermo BYBOX 400 400 km STOREDIST", ":2"},
+		{"zscore dst2 Palermo", "0"},
+
+		// 结果为空时删除目标key
+		{"geosearchstore dst2 Sicily FROMLONLAT 15 37 BYRADIUS 1 km", ":0"},
+		{"exists dst2", ":0"},
+		{"geosearchstore dst nokey FROMLONLAT 15 37 BYRADIUS 1 km", ":0"},
+		{"exists dst", ":0"},
+
+		{"geosearchstore dst Sicily FROMLONLAT 15 37 BYRADIUS 200 km WITHDIST",
+			"-ERR GEOSEARCHSTORE is not compatible with WITHDIST, WITHHASH and WITHCOORD options"},
+	})
+}
+
+func TestGeoradiusCommands(t *testing.T) {
+	testServerInit()
+	testRun(t, testClient(), []testCase{
+		{"geoadd Sicily 13.361389 38.115556 Palermo 15.087269 37.502669 Catania", ":2"},
+		{"geoadd Sicily 12.758489 38.788135 edge1", ":1"},
+
+		{"georadius Sicily 15 37 200 km WITHDIST ASC", "[[Catania 56.4413] [Palermo 190.4424]]"},
+		{"georadius Sicily 15 37 200 km WITHDIST WITHCOORD ASC COUNT 1", "[[Catania 56.4413 " + cataniaPos + "]]"},
+		{"georadius Sicily 15 37 200 km DESC", "[Palermo Catania]"},
+		{"georadius_ro Sicily 15 37 200 km ASC", "[Catania Palermo]"},
+		{"georadiusbymember Sicily Palermo 200 km WITHDIST ASC", "[[Palermo 0.0000] [edge1 91.4007] [Catania 166.2742]]"},
+		{"georadiusbymember_ro Sicily Palermo 200 km DESC", "[Catania edge1 Palermo]"},
+		{"georadiusbymember Sicily nomember 200 km", "-ERR could not decode requested zset member"},
+
+		{"georadius Sicily 15 37 200 km ASC STORE dst", ":2"},
+		{"zrange dst 0 -1", "[Palermo Catania]"},
+		{"georadius Sicily 15 37 200 km DESC STOREDIST dst2", ":2"},
+		{"zrange dst2 0 -1 withscores", "[Catania 56.441257870158204 Palermo 190.44242984775781]"},
+		{"georadiusbymember Sicily Palermo 100 km STORE dst3", ":2"},
+		{"zrange dst3 0 -1", "[Palermo edge1]"},
+
+		{"georadius_ro Sicily 15 37 200 km STORE dst4", "-ERR syntax error"},
+		{"georadius Sicily 15 37 200 km WITHDIST STORE dst4",
+			"-ERR STORE option in GEORADIUS is not compatible with WITHDIST, WITHHASH and WITHCOORD options"},
+		{"exists dst4", ":0"},
+	})
+}
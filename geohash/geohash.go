@@ -0,0 +1,251 @@
+package geohash
+
+// geohash把经纬度编码成一个整数：经度和纬度分别二分step次，得到两个step位的整数，
+// 再把它们的bit交错在一起，纬度在偶数位，经度在奇数位。
+// 前缀相同的hash表示的区域是相邻的，所以可以用有序集合的score做范围查询
+
+const (
+	StepMax = 26 // 26*2 = 52 bits，正好可以无损保存在double中
+
+	// 墨卡托投影的纬度范围，EPSG:900913 / EPSG:3785 / OSGEO:41001
+	LatMin  = -85.05112878
+	LatMax  = 85.05112878
+	LongMin = -180
+	LongMax = 180
+)
+
+type Bits struct {
+	Bits uint64
+	Step uint8
+}
+
+type Range struct {
+	Min, Max float64
+}
+
+type Area struct {
+	Hash      Bits
+	Longitude Range
+	Latitude  Range
+}
+
+type Neighbors struct {
+	North, East, West, South Bits
+	NorthEast, SouthEast     Bits
+	NorthWest, SouthWest     Bits
+}
+
+// IsZero hash为0的区域在搜索时会被跳过
+func (h Bits) IsZero() bool {
+	return h.Bits == 0 && h.Step == 0
+}
+
+func (r Range) isZero() bool {
+	return r.Max == 0 && r.Min == 0
+}
+
+// interleave64 交错x和y的bit，x在偶数位，y在奇数位
+// http://graphics.stanford.edu/~seander/bithacks.html#InterleaveBMN
+func interleave64(xlo, ylo uint32) uint64 {
+	B := [...]uint64{0x5555555555555555, 0x3333333333333333,
+		0x0F0F0F0F0F0F0F0F, 0x00FF00FF00FF00FF,
+		0x0000FFFF0000FFFF}
+	S := [...]uint{1, 2, 4, 8, 16}
+
+	x, y := uint64(xlo), uint64(ylo)
+
+	x = (x | (x << S[4])) & B[4]
+	y = (y | (y << S[4])) & B[4]
+
+	x = (x | (x << S[3])) & B[3]
+	y = (y | (y << S[3])) & B[3]
+
+	x = (x | (x << S[2])) & B[2]
+	y = (y | (y << S[2])) & B[2]
+
+	x = (x | (x << S[1])) & B[1]
+	y = (y | (y << S[1])) & B[1]
+
+	x = (x | (x << S[0])) & B[0]
+	y = (y | (y << S[0])) & B[0]
+
+	return x | (y << 1)
+}
+
+// deinterleave64 interleave64的逆操作，偶数位放在低32位，奇数位放在高32位
+func deinterleave64(interleaved uint64) uint64 {
+	B := [...]uint64{0x5555555555555555, 0x3333333333333333,
+		0x0F0F0F0F0F0F0F0F, 0x00FF00FF00FF00FF,
+		0x0000FFFF0000FFFF, 0x00000000FFFFFFFF}
+	S := [...]uint{0, 1, 2, 4, 8, 16}
+
+	x := interleaved
+	y := interleaved >> 1
+
+	for i := range S {
+		x = (x | (x >> S[i])) & B[i]
+		y = (y | (y >> S[i])) & B[i]
+	}
+
+	return x | (y << 32)
+}
+
+// GetCoordRange 返回WGS84的经纬度范围
+func GetCoordRange() (longRange, latRange Range) {
+	return Range{LongMin, LongMax}, Range{LatMin, LatMax}
+}
+
+// Encode 在给定的范围内把经纬度编码成step*2位的hash，参数不合法时返回false
+func Encode(longRange, latRange Range, longitude, latitude float64, step uint8, hash *Bits) bool {
+	if hash == nil || step > 32 || step == 0 || latRange.isZero() || longRange.isZero() {
+		return false
+	}
+
+	// 超出了墨卡托投影能表示的范围
+	if longitude > LongMax || longitude < LongMin || latitude > LatMax || latitude < LatMin {
+		return false
+	}
+
+	hash.Bits = 0
+	hash.Step = step
+
+	if latitude < latRange.Min || latitude > latRange.Max ||
+		longitude < longRange.Min || longitude > longRange.Max {
+		return false
+	}
+
+	latOffset := (latitude - latRange.Min) / (latRange.Max - latRange.Min)
+	longOffset := (longitude - longRange.Min) / (longRange.Max - longRange.Min)
+
+	// 转换成step位的定点数
+	latOffset *= float64(uint64(1) << step)
+	longOffset *= float64(uint64(1) << step)
+	hash.Bits = interleave64(uint32(latOffset), uint32(longOffset))
+	return true
+}
+
+// EncodeWGS84 使用WGS84的经纬度范围编码
+func EncodeWGS84(longitude, latitude float64, step uint8, hash *Bits) bool {
+	longRange, latRange := GetCoordRange()
+	return Encode(longRange, latRange, longitude, latitude, step, hash)
+}
+
+// Decode 把hash解码成它表示的矩形区域
+func Decode(longRange, latRange Range, hash Bits, area *Area) bool {
+	if hash.IsZero() || area == nil || latRange.isZero() || longRange.isZero() {
+		return false
+	}
+
+	area.Hash = hash
+	step := hash.Step
+	hashSep := deinterleave64(hash.Bits)
+
+	latScale := latRange.Max - latRange.Min
+	longScale := longRange.Max - longRange.Min
+
+	ilato := uint32(hashSep)       // 纬度在低32位
+	ilono := uint32(hashSep >> 32) // 经度在高32位
+
+	// 得到纬度和经度所在的区间
+	area.Latitude.Min = latRange.Min + (float64(ilato)/float64(uint64(1)<<step))*latScale
+	area.Latitude.Max = latRange.Min + (float64(ilato+1)/float64(uint64(1)<<step))*latScale
+	area.Longitude.Min = longRange.Min + (float64(ilono)/float64(uint64(1)<<step))*longScale
+	area.Longitude.Max = longRange.Min + (float64(ilono+1)/float64(uint64(1)<<step))*longScale
+	return true
+}
+
+// DecodeWGS84 使用WGS84的经纬度范围解码
+func DecodeWGS84(hash Bits, area *Area) bool {
+	longRange, latRange := GetCoordRange()
+	return Decode(longRange, latRange, hash, area)
+}
+
+// DecodeAreaToLongLat 用区域的中心点作为解码出来的经纬度
+func DecodeAreaToLongLat(area *Area, xy *[2]float64) bool {
+	if xy == nil {
+		return false
+	}
+	xy[0] = (area.Longitude.Min + area.Longitude.Max) / 2
+	if xy[0] > LongMax {
+		xy[0] = LongMax
+	}
+	if xy[0] < LongMin {
+		xy[0] = LongMin
+	}
+	xy[1] = (area.Latitude.Min + area.Latitude.Max) / 2
+	if xy[1] > LatMax {
+		xy[1] = LatMax
+	}
+	if xy[1] < LatMin {
+		xy[1] = LatMin
+	}
+	return true
+}
+
+// DecodeToLongLatWGS84 把hash解码成经纬度
+func DecodeToLongLatWGS84(hash Bits, xy *[2]float64) bool {
+	var area Area
+	if xy == nil || !DecodeWGS84(hash, &area) {
+		return false
+	}
+	return DecodeAreaToLongLat(&area, xy)
+}
+
+// moveX 在经度方向上移动d个格子，经度在奇数位
+func moveX(hash *Bits, d int8) {
+	if d == 0 {
+		return
+	}
+
+	x := hash.Bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.Bits & 0x5555555555555555
+
+	zz := uint64(0x5555555555555555) >> (64 - uint(hash.Step)*2)
+
+	if d > 0 {
+		x = x + (zz + 1)
+	} else {
+		x = x | zz
+		x = x - (zz + 1)
+	}
+
+	x &= uint64(0xaaaaaaaaaaaaaaaa) >> (64 - uint(hash.Step)*2)
+	hash.Bits = x | y
+}
+
+// moveY 在纬度方向上移动d个格子，纬度在偶数位
+func moveY(hash *Bits, d int8) {
+	if d == 0 {
+		return
+	}
+
+	x := hash.Bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.Bits & 0x5555555555555555
+
+	zz := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - uint(hash.Step)*2)
+	if d > 0 {
+		y = y + (zz + 1)
+	} else {
+		y = y | zz
+		y = y - (zz + 1)
+	}
+	y &= uint64(0x5555555555555555) >> (64 - uint(hash.Step)*2)
+	hash.Bits = x | y
+}
+
+// GetNeighbors 计算周围8个相同精度的区域
+func GetNeighbors(hash *Bits, neighbors *Neighbors) {
+	move := func(dst *Bits, dx, dy int8) {
+		*dst = *hash
+		moveX(dst, dx)
+		moveY(dst, dy)
+	}
+	move(&neighbors.East, 1, 0)
+	move(&neighbors.West, -1, 0)
+	move(&neighbors.South, 0, -1)
+	move(&neighbors.North, 0, 1)
+	move(&neighbors.NorthWest, -1, 1)
+	move(&neighbors.SouthWest, -1, -1)
+	move(&neighbors.NorthEast, 1, 1)
+	move(&neighbors.SouthEast, 1, -1)
+}
@@ -0,0 +1,229 @@
+package geohash
+
+import "math"
+
+const (
+	dr = math.Pi / 180.0
+	rd = 180.0 / math.Pi
+
+	// EarthRadiusInMeters 和其它的geo实现保持一致，使用的是地球的平均半径
+	EarthRadiusInMeters = 6372797.560856
+
+	mercatorMax = 20037726.37
+)
+
+const (
+	CircularType  = 1 // 按半径搜索
+	RectangleType = 2 // 按矩形搜索
+)
+
+// Shape 表示搜索的区域，XY是中心点，半径和宽高都需要乘以Conversion转换成米
+type Shape struct {
+	Type       int
+	XY         [2]float64
+	Conversion float64
+	Bounds     [4]float64
+	Radius     float64
+	Width      float64
+	Height     float64
+}
+
+// Radius 中心点所在的区域，以及周围8个区域，不需要搜索的区域被置为0
+type Radius struct {
+	Hash      Bits
+	Area      Area
+	Neighbors Neighbors
+}
+
+func degRad(ang float64) float64 { return ang * dr }
+func radDeg(ang float64) float64 { return ang * rd }
+
+// EstimateStepsByRadius 估计一个合适的精度，使得格子的大小刚好能包含半径为rangeMeters的区域
+func EstimateStepsByRadius(rangeMeters, lat float64) uint8 {
+	if rangeMeters == 0 {
+		return 26
+	}
+	step := 1
+	for rangeMeters < mercatorMax {
+		rangeMeters *= 2
+		step++
+	}
+	step -= 2 // 保证大部分情况下区域都能被包含
+
+	// 高纬度的格子在经度方向上更窄，需要降低精度
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+
+	if step < 1 {
+		step = 1
+	}
+	if step > 26 {
+		step = 26
+	}
+	return uint8(step)
+}
+
+// BoundingBox 计算包含搜索区域的经纬度矩形，bounds依次是min_lon, min_lat, max_lon, max_lat。
+// 在北半球，矩形上边的经度跨度更大，南半球则是下边，所以用离极点更近的一边计算经度跨度
+func BoundingBox(shape *Shape, bounds *[4]float64) bool {
+	if bounds == nil {
+		return false
+	}
+	longitude := shape.XY[0]
+	latitude := shape.XY[1]
+	var height, width float64
+	if shape.Type == CircularType {
+		height = shape.Conversion * shape.Radius
+		width = shape.Conversion * shape.Radius
+	} else {
+		height = shape.Conversion * shape.Height / 2
+		width = shape.Conversion * shape.Width / 2
+	}
+
+	latDelta := radDeg(height / EarthRadiusInMeters)
+	longDeltaTop := radDeg(width / EarthRadiusInMeters / math.Cos(degRad(latitude+latDelta)))
+	longDeltaBottom := radDeg(width / EarthRadiusInMeters / math.Cos(degRad(latitude-latDelta)))
+
+	if latitude < 0 {
+		bounds[0] = longitude - longDeltaBottom
+		bounds[2] = longitude + longDeltaBottom
+	} else {
+		bounds[0] = longitude - longDeltaTop
+		bounds[2] = longitude + longDeltaTop
+	}
+	bounds[1] = latitude - latDelta
+	bounds[3] = latitude + latDelta
+	return true
+}
+
+// CalculateAreasByShapeWGS84 计算需要搜索的9个区域，它们一定能覆盖整个搜索区域
+func CalculateAreasByShapeWGS84(shape *Shape) Radius {
+	var radius Radius
+	var hash Bits
+	var neighbors Neighbors
+	var area Area
+
+	BoundingBox(shape, &shape.Bounds)
+	minLon, minLat := shape.Bounds[0], shape.Bounds[1]
+	maxLon, maxLat := shape.Bounds[2], shape.Bounds[3]
+
+	longitude := shape.XY[0]
+	latitude := shape.XY[1]
+	// 矩形使用对角线的一半作为半径
+	radiusMeters := shape.Radius
+	if shape.Type != CircularType {
+		radiusMeters = math.Sqrt((shape.Width/2)*(shape.Width/2) + (shape.Height/2)*(shape.Height/2))
+	}
+	radiusMeters *= shape.Conversion
+
+	steps := EstimateStepsByRadius(radiusMeters, latitude)
+
+	longRange, latRange := GetCoordRange()
+	Encode(longRange, latRange, longitude, latitude, steps, &hash)
+	GetNeighbors(&hash, &neighbors)
+	Decode(longRange, latRange, hash, &area)
+
+	// 估计出来的精度不一定能覆盖整个区域，比如中心点靠近格子边缘的时候，
+	// 这时需要检查周围的格子是否覆盖了bounding box，不能覆盖时降低一级精度
+	decreaseStep := false
+	{
+		var north, south, east, west Area
+		Decode(longRange, latRange, neighbors.North, &north)
+		Decode(longRange, latRange, neighbors.South, &south)
+		Decode(longRange, latRange, neighbors.East, &east)
+		Decode(longRange, latRange, neighbors.West, &west)
+
+		if north.Latitude.Max < maxLat ||
+			south.Latitude.Min > minLat ||
+			east.Longitude.Max < maxLon ||
+			west.Longitude.Min > minLon {
+			decreaseStep = true
+		}
+	}
+
+	if steps > 1 && decreaseStep {
+		steps--
+		Encode(longRange, latRange, longitude, latitude, steps, &hash)
+		GetNeighbors(&hash, &neighbors)
+		Decode(longRange, latRange, hash, &area)
+	}
+
+	// 去掉和搜索区域没有交集的格子
+	if steps >= 2 {
+		if area.Latitude.Min < minLat {
+			neighbors.South = Bits{}
+			neighbors.SouthWest = Bits{}
+			neighbors.SouthEast = Bits{}
+		}
+		if area.Latitude.Max > maxLat {
+			neighbors.North = Bits{}
+			neighbors.NorthEast = Bits{}
+			neighbors.NorthWest = Bits{}
+		}
+		if area.Longitude.Min < minLon {
+			neighbors.West = Bits{}
+			neighbors.SouthWest = Bits{}
+			neighbors.NorthWest = Bits{}
+		}
+		if area.Longitude.Max > maxLon {
+			neighbors.East = Bits{}
+			neighbors.SouthEast = Bits{}
+			neighbors.NorthEast = Bits{}
+		}
+	}
+	radius.Hash = hash
+	radius.Neighbors = neighbors
+	radius.Area = area
+	return radius
+}
+
+// Align52Bits 把hash对齐到52位，作为有序集合的score
+func Align52Bits(hash Bits) uint64 {
+	return hash.Bits << (52 - uint(hash.Step)*2)
+}
+
+// GetLatDistance 计算两个纬度之间的距离
+func GetLatDistance(lat1d, lat2d float64) float64 {
+	return EarthRadiusInMeters * math.Abs(degRad(lat2d)-degRad(lat1d))
+}
+
+// GetDistance 使用haversine公式计算两点之间的距离
+func GetDistance(lon1d, lat1d, lon2d, lat2d float64) float64 {
+	lon1r := degRad(lon1d)
+	lon2r := degRad(lon2d)
+	v := math.Sin((lon2r - lon1r) / 2)
+	// 经度相同时只需要计算纬度的距离
+	if v == 0.0 {
+		return GetLatDistance(lat1d, lat2d)
+	}
+	lat1r := degRad(lat1d)
+	lat2r := degRad(lat2d)
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2.0 * EarthRadiusInMeters * math.Asin(math.Sqrt(a))
+}
+
+// GetDistanceIfInRadiusWGS84 两点距离不超过radius时返回true，distance返回距离
+func GetDistanceIfInRadiusWGS84(x1, y1, x2, y2, radius float64, distance *float64) bool {
+	*distance = GetDistance(x1, y1, x2, y2)
+	return *distance <= radius
+}
+
+// GetDistanceIfInRectangle (x2, y2)在以(x1, y1)为中心、宽高为widthM和heightM的矩形内时返回true
+func GetDistanceIfInRectangle(widthM, heightM, x1, y1, x2, y2 float64, distance *float64) bool {
+	// 纬度方向的距离计算起来更简单，先检查纬度
+	latDistance := GetLatDistance(y2, y1)
+	if latDistance > heightM/2 {
+		return false
+	}
+	lonDistance := GetDistance(x2, y1, x1, y1)
+	if lonDistance > widthM/2 {
+		return false
+	}
+	*distance = GetDistance(x1, y1, x2, y2)
+	return true
+}
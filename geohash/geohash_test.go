@@ -0,0 +1,81 @@
+package geohash
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	points := [][2]float64{
+		{13.361389, 38.115556},
+		{15.087269, 37.502669},
+		{-122.4194, 37.7749},
+		{0, 0},
+		{179.9999, -85.05},
+	}
+	for _, p := range points {
+		var hash Bits
+		if !EncodeWGS84(p[0], p[1], StepMax, &hash) {
+			t.Fatalf("encode %v failed", p)
+		}
+		bits := Align52Bits(hash)
+		var xy [2]float64
+		if !DecodeToLongLatWGS84(Bits{Bits: bits, Step: StepMax}, &xy) {
+			t.Fatalf("decode %v failed", p)
+		}
+		if math.Abs(xy[0]-p[0]) > 1e-5 || math.Abs(xy[1]-p[1]) > 1e-5 {
+			t.Fatalf("expect %v, got %v", p, xy)
+		}
+	}
+
+	var hash Bits
+	if EncodeWGS84(0, 86, StepMax, &hash) || EncodeWGS84(181, 0, StepMax, &hash) {
+		t.Fatal("encode out of range should fail")
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	var hash Bits
+	EncodeWGS84(13.361389, 38.115556, 10, &hash)
+	var center Area
+	DecodeWGS84(hash, &center)
+
+	var n Neighbors
+	GetNeighbors(&hash, &n)
+	var north, east, southWest Area
+	DecodeWGS84(n.North, &north)
+	DecodeWGS84(n.East, &east)
+	DecodeWGS84(n.SouthWest, &southWest)
+
+	if north.Latitude.Min != center.Latitude.Max || north.Longitude != center.Longitude {
+		t.Fatalf("north %+v is not adjacent to %+v", north, center)
+	}
+	if east.Longitude.Min != center.Longitude.Max || east.Latitude != center.Latitude {
+		t.Fatalf("east %+v is not adjacent to %+v", east, center)
+	}
+	if southWest.Latitude.Max != center.Latitude.Min || southWest.Longitude.Max != center.Longitude.Min {
+		t.Fatalf("south west %+v is not adjacent to %+v", southWest, center)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// Palermo到Catania
+	d := GetDistance(13.361389, 38.115556, 15.087269, 37.502669)
+	if math.Abs(d-166274.15) > 1 {
+		t.Fatalf("unexpected distance %f", d)
+	}
+
+	var dist float64
+	if !GetDistanceIfInRadiusWGS84(13.361389, 38.115556, 15.087269, 37.502669, 200000, &dist) {
+		t.Fatal("expect in radius")
+	}
+	if GetDistanceIfInRadiusWGS84(13.361389, 38.115556, 15.087269, 37.502669, 100000, &dist) {
+		t.Fatal("expect out of radius")
+	}
+	if !GetDistanceIfInRectangle(400000, 400000, 13.361389, 38.115556, 15.087269, 37.502669, &dist) {
+		t.Fatal("expect in rectangle")
+	}
+	if GetDistanceIfInRectangle(400000, 100000, 13.361389, 38.115556, 15.087269, 37.502669, &dist) {
+		t.Fatal("expect out of rectangle")
+	}
+}
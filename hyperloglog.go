@@ -0,0 +1,935 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+)
+
+/* HyperLogLog以字符串对象保存，格式与Redis完全一致：
+ *
+ * +------+---+-----+----------+
+ * | HYLL | E | N/U | Cardin.  |
+ * +------+---+-----+----------+
+ *
+ * 前4个字节是魔数"HYLL"，E是编码(dense或者sparse)，N/U是3个未使用的字节，
+ * Cardin.是8个字节的小端序基数缓存，最高位为1表示缓存失效。
+ *
+ * dense编码一共16384个6bit的寄存器，低位的寄存器放在字节的低位。
+ *
+ * sparse编码用三种操作码表示寄存器：
+ * ZERO:  00xxxxxx，xxxxxx+1个值为0的寄存器(1~64)
+ * XZERO: 01xxxxxx yyyyyyyy，14bit表示的长度+1个值为0的寄存器(1~16384)
+ * VAL:   1vvvvvxx，xx+1个值为vvvvv+1的寄存器，值为1~32，长度为1~4
+ * 寄存器的值大于32或者sparse编码超过server.hllSparseMaxBytes时转换为dense编码 */
+
+const (
+	hllP            = 14                 // 用来选择寄存器的hash位数
+	hllQ            = 64 - hllP          // 用来计算连续0的hash位数
+	hllRegisters    = 1 << hllP          // 寄存器的数量，16384
+	hllPMask        = hllRegisters - 1   // 选择寄存器的掩码
+	hllBits         = 6                  // 每个寄存器的位数
+	hllRegisterMax  = (1 << hllBits) - 1 // 寄存器的最大值
+	hllHdrSize      = 16                 // 头部的长度
+	hllDenseSize    = hllHdrSize + (hllRegisters*hllBits+7)/8
+	hllDense        = 0   // dense编码
+	hllSparse       = 1   // sparse编码
+	hllRaw          = 255 // 内部使用的编码，每个寄存器一个字节
+	hllMaxEncoding  = 1
+	hllAlphaInf     = 0.721347520444481703680 // 常量 0.5/ln(2)
+	hllCardOffset   = 8                       // 基数缓存在头部中的偏移量
+	hllEncodingByte = 4                       // 编码在头部中的偏移量
+)
+
+const (
+	hllSparseValMaxValue = 32
+	hllSparseValMaxLen   = 4
+	hllSparseZeroMaxLen  = 64
+	hllSparseXZeroMaxLen = 16384
+)
+
+const invalidHllErr = "-INVALIDOBJ Corrupted HLL object detected"
+
+/* ========================== sparse操作码 ========================== */
+
+func hllSparseIsZero(b byte) bool {
+	return b&0xc0 == 0
+}
+
+func hllSparseIsXZero(b byte) bool {
+	return b&0xc0 == 0x40
+}
+
+func hllSparseIsVal(b byte) bool {
+	return b&0x80 != 0
+}
+
+func hllSparseZeroLen(b byte) int {
+	return int(b&0x3f) + 1
+}
+
+func hllSparseXZeroLen(b0, b1 byte) int {
+	return (int(b0&0x3f)<<8 | int(b1)) + 1
+}
+
+func hllSparseValValue(b byte) int {
+	return int((b>>2)&0x1f) + 1
+}
+
+func hllSparseValLen(b byte) int {
+	return int(b&0x3) + 1
+}
+
+func hllSparseValSet(p []byte, val, length int) {
+	p[0] = byte((val-1)<<2|(length-1)) | 0x80
+}
+
+func hllSparseZeroSet(p []byte, length int) {
+	p[0] = byte(length - 1)
+}
+
+func hllSparseXZeroSet(p []byte, length int) {
+	l := length - 1
+	p[0] = byte(l>>8) | 0x40
+	p[1] = byte(l & 0xff)
+}
+
+/* ========================== 头部 ========================== */
+
+// hllObjectBuffer 返回HLL对象的所有字节，包括头部
+func hllObjectBuffer(o *robj) []byte {
+	return (*sds.SDS)(o.ptr).BufData(0)
+}
+
+// hllSetObjectBuffer 长度发生变化之后，用buf替换HLL对象的内容
+func hllSetObjectBuffer(o *robj, buf []byte) {
+	s := sds.NewLen(buf)
+	o.ptr = unsafe.Pointer(&s)
+}
+
+func hllInvalidateCache(hdr []byte) {
+	hdr[hllCardOffset+7] |= 1 << 7
+}
+
+func hllValidCache(hdr []byte) bool {
+	return hdr[hllCardOffset+7]&(1<<7) == 0
+}
+
+/* ========================== dense寄存器 ========================== */
+
+// hllDenseGetRegister 读取第regnum个寄存器的值
+func hllDenseGetRegister(registers []byte, regnum int) uint8 {
+	bytepos := regnum * hllBits / 8
+	fb := uint(regnum * hllBits & 7)
+	fb8 := 8 - fb
+	b0 := uint(registers[bytepos])
+	var b1 uint
+	// 最后一个寄存器不会跨越字节
+	if bytepos+1 < len(registers) {
+		b1 = uint(registers[bytepos+1])
+	}
+	return uint8(((b0 >> fb) | (b1 << fb8)) & hllRegisterMax)
+}
+
+// hllDenseSetRegister 设置第regnum个寄存器的值
+func hllDenseSetRegister(registers []byte, regnum int, val uint8) {
+	bytepos := regnum * hllBits / 8
+	fb := uint(regnum * hllBits & 7)
+	fb8 := 8 - fb
+	v := uint(val)
+	registers[bytepos] &= ^byte(hllRegisterMax << fb)
+	registers[bytepos] |= byte(v << fb)
+	if bytepos+1 < len(registers) {
+		registers[bytepos+1] &= ^byte(hllRegisterMax >> fb8)
+		registers[bytepos+1] |= byte(v >> fb8)
+	}
+}
+
+/* ========================== 低层的HLL实现 ========================== */
+
+// murmurHash64A 64位的MurmurHash2，与字节序无关
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ (uint64(len(key)) * m)
+
+	data := key
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+
+	switch len(data) {
+	case 7:
+		h ^= uint64(data[6]) << 48
+		fallthrough
+	case 6:
+		h ^= uint64(data[5]) << 40
+		fallthrough
+	case 5:
+		h ^= uint64(data[4]) << 32
+		fallthrough
+	case 4:
+		h ^= uint64(data[3]) << 24
+		fallthrough
+	case 3:
+		h ^= uint64(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint64(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint64(data[0])
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// hllPatLen 计算ele的hash，返回寄存器的下标和"000..1"的长度
+func hllPatLen(ele []byte) (index int, count uint8) {
+	hash := murmurHash64A(ele, 0xadc83b19)
+	index = int(hash & hllPMask)
+	hash >>= hllP
+	// 保证循环可以结束，并且count <= hllQ+1
+	hash |= uint64(1) << hllQ
+	count = uint8(bits.TrailingZeros64(hash) + 1)
+	return
+}
+
+// hllDenseSet 寄存器的值小于count时更新，更新了返回1，否则返回0
+func hllDenseSet(registers []byte, index int, count uint8) int {
+	oldcount := hllDenseGetRegister(registers, index)
+	if count > oldcount {
+		hllDenseSetRegister(registers, index, count)
+		return 1
+	}
+	return 0
+}
+
+// hllDenseAdd 往dense编码的HLL中添加元素，寄存器发生变化返回1，否则返回0
+func hllDenseAdd(registers []byte, ele []byte) int {
+	index, count := hllPatLen(ele)
+	return hllDenseSet(registers, index, count)
+}
+
+// hllDenseRegHisto 统计dense编码中每个寄存器值出现的次数
+func hllDenseRegHisto(registers []byte, reghisto *[64]int) {
+	for j := 0; j < hllRegisters; j++ {
+		reghisto[hllDenseGetRegister(registers, j)]++
+	}
+}
+
+// hllSparseToDense 把sparse编码转换为dense编码，sparse编码损坏时返回C_ERR
+func hllSparseToDense(o *robj) error {
+	sparse := hllObjectBuffer(o)
+
+	if sparse[hllEncodingByte] == hllDense {
+		return C_OK
+	}
+
+	// 复制魔数和基数缓存
+	dense := make([]byte, hllDenseSize)
+	copy(dense, sparse[:hllHdrSize])
+	dense[hllEncodingByte] = hllDense
+	registers := dense[hllHdrSize:]
+
+	idx := 0
+	for p := hllHdrSize; p < len(sparse); {
+		if hllSparseIsZero(sparse[p]) {
+			idx += hllSparseZeroLen(sparse[p])
+			p++
+		} else if hllSparseIsXZero(sparse[p]) {
+			if p+1 >= len(sparse) {
+				break
+			}
+			idx += hllSparseXZeroLen(sparse[p], sparse[p+1])
+			p += 2
+		} else {
+			runlen := hllSparseValLen(sparse[p])
+			regval := hllSparseValValue(sparse[p])
+			if runlen+idx > hllRegisters {
+				break // 溢出
+			}
+			for ; runlen > 0; runlen-- {
+				hllDenseSetRegister(registers, idx, uint8(regval))
+				idx++
+			}
+			p++
+		}
+	}
+
+	// sparse编码正确的话应该刚好覆盖所有的寄存器
+	if idx != hllRegisters {
+		return C_ERR
+	}
+
+	hllSetObjectBuffer(o, dense)
+	return C_OK
+}
+
+// hllSparseSet 寄存器的值小于count时更新sparse编码，必要时转换为dense编码。
+// 更新了返回1，不需要更新返回0，sparse编码损坏返回-1
+func hllSparseSet(o *robj, index int, count uint8) int {
+	// sparse编码不能表示大于32的值
+	if count > hllSparseValMaxValue {
+		return hllSparsePromote(o, index, count)
+	}
+
+	s := hllObjectBuffer(o)
+	resized := false
+
+	// 第一步：找到覆盖index的操作码
+	first, span := 0, 0
+	p, prev := hllHdrSize, -1
+	for p < len(s) {
+		oplen := 1
+		if hllSparseIsZero(s[p]) {
+			span = hllSparseZeroLen(s[p])
+		} else if hllSparseIsVal(s[p]) {
+			span = hllSparseValLen(s[p])
+		} else {
+			if p+1 >= len(s) {
+				return -1
+			}
+			span = hllSparseXZeroLen(s[p], s[p+1])
+			oplen = 2
+		}
+		if index <= first+span-1 {
+			break
+		}
+		prev = p
+		p += oplen
+		first += span
+	}
+	if span == 0 || p >= len(s) {
+		return -1 // 格式错误
+	}
+
+	var isZero, isXZero, isVal bool
+	var runlen int
+	if hllSparseIsZero(s[p]) {
+		isZero = true
+		runlen = hllSparseZeroLen(s[p])
+	} else if hllSparseIsXZero(s[p]) {
+		isXZero = true
+		runlen = hllSparseXZeroLen(s[p], s[p+1])
+	} else {
+		isVal = true
+		runlen = hllSparseValLen(s[p])
+	}
+
+	// 第二步：此时first是p覆盖的第一个寄存器，span是p覆盖的寄存器数量。
+	// A) VAL的值已经>=count，不需要更新
+	// B) VAL只覆盖了这一个寄存器，直接修改
+	// C) ZERO只覆盖了这一个寄存器，直接替换成VAL
+	// D) 其他情况需要把操作码拆分成多个，最多是XZERO-VAL-XZERO 5个字节
+	updated := false
+	if isVal {
+		oldcount := hllSparseValValue(s[p])
+		if oldcount >= int(count) {
+			return 0
+		}
+		if runlen == 1 {
+			hllSparseValSet(s[p:], int(count), 1)
+			updated = true
+		}
+	}
+	if !updated && isZero && runlen == 1 {
+		hllSparseValSet(s[p:], int(count), 1)
+		updated = true
+	}
+
+	if !updated {
+		var seq [5]byte
+		n := 0
+		last := first + span - 1 // p覆盖的最后一个寄存器
+
+		if isZero || isXZero {
+			if index != first {
+				length := index - first
+				if length > hllSparseZeroMaxLen {
+					hllSparseXZeroSet(seq[n:], length)
+					n += 2
+				} else {
+					hllSparseZeroSet(seq[n:], length)
+					n++
+				}
+			}
+			hllSparseValSet(seq[n:], int(count), 1)
+			n++
+			if index != last {
+				length := last - index
+				if length > hllSparseZeroMaxLen {
+					hllSparseXZeroSet(seq[n:], length)
+					n += 2
+				} else {
+					hllSparseZeroSet(seq[n:], length)
+					n++
+				}
+			}
+		} else {
+			curval := hllSparseValValue(s[p])
+			if index != first {
+				hllSparseValSet(seq[n:], curval, index-first)
+				n++
+			}
+			hllSparseValSet(seq[n:], int(count), 1)
+			n++
+			if index != last {
+				hllSparseValSet(seq[n:], curval, last-index)
+				n++
+			}
+		}
+
+		// 第三步：用新的操作码序列替换原来的操作码
+		oldlen := 1
+		if isXZero {
+			oldlen = 2
+		}
+		deltalen := n - oldlen
+		if deltalen > 0 && len(s)+deltalen > server.hllSparseMaxBytes {
+			return hllSparsePromote(o, index, count)
+		}
+		if deltalen != 0 {
+			buf := make([]byte, 0, len(s)+deltalen)
+			buf = append(buf, s[:p]...)
+			buf = append(buf, seq[:n]...)
+			buf = append(buf, s[p+oldlen:]...)
+			s = buf
+			resized = true
+		} else {
+			copy(s[p:], seq[:n])
+		}
+	}
+
+	// 第四步：合并相邻的值相同的VAL，从prev开始最多扫描5个操作码
+	p = prev
+	if p < 0 {
+		p = hllHdrSize
+	}
+	for scanlen := 5; p < len(s) && scanlen > 0; scanlen-- {
+		if hllSparseIsXZero(s[p]) {
+			p += 2
+			continue
+		} else if hllSparseIsZero(s[p]) {
+			p++
+			continue
+		}
+		if p+1 < len(s) && hllSparseIsVal(s[p+1]) {
+			v1 := hllSparseValValue(s[p])
+			v2 := hllSparseValValue(s[p+1])
+			if v1 == v2 {
+				length := hllSparseValLen(s[p]) + hllSparseValLen(s[p+1])
+				if length <= hllSparseValMaxLen {
+					hllSparseValSet(s[p+1:], v1, length)
+					copy(s[p:], s[p+1:])
+					s = s[:len(s)-1]
+					resized = true
+					// 合并之后不移动p，继续尝试和右边的值合并
+					continue
+				}
+			}
+		}
+		p++
+	}
+
+	if resized {
+		hllSetObjectBuffer(o, s)
+		s = hllObjectBuffer(o)
+	}
+	hllInvalidateCache(s)
+	return 1
+}
+
+// hllSparsePromote 转换为dense编码之后再设置寄存器，需要转换说明寄存器一定会被更新
+func hllSparsePromote(o *robj, index int, count uint8) int {
+	if hllSparseToDense(o) != C_OK {
+		return -1 // HLL损坏
+	}
+	denseRetval := hllDenseSet(hllObjectBuffer(o)[hllHdrSize:], index, count)
+	if denseRetval != 1 {
+		panic("hllSparsePromote: register not updated after promotion")
+	}
+	return denseRetval
+}
+
+// hllSparseAdd 往sparse编码的HLL中添加元素
+func hllSparseAdd(o *robj, ele []byte) int {
+	index, count := hllPatLen(ele)
+	return hllSparseSet(o, index, count)
+}
+
+// hllSparseRegHisto 统计sparse编码中每个寄存器值出现的次数，格式错误时invalid为true
+func hllSparseRegHisto(sparse []byte, invalid *bool, reghisto *[64]int) {
+	idx := 0
+	for p := 0; p < len(sparse); {
+		if hllSparseIsZero(sparse[p]) {
+			runlen := hllSparseZeroLen(sparse[p])
+			idx += runlen
+			reghisto[0] += runlen
+			p++
+		} else if hllSparseIsXZero(sparse[p]) {
+			if p+1 >= len(sparse) {
+				break
+			}
+			runlen := hllSparseXZeroLen(sparse[p], sparse[p+1])
+			idx += runlen
+			reghisto[0] += runlen
+			p += 2
+		} else {
+			runlen := hllSparseValLen(sparse[p])
+			regval := hllSparseValValue(sparse[p])
+			idx += runlen
+			reghisto[regval] += runlen
+			p++
+		}
+	}
+	if idx != hllRegisters && invalid != nil {
+		*invalid = true
+	}
+}
+
+// hllRawRegHisto 统计raw编码中每个寄存器值出现的次数
+func hllRawRegHisto(registers []byte, reghisto *[64]int) {
+	for j := 0; j < hllRegisters; j++ {
+		reghisto[registers[j]&hllRegisterMax]++
+	}
+}
+
+// hllSigma 见 "New cardinality estimation algorithms for HyperLogLog sketches"
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	var zPrime float64
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime = z
+		z += x * y
+		y += y
+		if zPrime == z {
+			break
+		}
+	}
+	return z
+}
+
+// hllTau 见 "New cardinality estimation algorithms for HyperLogLog sketches"
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	var zPrime float64
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime = z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			break
+		}
+	}
+	return z / 3
+}
+
+// hllCount 估算HLL的基数，hdr包括头部。sparse编码损坏时invalid为true
+func hllCount(hdr []byte, invalid *bool) uint64 {
+	m := float64(hllRegisters)
+	var reghisto [64]int
+
+	registers := hdr[hllHdrSize:]
+	switch hdr[hllEncodingByte] {
+	case hllDense:
+		hllDenseRegHisto(registers, &reghisto)
+	case hllSparse:
+		hllSparseRegHisto(registers, invalid, &reghisto)
+	case hllRaw:
+		hllRawRegHisto(registers, &reghisto)
+	default:
+		panic("Unknown HyperLogLog encoding in hllCount()")
+	}
+
+	// 根据寄存器的直方图估算基数，见Otmar Ertl的论文arXiv:1702.01284
+	z := m * hllTau((m-float64(reghisto[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(reghisto[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(reghisto[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
+
+// hllAdd 往HLL中添加元素，寄存器发生变化返回1，否则返回0，HLL损坏返回-1
+func hllAdd(o *robj, ele []byte) int {
+	hdr := hllObjectBuffer(o)
+	switch hdr[hllEncodingByte] {
+	case hllDense:
+		return hllDenseAdd(hdr[hllHdrSize:], ele)
+	case hllSparse:
+		return hllSparseAdd(o, ele)
+	default:
+		return -1
+	}
+}
+
+// hllMerge 把hll合并到max中，max[i] = MAX(max[i], hll[i])，hll损坏时返回C_ERR
+func hllMerge(max []byte, hll *robj) error {
+	hdr := hllObjectBuffer(hll)
+
+	if hdr[hllEncodingByte] == hllDense {
+		registers := hdr[hllHdrSize:]
+		for i := 0; i < hllRegisters; i++ {
+			if val := hllDenseGetRegister(registers, i); val > max[i] {
+				max[i] = val
+			}
+		}
+		return C_OK
+	}
+
+	i := 0
+	for p := hllHdrSize; p < len(hdr); {
+		if hllSparseIsZero(hdr[p]) {
+			i += hllSparseZeroLen(hdr[p])
+			p++
+		} else if hllSparseIsXZero(hdr[p]) {
+			if p+1 >= len(hdr) {
+				break
+			}
+			i += hllSparseXZeroLen(hdr[p], hdr[p+1])
+			p += 2
+		} else {
+			runlen := hllSparseValLen(hdr[p])
+			regval := uint8(hllSparseValValue(hdr[p]))
+			if runlen+i > hllRegisters {
+				break // 溢出
+			}
+			for ; runlen > 0; runlen-- {
+				if regval > max[i] {
+					max[i] = regval
+				}
+				i++
+			}
+			p++
+		}
+	}
+	if i != hllRegisters {
+		return C_ERR
+	}
+	return C_OK
+}
+
+/* ========================== HLL类型的命令 ========================== */
+
+// createHLLObject 创建一个空的sparse编码的HLL
+func createHLLObject() *robj {
+	sparselen := hllHdrSize + ((hllRegisters+(hllSparseXZeroMaxLen-1))/hllSparseXZeroMaxLen)*2
+	buf := make([]byte, sparselen)
+
+	// 用XZERO表示所有的寄存器
+	p := hllHdrSize
+	for aux := hllRegisters; aux > 0; {
+		xzero := hllSparseXZeroMaxLen
+		if xzero > aux {
+			xzero = aux
+		}
+		hllSparseXZeroSet(buf[p:], xzero)
+		p += 2
+		aux -= xzero
+	}
+
+	copy(buf, "HYLL")
+	buf[hllEncodingByte] = hllSparse
+	return createObject(ObjString, sds.NewLen(buf))
+}
+
+// isHLLObjectOrReply 检查o是否是合法的HLL，不是的话回复错误并返回C_ERR
+func isHLLObjectOrReply(c *Client, o *robj) error {
+	if o.checkType(c, ObjString) {
+		return C_ERR
+	}
+
+	if !o.sdsEncodedObject() || o.stringObjectLen() < hllHdrSize {
+		goto invalid
+	}
+
+	{
+		hdr := hllObjectBuffer(o)
+		if string(hdr[:4]) != "HYLL" || hdr[hllEncodingByte] > hllMaxEncoding {
+			goto invalid
+		}
+
+		// dense编码的长度是固定的
+		if hdr[hllEncodingByte] == hllDense && len(hdr) != hllDenseSize {
+			goto invalid
+		}
+	}
+	return C_OK
+
+invalid:
+	addReplyError(c, "-WRONGTYPE Key is not a valid HyperLogLog string value.")
+	return C_ERR
+}
+
+// PFADD var ele ele ele ... ele
+func pfaddCommand(c *Client) {
+	updated := 0
+
+	o := c.db.lookupKeyWrite(c.argv[1])
+	if o == nil {
+		o = createHLLObject()
+		c.db.dbAdd(c.argv[1], o)
+		updated++
+	} else {
+		if isHLLObjectOrReply(c, o) != C_OK {
+			return
+		}
+		o = c.db.dbUnshareStringValue(c.argv[1], o)
+	}
+
+	for j := 2; j < c.argc; j++ {
+		switch hllAdd(o, (*sds.SDS)(c.argv[j].ptr).BufData(0)) {
+		case 1:
+			updated++
+		case -1:
+			addReplyError(c, invalidHllErr)
+			return
+		}
+	}
+
+	if updated > 0 {
+		signalModifiedKey(c, c.db, c.argv[1])
+		notifyKeySpaceEvent(notifyString, "pfadd", c.argv[1], c.db.id)
+		server.dirty += updated
+		hllInvalidateCache(hllObjectBuffer(o))
+		addReply(c, shared.cone)
+	} else {
+		addReply(c, shared.czero)
+	}
+}
+
+// PFCOUNT var -> approximated cardinality of set.
+func pfcountCommand(c *Client) {
+	// 多个key时返回它们并集的基数
+	if c.argc > 2 {
+		max := make([]byte, hllHdrSize+hllRegisters)
+		max[hllEncodingByte] = hllRaw // 内部使用的编码
+		registers := max[hllHdrSize:]
+		for j := 1; j < c.argc; j++ {
+			o := c.db.lookupKeyRead(c.argv[j])
+			if o == nil {
+				continue // 不存在的key当作空的HLL
+			}
+			if isHLLObjectOrReply(c, o) != C_OK {
+				return
+			}
+			if hllMerge(registers, o) != C_OK {
+				addReplyError(c, invalidHllErr)
+				return
+			}
+		}
+		addReplyLongLong(c, int(hllCount(max, nil)))
+		return
+	}
+
+	// 只有一个key时，优先使用缓存的基数
+	o := c.db.lookupKeyRead(c.argv[1])
+	if o == nil {
+		addReply(c, shared.czero)
+		return
+	}
+	if isHLLObjectOrReply(c, o) != C_OK {
+		return
+	}
+	o = c.db.dbUnshareStringValue(c.argv[1], o)
+
+	var card uint64
+	hdr := hllObjectBuffer(o)
+	if hllValidCache(hdr) {
+		card = binary.LittleEndian.Uint64(hdr[hllCardOffset:])
+	} else {
+		invalid := false
+		card = hllCount(hdr, &invalid)
+		if invalid {
+			addReplyError(c, invalidHllErr)
+			return
+		}
+		binary.LittleEndian.PutUint64(hdr[hllCardOffset:], card)
+
+		// 虽然是只读命令，但是修改了缓存，需要传播
+		signalModifiedKey(c, c.db, c.argv[1])
+		server.dirty++
+	}
+	addReplyLongLong(c, int(card))
+}
+
+// PFMERGE dest src1 src2 src3 ... srcN => OK
+func pfmergeCommand(c *Client) {
+	max := make([]byte, hllRegisters)
+	useDense := false // 有一个输入是dense编码时目标直接使用dense编码
+
+	for j := 1; j < c.argc; j++ {
+		o := c.db.lookupKeyRead(c.argv[j])
+		if o == nil {
+			continue
+		}
+		if isHLLObjectOrReply(c, o) != C_OK {
+			return
+		}
+		if hllObjectBuffer(o)[hllEncodingByte] == hllDense {
+			useDense = true
+		}
+		if hllMerge(max, o) != C_OK {
+			addReplyError(c, invalidHllErr)
+			return
+		}
+	}
+
+	o := c.db.lookupKeyWrite(c.argv[1])
+	if o == nil {
+		o = createHLLObject()
+		c.db.dbAdd(c.argv[1], o)
+	} else {
+		// 上面已经检查过类型了
+		o = c.db.dbUnshareStringValue(c.argv[1], o)
+	}
+
+	if useDense && hllSparseToDense(o) != C_OK {
+		addReplyError(c, invalidHllErr)
+		return
+	}
+
+	// 把max写到目标HLL，hllSparseSet可能会修改o.ptr
+	for j := 0; j < hllRegisters; j++ {
+		if max[j] == 0 {
+			continue
+		}
+		hdr := hllObjectBuffer(o)
+		switch hdr[hllEncodingByte] {
+		case hllDense:
+			hllDenseSet(hdr[hllHdrSize:], j, max[j])
+		case hllSparse:
+			hllSparseSet(o, j, max[j])
+		}
+	}
+	hllInvalidateCache(hllObjectBuffer(o))
+
+	signalModifiedKey(c, c.db, c.argv[1])
+	// PFMERGE相当于批量的PFADD，所以产生pfadd事件
+	notifyKeySpaceEvent(notifyString, "pfadd", c.argv[1], c.db.id)
+	server.dirty++
+	addReply(c, shared.ok)
+}
+
+// PFDEBUG <subcommand> <key> ... args ...
+func pfdebugCommand(c *Client) {
+	cmd := (*sds.SDS)(c.argv[1].ptr).BufData(0)
+
+	o := c.db.lookupKeyWrite(c.argv[2])
+	if o == nil {
+		addReplyError(c, "The specified key does not exist")
+		return
+	}
+	if isHLLObjectOrReply(c, o) != C_OK {
+		return
+	}
+	o = c.db.dbUnshareStringValue(c.argv[2], o)
+	hdr := hllObjectBuffer(o)
+
+	if util.StrCaseCmp(cmd, "getreg") {
+		// PFDEBUG GETREG <key>
+		if c.argc != 3 {
+			goto arityerr
+		}
+		if hdr[hllEncodingByte] == hllSparse {
+			if hllSparseToDense(o) != C_OK {
+				addReplyError(c, invalidHllErr)
+				return
+			}
+			server.dirty++ // 编码发生了变化，需要传播
+		}
+
+		registers := hllObjectBuffer(o)[hllHdrSize:]
+		addReplyArrayLen(c, hllRegisters)
+		for j := 0; j < hllRegisters; j++ {
+			addReplyLongLong(c, int(hllDenseGetRegister(registers, j)))
+		}
+	} else if util.StrCaseCmp(cmd, "decode") {
+		// PFDEBUG DECODE <key>
+		if c.argc != 3 {
+			goto arityerr
+		}
+		if hdr[hllEncodingByte] != hllSparse {
+			addReplyError(c, "HLL encoding is not sparse")
+			return
+		}
+
+		var decoded strings.Builder
+		for p := hllHdrSize; p < len(hdr); {
+			if hllSparseIsZero(hdr[p]) {
+				decoded.WriteString("z:" + strconv.Itoa(hllSparseZeroLen(hdr[p])) + " ")
+				p++
+			} else if hllSparseIsXZero(hdr[p]) {
+				if p+1 >= len(hdr) {
+					break
+				}
+				decoded.WriteString("Z:" + strconv.Itoa(hllSparseXZeroLen(hdr[p], hdr[p+1])) + " ")
+				p += 2
+			} else {
+				decoded.WriteString("v:" + strconv.Itoa(hllSparseValValue(hdr[p])) + "," + strconv.Itoa(hllSparseValLen(hdr[p])) + " ")
+				p++
+			}
+		}
+		addReplyBulkCString(c, strings.TrimSpace(decoded.String()))
+	} else if util.StrCaseCmp(cmd, "encoding") {
+		// PFDEBUG ENCODING <key>
+		if c.argc != 3 {
+			goto arityerr
+		}
+		encodingStr := [2]string{"dense", "sparse"}
+		addReplyStatus(c, encodingStr[hdr[hllEncodingByte]])
+	} else if util.StrCaseCmp(cmd, "todense") {
+		// PFDEBUG TODENSE <key>
+		if c.argc != 3 {
+			goto arityerr
+		}
+		conv := false
+		if hdr[hllEncodingByte] == hllSparse {
+			if hllSparseToDense(o) != C_OK {
+				addReplyError(c, invalidHllErr)
+				return
+			}
+			conv = true
+			server.dirty++ // 编码发生了变化，需要传播
+		}
+		if conv {
+			addReply(c, shared.cone)
+		} else {
+			addReply(c, shared.czero)
+		}
+	} else {
+		addReplyErrorFormat(c, "Unknown PFDEBUG subcommand '%s'", cmd)
+	}
+	return
+
+arityerr:
+	addReplyErrorFormat(c, "Wrong number of arguments for the '%s' subcommand", cmd)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestHllDenseRegisters(t *testing.T) {
+	registers := make([]byte, hllDenseSize-hllHdrSize)
+	expected := make([]uint8, hllRegisters)
+	for i := 0; i < 10; i++ {
+		for j := 0; j < hllRegisters; j++ {
+			v := uint8(rand.Intn(hllRegisterMax + 1))
+			expected[j] = v
+			hllDenseSetRegister(registers, j, v)
+		}
+		for j := 0; j < hllRegisters; j++ {
+			if v := hllDenseGetRegister(registers, j); v != expected[j] {
+				t.Fatalf("register %d: expect %d, got %d", j, expected[j], v)
+			}
+		}
+	}
+}
+
+func TestHllSparseDense(t *testing.T) {
+	server = &RedisServer{hz: 1, hllSparseMaxBytes: 3000}
+	sparse := createHLLObject()
+	dense := createHLLObject()
+	if hllSparseToDense(dense) != C_OK {
+		t.Fatal("convert empty hll to dense failed")
+	}
+
+	for i := 0; i < 5000; i++ {
+		ele := []byte(fmt.Sprintf("ele:%d", i))
+		if hllAdd(sparse, ele) < 0 || hllAdd(dense, ele) < 0 {
+			t.Fatalf("add %s failed", ele)
+		}
+
+		if i%100 == 0 {
+			// 两种编码的寄存器必须完全相同
+			max1 := make([]byte, hllRegisters)
+			max2 := make([]byte, hllRegisters)
+			if hllMerge(max1, sparse) != C_OK || hllMerge(max2, dense) != C_OK {
+				t.Fatal("merge failed")
+			}
+			if string(max1) != string(max2) {
+				t.Fatalf("sparse and dense registers differ after %d elements", i+1)
+			}
+		}
+	}
+
+	if hllObjectBuffer(sparse)[hllEncodingByte] != hllDense {
+		t.Fatal("sparse hll should be promoted to dense")
+	}
+	card := hllCount(hllObjectBuffer(dense), nil)
+	if card < 4750 || card > 5250 {
+		t.Fatalf("cardinality of 5000 elements out of range: %d", card)
+	}
+}
+
+func TestHllCommands(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		// 创建空的HLL也算改变
+		{"pfadd empty", ":1"},
+		{"pfadd empty", ":0"},
+		{"pfcount empty", ":0"},
+
+		{"pfadd h1 a b c", ":1"},
+		{"pfadd h1 a b", ":0"},
+		{"pfadd h1 d", ":1"},
+		{"pfcount h1", ":4"},
+		{"pfadd h2 c d e f", ":1"},
+		{"pfcount h2", ":4"},
+		{"pfcount h1 h2", ":6"},
+		{"pfcount h1 h2 nokey", ":6"},
+		{"pfcount nokey", ":0"},
+
+		// 合并到不存在的key
+		{"pfmerge dst h1 h2", "+OK"},
+		{"pfcount dst", ":6"},
+		// 合并到已经存在的key，原有的元素保留
+		{"pfadd h3 x y", ":1"},
+		{"pfmerge h3 h1", "+OK"},
+		{"pfcount h3", ":6"},
+		{"pfcount h1", ":4"},
+		{"pfmerge dst2", "+OK"},
+		{"pfcount dst2", ":0"},
+		{"pfmerge dst3 nokey", "+OK"},
+		{"exists dst3", ":1"},
+
+		{"set str hello", "+OK"},
+		{"pfadd str a", "-WRONGTYPE Key is not a valid HyperLogLog string value."},
+		{"pfcount str", "-WRONGTYPE Key is not a valid HyperLogLog string value."},
+		{"pfcount h1 str", "-WRONGTYPE Key is not a valid HyperLogLog string value."},
+		{"pfmerge h1 str", "-WRONGTYPE Key is not a valid HyperLogLog string value."},
+		{"pfmerge str h1", "-WRONGTYPE Key is not a valid HyperLogLog string value."},
+		{"pfcount h1", ":4"},
+		{"lpush list a", ":1"},
+		{"pfadd list a", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"pfcount list", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+
+		{"pfdebug encoding nokey", "-ERR The specified key does not exist"},
+		{"pfdebug encoding str", "-WRONGTYPE Key is not a valid HyperLogLog string value."},
+		{"pfdebug unknown h1", "-ERR Unknown PFDEBUG subcommand 'unknown'"},
+	})
+
+	// 头部正确、缓存的基数无效，但是sparse数据损坏的HLL
+	if reply := testCommand(c, "set", "bad", "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\xff"); reply != "+OK" {
+		t.Fatalf("set bad: %q", reply)
+	}
+	testRun(t, c, []testCase{
+		{"pfcount bad", "-INVALIDOBJ Corrupted HLL object detected"},
+		{"pfadd bad a", "-INVALIDOBJ Corrupted HLL object detected"},
+		{"pfmerge dst bad", "-INVALIDOBJ Corrupted HLL object detected"},
+	})
+}
+
+func TestHllSparsePromotion(t *testing.T) {
+	testServerInit()
+	server.hllSparseMaxBytes = 30
+	c := testClient()
+
+	testRun(t, c, []testCase{
+		{"pfadd h a b c", ":1"},
+		{"pfdebug encoding h", "+sparse"},
+	})
+	// 超过hllSparseMaxBytes之后转换成dense
+	for i := 0; i < 100 && testCommand(c, "pfdebug", "encoding", "h") == "+sparse"; i++ {
+		testCommand(c, "pfadd", "h", fmt.Sprintf("ele:%d", i))
+	}
+	testRun(t, c, []testCase{
+		{"pfdebug encoding h", "+dense"},
+		{"pfadd h a", ":0"},
+		{"pfdebug todense h", ":0"},
+		{"pfadd h2 a b c", ":1"},
+		{"pfdebug todense h2", ":1"},
+		{"pfdebug encoding h2", "+dense"},
+		{"pfcount h2", ":3"},
+		{"strlen h2", fmt.Sprintf(":%d", hllDenseSize)},
+		// sparse和dense合并，结果总是dense
+		{"pfadd h3 a d", ":1"},
+		{"pfmerge h3 h2", "+OK"},
+		{"pfdebug encoding h3", "+dense"},
+		{"pfcount h3", ":4"},
+	})
+}
@@ -2,6 +2,7 @@ package intset
 
 import (
 	"math"
+	"math/rand"
 	"unsafe"
 )
 
@@ -186,6 +187,11 @@ func (is *IntSet) Len() int {
 	return int(is.length)
 }
 
+// Random 随机返回一个元素，调用者需要保证intset不为空
+func (is *IntSet) Random() int64 {
+	return is.get(rand.Intn(int(is.length)))
+}
+
 func (is *IntSet) Get(pos int, value *int64) bool {
 	if pos < int(is.length) {
 		*value = is.get(pos)
@@ -219,3 +225,12 @@ func (is *IntSet) Find(value int64) bool {
 	valenc := _intsetValueEncoding(value)
 	return valenc <= is.encoding && is.search(value, nil)
 }
+
+// Dup 复制一个intset
+func (is *IntSet) Dup() *IntSet {
+	return &IntSet{
+		length:   is.length,
+		contents: append([]int8(nil), is.contents...),
+		encoding: is.encoding,
+	}
+}
@@ -1,6 +1,166 @@
 package main
 
-// todo
+import (
+	"github.com/pengdafu/redis-golang/dict"
+	"github.com/pengdafu/redis-golang/quicklist"
+	"sync/atomic"
+)
+
+// lazyfreeQueueLen 后台释放队列的长度，队列满了之后直接在主线程中释放
+const lazyfreeQueueLen = 1024
+
+// lazyfreeThreshold 释放代价超过这个值的对象才会交给后台释放，
+// 小对象直接释放比交给后台goroutine的开销更小
+const lazyfreeThreshold = 64
+
+var (
+	lazyfreeObjects  int64 // 等待后台释放的对象个数
+	lazyfreedObjects int64 // 已经在后台释放的对象个数
+)
+
+// lazyfreeJobs 后台释放任务队列，由lazyfreeWorker依次执行
+var lazyfreeJobs chan func()
+
+// lazyfreeInit 创建释放队列并启动后台goroutine
+func lazyfreeInit() {
+	lazyfreeJobs = make(chan func(), lazyfreeQueueLen)
+	go lazyfreeWorker()
+}
+
+func lazyfreeWorker() {
+	for job := range lazyfreeJobs {
+		job()
+	}
+}
+
+// lazyfreeCreateJob 把释放任务交给后台goroutine，队列满了的时候在当前goroutine中直接执行
+func lazyfreeCreateJob(job func()) {
+	select {
+	case lazyfreeJobs <- job:
+	default:
+		job()
+	}
+}
+
+// lazyfreeFreeObject 在后台goroutine中释放对象：清空value内部的dict，断开对quicklist、
+// skiplist和rax的引用，这些结构占用的内存由GC回收，主线程不需要再遍历它们
+func lazyfreeFreeObject(o *robj) {
+	switch o.getType() {
+	case ObjSet:
+		if o.getEncoding() == ObjEncodingHt {
+			(*dict.Dict)(o.ptr).Empty(nil)
+		}
+	case ObjHash:
+		if o.getEncoding() == ObjEncodingHt {
+			if fe := hashTypeFieldExpires(o); fe != nil {
+				fe.Empty(nil)
+			}
+			(*dict.Dict)(o.ptr).Empty(nil)
+		}
+	case ObjZSet:
+		if o.getEncoding() == ObjEncodingSkipList {
+			zs := (*zset)(o.ptr)
+			zs.dict.Empty(nil)
+			zs.zsl = nil
+		}
+	case ObjStream:
+		s := (*stream)(o.ptr)
+		s.rax = nil
+		s.cgroups = nil
+	}
+	o.ptr = nil
+	o.decrRefCount()
+	atomic.AddInt64(&lazyfreeObjects, -1)
+	atomic.AddInt64(&lazyfreedObjects, 1)
+}
+
+// lazyfreeFreeDatabase 在后台goroutine中释放db的dict和过期时间表
+func lazyfreeFreeDatabase(ht1, ht2, ht3 *dict.Dict) {
+	numkeys := ht1.Size()
+	ht1.Empty(nil)
+	ht2.Empty(nil)
+	ht3.Empty(nil)
+	atomic.AddInt64(&lazyfreeObjects, -numkeys)
+	atomic.AddInt64(&lazyfreedObjects, numkeys)
+}
+
+// lazyfreeGetPendingObjectsCount 返回等待后台释放的对象个数
+func lazyfreeGetPendingObjectsCount() int64 {
+	return atomic.LoadInt64(&lazyfreeObjects)
+}
+
+// lazyfreeGetFreedObjectsCount 返回已经在后台释放的对象个数
+func lazyfreeGetFreedObjectsCount() int64 {
+	return atomic.LoadInt64(&lazyfreedObjects)
+}
+
+// lazyfreeGetFreeEffort 估算释放对象的代价，大致等于需要释放的内存块的个数。
+// 只有一块内存的对象(字符串、listpack和intset编码的对象)返回1
+func lazyfreeGetFreeEffort(key, obj *robj, dbid int) int64 {
+	if obj.getType() == ObjList && obj.getEncoding() == ObjEncodingQuickList {
+		return int64((*quicklist.Quicklist)(obj.ptr).Len())
+	} else if obj.getType() == ObjSet && obj.getEncoding() == ObjEncodingHt {
+		return (*dict.Dict)(obj.ptr).Size()
+	} else if obj.getType() == ObjZSet && obj.getEncoding() == ObjEncodingSkipList {
+		return int64((*zset)(obj.ptr).zsl.length)
+	} else if obj.getType() == ObjHash && obj.getEncoding() == ObjEncodingHt {
+		return (*dict.Dict)(obj.ptr).Size()
+	} else if obj.getType() == ObjStream {
+		s := (*stream)(obj.ptr)
+		// rax的每个节点都是一次分配
+		effort := int64(s.rax.numnodes)
+
+		// 每个消费组和它PEL中的元素也需要释放，用第一个消费组的PEL大小估算所有的消费组
+		if s.cgroups != nil && raxSize(s.cgroups) > 0 {
+			var ri raxIterator
+			raxStart(&ri, s.cgroups)
+			raxSeek(&ri, "^", nil)
+			raxNext(&ri)
+			cg := (*streamCG)(ri.data)
+			effort += int64(raxSize(s.cgroups) * (1 + raxSize(cg.pel)))
+			raxStop(&ri)
+		}
+		return effort
+	}
+	return 1
+}
+
+// dbASyncDelete 从db中删除key，释放代价比较大的value交给后台goroutine释放。
+// value被其他地方引用时不能在后台释放，这时和dbSyncDelete一样
 func dbASyncDelete(db *redisDb, key *robj) bool {
-	return dbSyncDelete(db, key)
+	if db.expires.Size() > 0 {
+		db.expires.Delete(key.ptr)
+	}
+	if db.hexpires.Size() > 0 {
+		db.hexpires.Delete(key.ptr)
+	}
+
+	de := db.dict.Unlink(key.ptr)
+	if de == nil {
+		return false
+	}
+	val := (*robj)(dict.GetVal(de))
+	if lazyfreeGetFreeEffort(key, val, db.id) > lazyfreeThreshold && val.refCount == 1 {
+		atomic.AddInt64(&lazyfreeObjects, 1)
+		lazyfreeCreateJob(func() {
+			lazyfreeFreeObject(val)
+		})
+	}
+
+	if server.clusterEnabled {
+		slotToKeyDel(key.ptr)
+	}
+	return true
+}
+
+// emptyDbAsync 用新创建的dict替换db中的dict，原来的dict交给后台goroutine释放
+func emptyDbAsync(db *redisDb) {
+	oldDict, oldExpires, oldHexpires := db.dict, db.expires, db.hexpires
+	db.dict = dict.Create(dbDictType, nil)
+	db.expires = dict.Create(keyPtrDictType, nil)
+	db.hexpires = dict.Create(keyDictType, nil)
+	atomic.AddInt64(&lazyfreeObjects, oldDict.Size())
+	lazyfreeCreateJob(func() {
+		lazyfreeFreeDatabase(oldDict, oldExpires, oldHexpires)
+	})
 }
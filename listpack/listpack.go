@@ -0,0 +1,772 @@
+package listpack
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// listpack的内存布局：
+// <total-bytes uint32> <num-elements uint16> <element-1> ... <element-N> <end-byte 0xFF>
+// 每个元素：<encoding-type + element-data> <element-tot-len>
+// element-tot-len记录前面两部分的长度，从右往左解码，所以可以反向遍历，
+// 而且插入/删除元素的时候不会像ziplist一样出现连锁更新
+
+const (
+	// HeaderSize 32bit表示总共占用的字节数，16bit表示一共有多少元素
+	HeaderSize = 6
+
+	// EndSize 1个字节表示listpack的结束标记
+	EndSize = 1
+
+	// numElementsUnknown 元素数量超过uint16的范围时，只能遍历计算
+	numElementsUnknown = math.MaxUint16
+)
+
+const (
+	Head = 0
+	Tail = 1
+)
+
+const (
+	encoding7BitUint     = 0
+	encoding7BitUintMask = 0x80
+
+	encoding6BitStr     = 0x80
+	encoding6BitStrMask = 0xC0
+
+	encoding13BitInt     = 0xC0
+	encoding13BitIntMask = 0xE0
+
+	encoding12BitStr     = 0xE0
+	encoding12BitStrMask = 0xF0
+
+	encoding16BitInt = 0xF1
+	encoding24BitInt = 0xF2
+	encoding32BitInt = 0xF3
+	encoding64BitInt = 0xF4
+	encoding32BitStr = 0xF0
+
+	lpEOF = 0xFF
+)
+
+const MaxSafetySize = 1 << 30
+
+func lpGetTotalBytes(lp []byte) int {
+	return int(binary.LittleEndian.Uint32(lp[0:]))
+}
+
+func lpSetTotalBytes(lp []byte, v int) {
+	binary.LittleEndian.PutUint32(lp[0:], uint32(v))
+}
+
+func lpGetNumElements(lp []byte) int {
+	return int(binary.LittleEndian.Uint16(lp[4:]))
+}
+
+func lpSetNumElements(lp []byte, v int) {
+	binary.LittleEndian.PutUint16(lp[4:], uint16(v))
+}
+
+// lpIncrNumElements 元素数量未知时不再维护
+func lpIncrNumElements(lp []byte, incr int) {
+	if n := lpGetNumElements(lp); n != numElementsUnknown {
+		n += incr
+		if n >= numElementsUnknown {
+			n = numElementsUnknown
+		}
+		lpSetNumElements(lp, n)
+	}
+}
+
+// lpStringToInt64 只有转换回字符串之后和原来完全一样才认为是整数，
+// 否则"007"、"+1"这样的字符串读出来会变成别的值
+func lpStringToInt64(s []byte, v *int64) bool {
+	if len(s) == 0 || len(s) > 20 {
+		return false
+	}
+	if len(s) == 1 && s[0] >= '0' && s[0] <= '9' {
+		*v = int64(s[0] - '0')
+		return true
+	}
+	digits := s
+	if s[0] == '-' {
+		digits = s[1:]
+	}
+	if len(digits) == 0 || digits[0] < '1' || digits[0] > '9' {
+		return false
+	}
+	for _, c := range digits[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	i, err := strconv.ParseInt(string(s), 10, 64)
+	if err != nil {
+		return false
+	}
+	*v = i
+	return true
+}
+
+// lpEncodeInteger 把v编码到buf中，返回编码之后的长度
+func lpEncodeInteger(buf []byte, v int64) int {
+	if v >= 0 && v <= 127 {
+		buf[0] = byte(v)
+		return 1
+	} else if v >= -4096 && v <= 4095 {
+		if v < 0 {
+			v = (1 << 13) + v
+		}
+		buf[0] = byte(v>>8) | encoding13BitInt
+		buf[1] = byte(v)
+		return 2
+	} else if v >= math.MinInt16 && v <= math.MaxInt16 {
+		if v < 0 {
+			v = (1 << 16) + v
+		}
+		buf[0] = encoding16BitInt
+		buf[1] = byte(v)
+		buf[2] = byte(v >> 8)
+		return 3
+	} else if v >= -1<<23 && v <= 1<<23-1 {
+		if v < 0 {
+			v = (1 << 24) + v
+		}
+		buf[0] = encoding24BitInt
+		buf[1] = byte(v)
+		buf[2] = byte(v >> 8)
+		buf[3] = byte(v >> 16)
+		return 4
+	} else if v >= math.MinInt32 && v <= math.MaxInt32 {
+		if v < 0 {
+			v = (1 << 32) + v
+		}
+		buf[0] = encoding32BitInt
+		binary.LittleEndian.PutUint32(buf[1:], uint32(v))
+		return 5
+	}
+	buf[0] = encoding64BitInt
+	binary.LittleEndian.PutUint64(buf[1:], uint64(v))
+	return 9
+}
+
+// lpEncodeString 把s的编码写入buf，返回写入的长度，buf为nil时只计算长度
+func lpEncodeString(buf []byte, s []byte) int {
+	l := len(s)
+	var hdr int
+	if l < 64 {
+		hdr = 1
+		if buf != nil {
+			buf[0] = encoding6BitStr | byte(l)
+		}
+	} else if l < 4096 {
+		hdr = 2
+		if buf != nil {
+			buf[0] = encoding12BitStr | byte(l>>8)
+			buf[1] = byte(l)
+		}
+	} else {
+		hdr = 5
+		if buf != nil {
+			buf[0] = encoding32BitStr
+			binary.LittleEndian.PutUint32(buf[1:], uint32(l))
+		}
+	}
+	if buf != nil {
+		copy(buf[hdr:], s)
+	}
+	return hdr + l
+}
+
+// lpEncodeBacklen 把l按照从右往左解码的格式写入buf，返回写入的长度，buf为nil时只计算长度
+func lpEncodeBacklen(buf []byte, l int) int {
+	switch {
+	case l <= 127:
+		if buf != nil {
+			buf[0] = byte(l)
+		}
+		return 1
+	case l < 16383:
+		if buf != nil {
+			buf[0] = byte(l >> 7)
+			buf[1] = byte(l&127) | 128
+		}
+		return 2
+	case l < 2097151:
+		if buf != nil {
+			buf[0] = byte(l >> 14)
+			buf[1] = byte((l>>7)&127) | 128
+			buf[2] = byte(l&127) | 128
+		}
+		return 3
+	case l < 268435455:
+		if buf != nil {
+			buf[0] = byte(l >> 21)
+			buf[1] = byte((l>>14)&127) | 128
+			buf[2] = byte((l>>7)&127) | 128
+			buf[3] = byte(l&127) | 128
+		}
+		return 4
+	default:
+		if buf != nil {
+			buf[0] = byte(l >> 28)
+			buf[1] = byte((l>>21)&127) | 128
+			buf[2] = byte((l>>14)&127) | 128
+			buf[3] = byte((l>>7)&127) | 128
+			buf[4] = byte(l&127) | 128
+		}
+		return 5
+	}
+}
+
+// lpDecodeBacklen 从lp[i]开始往左解码element-tot-len，返回值和它占用的字节数
+func lpDecodeBacklen(lp []byte, i int) (int, int) {
+	val, shift, n := 0, 0, 0
+	for {
+		val |= int(lp[i]&127) << shift
+		n++
+		if lp[i]&128 == 0 {
+			break
+		}
+		shift += 7
+		i--
+		if shift > 28 || i < 0 {
+			return -1, n
+		}
+	}
+	return val, n
+}
+
+// lpCurrentEncodedSize 返回p指向的元素encoding和data部分的长度
+func lpCurrentEncodedSize(p []byte) int {
+	switch {
+	case p[0]&encoding7BitUintMask == encoding7BitUint:
+		return 1
+	case p[0]&encoding6BitStrMask == encoding6BitStr:
+		return 1 + int(p[0]&0x3F)
+	case p[0]&encoding13BitIntMask == encoding13BitInt:
+		return 2
+	case p[0] == encoding16BitInt:
+		return 3
+	case p[0] == encoding24BitInt:
+		return 4
+	case p[0] == encoding32BitInt:
+		return 5
+	case p[0] == encoding64BitInt:
+		return 9
+	case p[0]&encoding12BitStrMask == encoding12BitStr:
+		return 2 + (int(p[0]&0x0F)<<8 | int(p[1]))
+	case p[0] == encoding32BitStr:
+		return 5 + int(binary.LittleEndian.Uint32(p[1:]))
+	case p[0] == lpEOF:
+		return 1
+	}
+	return 0
+}
+
+// lpCurrentEncodedSizeSafe 和lpCurrentEncodedSize一样，但是会检查读取的头部有没有越界，
+// 返回0表示元素已经损坏
+func lpCurrentEncodedSizeSafe(p []byte) int {
+	if len(p) == 0 {
+		return 0
+	}
+	var hdr int
+	switch {
+	case p[0]&encoding12BitStrMask == encoding12BitStr:
+		hdr = 2
+	case p[0] == encoding32BitStr:
+		hdr = 5
+	default:
+		hdr = 1
+	}
+	if len(p) < hdr {
+		return 0
+	}
+	if p[0] >= 0xF5 && p[0] != lpEOF {
+		return 0
+	}
+	return lpCurrentEncodedSize(p)
+}
+
+// lpEntrySize 返回p指向的元素占用的全部字节数
+func lpEntrySize(p []byte) int {
+	l := lpCurrentEncodedSize(p)
+	return l + lpEncodeBacklen(nil, l)
+}
+
+// lpEncodeEntry 把s编码成一个完整的元素，能表示成整数的字符串会按整数编码
+func lpEncodeEntry(s []byte) []byte {
+	var buf [9]byte
+	var enc []byte
+	var v int64
+	var l int
+	if lpStringToInt64(s, &v) {
+		l = lpEncodeInteger(buf[:], v)
+		enc = buf[:l:l]
+	} else {
+		l = lpEncodeString(nil, s)
+		enc = make([]byte, l, l+5)
+		lpEncodeString(enc, s)
+	}
+	var backlen [5]byte
+	n := lpEncodeBacklen(backlen[:], l)
+	return append(enc, backlen[:n]...)
+}
+
+// lpInsertRaw 在offset处删除del个字节，然后插入ele，返回新的listpack
+func lpInsertRaw(lp []byte, offset int, ele []byte, del int) []byte {
+	newLen := len(lp) - del + len(ele)
+	n := make([]byte, newLen)
+	copy(n, lp[:offset])
+	copy(n[offset:], ele)
+	copy(n[offset+len(ele):], lp[offset+del:])
+	lpSetTotalBytes(n, newLen)
+	return n
+}
+
+func New() []byte {
+	lp := make([]byte, HeaderSize+EndSize)
+	lpSetTotalBytes(lp, HeaderSize+EndSize)
+	lpSetNumElements(lp, 0)
+	lp[HeaderSize] = lpEOF
+	return lp
+}
+
+// SafeToAdd 检查增加add个字节之后listpack会不会太大
+func SafeToAdd(lp []byte, add int) bool {
+	l := 0
+	if len(lp) > 0 {
+		l = lpGetTotalBytes(lp)
+	}
+	return l+add <= MaxSafetySize
+}
+
+// Bytes 返回listpack占用的字节数
+func Bytes(lp []byte) int {
+	return lpGetTotalBytes(lp)
+}
+
+// First 返回第一个元素，listpack为空时返回nil
+func First(lp []byte) []byte {
+	p := lp[HeaderSize:]
+	if p[0] == lpEOF {
+		return nil
+	}
+	return p
+}
+
+// Last 返回最后一个元素，listpack为空时返回nil
+func Last(lp []byte) []byte {
+	return Prev(lp, lp[len(lp)-1:])
+}
+
+func Next(lp []byte, p []byte) []byte {
+	if p[0] == lpEOF {
+		return nil
+	}
+	p = p[lpEntrySize(p):]
+	if p[0] == lpEOF {
+		return nil
+	}
+	return p
+}
+
+// Prev 返回p的前一个元素，p可以指向结束标记
+func Prev(lp []byte, p []byte) []byte {
+	offset := len(lp) - len(p)
+	if offset == HeaderSize {
+		return nil
+	}
+	prevlen, n := lpDecodeBacklen(lp, offset-1)
+	return lp[offset-n-prevlen:]
+}
+
+// Index 返回下标为index的元素，index为负数时从尾部开始计算，越界时返回nil
+func Index(lp []byte, index int) []byte {
+	var p []byte
+	if index < 0 {
+		p = lp[len(lp)-1:]
+		for ; index < 0; index++ {
+			if p = Prev(lp, p); p == nil {
+				return nil
+			}
+		}
+		return p
+	}
+	p = lp[HeaderSize:]
+	for ; index > 0 && p[0] != lpEOF; index-- {
+		p = p[lpEntrySize(p):]
+	}
+	if p[0] == lpEOF {
+		return nil
+	}
+	return p
+}
+
+// Get 获取p指向的元素，字符串保存到sstr和slen中，整数保存到sval中，此时sstr为nil
+func Get(p []byte, sstr *[]byte, slen *int, sval *int64) bool {
+	if p == nil || p[0] == lpEOF {
+		return false
+	}
+	if sstr != nil {
+		*sstr = nil
+	}
+
+	var uval, negstart, negmax uint64
+	switch {
+	case p[0]&encoding7BitUintMask == encoding7BitUint:
+		uval, negstart = uint64(p[0]&0x7F), math.MaxUint64
+	case p[0]&encoding6BitStrMask == encoding6BitStr:
+		l := int(p[0] & 0x3F)
+		*sstr, *slen = p[1:1+l], l
+		return true
+	case p[0]&encoding13BitIntMask == encoding13BitInt:
+		uval = uint64(p[0]&0x1F)<<8 | uint64(p[1])
+		negstart, negmax = 1<<12, 8191
+	case p[0] == encoding16BitInt:
+		uval = uint64(p[1]) | uint64(p[2])<<8
+		negstart, negmax = 1<<15, math.MaxUint16
+	case p[0] == encoding24BitInt:
+		uval = uint64(p[1]) | uint64(p[2])<<8 | uint64(p[3])<<16
+		negstart, negmax = 1<<23, 1<<24-1
+	case p[0] == encoding32BitInt:
+		uval = uint64(binary.LittleEndian.Uint32(p[1:]))
+		negstart, negmax = 1<<31, math.MaxUint32
+	case p[0] == encoding64BitInt:
+		uval = binary.LittleEndian.Uint64(p[1:])
+		negstart, negmax = math.MaxUint64, math.MaxUint64
+	case p[0]&encoding12BitStrMask == encoding12BitStr:
+		l := int(p[0]&0x0F)<<8 | int(p[1])
+		*sstr, *slen = p[2:2+l], l
+		return true
+	case p[0] == encoding32BitStr:
+		l := int(binary.LittleEndian.Uint32(p[1:]))
+		*sstr, *slen = p[5:5+l], l
+		return true
+	default:
+		panic("listpack: invalid encoding")
+	}
+
+	if sval != nil {
+		if uval >= negstart {
+			// 按补码还原负数
+			uval = negmax - uval
+			*sval = -int64(uval) - 1
+		} else {
+			*sval = int64(uval)
+		}
+	}
+	return true
+}
+
+// Find 从p开始查找和vstr相等的元素，每次比较之后跳过skip个元素，找不到返回nil
+func Find(p []byte, vstr []byte, vlen, skip int) []byte {
+	skipCnt := 0
+	vencoded, vIsInt := false, false
+	var vll int64
+
+	var sstr []byte
+	var slen int
+	var sval int64
+	for p[0] != lpEOF {
+		if skipCnt == 0 {
+			Get(p, &sstr, &slen, &sval)
+			if sstr != nil {
+				if slen == vlen && string(sstr) == string(vstr[:vlen]) {
+					return p
+				}
+			} else {
+				// 只在第一次遇到整数元素的时候尝试把vstr转换成整数
+				if !vencoded {
+					vIsInt = lpStringToInt64(vstr[:vlen], &vll)
+					vencoded = true
+				}
+				if vIsInt && sval == vll {
+					return p
+				}
+			}
+			skipCnt = skip
+		} else {
+			skipCnt--
+		}
+		p = p[lpEntrySize(p):]
+	}
+	return nil
+}
+
+// Len 返回元素数量，数量超过uint16的范围时需要遍历
+func Len(lp []byte) int {
+	if n := lpGetNumElements(lp); n != numElementsUnknown {
+		return n
+	}
+	n := 0
+	for p := lp[HeaderSize:]; p[0] != lpEOF; p = p[lpEntrySize(p):] {
+		n++
+	}
+	if n < numElementsUnknown {
+		lpSetNumElements(lp, n)
+	}
+	return n
+}
+
+// Insert 把s插入到p的前面，p可以指向结束标记
+func Insert(lp, p, s []byte) []byte {
+	lp = lpInsertRaw(lp, len(lp)-len(p), lpEncodeEntry(s), 0)
+	lpIncrNumElements(lp, 1)
+	return lp
+}
+
+// lpEncodeIntegerEntry 把v编码成一个完整的元素
+func lpEncodeIntegerEntry(v int64) []byte {
+	var buf [10]byte // 整数最多占用9个字节，再加1个字节的长度
+	l := lpEncodeInteger(buf[:], v)
+	n := lpEncodeBacklen(buf[l:], l)
+	return buf[:l+n]
+}
+
+// AppendInteger 把整数v追加到尾部
+func AppendInteger(lp []byte, v int64) []byte {
+	lp = lpInsertRaw(lp, len(lp)-EndSize, lpEncodeIntegerEntry(v), 0)
+	lpIncrNumElements(lp, 1)
+	return lp
+}
+
+// ReplaceInteger 把p指向的元素替换成整数v，之后p指向新的元素
+func ReplaceInteger(lp []byte, p *[]byte, v int64) []byte {
+	offset := len(lp) - len(*p)
+	lp = lpInsertRaw(lp, offset, lpEncodeIntegerEntry(v), lpEntrySize(*p))
+	*p = lp[offset:]
+	return lp
+}
+
+// Push 把s插入到头部或者尾部
+func Push(lp, s []byte, where int) []byte {
+	if where == Head {
+		return Insert(lp, lp[HeaderSize:], s)
+	}
+	return Insert(lp, lp[len(lp)-1:], s)
+}
+
+// Delete 删除p指向的元素，之后p指向下一个元素或者结束标记
+func Delete(lp []byte, p *[]byte) []byte {
+	offset := len(lp) - len(*p)
+	lp = lpInsertRaw(lp, offset, nil, lpEntrySize(*p))
+	lpIncrNumElements(lp, -1)
+	*p = lp[offset:]
+	return lp
+}
+
+// Replace 把p指向的元素替换成s，返回新的listpack
+func Replace(lp, p, s []byte) []byte {
+	return lpInsertRaw(lp, len(lp)-len(p), lpEncodeEntry(s), lpEntrySize(p))
+}
+
+// DeleteRange 从下标index开始删除num个元素
+func DeleteRange(lp []byte, index, num int) []byte {
+	p := Index(lp, index)
+	if p == nil || num <= 0 {
+		return lp
+	}
+	offset := len(lp) - len(p)
+	deleted := 0
+	for ; deleted < num && p[0] != lpEOF; deleted++ {
+		p = p[lpEntrySize(p):]
+	}
+	lp = lpInsertRaw(lp, offset, nil, len(lp)-len(p)-offset)
+	lpIncrNumElements(lp, -deleted)
+	return lp
+}
+
+// Compare 比较p指向的元素和s是否相等，整数编码的元素会尝试把s按整数比较
+func Compare(p []byte, s []byte) bool {
+	var sstr []byte
+	var slen int
+	var sval int64
+	if !Get(p, &sstr, &slen, &sval) {
+		return false
+	}
+	if sstr != nil {
+		return slen == len(s) && string(sstr) == string(s)
+	}
+	var v int64
+	return lpStringToInt64(s, &v) && v == sval
+}
+
+// ValidateIntegrity 检查listpack的结构是否完整，deep为false时只检查头部，
+// deep为true时检查每一个元素，cb不为nil时对每个元素调用，返回false表示校验失败
+func ValidateIntegrity(lp []byte, deep bool, cb func(p []byte) bool) bool {
+	if len(lp) < HeaderSize+EndSize {
+		return false
+	}
+	if lpGetTotalBytes(lp) != len(lp) {
+		return false
+	}
+	if lp[len(lp)-1] != lpEOF {
+		return false
+	}
+	if !deep {
+		return true
+	}
+
+	count := 0
+	offset := HeaderSize
+	for lp[offset] != lpEOF {
+		p := lp[offset:]
+		l := lpCurrentEncodedSizeSafe(p)
+		if l == 0 {
+			return false
+		}
+		backlenSize := lpEncodeBacklen(nil, l)
+		// 元素不能越过结束标记
+		if offset+l+backlenSize > len(lp)-EndSize {
+			return false
+		}
+		// 记录的长度必须和编码的长度一致
+		if v, n := lpDecodeBacklen(lp, offset+l+backlenSize-1); v != l || n != backlenSize {
+			return false
+		}
+		if cb != nil && !cb(p) {
+			return false
+		}
+		offset += l + backlenSize
+		count++
+	}
+	if offset != len(lp)-EndSize {
+		return false
+	}
+
+	if n := lpGetNumElements(lp); n != numElementsUnknown && n != count {
+		return false
+	}
+	return true
+}
+
+// Entry 保存从listpack中取出的元素，Sval为nil时元素是整数Lval
+type Entry struct {
+	Sval []byte
+	Slen int
+	Lval int64
+}
+
+// RandomPair 随机返回一对key-value，totalCount是listpack中kv对的数量，val为nil时只返回key
+func RandomPair(lp []byte, totalCount int, key, val *Entry) {
+	if totalCount == 0 {
+		panic("RandomPair on empty listpack")
+	}
+	// listpack中保存的是kv对，所以下标是偶数
+	r := rand.Intn(totalCount) * 2
+	p := Index(lp, r)
+	if !Get(p, &key.Sval, &key.Slen, &key.Lval) {
+		panic("listpack corrupted")
+	}
+	if val == nil {
+		return
+	}
+	p = Next(lp, p)
+	if !Get(p, &val.Sval, &val.Slen, &val.Lval) {
+		panic("listpack corrupted")
+	}
+}
+
+// lpRandomEntries 随机选出count个元素，可能会重复，step为2时按kv对选择
+func lpRandomEntries(lp []byte, count, step int, keys, vals []Entry) {
+	type randPick struct {
+		index int
+		order int
+	}
+	totalSize := Len(lp) / step
+	if totalSize == 0 {
+		panic("random pick on empty listpack")
+	}
+
+	// 生成随机的下标，记下生成的顺序
+	picks := make([]randPick, count)
+	for i := range picks {
+		picks[i].index = rand.Intn(totalSize) * step
+		picks[i].order = i
+	}
+
+	// 按下标排序之后只需要遍历一次listpack
+	sort.Slice(picks, func(i, j int) bool {
+		return picks[i].index < picks[j].index
+	})
+
+	var key, value Entry
+	lpindex, pickindex := 0, 0
+	p := First(lp)
+	for pickindex < count && Get(p, &key.Sval, &key.Slen, &key.Lval) {
+		if step == 2 {
+			p = Next(lp, p)
+			if !Get(p, &value.Sval, &value.Slen, &value.Lval) {
+				panic("listpack corrupted")
+			}
+		}
+		for pickindex < count && lpindex == picks[pickindex].index {
+			storeorder := picks[pickindex].order
+			keys[storeorder] = key
+			if vals != nil {
+				vals[storeorder] = value
+			}
+			pickindex++
+		}
+		lpindex += step
+		p = Next(lp, p)
+	}
+}
+
+// lpRandomEntriesUnique 随机选出最多count个不重复的元素，返回实际的数量
+func lpRandomEntriesUnique(lp []byte, count, step int, keys, vals []Entry) int {
+	totalSize := Len(lp) / step
+	if count > totalSize {
+		count = totalSize
+	}
+
+	// 只遍历一次，每个元素被选中的概率是还需要选择的数量除以还没有访问的数量，
+	// 这样每个元素被选中的概率都是相同的
+	p := First(lp)
+	picked, remaining, index := 0, count, 0
+	for picked < count && p != nil {
+		threshold := float64(remaining) / float64(totalSize-index)
+		if rand.Float64() <= threshold {
+			if !Get(p, &keys[picked].Sval, &keys[picked].Slen, &keys[picked].Lval) {
+				panic("listpack corrupted")
+			}
+			if step == 2 {
+				p = Next(lp, p)
+				if vals != nil && !Get(p, &vals[picked].Sval, &vals[picked].Slen, &vals[picked].Lval) {
+					panic("listpack corrupted")
+				}
+			}
+			remaining--
+			picked++
+		} else if step == 2 {
+			p = Next(lp, p)
+		}
+		p = Next(lp, p)
+		index++
+	}
+	return picked
+}
+
+// RandomPairs 随机返回count对key-value，可能会重复，vals为nil时只返回key
+func RandomPairs(lp []byte, count int, keys, vals []Entry) {
+	lpRandomEntries(lp, count, 2, keys, vals)
+}
+
+// RandomPairsUnique 随机返回最多count对不重复的key-value，返回实际的数量
+func RandomPairsUnique(lp []byte, count int, keys, vals []Entry) int {
+	return lpRandomEntriesUnique(lp, count, 2, keys, vals)
+}
+
+// RandomElements 随机返回count个元素，可能会重复，用于每个元素单独保存的listpack
+func RandomElements(lp []byte, count int, entries []Entry) {
+	lpRandomEntries(lp, count, 1, entries, nil)
+}
+
+// RandomElementsUnique 随机返回最多count个不重复的元素，返回实际的数量
+func RandomElementsUnique(lp []byte, count int, entries []Entry) int {
+	return lpRandomEntriesUnique(lp, count, 1, entries, nil)
+}
@@ -0,0 +1,164 @@
+package listpack
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEncoding(t *testing.T) {
+	values := []string{"0", "127", "128", "-1", "-4096", "4095", "-32768", "32767", "-8388608",
+		"8388607", "-2147483648", "2147483647", "-9223372036854775808", "9223372036854775807",
+		"007", "+1", "-0", "abc", strings.Repeat("x", 63), strings.Repeat("y", 64),
+		strings.Repeat("z", 4095), strings.Repeat("w", 4096)}
+	lp := New()
+	for _, v := range values {
+		lp = Push(lp, []byte(v), Tail)
+	}
+	if Len(lp) != len(values) || Bytes(lp) != len(lp) {
+		t.Fatalf("len %d bytes %d", Len(lp), Bytes(lp))
+	}
+	if !ValidateIntegrity(lp, true, nil) {
+		t.Fatal("validate failed")
+	}
+
+	i := 0
+	for p := First(lp); p != nil; p = Next(lp, p) {
+		var sstr []byte
+		var slen int
+		var sval int64
+		Get(p, &sstr, &slen, &sval)
+		got := string(sstr)
+		if sstr == nil {
+			got = fmt.Sprintf("%d", sval)
+		}
+		if got != values[i] {
+			t.Fatalf("index %d: expect %s, got %s", i, values[i], got)
+		}
+		i++
+	}
+
+	i = len(values) - 1
+	for p := Last(lp); p != nil; p = Prev(lp, p) {
+		if !Compare(p, []byte(values[i])) {
+			t.Fatalf("index %d: compare failed", i)
+		}
+		i--
+	}
+	if i != -1 {
+		t.Fatalf("reverse iteration stopped at %d", i)
+	}
+}
+
+func TestInsertDelete(t *testing.T) {
+	lp := New()
+	lp = Push(lp, []byte("b"), Tail)
+	lp = Push(lp, []byte("d"), Tail)
+	lp = Push(lp, []byte("a"), Head)
+	lp = Insert(lp, Index(lp, 2), []byte("c"))
+
+	for i, s := range []string{"a", "b", "c", "d"} {
+		if p := Index(lp, i); p == nil || !Compare(p, []byte(s)) {
+			t.Fatalf("index %d: expect %s", i, s)
+		}
+	}
+	if p := Index(lp, -1); !Compare(p, []byte("d")) || Index(lp, 4) != nil || Index(lp, -5) != nil {
+		t.Fatal("index out of range")
+	}
+
+	p := Find(First(lp), []byte("b"), 1, 0)
+	lp = Delete(lp, &p)
+	if !Compare(p, []byte("c")) {
+		t.Fatal("p should point to the next element after delete")
+	}
+	lp = Replace(lp, p, []byte("12345"))
+	if Find(First(lp), []byte("12345"), 5, 0) == nil || Len(lp) != 3 {
+		t.Fatal("replace failed")
+	}
+
+	lp = DeleteRange(lp, 0, 2)
+	if Len(lp) != 1 || !Compare(First(lp), []byte("d")) || !ValidateIntegrity(lp, true, nil) {
+		t.Fatal("delete range failed")
+	}
+}
+
+func TestFindSkip(t *testing.T) {
+	lp := New()
+	for _, s := range []string{"k1", "v1", "k2", "k1", "10", "v3"} {
+		lp = Push(lp, []byte(s), Tail)
+	}
+	// 只比较key，值等于k1的value不会被匹配
+	if p := Find(First(lp), []byte("k1"), 2, 1); p == nil || len(lp)-len(p) != HeaderSize {
+		t.Fatal("find k1 failed")
+	}
+	if p := Find(First(lp), []byte("v1"), 2, 1); p != nil {
+		t.Fatal("values should be skipped")
+	}
+	if p := Find(First(lp), []byte("10"), 2, 1); p == nil || !Compare(p, []byte("10")) {
+		t.Fatal("find integer key failed")
+	}
+}
+
+func TestValidateCorrupted(t *testing.T) {
+	lp := New()
+	lp = Push(lp, []byte("hello"), Tail)
+	lp = Push(lp, []byte("1024"), Tail)
+
+	bad := append([]byte(nil), lp...)
+	bad[HeaderSize] = 0x80 | 30
+	if ValidateIntegrity(bad, true, nil) {
+		t.Fatal("string length overflow should be detected")
+	}
+	bad = append([]byte(nil), lp...)
+	lpSetNumElements(bad, 3)
+	if ValidateIntegrity(bad, true, nil) {
+		t.Fatal("wrong element count should be detected")
+	}
+	if ValidateIntegrity(lp[:len(lp)-1], false, nil) {
+		t.Fatal("truncated listpack should be detected")
+	}
+}
+
+func TestRandomElementsUnique(t *testing.T) {
+	lp := New()
+	for i := 0; i < 50; i++ {
+		lp = Push(lp, []byte(fmt.Sprintf("ele:%d", i)), Tail)
+	}
+	entries := make([]Entry, 60)
+	n := RandomElementsUnique(lp, 60, entries)
+	if n != 50 {
+		t.Fatalf("expect 50 elements, got %d", n)
+	}
+	seen := map[string]bool{}
+	for _, e := range entries[:n] {
+		if seen[string(e.Sval)] {
+			t.Fatalf("duplicated element %s", e.Sval)
+		}
+		seen[string(e.Sval)] = true
+	}
+
+	RandomElements(lp, 60, entries)
+	for _, e := range entries {
+		if Find(First(lp), e.Sval, e.Slen, 0) == nil {
+			t.Fatalf("unknown element %s", e.Sval)
+		}
+	}
+}
+
+func TestIntegerEntries(t *testing.T) {
+	lp := New()
+	for _, v := range []int64{0, -1, 1000, -70000, 1 << 40} {
+		lp = AppendInteger(lp, v)
+	}
+	p := Index(lp, 2)
+	lp = ReplaceInteger(lp, &p, -5)
+	var sval int64
+	var sstr []byte
+	var slen int
+	if !Get(p, &sstr, &slen, &sval) || sstr != nil || sval != -5 {
+		t.Fatalf("replace integer failed: %d", sval)
+	}
+	if Len(lp) != 5 || !Compare(Last(lp), []byte("1099511627776")) || !ValidateIntegrity(lp, true, nil) {
+		t.Fatal("append integer failed")
+	}
+}
@@ -0,0 +1,196 @@
+// Package lzf 是liblzf的移植，quicklist用它来压缩中间的节点
+package lzf
+
+const (
+	hlog   = 16
+	hsize  = 1 << hlog
+	maxLit = 1 << 5
+	maxOff = 1 << 13
+	maxRef = (1 << 8) + (1 << 3)
+)
+
+func first(p []byte, i int) uint32 {
+	return uint32(p[i])<<8 | uint32(p[i+1])
+}
+
+func next(v uint32, p []byte, i int) uint32 {
+	return v<<8 | uint32(p[i+2])
+}
+
+func idx(h uint32) uint32 {
+	return ((h >> (3*8 - hlog)) - h*5) & (hsize - 1)
+}
+
+// Compress 压缩in并把结果写入out，返回压缩后的长度。
+// out的空间不够时返回0，这时候应该直接保存未压缩的数据
+func Compress(in, out []byte) int {
+	inLen, outLen := len(in), len(out)
+	if inLen == 0 {
+		return 0
+	}
+
+	// htab保存的是位置+1，0表示没有记录
+	var htab [hsize]int
+	ip, op := 0, 0
+	lit := 0
+	op++ // 开始一段字面量
+
+	var hval uint32
+	if inLen >= 2 {
+		hval = first(in, ip)
+	}
+	for ip < inLen-2 {
+		hval = next(hval, in, ip)
+		hslot := idx(hval)
+		ref := htab[hslot] - 1
+		htab[hslot] = ip + 1
+
+		off := ip - ref - 1
+		if ref >= 0 && off < maxOff && in[ref+2] == in[ip+2] && in[ref] == in[ip] && in[ref+1] == in[ip+1] {
+			// 找到匹配
+			length := 2
+			maxlen := inLen - ip - length
+			if maxlen > maxRef {
+				maxlen = maxRef
+			}
+
+			noLit := 0
+			if lit == 0 {
+				noLit = 1
+			}
+			if op-noLit+3+1 >= outLen {
+				return 0
+			}
+
+			out[op-lit-1] = byte(lit - 1) // 结束字面量
+			op -= noLit                   // 字面量长度为0时撤销
+
+			for {
+				length++
+				if length >= maxlen || in[ref+length] != in[ip+length] {
+					break
+				}
+			}
+
+			length -= 2 // 现在length表示匹配的字节数-1
+			ip++
+
+			if length < 7 {
+				out[op] = byte(off>>8 + length<<5)
+				op++
+			} else {
+				out[op] = byte(off>>8 + 7<<5)
+				out[op+1] = byte(length - 7)
+				op += 2
+			}
+			out[op] = byte(off)
+			op++
+
+			lit = 0
+			op++ // 开始一段字面量
+
+			ip += length + 1
+			if ip >= inLen-2 {
+				break
+			}
+
+			ip -= 2
+			hval = first(in, ip)
+			hval = next(hval, in, ip)
+			htab[idx(hval)] = ip + 1
+			ip++
+			hval = next(hval, in, ip)
+			htab[idx(hval)] = ip + 1
+			ip++
+		} else {
+			// 多一个字面量字节
+			if op >= outLen {
+				return 0
+			}
+			lit++
+			out[op] = in[ip]
+			op++
+			ip++
+
+			if lit == maxLit {
+				out[op-lit-1] = byte(lit - 1)
+				lit = 0
+				op++
+			}
+		}
+	}
+
+	// 最多还剩3个字节
+	if op+3 > outLen {
+		return 0
+	}
+	for ip < inLen {
+		lit++
+		out[op] = in[ip]
+		op++
+		ip++
+
+		if lit == maxLit {
+			out[op-lit-1] = byte(lit - 1)
+			lit = 0
+			op++
+		}
+	}
+
+	out[op-lit-1] = byte(lit - 1)
+	if lit == 0 {
+		op--
+	}
+	return op
+}
+
+// Decompress 解压in并把结果写入out，返回解压后的长度，数据损坏或者out的空间不够时返回0
+func Decompress(in, out []byte) int {
+	inLen, outLen := len(in), len(out)
+	ip, op := 0, 0
+
+	for ip < inLen {
+		ctrl := int(in[ip])
+		ip++
+
+		if ctrl < 1<<5 {
+			// 字面量
+			ctrl++
+			if op+ctrl > outLen || ip+ctrl > inLen {
+				return 0
+			}
+			copy(out[op:op+ctrl], in[ip:ip+ctrl])
+			op += ctrl
+			ip += ctrl
+		} else {
+			// 回溯引用
+			length := ctrl >> 5
+			ref := op - (ctrl&0x1f)<<8 - 1
+
+			if ip >= inLen {
+				return 0
+			}
+			if length == 7 {
+				length += int(in[ip])
+				ip++
+				if ip >= inLen {
+					return 0
+				}
+			}
+			ref -= int(in[ip])
+			ip++
+
+			if op+length+2 > outLen || ref < 0 {
+				return 0
+			}
+
+			// 引用的区域可能和输出重叠，只能逐字节复制
+			for i := 0; i < length+2; i++ {
+				out[op] = out[ref]
+				op++
+				ref++
+			}
+		}
+	}
+	return op
+}
@@ -0,0 +1,41 @@
+package lzf
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCompressDecompress(t *testing.T) {
+	inputs := [][]byte{
+		[]byte("a"),
+		[]byte("abc"),
+		bytes.Repeat([]byte("abcdefgh"), 100),
+		bytes.Repeat([]byte{0}, 10000),
+	}
+	random := make([]byte, 4096)
+	rand.Read(random)
+	mixed := append(bytes.Repeat([]byte("hello world "), 50), random[:300]...)
+	inputs = append(inputs, random, mixed)
+
+	for i, in := range inputs {
+		out := make([]byte, len(in)+len(in)/16+64)
+		n := Compress(in, out)
+		if n == 0 {
+			t.Fatalf("input %d: compress failed", i)
+		}
+
+		dec := make([]byte, len(in))
+		if m := Decompress(out[:n], dec); m != len(in) || !bytes.Equal(dec, in) {
+			t.Fatalf("input %d: decompressed data mismatch", i)
+		}
+	}
+}
+
+func TestCompressNoSpace(t *testing.T) {
+	in := make([]byte, 1024)
+	rand.Read(in)
+	if n := Compress(in, make([]byte, 512)); n != 0 {
+		t.Fatalf("expect 0 when output buffer is too small, got %d", n)
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/pengdafu/redis-golang/sds"
 	"github.com/pengdafu/redis-golang/util"
 	"log"
+	"math"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -131,7 +133,7 @@ func createClient(conn *Connection) *Client {
 	c.reply.SetDupMethod(dupClientReplyValue)
 	c.bType = BLOCKED_NONE
 	c.bpop.timeout = 0
-	c.bpop.keys = dict.Create(nil, nil)
+	c.bpop.keys = dict.Create(objectKeyPointValueDictType, nil)
 	c.bpop.target = nil
 	c.bpop.xReadGroup = nil
 	c.bpop.xReadConsumer = nil
@@ -536,6 +538,11 @@ func freeClientReplyValue(o interface{}) {
 
 // todo
 func freeClientAsync(c *Client) {
+	// 阻塞中的客户端需要先从阻塞的key上移除
+	if c.flags&CLIENT_BLOCKED > 0 {
+		unblockClient(c)
+	}
+	c.flags |= CLIENT_CLOSE_ASAP
 	syscall.Close(c.conn.Fd)
 }
 func dupClientReplyValue(o interface{}) interface{} {
@@ -653,6 +660,48 @@ func addReplyBulkLongLong(c *Client, vll int64) {
 	addReplyBulkBuffer(c, p, len(p))
 }
 
+func addReplyBulkCString(c *Client, s string) {
+	addReplyBulkBuffer(c, util.String2Bytes(s), len(s))
+}
+
+// addReplyStatus 回复状态字符串，+status\r\n
+func addReplyStatus(c *Client, status string) {
+	addReplyProto(c, "+")
+	addReplyProto(c, status)
+	addReplyProto(c, "\r\n")
+}
+
+func addReplyDouble(c *Client, d float64) {
+	if math.IsInf(d, 0) {
+		inf := "inf"
+		if d < 0 {
+			inf = "-inf"
+		}
+		if c.resp == 2 {
+			addReplyBulkCString(c, inf)
+		} else {
+			addReplyProto(c, ","+inf+"\r\n")
+		}
+		return
+	}
+
+	dbuf := strconv.FormatFloat(d, 'g', 17, 64)
+	if c.resp == 2 {
+		addReplyBulkCString(c, dbuf)
+	} else {
+		addReplyProto(c, ","+dbuf+"\r\n")
+	}
+}
+
+// addReplyHumanLongDouble RESP2使用人类可读的格式回复bulk string，RESP3回复double
+func addReplyHumanLongDouble(c *Client, d float64) {
+	if c.resp == 2 {
+		addReplyBulkCString(c, util.LD2String(d, true))
+	} else {
+		addReplyDouble(c, d)
+	}
+}
+
 func addReplyAggregateLen(c *Client, length int, prefix byte) {
 	if prefix == '*' && length < ObjSharedBulkHdrLen {
 		addReply(c, shared.mBulkHdr[length])
@@ -678,6 +727,14 @@ func addReplyArrayLen(c *Client, length int) {
 	addReplyAggregateLen(c, length, '*')
 }
 
+func addReplySetLen(c *Client, length int) {
+	prefix := byte('*')
+	if c.resp != 2 {
+		prefix = '~'
+	}
+	addReplyAggregateLen(c, length, prefix)
+}
+
 func addReplyBulkLen(c *Client, o *robj) {
 	slen := o.stringObjectLen()
 	if slen < ObjSharedBulkHdrLen {
@@ -744,6 +801,25 @@ func addReplyErrorFormat(c *Client, format string, a ...any) {
 	afterErrorReply(c, err)
 }
 
+// addReplyHelp 回复子命令的帮助信息，help中每一行是一个状态回复
+func addReplyHelp(c *Client, help []string) {
+	cmd := strings.ToUpper(util.Bytes2String((*sds.SDS)(c.argv[0].ptr).BufData(0)))
+	addReplyArrayLen(c, len(help)+3)
+	addReplyStatus(c, fmt.Sprintf("%s <subcommand> [<arg> [value] [opt] ...]. Subcommands are:", cmd))
+	for _, line := range help {
+		addReplyStatus(c, line)
+	}
+	addReplyStatus(c, "HELP")
+	addReplyStatus(c, "    Print this help.")
+}
+
+// addReplySubcommandSyntaxError 子命令不存在或者参数个数不对
+func addReplySubcommandSyntaxError(c *Client) {
+	cmd := strings.ToUpper(util.Bytes2String((*sds.SDS)(c.argv[0].ptr).BufData(0)))
+	addReplyErrorFormat(c, "unknown subcommand or wrong number of arguments for '%.128s'. Try %s HELP.",
+		(*sds.SDS)(c.argv[1].ptr).BufData(0), cmd)
+}
+
 func addReplyErrorLength(c *Client, err string) {
 	if len(err) == 0 || err[0] != '-' {
 		addReplyProto(c, "-ERR ")
@@ -985,6 +1061,35 @@ func rewriteClientCommandVector(c *Client, argc int, argv ...*robj) {
 	}
 }
 
+// rewriteClientCommandArgument 把第i个参数替换成newval，i为0时同时更新c.cmd
+func rewriteClientCommandArgument(c *Client, i int, newval *robj) {
+	if i >= c.argc {
+		argv := make([]*robj, i+1)
+		copy(argv, c.argv[:c.argc])
+		c.argv = argv
+		c.argc = i + 1
+	}
+	oldval := c.argv[i]
+	if oldval != nil {
+		c.argvLenSum -= getStringObjectLen(oldval)
+	}
+	if newval != nil {
+		c.argvLenSum += getStringObjectLen(newval)
+	}
+	c.argv[i] = newval
+	newval.incrRefCount()
+	if oldval != nil {
+		oldval.decrRefCount()
+	}
+
+	if i == 0 {
+		c.cmd = lookupCommandOrOriginal(c.argv[0].ptr)
+		if c.cmd == nil {
+			panic("cmd nil")
+		}
+	}
+}
+
 func getStringObjectLen(o *robj) int {
 	if o.getType() != ObjString {
 		panic(fmt.Sprintf("expect objString(0), but %d", o.getType()))
@@ -1008,7 +1113,7 @@ func trimReplyUnusedTailSpace(c *Client) {
 	ln := c.reply.Last()
 	var tail *clientReplyBlock
 	if ln != nil {
-		tail = ln.NodeValue().(*clientReplyBlock)
+		tail, _ = ln.NodeValue().(*clientReplyBlock)
 	}
 
 	if tail == nil {
@@ -1016,11 +1121,11 @@ func trimReplyUnusedTailSpace(c *Client) {
 	}
 
 	if len(tail.buf)-tail.used > len(tail.buf)/4 && tail.used < PROTO_REPLY_CHUNK_BYTES {
-		oldSize := tail.used
+		oldSize := cap(tail.buf)
 		buf := make([]byte, tail.used)
 		copy(buf, tail.buf)
 		tail.buf = buf
-		c.replyBytes = c.replyBytes + tail.used - oldSize
+		c.replyBytes = c.replyBytes + cap(tail.buf) - oldSize
 	}
 }
 
@@ -1032,9 +1137,32 @@ func setDeferredSetLen(c *Client, node *adlist.ListNode, length int) {
 	setDeferredAggregateLen(c, node, length, prefix)
 }
 
+func setDeferredArrayLen(c *Client, node *adlist.ListNode, length int) {
+	setDeferredAggregateLen(c, node, length, '*')
+}
+
+func setDeferredMapLen(c *Client, node *adlist.ListNode, length int) {
+	prefix := byte('*')
+	if c.resp == 2 {
+		length *= 2
+	} else {
+		prefix = '%'
+	}
+	setDeferredAggregateLen(c, node, length, prefix)
+}
+
 func setDeferredAggregateLen(c *Client, node *adlist.ListNode, length int, prefix byte) {
+	setDeferredReply(c, node, fmt.Sprintf("%c%d\r\n", prefix, length))
+}
+
+// setDeferredReplyBulkCString 把addReplyDeferredLen占的位置填充成一个bulk string
+func setDeferredReplyBulkCString(c *Client, node *adlist.ListNode, s string) {
+	setDeferredReply(c, node, fmt.Sprintf("$%d\r\n%s\r\n", len(s), s))
+}
+
+// setDeferredReply 把addReplyDeferredLen占的位置填充成lenStr
+func setDeferredReply(c *Client, node *adlist.ListNode, lenStr string) {
 	var next *clientReplyBlock
-	lenStr := fmt.Sprintf("%c%d\r\n", prefix, length)
 
 	if node == nil {
 		return
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"testing"
 )
 
@@ -19,3 +20,91 @@ func TestObject(t *testing.T) {
 func change(o *robj) {
 	o.setEncoding(ObjEncodingHt)
 }
+
+func TestObjectCommand(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"set n 100", "+OK"},
+		{"set big 123456789012", "+OK"},
+		{"set s hello", "+OK"},
+		{"append s !", ":6"},
+		{"rpush l a", ":1"},
+		{"sadd si 1", ":1"},
+		{"sadd sl a", ":1"},
+		{"zadd z 1 a", ":1"},
+		{"hset h f v", ":1"},
+		{"xadd x 1-0 f v", "1-0"},
+
+		{"object encoding n", "int"},
+		{"object encoding big", "int"},
+		{"object encoding s", "raw"},
+		{"object encoding l", "quicklist"},
+		{"object encoding si", "intset"},
+		{"object encoding sl", "listpack"},
+		{"object encoding z", "listpack"},
+		{"object encoding h", "listpack"},
+		{"object encoding x", "stream"},
+		{"object encoding nokey", "(nil)"},
+
+		{"object refcount s", ":1"},
+		{"object refcount nokey", "(nil)"},
+		{"object idletime nokey", "(nil)"},
+		{"object freq nokey", "(nil)"},
+		{"object encoding", "-ERR unknown subcommand or wrong number of arguments for 'encoding'. Try OBJECT HELP."},
+		{"object nosuch s", "-ERR unknown subcommand or wrong number of arguments for 'nosuch'. Try OBJECT HELP."},
+	})
+
+	// 共享的小整数
+	if reply := testCommand(c, "object", "refcount", "n"); reply != ":"+strconv.Itoa(ObjSharedRefCount) {
+		t.Fatalf("object refcount n: expect shared refcount, got %q", reply)
+	}
+
+	// OBJECT不会更新key的访问时间
+	o := c.db.lookupKeyRead(createStringObject("s"))
+	o.setLru((LRU_CLOCK() - 10) & LruClockMax)
+	testRun(t, c, []testCase{
+		{"object idletime s", ":10"},
+		{"object idletime s", ":10"},
+		{"object freq s", "-ERR An LFU maxmemory policy is not selected, access frequency not tracked. " +
+			"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust."},
+		{"get s", "hello!"},
+		{"object idletime s", ":0"},
+	})
+}
+
+func TestObjectFreq(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"config set maxmemory-policy allkeys-lfu", "+OK"},
+		{"set k v", "+OK"},
+		{"object freq k", ":5"},
+		{"object freq k", ":5"},
+		{"get k", "v"},
+		{"object freq k", ":6"},
+		{"object idletime k", "-ERR An LFU maxmemory policy is selected, idle time not tracked. " +
+			"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust."},
+		{"config set maxmemory-policy volatile-lfu", "+OK"},
+		{"object freq k", ":6"},
+		{"config set maxmemory-policy nosuchpolicy", "-ERR CONFIG SET failed (possibly related to argument 'maxmemory-policy') - " +
+			"argument(s) must be one of the following: 'volatile-lru', 'volatile-lfu', 'volatile-random', 'volatile-ttl', " +
+			"'allkeys-lru', 'allkeys-lfu', 'allkeys-random', 'noeviction'"},
+		{"config get maxmemory-policy", "[maxmemory-policy volatile-lfu]"},
+	})
+
+	// 按照lfu-decay-time衰减
+	o := c.db.lookupKeyRead(createStringObject("k"))
+	o.setLru(uint32(LFUGetTimeInMinutes()-4)<<8 | 6)
+	testRun(t, c, []testCase{
+		{"config set lfu-decay-time 2", "+OK"},
+		{"object freq k", ":4"},
+		{"config set lfu-decay-time 0", "+OK"},
+		{"object freq k", ":6"},
+		{"config set lfu-decay-time -1", "-ERR CONFIG SET failed (possibly related to argument 'lfu-decay-time') - " +
+			"argument must be between 0 and 2147483647 inclusive"},
+		{"config set lfu-log-factor x", "-ERR CONFIG SET failed (possibly related to argument 'lfu-log-factor') - " +
+			"argument couldn't be parsed into an integer"},
+		{"config get lfu-*", "[lfu-log-factor 10 lfu-decay-time 0]"},
+	})
+}
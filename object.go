@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/pengdafu/redis-golang/dict"
 	"github.com/pengdafu/redis-golang/intset"
+	"github.com/pengdafu/redis-golang/listpack"
+	"github.com/pengdafu/redis-golang/quicklist"
 	"github.com/pengdafu/redis-golang/sds"
 	"github.com/pengdafu/redis-golang/util"
 	"math"
@@ -39,6 +41,7 @@ const (
 	ObjEncodingEmbStr
 	ObjEncodingQuickList
 	ObjEncodingStream // listpack
+	ObjEncodingListPack
 )
 
 const (
@@ -93,7 +96,7 @@ func isSdsRepresentableAsLongLong(s sds.SDS, llval *int64) bool {
 }
 
 type objPtrType interface {
-	sds.SDS | int | int64 | []byte | intset.IntSet | dict.Dict
+	sds.SDS | int | int64 | []byte | intset.IntSet | dict.Dict | zset | quicklist.Quicklist | stream
 }
 
 func createObject[T objPtrType](typ int, ptr T) *robj {
@@ -104,7 +107,7 @@ func createObject[T objPtrType](typ int, ptr T) *robj {
 	o.refCount = 1
 
 	if server.maxMemoryPolicy&MaxMemoryFlagLfu > 0 {
-		o.setLru(uint32(LFUGetTimeInMinutes()<<lruBitOffset | LfuInitVal))
+		o.setLru(uint32(LFUGetTimeInMinutes())<<8 | LfuInitVal)
 	} else {
 		o.setLru(LRU_CLOCK())
 	}
@@ -123,6 +126,13 @@ func createStringObject(ptr string) *robj {
 	}
 }
 
+func createQuicklistObject() *robj {
+	l := quicklist.Create()
+	o := createObject(ObjList, *l)
+	o.setEncoding(ObjEncodingQuickList)
+	return o
+}
+
 func createIntsetObject() *robj {
 	is := intset.New()
 	o := createObject(ObjSet, is)
@@ -130,6 +140,13 @@ func createIntsetObject() *robj {
 	return o
 }
 
+func createSetListpackObject() *robj {
+	lp := listpack.New()
+	o := createObject(ObjSet, lp)
+	o.setEncoding(ObjEncodingListPack)
+	return o
+}
+
 func createSetObject() *robj {
 	dt := dict.Create(setDictType, nil)
 	o := createObject(ObjSet, *dt)
@@ -137,6 +154,30 @@ func createSetObject() *robj {
 	return o
 }
 
+func createZsetObject() *robj {
+	zs := zset{
+		dict: dict.Create(zsetDictType, nil),
+		zsl:  zslCreate(),
+	}
+	o := createObject(ObjZSet, zs)
+	o.setEncoding(ObjEncodingSkipList)
+	return o
+}
+
+func createZsetListpackObject() *robj {
+	zl := listpack.New()
+	o := createObject(ObjZSet, zl)
+	o.setEncoding(ObjEncodingListPack)
+	return o
+}
+
+func createStreamObject() *robj {
+	s := stream{rax: raxNew()}
+	o := createObject(ObjStream, s)
+	o.setEncoding(ObjEncodingStream)
+	return o
+}
+
 // 说明长度肯定小于等于44
 func createEmbeddedStringObject(ptr []byte) *robj {
 	/**
@@ -170,6 +211,11 @@ func createStringObjectFromLongLongWithOptions(v int64, vobj int) *robj {
 	}
 }
 
+// createStringObjectFromLongDouble 用long double创建字符串对象，humanfriendly参考util.LD2String
+func createStringObjectFromLongDouble(value float64, humanfriendly bool) *robj {
+	return createStringObject(util.LD2String(value, humanfriendly))
+}
+
 func (o *robj) sdsEncodedObject() bool {
 	ed := o.getEncoding()
 	return ed == ObjEncodingRaw || ed == ObjEncodingEmbStr
@@ -203,6 +249,26 @@ func (o *robj) incrRefCount() {
 	}
 }
 
+// dupStringObject 复制一个字符串对象，新对象的编码和原对象相同，并且不是共享的
+func (o *robj) dupStringObject() *robj {
+	if o.getType() != ObjString {
+		panic("dupStringObject against non string object")
+	}
+	switch o.getEncoding() {
+	case ObjEncodingRaw:
+		return createRawStringObject((*sds.SDS)(o.ptr).BufData(0))
+	case ObjEncodingEmbStr:
+		return createEmbeddedStringObject((*sds.SDS)(o.ptr).BufData(0))
+	case ObjEncodingInt:
+		v := *(*int64)(o.ptr)
+		d := createObject(ObjString, v)
+		d.setEncoding(ObjEncodingInt)
+		return d
+	default:
+		panic("Wrong encoding.")
+	}
+}
+
 func (o *robj) getDecodedObject() *robj {
 	if o.sdsEncodedObject() {
 		o.incrRefCount()
@@ -299,6 +365,61 @@ func (o *robj) getLongLongFromObject(target *int64) error {
 	return C_OK
 }
 
+func (o *robj) getRangeLongFromObjectOrReply(c *Client, min, max int64, target *int64, msg string) error {
+	if o.getLongLongFromObjectOrReply(c, target, msg) != C_OK {
+		return C_ERR
+	}
+	if *target < min || *target > max {
+		if msg != "" {
+			addReplyError(c, msg)
+		} else {
+			addReplyErrorFormat(c, "value is out of range, value must between %d and %d", min, max)
+		}
+		return C_ERR
+	}
+	return C_OK
+}
+
+func (o *robj) getPositiveLongFromObjectOrReply(c *Client, target *int64, msg string) error {
+	if msg == "" {
+		msg = "value is out of range, must be positive"
+	}
+	return o.getRangeLongFromObjectOrReply(c, 0, math.MaxInt64, target, msg)
+}
+
+func (o *robj) getDoubleFromObjectOrReply(c *Client, target *float64, msg string) error {
+	var value float64
+	if o.getDoubleFromObject(&value) != C_OK {
+		if msg != "" {
+			addReplyError(c, msg)
+		} else {
+			addReplyError(c, "value is not a valid float")
+		}
+		return C_ERR
+	}
+	*target = value
+	return C_OK
+}
+
+func (o *robj) getDoubleFromObject(target *float64) error {
+	var value float64
+	if o == nil {
+		value = 0
+	} else {
+		if o.sdsEncodedObject() {
+			if !util.String2D((*sds.SDS)(o.ptr).BufData(0), &value) {
+				return C_ERR
+			}
+		} else if o.getEncoding() == ObjEncodingInt {
+			value = float64(*(*int)(o.ptr))
+		} else {
+			panic("Unknown string encoding")
+		}
+	}
+	*target = value
+	return C_OK
+}
+
 func (o *robj) stringObjectLen() int {
 	if o.getType() != ObjString {
 		panic("not string obj")
@@ -317,3 +438,109 @@ func (o *robj) checkType(c *Client, typ int) bool {
 	}
 	return false
 }
+
+// strEncoding 返回OBJECT ENCODING使用的编码名称
+func strEncoding(encoding uint32) string {
+	switch encoding {
+	case ObjEncodingRaw:
+		return "raw"
+	case ObjEncodingInt:
+		return "int"
+	case ObjEncodingHt:
+		return "hashtable"
+	case ObjEncodingQuickList:
+		return "quicklist"
+	case ObjEncodingListPack:
+		return "listpack"
+	case ObjEncodingZipList:
+		return "ziplist"
+	case ObjEncodingIntSet:
+		return "intset"
+	case ObjEncodingSkipList:
+		return "skiplist"
+	case ObjEncodingEmbStr:
+		return "embstr"
+	case ObjEncodingStream:
+		return "stream"
+	default:
+		return "unknown"
+	}
+}
+
+// estimateObjectIdleTime 根据LRU时钟估算对象有多少毫秒没有被访问，LRU时钟只有24位，需要处理回绕
+func estimateObjectIdleTime(o *robj) int64 {
+	lruclock := LRU_CLOCK()
+	if lruclock >= o.getLru() {
+		return int64(lruclock-o.getLru()) * LruClockResolution
+	}
+	return int64(lruclock+(LruClockMax-o.getLru())) * LruClockResolution
+}
+
+// objectCommandLookup 查找key，不会更新key的访问时间，也不会触发keyspace通知
+func objectCommandLookup(c *Client, key *robj) *robj {
+	return c.db.lookupKeyReadWithFlags(key, lookupNoTouch|lookupNoNotify)
+}
+
+func objectCommandLookupOrReply(c *Client, key, reply *robj) *robj {
+	o := objectCommandLookup(c, key)
+	if o == nil {
+		addReply(c, reply)
+	}
+	return o
+}
+
+// OBJECT <subcommand> key
+func objectCommand(c *Client) {
+	opt := (*sds.SDS)(c.argv[1].ptr).BufData(0)
+	if c.argc == 2 && util.StrCaseCmp(opt, "help") {
+		addReplyHelp(c, []string{
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"FREQ <key>",
+			"    Return the access frequency index of the <key>. The returned integer is",
+			"    proportional to the logarithm of the recent access frequency of the key.",
+			"IDLETIME <key>",
+			"    Return the idle time of the <key>, that is the approximated number of",
+			"    seconds elapsed since the last access to the key.",
+			"REFCOUNT <key>",
+			"    Return the number of references of the value associated with the specified",
+			"    <key>.",
+		})
+	} else if util.StrCaseCmp(opt, "encoding") && c.argc == 3 {
+		o := objectCommandLookupOrReply(c, c.argv[2], shared.null[c.resp])
+		if o == nil {
+			return
+		}
+		addReplyBulkCString(c, strEncoding(o.getEncoding()))
+	} else if util.StrCaseCmp(opt, "refcount") && c.argc == 3 {
+		o := objectCommandLookupOrReply(c, c.argv[2], shared.null[c.resp])
+		if o == nil {
+			return
+		}
+		addReplyLongLong(c, o.refCount)
+	} else if util.StrCaseCmp(opt, "idletime") && c.argc == 3 {
+		o := objectCommandLookupOrReply(c, c.argv[2], shared.null[c.resp])
+		if o == nil {
+			return
+		}
+		if server.maxMemoryPolicy&MaxMemoryFlagLfu > 0 {
+			addReplyError(c, "An LFU maxmemory policy is selected, idle time not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+			return
+		}
+		addReplyLongLong(c, int(estimateObjectIdleTime(o)/1000))
+	} else if util.StrCaseCmp(opt, "freq") && c.argc == 3 {
+		o := objectCommandLookupOrReply(c, c.argv[2], shared.null[c.resp])
+		if o == nil {
+			return
+		}
+		if server.maxMemoryPolicy&MaxMemoryFlagLfu == 0 {
+			addReplyError(c, "An LFU maxmemory policy is not selected, access frequency not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+			return
+		}
+		// 只返回衰减之后的计数，不会更新对象的LFU数据
+		addReplyLongLong(c, int(LFUDecrAndReturn(o)))
+	} else {
+		addReplySubcommandSyntaxError(c)
+	}
+}
@@ -0,0 +1,913 @@
+// Package quicklist 实现了list类型的底层编码：一个由ziplist节点组成的双向链表，
+// 每个节点能保存的元素数量或者字节数由fill决定，两端compress个节点以外的节点会用lzf压缩
+package quicklist
+
+import (
+	"github.com/pengdafu/redis-golang/adlist"
+	"github.com/pengdafu/redis-golang/lzf"
+	"github.com/pengdafu/redis-golang/ziplist"
+)
+
+const (
+	// Head 和 Tail 表示push和pop的位置
+	Head = 0
+	Tail = -1
+)
+
+const (
+	// StartHead 表示迭代器从头向尾遍历，StartTail 表示从尾向头遍历
+	StartHead = 0
+	StartTail = 1
+)
+
+const (
+	nodeEncodingRaw = 1
+	nodeEncodingLZF = 2
+)
+
+const (
+	fillMax     = 1<<15 - 1
+	compressMax = 1<<16 - 1
+
+	// 节点小于这个字节数时不压缩
+	minCompressBytes = 48
+	// 压缩后至少要节省这么多字节才保存压缩后的数据
+	minCompressImprove = 8
+
+	// fill为正数时，节点的字节数仍然不能超过这个限制
+	sizeSafetyLimit = 8192
+)
+
+// fill为负数时，-1到-5分别对应节点最大4kb到64kb
+var optimizationLevel = [...]int{4096, 8192, 16384, 32768, 65536}
+
+type node struct {
+	zl         []byte // 未压缩时的ziplist
+	compressed []byte // lzf压缩后的数据
+	sz         int    // 未压缩时ziplist的字节数
+	count      int    // ziplist中元素的数量
+
+	encoding   int
+	recompress bool // 为了使用而临时解压的节点，使用完需要重新压缩
+}
+
+type Quicklist struct {
+	nodes    *adlist.List // 节点的值是*node
+	count    int          // 所有ziplist中元素的总数
+	fill     int
+	compress int // 两端不压缩的节点数量，0表示不压缩
+}
+
+// Entry 表示quicklist中的一个元素，Value为nil时元素是整数，保存在Longval中
+type Entry struct {
+	quicklist *Quicklist
+	node      *adlist.ListNode
+	zi        []byte
+	Value     []byte
+	Longval   int64
+	offset    int
+}
+
+type Iter struct {
+	quicklist *Quicklist
+	current   *adlist.ListNode
+	zi        []byte
+	offset    int // current节点中的偏移量
+	direction int
+}
+
+func Create() *Quicklist {
+	return &Quicklist{
+		nodes: adlist.Create(),
+		fill:  -2,
+	}
+}
+
+func New(fill, compress int) *Quicklist {
+	ql := Create()
+	ql.SetOptions(fill, compress)
+	return ql
+}
+
+func (ql *Quicklist) SetCompressDepth(compress int) {
+	if compress > compressMax {
+		compress = compressMax
+	} else if compress < 0 {
+		compress = 0
+	}
+	ql.compress = compress
+}
+
+func (ql *Quicklist) SetFill(fill int) {
+	if fill > fillMax {
+		fill = fillMax
+	} else if fill < -len(optimizationLevel) {
+		fill = -len(optimizationLevel)
+	}
+	ql.fill = fill
+}
+
+func (ql *Quicklist) SetOptions(fill, compress int) {
+	ql.SetFill(fill)
+	ql.SetCompressDepth(compress)
+}
+
+// Count 返回元素的数量
+func (ql *Quicklist) Count() int {
+	return ql.count
+}
+
+// Len 返回节点的数量
+func (ql *Quicklist) Len() int {
+	return ql.nodes.Len()
+}
+
+func nodeOf(ln *adlist.ListNode) *node {
+	return ln.NodeValue().(*node)
+}
+
+func createNode() *node {
+	return &node{
+		encoding: nodeEncodingRaw,
+	}
+}
+
+func (n *node) updateSz() {
+	n.sz = len(n.zl)
+}
+
+/*-----------------------------------------------------------------------------
+ * 压缩
+ *----------------------------------------------------------------------------*/
+
+// compressNode 压缩节点，压缩失败或者收益太小时返回false
+func compressNode(n *node) bool {
+	if n.encoding != nodeEncodingRaw {
+		return false
+	}
+	// 之前被解压过的节点，即使压缩失败也不需要再标记了
+	n.recompress = false
+
+	if n.sz < minCompressBytes {
+		return false
+	}
+
+	out := make([]byte, n.sz)
+	sz := lzf.Compress(n.zl, out)
+	if sz == 0 || sz+minCompressImprove >= n.sz {
+		return false
+	}
+
+	n.compressed = out[:sz]
+	n.zl = nil
+	n.encoding = nodeEncodingLZF
+	return true
+}
+
+func decompressNode(n *node) bool {
+	if n.encoding != nodeEncodingLZF {
+		return false
+	}
+
+	zl := make([]byte, n.sz)
+	if lzf.Decompress(n.compressed, zl) == 0 {
+		panic("quicklist: lzf decompress failed")
+	}
+	n.zl = zl
+	n.compressed = nil
+	n.encoding = nodeEncodingRaw
+	return true
+}
+
+// decompressNodeForUse 临时解压节点，使用完后通过recompressOnly重新压缩
+func decompressNodeForUse(n *node) {
+	if decompressNode(n) {
+		n.recompress = true
+	}
+}
+
+func (ql *Quicklist) recompressOnly(n *node) {
+	if n.recompress {
+		compressNode(n)
+	}
+}
+
+// __compress 保证两端compress个节点处于未压缩的状态，并尝试压缩ln
+func (ql *Quicklist) __compress(ln *adlist.ListNode) {
+	// 节点数量太少时不压缩任何节点
+	if ql.compress == 0 || ql.nodes.Len() < ql.compress*2 {
+		return
+	}
+
+	forward := ql.nodes.First()
+	reverse := ql.nodes.Last()
+	depth := 0
+	inDepth := false
+	for depth < ql.compress {
+		depth++
+		// 深度范围以内的节点必须保持未压缩，也不能再被重新压缩
+		for _, n := range [...]*node{nodeOf(forward), nodeOf(reverse)} {
+			decompressNode(n)
+			n.recompress = false
+		}
+
+		if forward == ln || reverse == ln {
+			inDepth = true
+		}
+
+		// 两边已经相遇，没有需要压缩的节点
+		if forward == reverse || forward.Next() == reverse {
+			return
+		}
+
+		forward = forward.Next()
+		reverse = reverse.Prev()
+	}
+
+	if !inDepth && ln != nil {
+		compressNode(nodeOf(ln))
+	}
+
+	// forward和reverse是深度范围以外的第一个节点
+	compressNode(nodeOf(forward))
+	compressNode(nodeOf(reverse))
+}
+
+func (ql *Quicklist) compressNode(ln *adlist.ListNode) {
+	if n := nodeOf(ln); n.recompress {
+		compressNode(n)
+	} else {
+		ql.__compress(ln)
+	}
+}
+
+/*-----------------------------------------------------------------------------
+ * 节点管理
+ *----------------------------------------------------------------------------*/
+
+// insertNode 在oldNode之后或者之前插入新节点，返回新节点，oldNode为nil时quicklist必须为空
+func (ql *Quicklist) insertNode(oldNode *adlist.ListNode, n *node, after bool) *adlist.ListNode {
+	var ln *adlist.ListNode
+	if oldNode == nil {
+		ql.nodes.AddNodeHead(n)
+		ln = ql.nodes.First()
+	} else {
+		ql.nodes.InsertNode(oldNode, n, after)
+		if after {
+			ln = oldNode.Next()
+		} else {
+			ln = oldNode.Prev()
+		}
+	}
+
+	if oldNode != nil {
+		ql.compressNode(oldNode)
+	}
+	return ln
+}
+
+func (ql *Quicklist) delNode(ln *adlist.ListNode) {
+	ql.nodes.DelNode(ln)
+	ql.count -= nodeOf(ln).count
+
+	// 删除的节点可能在压缩深度以内，需要解压其他节点
+	ql.__compress(nil)
+}
+
+// delIndex 删除ln中p指向的元素，节点被删除时返回true，否则p指向下一个元素
+func (ql *Quicklist) delIndex(ln *adlist.ListNode, p *[]byte) bool {
+	n := nodeOf(ln)
+	n.zl = ziplist.Delete(n.zl, p)
+	n.count--
+	ql.count--
+
+	if n.count == 0 {
+		ql.nodes.DelNode(ln)
+		ql.__compress(nil)
+		return true
+	}
+	n.updateSz()
+	return false
+}
+
+func nodeSizeMeetsOptimizationRequirement(sz, fill int) bool {
+	if fill >= 0 {
+		return false
+	}
+
+	offset := -fill - 1
+	if offset < len(optimizationLevel) {
+		return sz <= optimizationLevel[offset]
+	}
+	return false
+}
+
+// nodeAllowInsert 判断节点是否还能再插入一个sz字节的元素
+func nodeAllowInsert(ln *adlist.ListNode, fill, sz int) bool {
+	if ln == nil {
+		return false
+	}
+	n := nodeOf(ln)
+
+	// prevlen占用的字节
+	ziplistOverhead := 5
+	if sz < 254 {
+		ziplistOverhead = 1
+	}
+
+	// encoding占用的字节
+	if sz < 64 {
+		ziplistOverhead += 1
+	} else if sz < 16384 {
+		ziplistOverhead += 2
+	} else {
+		ziplistOverhead += 5
+	}
+
+	// 元素是整数时会高估
+	newSz := n.sz + sz + ziplistOverhead
+	if nodeSizeMeetsOptimizationRequirement(newSz, fill) {
+		return true
+	} else if newSz > sizeSafetyLimit {
+		return false
+	}
+	return n.count < fill
+}
+
+func nodeAllowMerge(a, b *adlist.ListNode, fill int) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	na, nb := nodeOf(a), nodeOf(b)
+
+	// 合并后少了一个ziplist的头部和结束标记
+	mergeSz := na.sz + nb.sz - int(ziplist.HeaderSize+ziplist.EndSize)
+	if nodeSizeMeetsOptimizationRequirement(mergeSz, fill) {
+		return true
+	} else if mergeSz > sizeSafetyLimit {
+		return false
+	}
+	return na.count+nb.count <= fill
+}
+
+/*-----------------------------------------------------------------------------
+ * 插入
+ *----------------------------------------------------------------------------*/
+
+// PushHead 在头部插入元素，创建了新的头节点时返回true
+func (ql *Quicklist) PushHead(value []byte) bool {
+	origHead := ql.nodes.First()
+	if nodeAllowInsert(origHead, ql.fill, len(value)) {
+		n := nodeOf(origHead)
+		n.zl = ziplist.Push(n.zl, value, ziplist.Head)
+		n.updateSz()
+	} else {
+		n := createNode()
+		n.zl = ziplist.Push(ziplist.New(), value, ziplist.Head)
+		n.updateSz()
+		if origHead == nil {
+			ql.insertNode(nil, n, false)
+		} else {
+			ql.insertNode(origHead, n, false)
+		}
+	}
+	ql.count++
+	nodeOf(ql.nodes.First()).count++
+	return origHead != ql.nodes.First()
+}
+
+// PushTail 在尾部插入元素，创建了新的尾节点时返回true
+func (ql *Quicklist) PushTail(value []byte) bool {
+	origTail := ql.nodes.Last()
+	if nodeAllowInsert(origTail, ql.fill, len(value)) {
+		n := nodeOf(origTail)
+		n.zl = ziplist.Push(n.zl, value, ziplist.Tail)
+		n.updateSz()
+	} else {
+		n := createNode()
+		n.zl = ziplist.Push(ziplist.New(), value, ziplist.Tail)
+		n.updateSz()
+		if origTail == nil {
+			ql.insertNode(nil, n, true)
+		} else {
+			ql.insertNode(origTail, n, true)
+		}
+	}
+	ql.count++
+	nodeOf(ql.nodes.Last()).count++
+	return origTail != ql.nodes.Last()
+}
+
+// Push 在where(Head或Tail)插入元素
+func (ql *Quicklist) Push(value []byte, where int) {
+	if where == Head {
+		ql.PushHead(value)
+	} else if where == Tail {
+		ql.PushTail(value)
+	}
+}
+
+// splitNode 把ln从offset处分成两个节点，after为true时新节点包含offset之后的元素，
+// 否则包含offset及之前的元素。返回的新节点还没有加入quicklist
+func splitNode(ln *adlist.ListNode, offset int, after bool) *node {
+	n := nodeOf(ln)
+	newNode := createNode()
+	newNode.zl = make([]byte, len(n.zl))
+	copy(newNode.zl, n.zl)
+
+	count := n.count
+	var origStart, origExtent, newStart, newExtent int
+	if after {
+		origStart, origExtent = offset+1, count-offset-1
+		newStart, newExtent = 0, offset+1
+	} else {
+		origStart, origExtent = 0, offset
+		newStart, newExtent = offset, count-offset
+	}
+
+	n.zl = ziplist.DeleteRange(n.zl, origStart, origExtent)
+	n.count = ziplist.Len(n.zl)
+	n.updateSz()
+
+	newNode.zl = ziplist.DeleteRange(newNode.zl, newStart, newExtent)
+	newNode.count = ziplist.Len(newNode.zl)
+	newNode.updateSz()
+
+	return newNode
+}
+
+// ziplistMerge 把b合并到a中并删除b，返回合并后的节点
+func (ql *Quicklist) ziplistMerge(a, b *adlist.ListNode) *adlist.ListNode {
+	na, nb := nodeOf(a), nodeOf(b)
+	decompressNode(na)
+	decompressNode(nb)
+
+	na.zl = ziplist.Merge(na.zl, nb.zl)
+	na.count = ziplist.Len(na.zl)
+	na.updateSz()
+
+	nb.count = 0
+	ql.delNode(b)
+	ql.compressNode(a)
+	return a
+}
+
+// mergeNodes 尝试合并center周围的节点：
+//   - (center.prev.prev, center.prev)
+//   - (center.next, center.next.next)
+//   - (center.prev, center)
+//   - (center, center.next)
+func (ql *Quicklist) mergeNodes(center *adlist.ListNode) {
+	fill := ql.fill
+	var prev, prevPrev, next, nextNext *adlist.ListNode
+
+	if prev = center.Prev(); prev != nil {
+		prevPrev = prev.Prev()
+	}
+	if next = center.Next(); next != nil {
+		nextNext = next.Next()
+	}
+
+	if nodeAllowMerge(prevPrev, prev, fill) {
+		ql.ziplistMerge(prevPrev, prev)
+	}
+
+	if nodeAllowMerge(next, nextNext, fill) {
+		ql.ziplistMerge(next, nextNext)
+	}
+
+	var target *adlist.ListNode
+	if nodeAllowMerge(center.Prev(), center, fill) {
+		target = ql.ziplistMerge(center.Prev(), center)
+	} else {
+		target = center
+	}
+
+	if nodeAllowMerge(target, target.Next(), fill) {
+		ql.ziplistMerge(target, target.Next())
+	}
+}
+
+// insert 在entry之前或者之后插入元素，节点满了时会尝试放到相邻节点，
+// 相邻节点也满了就创建新节点或者拆分当前节点
+func (ql *Quicklist) insert(entry *Entry, value []byte, after bool) {
+	fill := ql.fill
+	ln := entry.node
+	sz := len(value)
+
+	if ln == nil {
+		// 没有参照的节点，创建唯一的节点
+		n := createNode()
+		n.zl = ziplist.Push(ziplist.New(), value, ziplist.Head)
+		n.count++
+		n.updateSz()
+		ql.insertNode(nil, n, after)
+		ql.count++
+		return
+	}
+
+	n := nodeOf(ln)
+	offset := entry.offset
+	if offset < 0 {
+		offset += n.count
+	}
+
+	var full, atTail, atHead, fullNext, fullPrev bool
+	if !nodeAllowInsert(ln, fill, sz) {
+		full = true
+	}
+	if after && offset == n.count-1 {
+		atTail = true
+		if !nodeAllowInsert(ln.Next(), fill, sz) {
+			fullNext = true
+		}
+	}
+	if !after && offset == 0 {
+		atHead = true
+		if !nodeAllowInsert(ln.Prev(), fill, sz) {
+			fullPrev = true
+		}
+	}
+
+	if !full && after {
+		decompressNodeForUse(n)
+		zi := ziplist.Index(n.zl, offset)
+		if next := ziplist.Next(n.zl, zi); next == nil {
+			n.zl = ziplist.Push(n.zl, value, ziplist.Tail)
+		} else {
+			n.zl = ziplist.Insert(n.zl, next, value)
+		}
+		n.count++
+		n.updateSz()
+		ql.recompressOnly(n)
+	} else if !full && !after {
+		decompressNodeForUse(n)
+		n.zl = ziplist.Insert(n.zl, ziplist.Index(n.zl, offset), value)
+		n.count++
+		n.updateSz()
+		ql.recompressOnly(n)
+	} else if full && atTail && ln.Next() != nil && !fullNext && after {
+		// 插入到下一个节点的头部
+		nn := nodeOf(ln.Next())
+		decompressNodeForUse(nn)
+		nn.zl = ziplist.Push(nn.zl, value, ziplist.Head)
+		nn.count++
+		nn.updateSz()
+		ql.recompressOnly(nn)
+	} else if full && atHead && ln.Prev() != nil && !fullPrev && !after {
+		// 插入到上一个节点的尾部
+		pn := nodeOf(ln.Prev())
+		decompressNodeForUse(pn)
+		pn.zl = ziplist.Push(pn.zl, value, ziplist.Tail)
+		pn.count++
+		pn.updateSz()
+		ql.recompressOnly(pn)
+	} else if full && ((atTail && ln.Next() != nil && fullNext && after) ||
+		(atHead && ln.Prev() != nil && fullPrev && !after)) {
+		// 相邻节点也满了，创建一个新节点
+		newNode := createNode()
+		newNode.zl = ziplist.Push(ziplist.New(), value, ziplist.Head)
+		newNode.count++
+		newNode.updateSz()
+		ql.insertNode(ln, newNode, after)
+	} else if full {
+		// 拆分当前节点
+		decompressNodeForUse(n)
+		newNode := splitNode(ln, offset, after)
+		if after {
+			newNode.zl = ziplist.Push(newNode.zl, value, ziplist.Head)
+		} else {
+			newNode.zl = ziplist.Push(newNode.zl, value, ziplist.Tail)
+		}
+		newNode.count++
+		newNode.updateSz()
+		ql.insertNode(ln, newNode, after)
+		ql.mergeNodes(ln)
+	}
+
+	ql.count++
+}
+
+func (ql *Quicklist) InsertBefore(entry *Entry, value []byte) {
+	ql.insert(entry, value, false)
+}
+
+func (ql *Quicklist) InsertAfter(entry *Entry, value []byte) {
+	ql.insert(entry, value, true)
+}
+
+/*-----------------------------------------------------------------------------
+ * 删除和替换
+ *----------------------------------------------------------------------------*/
+
+// DelEntry 删除迭代器当前返回的元素，之后可以继续调用Next
+func (iter *Iter) DelEntry(entry *Entry) {
+	prev := entry.node.Prev()
+	next := entry.node.Next()
+	deletedNode := entry.quicklist.delIndex(entry.node, &entry.zi)
+
+	// 删除后zi已经失效了
+	iter.zi = nil
+
+	// 当前节点被删除时，需要移动到下一个节点，否则offset保持不变就是下一个元素
+	if deletedNode {
+		if iter.direction == StartHead {
+			iter.current = next
+			iter.offset = 0
+		} else if iter.direction == StartTail {
+			iter.current = prev
+			iter.offset = -1
+		}
+	}
+}
+
+// ReplaceAtIndex 把index处的元素替换成value，index不存在时返回false
+func (ql *Quicklist) ReplaceAtIndex(index int, value []byte) bool {
+	var entry Entry
+	if ql.Index(index, &entry) {
+		n := nodeOf(entry.node)
+		n.zl = ziplist.Replace(n.zl, entry.zi, value)
+		n.updateSz()
+		ql.compressNode(entry.node)
+		return true
+	}
+	return false
+}
+
+// DelRange 从start开始删除count个元素，start可以是负数
+func (ql *Quicklist) DelRange(start, count int) bool {
+	if count <= 0 {
+		return false
+	}
+
+	extent := count
+	if start >= 0 && extent > ql.count-start {
+		// 删除的数量超过了剩余的元素
+		extent = ql.count - start
+	} else if start < 0 && extent > -start {
+		extent = -start
+	}
+
+	var entry Entry
+	if !ql.Index(start, &entry) {
+		return false
+	}
+
+	ln := entry.node
+	for extent > 0 && ln != nil {
+		next := ln.Next()
+		n := nodeOf(ln)
+
+		var del int
+		deleteEntireNode := false
+		if entry.offset == 0 && extent >= n.count {
+			deleteEntireNode = true
+			del = n.count
+		} else if entry.offset >= 0 && extent+entry.offset >= n.count {
+			del = n.count - entry.offset
+		} else if entry.offset < 0 {
+			// 负数的offset只会出现在第一个节点，表示一直删除到这个节点的结尾
+			del = -entry.offset
+			if del > extent {
+				del = extent
+			}
+		} else {
+			del = extent
+		}
+
+		if deleteEntireNode {
+			ql.delNode(ln)
+		} else {
+			decompressNodeForUse(n)
+			n.zl = ziplist.DeleteRange(n.zl, entry.offset, del)
+			n.updateSz()
+			n.count -= del
+			ql.count -= del
+			if n.count == 0 {
+				ql.delNode(ln)
+			} else {
+				ql.recompressOnly(n)
+			}
+		}
+
+		extent -= del
+		ln = next
+		entry.offset = 0
+	}
+	return true
+}
+
+// Pop 从where(Head或Tail)弹出一个元素，字符串保存在data中(复制)，整数保存在sval中
+func (ql *Quicklist) Pop(where int, data *[]byte, sval *int64) bool {
+	if ql.count == 0 {
+		return false
+	}
+
+	if data != nil {
+		*data = nil
+	}
+	if sval != nil {
+		*sval = -123456789
+	}
+
+	var ln *adlist.ListNode
+	pos := 0
+	if where == Head {
+		ln = ql.nodes.First()
+	} else if where == Tail {
+		ln = ql.nodes.Last()
+		pos = -1
+	}
+	if ln == nil {
+		return false
+	}
+
+	n := nodeOf(ln)
+	p := ziplist.Index(n.zl, pos)
+
+	var vstr []byte
+	var vlen int
+	var vlong int64
+	if !ziplist.Get(p, &vstr, &vlen, &vlong) {
+		return false
+	}
+	if vstr != nil {
+		if data != nil {
+			// 空字符串也要返回非nil的切片，调用者用data是否为nil区分字符串和整数
+			*data = make([]byte, len(vstr))
+			copy(*data, vstr)
+		}
+	} else if sval != nil {
+		*sval = vlong
+	}
+	ql.delIndex(ln, &p)
+	return true
+}
+
+/*-----------------------------------------------------------------------------
+ * 查找和遍历
+ *----------------------------------------------------------------------------*/
+
+// GetIterator 返回一个迭代器，direction是StartHead或者StartTail
+func (ql *Quicklist) GetIterator(direction int) *Iter {
+	iter := &Iter{
+		quicklist: ql,
+		direction: direction,
+	}
+	if direction == StartHead {
+		iter.current = ql.nodes.First()
+		iter.offset = 0
+	} else if direction == StartTail {
+		iter.current = ql.nodes.Last()
+		iter.offset = -1
+	}
+	return iter
+}
+
+// GetIteratorAtIdx 返回从idx开始遍历的迭代器，idx不存在时返回nil
+func (ql *Quicklist) GetIteratorAtIdx(direction int, idx int) *Iter {
+	var entry Entry
+	if ql.Index(idx, &entry) {
+		iter := ql.GetIterator(direction)
+		iter.current = entry.node
+		iter.offset = entry.offset
+		return iter
+	}
+	return nil
+}
+
+// Release 释放迭代器，重新压缩当前节点
+func (iter *Iter) Release() {
+	if iter != nil && iter.current != nil {
+		iter.quicklist.compressNode(iter.current)
+	}
+}
+
+// Next 把下一个元素保存到entry中，没有更多元素时返回false
+func (iter *Iter) Next(entry *Entry) bool {
+	*entry = Entry{}
+	if iter == nil {
+		return false
+	}
+
+	entry.quicklist = iter.quicklist
+	for iter.current != nil {
+		entry.node = iter.current
+		n := nodeOf(iter.current)
+
+		if iter.zi == nil {
+			// 使用offset定位
+			decompressNodeForUse(n)
+			iter.zi = ziplist.Index(n.zl, iter.offset)
+		} else if iter.direction == StartHead {
+			iter.zi = ziplist.Next(n.zl, iter.zi)
+			iter.offset++
+		} else if iter.direction == StartTail {
+			iter.zi = ziplist.Prev(n.zl, iter.zi)
+			iter.offset--
+		}
+
+		entry.zi = iter.zi
+		entry.offset = iter.offset
+
+		if iter.zi != nil {
+			var vlen int
+			ziplist.Get(entry.zi, &entry.Value, &vlen, &entry.Longval)
+			return true
+		}
+
+		// 当前节点遍历完了，移动到下一个节点
+		iter.quicklist.compressNode(iter.current)
+		if iter.direction == StartHead {
+			iter.current = iter.current.Next()
+			iter.offset = 0
+		} else if iter.direction == StartTail {
+			iter.current = iter.current.Prev()
+			iter.offset = -1
+		}
+		iter.zi = nil
+	}
+	entry.node = nil
+	return false
+}
+
+// Index 查找idx处的元素，idx为负数时从尾部开始计算，找到时返回true
+func (ql *Quicklist) Index(idx int, entry *Entry) bool {
+	*entry = Entry{quicklist: ql}
+
+	forward := idx >= 0
+	var index int
+	var ln *adlist.ListNode
+	if forward {
+		index = idx
+		ln = ql.nodes.First()
+	} else {
+		index = -idx - 1
+		ln = ql.nodes.Last()
+	}
+
+	if index >= ql.count {
+		return false
+	}
+
+	accum := 0
+	for ln != nil {
+		n := nodeOf(ln)
+		if accum+n.count > index {
+			break
+		}
+		accum += n.count
+		if forward {
+			ln = ln.Next()
+		} else {
+			ln = ln.Prev()
+		}
+	}
+	if ln == nil {
+		return false
+	}
+
+	entry.node = ln
+	if forward {
+		entry.offset = index - accum
+	} else {
+		entry.offset = -index - 1 + accum
+	}
+
+	n := nodeOf(ln)
+	decompressNodeForUse(n)
+	entry.zi = ziplist.Index(n.zl, entry.offset)
+	var vlen int
+	if !ziplist.Get(entry.zi, &entry.Value, &vlen, &entry.Longval) {
+		panic("quicklist: index entry not found")
+	}
+	return true
+}
+
+// Compare 判断entry的值是否等于s
+func (entry *Entry) Compare(s []byte) bool {
+	return ziplist.Compare(entry.zi, s)
+}
+
+// Dup 复制一个quicklist
+func (ql *Quicklist) Dup() *Quicklist {
+	copyQl := New(ql.fill, ql.compress)
+
+	for ln := ql.nodes.First(); ln != nil; ln = ln.Next() {
+		n := nodeOf(ln)
+		newNode := &node{
+			sz:       n.sz,
+			count:    n.count,
+			encoding: n.encoding,
+		}
+		if n.encoding == nodeEncodingLZF {
+			newNode.compressed = append([]byte(nil), n.compressed...)
+		} else {
+			newNode.zl = append([]byte(nil), n.zl...)
+		}
+		copyQl.nodes.AddNodeTail(newNode)
+	}
+
+	copyQl.count = ql.count
+	return copyQl
+}
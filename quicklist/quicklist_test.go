@@ -0,0 +1,202 @@
+package quicklist
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func entryValue(e *Entry) string {
+	if e.Value != nil {
+		return string(e.Value)
+	}
+	return strconv.FormatInt(e.Longval, 10)
+}
+
+func checkList(t *testing.T, ql *Quicklist, expect []string) {
+	t.Helper()
+	if ql.Count() != len(expect) {
+		t.Fatalf("count: expect %d, got %d", len(expect), ql.Count())
+	}
+
+	var entry Entry
+	iter := ql.GetIterator(StartHead)
+	i := 0
+	for iter.Next(&entry) {
+		if i >= len(expect) || entryValue(&entry) != expect[i] {
+			t.Fatalf("index %d: expect %v, got %s", i, expect, entryValue(&entry))
+		}
+		i++
+	}
+	iter.Release()
+	if i != len(expect) {
+		t.Fatalf("iterated %d elements, expect %d", i, len(expect))
+	}
+
+	iter = ql.GetIterator(StartTail)
+	for iter.Next(&entry) {
+		i--
+		if entryValue(&entry) != expect[i] {
+			t.Fatalf("reverse index %d: expect %s, got %s", i, expect[i], entryValue(&entry))
+		}
+	}
+	iter.Release()
+
+	total := 0
+	for ln := ql.nodes.First(); ln != nil; ln = ln.Next() {
+		total += nodeOf(ln).count
+	}
+	if total != ql.Count() {
+		t.Fatalf("node count sum %d != count %d", total, ql.Count())
+	}
+}
+
+func randomValue(r *rand.Rand) string {
+	if r.Intn(3) == 0 {
+		return strconv.Itoa(r.Intn(100000) - 50000)
+	}
+	return fmt.Sprintf("value-%d-%s", r.Intn(1000), string(make([]byte, r.Intn(40))))
+}
+
+func TestRandomOperations(t *testing.T) {
+	for _, fill := range []int{-2, -1, 1, 4, 32} {
+		for _, depth := range []int{0, 1, 2} {
+			r := rand.New(rand.NewSource(int64(fill*10 + depth)))
+			ql := New(fill, depth)
+			var model []string
+
+			for op := 0; op < 3000; op++ {
+				switch r.Intn(7) {
+				case 0:
+					v := randomValue(r)
+					ql.PushHead([]byte(v))
+					model = append([]string{v}, model...)
+				case 1:
+					v := randomValue(r)
+					ql.PushTail([]byte(v))
+					model = append(model, v)
+				case 2:
+					var data []byte
+					var sval int64
+					if ql.Pop(Head, &data, &sval) != (len(model) > 0) {
+						t.Fatalf("pop head mismatch")
+					}
+					if len(model) > 0 {
+						model = model[1:]
+					}
+				case 3:
+					if len(model) == 0 {
+						continue
+					}
+					idx := r.Intn(len(model))
+					var entry Entry
+					if !ql.Index(idx, &entry) || entryValue(&entry) != model[idx] {
+						t.Fatalf("index %d mismatch", idx)
+					}
+					v := randomValue(r)
+					if r.Intn(2) == 0 {
+						ql.InsertBefore(&entry, []byte(v))
+						model = append(model[:idx], append([]string{v}, model[idx:]...)...)
+					} else {
+						ql.InsertAfter(&entry, []byte(v))
+						model = append(model[:idx+1], append([]string{v}, model[idx+1:]...)...)
+					}
+				case 4:
+					if len(model) == 0 {
+						continue
+					}
+					idx := r.Intn(len(model))
+					v := randomValue(r)
+					if !ql.ReplaceAtIndex(idx-len(model), []byte(v)) {
+						t.Fatalf("replace %d failed", idx)
+					}
+					model[idx] = v
+				case 5:
+					if len(model) == 0 || r.Intn(4) != 0 {
+						continue
+					}
+					start := r.Intn(len(model))
+					count := r.Intn(len(model)-start) + 1
+					if r.Intn(2) == 0 {
+						ql.DelRange(start, count)
+					} else {
+						ql.DelRange(start-len(model), count)
+					}
+					model = append(model[:start], model[start+count:]...)
+				case 6:
+					// 删除所有等于model中某个值的元素
+					if len(model) == 0 {
+						continue
+					}
+					target := model[r.Intn(len(model))]
+					var entry Entry
+					iter := ql.GetIterator(StartTail)
+					for iter.Next(&entry) {
+						if entry.Compare([]byte(target)) {
+							iter.DelEntry(&entry)
+						}
+					}
+					iter.Release()
+					kept := model[:0]
+					for _, v := range model {
+						if v != target {
+							kept = append(kept, v)
+						}
+					}
+					model = kept
+				}
+			}
+			checkList(t, ql, model)
+			checkList(t, ql.Dup(), model)
+		}
+	}
+}
+
+func TestCompressDepth(t *testing.T) {
+	ql := New(4, 1)
+	var model []string
+	for i := 0; i < 200; i++ {
+		v := fmt.Sprintf("a fairly long value that compresses well %d", i%5)
+		ql.PushTail([]byte(v))
+		model = append(model, v)
+	}
+
+	compressed := 0
+	for ln := ql.nodes.First(); ln != nil; ln = ln.Next() {
+		if nodeOf(ln).encoding == nodeEncodingLZF {
+			compressed++
+		}
+	}
+	if nodeOf(ql.nodes.First()).encoding != nodeEncodingRaw || nodeOf(ql.nodes.Last()).encoding != nodeEncodingRaw {
+		t.Fatalf("head and tail should not be compressed")
+	}
+	if compressed != ql.Len()-2 {
+		t.Fatalf("expect %d compressed nodes, got %d", ql.Len()-2, compressed)
+	}
+	checkList(t, ql, model)
+}
+
+func TestPopEmptyString(t *testing.T) {
+	ql := Create()
+	ql.PushTail([]byte(""))
+	ql.PushTail([]byte("12"))
+	ql.PushTail([]byte(""))
+	checkList(t, ql, []string{"", "12", ""})
+
+	// 空字符串弹出时data不为nil，和整数区分开
+	var data []byte
+	var sval int64
+	if !ql.Pop(Head, &data, &sval) || data == nil || len(data) != 0 {
+		t.Fatalf("pop head: expect empty string, got %q %d", data, sval)
+	}
+	if !ql.Pop(Head, &data, &sval) || data != nil || sval != 12 {
+		t.Fatalf("pop head: expect integer 12, got %q %d", data, sval)
+	}
+	if !ql.Pop(Tail, &data, &sval) || data == nil || len(data) != 0 {
+		t.Fatalf("pop tail: expect empty string, got %q %d", data, sval)
+	}
+	if ql.Pop(Tail, &data, &sval) {
+		t.Fatal("pop from empty quicklist should fail")
+	}
+}
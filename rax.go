@@ -1,6 +1,20 @@
 package main
 
+import (
+	"bytes"
+	"sort"
+	"unsafe"
+)
+
+// rax 基数树，key按照字节序排列，公共前缀只保存一次。
+// 每个节点保存从父节点到它的整条边(压缩路径)，子节点按照边的第一个字节排序。
+// 除了根节点，不是key的节点至少有两个子节点，否则会和唯一的子节点合并
+
 type raxNode struct {
+	isKey    bool           // 从根节点到这个节点的路径是一个key
+	data     unsafe.Pointer // key关联的值
+	edge     []byte         // 从父节点到这个节点的边
+	children []*raxNode     // 按照edge[0]排序
 }
 
 type rax struct {
@@ -8,3 +22,417 @@ type rax struct {
 	numele   uint64
 	numnodes uint64
 }
+
+func raxNew() *rax {
+	return &rax{head: &raxNode{}, numnodes: 1}
+}
+
+// raxSize 返回key的数量
+func raxSize(rt *rax) uint64 {
+	return rt.numele
+}
+
+// raxFindChild 返回第一个edge[0]大于等于c的子节点的下标，以及edge[0]是否等于c
+func raxFindChild(n *raxNode, c byte) (int, bool) {
+	idx := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].edge[0] >= c
+	})
+	return idx, idx < len(n.children) && n.children[idx].edge[0] == c
+}
+
+// raxCommonPrefixLen 返回a和b的公共前缀长度
+func raxCommonPrefixLen(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// raxLowWalk 沿着s往下查找，返回停下来的节点h、s中匹配的字节数i、h的边中匹配的字节数j。
+// j等于len(h.edge)时表示完整匹配了h，否则在h的边的中间停下。
+// stack不为nil时保存h的所有祖先节点
+func raxLowWalk(rt *rax, s []byte, stack *[]*raxNode) (h *raxNode, i, j int) {
+	h = rt.head
+	for i < len(s) {
+		idx, found := raxFindChild(h, s[i])
+		if !found {
+			break
+		}
+		child := h.children[idx]
+		if stack != nil {
+			*stack = append(*stack, h)
+		}
+		m := raxCommonPrefixLen(child.edge, s[i:])
+		h, i = child, i+m
+		if m < len(child.edge) {
+			return h, i, m
+		}
+	}
+	return h, i, len(h.edge)
+}
+
+// raxAddChild 把child按顺序加入n的子节点
+func raxAddChild(n, child *raxNode) {
+	idx, _ := raxFindChild(n, child.edge[0])
+	n.children = append(n.children, nil)
+	copy(n.children[idx+1:], n.children[idx:])
+	n.children[idx] = child
+}
+
+// raxGenericInsert 插入s，key已经存在时根据overwrite决定是否更新值，
+// 返回是否插入了新的key和原来的值
+func raxGenericInsert(rt *rax, s []byte, data unsafe.Pointer, overwrite bool) (bool, unsafe.Pointer) {
+	var stack []*raxNode
+	h, i, j := raxLowWalk(rt, s, &stack)
+
+	// 停在边的中间，把h拆成两个节点
+	if j < len(h.edge) {
+		parent := stack[len(stack)-1]
+		idx, _ := raxFindChild(parent, h.edge[0])
+		mid := &raxNode{
+			edge:     append([]byte(nil), h.edge[:j]...),
+			children: []*raxNode{h},
+		}
+		h.edge = append([]byte(nil), h.edge[j:]...)
+		parent.children[idx] = mid
+		rt.numnodes++
+		h = mid
+	}
+
+	if i == len(s) {
+		if h.isKey {
+			old := h.data
+			if overwrite {
+				h.data = data
+			}
+			return false, old
+		}
+		h.isKey = true
+		h.data = data
+		rt.numele++
+		return true, nil
+	}
+
+	// s还有剩下的字节，作为一个新的子节点
+	raxAddChild(h, &raxNode{
+		isKey: true,
+		data:  data,
+		edge:  append([]byte(nil), s[i:]...),
+	})
+	rt.numnodes++
+	rt.numele++
+	return true, nil
+}
+
+// raxInsert 插入s，已经存在时更新它的值，返回是否插入了新的key和原来的值
+func raxInsert(rt *rax, s []byte, data unsafe.Pointer) (bool, unsafe.Pointer) {
+	return raxGenericInsert(rt, s, data, true)
+}
+
+// raxTryInsert 和raxInsert一样，但是不会更新已经存在的key
+func raxTryInsert(rt *rax, s []byte, data unsafe.Pointer) (bool, unsafe.Pointer) {
+	return raxGenericInsert(rt, s, data, false)
+}
+
+// raxFind 查找s，返回它的值以及是否存在
+func raxFind(rt *rax, s []byte) (unsafe.Pointer, bool) {
+	h, i, j := raxLowWalk(rt, s, nil)
+	if i != len(s) || j != len(h.edge) || !h.isKey {
+		return nil, false
+	}
+	return h.data, true
+}
+
+// raxRemove 删除s，返回原来的值以及是否删除成功
+func raxRemove(rt *rax, s []byte) (unsafe.Pointer, bool) {
+	var stack []*raxNode
+	h, i, j := raxLowWalk(rt, s, &stack)
+	if i != len(s) || j != len(h.edge) || !h.isKey {
+		return nil, false
+	}
+
+	old := h.data
+	h.isKey = false
+	h.data = nil
+	rt.numele--
+
+	// 没有子节点的节点直接从父节点中删除
+	if len(h.children) == 0 && h != rt.head {
+		parent := stack[len(stack)-1]
+		idx, _ := raxFindChild(parent, h.edge[0])
+		parent.children = append(parent.children[:idx], parent.children[idx+1:]...)
+		rt.numnodes--
+		h = parent
+	}
+
+	// 不是key又只有一个子节点时，和子节点合并成一个压缩节点
+	if h != rt.head && !h.isKey && len(h.children) == 1 {
+		child := h.children[0]
+		edge := make([]byte, 0, len(h.edge)+len(child.edge))
+		edge = append(append(edge, h.edge...), child.edge...)
+		h.edge = edge
+		h.isKey, h.data, h.children = child.isKey, child.data, child.children
+		rt.numnodes--
+	}
+	return old, true
+}
+
+const (
+	raxIterJustSeeked = 1 << 0 // 刚调用过raxSeek，下一次迭代返回当前元素
+	raxIterEOF        = 1 << 1 // 迭代结束
+)
+
+// raxIterator 按照字节序遍历rax，迭代期间修改rax之后需要重新seek
+type raxIterator struct {
+	rt    *rax
+	flags int
+	key   []byte         // 当前元素的key，下一次迭代时会被修改
+	data  unsafe.Pointer // 当前元素的值
+	stack []*raxNode     // 从根节点到当前节点的路径
+}
+
+func raxStart(it *raxIterator, rt *rax) {
+	it.rt = rt
+	it.flags = raxIterEOF
+	it.key = it.key[:0]
+	it.data = nil
+	it.stack = it.stack[:0]
+}
+
+func raxStop(it *raxIterator) {
+	it.stack = nil
+	it.key = nil
+}
+
+func raxEOF(it *raxIterator) bool {
+	return it.flags&raxIterEOF != 0
+}
+
+func (it *raxIterator) top() *raxNode {
+	return it.stack[len(it.stack)-1]
+}
+
+func (it *raxIterator) push(n *raxNode) {
+	it.stack = append(it.stack, n)
+	it.key = append(it.key, n.edge...)
+}
+
+func (it *raxIterator) pop() *raxNode {
+	n := it.top()
+	it.stack = it.stack[:len(it.stack)-1]
+	it.key = it.key[:len(it.key)-len(n.edge)]
+	return n
+}
+
+// descendFirst 移动到当前子树中最小的key，当前节点是key时不移动
+func (it *raxIterator) descendFirst() {
+	for n := it.top(); !n.isKey; n = it.top() {
+		it.push(n.children[0])
+	}
+}
+
+// descendLast 移动到当前子树中最大的key，也就是最右边的叶子节点
+func (it *raxIterator) descendLast() {
+	for n := it.top(); len(n.children) > 0; n = it.top() {
+		it.push(n.children[len(n.children)-1])
+	}
+}
+
+// nextAfterSubtree 移动到当前子树之后的第一个key
+func (it *raxIterator) nextAfterSubtree() bool {
+	for len(it.stack) > 1 {
+		child := it.pop()
+		parent := it.top()
+		idx, _ := raxFindChild(parent, child.edge[0])
+		if idx+1 < len(parent.children) {
+			it.push(parent.children[idx+1])
+			it.descendFirst()
+			return true
+		}
+	}
+	return false
+}
+
+// stepNext 移动到下一个key，key的子节点都比它大
+func (it *raxIterator) stepNext() bool {
+	if n := it.top(); len(n.children) > 0 {
+		it.push(n.children[0])
+		it.descendFirst()
+		return true
+	}
+	return it.nextAfterSubtree()
+}
+
+// stepPrev 移动到上一个key，也就是左边兄弟子树中最大的key，或者是父节点本身
+func (it *raxIterator) stepPrev() bool {
+	for len(it.stack) > 1 {
+		child := it.pop()
+		parent := it.top()
+		idx, _ := raxFindChild(parent, child.edge[0])
+		if idx > 0 {
+			it.push(parent.children[idx-1])
+			it.descendLast()
+			return true
+		}
+		if parent.isKey {
+			return true
+		}
+	}
+	return false
+}
+
+// seekGreaterOrEqual 移动到第一个大于等于ele的key
+func (it *raxIterator) seekGreaterOrEqual(ele []byte) bool {
+	n, i := it.top(), 0
+	for {
+		if i == len(ele) {
+			it.descendFirst()
+			return true
+		}
+		idx, found := raxFindChild(n, ele[i])
+		if !found {
+			if idx < len(n.children) {
+				it.push(n.children[idx])
+				it.descendFirst()
+				return true
+			}
+			return it.nextAfterSubtree()
+		}
+		child := n.children[idx]
+		m := raxCommonPrefixLen(child.edge, ele[i:])
+		it.push(child)
+		if m == len(child.edge) {
+			n, i = child, i+m
+			continue
+		}
+		// 在边的中间不匹配，整个子树要么都比ele大，要么都比ele小
+		if i+m == len(ele) || child.edge[m] > ele[i+m] {
+			it.descendFirst()
+			return true
+		}
+		return it.nextAfterSubtree()
+	}
+}
+
+// seekLessOrEqual 移动到最后一个小于等于ele的key
+func (it *raxIterator) seekLessOrEqual(ele []byte) bool {
+	n, i := it.top(), 0
+	for {
+		if i == len(ele) {
+			if n.isKey {
+				return true
+			}
+			return it.stepPrev()
+		}
+		idx, found := raxFindChild(n, ele[i])
+		if !found {
+			if idx > 0 {
+				it.push(n.children[idx-1])
+				it.descendLast()
+				return true
+			}
+			// n的key是ele的前缀，所以比ele小
+			if n.isKey {
+				return true
+			}
+			return it.stepPrev()
+		}
+		child := n.children[idx]
+		m := raxCommonPrefixLen(child.edge, ele[i:])
+		it.push(child)
+		if m == len(child.edge) {
+			n, i = child, i+m
+			continue
+		}
+		if i+m < len(ele) && child.edge[m] < ele[i+m] {
+			it.descendLast()
+			return true
+		}
+		return it.stepPrev()
+	}
+}
+
+// raxSeek 把迭代器移动到op指定的位置，之后第一次调用raxNext或者raxPrev返回这个元素。
+// op可以是">", ">=", "<", "<=", "="，以及"^"表示第一个元素，"$"表示最后一个元素。
+// op不合法时返回false
+func raxSeek(it *raxIterator, op string, ele []byte) bool {
+	it.stack = it.stack[:0]
+	it.key = it.key[:0]
+	it.data = nil
+	it.flags = raxIterJustSeeked
+	it.push(it.rt.head)
+
+	var found bool
+	switch op {
+	case "^", "$", "=", ">=", ">", "<=", "<":
+		if it.rt.numele == 0 {
+			it.flags |= raxIterEOF
+			return true
+		}
+	default:
+		return false
+	}
+
+	switch op {
+	case "^":
+		it.descendFirst()
+		found = true
+	case "$":
+		it.descendLast()
+		found = true
+	case "=":
+		found = it.seekGreaterOrEqual(ele) && bytes.Equal(it.key, ele)
+	case ">=", ">":
+		found = it.seekGreaterOrEqual(ele)
+		if found && op == ">" && bytes.Equal(it.key, ele) {
+			found = it.stepNext()
+		}
+	case "<=", "<":
+		found = it.seekLessOrEqual(ele)
+		if found && op == "<" && bytes.Equal(it.key, ele) {
+			found = it.stepPrev()
+		}
+	}
+
+	if !found || !it.top().isKey {
+		it.flags |= raxIterEOF
+		return true
+	}
+	it.data = it.top().data
+	return true
+}
+
+// raxNext 移动到下一个元素，没有更多元素时返回false
+func raxNext(it *raxIterator) bool {
+	if it.flags&raxIterEOF != 0 {
+		return false
+	}
+	if it.flags&raxIterJustSeeked != 0 {
+		it.flags &^= raxIterJustSeeked
+		return true
+	}
+	if !it.stepNext() {
+		it.flags |= raxIterEOF
+		return false
+	}
+	it.data = it.top().data
+	return true
+}
+
+// raxPrev 移动到上一个元素，没有更多元素时返回false
+func raxPrev(it *raxIterator) bool {
+	if it.flags&raxIterEOF != 0 {
+		return false
+	}
+	if it.flags&raxIterJustSeeked != 0 {
+		it.flags &^= raxIterJustSeeked
+		return true
+	}
+	if !it.stepPrev() {
+		it.flags |= raxIterEOF
+		return false
+	}
+	it.data = it.top().data
+	return true
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"unsafe"
+)
+
+func TestRaxInsertRemove(t *testing.T) {
+	rt := raxNew()
+	keys := map[string]int{}
+	for i := 0; i < 5000; i++ {
+		k := fmt.Sprintf("%x", rand.Intn(3000))
+		if rand.Intn(3) == 0 {
+			_, removed := raxRemove(rt, []byte(k))
+			_, exists := keys[k]
+			if removed != exists {
+				t.Fatalf("remove %s: expect %v", k, exists)
+			}
+			delete(keys, k)
+			continue
+		}
+		v := i
+		inserted, _ := raxInsert(rt, []byte(k), unsafe.Pointer(&v))
+		_, exists := keys[k]
+		if inserted == exists {
+			t.Fatalf("insert %s: expect %v", k, !exists)
+		}
+		keys[k] = v
+	}
+
+	if raxSize(rt) != uint64(len(keys)) {
+		t.Fatalf("size %d, expect %d", raxSize(rt), len(keys))
+	}
+	for k, v := range keys {
+		p, ok := raxFind(rt, []byte(k))
+		if !ok || *(*int)(p) != v {
+			t.Fatalf("find %s failed", k)
+		}
+	}
+	if _, ok := raxFind(rt, []byte("not-exists")); ok {
+		t.Fatal("find a missing key")
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	var it raxIterator
+	raxStart(&it, rt)
+	raxSeek(&it, "^", nil)
+	for i := 0; raxNext(&it); i++ {
+		if string(it.key) != sorted[i] || *(*int)(it.data) != keys[sorted[i]] {
+			t.Fatalf("iterate %d: expect %s, got %s", i, sorted[i], it.key)
+		}
+	}
+	raxStop(&it)
+
+	// 全部删除之后只剩根节点
+	for k := range keys {
+		raxRemove(rt, []byte(k))
+	}
+	if raxSize(rt) != 0 || rt.numnodes != 1 {
+		t.Fatalf("size %d nodes %d after removing all keys", raxSize(rt), rt.numnodes)
+	}
+}
+
+func TestRaxIterator(t *testing.T) {
+	rt := raxNew()
+	var keys []string
+	for _, k := range []string{"", "a", "ab", "abc", "abd", "b", "ba", "romane", "romanus", "romulus", "rubens", "ruber"} {
+		raxInsert(rt, []byte(k), nil)
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var it raxIterator
+	raxStart(&it, rt)
+	defer raxStop(&it)
+
+	raxSeek(&it, "^", nil)
+	for i := 0; raxNext(&it); i++ {
+		if string(it.key) != keys[i] {
+			t.Fatalf("next %d: expect %q, got %q", i, keys[i], it.key)
+		}
+	}
+	raxSeek(&it, "$", nil)
+	for i := len(keys) - 1; raxPrev(&it); i-- {
+		if string(it.key) != keys[i] {
+			t.Fatalf("prev %d: expect %q, got %q", i, keys[i], it.key)
+		}
+	}
+
+	// 和有序数组的二分查找结果比较
+	for _, op := range []string{">=", ">", "<=", "<", "="} {
+		for _, ele := range []string{"", "a", "aa", "abc", "abe", "az", "c", "roman", "romanez", "rub", "rubf", "z"} {
+			i := sort.SearchStrings(keys, ele)
+			expect := -1
+			switch op {
+			case ">=":
+				expect = i
+			case ">":
+				if i < len(keys) && keys[i] == ele {
+					i++
+				}
+				expect = i
+			case "<=":
+				if i < len(keys) && keys[i] == ele {
+					expect = i
+				} else {
+					expect = i - 1
+				}
+			case "<":
+				expect = i - 1
+			case "=":
+				if i < len(keys) && keys[i] == ele {
+					expect = i
+				}
+			}
+			raxSeek(&it, op, []byte(ele))
+			ok := raxNext(&it)
+			if expect < 0 || expect >= len(keys) {
+				if ok {
+					t.Fatalf("seek %s %q: expect eof, got %q", op, ele, it.key)
+				}
+				continue
+			}
+			if !ok || !bytes.Equal(it.key, []byte(keys[expect])) {
+				t.Fatalf("seek %s %q: expect %q, got %q", op, ele, keys[expect], it.key)
+			}
+		}
+	}
+}
@@ -20,6 +20,9 @@ func main() {
 	rand.Seed(time.Now().UnixNano())
 
 	redisServer := New()
+	if len(os.Args) > 1 {
+		redisServer.configFile = os.Args[1]
+	}
 
 	redisServer.InitServer()
 
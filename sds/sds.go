@@ -1,6 +1,7 @@
 package sds
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"github.com/pengdafu/redis-golang/util"
@@ -380,6 +381,22 @@ func Catlen(s SDS, p []byte, l int) SDS {
 	return s
 }
 
+// GrowZero 把sds增长到l的长度，新增的部分用0填充，l小于当前长度时什么都不做
+func GrowZero(s SDS, l int) SDS {
+	curLen := Len(s)
+	if l <= curLen {
+		return s
+	}
+
+	s = MakeRoomFor(s, l-curLen)
+	buf := s.Buf(curLen)[:l-curLen]
+	for i := range buf {
+		buf[i] = 0
+	}
+	sdssetlen(s, l)
+	return s
+}
+
 func Range(s SDS, start, end int) {
 	oldLen := Len(s)
 	if oldLen == 0 { // sds 还没使用
@@ -479,6 +496,16 @@ func RemoveFreeSpace(s SDS) SDS {
 	return s
 }
 
+// Cmp 按memcmp的语义比较两个sds，返回值同bytes.Compare
+func Cmp(s1, s2 SDS) int {
+	return bytes.Compare(s1.BufData(0), s2.BufData(0))
+}
+
+// Same 判断两个sds是否是同一个对象(引用同一块内存)，而不是比较内容
+func Same(s1, s2 SDS) bool {
+	return len(s1.buf) > 0 && len(s2.buf) > 0 && &s1.buf[0] == &s2.buf[0]
+}
+
 func Dup(s SDS) SDS {
 	return NewLen(s.BufData(0))
 }
@@ -148,6 +148,15 @@ const (
 	MaxMemoryFlagLfu              = 1 << 1
 	MaxMemoryFlagAllKeys          = 1 << 2
 	MaxMemoryFlagNoSharedIntegers = MaxMemoryFlagLru | MaxMemoryFlagLfu
+
+	MaxMemoryVolatileLru    = 0<<8 | MaxMemoryFlagLru
+	MaxMemoryVolatileLfu    = 1<<8 | MaxMemoryFlagLfu
+	MaxMemoryVolatileTtl    = 2 << 8
+	MaxMemoryVolatileRandom = 3 << 8
+	MaxMemoryAllKeysLru     = 4<<8 | MaxMemoryFlagLru | MaxMemoryFlagAllKeys
+	MaxMemoryAllKeysLfu     = 5<<8 | MaxMemoryFlagLfu | MaxMemoryFlagAllKeys
+	MaxMemoryAllKeysRandom  = 6<<8 | MaxMemoryFlagAllKeys
+	MaxMemoryNoEviction     = 7 << 8
 )
 
 // server static configuration
@@ -177,6 +186,7 @@ type socketFds struct {
 type RedisServer struct {
 	el         *ae.EventLoop
 	masterhost string
+	configFile string // 启动时指定的配置文件，没有时为空
 
 	commands     *dict.Dict
 	origCommands *dict.Dict
@@ -189,9 +199,18 @@ type RedisServer struct {
 	bindAddr      [CONFIG_BINDADDR_MAX]string
 	bindAddrCount int
 
-	hashMaxZipListValue   int // 超过64字节转ht
-	hashMaxZipListEntries int // 超过512个元素转ht
-	setMaxIntSetEntries   int // 超过512个元素转ht
+	hashMaxListpackValue   int // 超过64字节转ht
+	hashMaxListpackEntries int // 超过512个元素转ht
+	setMaxIntSetEntries    int // 超过512个元素转ht
+	setMaxListpackEntries  int // 超过128个元素转ht
+	setMaxListpackValue    int // 超过64字节转ht
+	zsetMaxListpackEntries int // 超过128个元素转skiplist
+	zsetMaxListpackValue   int // 超过64字节转skiplist
+	listMaxZipListSize     int // quicklist节点的fill，负数表示按字节数限制
+	streamNodeMaxBytes     int // stream单个节点的最大字节数
+	streamNodeMaxEntries   int // stream单个节点的最大元素个数
+	listCompressDepth      int // quicklist两端不压缩的节点数量
+	hllSparseMaxBytes      int // sparse编码超过3000字节转dense
 
 	clients                        []*Client
 	currentClient                  *Client
@@ -199,6 +218,7 @@ type RedisServer struct {
 	lazyFreeLazyUserDel            bool
 	lazyFreeLazyExpire             bool
 	lazyFreeLazyServerDel          bool
+	lazyFreeLazyUserFlush          bool
 	loading                        bool
 	activeExpireEnabled            bool
 	activeRehashing                bool
@@ -207,6 +227,7 @@ type RedisServer struct {
 	statNumConnections             uint64 // 成功连接客户端的次数
 	statTotalReadsProcessed        uint64 // 成功处理read的次数
 	statExpiredKeys                uint64 // 成功处理过期key的次数
+	statExpiredSubkeys             uint64 // 成功处理过期hash field的次数
 	statExpiredStalePerc           int    // 成功处理过期key的次数
 	statExpiredTimeCapReachedCount int
 	tcpKeepalive                   int
@@ -216,6 +237,8 @@ type RedisServer struct {
 	dirty                          int
 	maxMemoryPolicy                int
 	maxMemory                      int64
+	lfuLogFactor                   int // LFU计数增长的对数因子
+	lfuDecayTime                   int // LFU计数每隔多少分钟减1
 
 	lruClock  uint32
 	hz        int
@@ -233,16 +256,21 @@ type RedisServer struct {
 	luaTimeStart    int64
 	fixedTimeExpire int64
 
-	clientsPendWrite   *adlist.List
-	readyKeys          *adlist.List
-	aofState           int
-	aofFsync           int
-	statNetOutputBytes int
+	clientsPendWrite     *adlist.List
+	readyKeys            *adlist.List     // 有客户端阻塞等待的、已经就绪的key，readyList类型
+	unblockedClients     *adlist.List     // 已经解除阻塞，需要重新处理querybuf的客户端
+	clientsTimeoutTable  *rax             // 设置了超时时间的阻塞客户端，按照超时时间排序
+	blockedClients       int              // 阻塞中的客户端数量
+	blockedClientsByType [BLOCKED_NUM]int // 每一种阻塞类型的客户端数量
+	aofState             int
+	aofFsync             int
+	statNetOutputBytes   int
 
 	rdbChildPid, aofChildPid, moduleChildPid int
 
-	delCommand *redisCommand
-	slaves     *adlist.List
+	delCommand  *redisCommand
+	hdelCommand *redisCommand
+	slaves      *adlist.List
 }
 
 const (
@@ -359,14 +387,16 @@ type user struct {
 type multiState struct {
 	cmdFlags uint64
 }
+type blockPos struct {
+	wherefrom int // 从哪一端弹出，listHead或者listTail
+	whereto   int // 推入到target的哪一端
+}
 type blockingState struct {
-	timeout time.Duration
-	keys    *dict.Dict
-	target  *robj
-	listPos struct {
-		wherefrom int
-		whereto   int
-	}
+	timeout int64      // 阻塞的超时时间，毫秒时间戳，0表示永不超时
+	keys    *dict.Dict // 阻塞等待的key
+	target  *robj      // BLMOVE的目标key
+	listPos blockPos
+	count   int // BLMPOP每次弹出的元素个数，其它命令为0
 
 	xReadCount      int
 	xReadGroup      *robj
@@ -387,6 +417,9 @@ func (server *RedisServer) InitServer() {
 	dict.SetHashFunctionSeed(util.GetRandomBytes(16))
 
 	initServerConfig()
+	if server.configFile != "" {
+		loadServerConfig(server.configFile)
+	}
 
 	var err error
 
@@ -402,6 +435,7 @@ func (server *RedisServer) InitServer() {
 		db := &redisDb{}
 		db.dict = dict.Create(dbDictType, nil)
 		db.expires = dict.Create(keyPtrDictType, nil)
+		db.hexpires = dict.Create(keyDictType, nil)
 		db.blockingKeys = dict.Create(keyListDictType, nil)
 		db.watchedKeys = dict.Create(keyListDictType, nil)
 		db.readyKeys = dict.Create(objectKeyPointValueDictType, nil)
@@ -409,6 +443,7 @@ func (server *RedisServer) InitServer() {
 		db.defragLater = adlist.Create()
 		server.db[i] = db
 	}
+	lazyfreeInit()
 
 	server.el.AeSetBeforeSleepProc(beforeSleep)
 
@@ -438,19 +473,33 @@ func initServerConfig() {
 	server.maxclients = 100
 	server.clientsPendWrite = adlist.Create()
 	server.readyKeys = adlist.Create()
+	server.unblockedClients = adlist.Create()
+	server.clientsTimeoutTable = raxNew()
 	server.hz = 10
+	server.lruClock = getLRUClock()
 	server.clientMaxQueryBufLen = 1024 * 1024
 	server.dbnum = 16
 	server.protoMaxBulkLen = 1024 * 1024
 	server.activeExpireEnabled = true
 	server.activeRehashing = true
 
-	server.hashMaxZipListValue = 64
-	server.hashMaxZipListEntries = 512
+	server.hashMaxListpackValue = 64
+	server.hashMaxListpackEntries = 512
 	server.setMaxIntSetEntries = 512
+	server.setMaxListpackEntries = 128
+	server.setMaxListpackValue = 64
+	server.zsetMaxListpackEntries = 128
+	server.zsetMaxListpackValue = 64
+	server.listMaxZipListSize = -2
+	server.streamNodeMaxBytes = 4096
+	server.streamNodeMaxEntries = 100
+	server.listCompressDepth = 0
+	server.hllSparseMaxBytes = 3000
 
 	server.activeExpireEffort = 1
 
+	initConfigValues()
+
 	server.rdbChildPid = -1
 	server.moduleChildPid = -1
 	server.aofChildPid = -1
@@ -458,6 +507,8 @@ func initServerConfig() {
 	server.commands = dict.Create(commandTableDictType, nil)
 	server.origCommands = dict.Create(commandTableDictType, nil)
 	populateCommandTable()
+	server.delCommand = lookupCommandByCString("del")
+	server.hdelCommand = lookupCommandByCString("hdel")
 }
 
 func (server *RedisServer) Start() {
@@ -501,6 +552,9 @@ func (server *RedisServer) serverCron(el *ae.EventLoop, id int64, clientData int
 		}
 	}
 
+	// 阻塞客户端的超时检查
+	handleBlockedClientsTimeout()
+
 	databaseCron()
 
 	server.lruClock = getLRUClock()
@@ -651,9 +705,84 @@ var redisCommandTable = []redisCommand{
 	{"select", selectCommand, 2,
 		"ok-loading fast ok-stale @keyspace",
 		0, nil, 0, 0, 0, 0, 0, 0},
-	{"expire", expireCommand, 3,
+	{"expire", expireCommand, -3,
+		"write fast @keyspace",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"expireat", expireatCommand, -3,
+		"write fast @keyspace",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"pexpire", pexpireCommand, -3,
+		"write fast @keyspace",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"pexpireat", pexpireatCommand, -3,
+		"write fast @keyspace",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"ttl", ttlCommand, 2,
+		"read-only fast random @keyspace",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"pttl", pttlCommand, 2,
+		"read-only fast random @keyspace",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"expiretime", expiretimeCommand, 2,
+		"read-only fast @keyspace",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"pexpiretime", pexpiretimeCommand, 2,
+		"read-only fast @keyspace",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"persist", persistCommand, 2,
+		"write fast @keyspace",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"scan", scanCommand, -2,
+		"read-only random @keyspace",
+		0, nil, 0, 0, 0, 0, 0, 0},
+	{"exists", existsCommand, -2,
+		"read-only fast @keyspace",
+		0, nil, 1, -1, 1, 0, 0, 0},
+	{"type", typeCommand, 2,
+		"read-only fast @keyspace",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"keys", keysCommand, 2,
+		"read-only to-sort @keyspace @dangerous",
+		0, nil, 0, 0, 0, 0, 0, 0},
+	{"rename", renameCommand, 3,
+		"write @keyspace",
+		0, nil, 1, 2, 1, 0, 0, 0},
+	{"renamenx", renamenxCommand, 3,
+		"write fast @keyspace",
+		0, nil, 1, 2, 1, 0, 0, 0},
+	{"move", moveCommand, 3,
 		"write fast @keyspace",
 		0, nil, 1, 1, 1, 0, 0, 0},
+	{"copy", copyCommand, -3,
+		"write use-memory @keyspace",
+		0, nil, 1, 2, 1, 0, 0, 0},
+	{"randomkey", randomkeyCommand, 1,
+		"read-only random @keyspace",
+		0, nil, 0, 0, 0, 0, 0, 0},
+	{"dbsize", dbsizeCommand, 1,
+		"read-only fast @keyspace",
+		0, nil, 0, 0, 0, 0, 0, 0},
+	{"touch", touchCommand, -2,
+		"read-only fast @keyspace",
+		0, nil, 1, -1, 1, 0, 0, 0},
+	{"object", objectCommand, -2,
+		"read-only random @keyspace",
+		0, nil, 2, 2, 1, 0, 0, 0},
+	{"config", configCommand, -2,
+		"admin ok-loading ok-stale no-script",
+		0, nil, 0, 0, 0, 0, 0, 0},
+	{"info", infoCommand, -1,
+		"ok-loading ok-stale random @dangerous",
+		0, nil, 0, 0, 0, 0, 0, 0},
+	{"flushdb", flushdbCommand, -1,
+		"write @keyspace @dangerous",
+		0, nil, 0, 0, 0, 0, 0, 0},
+	{"flushall", flushallCommand, -1,
+		"write @keyspace @dangerous",
+		0, nil, 0, 0, 0, 0, 0, 0},
+	{"swapdb", swapdbCommand, 3,
+		"write fast @keyspace @dangerous",
+		0, nil, 0, 0, 0, 0, 0, 0},
 	{"get", getCommand, 2,
 		"read-only fast @string",
 		0, nil, 1, 1, 1, 0, 0, 0},
@@ -666,12 +795,165 @@ var redisCommandTable = []redisCommand{
 	//{"exec", execCommand, 1,
 	//	"no-script no-monitor no-slowlog ok-loading ok-stale @transaction",
 	//	0, nil, 0, 0, 0, 0, 0, 0},
+	{"setnx", setnxCommand, 3,
+		"write use-memory fast @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"setex", setexCommand, 4,
+		"write use-memory @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"psetex", psetexCommand, 4,
+		"write use-memory @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"getset", getsetCommand, 3,
+		"write use-memory fast @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"getdel", getdelCommand, 2,
+		"write fast @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"getex", getexCommand, -2,
+		"write fast @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"mget", mgetCommand, -2,
+		"read-only fast @string",
+		0, nil, 1, -1, 1, 0, 0, 0},
+	{"mset", msetCommand, -3,
+		"write use-memory @string",
+		0, nil, 1, -1, 2, 0, 0, 0},
+	{"msetnx", msetnxCommand, -3,
+		"write use-memory @string",
+		0, nil, 1, -1, 2, 0, 0, 0},
+	{"incr", incrCommand, 2,
+		"write use-memory fast @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"decr", decrCommand, 2,
+		"write use-memory fast @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"incrby", incrbyCommand, 3,
+		"write use-memory fast @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"decrby", decrbyCommand, 3,
+		"write use-memory fast @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"incrbyfloat", incrbyfloatCommand, 3,
+		"write use-memory fast @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"append", appendCommand, 3,
+		"write use-memory fast @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"strlen", strlenCommand, 2,
+		"read-only fast @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"setrange", setrangeCommand, 4,
+		"write use-memory @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"getrange", getrangeCommand, 4,
+		"read-only @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"substr", getrangeCommand, 4,
+		"read-only @string",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"setbit", setbitCommand, 4,
+		"write use-memory @bitmap",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"getbit", getbitCommand, 3,
+		"read-only fast @bitmap",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"bitfield", bitfieldCommand, -2,
+		"write use-memory @bitmap",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"bitfield_ro", bitfieldroCommand, -2,
+		"read-only fast @bitmap",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"bitop", bitopCommand, -4,
+		"write use-memory @bitmap",
+		0, nil, 2, -1, 1, 0, 0, 0},
+	{"bitcount", bitcountCommand, -2,
+		"read-only @bitmap",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"bitpos", bitposCommand, -3,
+		"read-only @bitmap",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"pfadd", pfaddCommand, -2,
+		"write use-memory fast @hyperloglog",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"pfcount", pfcountCommand, -2,
+		"read-only @hyperloglog",
+		0, nil, 1, -1, 1, 0, 0, 0},
+	{"pfmerge", pfmergeCommand, -2,
+		"write use-memory @hyperloglog",
+		0, nil, 1, -1, 1, 0, 0, 0},
+	{"pfdebug", pfdebugCommand, -3,
+		"admin write use-memory @hyperloglog",
+		0, nil, 2, 2, 1, 0, 0, 0},
 	{"del", delCommand, -2,
 		"write @keyspace",
 		0, nil, 1, -1, 1, 0, 0, 0},
 	{"unlink", unlinkCommand, -2,
 		"write fast @keyspace",
 		0, nil, 1, -1, 1, 0, 0, 0},
+	{"rpush", rpushCommand, -3,
+		"write use-memory fast @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"lpush", lpushCommand, -3,
+		"write use-memory fast @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"rpushx", rpushxCommand, -3,
+		"write use-memory fast @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"lpushx", lpushxCommand, -3,
+		"write use-memory fast @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"linsert", linsertCommand, 5,
+		"write use-memory @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"rpop", rpopCommand, -2,
+		"write fast @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"lpop", lpopCommand, -2,
+		"write fast @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"llen", llenCommand, 2,
+		"read-only fast @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"lindex", lindexCommand, 3,
+		"read-only @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"lset", lsetCommand, 4,
+		"write use-memory @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"lrange", lrangeCommand, 4,
+		"read-only @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"ltrim", ltrimCommand, 4,
+		"write @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"lpos", lposCommand, -3,
+		"read-only @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"lrem", lremCommand, 4,
+		"write @list",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"rpoplpush", rpoplpushCommand, 3,
+		"write use-memory @list",
+		0, nil, 1, 2, 1, 0, 0, 0},
+	{"lmove", lmoveCommand, 5,
+		"write use-memory @list",
+		0, nil, 1, 2, 1, 0, 0, 0},
+	{"lmpop", lmpopCommand, -4,
+		"write @list",
+		0, lmpopGetKeys, 0, 0, 0, 0, 0, 0},
+	{"blpop", blpopCommand, -3,
+		"write no-script @list @blocking",
+		0, nil, 1, -2, 1, 0, 0, 0},
+	{"brpop", brpopCommand, -3,
+		"write no-script @list @blocking",
+		0, nil, 1, -2, 1, 0, 0, 0},
+	{"blmove", blmoveCommand, 6,
+		"write use-memory no-script @list @blocking",
+		0, nil, 1, 2, 1, 0, 0, 0},
+	{"blmpop", blmpopCommand, -5,
+		"write no-script @list @blocking",
+		0, blmpopGetKeys, 0, 0, 0, 0, 0, 0},
 	{"hset", hsetCommand, -4,
 		"write use-memory fast @hash",
 		0, nil, 1, 1, 1, 0, 0, 0},
@@ -698,6 +980,51 @@ var redisCommandTable = []redisCommand{
 	{"hgetall", hgetallCommand, 2,
 		"read-only random @hash",
 		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hsetnx", hsetnxCommand, 4,
+		"write use-memory fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hincrby", hincrbyCommand, 4,
+		"write use-memory fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hincrbyfloat", hincrbyfloatCommand, 4,
+		"write use-memory fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hexists", hexistsCommand, 3,
+		"read-only fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hlen", hlenCommand, 2,
+		"read-only fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hstrlen", hstrlenCommand, 3,
+		"read-only fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hrandfield", hrandfieldCommand, -2,
+		"read-only random @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hexpire", hexpireCommand, -6,
+		"write fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hpexpire", hpexpireCommand, -6,
+		"write fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hexpireat", hexpireatCommand, -6,
+		"write fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hpexpireat", hpexpireatCommand, -6,
+		"write fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"httl", httlCommand, -5,
+		"read-only random fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hpttl", hpttlCommand, -5,
+		"read-only random fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hpersist", hpersistCommand, -5,
+		"write fast @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"hscan", hscanCommand, -3,
+		"read-only random @hash",
+		0, nil, 1, 1, 1, 0, 0, 0},
 	{"sadd", saddCommand, -3,
 		"write use-memory fast @set",
 		0, nil, 1, 1, 1, 0, 0, 0},
@@ -715,6 +1042,192 @@ var redisCommandTable = []redisCommand{
 	{"smembers", sinterCommand, 2,
 		"read-only to-sort @set",
 		0, nil, 1, 1, 1, 0, 0, 0},
+	{"spop", spopCommand, -2,
+		"write random fast @set",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"srandmember", srandmemberCommand, -2,
+		"read-only random @set",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"sscan", sscanCommand, -3,
+		"read-only random @set",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"sismember", sismemberCommand, 3,
+		"read-only fast @set",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"smismember", smismemberCommand, -3,
+		"read-only fast @set",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"smove", smoveCommand, 4,
+		"write fast @set",
+		0, nil, 1, 2, 1, 0, 0, 0},
+	{"sinterstore", sinterstoreCommand, -3,
+		"write use-memory @set",
+		0, nil, 1, -1, 1, 0, 0, 0},
+	{"sintercard", sintercardCommand, -3,
+		"read-only @set",
+		0, sintercardGetKeys, 0, 0, 0, 0, 0, 0},
+	{"sunion", sunionCommand, -2,
+		"read-only to-sort @set",
+		0, nil, 1, -1, 1, 0, 0, 0},
+	{"sunionstore", sunionstoreCommand, -3,
+		"write use-memory @set",
+		0, nil, 1, -1, 1, 0, 0, 0},
+	{"sdiff", sdiffCommand, -2,
+		"read-only to-sort @set",
+		0, nil, 1, -1, 1, 0, 0, 0},
+	{"sdiffstore", sdiffstoreCommand, -3,
+		"write use-memory @set",
+		0, nil, 1, -1, 1, 0, 0, 0},
+	{"zadd", zaddCommand, -4,
+		"write use-memory fast @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zincrby", zincrbyCommand, 4,
+		"write use-memory fast @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zrem", zremCommand, -3,
+		"write fast @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zcard", zcardCommand, 2,
+		"read-only fast @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zscore", zscoreCommand, 3,
+		"read-only fast @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zrank", zrankCommand, 3,
+		"read-only fast @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zrevrank", zrevrankCommand, 3,
+		"read-only fast @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zremrangebyscore", zremrangebyscoreCommand, 4,
+		"write @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zremrangebyrank", zremrangebyrankCommand, 4,
+		"write @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zremrangebylex", zremrangebylexCommand, 4,
+		"write @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zrangestore", zrangestoreCommand, -5,
+		"write use-memory @sortedset",
+		0, nil, 1, 2, 1, 0, 0, 0},
+	{"zrange", zrangeCommand, -4,
+		"read-only @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zrangebyscore", zrangebyscoreCommand, -4,
+		"read-only @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zrevrangebyscore", zrevrangebyscoreCommand, -4,
+		"read-only @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zrangebylex", zrangebylexCommand, -4,
+		"read-only @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zrevrangebylex", zrevrangebylexCommand, -4,
+		"read-only @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zcount", zcountCommand, 4,
+		"read-only fast @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zlexcount", zlexcountCommand, 4,
+		"read-only fast @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zrevrange", zrevrangeCommand, -4,
+		"read-only @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zunionstore", zunionstoreCommand, -4,
+		"write use-memory @sortedset",
+		0, zunionInterDiffStoreGetKeys, 0, 0, 0, 0, 0, 0},
+	{"zinterstore", zinterstoreCommand, -4,
+		"write use-memory @sortedset",
+		0, zunionInterDiffStoreGetKeys, 0, 0, 0, 0, 0, 0},
+	{"zdiffstore", zdiffstoreCommand, -4,
+		"write use-memory @sortedset",
+		0, zunionInterDiffStoreGetKeys, 0, 0, 0, 0, 0, 0},
+	{"zscan", zscanCommand, -3,
+		"read-only random @sortedset",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"zunion", zunionCommand, -3,
+		"read-only @sortedset",
+		0, zunionInterDiffGetKeys, 0, 0, 0, 0, 0, 0},
+	{"zinter", zinterCommand, -3,
+		"read-only @sortedset",
+		0, zunionInterDiffGetKeys, 0, 0, 0, 0, 0, 0},
+	{"zdiff", zdiffCommand, -3,
+		"read-only @sortedset",
+		0, zunionInterDiffGetKeys, 0, 0, 0, 0, 0, 0},
+	{"xadd", xaddCommand, -5,
+		"write use-memory fast random @stream",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"xrange", xrangeCommand, -4,
+		"read-only @stream",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"xrevrange", xrevrangeCommand, -4,
+		"read-only @stream",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"xlen", xlenCommand, 2,
+		"read-only fast @stream",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"xdel", xdelCommand, -3,
+		"write fast @stream",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"xtrim", xtrimCommand, -4,
+		"write random @stream",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"xread", xreadCommand, -4,
+		"read-only @stream @blocking",
+		0, nil, 0, 0, 0, 0, 0, 0},
+	{"xreadgroup", xreadCommand, -7,
+		"write @stream @blocking",
+		0, nil, 0, 0, 0, 0, 0, 0},
+	{"xgroup", xgroupCommand, -2,
+		"write use-memory @stream",
+		0, nil, 2, 2, 1, 0, 0, 0},
+	{"xack", xackCommand, -4,
+		"write fast random @stream",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"xpending", xpendingCommand, -3,
+		"read-only random @stream",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"xclaim", xclaimCommand, -6,
+		"write random fast @stream",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"xautoclaim", xautoclaimCommand, -6,
+		"write random fast @stream",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"xinfo", xinfoCommand, -2,
+		"read-only random @stream",
+		0, nil, 2, 2, 1, 0, 0, 0},
+	{"geoadd", geoaddCommand, -5,
+		"write use-memory @geo",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"georadius", georadiusCommand, -6,
+		"write use-memory @geo",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"georadius_ro", georadiusroCommand, -6,
+		"read-only @geo",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"georadiusbymember", georadiusbymemberCommand, -5,
+		"write use-memory @geo",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"georadiusbymember_ro", georadiusbymemberroCommand, -5,
+		"read-only @geo",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"geohash", geohashCommand, -2,
+		"read-only @geo",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"geopos", geoposCommand, -2,
+		"read-only @geo",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"geodist", geodistCommand, -4,
+		"read-only @geo",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"geosearch", geosearchCommand, -7,
+		"read-only @geo",
+		0, nil, 1, 1, 1, 0, 0, 0},
+	{"geosearchstore", geosearchstoreCommand, -8,
+		"write use-memory @geo",
+		0, nil, 1, 2, 1, 0, 0, 0},
 }
 
 func populateCommandTable() {
@@ -942,12 +1455,18 @@ func processCommand(c *Client) error {
 	*/
 
 	call(c, CmdCallFull)
+	if server.readyKeys.Len() > 0 {
+		handleClientsBlockedOnKeys()
+	}
 	return C_OK
 }
 
 func call(c *Client, flags int) {
 	realCmd := c.cmd
 
+	// 传播相关的标志只对本次命令有效
+	c.flags &^= CLIENT_FORCE_AOF | CLIENT_FORCE_REPL | CLIENT_PREVENT_PROP
+
 	start := server.ustime
 	c.cmd.proc(c)
 	duration := time.Now().UnixMicro() - start
@@ -994,6 +1513,10 @@ func flagTransaction(c *Client) {
 func lookupCommand(key unsafe.Pointer) *redisCommand {
 	return (*redisCommand)(server.commands.FetchValue(key))
 }
+func lookupCommandByCString(name string) *redisCommand {
+	s := sds.NewLen(name)
+	return lookupCommand(unsafe.Pointer(&s))
+}
 func lookupCommandOrOriginal(key unsafe.Pointer) *redisCommand {
 	cmd := (*redisCommand)(server.commands.FetchValue(key))
 	if cmd == nil {
@@ -1011,7 +1534,8 @@ type shareObject struct {
 	masterDownErr, roSlaveErr, execAbortErr, noAuthErr, noReplicateErr *robj
 	busyKeyErr, oomErr, plus, messageBulk, pMessageBulk, subscribeBulk *robj
 	unsubscribeBulk, pSubscribeBulk, pUnsubscribeBulk, del, unlink     *robj
-	rpop, lpop, lpush, rpoplpush, zpopmin, zpopmax, emptyScan          *robj
+	rpop, lpop, lpush, rpoplpush, zpopmin, zpopmax, emptyScan, hset    *robj
+	hdel, hpexpireat, srem, pexpireat                                  *robj
 	multi, exec                                                        *robj
 	selec                                                              [ProtoSharedSelectCmds]*robj
 	integers                                                           [ObjSharedIntegers]*robj
@@ -1106,6 +1630,11 @@ func createSharedObjects() {
 	shared.lpop = createStringObject("LPOP")
 	shared.lpush = createStringObject("LPUSH")
 	shared.rpoplpush = createStringObject("RPOPLPUSH")
+	shared.hset = createStringObject("HSET")
+	shared.hdel = createStringObject("HDEL")
+	shared.hpexpireat = createStringObject("HPEXPIREAT")
+	shared.pexpireat = createStringObject("PEXPIREAT")
+	shared.srem = createStringObject("SREM")
 	shared.zpopmin = createStringObject("ZPOPMIN")
 	shared.zpopmax = createStringObject("ZPOPMAX")
 	shared.multi = createStringObject("MULTI")
@@ -1150,6 +1679,14 @@ var keyPtrDictType = &dict.Type{
 	KeyDestructor: nil,
 	ValDestructor: nil,
 }
+var keyDictType = &dict.Type{
+	HashFunction:  dictSdsHash,
+	KeyDup:        nil,
+	ValDup:        nil,
+	KeyCompare:    dictSdsKeyCompare,
+	KeyDestructor: dictSdsDestructor,
+	ValDestructor: nil,
+}
 var keyListDictType = &dict.Type{
 	HashFunction:  dictObjHash,
 	KeyDup:        nil,
@@ -1174,6 +1711,22 @@ var hashDictType = &dict.Type{
 	KeyDestructor: dictSdsDestructor,
 	ValDestructor: dictSdsDestructor,
 }
+var hashFieldExpiresDictType = &dict.Type{
+	HashFunction:  dictSdsHash,
+	KeyDup:        nil,
+	ValDup:        nil,
+	KeyCompare:    dictSdsKeyCompare,
+	KeyDestructor: dictSdsDestructor,
+	ValDestructor: nil,
+}
+var zsetDictType = &dict.Type{
+	HashFunction:  dictSdsHash,
+	KeyDup:        nil,
+	ValDup:        nil,
+	KeyCompare:    dictSdsKeyCompare,
+	KeyDestructor: nil,
+	ValDestructor: nil,
+}
 var setDictType = &dict.Type{
 	HashFunction:  dictSdsCaseHash,
 	KeyDup:        nil,
@@ -1228,7 +1781,7 @@ func dictEncObjHash(key unsafe.Pointer) uint64 {
 	}
 }
 func dictEncObjKeyCompare(privData interface{}, key1, key2 unsafe.Pointer) bool {
-	o1, o2 := (*robj)(key1), (*robj)(key1)
+	o1, o2 := (*robj)(key1), (*robj)(key2)
 	if o1.getEncoding() == ObjEncodingInt && o2.getEncoding() == ObjEncodingInt {
 		return *(*int)(o1.ptr) == *(*int)(o2.ptr)
 	}
@@ -1250,6 +1803,19 @@ func dictEncObjKeyCompare(privData interface{}, key1, key2 unsafe.Pointer) bool
 }
 
 func beforeSleep(eventLoop *ae.EventLoop) {
+	// 处理超时的阻塞客户端
+	handleBlockedClientsTimeout()
+
+	// 处理刚刚解除阻塞的客户端中积压的命令
+	if server.unblockedClients.Len() > 0 {
+		processUnblockedClients()
+	}
+
+	// 服务在就绪的key上阻塞的客户端
+	if server.readyKeys.Len() > 0 {
+		handleClientsBlockedOnKeys()
+	}
+
 	handleClientsWithPendingWrites()
 
 	if server.activeExpireEnabled && server.masterhost == "" {
@@ -1259,6 +1825,74 @@ func beforeSleep(eventLoop *ae.EventLoop) {
 	flushAppendOnlyFile(0)
 }
 
+// genRedisInfoString 生成INFO命令返回的内容，section为default、all或者everything时返回所有的section
+func genRedisInfoString(section string) string {
+	allsections := section == "default" || section == "all" || section == "everything"
+	var info strings.Builder
+	sections := 0
+
+	if allsections || section == "memory" {
+		if sections > 0 {
+			info.WriteString("\r\n")
+		}
+		sections++
+		fmt.Fprintf(&info, "# Memory\r\n"+
+			"lazyfree_pending_objects:%d\r\n",
+			lazyfreeGetPendingObjectsCount())
+	}
+
+	if allsections || section == "stats" {
+		if sections > 0 {
+			info.WriteString("\r\n")
+		}
+		sections++
+		fmt.Fprintf(&info, "# Stats\r\n"+
+			"total_connections_received:%d\r\n"+
+			"total_reads_processed:%d\r\n"+
+			"total_net_output_bytes:%d\r\n"+
+			"rejected_connections:%d\r\n"+
+			"expired_keys:%d\r\n"+
+			"expired_subkeys:%d\r\n"+
+			"lazyfreed_objects:%d\r\n",
+			server.statNumConnections,
+			server.statTotalReadsProcessed,
+			server.statNetOutputBytes,
+			server.statRejectedConn,
+			server.statExpiredKeys,
+			server.statExpiredSubkeys,
+			lazyfreeGetFreedObjectsCount())
+	}
+
+	if allsections || section == "keyspace" {
+		if sections > 0 {
+			info.WriteString("\r\n")
+		}
+		sections++
+		info.WriteString("# Keyspace\r\n")
+		for j := 0; j < server.dbnum; j++ {
+			keys := server.db[j].dict.Size()
+			vkeys := server.db[j].expires.Size()
+			if keys > 0 || vkeys > 0 {
+				fmt.Fprintf(&info, "db%d:keys=%d,expires=%d,avg_ttl=%d\r\n",
+					j, keys, vkeys, server.db[j].avgTTL)
+			}
+		}
+	}
+	return info.String()
+}
+
+// INFO [section]
+func infoCommand(c *Client) {
+	section := "default"
+	if c.argc == 2 {
+		section = strings.ToLower(util.Bytes2String((*sds.SDS)(c.argv[1].ptr).BufData(0)))
+	} else if c.argc > 2 {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+	addReplyBulkCString(c, genRedisInfoString(section))
+}
+
 func hasActiveChildProcess() bool {
 	return server.rdbChildPid != -1 || server.aofChildPid != -1 || server.moduleChildPid != -1
 }
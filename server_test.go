@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pengdafu/redis-golang/adlist"
+	"github.com/pengdafu/redis-golang/dict"
+	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testServerInit 和InitServer一样初始化server和db，但是不创建事件循环，也不监听端口
+func testServerInit() {
+	server = new(RedisServer)
+	dict.SetHashFunctionSeed(util.GetRandomBytes(16))
+	initServerConfig()
+	createSharedObjects()
+	server.db = make([]*redisDb, server.dbnum)
+	for i := 0; i < server.dbnum; i++ {
+		db := &redisDb{}
+		db.dict = dict.Create(dbDictType, nil)
+		db.expires = dict.Create(keyPtrDictType, nil)
+		db.hexpires = dict.Create(keyDictType, nil)
+		db.blockingKeys = dict.Create(keyListDictType, nil)
+		db.watchedKeys = dict.Create(keyListDictType, nil)
+		db.readyKeys = dict.Create(objectKeyPointValueDictType, nil)
+		db.id = i
+		db.defragLater = adlist.Create()
+		server.db[i] = db
+	}
+	if lazyfreeJobs == nil {
+		lazyfreeInit()
+	}
+	updateCachedTime(0)
+}
+
+// testClient 创建一个没有真实连接的客户端，回复留在c.buf和c.reply中，由testReply读取
+func testClient() *Client {
+	c := createClient(nil)
+	c.conn = &Connection{Fd: -1}
+	return c
+}
+
+// testCommand 像processCommand一样执行一条命令，返回testReply格式化后的回复
+func testCommand(c *Client, args ...string) string {
+	c.argc = len(args)
+	c.argv = make([]*robj, len(args))
+	for i, arg := range args {
+		c.argv[i] = createStringObject(arg)
+	}
+	updateCachedTime(0)
+	processCommand(c)
+	return testReply(c)
+}
+
+// testReply 取出并清空客户端的回复，格式化成一个便于比较的字符串：
+// 状态回复为+OK，错误为-ERR ...，整数为:1，空回复为(nil)，
+// bulk回复就是内容本身，数组为[a b c]
+func testReply(c *Client) string {
+	var buf []byte
+	buf = append(buf, c.buf[:c.bufpos]...)
+	iter := c.reply.Rewind()
+	for ln := iter.Next(); ln != nil; ln = iter.Next() {
+		if block, ok := ln.NodeValue().(*clientReplyBlock); ok {
+			buf = append(buf, block.buf[:block.used]...)
+		}
+	}
+	c.bufpos = 0
+	c.reply = adlist.Create()
+	c.replyBytes = 0
+
+	var replies []string
+	for len(buf) > 0 {
+		var s string
+		s, buf = testParseReply(buf)
+		replies = append(replies, s)
+	}
+	return strings.Join(replies, " ")
+}
+
+func testParseReply(buf []byte) (string, []byte) {
+	end := strings.Index(string(buf), "\r\n")
+	line, rest := string(buf[1:end]), buf[end+2:]
+	switch buf[0] {
+	case '+', '-':
+		return string(buf[:end]), rest
+	case ':':
+		return ":" + line, rest
+	case '_':
+		return "(nil)", rest
+	case ',':
+		return line, rest
+	case '$':
+		n, _ := strconv.Atoi(line)
+		if n < 0 {
+			return "(nil)", rest
+		}
+		return string(rest[:n]), rest[n+2:]
+	case '*', '%':
+		n, _ := strconv.Atoi(line)
+		if n < 0 {
+			return "(nil)", rest
+		}
+		if buf[0] == '%' {
+			n *= 2
+		}
+		items := make([]string, n)
+		for i := range items {
+			items[i], rest = testParseReply(rest)
+		}
+		return "[" + strings.Join(items, " ") + "]", rest
+	}
+	panic(fmt.Sprintf("unknown reply %q", buf))
+}
+
+// testArgv 把客户端当前的参数格式化成[a b c]，用于检查命令改写后的传播形式
+func testArgv(c *Client) string {
+	args := make([]string, c.argc)
+	for i, arg := range c.argv[:c.argc] {
+		args[i] = string((*sds.SDS)(arg.getDecodedObject().ptr).BufData(0))
+	}
+	return "[" + strings.Join(args, " ") + "]"
+}
+
+// testCase 一条命令和它期望的回复，命令按空白拆分成参数
+type testCase struct {
+	cmd    string
+	expect string
+}
+
+// testRun 依次执行cases中的命令并检查回复
+func testRun(t *testing.T, c *Client, cases []testCase) {
+	t.Helper()
+	for _, tc := range cases {
+		if reply := testCommand(c, strings.Fields(tc.cmd)...); reply != tc.expect {
+			t.Errorf("%s: expect %q, got %q", tc.cmd, tc.expect, reply)
+		}
+	}
+}
+
+// testArgsCase 参数中有空字符串的命令，不能按空白拆分
+type testArgsCase struct {
+	args   []string
+	expect string
+}
+
+func testArgsRun(t *testing.T, c *Client, cases []testArgsCase) {
+	t.Helper()
+	for _, tc := range cases {
+		if reply := testCommand(c, tc.args...); reply != tc.expect {
+			t.Errorf("%q: expect %q, got %q", tc.args, tc.expect, reply)
+		}
+	}
+}
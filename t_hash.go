@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"github.com/pengdafu/redis-golang/dict"
+	"github.com/pengdafu/redis-golang/listpack"
 	"github.com/pengdafu/redis-golang/sds"
-	"github.com/pengdafu/redis-golang/ziplist"
+	"github.com/pengdafu/redis-golang/util"
+	"math"
+	"strconv"
 	"unsafe"
 )
 
@@ -39,46 +42,54 @@ const (
 	hashSetCopy      = 0
 	hashSetTakeFiled = 1 << 0
 	hashSetTakeValue = 1 << 1
+	hashSetKeepTtl   = 1 << 2 // 更新field时保留它的过期时间
 )
 
 func hashTypeSet(o *robj, field, value sds.SDS, flags int) int {
 	var update = 0
 
-	if o.getEncoding() == ObjEncodingZipList {
+	if o.getEncoding() == ObjEncodingListPack {
 		zl := *(*[]byte)(o.ptr)
-		fptr := ziplist.Index(zl, ziplist.Head)
+		fptr := listpack.Index(zl, listpack.Head)
 		var vptr []byte
 		if fptr != nil {
-			fptr = ziplist.Find(fptr, field.BufData(0), sds.Len(field), 1)
+			fptr = listpack.Find(fptr, field.BufData(0), sds.Len(field), 1)
 			if fptr != nil {
-				vptr = ziplist.Next(zl, fptr)
+				vptr = listpack.Next(zl, fptr)
 				update = 1
 
-				zl = ziplist.Delete(zl, &vptr)
-				zl = ziplist.Insert(zl, vptr, value.BufData(0))
+				zl = listpack.Delete(zl, &vptr)
+				zl = listpack.Insert(zl, vptr, value.BufData(0))
 			}
 		}
 
 		if update == 0 {
-			zl = ziplist.Push(zl, field.BufData(0), ziplist.Tail)
-			zl = ziplist.Push(zl, value.BufData(0), ziplist.Tail)
+			zl = listpack.Push(zl, field.BufData(0), listpack.Tail)
+			zl = listpack.Push(zl, value.BufData(0), listpack.Tail)
 		}
 		o.ptr = unsafe.Pointer(&zl)
 
-		if hashTypeLength(o) > server.hashMaxZipListEntries {
+		if hashTypeLength(o) > server.hashMaxListpackEntries {
 			hashTypeConvert(o, ObjEncodingHt)
 		}
 	} else if o.getEncoding() == ObjEncodingHt {
 		d := (*dict.Dict)(o.ptr)
 		de := d.Find(unsafe.Pointer(&field))
 		if de != nil {
+			// 已经过期但还没有被回收的field当作新建的field
+			expired := hashTypeFieldIsExpired(o, field)
 			if flags&hashSetTakeValue > 0 {
 				dict.SetVal(de, unsafe.Pointer(&value))
 			} else {
 				dup := sds.Dup(value)
 				dict.SetVal(de, unsafe.Pointer(&dup))
 			}
-			update = 1
+			if expired || flags&hashSetKeepTtl == 0 {
+				hashTypeRemoveFieldExpire(o, field)
+			}
+			if !expired {
+				update = 1
+			}
 		} else {
 			var f, v sds.SDS
 			if flags&hashSetTakeFiled > 0 {
@@ -112,7 +123,7 @@ func hgetCommand(c *Client) {
 		return
 	}
 
-	addHashFieldToReply(c, o, *(*sds.SDS)(c.argv[2].ptr))
+	addHashFieldToReply(c, c.argv[1], o, *(*sds.SDS)(c.argv[2].ptr))
 }
 
 func hmgetCommand(c *Client) {
@@ -124,7 +135,7 @@ func hmgetCommand(c *Client) {
 
 	addReplyArrayLen(c, c.argc-2)
 	for i := 2; i < c.argc; i++ {
-		addHashFieldToReply(c, o, *(*sds.SDS)(c.argv[i].ptr))
+		addHashFieldToReply(c, c.argv[1], o, *(*sds.SDS)(c.argv[i].ptr))
 	}
 }
 
@@ -160,14 +171,14 @@ func hdelCommand(c *Client) {
 
 func hashTypeDelete(o *robj, field sds.SDS) bool {
 	var deleted bool
-	if o.getEncoding() == ObjEncodingZipList {
+	if o.getEncoding() == ObjEncodingListPack {
 		zl := *(*[]byte)(o.ptr)
-		fptr := ziplist.Index(zl, ziplist.Head)
+		fptr := listpack.Index(zl, listpack.Head)
 		if fptr != nil {
-			fptr = ziplist.Find(fptr, field.BufData(0), sds.Len(field), 1)
+			fptr = listpack.Find(fptr, field.BufData(0), sds.Len(field), 1)
 			if fptr != nil {
-				zl = ziplist.Delete(zl, &fptr) // delete key
-				zl = ziplist.Delete(zl, &fptr) // delete value
+				zl = listpack.Delete(zl, &fptr) // delete key
+				zl = listpack.Delete(zl, &fptr) // delete value
 				o.ptr = unsafe.Pointer(&zl)
 				deleted = true
 			}
@@ -176,6 +187,7 @@ func hashTypeDelete(o *robj, field sds.SDS) bool {
 		d := (*dict.Dict)(o.ptr)
 		if d.Delete(unsafe.Pointer(&field)) {
 			deleted = true
+			hashTypeRemoveFieldExpire(o, field)
 			if htNeedResize(d) {
 				d.Resize()
 			}
@@ -199,11 +211,11 @@ func hvalsCommand(c *Client) {
 }
 
 func addHashIteratorCursorToReply(c *Client, hi *hashTypeIterator, what int) {
-	if hi.encoding == ObjEncodingZipList {
+	if hi.encoding == ObjEncodingListPack {
 		var vstr []byte
 		var vlen int
 		var vll int64
-		hashTypeCurrentFromZiplist(hi, what, &vstr, &vlen, &vll)
+		hashTypeCurrentFromListpack(hi, what, &vstr, &vlen, &vll)
 		if vstr != nil {
 			addReplyBulkBuffer(c, vstr, vlen)
 		} else {
@@ -228,6 +240,10 @@ func genericHgetallCommand(c *Client, flags int) {
 	if o = lookupKeyReadOrReply(c, c.argv[1], emptyResp); o == nil || o.checkType(c, ObjHash) {
 		return
 	}
+	if hashTypeExpireFields(c.db, c.argv[1], o, mstime()) {
+		addReply(c, emptyResp)
+		return
+	}
 
 	length := hashTypeLength(o)
 	if flags&objHashKey > 0 && flags&objHashValue > 0 {
@@ -259,34 +275,21 @@ func genericHgetallCommand(c *Client, flags int) {
 	}
 }
 
-func addHashFieldToReply(c *Client, o *robj, field sds.SDS) {
+func addHashFieldToReply(c *Client, key, o *robj, field sds.SDS) {
 	if o == nil {
 		addReplyNull(c)
 		return
 	}
 
-	if o.getEncoding() == ObjEncodingZipList {
-		var vstr []byte
-		var vlen int
-		var vll int64
-		if hashTypeGetFromZiplist(o, field, &vstr, &vlen, &vll) < 0 {
-			addReplyNull(c)
-		} else {
-			if vstr != nil {
-				addReplyBulkBuffer(c, vstr, vlen)
-			} else {
-				addReplyBulkLongLong(c, vll)
-			}
-		}
-	} else if o.getEncoding() == ObjEncodingHt {
-		value := hashTypeGetFromHashTable(o, field)
-		if value != nil {
-			addReplyBulkBuffer(c, value.BufData(0), sds.Len(*value))
-		} else {
-			addReplyNull(c)
-		}
+	var vstr []byte
+	var vlen int
+	var vll int64
+	if hashTypeGetValue(c.db, key, o, field, hfeLazyExpire, &vstr, &vlen, &vll) != C_OK {
+		addReplyNull(c)
+	} else if vstr != nil {
+		addReplyBulkBuffer(c, vstr, vlen)
 	} else {
-		panic("Unknown hash encoding")
+		addReplyBulkLongLong(c, vll)
 	}
 }
 
@@ -300,19 +303,19 @@ func hashTypeGetFromHashTable(o *robj, field sds.SDS) *sds.SDS {
 	return (*sds.SDS)(dict.GetVal(de))
 }
 
-func hashTypeGetFromZiplist(o *robj, field sds.SDS, vstr *[]byte, vlen *int, vll *int64) (ret int) {
+func hashTypeGetFromListpack(o *robj, field sds.SDS, vstr *[]byte, vlen *int, vll *int64) (ret int) {
 	zl := *(*[]byte)(o.ptr)
-	fptr := ziplist.Index(zl, ziplist.Head)
+	fptr := listpack.Index(zl, listpack.Head)
 	var vptr []byte
 	if fptr != nil {
-		fptr = ziplist.Find(fptr, field.BufData(0), sds.Len(field), 1)
+		fptr = listpack.Find(fptr, field.BufData(0), sds.Len(field), 1)
 		if fptr != nil {
-			vptr = ziplist.Next(zl, fptr)
+			vptr = listpack.Next(zl, fptr)
 		}
 	}
 
 	if vptr != nil {
-		if !ziplist.Get(vptr, vstr, vlen, vll) {
+		if !listpack.Get(vptr, vstr, vlen, vll) {
 			return -1
 		}
 		return 0
@@ -320,6 +323,85 @@ func hashTypeGetFromZiplist(o *robj, field sds.SDS, vstr *[]byte, vlen *int, vll
 	return -1
 }
 
+// hashTypeGetValue 获取field的值，listpack中的整数保存在vll中，此时vstr为nil。field不存在或者已经过期时返回C_ERR，
+// 过期的field会按照hfeFlags被惰性删除
+func hashTypeGetValue(db *redisDb, key, o *robj, field sds.SDS, hfeFlags int, vstr *[]byte, vlen *int, vll *int64) error {
+	if o.getEncoding() == ObjEncodingListPack {
+		*vstr = nil
+		if hashTypeGetFromListpack(o, field, vstr, vlen, vll) == 0 {
+			return C_OK
+		}
+	} else if o.getEncoding() == ObjEncodingHt {
+		if hashTypeFieldExpireIfNeeded(db, key, o, field, hfeFlags) {
+			return C_ERR
+		}
+		if value := hashTypeGetFromHashTable(o, field); value != nil {
+			*vstr = value.BufData(0)
+			*vlen = sds.Len(*value)
+			return C_OK
+		}
+	} else {
+		panic("Unknown hash encoding")
+	}
+	return C_ERR
+}
+
+// hashTypeGetValueLength 返回field的值的长度，field不存在时返回0
+func hashTypeGetValueLength(db *redisDb, key, o *robj, field sds.SDS) int {
+	var vstr []byte
+	var vlen int
+	var vll int64
+	if hashTypeGetValue(db, key, o, field, hfeLazyExpire, &vstr, &vlen, &vll) != C_OK {
+		return 0
+	}
+	if vstr != nil {
+		return vlen
+	}
+	return len(strconv.FormatInt(vll, 10))
+}
+
+// hashTypeExists 判断field是否存在
+func hashTypeExists(db *redisDb, key, o *robj, field sds.SDS, hfeFlags int) bool {
+	var vstr []byte
+	var vlen int
+	var vll int64
+	return hashTypeGetValue(db, key, o, field, hfeFlags, &vstr, &vlen, &vll) == C_OK
+}
+
+// hashTypeRandomElement 随机返回一个field，val不为nil时同时返回value。hashsize是hash的长度
+func hashTypeRandomElement(hashobj *robj, hashsize int, key, val *listpack.Entry) {
+	if hashobj.getEncoding() == ObjEncodingHt {
+		de := (*dict.Dict)(hashobj.ptr).GetFairRandomKey()
+		field := *(*sds.SDS)(dict.GetKey(de))
+		key.Sval, key.Slen = field.BufData(0), sds.Len(field)
+		if val != nil {
+			value := *(*sds.SDS)(dict.GetVal(de))
+			val.Sval, val.Slen = value.BufData(0), sds.Len(value)
+		}
+	} else if hashobj.getEncoding() == ObjEncodingListPack {
+		listpack.RandomPair(*(*[]byte)(hashobj.ptr), hashsize, key, val)
+	} else {
+		panic("Unknown hash encoding")
+	}
+}
+
+// hashReplyFromListpackEntry 回复listpack.Entry中保存的字符串或者整数
+func hashReplyFromListpackEntry(c *Client, e *listpack.Entry) {
+	if e.Sval != nil {
+		addReplyBulkBuffer(c, e.Sval, e.Slen)
+	} else {
+		addReplyBulkLongLong(c, e.Lval)
+	}
+}
+
+// hashSdsFromListpackEntry 把listpack.Entry转换成sds
+func hashSdsFromListpackEntry(e *listpack.Entry) sds.SDS {
+	if e.Sval != nil {
+		return sds.NewLen(e.Sval[:e.Slen])
+	}
+	return sds.FromLongLong(e.Lval)
+}
+
 func hashTypeLookupWriteOrCreate(c *Client, key *robj) *robj {
 	o := c.db.lookupKeyWrite(key)
 	if o == nil {
@@ -336,29 +418,29 @@ func hashTypeLookupWriteOrCreate(c *Client, key *robj) *robj {
 
 func hashTypeTryConversion(o *robj, argv []*robj, start, end int) {
 	sum := 0
-	if o.getEncoding() != ObjEncodingZipList {
+	if o.getEncoding() != ObjEncodingListPack {
 		return
 	}
 	for i := start; i <= end; i++ {
 		if !argv[i].sdsEncodedObject() {
 			continue
 		}
-		l := sds.Len(*(*sds.SDS)(o.ptr))
-		if l > server.hashMaxZipListValue {
+		l := sds.Len(*(*sds.SDS)(argv[i].ptr))
+		if l > server.hashMaxListpackValue {
 			hashTypeConvert(o, ObjEncodingHt)
 			return
 		}
 		sum += l
 	}
 
-	if !ziplist.SafeToAdd(*(*[]byte)(o.ptr), sum) {
+	if !listpack.SafeToAdd(*(*[]byte)(o.ptr), sum) {
 		hashTypeConvert(o, ObjEncodingHt)
 	}
 }
 
 func hashTypeConvert(o *robj, enc uint32) {
-	if o.getEncoding() == ObjEncodingZipList {
-		hashTypeConvertZiplist(o, enc)
+	if o.getEncoding() == ObjEncodingListPack {
+		hashTypeConvertListpack(o, enc)
 	} else if o.getEncoding() == ObjEncodingHt {
 		panic("Not implemented")
 	} else {
@@ -369,7 +451,7 @@ func hashTypeConvert(o *robj, enc uint32) {
 type hashTypeIterator struct {
 	subject    *robj
 	encoding   int
-	fptr, vptr []byte // ziplist fptr: key, vptr: value
+	fptr, vptr []byte // listpack fptr: key, vptr: value
 
 	de *dict.Entry
 	di *dict.Iterator
@@ -380,8 +462,8 @@ const (
 	objHashValue = 2
 )
 
-func hashTypeConvertZiplist(o *robj, enc uint32) {
-	if enc == ObjEncodingZipList {
+func hashTypeConvertListpack(o *robj, enc uint32) {
+	if enc == ObjEncodingListPack {
 		/* Nothing to do */
 	} else if enc == ObjEncodingHt {
 		hi := hashTypeInitIterator(o)
@@ -391,7 +473,7 @@ func hashTypeConvertZiplist(o *robj, enc uint32) {
 			key := hashTypeCurrentObjectNewSds(hi, objHashKey)
 			value := hashTypeCurrentObjectNewSds(hi, objHashValue)
 			if !dt.Add(unsafe.Pointer(&key), unsafe.Pointer(&value)) {
-				panic("Ziplist corruption detected")
+				panic("Listpack corruption detected")
 			}
 		}
 		hashTypeReleaseIterator(hi)
@@ -402,9 +484,42 @@ func hashTypeConvertZiplist(o *robj, enc uint32) {
 	}
 }
 
+// hashTypeDup 复制一个hash对象，新对象的编码和原对象相同，field的过期时间也会一起复制
+func hashTypeDup(o *robj) *robj {
+	var hobj *robj
+	if o.getEncoding() == ObjEncodingListPack {
+		zl := append([]byte(nil), *(*[]byte)(o.ptr)...)
+		hobj = createObject(ObjHash, zl)
+		hobj.setEncoding(ObjEncodingListPack)
+	} else if o.getEncoding() == ObjEncodingHt {
+		d := dict.Create(hashDictType, nil)
+		d.Expand((*dict.Dict)(o.ptr).Size())
+		hi := hashTypeInitIterator(o)
+		for hashTypeNext(hi) != C_ERR {
+			field := hashTypeCurrentObjectNewSds(hi, objHashKey)
+			value := hashTypeCurrentObjectNewSds(hi, objHashValue)
+			d.Add(unsafe.Pointer(&field), unsafe.Pointer(&value))
+		}
+		hashTypeReleaseIterator(hi)
+		hobj = createObject(ObjHash, *d)
+		hobj.setEncoding(ObjEncodingHt)
+
+		if fe := hashTypeFieldExpires(o); fe != nil {
+			di := fe.GetIterator()
+			for de := di.Next(); de != nil; de = di.Next() {
+				hashTypeSetFieldExpire(hobj, *(*sds.SDS)(dict.GetKey(de)), dict.GetSignedIntegerVal(de))
+			}
+			di.Release()
+		}
+	} else {
+		panic("Unknown hash encoding")
+	}
+	return hobj
+}
+
 func hashTypeLength(o *robj) (l int) {
-	if o.getEncoding() == ObjEncodingZipList {
-		l = ziplist.Len(*(*[]byte)(o.ptr)) / 2 // kv
+	if o.getEncoding() == ObjEncodingListPack {
+		l = listpack.Len(*(*[]byte)(o.ptr)) / 2 // kv
 	} else if o.getEncoding() == ObjEncodingHt {
 		l = int((*dict.Dict)(o.ptr).Size())
 	} else {
@@ -427,9 +542,9 @@ func hashTypeCurrentObjectNewSds(hi *hashTypeIterator, what int) sds.SDS {
 }
 
 func hashTypeCurrentObject(hi *hashTypeIterator, what int, vstr *[]byte, vlen *int, vll *int64) {
-	if hi.encoding == ObjEncodingZipList {
+	if hi.encoding == ObjEncodingListPack {
 		*vstr = nil
-		hashTypeCurrentFromZiplist(hi, what, vstr, vlen, vll)
+		hashTypeCurrentFromListpack(hi, what, vstr, vlen, vll)
 	} else if hi.encoding == ObjEncodingHt {
 		ele := hashTypeCurrentFromHashTable(hi, what)
 		*vstr = ele.BufData(0)
@@ -450,11 +565,11 @@ func hashTypeCurrentFromHashTable(hi *hashTypeIterator, what int) sds.SDS {
 	return *(*sds.SDS)(p)
 }
 
-func hashTypeCurrentFromZiplist(hi *hashTypeIterator, what int, vstr *[]byte, vlen *int, vll *int64) {
+func hashTypeCurrentFromListpack(hi *hashTypeIterator, what int, vstr *[]byte, vlen *int, vll *int64) {
 	if what&objHashKey > 0 {
-		ziplist.Get(hi.fptr, vstr, vlen, vll)
+		listpack.Get(hi.fptr, vstr, vlen, vll)
 	} else {
-		ziplist.Get(hi.vptr, vstr, vlen, vll)
+		listpack.Get(hi.vptr, vstr, vlen, vll)
 	}
 }
 
@@ -465,19 +580,19 @@ func hashTypeReleaseIterator(hi *hashTypeIterator) {
 }
 
 func hashTypeNext(hi *hashTypeIterator) error {
-	if hi.encoding == ObjEncodingZipList {
+	if hi.encoding == ObjEncodingListPack {
 		zl := *(*[]byte)(hi.subject.ptr)
 		fptr := hi.fptr
 		vptr := hi.vptr
 		if fptr == nil {
-			fptr = ziplist.Index(zl, 0)
+			fptr = listpack.Index(zl, 0)
 		} else {
-			fptr = ziplist.Next(zl, vptr)
+			fptr = listpack.Next(zl, vptr)
 		}
 		if fptr == nil {
 			return C_ERR
 		}
-		vptr = ziplist.Next(zl, fptr)
+		vptr = listpack.Next(zl, fptr)
 		hi.fptr = fptr
 		hi.vptr = vptr
 	} else if hi.encoding == ObjEncodingHt {
@@ -494,7 +609,7 @@ func hashTypeInitIterator(subject *robj) *hashTypeIterator {
 	hi := new(hashTypeIterator)
 	hi.subject = subject
 	hi.encoding = int(subject.getEncoding())
-	if hi.encoding == ObjEncodingZipList {
+	if hi.encoding == ObjEncodingListPack {
 		hi.fptr = nil
 		hi.vptr = nil
 	} else if hi.encoding == ObjEncodingHt {
@@ -506,8 +621,845 @@ func hashTypeInitIterator(subject *robj) *hashTypeIterator {
 }
 
 func createHashObject() *robj {
-	zl := ziplist.New()
+	zl := listpack.New()
 	o := createObject(ObjHash, zl)
-	o.setEncoding(ObjEncodingZipList)
+	o.setEncoding(ObjEncodingListPack)
 	return o
 }
+
+// HSETNX key field value
+func hsetnxCommand(c *Client) {
+	var o *robj
+	if o = hashTypeLookupWriteOrCreate(c, c.argv[1]); o == nil {
+		return
+	}
+
+	if hashTypeExists(c.db, c.argv[1], o, *(*sds.SDS)(c.argv[2].ptr), hfeLazyAvoidHashDel) {
+		addReply(c, shared.czero)
+		return
+	}
+
+	hashTypeTryConversion(o, c.argv, 2, 3)
+	hashTypeSet(o, *(*sds.SDS)(c.argv[2].ptr), *(*sds.SDS)(c.argv[3].ptr), hashSetCopy)
+	addReply(c, shared.cone)
+	signalModifiedKey(c, c.db, c.argv[1])
+	notifyKeySpaceEvent(notifyHash, "hset", c.argv[1], c.db.id)
+	server.dirty++
+}
+
+// HINCRBY key field increment
+func hincrbyCommand(c *Client) {
+	var incr int64
+	if c.argv[3].getLongLongFromObjectOrReply(c, &incr, "") != C_OK {
+		return
+	}
+	var o *robj
+	if o = hashTypeLookupWriteOrCreate(c, c.argv[1]); o == nil {
+		return
+	}
+
+	var vstr []byte
+	var vlen int
+	var value int64
+	if hashTypeGetValue(c.db, c.argv[1], o, *(*sds.SDS)(c.argv[2].ptr), hfeLazyAvoidHashDel, &vstr, &vlen, &value) == C_OK {
+		// listpack中的整数已经保存在value中了
+		if vstr != nil && !util.String2Int64(vstr[:vlen], &value) {
+			addReplyError(c, "hash value is not an integer")
+			return
+		}
+	} else {
+		value = 0
+	}
+
+	oldvalue := value
+	if (incr < 0 && oldvalue < 0 && incr < (math.MinInt64-oldvalue)) ||
+		(incr > 0 && oldvalue > 0 && incr > (math.MaxInt64-oldvalue)) {
+		addReplyError(c, "increment or decrement would overflow")
+		return
+	}
+	value += incr
+	// 写入listpack时会尽量使用整数编码
+	hashTypeSet(o, *(*sds.SDS)(c.argv[2].ptr), sds.FromLongLong(value), hashSetTakeValue|hashSetKeepTtl)
+	addReplyLongLong(c, int(value))
+	signalModifiedKey(c, c.db, c.argv[1])
+	notifyKeySpaceEvent(notifyHash, "hincrby", c.argv[1], c.db.id)
+	server.dirty++
+}
+
+// HINCRBYFLOAT key field increment
+func hincrbyfloatCommand(c *Client) {
+	var incr float64
+	if c.argv[3].getDoubleFromObjectOrReply(c, &incr, "") != C_OK {
+		return
+	}
+	if math.IsNaN(incr) || math.IsInf(incr, 0) {
+		addReplyError(c, "value is NaN or Infinity")
+		return
+	}
+	var o *robj
+	if o = hashTypeLookupWriteOrCreate(c, c.argv[1]); o == nil {
+		return
+	}
+
+	var vstr []byte
+	var vlen int
+	var ll int64
+	var value float64
+	if hashTypeGetValue(c.db, c.argv[1], o, *(*sds.SDS)(c.argv[2].ptr), hfeLazyAvoidHashDel, &vstr, &vlen, &ll) == C_OK {
+		if vstr != nil {
+			if !util.String2D(vstr[:vlen], &value) {
+				addReplyError(c, "hash value is not a float")
+				return
+			}
+		} else {
+			value = float64(ll)
+		}
+	} else {
+		value = 0
+	}
+
+	value += incr
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		addReplyError(c, "increment would produce NaN or Infinity")
+		return
+	}
+
+	buf := util.LD2String(value, true)
+	hashTypeSet(o, *(*sds.SDS)(c.argv[2].ptr), sds.NewLen(buf), hashSetTakeValue|hashSetKeepTtl)
+	addReplyBulkCString(c, buf)
+	signalModifiedKey(c, c.db, c.argv[1])
+	notifyKeySpaceEvent(notifyHash, "hincrbyfloat", c.argv[1], c.db.id)
+	server.dirty++
+
+	// 总是以HSET的形式传播最终的值，避免副本或者AOF重放时因为浮点数精度产生差异
+	newobj := createRawStringObject(util.String2Bytes(buf))
+	rewriteClientCommandArgument(c, 0, shared.hset)
+	rewriteClientCommandArgument(c, 3, newobj)
+	newobj.decrRefCount()
+}
+
+// HLEN key
+func hlenCommand(c *Client) {
+	var o *robj
+	if o = lookupKeyReadOrReply(c, c.argv[1], shared.czero); o == nil || o.checkType(c, ObjHash) {
+		return
+	}
+	if hashTypeExpireFields(c.db, c.argv[1], o, mstime()) {
+		addReply(c, shared.czero)
+		return
+	}
+	addReplyLongLong(c, hashTypeLength(o))
+}
+
+// HSTRLEN key field
+func hstrlenCommand(c *Client) {
+	var o *robj
+	if o = lookupKeyReadOrReply(c, c.argv[1], shared.czero); o == nil || o.checkType(c, ObjHash) {
+		return
+	}
+	addReplyLongLong(c, hashTypeGetValueLength(c.db, c.argv[1], o, *(*sds.SDS)(c.argv[2].ptr)))
+}
+
+// HEXISTS key field
+func hexistsCommand(c *Client) {
+	var o *robj
+	if o = lookupKeyReadOrReply(c, c.argv[1], shared.czero); o == nil || o.checkType(c, ObjHash) {
+		return
+	}
+	if hashTypeExists(c.db, c.argv[1], o, *(*sds.SDS)(c.argv[2].ptr), hfeLazyExpire) {
+		addReply(c, shared.cone)
+	} else {
+		addReply(c, shared.czero)
+	}
+}
+
+const (
+	// count*hrandfieldSubStrategyMul大于hash的长度时，先复制整个hash再随机删除
+	hrandfieldSubStrategyMul = 3
+	// 允许重复时，每次从listpack中最多取出的元素个数
+	hrandfieldRandomSampleLimit = 1000
+)
+
+// hrandfieldReplyWithListpack 回复从listpack中随机取出的元素，vals为nil时只回复field
+func hrandfieldReplyWithListpack(c *Client, count int, keys, vals []listpack.Entry) {
+	for i := 0; i < count; i++ {
+		if vals != nil && c.resp > 2 {
+			addReplyArrayLen(c, 2)
+		}
+		hashReplyFromListpackEntry(c, &keys[i])
+		if vals != nil {
+			hashReplyFromListpackEntry(c, &vals[i])
+		}
+	}
+}
+
+// hrandfieldWithCountCommand 实现HRANDFIELD key count [WITHVALUES]，count为负数时允许重复
+func hrandfieldWithCountCommand(c *Client, l int64, withvalues bool) {
+	var hash *robj
+	if hash = lookupKeyReadOrReply(c, c.argv[1], shared.emptyArray); hash == nil || hash.checkType(c, ObjHash) {
+		return
+	}
+	if hashTypeExpireFields(c.db, c.argv[1], hash, mstime()) {
+		addReply(c, shared.emptyArray)
+		return
+	}
+	size := hashTypeLength(hash)
+
+	uniq := true
+	count := l
+	if l < 0 {
+		count = -l
+		uniq = false
+	}
+
+	// count为0时直接返回，避免后面的特殊情况
+	if count == 0 {
+		addReply(c, shared.emptyArray)
+		return
+	}
+
+	// CASE 1: count为负数，每次都从整个hash中随机选择，结果可能重复
+	if !uniq || count == 1 {
+		if withvalues && c.resp == 2 {
+			addReplyArrayLen(c, int(count*2))
+		} else {
+			addReplyArrayLen(c, int(count))
+		}
+		if hash.getEncoding() == ObjEncodingHt {
+			d := (*dict.Dict)(hash.ptr)
+			for ; count > 0; count-- {
+				de := d.GetRandomKey()
+				if withvalues && c.resp > 2 {
+					addReplyArrayLen(c, 2)
+				}
+				field := *(*sds.SDS)(dict.GetKey(de))
+				addReplyBulkBuffer(c, field.BufData(0), sds.Len(field))
+				if withvalues {
+					value := *(*sds.SDS)(dict.GetVal(de))
+					addReplyBulkBuffer(c, value.BufData(0), sds.Len(value))
+				}
+			}
+		} else if hash.getEncoding() == ObjEncodingListPack {
+			limit := count
+			if limit > hrandfieldRandomSampleLimit {
+				limit = hrandfieldRandomSampleLimit
+			}
+			keys := make([]listpack.Entry, limit)
+			var vals []listpack.Entry
+			if withvalues {
+				vals = make([]listpack.Entry, limit)
+			}
+			for count > 0 {
+				sampleCount := limit
+				if sampleCount > count {
+					sampleCount = count
+				}
+				count -= sampleCount
+				listpack.RandomPairs(*(*[]byte)(hash.ptr), int(sampleCount), keys, vals)
+				hrandfieldReplyWithListpack(c, int(sampleCount), keys, vals)
+			}
+		} else {
+			panic("Unknown hash encoding")
+		}
+		return
+	}
+
+	// RESP3回复嵌套的数组，RESP2回复扁平的数组
+	replySize := int(count)
+	if replySize > size {
+		replySize = size
+	}
+	if withvalues && c.resp == 2 {
+		addReplyArrayLen(c, replySize*2)
+	} else {
+		addReplyArrayLen(c, replySize)
+	}
+
+	// CASE 2: count大于等于hash的长度，直接返回整个hash
+	if count >= int64(size) {
+		hi := hashTypeInitIterator(hash)
+		for hashTypeNext(hi) != C_ERR {
+			if withvalues && c.resp > 2 {
+				addReplyArrayLen(c, 2)
+			}
+			addHashIteratorCursorToReply(c, hi, objHashKey)
+			if withvalues {
+				addHashIteratorCursorToReply(c, hi, objHashValue)
+			}
+		}
+		hashTypeReleaseIterator(hi)
+		return
+	}
+
+	// CASE 3: count和hash的长度相差不大，复制整个hash，再随机删除元素直到剩下count个
+	if count*hrandfieldSubStrategyMul > int64(size) {
+		d := dict.Create(hashDictType, nil)
+		d.Expand(int64(size))
+		hi := hashTypeInitIterator(hash)
+		for hashTypeNext(hi) != C_ERR {
+			key := hashTypeCurrentObjectNewSds(hi, objHashKey)
+			var value unsafe.Pointer
+			if withvalues {
+				v := hashTypeCurrentObjectNewSds(hi, objHashValue)
+				value = unsafe.Pointer(&v)
+			}
+			if !d.Add(unsafe.Pointer(&key), value) {
+				panic("hrandfield: duplicate field in hash")
+			}
+		}
+		hashTypeReleaseIterator(hi)
+
+		for ; size > int(count); size-- {
+			de := d.GetRandomKey()
+			d.Delete(dict.GetKey(de))
+		}
+
+		di := d.GetIterator()
+		for de := di.Next(); de != nil; de = di.Next() {
+			if withvalues && c.resp > 2 {
+				addReplyArrayLen(c, 2)
+			}
+			key := *(*sds.SDS)(dict.GetKey(de))
+			addReplyBulkBuffer(c, key.BufData(0), sds.Len(key))
+			if withvalues {
+				value := *(*sds.SDS)(dict.GetVal(de))
+				addReplyBulkBuffer(c, value.BufData(0), sds.Len(value))
+			}
+		}
+		di.Release()
+		return
+	}
+
+	// CASE 4: hash比count大很多，不断随机选择元素，直到选出count个不重复的元素
+	if hash.getEncoding() == ObjEncodingListPack {
+		// 从listpack中多次随机选择一个元素效率很低，一次遍历选出所有的元素
+		keys := make([]listpack.Entry, count)
+		var vals []listpack.Entry
+		if withvalues {
+			vals = make([]listpack.Entry, count)
+		}
+		if listpack.RandomPairsUnique(*(*[]byte)(hash.ptr), int(count), keys, vals) != int(count) {
+			panic("hrandfield: not enough unique fields in listpack")
+		}
+		hrandfieldReplyWithListpack(c, int(count), keys, vals)
+		return
+	}
+
+	var key, value listpack.Entry
+	var valp *listpack.Entry
+	if withvalues {
+		valp = &value
+	}
+	d := dict.Create(hashDictType, nil)
+	d.Expand(count)
+	for added := int64(0); added < count; {
+		hashTypeRandomElement(hash, size, &key, valp)
+
+		// 已经选过的元素跳过
+		skey := hashSdsFromListpackEntry(&key)
+		if !d.Add(unsafe.Pointer(&skey), nil) {
+			continue
+		}
+		added++
+
+		// 直接回复，不需要在dict中保存value
+		if withvalues && c.resp > 2 {
+			addReplyArrayLen(c, 2)
+		}
+		hashReplyFromListpackEntry(c, &key)
+		if withvalues {
+			hashReplyFromListpackEntry(c, &value)
+		}
+	}
+}
+
+// HRANDFIELD key [count [WITHVALUES]]
+func hrandfieldCommand(c *Client) {
+	if c.argc >= 3 {
+		var l int64
+		if c.argv[2].getRangeLongFromObjectOrReply(c, -math.MaxInt64, math.MaxInt64, &l, "") != C_OK {
+			return
+		}
+		if c.argc > 4 || (c.argc == 4 && !util.StrCaseCmp((*sds.SDS)(c.argv[3].ptr).BufData(0), "withvalues")) {
+			addReplyErrorObject(c, shared.syntaxErr)
+			return
+		}
+		hrandfieldWithCountCommand(c, l, c.argc == 4)
+		return
+	}
+
+	// 没有count参数时回复一个bulk string
+	var hash *robj
+	if hash = lookupKeyReadOrReply(c, c.argv[1], shared.null[c.resp]); hash == nil || hash.checkType(c, ObjHash) {
+		return
+	}
+	if hashTypeExpireFields(c.db, c.argv[1], hash, mstime()) {
+		addReply(c, shared.null[c.resp])
+		return
+	}
+
+	var ele listpack.Entry
+	hashTypeRandomElement(hash, hashTypeLength(hash), &ele, nil)
+	hashReplyFromListpackEntry(c, &ele)
+}
+
+/* ------------------------- hash field expire ------------------------- */
+
+// 设置field过期时间时每个field的结果
+const (
+	hfeSetNoField        = -2 // field不存在
+	hfeSetNoConditionMet = 0  // NX/XX/GT/LT条件不满足
+	hfeSetOk             = 1  // 设置成功
+	hfeSetDeleted        = 2  // 过期时间已经过去，field被直接删除
+)
+
+// 查询或者移除field过期时间时每个field的结果
+const (
+	hfeGetNoField = -2 // field不存在
+	hfeGetNoTtl   = -1 // field没有设置过期时间
+	hfePersistOk  = 1  // 过期时间被移除
+)
+
+// 惰性删除过期field时的选项
+const (
+	hfeLazyExpire       = 0      // 删除过期的field，hash为空时删除key
+	hfeLazyAvoidHashDel = 1 << 0 // hash为空时不删除key，调用者接下来会写入新的field
+)
+
+// HEXPIRE类命令的NX/XX/GT/LT条件，一次只能指定一个
+const (
+	hfeNx = 1 << iota // field没有过期时间时才设置
+	hfeXx             // field已经有过期时间时才设置
+	hfeGt             // 新的过期时间大于当前的过期时间时才设置，没有过期时间当作无限大
+	hfeLt             // 新的过期时间小于当前的过期时间时才设置
+)
+
+// hfeMaxAbsTimeMsec field过期时间(毫秒时间戳)允许的最大值
+const hfeMaxAbsTimeMsec = 1<<48 - 1
+
+// hashTypeFieldExpires 返回hash的field过期时间表：field -> 毫秒时间戳。
+// 只有hashtable编码的hash可以设置field过期时间，过期时间表作为metadata保存在hash的dict上，
+// 这样RENAME/MOVE等操作不需要额外处理
+func hashTypeFieldExpires(o *robj) *dict.Dict {
+	if o.getEncoding() != ObjEncodingHt {
+		return nil
+	}
+	fe, _ := (*dict.Dict)(o.ptr).Metadata().(*dict.Dict)
+	return fe
+}
+
+// hashTypeGetFieldExpire 返回field的过期时间，没有设置时返回-1
+func hashTypeGetFieldExpire(o *robj, field sds.SDS) int64 {
+	fe := hashTypeFieldExpires(o)
+	if fe == nil {
+		return -1
+	}
+	de := fe.Find(unsafe.Pointer(&field))
+	if de == nil {
+		return -1
+	}
+	return dict.GetSignedIntegerVal(de)
+}
+
+// hashTypeSetFieldExpire 设置field的过期时间，调用者需要保证hash是hashtable编码并且field存在
+func hashTypeSetFieldExpire(o *robj, field sds.SDS, when int64) {
+	d := (*dict.Dict)(o.ptr)
+	fe := hashTypeFieldExpires(o)
+	if fe == nil {
+		fe = dict.Create(hashFieldExpiresDictType, nil)
+		d.SetMetadata(fe)
+	}
+	de := fe.Find(unsafe.Pointer(&field))
+	if de == nil {
+		dup := sds.Dup(field)
+		de = fe.AddRaw(unsafe.Pointer(&dup), nil)
+	}
+	dict.SetSignedIntegerVal(de, when)
+}
+
+// hashTypeRemoveFieldExpire 移除field的过期时间，field没有设置过期时间时返回false
+func hashTypeRemoveFieldExpire(o *robj, field sds.SDS) bool {
+	fe := hashTypeFieldExpires(o)
+	if fe == nil {
+		return false
+	}
+	removed := fe.Delete(unsafe.Pointer(&field))
+	if fe.Size() == 0 {
+		(*dict.Dict)(o.ptr).SetMetadata(nil)
+	}
+	return removed
+}
+
+// hashTypeFieldIsExpired 判断field是否已经过期
+func hashTypeFieldIsExpired(o *robj, field sds.SDS) bool {
+	when := hashTypeGetFieldExpire(o, field)
+	if when < 0 {
+		return false
+	}
+	if server.loading {
+		return false
+	}
+	return mstime() > when
+}
+
+// propagateHashFieldExpire 过期的field以HDEL的形式传播给AOF和从节点
+func (db *redisDb) propagateHashFieldExpire(key *robj, field sds.SDS) {
+	argv := [3]*robj{}
+	argv[0] = shared.hdel
+	argv[1] = key
+	argv[2] = createRawStringObject(field.BufData(0))
+	argv[0].incrRefCount()
+	argv[1].incrRefCount()
+
+	if server.aofState != aofOff {
+		feedAppendOnlyFile(server.hdelCommand, db.id, argv[:], 3)
+	}
+	replicationFeedSlaves(server.slaves, db.id, argv[:], 3)
+	argv[0].decrRefCount()
+	argv[1].decrRefCount()
+	argv[2].decrRefCount()
+}
+
+// hashTypeDeleteExpiredField 删除一个已经过期的field，返回true表示hash为空并且key被删除了
+func hashTypeDeleteExpiredField(db *redisDb, key, o *robj, field sds.SDS, hfeFlags int) bool {
+	server.statExpiredSubkeys++
+	db.propagateHashFieldExpire(key, field)
+	hashTypeDelete(o, field)
+	notifyKeySpaceEvent(notifyHash, "hexpired", key, db.id)
+
+	var keyRemoved bool
+	if hfeFlags&hfeLazyAvoidHashDel == 0 && hashTypeLength(o) == 0 {
+		dbDelete(db, key)
+		notifyKeySpaceEvent(notifyGeneric, "del", key, db.id)
+		keyRemoved = true
+	}
+	signalModifiedKey(nil, db, key)
+	return keyRemoved
+}
+
+// hashTypeFieldExpireIfNeeded field已经过期时删除它。返回true表示field已经过期，调用者应该当作field不存在
+func hashTypeFieldExpireIfNeeded(db *redisDb, key, o *robj, field sds.SDS, hfeFlags int) bool {
+	if !hashTypeFieldIsExpired(o, field) {
+		return false
+	}
+
+	// 从节点不主动删除，等待主节点传播的HDEL
+	if server.masterhost != "" {
+		return true
+	}
+
+	hashTypeDeleteExpiredField(db, key, o, field, hfeFlags)
+	return true
+}
+
+// hashTypeExpireFields 删除hash中所有在now之前过期的field，返回true表示hash为空并且key被删除了。
+// 需要遍历整个hash的命令在执行前调用，activeExpireCycle也通过它回收field
+func hashTypeExpireFields(db *redisDb, key, o *robj, now int64) bool {
+	fe := hashTypeFieldExpires(o)
+	if fe == nil || server.loading || server.masterhost != "" {
+		return false
+	}
+
+	// 遍历的同时不能删除，先收集过期的field
+	var expired []sds.SDS
+	di := fe.GetIterator()
+	for de := di.Next(); de != nil; de = di.Next() {
+		if now > dict.GetSignedIntegerVal(de) {
+			expired = append(expired, *(*sds.SDS)(dict.GetKey(de)))
+		}
+	}
+	di.Release()
+
+	for _, field := range expired {
+		if hashTypeDeleteExpiredField(db, key, o, field, hfeLazyExpire) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashTypeActiveExpire 由activeExpireCycle调用，回收key中已经过期的field。
+// key不存在或者不再有field设置过期时间时，把它从db.hexpires中移除
+func hashTypeActiveExpire(db *redisDb, key *robj, now int64) {
+	o := (*robj)(db.dict.FetchValue(key.ptr))
+	if o != nil && o.getType() == ObjHash {
+		if hashTypeExpireFields(db, key, o, now) {
+			return
+		}
+		if hashTypeFieldExpires(o) != nil {
+			return
+		}
+	}
+	db.hexpires.Delete(key.ptr)
+}
+
+// getHashFieldsFromArgumentsOrReply 解析 FIELDS numfields field [field ...]，fieldsIdx是FIELDS参数的位置
+func getHashFieldsFromArgumentsOrReply(c *Client, fieldsIdx int, numFields *int64) error {
+	if fieldsIdx >= c.argc-1 || !util.StrCaseCmp((*sds.SDS)(c.argv[fieldsIdx].ptr).BufData(0), "fields") {
+		addReplyError(c, "Mandatory argument FIELDS is missing or not at the right position")
+		return C_ERR
+	}
+	if c.argv[fieldsIdx+1].getRangeLongFromObjectOrReply(c, 1, math.MaxInt32,
+		numFields, "Parameter `numFields` should be greater than 0") != C_OK {
+		return C_ERR
+	}
+	if *numFields != int64(c.argc-fieldsIdx-2) {
+		addReplyError(c, "The `numfields` parameter must match the number of arguments")
+		return C_ERR
+	}
+	return C_OK
+}
+
+// hfeConditionMet 检查field的NX/XX/GT/LT条件是否满足，current为-1表示field没有过期时间
+func hfeConditionMet(flag int, current, when int64) bool {
+	switch flag {
+	case hfeNx:
+		return current == -1
+	case hfeXx:
+		return current != -1
+	case hfeGt:
+		return current != -1 && when > current
+	case hfeLt:
+		return current == -1 || when < current
+	}
+	return true
+}
+
+// hexpireGenericCommand 实现HEXPIRE/HPEXPIRE/HEXPIREAT/HPEXPIREAT，basetime为0时是绝对时间
+//
+// HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func hexpireGenericCommand(c *Client, basetime int64, unit int) {
+	key := c.argv[1]
+
+	var when int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &when, "") != C_OK {
+		return
+	}
+	maxWhen := int64(hfeMaxAbsTimeMsec)
+	if unit == unitSeconds {
+		maxWhen /= 1000
+	}
+	if when < 0 || when > maxWhen {
+		addReplyErrorFormat(c, "invalid expire time, must be >= 0 and <= %d", hfeMaxAbsTimeMsec)
+		return
+	}
+	if unit == unitSeconds {
+		when *= 1000
+	}
+	if when > hfeMaxAbsTimeMsec-basetime {
+		addReplyErrorFormat(c, "invalid expire time in '%s' command", c.cmd.name)
+		return
+	}
+	when += basetime
+
+	fieldsIdx := 3
+	var flag int
+	if c.argc > 3 {
+		opt := (*sds.SDS)(c.argv[3].ptr).BufData(0)
+		switch {
+		case util.StrCaseCmp(opt, "nx"):
+			flag = hfeNx
+		case util.StrCaseCmp(opt, "xx"):
+			flag = hfeXx
+		case util.StrCaseCmp(opt, "gt"):
+			flag = hfeGt
+		case util.StrCaseCmp(opt, "lt"):
+			flag = hfeLt
+		}
+		if flag != 0 {
+			fieldsIdx++
+		}
+	}
+	var numFields int64
+	if getHashFieldsFromArgumentsOrReply(c, fieldsIdx, &numFields) != C_OK {
+		return
+	}
+
+	var o *robj
+	if o = c.db.lookupKeyWrite(key); o != nil && o.checkType(c, ObjHash) {
+		return
+	}
+
+	addReplyArrayLen(c, int(numFields))
+	if o == nil {
+		for i := 0; i < int(numFields); i++ {
+			addReplyLongLong(c, hfeSetNoField)
+		}
+		return
+	}
+
+	var updated []*robj
+	var deleted int
+	for i := fieldsIdx + 2; i < c.argc; i++ {
+		field := *(*sds.SDS)(c.argv[i].ptr)
+		if !hashTypeExists(c.db, key, o, field, hfeLazyAvoidHashDel) {
+			addReplyLongLong(c, hfeSetNoField)
+			continue
+		}
+		if !hfeConditionMet(flag, hashTypeGetFieldExpire(o, field), when) {
+			addReplyLongLong(c, hfeSetNoConditionMet)
+			continue
+		}
+		if checkAlreadyExpired(when) {
+			// 过期时间已经过去的field直接删除，以HDEL的形式传播
+			c.db.propagateHashFieldExpire(key, field)
+			hashTypeDelete(o, field)
+			deleted++
+			addReplyLongLong(c, hfeSetDeleted)
+			continue
+		}
+
+		if o.getEncoding() == ObjEncodingListPack {
+			hashTypeConvert(o, ObjEncodingHt)
+		}
+		hashTypeSetFieldExpire(o, field, when)
+		updated = append(updated, c.argv[i])
+		addReplyLongLong(c, hfeSetOk)
+	}
+
+	if len(updated) > 0 {
+		c.db.trackHashFieldExpires(key, o)
+		notifyKeySpaceEvent(notifyHash, "hexpire", key, c.db.id)
+	}
+	if deleted > 0 {
+		notifyKeySpaceEvent(notifyHash, "hdel", key, c.db.id)
+	}
+	// 过期的field被惰性删除或者field被直接删除后hash可能为空
+	if hashTypeLength(o) == 0 {
+		dbDelete(c.db, key)
+		notifyKeySpaceEvent(notifyGeneric, "del", key, c.db.id)
+	}
+	if len(updated) > 0 || deleted > 0 {
+		signalModifiedKey(c, c.db, key)
+		server.dirty++
+	}
+
+	// 没有field设置了过期时间，删除的field已经以HDEL传播，命令本身不需要传播
+	if len(updated) == 0 {
+		c.flags |= CLIENT_PREVENT_PROP
+		return
+	}
+	// 以HPEXPIREAT的形式传播绝对时间，避免从节点和AOF重放时计算出不同的过期时间。
+	// 只传播设置成功的field，条件已经在主节点上判断过了
+	argv := make([]*robj, 0, 5+len(updated))
+	argv = append(argv, shared.hpexpireat, key,
+		createStringObjectFromLongLongWithOptions(when, 0),
+		createStringObject("FIELDS"),
+		createStringObjectFromLongLongWithOptions(int64(len(updated)), 0))
+	argv = append(argv, updated...)
+	rewriteClientCommandVector(c, len(argv), argv...)
+}
+
+// HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func hexpireCommand(c *Client) {
+	hexpireGenericCommand(c, mstime(), unitSeconds)
+}
+
+// HPEXPIRE key milliseconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func hpexpireCommand(c *Client) {
+	hexpireGenericCommand(c, mstime(), unitMilliSeconds)
+}
+
+// HEXPIREAT key unix-time-seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func hexpireatCommand(c *Client) {
+	hexpireGenericCommand(c, 0, unitSeconds)
+}
+
+// HPEXPIREAT key unix-time-milliseconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func hpexpireatCommand(c *Client) {
+	hexpireGenericCommand(c, 0, unitMilliSeconds)
+}
+
+// httlGenericCommand 实现HTTL/HPTTL key FIELDS numfields field [field ...]
+func httlGenericCommand(c *Client, unit int) {
+	var numFields int64
+	if getHashFieldsFromArgumentsOrReply(c, 2, &numFields) != C_OK {
+		return
+	}
+
+	var o *robj
+	if o = c.db.lookupKeyRead(c.argv[1]); o != nil && o.checkType(c, ObjHash) {
+		return
+	}
+
+	addReplyArrayLen(c, int(numFields))
+	for i := 4; i < c.argc; i++ {
+		field := *(*sds.SDS)(c.argv[i].ptr)
+		if o == nil || !hashTypeExists(c.db, c.argv[1], o, field, hfeLazyExpire) {
+			addReplyLongLong(c, hfeGetNoField)
+			continue
+		}
+
+		when := hashTypeGetFieldExpire(o, field)
+		if when == -1 {
+			addReplyLongLong(c, hfeGetNoTtl)
+			continue
+		}
+		ttl := when - mstime()
+		if ttl < 0 {
+			ttl = 0
+		}
+		if unit == unitSeconds {
+			ttl = (ttl + 500) / 1000
+		}
+		addReplyLongLong(c, int(ttl))
+	}
+}
+
+// HTTL key FIELDS numfields field [field ...]
+func httlCommand(c *Client) {
+	httlGenericCommand(c, unitSeconds)
+}
+
+// HPTTL key FIELDS numfields field [field ...]
+func hpttlCommand(c *Client) {
+	httlGenericCommand(c, unitMilliSeconds)
+}
+
+// HPERSIST key FIELDS numfields field [field ...]
+func hpersistCommand(c *Client) {
+	var numFields int64
+	if getHashFieldsFromArgumentsOrReply(c, 2, &numFields) != C_OK {
+		return
+	}
+
+	var o *robj
+	if o = c.db.lookupKeyWrite(c.argv[1]); o != nil && o.checkType(c, ObjHash) {
+		return
+	}
+
+	addReplyArrayLen(c, int(numFields))
+	var changed bool
+	for i := 4; i < c.argc; i++ {
+		field := *(*sds.SDS)(c.argv[i].ptr)
+		if o == nil || !hashTypeExists(c.db, c.argv[1], o, field, hfeLazyExpire) {
+			addReplyLongLong(c, hfeGetNoField)
+			continue
+		}
+		if !hashTypeRemoveFieldExpire(o, field) {
+			addReplyLongLong(c, hfeGetNoTtl)
+			continue
+		}
+		changed = true
+		addReplyLongLong(c, hfePersistOk)
+	}
+
+	if changed {
+		signalModifiedKey(c, c.db, c.argv[1])
+		notifyKeySpaceEvent(notifyHash, "hpersist", c.argv[1], c.db.id)
+		server.dirty++
+	}
+}
+
+// HSCAN key cursor [MATCH pattern] [COUNT count]
+func hscanCommand(c *Client) {
+	var cursor uint64
+	if parseScanCursorOrReply(c, c.argv[2], &cursor) != C_OK {
+		return
+	}
+	o := lookupKeyReadOrReply(c, c.argv[1], shared.emptyScan)
+	if o == nil || o.checkType(c, ObjHash) {
+		return
+	}
+	scanGenericCommand(c, o, cursor)
+}
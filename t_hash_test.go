@@ -0,0 +1,210 @@
+package main
+
+import (
+	"github.com/pengdafu/redis-golang/sds"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// hashEncodings 分别用listpack和hashtable编码执行f
+func hashEncodings(t *testing.T, f func(t *testing.T, c *Client)) {
+	for _, maxEntries := range []int{512, 0} {
+		testServerInit()
+		server.hashMaxListpackEntries = maxEntries
+		f(t, testClient())
+	}
+}
+
+func TestHashCommands(t *testing.T) {
+	hashEncodings(t, func(t *testing.T, c *Client) {
+		testRun(t, c, []testCase{
+			{"hincrby h n 5", ":5"},
+			{"hincrby h n -10", ":-5"},
+			{"hset h max 9223372036854775807 s abc f 1.5", ":3"},
+			{"hincrby h max 1", "-ERR increment or decrement would overflow"},
+			{"hincrby h s 1", "-ERR hash value is not an integer"},
+			{"hincrby h n x", "-ERR value is not an integer or out of range"},
+			{"hincrbyfloat h f 0.25", "1.75"},
+			{"hincrbyfloat h n 0.5", "-4.5"},
+			{"hincrbyfloat h new 3", "3"},
+			{"hincrbyfloat h s 1", "-ERR hash value is not a float"},
+			{"hincrbyfloat h f +inf", "-ERR value is NaN or Infinity"},
+			{"hget h f", "1.75"},
+
+			{"hsetnx h s xyz", ":0"},
+			{"hsetnx h t xyz", ":1"},
+			{"hget h s", "abc"},
+			{"hexists h t", ":1"},
+			{"hexists h nofield", ":0"},
+			{"hexists nokey f", ":0"},
+			{"hlen h", ":6"},
+			{"hlen nokey", ":0"},
+			{"hstrlen h s", ":3"},
+			{"hstrlen h max", ":19"},
+			{"hstrlen h nofield", ":0"},
+			{"set str x", "+OK"},
+			{"hlen str", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+			{"hincrby str f 1", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		})
+	})
+}
+
+func TestHrandfieldCommand(t *testing.T) {
+	hashEncodings(t, func(t *testing.T, c *Client) {
+		testRun(t, c, []testCase{
+			{"hset h a 1 b 2 c 3 d 4 e 5", ":5"},
+			{"hrandfield nokey", "(nil)"},
+			{"hrandfield nokey 3", "[]"},
+			{"hrandfield h 0", "[]"},
+			{"hrandfield h x", "-ERR value is not an integer or out of range"},
+			{"hrandfield h 1 withvalue", "-ERR syntax error"},
+		})
+
+		fields := map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"}
+		tests := []struct {
+			count      string
+			withValues bool
+			expect     int
+			unique     bool
+		}{
+			{"3", false, 3, true},
+			{"5", false, 5, true},
+			{"100", false, 5, true},
+			{"4", true, 4, true},
+			{"-3", false, 3, false},
+			{"-20", false, 20, false},
+			{"-20", true, 20, false},
+		}
+		for _, tt := range tests {
+			args := []string{"hrandfield", "h", tt.count}
+			if tt.withValues {
+				args = append(args, "withvalues")
+			}
+			reply := testCommand(c, args...)
+			items := strings.Fields(strings.Trim(reply, "[]"))
+			step := 1
+			if tt.withValues {
+				step = 2
+			}
+			if len(items) != tt.expect*step {
+				t.Fatalf("%v: expect %d fields, got %q", args, tt.expect, reply)
+			}
+			seen := make(map[string]bool)
+			for i := 0; i < len(items); i += step {
+				value, ok := fields[items[i]]
+				if !ok || (tt.withValues && items[i+1] != value) {
+					t.Fatalf("%v: unexpected reply %q", args, reply)
+				}
+				if tt.unique && seen[items[i]] {
+					t.Fatalf("%v: field %s returned twice", args, items[i])
+				}
+				seen[items[i]] = true
+			}
+		}
+
+		if reply := testCommand(c, "hrandfield", "h"); fields[reply] == "" {
+			t.Fatalf("hrandfield h: unexpected reply %q", reply)
+		}
+	})
+}
+
+func TestHexpireCommand(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"hset h a 1 b 2 c 3", ":3"},
+		{"hexpire h 100 fields 2 a nofield", "[:1 :-2]"},
+		{"hexpire nokey 100 fields 1 a", "[:-2]"},
+		{"hexpire h 100 nx fields 2 a b", "[:0 :1]"},
+		{"hexpire h 50 gt fields 2 a c", "[:0 :0]"},
+		{"hexpire h 200 gt fields 1 a", "[:1]"},
+		{"hexpire h 50 lt fields 2 a c", "[:1 :1]"},
+		{"hexpire h 100 xx fields 1 nofield", "[:-2]"},
+		{"hexpire h -1 fields 1 a", "-ERR invalid expire time, must be >= 0 and <= 281474976710655"},
+		{"hexpire h 100 fields 2 a", "-ERR The `numfields` parameter must match the number of arguments"},
+		{"hexpire h 100 a b c", "-ERR Mandatory argument FIELDS is missing or not at the right position"},
+		{"httl h fields 3 a b nofield", "[:50 :100 :-2]"},
+	})
+
+	// 设置成功的field以HPEXPIREAT的绝对时间传播，条件和没有设置的field不传播
+	testRun(t, c, []testCase{{"hset h d 4", ":1"}})
+	if reply := testCommand(c, "hexpire", "h", "10", "nx", "fields", "3", "a", "d", "nofield"); reply != "[:0 :1 :-2]" {
+		t.Fatalf("expect [0 1 -2], got %q", reply)
+	}
+	argv := testArgv(c)
+	when := hashTypeGetFieldExpire(c.db.lookupKeyRead(createStringObject("h")), sds.NewLen("d"))
+	if expect := "[HPEXPIREAT h " + strconv.FormatInt(when, 10) + " FIELDS 1 d]"; argv != expect {
+		t.Fatalf("expect propagated argv %s, got %s", expect, argv)
+	}
+
+	// 过期时间已经过去的field被删除，命令本身不传播
+	if reply := testCommand(c, "hpexpireat", "h", "1", "fields", "2", "a", "b"); reply != "[:2 :2]" {
+		t.Fatalf("expect [2 2], got %q", reply)
+	}
+	if c.flags&CLIENT_PREVENT_PROP != CLIENT_PREVENT_PROP {
+		t.Fatal("HPEXPIREAT with only deleted fields should not be propagated")
+	}
+	testRun(t, c, []testCase{
+		{"hlen h", ":2"},
+		{"hpexpireat h 1 fields 2 c d", "[:2 :2]"},
+		{"exists h", ":0"},
+	})
+}
+
+func TestHsetExpiredField(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"hset h a 1 b 2", ":2"},
+		{"hexpire h 100 fields 2 a b", "[:1 :1]"},
+	})
+
+	// 已经过期但还没有被回收的field，HSET当作新建，并且清除过期时间
+	o := c.db.lookupKeyRead(createStringObject("h"))
+	hashTypeSetFieldExpire(o, sds.NewLen("a"), mstime()-1)
+	testRun(t, c, []testCase{
+		{"hset h a 3 b 4", ":1"},
+		{"httl h fields 2 a b", "[:-1 :-1]"},
+		{"hget h a", "3"},
+	})
+}
+
+func TestHashListpackConvert(t *testing.T) {
+	testServerInit()
+	server.hashMaxListpackEntries = 3
+	server.hashMaxListpackValue = 8
+	c := testClient()
+
+	// field个数超过hashMaxListpackEntries时转换成hashtable
+	testArgsRun(t, c, []testArgsCase{
+		{[]string{"hset", "h", "", "v", "f", ""}, ":2"},
+		{[]string{"object", "encoding", "h"}, "listpack"},
+		{[]string{"hset", "h", "g", "1"}, ":1"},
+		{[]string{"object", "encoding", "h"}, "listpack"},
+		{[]string{"hset", "h", "x", "2"}, ":1"},
+		{[]string{"object", "encoding", "h"}, "hashtable"},
+		{[]string{"hlen", "h"}, ":4"},
+		{[]string{"hget", "h", ""}, "v"},
+		{[]string{"hget", "h", "f"}, ""},
+		{[]string{"hstrlen", "h", "f"}, ":0"},
+		{[]string{"hget", "h", "g"}, "1"},
+		{[]string{"hget", "h", "x"}, "2"},
+		{[]string{"hdel", "h", ""}, ":1"},
+		{[]string{"hexists", "h", ""}, ":0"},
+	})
+
+	// field或value的长度超过hashMaxListpackValue时转换成hashtable
+	testRun(t, c, []testCase{
+		{"hset h2 a 1 b 2", ":2"},
+		{"object encoding h2", "listpack"},
+		{"hset h2 c 123456789", ":1"},
+		{"object encoding h2", "hashtable"},
+		{"hmget h2 a b c", "[1 2 123456789]"},
+		{"hsetnx h3 field 1", ":1"},
+		{"object encoding h3", "listpack"},
+		{"hsetnx h3 longerfield 1", ":1"},
+		{"object encoding h3", "hashtable"},
+		{"hmget h3 field longerfield", "[1 1]"},
+	})
+}
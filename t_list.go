@@ -0,0 +1,979 @@
+package main
+
+import (
+	"github.com/pengdafu/redis-golang/adlist"
+	"github.com/pengdafu/redis-golang/quicklist"
+	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+	"math"
+)
+
+const (
+	listHead = 0
+	listTail = 1
+)
+
+/*-----------------------------------------------------------------------------
+ * List API
+ *----------------------------------------------------------------------------*/
+
+// listTypeIterator 遍历list，direction为listTail时从头向尾遍历，listHead时从尾向头遍历
+type listTypeIterator struct {
+	subject   *robj
+	encoding  uint32
+	direction int
+	iter      *quicklist.Iter
+}
+
+type listTypeEntry struct {
+	li    *listTypeIterator
+	entry quicklist.Entry
+}
+
+// listTypePush 在where(listHead或者listTail)插入value
+func listTypePush(subject, value *robj, where int) {
+	if subject.getEncoding() == ObjEncodingQuickList {
+		pos := quicklist.Tail
+		if where == listHead {
+			pos = quicklist.Head
+		}
+		value = value.getDecodedObject()
+		(*quicklist.Quicklist)(subject.ptr).Push((*sds.SDS)(value.ptr).BufData(0), pos)
+		value.decrRefCount()
+	} else {
+		panic("Unknown list encoding")
+	}
+}
+
+// listTypePop 从where弹出一个元素，list为空时返回nil
+func listTypePop(subject *robj, where int) *robj {
+	var value *robj
+
+	if subject.getEncoding() == ObjEncodingQuickList {
+		pos := quicklist.Tail
+		if where == listHead {
+			pos = quicklist.Head
+		}
+
+		var data []byte
+		var vlong int64
+		if (*quicklist.Quicklist)(subject.ptr).Pop(pos, &data, &vlong) {
+			if data != nil {
+				value = createStringObject(util.Bytes2String(data))
+			} else {
+				value = createStringObjectFromLongLongWithOptions(vlong, 0)
+			}
+		}
+	} else {
+		panic("Unknown list encoding")
+	}
+	return value
+}
+
+func listTypeLength(subject *robj) int {
+	if subject.getEncoding() == ObjEncodingQuickList {
+		return (*quicklist.Quicklist)(subject.ptr).Count()
+	}
+	panic("Unknown list encoding")
+}
+
+// listTypeDup 复制一个list对象
+func listTypeDup(o *robj) *robj {
+	if o.getEncoding() != ObjEncodingQuickList {
+		panic("Unknown list encoding")
+	}
+	lobj := createObject(ObjList, *(*quicklist.Quicklist)(o.ptr).Dup())
+	lobj.setEncoding(ObjEncodingQuickList)
+	return lobj
+}
+
+// listTypeInitIterator 从index开始遍历list
+func listTypeInitIterator(subject *robj, index int, direction int) *listTypeIterator {
+	li := &listTypeIterator{
+		subject:   subject,
+		encoding:  subject.getEncoding(),
+		direction: direction,
+	}
+
+	// listHead表示从尾部开始向头部遍历，listTail表示从头部开始向尾部遍历
+	iterDirection := quicklist.StartHead
+	if direction == listHead {
+		iterDirection = quicklist.StartTail
+	}
+	if li.encoding == ObjEncodingQuickList {
+		li.iter = (*quicklist.Quicklist)(subject.ptr).GetIteratorAtIdx(iterDirection, index)
+	} else {
+		panic("Unknown list encoding")
+	}
+	return li
+}
+
+func listTypeReleaseIterator(li *listTypeIterator) {
+	li.iter.Release()
+}
+
+// listTypeNext 把当前元素保存到entry中并前进到下一个元素，没有更多元素时返回false
+func listTypeNext(li *listTypeIterator, entry *listTypeEntry) bool {
+	entry.li = li
+	if li.encoding == ObjEncodingQuickList {
+		return li.iter.Next(&entry.entry)
+	}
+	panic("Unknown list encoding")
+}
+
+// listTypeGet 返回entry对应的对象
+func listTypeGet(entry *listTypeEntry) *robj {
+	if entry.li.encoding == ObjEncodingQuickList {
+		if entry.entry.Value != nil {
+			return createStringObject(util.Bytes2String(entry.entry.Value))
+		}
+		return createStringObjectFromLongLongWithOptions(entry.entry.Longval, 0)
+	}
+	panic("Unknown list encoding")
+}
+
+func listTypeInsert(entry *listTypeEntry, value *robj, where int) {
+	if entry.li.encoding == ObjEncodingQuickList {
+		value = value.getDecodedObject()
+		ql := (*quicklist.Quicklist)(entry.li.subject.ptr)
+		if where == listTail {
+			ql.InsertAfter(&entry.entry, (*sds.SDS)(value.ptr).BufData(0))
+		} else if where == listHead {
+			ql.InsertBefore(&entry.entry, (*sds.SDS)(value.ptr).BufData(0))
+		}
+		value.decrRefCount()
+	} else {
+		panic("Unknown list encoding")
+	}
+}
+
+// listTypeEqual 判断entry是否等于o，o必须是sds编码的
+func listTypeEqual(entry *listTypeEntry, o *robj) bool {
+	if entry.li.encoding == ObjEncodingQuickList {
+		return entry.entry.Compare((*sds.SDS)(o.ptr).BufData(0))
+	}
+	panic("Unknown list encoding")
+}
+
+// listTypeDelete 删除迭代器当前的元素
+func listTypeDelete(iter *listTypeIterator, entry *listTypeEntry) {
+	if entry.li.encoding == ObjEncodingQuickList {
+		iter.iter.DelEntry(&entry.entry)
+	} else {
+		panic("Unknown list encoding")
+	}
+}
+
+// listTypeDelRange 从start开始删除count个元素
+func listTypeDelRange(subject *robj, start, count int) {
+	if subject.getEncoding() == ObjEncodingQuickList {
+		(*quicklist.Quicklist)(subject.ptr).DelRange(start, count)
+	} else {
+		panic("Unknown list encoding")
+	}
+}
+
+/*-----------------------------------------------------------------------------
+ * List Commands
+ *----------------------------------------------------------------------------*/
+
+// pushGenericCommand 实现LPUSH/RPUSH/LPUSHX/RPUSHX，xx为true时只在key存在时插入
+func pushGenericCommand(c *Client, where int, xx bool) {
+	lobj := c.db.lookupKeyWrite(c.argv[1])
+	if lobj != nil && lobj.checkType(c, ObjList) {
+		return
+	}
+	if lobj == nil {
+		if xx {
+			addReply(c, shared.czero)
+			return
+		}
+
+		lobj = createQuicklistObject()
+		(*quicklist.Quicklist)(lobj.ptr).SetOptions(server.listMaxZipListSize, server.listCompressDepth)
+		c.db.dbAdd(c.argv[1], lobj)
+	}
+
+	for j := 2; j < c.argc; j++ {
+		listTypePush(lobj, c.argv[j], where)
+		server.dirty++
+	}
+
+	addReplyLongLong(c, listTypeLength(lobj))
+
+	event := "rpush"
+	if where == listHead {
+		event = "lpush"
+	}
+	signalModifiedKey(c, c.db, c.argv[1])
+	notifyKeySpaceEvent(notifyList, event, c.argv[1], c.db.id)
+}
+
+// LPUSH <key> <element> [<element> ...]
+func lpushCommand(c *Client) {
+	pushGenericCommand(c, listHead, false)
+}
+
+// RPUSH <key> <element> [<element> ...]
+func rpushCommand(c *Client) {
+	pushGenericCommand(c, listTail, false)
+}
+
+// LPUSHX <key> <element> [<element> ...]
+func lpushxCommand(c *Client) {
+	pushGenericCommand(c, listHead, true)
+}
+
+// RPUSHX <key> <element> [<element> ...]
+func rpushxCommand(c *Client) {
+	pushGenericCommand(c, listTail, true)
+}
+
+// LINSERT <key> (BEFORE|AFTER) <pivot> <element>
+func linsertCommand(c *Client) {
+	var where int
+	if util.StrCaseCmp((*sds.SDS)(c.argv[2].ptr).BufData(0), "after") {
+		where = listTail
+	} else if util.StrCaseCmp((*sds.SDS)(c.argv[2].ptr).BufData(0), "before") {
+		where = listHead
+	} else {
+		addReply(c, shared.syntaxErr)
+		return
+	}
+
+	var subject *robj
+	if subject = lookupKeyWriteOrReply(c, c.argv[1], shared.czero); subject == nil || subject.checkType(c, ObjList) {
+		return
+	}
+
+	// 从头到尾查找pivot
+	var entry listTypeEntry
+	inserted := false
+	iter := listTypeInitIterator(subject, 0, listTail)
+	for listTypeNext(iter, &entry) {
+		if listTypeEqual(&entry, c.argv[3]) {
+			listTypeInsert(&entry, c.argv[4], where)
+			inserted = true
+			break
+		}
+	}
+	listTypeReleaseIterator(iter)
+
+	if !inserted {
+		// 没有找到pivot
+		addReplyLongLong(c, -1)
+		return
+	}
+
+	signalModifiedKey(c, c.db, c.argv[1])
+	notifyKeySpaceEvent(notifyList, "linsert", c.argv[1], c.db.id)
+	server.dirty++
+
+	addReplyLongLong(c, listTypeLength(subject))
+}
+
+// LLEN <key>
+func llenCommand(c *Client) {
+	var o *robj
+	if o = lookupKeyReadOrReply(c, c.argv[1], shared.czero); o == nil || o.checkType(c, ObjList) {
+		return
+	}
+	addReplyLongLong(c, listTypeLength(o))
+}
+
+// LINDEX <key> <index>
+func lindexCommand(c *Client) {
+	var o *robj
+	if o = lookupKeyReadOrReply(c, c.argv[1], shared.null[c.resp]); o == nil || o.checkType(c, ObjList) {
+		return
+	}
+
+	var index int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &index, "") != C_OK {
+		return
+	}
+
+	if o.getEncoding() == ObjEncodingQuickList {
+		var entry quicklist.Entry
+		if (*quicklist.Quicklist)(o.ptr).Index(int(index), &entry) {
+			if entry.Value != nil {
+				addReplyBulkBuffer(c, entry.Value, len(entry.Value))
+			} else {
+				addReplyBulkLongLong(c, entry.Longval)
+			}
+		} else {
+			addReplyNull(c)
+		}
+	} else {
+		panic("Unknown list encoding")
+	}
+}
+
+// LSET <key> <index> <element>
+func lsetCommand(c *Client) {
+	var o *robj
+	if o = lookupKeyWriteOrReply(c, c.argv[1], shared.noKeyErr); o == nil || o.checkType(c, ObjList) {
+		return
+	}
+
+	var index int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &index, "") != C_OK {
+		return
+	}
+
+	value := c.argv[3]
+	if o.getEncoding() == ObjEncodingQuickList {
+		ql := (*quicklist.Quicklist)(o.ptr)
+		if !ql.ReplaceAtIndex(int(index), (*sds.SDS)(value.ptr).BufData(0)) {
+			addReplyErrorObject(c, shared.outOfRangeErr)
+		} else {
+			addReply(c, shared.ok)
+			signalModifiedKey(c, c.db, c.argv[1])
+			notifyKeySpaceEvent(notifyList, "lset", c.argv[1], c.db.id)
+			server.dirty++
+		}
+	} else {
+		panic("Unknown list encoding")
+	}
+}
+
+// listElementsRemoved 在从list中弹出元素之后发送事件，list为空时删除key
+func listElementsRemoved(c *Client, key *robj, where int, o *robj, count int) {
+	event := "rpop"
+	if where == listHead {
+		event = "lpop"
+	}
+
+	notifyKeySpaceEvent(notifyList, event, key, c.db.id)
+	if listTypeLength(o) == 0 {
+		notifyKeySpaceEvent(notifyGeneric, "del", key, c.db.id)
+		dbDelete(c.db, key)
+	}
+	signalModifiedKey(c, c.db, key)
+	server.dirty += count
+}
+
+// popGenericCommand 实现LPOP和RPOP，指定count时返回数组
+func popGenericCommand(c *Client, where int) {
+	var count int64
+	hasCount := false
+
+	if c.argc > 3 {
+		addReplyErrorFormat(c, "wrong number of arguments for '%s' command", c.cmd.name)
+		return
+	} else if c.argc == 3 {
+		if c.argv[2].getPositiveLongFromObjectOrReply(c, &count, "") != C_OK {
+			return
+		}
+		hasCount = true
+		if count == 0 {
+			addReply(c, shared.nullArray[c.resp])
+			return
+		}
+	}
+
+	reply := shared.null[c.resp]
+	if hasCount {
+		reply = shared.nullArray[c.resp]
+	}
+
+	var o *robj
+	if o = lookupKeyWriteOrReply(c, c.argv[1], reply); o == nil || o.checkType(c, ObjList) {
+		return
+	}
+
+	if !hasCount {
+		// 弹出一个元素，回复bulk string
+		value := listTypePop(o, where)
+		addReplyBulk(c, value)
+		value.decrRefCount()
+		listElementsRemoved(c, c.argv[1], where, o, 1)
+	} else {
+		// 弹出多个元素，回复数组
+		llen := listTypeLength(o)
+		rangelen := int(count)
+		if rangelen > llen {
+			rangelen = llen
+		}
+
+		rangestart, rangeend := 0, rangelen-1
+		reverse := false
+		if where == listTail {
+			rangestart, rangeend = -rangelen, -1
+			reverse = true
+		}
+		addListRangeReply(c, o, rangestart, rangeend, reverse)
+		listTypeDelRange(o, rangestart, rangelen)
+		listElementsRemoved(c, c.argv[1], where, o, rangelen)
+	}
+}
+
+// LPOP <key> [count]
+func lpopCommand(c *Client) {
+	popGenericCommand(c, listHead)
+}
+
+// RPOP <key> [count]
+func rpopCommand(c *Client) {
+	popGenericCommand(c, listTail)
+}
+
+// addListRangeReply 回复[start, end]范围内的元素，reverse为true时从end向start回复
+func addListRangeReply(c *Client, o *robj, start, end int, reverse bool) {
+	llen := listTypeLength(o)
+
+	if start < 0 {
+		start = llen + start
+	}
+	if end < 0 {
+		end = llen + end
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	// 结果为空时，end必然大于等于0，所以只需要检查start
+	if start > end || start >= llen {
+		addReply(c, shared.emptyArray)
+		return
+	}
+	if end >= llen {
+		end = llen - 1
+	}
+	rangelen := end - start + 1
+
+	addReplyArrayLen(c, rangelen)
+	if o.getEncoding() == ObjEncodingQuickList {
+		from, direction := start, listTail
+		if reverse {
+			from, direction = end, listHead
+		}
+
+		var entry listTypeEntry
+		iter := listTypeInitIterator(o, from, direction)
+		for ; rangelen > 0; rangelen-- {
+			listTypeNext(iter, &entry)
+			qe := &entry.entry
+			if qe.Value != nil {
+				addReplyBulkBuffer(c, qe.Value, len(qe.Value))
+			} else {
+				addReplyBulkLongLong(c, qe.Longval)
+			}
+		}
+		listTypeReleaseIterator(iter)
+	} else {
+		panic("Unknown list encoding")
+	}
+}
+
+// LRANGE <key> <start> <stop>
+func lrangeCommand(c *Client) {
+	var start, end int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &start, "") != C_OK ||
+		c.argv[3].getLongLongFromObjectOrReply(c, &end, "") != C_OK {
+		return
+	}
+
+	var o *robj
+	if o = lookupKeyReadOrReply(c, c.argv[1], shared.emptyArray); o == nil || o.checkType(c, ObjList) {
+		return
+	}
+
+	addListRangeReply(c, o, int(start), int(end), false)
+}
+
+// LTRIM <key> <start> <stop>
+func ltrimCommand(c *Client) {
+	var start, end int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &start, "") != C_OK ||
+		c.argv[3].getLongLongFromObjectOrReply(c, &end, "") != C_OK {
+		return
+	}
+
+	var o *robj
+	if o = lookupKeyWriteOrReply(c, c.argv[1], shared.ok); o == nil || o.checkType(c, ObjList) {
+		return
+	}
+
+	llen := int64(listTypeLength(o))
+	if start < 0 {
+		start = llen + start
+	}
+	if end < 0 {
+		end = llen + end
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	var ltrim, rtrim int64
+	if start > end || start >= llen {
+		// 范围为空，删除所有元素
+		ltrim = llen
+		rtrim = 0
+	} else {
+		if end >= llen {
+			end = llen - 1
+		}
+		ltrim = start
+		rtrim = llen - end - 1
+	}
+
+	if o.getEncoding() == ObjEncodingQuickList {
+		ql := (*quicklist.Quicklist)(o.ptr)
+		ql.DelRange(0, int(ltrim))
+		ql.DelRange(-int(rtrim), int(rtrim))
+	} else {
+		panic("Unknown list encoding")
+	}
+
+	notifyKeySpaceEvent(notifyList, "ltrim", c.argv[1], c.db.id)
+	if listTypeLength(o) == 0 {
+		dbDelete(c.db, c.argv[1])
+		notifyKeySpaceEvent(notifyGeneric, "del", c.argv[1], c.db.id)
+	}
+	signalModifiedKey(c, c.db, c.argv[1])
+	server.dirty += int(ltrim + rtrim)
+	addReply(c, shared.ok)
+}
+
+// LPOS <key> <element> [RANK <rank>] [COUNT <count>] [MAXLEN <maxlen>]
+func lposCommand(c *Client) {
+	ele := c.argv[2]
+	direction := listTail
+	var rank, count, maxlen int64 = 1, -1, 0 // count为-1表示没有指定COUNT
+
+	for j := 3; j < c.argc; j++ {
+		opt := (*sds.SDS)(c.argv[j].ptr).BufData(0)
+		moreargs := c.argc - 1 - j
+
+		if util.StrCaseCmp(opt, "rank") && moreargs > 0 {
+			j++
+			if c.argv[j].getLongLongFromObjectOrReply(c, &rank, "") != C_OK {
+				return
+			}
+			if rank == 0 {
+				addReplyError(c, "RANK can't be zero: use 1 to start from "+
+					"the first match, 2 from the second ... "+
+					"or use negative to start from the end of the list")
+				return
+			}
+		} else if util.StrCaseCmp(opt, "count") && moreargs > 0 {
+			j++
+			if c.argv[j].getPositiveLongFromObjectOrReply(c, &count, "COUNT can't be negative") != C_OK {
+				return
+			}
+		} else if util.StrCaseCmp(opt, "maxlen") && moreargs > 0 {
+			j++
+			if c.argv[j].getPositiveLongFromObjectOrReply(c, &maxlen, "MAXLEN can't be negative") != C_OK {
+				return
+			}
+		} else {
+			addReply(c, shared.syntaxErr)
+			return
+		}
+	}
+
+	// rank为负数表示从尾部开始查找
+	if rank < 0 {
+		rank = -rank
+		direction = listHead
+	}
+
+	o := c.db.lookupKeyRead(c.argv[1])
+	if o == nil {
+		if count != -1 {
+			addReply(c, shared.emptyArray)
+		} else {
+			addReply(c, shared.null[c.resp])
+		}
+		return
+	}
+	if o.checkType(c, ObjList) {
+		return
+	}
+
+	// 指定了COUNT时回复数组
+	var arraylenptr *adlist.ListNode
+	if count != -1 {
+		arraylenptr = addReplyDeferredLen(c)
+	}
+
+	start := 0
+	if direction == listHead {
+		start = -1
+	}
+	li := listTypeInitIterator(o, start, direction)
+
+	var entry listTypeEntry
+	llen := int64(listTypeLength(o))
+	var index, matches, arraylen int64
+	matchindex := int64(-1)
+	for listTypeNext(li, &entry) && (maxlen == 0 || index < maxlen) {
+		if listTypeEqual(&entry, ele) {
+			matches++
+			if direction == listTail {
+				matchindex = index
+			} else {
+				matchindex = llen - index - 1
+			}
+			if matches >= rank {
+				if count == -1 {
+					break
+				}
+				arraylen++
+				addReplyLongLong(c, int(matchindex))
+				if count != 0 && matches-rank+1 >= count {
+					break
+				}
+			}
+		}
+		index++
+		matchindex = -1 // 没有匹配时退出循环
+	}
+	listTypeReleaseIterator(li)
+
+	if count != -1 {
+		setDeferredArrayLen(c, arraylenptr, int(arraylen))
+	} else if matchindex != -1 {
+		addReplyLongLong(c, int(matchindex))
+	} else {
+		addReply(c, shared.null[c.resp])
+	}
+}
+
+// LREM <key> <count> <element>
+func lremCommand(c *Client) {
+	obj := c.argv[3]
+
+	var toremove int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &toremove, "") != C_OK {
+		return
+	}
+
+	var subject *robj
+	if subject = lookupKeyWriteOrReply(c, c.argv[1], shared.czero); subject == nil || subject.checkType(c, ObjList) {
+		return
+	}
+
+	// count为负数时从尾部开始删除
+	var li *listTypeIterator
+	if toremove < 0 {
+		toremove = -toremove
+		li = listTypeInitIterator(subject, -1, listHead)
+	} else {
+		li = listTypeInitIterator(subject, 0, listTail)
+	}
+
+	var entry listTypeEntry
+	var removed int64
+	for listTypeNext(li, &entry) {
+		if listTypeEqual(&entry, obj) {
+			listTypeDelete(li, &entry)
+			server.dirty++
+			removed++
+			if toremove != 0 && removed == toremove {
+				break
+			}
+		}
+	}
+	listTypeReleaseIterator(li)
+
+	if removed > 0 {
+		signalModifiedKey(c, c.db, c.argv[1])
+		notifyKeySpaceEvent(notifyList, "lrem", c.argv[1], c.db.id)
+	}
+
+	if listTypeLength(subject) == 0 {
+		dbDelete(c.db, c.argv[1])
+		notifyKeySpaceEvent(notifyGeneric, "del", c.argv[1], c.db.id)
+	}
+
+	addReplyLongLong(c, int(removed))
+}
+
+// getListPositionFromObjectOrReply 解析LEFT|RIGHT
+func getListPositionFromObjectOrReply(c *Client, arg *robj, position *int) error {
+	if util.StrCaseCmp((*sds.SDS)(arg.ptr).BufData(0), "right") {
+		*position = listTail
+	} else if util.StrCaseCmp((*sds.SDS)(arg.ptr).BufData(0), "left") {
+		*position = listHead
+	} else {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return C_ERR
+	}
+	return C_OK
+}
+
+// lmoveHandlePush 把value推入到dstkey的where端，dstobj为nil时创建list
+func lmoveHandlePush(c *Client, dstkey, dstobj, value *robj, where int) {
+	if dstobj == nil {
+		dstobj = createQuicklistObject()
+		(*quicklist.Quicklist)(dstobj.ptr).SetOptions(server.listMaxZipListSize, server.listCompressDepth)
+		c.db.dbAdd(dstkey, dstobj)
+	}
+	signalModifiedKey(c, c.db, dstkey)
+	listTypePush(dstobj, value, where)
+
+	event := "rpush"
+	if where == listHead {
+		event = "lpush"
+	}
+	notifyKeySpaceEvent(notifyList, event, dstkey, c.db.id)
+
+	// 总是回复被移动的元素
+	addReplyBulk(c, value)
+}
+
+// lmoveGenericCommand 从argv[1]的wherefrom端弹出一个元素，推入到argv[2]的whereto端
+func lmoveGenericCommand(c *Client, wherefrom, whereto int) {
+	var sobj *robj
+	if sobj = lookupKeyWriteOrReply(c, c.argv[1], shared.null[c.resp]); sobj == nil || sobj.checkType(c, ObjList) {
+		return
+	}
+
+	if listTypeLength(sobj) == 0 {
+		addReplyNull(c)
+		return
+	}
+
+	dobj := c.db.lookupKeyWrite(c.argv[2])
+	touchedkey := c.argv[1]
+	if dobj != nil && dobj.checkType(c, ObjList) {
+		return
+	}
+
+	value := listTypePop(sobj, wherefrom)
+	lmoveHandlePush(c, c.argv[2], dobj, value, whereto)
+	value.decrRefCount()
+
+	event := "rpop"
+	if wherefrom == listHead {
+		event = "lpop"
+	}
+	notifyKeySpaceEvent(notifyList, event, touchedkey, c.db.id)
+	// 源list为空时删除
+	if listTypeLength(sobj) == 0 {
+		dbDelete(c.db, touchedkey)
+		notifyKeySpaceEvent(notifyGeneric, "del", touchedkey, c.db.id)
+	}
+	signalModifiedKey(c, c.db, touchedkey)
+	server.dirty++
+}
+
+// listPopRangeAndReplyWithKey 从where端弹出最多count个元素，回复[key, [elements]]。
+// list为空被删除时返回true
+func listPopRangeAndReplyWithKey(c *Client, o, key *robj, where int, count int) bool {
+	llen := listTypeLength(o)
+	rangelen := count
+	if rangelen > llen {
+		rangelen = llen
+	}
+
+	rangestart, rangeend := 0, rangelen-1
+	reverse := false
+	if where == listTail {
+		rangestart, rangeend = -rangelen, -1
+		reverse = true
+	}
+
+	// key只回复一次，后面是元素数组
+	addReplyArrayLen(c, 2)
+	addReplyBulk(c, key)
+	addListRangeReply(c, o, rangestart, rangeend, reverse)
+
+	listTypeDelRange(o, rangestart, rangelen)
+	listElementsRemoved(c, key, where, o, rangelen)
+	return listTypeLength(o) == 0
+}
+
+// RPOPLPUSH <source> <destination>
+func rpoplpushCommand(c *Client) {
+	lmoveGenericCommand(c, listTail, listHead)
+}
+
+// LMOVE <source> <destination> (LEFT|RIGHT) (LEFT|RIGHT)
+func lmoveCommand(c *Client) {
+	var wherefrom, whereto int
+	if getListPositionFromObjectOrReply(c, c.argv[3], &wherefrom) != C_OK ||
+		getListPositionFromObjectOrReply(c, c.argv[4], &whereto) != C_OK {
+		return
+	}
+	lmoveGenericCommand(c, wherefrom, whereto)
+}
+
+// mpopGenericCommand 从第一个非空的list中弹出最多count个元素，所有list都为空时回复null
+func mpopGenericCommand(c *Client, keys []*robj, where int, count int) {
+	for _, key := range keys {
+		o := c.db.lookupKeyWrite(key)
+		// key不存在，继续下一个key
+		if o == nil {
+			continue
+		}
+		if o.checkType(c, ObjList) {
+			return
+		}
+		// list为空，继续下一个key
+		if listTypeLength(o) == 0 {
+			continue
+		}
+
+		listPopRangeAndReplyWithKey(c, o, key, where, count)
+		return
+	}
+
+	addReply(c, shared.nullArray[c.resp])
+}
+
+/*-----------------------------------------------------------------------------
+ * Blocking POP operations
+ *----------------------------------------------------------------------------*/
+
+// blockingPopGenericCommand 实现BLPOP/BRPOP/BLMPOP，count为0时是BLPOP/BRPOP。
+// 如果有非空的list，像[LR]POP一样立刻返回，否则阻塞客户端
+func blockingPopGenericCommand(c *Client, keys []*robj, where int, timeoutIdx int, count int) {
+	var timeout int64
+	if getTimeoutFromObjectOrReply(c, c.argv[timeoutIdx], &timeout, unitSeconds) != C_OK {
+		return
+	}
+
+	for _, key := range keys {
+		o := c.db.lookupKeyWrite(key)
+		if o == nil {
+			continue
+		}
+		if o.checkType(c, ObjList) {
+			return
+		}
+		if listTypeLength(o) == 0 {
+			continue
+		}
+
+		if count > 0 {
+			// BLMPOP，非空list，像带COUNT的[LR]POP一样
+			listPopRangeAndReplyWithKey(c, o, key, where, count)
+			return
+		}
+
+		// 非空list，像[LR]POP一样
+		value := listTypePop(o, where)
+		addReplyArrayLen(c, 2)
+		addReplyBulk(c, key)
+		addReplyBulk(c, value)
+		value.decrRefCount()
+		listElementsRemoved(c, key, where, o, 1)
+		return
+	}
+
+	// 不允许阻塞时（比如在MULTI中），只能当做超时处理
+	if c.flags&CLIENT_DENY_BLOCKING > 0 {
+		addReply(c, shared.nullArray[c.resp])
+		return
+	}
+
+	// 所有key都不存在，阻塞客户端
+	blockForKeys(c, BLOCKED_LIST, keys, count, timeout, nil, &blockPos{wherefrom: where}, nil)
+}
+
+// BLPOP <key> [<key> ...] <timeout>
+func blpopCommand(c *Client) {
+	blockingPopGenericCommand(c, c.argv[1:c.argc-1], listHead, c.argc-1, 0)
+}
+
+// BRPOP <key> [<key> ...] <timeout>
+func brpopCommand(c *Client) {
+	blockingPopGenericCommand(c, c.argv[1:c.argc-1], listTail, c.argc-1, 0)
+}
+
+func blmoveGenericCommand(c *Client, wherefrom, whereto int, timeout int64) {
+	key := c.db.lookupKeyWrite(c.argv[1])
+	if key != nil && key.checkType(c, ObjList) {
+		return
+	}
+
+	if key == nil {
+		if c.flags&CLIENT_DENY_BLOCKING > 0 {
+			// 不允许阻塞时立刻返回
+			addReplyNull(c)
+			return
+		}
+		// list为空，阻塞客户端
+		blockForKeys(c, BLOCKED_LIST, c.argv[1:2], 0, timeout, c.argv[2],
+			&blockPos{wherefrom: wherefrom, whereto: whereto}, nil)
+	} else {
+		// list存在并且不为空，执行普通的LMOVE
+		lmoveGenericCommand(c, wherefrom, whereto)
+	}
+}
+
+// BLMOVE <source> <destination> (LEFT|RIGHT) (LEFT|RIGHT) <timeout>
+func blmoveCommand(c *Client) {
+	var wherefrom, whereto int
+	var timeout int64
+	if getListPositionFromObjectOrReply(c, c.argv[3], &wherefrom) != C_OK ||
+		getListPositionFromObjectOrReply(c, c.argv[4], &whereto) != C_OK ||
+		getTimeoutFromObjectOrReply(c, c.argv[5], &timeout, unitSeconds) != C_OK {
+		return
+	}
+	blmoveGenericCommand(c, wherefrom, whereto, timeout)
+}
+
+// lmpopGenericCommand 实现LMPOP/BLMPOP，numkeysIdx是numkeys参数的位置
+func lmpopGenericCommand(c *Client, numkeysIdx int, isBlock bool) {
+	var numkeys int64
+	count := int64(-1)
+
+	if c.argv[numkeysIdx].getRangeLongFromObjectOrReply(c, 1, math.MaxInt64, &numkeys,
+		"numkeys should be greater than 0") != C_OK {
+		return
+	}
+
+	// 解析LEFT|RIGHT
+	whereIdx := int64(numkeysIdx) + numkeys + 1
+	if whereIdx >= int64(c.argc) {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+	var where int
+	if getListPositionFromObjectOrReply(c, c.argv[whereIdx], &where) != C_OK {
+		return
+	}
+
+	// 解析可选参数
+	for j := int(whereIdx) + 1; j < c.argc; j++ {
+		opt := (*sds.SDS)(c.argv[j].ptr).BufData(0)
+		moreargs := c.argc - 1 - j
+
+		if count == -1 && util.StrCaseCmp(opt, "count") && moreargs > 0 {
+			j++
+			if c.argv[j].getRangeLongFromObjectOrReply(c, 1, math.MaxInt64, &count,
+				"count should be greater than 0") != C_OK {
+				return
+			}
+		} else {
+			addReplyErrorObject(c, shared.syntaxErr)
+			return
+		}
+	}
+
+	if count == -1 {
+		count = 1
+	}
+
+	keys := c.argv[numkeysIdx+1 : numkeysIdx+1+int(numkeys)]
+	if isBlock {
+		blockingPopGenericCommand(c, keys, where, 1, int(count))
+	} else {
+		mpopGenericCommand(c, keys, where, int(count))
+	}
+}
+
+// LMPOP <numkeys> <key> [<key> ...] (LEFT|RIGHT) [COUNT count]
+func lmpopCommand(c *Client) {
+	lmpopGenericCommand(c, 1, false)
+}
+
+// BLMPOP <timeout> <numkeys> <key> [<key> ...] (LEFT|RIGHT) [COUNT count]
+func blmpopCommand(c *Client) {
+	lmpopGenericCommand(c, 2, true)
+}
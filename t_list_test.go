@@ -0,0 +1,247 @@
+package main
+
+import "testing"
+
+// listEncodings 用不同的quicklist节点大小和压缩深度执行f，节点很小时元素分布在多个节点中
+func listEncodings(t *testing.T, f func(t *testing.T, c *Client)) {
+	for _, cfg := range []struct{ fill, compress int }{{-2, 0}, {2, 0}, {1, 1}, {3, 2}} {
+		testServerInit()
+		server.listMaxZipListSize = cfg.fill
+		server.listCompressDepth = cfg.compress
+		f(t, testClient())
+	}
+}
+
+func TestListPushPop(t *testing.T) {
+	listEncodings(t, func(t *testing.T, c *Client) {
+		testRun(t, c, []testCase{
+			{"rpush l a b c d e", ":5"},
+			{"lpush l z y", ":7"},
+			{"lpushx nokey a", ":0"},
+			{"rpushx l f", ":8"},
+			{"lrange l 0 -1", "[y z a b c d e f]"},
+			{"llen l", ":8"},
+
+			{"lpop l", "y"},
+			{"rpop l", "f"},
+			{"lpop l 2", "[z a]"},
+			{"lpop l -1", "-ERR value is out of range, must be positive"},
+			{"lpop nokey", "(nil)"},
+			{"lpop nokey 2", "(nil)"},
+			{"rpop l 10", "[e d c b]"},
+			{"exists l", ":0"},
+			{"llen l", ":0"},
+
+			// 整数元素
+			{"rpush n 1 -2 9223372036854775807", ":3"},
+			{"lpop n", "1"},
+			{"rpop n 2", "[9223372036854775807 -2]"},
+
+			{"set str x", "+OK"},
+			{"lpush str a", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+			{"lpop str", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		})
+
+		// 空字符串元素不能被当作整数
+		testArgsRun(t, c, []testArgsCase{
+			{[]string{"rpush", "e", "", "1", ""}, ":3"},
+			{[]string{"lrange", "e", "0", "-1"}, "[ 1 ]"},
+			{[]string{"lindex", "e", "0"}, ""},
+			{[]string{"lpop", "e"}, ""},
+			{[]string{"rpop", "e", "2"}, "[ 1]"},
+			{[]string{"exists", "e"}, ":0"},
+		})
+	})
+}
+
+func TestListIndexCommands(t *testing.T) {
+	listEncodings(t, func(t *testing.T, c *Client) {
+		testRun(t, c, []testCase{
+			{"rpush l 1 2 3 2 1 2", ":6"},
+			{"lindex l 0", "1"},
+			{"lindex l -1", "2"},
+			{"lindex l 10", "(nil)"},
+			{"lindex l -10", "(nil)"},
+			{"lindex l x", "-ERR value is not an integer or out of range"},
+			{"lindex nokey 0", "(nil)"},
+
+			{"lset l 0 x", "+OK"},
+			{"lset l -1 y", "+OK"},
+			{"lset l 10 z", "-ERR index out of range"},
+			{"lset l -10 z", "-ERR index out of range"},
+			{"lset nokey 0 a", "-ERR no such key"},
+			{"lrange l 0 -1", "[x 2 3 2 1 y]"},
+
+			{"lrange l -100 100", "[x 2 3 2 1 y]"},
+			{"lrange l 3 1", "[]"},
+			{"lrange l 10 20", "[]"},
+			{"lrange l -2 -1", "[1 y]"},
+			{"lrange nokey 0 -1", "[]"},
+
+			{"ltrim l 1 -2", "+OK"},
+			{"lrange l 0 -1", "[2 3 2 1]"},
+			{"ltrim l -100 100", "+OK"},
+			{"lrange l 0 -1", "[2 3 2 1]"},
+			{"ltrim l 1 1", "+OK"},
+			{"lrange l 0 -1", "[3]"},
+			{"ltrim l 5 1", "+OK"},
+			{"exists l", ":0"},
+			{"ltrim nokey 0 1", "+OK"},
+		})
+
+		testArgsRun(t, c, []testArgsCase{
+			{[]string{"rpush", "e", "a", "b"}, ":2"},
+			{[]string{"lset", "e", "0", ""}, "+OK"},
+			{[]string{"lrange", "e", "0", "-1"}, "[ b]"},
+			{[]string{"lset", "e", "0", "5"}, "+OK"},
+			{[]string{"lindex", "e", "0"}, "5"},
+		})
+	})
+}
+
+func TestListRemInsertPos(t *testing.T) {
+	listEncodings(t, func(t *testing.T, c *Client) {
+		testRun(t, c, []testCase{
+			{"rpush r a b a c a", ":5"},
+			{"lrem r 1 a", ":1"},
+			{"lrem r -1 a", ":1"},
+			{"lrange r 0 -1", "[b a c]"},
+			{"lrem r 0 nomember", ":0"},
+			{"lrem nokey 0 a", ":0"},
+			{"rpush r2 1 2 1 1", ":4"},
+			{"lrem r2 0 1", ":3"},
+			{"lrange r2 0 -1", "[2]"},
+			{"lrem r2 0 2", ":1"},
+			{"exists r2", ":0"},
+
+			{"linsert r before b X", ":4"},
+			{"linsert r after a Y", ":5"},
+			{"linsert r after c Z", ":6"},
+			{"linsert r before nomember Z", ":-1"},
+			{"linsert nokey before a b", ":0"},
+			{"linsert r middle a b", "-ERR syntax error"},
+			{"lrange r 0 -1", "[X b a Y c Z]"},
+
+			{"rpush p a b c 1 2 3 c c", ":8"},
+			{"lpos p c", ":2"},
+			{"lpos p 1", ":3"},
+			{"lpos p c rank 2", ":6"},
+			{"lpos p c rank -1", ":7"},
+			{"lpos p c rank 4", "(nil)"},
+			{"lpos p c count 0", "[:2 :6 :7]"},
+			{"lpos p c count 2", "[:2 :6]"},
+			{"lpos p c rank -2 count 0", "[:6 :2]"},
+			{"lpos p c maxlen 3", ":2"},
+			{"lpos p c rank 2 maxlen 3", "(nil)"},
+			{"lpos p x", "(nil)"},
+			{"lpos p x count 0", "[]"},
+			{"lpos nokey x", "(nil)"},
+			{"lpos p c rank 0", "-ERR RANK can't be zero: use 1 to start from the first match, " +
+				"2 from the second ... or use negative to start from the end of the list"},
+			{"lpos p c count -1", "-ERR COUNT can't be negative"},
+			{"lpos p c maxlen -1", "-ERR MAXLEN can't be negative"},
+		})
+
+		testArgsRun(t, c, []testArgsCase{
+			{[]string{"rpush", "e", "", "a", ""}, ":3"},
+			{[]string{"lpos", "e", "", "count", "0"}, "[:0 :2]"},
+			{[]string{"linsert", "e", "after", "", "x"}, ":4"},
+			{[]string{"lrange", "e", "0", "-1"}, "[ x a ]"},
+			{[]string{"lrem", "e", "0", ""}, ":2"},
+			{[]string{"lrange", "e", "0", "-1"}, "[x a]"},
+		})
+	})
+}
+
+func TestListMoveCommands(t *testing.T) {
+	listEncodings(t, func(t *testing.T, c *Client) {
+		testRun(t, c, []testCase{
+			{"rpush src a b c", ":3"},
+			{"rpush dst x y", ":2"},
+			{"lmove src dst left left", "a"},
+			{"lrange dst 0 -1", "[a x y]"},
+			{"lmove src dst left right", "b"},
+			{"lrange dst 0 -1", "[a x y b]"},
+			{"lmove dst src right left", "b"},
+			{"lrange src 0 -1", "[b c]"},
+			{"lmove dst src right right", "y"},
+			{"lrange src 0 -1", "[b c y]"},
+			{"lrange dst 0 -1", "[a x]"},
+
+			// 源和目标是同一个list时旋转list
+			{"lmove src src left right", "b"},
+			{"lrange src 0 -1", "[c y b]"},
+			{"lmove src src right left", "b"},
+			{"lrange src 0 -1", "[b c y]"},
+			{"lmove src src left left", "b"},
+			{"lrange src 0 -1", "[b c y]"},
+
+			// 源list弹空后被删除，目标list不存在时创建
+			{"lmove dst newdst right left", "x"},
+			{"lmove dst newdst right left", "a"},
+			{"exists dst", ":0"},
+			{"lrange newdst 0 -1", "[a x]"},
+			{"lmove nokey newdst left left", "(nil)"},
+			{"exists nokey", ":0"},
+			{"lmove src dst up left", "-ERR syntax error"},
+
+			{"rpoplpush src newdst", "y"},
+			{"lrange src 0 -1", "[b c]"},
+			{"lrange newdst 0 -1", "[y a x]"},
+			{"rpoplpush src src", "c"},
+			{"lrange src 0 -1", "[c b]"},
+			{"rpoplpush nokey newdst", "(nil)"},
+
+			{"set str x", "+OK"},
+			{"lmove src str left left", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+			{"lmove str src left left", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+			{"rpoplpush src str", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+			{"lrange src 0 -1", "[c b]"},
+		})
+
+		testArgsRun(t, c, []testArgsCase{
+			{[]string{"rpush", "e", "", "1"}, ":2"},
+			{[]string{"lmove", "e", "e2", "left", "right"}, ""},
+			{[]string{"llen", "e2"}, ":1"},
+			{[]string{"lindex", "e2", "0"}, ""},
+			{[]string{"rpoplpush", "e", "e2"}, "1"},
+			{[]string{"lrange", "e2", "0", "-1"}, "[1 ]"},
+			{[]string{"lmove", "e2", "e2", "right", "left"}, ""},
+			{[]string{"lrange", "e2", "0", "-1"}, "[ 1]"},
+			{[]string{"lindex", "e2", "0"}, ""},
+		})
+	})
+}
+
+func TestListMpopCommand(t *testing.T) {
+	listEncodings(t, func(t *testing.T, c *Client) {
+		testRun(t, c, []testCase{
+			{"rpush l1 a b c", ":3"},
+			{"rpush l2 d e", ":2"},
+			{"lmpop 2 nokey l1 left", "[l1 [a]]"},
+			{"lmpop 2 l1 l2 right count 5", "[l1 [c b]]"},
+			{"exists l1", ":0"},
+			{"lmpop 2 l1 l2 left count 1", "[l2 [d]]"},
+			{"lmpop 1 l2 left count 2", "[l2 [e]]"},
+			{"lmpop 2 l1 l2 left", "(nil)"},
+
+			{"lmpop 0 l1 left", "-ERR numkeys should be greater than 0"},
+			{"lmpop 3 l1 l2 left", "-ERR syntax error"},
+			{"lmpop 1 l1 middle", "-ERR syntax error"},
+			{"lmpop 1 l1 left count 0", "-ERR count should be greater than 0"},
+			{"lmpop 1 l1 left count 1 count 2", "-ERR syntax error"},
+			{"lmpop 1 l1 left extra", "-ERR syntax error"},
+
+			{"set str x", "+OK"},
+			{"rpush l3 a", ":1"},
+			{"lmpop 2 str l3 left", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		})
+
+		testArgsRun(t, c, []testArgsCase{
+			{[]string{"rpush", "e", "", "x", ""}, ":3"},
+			{[]string{"lmpop", "1", "e", "left", "count", "2"}, "[e [ x]]"},
+			{[]string{"lmpop", "1", "e", "right"}, "[e []]"},
+			{[]string{"exists", "e"}, ":0"},
+		})
+	})
+}
@@ -4,8 +4,13 @@ import (
 	"github.com/pengdafu/redis-golang/adlist"
 	"github.com/pengdafu/redis-golang/dict"
 	"github.com/pengdafu/redis-golang/intset"
+	"github.com/pengdafu/redis-golang/listpack"
 	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+	"math"
+	"math/rand"
 	"sort"
+	"strconv"
 	"unsafe"
 )
 
@@ -13,7 +18,7 @@ func saddCommand(c *Client) {
 	var set *robj
 	set = c.db.lookupKeyWrite(c.argv[1])
 	if set == nil {
-		set = setTypeCreate(*(*sds.SDS)(c.argv[2].ptr))
+		set = setTypeCreate(*(*sds.SDS)(c.argv[2].ptr), c.argc-2)
 		c.db.dbAdd(c.argv[1], set)
 	} else if set.checkType(c, ObjSet) {
 		return
@@ -42,6 +47,23 @@ func setTypeAdd(subject *robj, value unsafe.Pointer) bool {
 			dict.SetVal(de, nil)
 			return true
 		}
+	} else if subject.getEncoding() == ObjEncodingListPack {
+		sdsValue := *(*sds.SDS)(value)
+		lp := *(*[]byte)(subject.ptr)
+		if p := listpack.First(lp); p != nil && listpack.Find(p, sdsValue.BufData(0), sds.Len(sdsValue), 0) != nil {
+			return false
+		}
+		if listpack.Len(lp) < server.setMaxListpackEntries &&
+			sds.Len(sdsValue) <= server.setMaxListpackValue &&
+			listpack.SafeToAdd(lp, sds.Len(sdsValue)) {
+			lp = listpack.Push(lp, sdsValue.BufData(0), listpack.Tail)
+			subject.ptr = unsafe.Pointer(&lp)
+		} else {
+			// 超过listpack的限制，转换成hashtable
+			setTypeConvert(subject, ObjEncodingHt)
+			(*dict.Dict)(subject.ptr).Add(value, nil)
+		}
+		return true
 	} else if subject.getEncoding() == ObjEncodingIntSet {
 		sdsValue := *(*sds.SDS)(value)
 		var llval int64
@@ -59,6 +81,12 @@ func setTypeAdd(subject *robj, value unsafe.Pointer) bool {
 				}
 				return true
 			}
+		} else if setTypeIntsetFitsListpack((*intset.IntSet)(subject.ptr), sds.Len(sdsValue)) {
+			// 加入非整数元素之后还没有超过listpack的限制，转换成listpack
+			setTypeConvert(subject, ObjEncodingListPack)
+			lp := listpack.Push(*(*[]byte)(subject.ptr), sdsValue.BufData(0), listpack.Tail)
+			subject.ptr = unsafe.Pointer(&lp)
+			return true
 		} else {
 			setTypeConvert(subject, ObjEncodingHt)
 			(*dict.Dict)(subject.ptr).Add(value, nil)
@@ -70,10 +98,36 @@ func setTypeAdd(subject *robj, value unsafe.Pointer) bool {
 	return false
 }
 
-func setTypeCreate(value sds.SDS) *robj {
-	if isSdsRepresentableAsLongLong(value, nil) {
+// setTypeIntsetFitsListpack 判断intset加入一个长度为vlen的非整数元素之后能不能用listpack保存
+func setTypeIntsetFitsListpack(is *intset.IntSet, vlen int) bool {
+	n := is.Len()
+	if n >= server.setMaxListpackEntries || vlen > server.setMaxListpackValue {
+		return false
+	}
+
+	// intset中最长的元素一定是最大值或者最小值
+	var maxelelen int
+	if n > 0 {
+		var min, max int64
+		is.Get(0, &min)
+		is.Get(n-1, &max)
+		maxelelen = len(strconv.FormatInt(min, 10))
+		if l := len(strconv.FormatInt(max, 10)); l > maxelelen {
+			maxelelen = l
+		}
+	}
+	// 整数在listpack中最多占用9个字节，再加1个字节的长度
+	return maxelelen <= server.setMaxListpackValue && listpack.SafeToAdd(nil, n*10+vlen)
+}
+
+// setTypeCreate 根据第一个元素和预计的元素个数sizeHint选择集合的编码
+func setTypeCreate(value sds.SDS, sizeHint int) *robj {
+	if isSdsRepresentableAsLongLong(value, nil) && sizeHint <= server.setMaxIntSetEntries {
 		return createIntsetObject()
 	}
+	if sizeHint <= server.setMaxListpackEntries {
+		return createSetListpackObject()
+	}
 	return createSetObject()
 }
 
@@ -81,30 +135,63 @@ type setTypeIterator struct {
 	subject  *robj
 	encoding int
 	ii       int
+	lpi      []byte // listpack中下一个元素的位置
 	di       *dict.Iterator
 }
 
+// setTypeConvert 把intset转换成listpack或者hashtable，或者把listpack转换成hashtable
 func setTypeConvert(setobj *robj, enc uint32) {
-	if enc != ObjEncodingHt {
+	if enc != ObjEncodingHt && enc != ObjEncodingListPack ||
+		setobj.getEncoding() == ObjEncodingHt ||
+		enc == ObjEncodingListPack && setobj.getEncoding() != ObjEncodingIntSet {
 		panic("Unsupported set conversion")
 	}
 
-	d := dict.Create(setDictType, nil)
-	is := (*intset.IntSet)(setobj.ptr)
-	d.Expand(int64(is.Len()))
-
 	si := setTypeInitIterator(setobj)
-	var element sds.SDS
-	var intele int64
-	for setTypeNext(si, &element, &intele) != -1 {
-		element := sds.FromLongLong(intele)
-		d.Add(unsafe.Pointer(&element), nil)
+	if enc == ObjEncodingHt {
+		d := dict.Create(setDictType, nil)
+		d.Expand(int64(setTypeSize(setobj)))
+		for element := setTypeNextObject(si); element != nil; element = setTypeNextObject(si) {
+			d.Add(unsafe.Pointer(element), nil)
+		}
+		setobj.ptr = unsafe.Pointer(d)
+	} else {
+		lp := listpack.New()
+		var element sds.SDS
+		var intele int64
+		for setTypeNext(si, &element, &intele) != -1 {
+			lp = listpack.Push(lp, []byte(strconv.FormatInt(intele, 10)), listpack.Tail)
+		}
+		setobj.ptr = unsafe.Pointer(&lp)
 	}
-
 	setTypeReleaseIterator(si)
 
-	setobj.setEncoding(ObjEncodingHt)
-	setobj.ptr = unsafe.Pointer(d)
+	setobj.setEncoding(enc)
+}
+
+// setTypeDup 复制一个set对象，新对象的编码和原对象相同
+func setTypeDup(o *robj) *robj {
+	var set *robj
+	switch o.getEncoding() {
+	case ObjEncodingIntSet:
+		set = createObject(ObjSet, *(*intset.IntSet)(o.ptr).Dup())
+		set.setEncoding(ObjEncodingIntSet)
+	case ObjEncodingListPack:
+		lp := append([]byte(nil), *(*[]byte)(o.ptr)...)
+		set = createObject(ObjSet, lp)
+		set.setEncoding(ObjEncodingListPack)
+	case ObjEncodingHt:
+		set = createSetObject()
+		(*dict.Dict)(set.ptr).Expand(int64(setTypeSize(o)))
+		si := setTypeInitIterator(o)
+		for element := setTypeNextObject(si); element != nil; element = setTypeNextObject(si) {
+			setTypeAdd(set, unsafe.Pointer(element))
+		}
+		setTypeReleaseIterator(si)
+	default:
+		panic("Unknown set encoding")
+	}
+	return set
 }
 
 func setTypeReleaseIterator(si *setTypeIterator) {
@@ -128,12 +215,59 @@ func setTypeNext(si *setTypeIterator, sdsele *sds.SDS, llele *int64) int {
 		if !is.Get(ii, llele) {
 			return -1
 		}
+	} else if si.encoding == ObjEncodingListPack {
+		if si.lpi == nil {
+			return -1
+		}
+		*sdsele = listpackGetObject(si.lpi)
+		*llele = -123456789
+		si.lpi = listpack.Next(*(*[]byte)(si.subject.ptr), si.lpi)
 	} else {
 		panic("Wrong set encoding in setTypeNext")
 	}
 	return si.encoding
 }
 
+// setTypeNextObject 返回下一个元素的sds副本，intset中的整数也会转换成sds，迭代结束时返回nil
+func setTypeNextObject(si *setTypeIterator) *sds.SDS {
+	var sdsele sds.SDS
+	var intele int64
+	switch setTypeNext(si, &sdsele, &intele) {
+	case -1:
+		return nil
+	case ObjEncodingIntSet:
+		ele := sds.FromLongLong(intele)
+		return &ele
+	case ObjEncodingHt:
+		ele := sds.Dup(sdsele)
+		return &ele
+	case ObjEncodingListPack:
+		// listpack中取出的元素已经是一个新的sds
+		return &sdsele
+	default:
+		panic("Unsupported encoding")
+	}
+}
+
+// setTypeRandomElement 随机返回一个元素，返回值是集合的编码：
+// hashtable和listpack编码时元素保存在sdsele中，intset编码时保存在llele中
+func setTypeRandomElement(setobj *robj, sdsele *sds.SDS, llele *int64) int {
+	if setobj.getEncoding() == ObjEncodingHt {
+		de := (*dict.Dict)(setobj.ptr).GetFairRandomKey()
+		*sdsele = *(*sds.SDS)(dict.GetKey(de))
+		*llele = -123456789
+	} else if setobj.getEncoding() == ObjEncodingListPack {
+		lp := *(*[]byte)(setobj.ptr)
+		*sdsele = listpackGetObject(listpack.Index(lp, rand.Intn(listpack.Len(lp))))
+		*llele = -123456789
+	} else if setobj.getEncoding() == ObjEncodingIntSet {
+		*llele = (*intset.IntSet)(setobj.ptr).Random()
+	} else {
+		panic("Unknown set encoding")
+	}
+	return int(setobj.getEncoding())
+}
+
 func setTypeInitIterator(subject *robj) *setTypeIterator {
 	si := new(setTypeIterator)
 	si.subject = subject
@@ -142,6 +276,8 @@ func setTypeInitIterator(subject *robj) *setTypeIterator {
 		si.di = (*dict.Dict)(subject.ptr).GetIterator()
 	} else if si.encoding == ObjEncodingIntSet {
 		si.ii = 0
+	} else if si.encoding == ObjEncodingListPack {
+		si.lpi = listpack.First(*(*[]byte)(subject.ptr))
 	} else {
 		panic("Unknown set encoding")
 	}
@@ -188,6 +324,18 @@ func setTypeRemove(setobj *robj, value unsafe.Pointer) bool {
 			}
 			return true
 		}
+	} else if setobj.getEncoding() == ObjEncodingListPack {
+		sdsValue := *(*sds.SDS)(value)
+		lp := *(*[]byte)(setobj.ptr)
+		p := listpack.First(lp)
+		if p == nil {
+			return false
+		}
+		if p = listpack.Find(p, sdsValue.BufData(0), sds.Len(sdsValue), 0); p != nil {
+			lp = listpack.Delete(lp, &p)
+			setobj.ptr = unsafe.Pointer(&lp)
+			return true
+		}
 	} else if setobj.getEncoding() == ObjEncodingIntSet {
 		if isSdsRepresentableAsLongLong(*(*sds.SDS)(value), &llval) {
 			var success bool
@@ -208,6 +356,8 @@ func setTypeSize(subject *robj) int {
 		return int((*dict.Dict)(subject.ptr).Size())
 	} else if subject.getEncoding() == ObjEncodingIntSet {
 		return (*intset.IntSet)(subject.ptr).Len()
+	} else if subject.getEncoding() == ObjEncodingListPack {
+		return listpack.Len(*(*[]byte)(subject.ptr))
 	} else {
 		panic("Unknown set encoding")
 	}
@@ -223,10 +373,45 @@ func scardCommand(c *Client) {
 }
 
 func sinterCommand(c *Client) {
-	sinterGenericCommand(c, c.argv[1:], c.argc-1, nil)
+	sinterGenericCommand(c, c.argv[1:], c.argc-1, nil, false, 0)
+}
+
+// SINTERSTORE destination key [key ...]
+func sinterstoreCommand(c *Client) {
+	sinterGenericCommand(c, c.argv[2:], c.argc-2, c.argv[1], false, 0)
+}
+
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func sintercardCommand(c *Client) {
+	var numkeys, limit int64 // limit为0表示没有限制
+	if c.argv[1].getRangeLongFromObjectOrReply(c, 1, math.MaxInt64, &numkeys, "numkeys should be greater than 0") != C_OK {
+		return
+	}
+	if numkeys > int64(c.argc-2) {
+		addReplyError(c, "Number of keys can't be greater than number of args")
+		return
+	}
+
+	for j := 2 + int(numkeys); j < c.argc; j++ {
+		opt := (*sds.SDS)(c.argv[j].ptr).BufData(0)
+		moreargs := c.argc - 1 - j
+		if util.StrCaseCmp(opt, "limit") && moreargs > 0 {
+			j++
+			if c.argv[j].getPositiveLongFromObjectOrReply(c, &limit, "LIMIT can't be negative") != C_OK {
+				return
+			}
+		} else {
+			addReplyErrorObject(c, shared.syntaxErr)
+			return
+		}
+	}
+
+	sinterGenericCommand(c, c.argv[2:], int(numkeys), nil, true, int(limit))
 }
 
-func sinterGenericCommand(c *Client, setkeys []*robj, setnum int, dstkey *robj) {
+// sinterGenericCommand 计算交集，dstkey不为nil时保存到dstkey中；
+// cardinalityOnly为true时只回复交集的元素个数，达到limit时提前结束，limit为0表示没有限制
+func sinterGenericCommand(c *Client, setkeys []*robj, setnum int, dstkey *robj, cardinalityOnly bool, limit int) {
 	sets := make([]*robj, setnum)
 
 	var si *setTypeIterator
@@ -264,21 +449,24 @@ func sinterGenericCommand(c *Client, setkeys []*robj, setnum int, dstkey *robj)
 				server.dirty++
 			}
 			addReply(c, shared.czero)
+		} else if cardinalityOnly {
+			addReply(c, shared.czero)
 		} else {
 			addReply(c, shared.emptySet[c.resp])
 		}
 		return
 	}
 
+	// 从最小的集合开始遍历，检查的次数最少
 	sort.Slice(sets, func(i, j int) bool {
-		return setTypeSize(sets[i]) > setTypeSize(sets[j])
+		return setTypeSize(sets[i]) < setTypeSize(sets[j])
 	})
 
 	var replyLen *adlist.ListNode
-	if dstkey == nil {
-		replyLen = addReplyDeferredLen(c)
-	} else {
+	if dstkey != nil {
 		dstset = createIntsetObject()
+	} else if !cardinalityOnly {
+		replyLen = addReplyDeferredLen(c)
 	}
 
 	si = setTypeInitIterator(sets[0])
@@ -295,13 +483,13 @@ func sinterGenericCommand(c *Client, setkeys []*robj, setnum int, dstkey *robj)
 			if encoding == ObjEncodingIntSet {
 				if sets[j].getEncoding() == ObjEncodingIntSet && !(*intset.IntSet)(sets[j].ptr).Find(intobj) {
 					break
-				} else if sets[j].getEncoding() == ObjEncodingHt {
+				} else if sets[j].getEncoding() != ObjEncodingIntSet {
 					elesds = sds.FromLongLong(intobj)
 					if !setTypeIsMember(sets[j], elesds) {
 						break
 					}
 				}
-			} else if encoding == ObjEncodingHt {
+			} else {
 				if !setTypeIsMember(sets[j], elesds) {
 					break
 				}
@@ -309,26 +497,35 @@ func sinterGenericCommand(c *Client, setkeys []*robj, setnum int, dstkey *robj)
 		}
 
 		if j == setnum {
-			if dstkey == nil {
-				if encoding == ObjEncodingHt {
-					addReplyBulkBuffer(c, elesds.BufData(0), sds.Len(elesds))
-				} else {
+			if cardinalityOnly {
+				cardinality++
+				if limit > 0 && cardinality >= limit {
+					break
+				}
+			} else if dstkey == nil {
+				if encoding == ObjEncodingIntSet {
 					addReplyBulkLongLong(c, intobj)
+				} else {
+					addReplyBulkBuffer(c, elesds.BufData(0), sds.Len(elesds))
 				}
 				cardinality++
 			} else {
+				// dstset保存的是元素的指针，每个元素都需要单独的变量
+				var ele sds.SDS
 				if encoding == ObjEncodingIntSet {
-					elesds = sds.FromLongLong(intobj)
-					setTypeAdd(dstset, unsafe.Pointer(&elesds))
+					ele = sds.FromLongLong(intobj)
 				} else {
-					setTypeAdd(dstset, unsafe.Pointer(&elesds))
+					ele = sds.Dup(elesds)
 				}
+				setTypeAdd(dstset, unsafe.Pointer(&ele))
 			}
 		}
 	}
 
 	setTypeReleaseIterator(si)
-	if dstkey != nil {
+	if cardinalityOnly {
+		addReplyLongLong(c, cardinality)
+	} else if dstkey != nil {
 		deleted := dbDelete(c.db, dstkey)
 		if setTypeSize(dstset) > 0 {
 			c.db.dbAdd(dstkey, dstset)
@@ -342,6 +539,7 @@ func sinterGenericCommand(c *Client, setkeys []*robj, setnum int, dstkey *robj)
 			}
 		}
 		signalModifiedKey(c, c.db, dstkey)
+		server.dirty++
 	} else {
 		setDeferredSetLen(c, replyLen, cardinality)
 	}
@@ -355,8 +553,609 @@ func setTypeIsMember(subject *robj, value sds.SDS) bool {
 		if isSdsRepresentableAsLongLong(value, &llval) {
 			return (*intset.IntSet)(subject.ptr).Find(llval)
 		}
+	} else if subject.getEncoding() == ObjEncodingListPack {
+		lp := *(*[]byte)(subject.ptr)
+		if p := listpack.First(lp); p != nil {
+			return listpack.Find(p, value.BufData(0), sds.Len(value), 0) != nil
+		}
 	} else {
 		panic("Unknown set encoding")
 	}
 	return false
 }
+
+// SISMEMBER key member
+func sismemberCommand(c *Client) {
+	var set *robj
+	if set = lookupKeyReadOrReply(c, c.argv[1], shared.czero); set == nil || set.checkType(c, ObjSet) {
+		return
+	}
+
+	if setTypeIsMember(set, *(*sds.SDS)(c.argv[2].ptr)) {
+		addReply(c, shared.cone)
+	} else {
+		addReply(c, shared.czero)
+	}
+}
+
+// SMISMEMBER key member [member ...]
+func smismemberCommand(c *Client) {
+	// key不存在时当作空集合，每个member都回复0
+	set := c.db.lookupKeyRead(c.argv[1])
+	if set != nil && set.checkType(c, ObjSet) {
+		return
+	}
+
+	addReplyArrayLen(c, c.argc-2)
+	for j := 2; j < c.argc; j++ {
+		if set != nil && setTypeIsMember(set, *(*sds.SDS)(c.argv[j].ptr)) {
+			addReply(c, shared.cone)
+		} else {
+			addReply(c, shared.czero)
+		}
+	}
+}
+
+// SMOVE source destination member
+func smoveCommand(c *Client) {
+	srcset := c.db.lookupKeyWrite(c.argv[1])
+	dstset := c.db.lookupKeyWrite(c.argv[2])
+	ele := c.argv[3]
+
+	if srcset == nil {
+		addReply(c, shared.czero)
+		return
+	}
+
+	if srcset.checkType(c, ObjSet) || (dstset != nil && dstset.checkType(c, ObjSet)) {
+		return
+	}
+
+	// 源集合和目标集合相同时什么都不做
+	if srcset == dstset {
+		if setTypeIsMember(srcset, *(*sds.SDS)(ele.ptr)) {
+			addReply(c, shared.cone)
+		} else {
+			addReply(c, shared.czero)
+		}
+		return
+	}
+
+	if !setTypeRemove(srcset, ele.ptr) {
+		addReply(c, shared.czero)
+		return
+	}
+	notifyKeySpaceEvent(notifySet, "srem", c.argv[1], c.db.id)
+
+	if setTypeSize(srcset) == 0 {
+		dbDelete(c.db, c.argv[1])
+		notifyKeySpaceEvent(notifyGeneric, "del", c.argv[1], c.db.id)
+	}
+
+	if dstset == nil {
+		dstset = setTypeCreate(*(*sds.SDS)(ele.ptr), 1)
+		c.db.dbAdd(c.argv[2], dstset)
+	}
+
+	signalModifiedKey(c, c.db, c.argv[1])
+	server.dirty++
+
+	// 元素成功加入目标集合时，目标集合也被修改了
+	if setTypeAdd(dstset, ele.ptr) {
+		server.dirty++
+		signalModifiedKey(c, c.db, c.argv[2])
+		notifyKeySpaceEvent(notifySet, "sadd", c.argv[2], c.db.id)
+	}
+	addReply(c, shared.cone)
+}
+
+// sunionDiffGenericCommand 计算并集或者差集，dstkey不为nil时保存到dstkey中
+func sunionDiffGenericCommand(c *Client, setkeys []*robj, setnum int, dstkey *robj, op int) {
+	sets := make([]*robj, setnum)
+
+	for j := 0; j < setnum; j++ {
+		var setobj *robj
+		if dstkey != nil {
+			setobj = c.db.lookupKeyWrite(setkeys[j])
+		} else {
+			setobj = c.db.lookupKeyRead(setkeys[j])
+		}
+		if setobj == nil {
+			sets[j] = nil
+			continue
+		}
+		if setobj.checkType(c, ObjSet) {
+			return
+		}
+		sets[j] = setobj
+	}
+
+	// 选择差集的算法:
+	// 算法1遍历第一个集合的元素，检查它是否在其他集合中，复杂度O(N*M)，N是第一个集合的大小，M是集合的个数
+	// 算法2把第一个集合的元素加入结果，再删除其他集合的所有元素，复杂度O(N)，N是所有集合的元素总数
+	diffAlgo := 1
+	if op == setOpDiff && sets[0] != nil {
+		var algoOneWork, algoTwoWork int
+		for j := 0; j < setnum; j++ {
+			if sets[j] == nil {
+				continue
+			}
+			algoOneWork += setTypeSize(sets[0])
+			algoTwoWork += setTypeSize(sets[j])
+		}
+
+		// 有相同元素时算法1的操作更少，常数时间也更好，给它一些优势
+		algoOneWork /= 2
+		if algoOneWork > algoTwoWork {
+			diffAlgo = 2
+		}
+
+		if diffAlgo == 1 && setnum > 1 {
+			// 算法1按照集合从大到小的顺序检查，可以尽早找到重复的元素
+			rest := sets[1:]
+			sort.Slice(rest, func(i, j int) bool {
+				var si, sj int
+				if rest[i] != nil {
+					si = setTypeSize(rest[i])
+				}
+				if rest[j] != nil {
+					sj = setTypeSize(rest[j])
+				}
+				return si > sj
+			})
+		}
+	}
+
+	// 结果先保存在临时集合中，STORE命令会直接把它保存到dstkey
+	dstset := createIntsetObject()
+	var cardinality int
+
+	if op == setOpUnion {
+		for j := 0; j < setnum; j++ {
+			if sets[j] == nil {
+				continue
+			}
+			si := setTypeInitIterator(sets[j])
+			for ele := setTypeNextObject(si); ele != nil; ele = setTypeNextObject(si) {
+				if setTypeAdd(dstset, unsafe.Pointer(ele)) {
+					cardinality++
+				}
+			}
+			setTypeReleaseIterator(si)
+		}
+	} else if op == setOpDiff && sets[0] != nil && diffAlgo == 1 {
+		si := setTypeInitIterator(sets[0])
+		for ele := setTypeNextObject(si); ele != nil; ele = setTypeNextObject(si) {
+			var j int
+			for j = 1; j < setnum; j++ {
+				if sets[j] == nil {
+					continue
+				}
+				if sets[j] == sets[0] || setTypeIsMember(sets[j], *ele) {
+					break
+				}
+			}
+			if j == setnum {
+				setTypeAdd(dstset, unsafe.Pointer(ele))
+				cardinality++
+			}
+		}
+		setTypeReleaseIterator(si)
+	} else if op == setOpDiff && sets[0] != nil && diffAlgo == 2 {
+		for j := 0; j < setnum; j++ {
+			if sets[j] == nil {
+				continue
+			}
+			si := setTypeInitIterator(sets[j])
+			for ele := setTypeNextObject(si); ele != nil; ele = setTypeNextObject(si) {
+				if j == 0 {
+					if setTypeAdd(dstset, unsafe.Pointer(ele)) {
+						cardinality++
+					}
+				} else {
+					if setTypeRemove(dstset, unsafe.Pointer(ele)) {
+						cardinality--
+					}
+				}
+			}
+			setTypeReleaseIterator(si)
+
+			// 结果已经为空，继续删除没有意义
+			if cardinality == 0 {
+				break
+			}
+		}
+	}
+
+	if dstkey == nil {
+		addReplySetLen(c, cardinality)
+		si := setTypeInitIterator(dstset)
+		for ele := setTypeNextObject(si); ele != nil; ele = setTypeNextObject(si) {
+			addReplyBulkBuffer(c, ele.BufData(0), sds.Len(*ele))
+		}
+		setTypeReleaseIterator(si)
+		dstset.decrRefCount()
+	} else {
+		deleted := dbDelete(c.db, dstkey)
+		if setTypeSize(dstset) > 0 {
+			c.db.dbAdd(dstkey, dstset)
+			addReplyLongLong(c, setTypeSize(dstset))
+			event := "sdiffstore"
+			if op == setOpUnion {
+				event = "sunionstore"
+			}
+			notifyKeySpaceEvent(notifySet, event, dstkey, c.db.id)
+		} else {
+			dstset.decrRefCount()
+			addReply(c, shared.czero)
+			if deleted {
+				notifyKeySpaceEvent(notifyGeneric, "del", dstkey, c.db.id)
+			}
+		}
+		signalModifiedKey(c, c.db, dstkey)
+		server.dirty++
+	}
+}
+
+// SUNION key [key ...]
+func sunionCommand(c *Client) {
+	sunionDiffGenericCommand(c, c.argv[1:], c.argc-1, nil, setOpUnion)
+}
+
+// SUNIONSTORE destination key [key ...]
+func sunionstoreCommand(c *Client) {
+	sunionDiffGenericCommand(c, c.argv[2:], c.argc-2, c.argv[1], setOpUnion)
+}
+
+// SDIFF key [key ...]
+func sdiffCommand(c *Client) {
+	sunionDiffGenericCommand(c, c.argv[1:], c.argc-1, nil, setOpDiff)
+}
+
+// SDIFFSTORE destination key [key ...]
+func sdiffstoreCommand(c *Client) {
+	sunionDiffGenericCommand(c, c.argv[2:], c.argc-2, c.argv[1], setOpDiff)
+}
+
+// SPOP key [count]
+func spopCommand(c *Client) {
+	if c.argc == 3 {
+		spopWithCountCommand(c)
+		return
+	} else if c.argc > 3 {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+
+	var set *robj
+	if set = lookupKeyWriteOrReply(c, c.argv[1], shared.null[c.resp]); set == nil || set.checkType(c, ObjSet) {
+		return
+	}
+
+	var sdsele sds.SDS
+	var llele int64
+	var ele *robj
+	if setTypeRandomElement(set, &sdsele, &llele) == ObjEncodingIntSet {
+		ele = createStringObjectFromLongLongWithOptions(llele, 0)
+		set.ptr = unsafe.Pointer((*intset.IntSet)(set.ptr).Remove(llele, nil))
+	} else {
+		ele = createRawStringObject(sdsele.BufData(0))
+		setTypeRemove(set, ele.ptr)
+	}
+
+	notifyKeySpaceEvent(notifySet, "spop", c.argv[1], c.db.id)
+
+	// 以SREM的形式传播
+	key := c.argv[1]
+	rewriteClientCommandVector(c, 3, shared.srem, key, ele)
+
+	addReplyBulk(c, ele)
+
+	if setTypeSize(set) == 0 {
+		dbDelete(c.db, key)
+		notifyKeySpaceEvent(notifyGeneric, "del", key, c.db.id)
+	}
+
+	signalModifiedKey(c, c.db, key)
+	server.dirty++
+}
+
+// spopMoveStrategyMul 剩余元素个数*spopMoveStrategyMul大于count时，直接随机弹出count个元素，
+// 否则随机选出需要保留的元素组成新的集合，原来的集合整个返回给客户端
+const spopMoveStrategyMul = 5
+
+// spopWithCountCommand 实现SPOP key count
+func spopWithCountCommand(c *Client) {
+	var l int64
+	if c.argv[2].getPositiveLongFromObjectOrReply(c, &l, "") != C_OK {
+		return
+	}
+	count := int(l)
+
+	var set *robj
+	if set = lookupKeyWriteOrReply(c, c.argv[1], shared.emptySet[c.resp]); set == nil || set.checkType(c, ObjSet) {
+		return
+	}
+
+	// count为0时直接返回，避免后面的特殊情况
+	if count == 0 {
+		addReply(c, shared.emptySet[c.resp])
+		return
+	}
+
+	size := setTypeSize(set)
+
+	notifyKeySpaceEvent(notifySet, "spop", c.argv[1], c.db.id)
+	server.dirty += count
+
+	// CASE 1: count大于等于集合的大小，返回整个集合并删除key
+	if count >= size {
+		sunionDiffGenericCommand(c, c.argv[1:], 1, nil, setOpUnion)
+
+		key := c.argv[1]
+		dbDelete(c.db, key)
+		notifyKeySpaceEvent(notifyGeneric, "del", key, c.db.id)
+
+		// 以DEL的形式传播
+		rewriteClientCommandVector(c, 2, shared.del, key)
+		signalModifiedKey(c, c.db, key)
+		return
+	}
+
+	addReplySetLen(c, count)
+
+	var sdsele sds.SDS
+	var llele int64
+	remaining := size - count // SPOP之后剩余的元素个数
+
+	if remaining*spopMoveStrategyMul > count {
+		// CASE 2: 需要返回的元素比集合小很多，随机选出元素返回并从集合中删除
+		for ; count > 0; count-- {
+			if setTypeRandomElement(set, &sdsele, &llele) == ObjEncodingIntSet {
+				addReplyBulkLongLong(c, llele)
+				set.ptr = unsafe.Pointer((*intset.IntSet)(set.ptr).Remove(llele, nil))
+			} else {
+				addReplyBulkBuffer(c, sdsele.BufData(0), sds.Len(sdsele))
+				setTypeRemove(set, unsafe.Pointer(&sdsele))
+			}
+		}
+	} else {
+		// CASE 3: 需要返回的元素接近集合的大小，随机选出需要保留的元素，
+		// 组成新的集合作为key的值，原来集合中剩下的元素全部返回
+		var newset *robj
+		for ; remaining > 0; remaining-- {
+			var ele sds.SDS
+			if setTypeRandomElement(set, &sdsele, &llele) == ObjEncodingIntSet {
+				ele = sds.FromLongLong(llele)
+			} else {
+				ele = sds.Dup(sdsele)
+			}
+			if newset == nil {
+				newset = setTypeCreate(ele, remaining)
+			}
+			setTypeAdd(newset, unsafe.Pointer(&ele))
+			setTypeRemove(set, unsafe.Pointer(&ele))
+		}
+
+		si := setTypeInitIterator(set)
+		for {
+			encoding := setTypeNext(si, &sdsele, &llele)
+			if encoding == -1 {
+				break
+			}
+			if encoding == ObjEncodingIntSet {
+				addReplyBulkLongLong(c, llele)
+			} else {
+				addReplyBulkBuffer(c, sdsele.BufData(0), sds.Len(sdsele))
+			}
+		}
+		setTypeReleaseIterator(si)
+
+		c.db.dbOverwrite(c.argv[1], newset)
+	}
+
+	signalModifiedKey(c, c.db, c.argv[1])
+}
+
+const (
+	// count*srandmemberSubStrategyMul大于集合的大小时，先复制整个集合再随机删除，
+	// 否则不断随机选择直到选出count个不重复的元素
+	srandmemberSubStrategyMul = 3
+	// 允许重复时，每次从listpack中最多取出的元素个数
+	srandmemberRandomSampleLimit = 1000
+)
+
+// srandmemberReplyWithListpack 回复从listpack中随机取出的元素
+func srandmemberReplyWithListpack(c *Client, count int, entries []listpack.Entry) {
+	for i := 0; i < count; i++ {
+		if entries[i].Sval != nil {
+			addReplyBulkBuffer(c, entries[i].Sval, entries[i].Slen)
+		} else {
+			addReplyBulkLongLong(c, entries[i].Lval)
+		}
+	}
+}
+
+// srandmemberWithCountCommand 实现SRANDMEMBER key count，count为负数时允许重复
+func srandmemberWithCountCommand(c *Client) {
+	var l int64
+	if c.argv[2].getRangeLongFromObjectOrReply(c, -math.MaxInt64, math.MaxInt64, &l, "") != C_OK {
+		return
+	}
+	uniq := true
+	count := int(l)
+	if l < 0 {
+		count = int(-l)
+		uniq = false
+	}
+
+	var set *robj
+	if set = lookupKeyReadOrReply(c, c.argv[1], shared.emptyArray); set == nil || set.checkType(c, ObjSet) {
+		return
+	}
+	size := setTypeSize(set)
+
+	// count为0时直接返回，避免后面的特殊情况
+	if count == 0 {
+		addReply(c, shared.emptyArray)
+		return
+	}
+
+	var ele sds.SDS
+	var llele int64
+
+	// CASE 1: count为负数，每次都从整个集合中随机选择，结果可能重复
+	if !uniq || count == 1 {
+		addReplyArrayLen(c, count)
+		if set.getEncoding() == ObjEncodingListPack && count > 1 {
+			// 从listpack中多次随机选择一个元素效率很低，分批一次遍历选出多个元素
+			limit := count
+			if limit > srandmemberRandomSampleLimit {
+				limit = srandmemberRandomSampleLimit
+			}
+			entries := make([]listpack.Entry, limit)
+			for count > 0 {
+				sampleCount := limit
+				if sampleCount > count {
+					sampleCount = count
+				}
+				count -= sampleCount
+				listpack.RandomElements(*(*[]byte)(set.ptr), sampleCount, entries)
+				srandmemberReplyWithListpack(c, sampleCount, entries)
+			}
+			return
+		}
+		for ; count > 0; count-- {
+			if setTypeRandomElement(set, &ele, &llele) == ObjEncodingIntSet {
+				addReplyBulkLongLong(c, llele)
+			} else {
+				addReplyBulkBuffer(c, ele.BufData(0), sds.Len(ele))
+			}
+		}
+		return
+	}
+
+	// CASE 2: count大于等于集合的大小，直接返回整个集合
+	if count >= size {
+		addReplyArrayLen(c, size)
+		si := setTypeInitIterator(set)
+		for {
+			encoding := setTypeNext(si, &ele, &llele)
+			if encoding == -1 {
+				break
+			}
+			if encoding == ObjEncodingIntSet {
+				addReplyBulkLongLong(c, llele)
+			} else {
+				addReplyBulkBuffer(c, ele.BufData(0), sds.Len(ele))
+			}
+			size--
+		}
+		setTypeReleaseIterator(si)
+		if size != 0 {
+			panic("srandmember: set size changed while iterating")
+		}
+		return
+	}
+
+	// listpack编码时一次遍历就能选出count个不重复的元素
+	if set.getEncoding() == ObjEncodingListPack {
+		entries := make([]listpack.Entry, count)
+		if listpack.RandomElementsUnique(*(*[]byte)(set.ptr), count, entries) != count {
+			panic("srandmember: not enough unique elements in listpack")
+		}
+		addReplyArrayLen(c, count)
+		srandmemberReplyWithListpack(c, count, entries)
+		return
+	}
+
+	// CASE 3和CASE 4需要一个辅助的dict
+	d := dict.Create(setDictType, nil)
+
+	if count*srandmemberSubStrategyMul > size {
+		// CASE 3: count和集合的大小相差不大，复制整个集合，再随机删除元素直到剩下count个
+		d.Expand(int64(size))
+		si := setTypeInitIterator(set)
+		for {
+			encoding := setTypeNext(si, &ele, &llele)
+			if encoding == -1 {
+				break
+			}
+			var sdsele sds.SDS
+			if encoding == ObjEncodingIntSet {
+				sdsele = sds.FromLongLong(llele)
+			} else {
+				sdsele = sds.Dup(ele)
+			}
+			if !d.Add(unsafe.Pointer(&sdsele), nil) {
+				panic("srandmember: duplicate element in set")
+			}
+		}
+		setTypeReleaseIterator(si)
+
+		for ; size > count; size-- {
+			de := d.GetRandomKey()
+			d.Delete(dict.GetKey(de))
+		}
+	} else {
+		// CASE 4: 集合比count大很多，不断随机选择元素，直到选出count个不重复的元素
+		d.Expand(int64(count))
+		for added := 0; added < count; {
+			var sdsele sds.SDS
+			if setTypeRandomElement(set, &ele, &llele) == ObjEncodingIntSet {
+				sdsele = sds.FromLongLong(llele)
+			} else {
+				sdsele = sds.Dup(ele)
+			}
+			if d.Add(unsafe.Pointer(&sdsele), nil) {
+				added++
+			}
+		}
+	}
+
+	// CASE 3和CASE 4: 回复dict中的元素
+	addReplyArrayLen(c, count)
+	di := d.GetIterator()
+	for de := di.Next(); de != nil; de = di.Next() {
+		sdsele := *(*sds.SDS)(dict.GetKey(de))
+		addReplyBulkBuffer(c, sdsele.BufData(0), sds.Len(sdsele))
+	}
+	di.Release()
+}
+
+// SRANDMEMBER key [count]
+func srandmemberCommand(c *Client) {
+	if c.argc == 3 {
+		srandmemberWithCountCommand(c)
+		return
+	} else if c.argc > 3 {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+
+	var set *robj
+	if set = lookupKeyReadOrReply(c, c.argv[1], shared.null[c.resp]); set == nil || set.checkType(c, ObjSet) {
+		return
+	}
+
+	var ele sds.SDS
+	var llele int64
+	if setTypeRandomElement(set, &ele, &llele) == ObjEncodingIntSet {
+		addReplyBulkLongLong(c, llele)
+	} else {
+		addReplyBulkBuffer(c, ele.BufData(0), sds.Len(ele))
+	}
+}
+
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+func sscanCommand(c *Client) {
+	var cursor uint64
+	if parseScanCursorOrReply(c, c.argv[2], &cursor) != C_OK {
+		return
+	}
+	set := lookupKeyReadOrReply(c, c.argv[1], shared.emptyScan)
+	if set == nil || set.checkType(c, ObjSet) {
+		return
+	}
+	scanGenericCommand(c, set, cursor)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// setEncodings 分别用intset/listpack和hashtable编码执行f
+func setEncodings(t *testing.T, f func(t *testing.T, c *Client)) {
+	for _, maxEntries := range []int{128, 0} {
+		testServerInit()
+		server.setMaxIntSetEntries = maxEntries
+		server.setMaxListpackEntries = maxEntries
+		f(t, testClient())
+	}
+}
+
+// testSetRun 和testRun一样，但是数组回复按元素排序之后再比较，集合元素的顺序和编码有关
+func testSetRun(t *testing.T, c *Client, cases []testCase) {
+	t.Helper()
+	for _, tc := range cases {
+		reply := testCommand(c, strings.Fields(tc.cmd)...)
+		if strings.HasPrefix(reply, "[") {
+			items := strings.Fields(strings.Trim(reply, "[]"))
+			sort.Strings(items)
+			reply = "[" + strings.Join(items, " ") + "]"
+		}
+		if reply != tc.expect {
+			t.Errorf("%s: expect %q, got %q", tc.cmd, tc.expect, reply)
+		}
+	}
+}
+
+func TestSetAlgebraCommands(t *testing.T) {
+	setEncodings(t, func(t *testing.T, c *Client) {
+		testSetRun(t, c, []testCase{
+			{"sadd s1 1 2 3 4", ":4"},
+			{"sadd s2 3 4 5", ":3"},
+			{"sadd s3 a b 3", ":3"},
+
+			{"sinter s1 s2", "[3 4]"},
+			{"sinter s1 s2 s3", "[3]"},
+			{"sinter s1 nokey", "[]"},
+			{"sunion s1 s2 nokey", "[1 2 3 4 5]"},
+			{"sdiff s1 s2 s3", "[1 2]"},
+			{"sdiff nokey s1", "[]"},
+			{"sdiff s1 s1", "[]"},
+
+			// 目标key也是源key
+			{"sunionstore s1 s1 s3", ":6"},
+			{"smembers s1", "[1 2 3 4 a b]"},
+			{"sdiffstore s1 s1 s3", ":3"},
+			{"smembers s1", "[1 2 4]"},
+			{"sinterstore s2 s2 s1", ":1"},
+			{"smembers s2", "[4]"},
+
+			// 结果为空时删除目标key
+			{"sinterstore s2 s2 s3", ":0"},
+			{"exists s2", ":0"},
+			{"sdiffstore s3 s3 s3", ":0"},
+			{"exists s3", ":0"},
+			{"sunionstore dst nokey", ":0"},
+			{"exists dst", ":0"},
+
+			{"set str x", "+OK"},
+			{"sinter s1 str", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+			{"sunionstore str s1", ":3"},
+			{"type str", "+set"},
+		})
+	})
+}
+
+func TestSintercardCommand(t *testing.T) {
+	setEncodings(t, func(t *testing.T, c *Client) {
+		testSetRun(t, c, []testCase{
+			{"sadd s1 a b c d", ":4"},
+			{"sadd s2 b c d e", ":4"},
+			{"sintercard 2 s1 s2", ":3"},
+			{"sintercard 1 s1", ":4"},
+			{"sintercard 2 s1 s2 limit 2", ":2"},
+			{"sintercard 2 s1 s2 limit 0", ":3"},
+			{"sintercard 2 s1 s2 limit 10", ":3"},
+			{"sintercard 2 s1 nokey", ":0"},
+			{"sintercard 0 s1", "-ERR numkeys should be greater than 0"},
+			{"sintercard 3 s1 s2", "-ERR Number of keys can't be greater than number of args"},
+			{"sintercard 2 s1 s2 limit -1", "-ERR LIMIT can't be negative"},
+			{"sintercard 2 s1 s2 limit", "-ERR syntax error"},
+			{"sintercard 1 s1 s2", "-ERR syntax error"},
+		})
+	})
+}
+
+func TestSmoveCommand(t *testing.T) {
+	setEncodings(t, func(t *testing.T, c *Client) {
+		testSetRun(t, c, []testCase{
+			{"sadd src 1 2 a", ":3"},
+			{"sadd ints 5 6", ":2"},
+
+			// 源和目标相同时只检查元素是否存在
+			{"smove src src a", ":1"},
+			{"smove src src nomember", ":0"},
+			{"smembers src", "[1 2 a]"},
+
+			{"smove src dst nomember", ":0"},
+			{"exists dst", ":0"},
+			{"smove nokey dst a", ":0"},
+
+			// 字符串元素移动到intset编码的集合
+			{"smove src ints a", ":1"},
+			{"smembers ints", "[5 6 a]"},
+			{"smove src dst 1", ":1"},
+			{"smove ints dst 1", ":0"},
+			{"sadd ints 2", ":1"},
+			{"smove ints src 2", ":1"},
+			{"smembers src", "[2]"},
+			{"smove src dst 2", ":1"},
+			{"exists src", ":0"},
+			{"smembers dst", "[1 2]"},
+
+			{"set str x", "+OK"},
+			{"smove dst str 1", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+			{"smove str dst 1", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+			{"smembers dst", "[1 2]"},
+		})
+	})
+}
+
+func TestSetEncodingConvert(t *testing.T) {
+	testServerInit()
+	server.setMaxIntSetEntries = 3
+	server.setMaxListpackEntries = 4
+	server.setMaxListpackValue = 8
+	c := testClient()
+
+	testSetRun(t, c, []testCase{
+		// 整数个数超过setMaxIntSetEntries时intset直接转换成hashtable
+		{"sadd ints 1 2 3", ":3"},
+		{"object encoding ints", "intset"},
+		{"sadd ints 4", ":1"},
+		{"object encoding ints", "hashtable"},
+		{"smembers ints", "[1 2 3 4]"},
+
+		// 太长的字符串元素直接转换成hashtable
+		{"sadd long 1 123456789", ":2"},
+		{"object encoding long", "intset"},
+		{"sadd long abcdefghi", ":1"},
+		{"object encoding long", "hashtable"},
+		{"smembers long", "[1 123456789 abcdefghi]"},
+	})
+
+	// 加入非整数元素时intset转换成listpack，元素个数超过setMaxListpackEntries时再转换成hashtable
+	testArgsRun(t, c, []testArgsCase{
+		{[]string{"sadd", "s", "1", "2"}, ":2"},
+		{[]string{"object", "encoding", "s"}, "intset"},
+		{[]string{"sadd", "s", ""}, ":1"},
+		{[]string{"object", "encoding", "s"}, "listpack"},
+		{[]string{"sismember", "s", ""}, ":1"},
+		{[]string{"sismember", "s", "1"}, ":1"},
+		{[]string{"sadd", "s", "a", ""}, ":1"},
+		{[]string{"object", "encoding", "s"}, "listpack"},
+		{[]string{"sadd", "s", "b"}, ":1"},
+		{[]string{"object", "encoding", "s"}, "hashtable"},
+		{[]string{"scard", "s"}, ":5"},
+		{[]string{"smismember", "s", "", "1", "2", "a", "b", "c"}, "[:1 :1 :1 :1 :1 :0]"},
+		{[]string{"srem", "s", ""}, ":1"},
+		{[]string{"sismember", "s", ""}, ":0"},
+	})
+}
+
+// setReplyItems 把数组回复拆分成元素
+func setReplyItems(reply string) []string {
+	return strings.Fields(strings.Trim(reply, "[]"))
+}
+
+func TestSpopSrandmemberWithCount(t *testing.T) {
+	for _, tt := range []struct {
+		encoding string
+		prefix   string // 元素前缀，为空时元素都是整数
+		maxLp    int
+	}{
+		{"intset", "", 128},
+		{"listpack", "m", 128},
+		{"hashtable", "m", 0},
+	} {
+		testServerInit()
+		server.setMaxListpackEntries = tt.maxLp
+		c := testClient()
+
+		const size = 20
+		members := make(map[string]bool, size)
+		args := []string{"sadd", "s"}
+		for i := 0; i < size; i++ {
+			m := tt.prefix + strconv.Itoa(i)
+			members[m] = true
+			args = append(args, m)
+		}
+		testCommand(c, args...)
+		if enc := testCommand(c, "object", "encoding", "s"); enc != tt.encoding {
+			t.Fatalf("expect encoding %s, got %s", tt.encoding, enc)
+		}
+
+		// 覆盖逐个随机选择、复制后删除、返回整个集合等不同的策略
+		for _, count := range []int{1, 2, 6, 15, 19, 20, 30} {
+			items := setReplyItems(testCommand(c, "srandmember", "s", strconv.Itoa(count)))
+			expect := count
+			if expect > size {
+				expect = size
+			}
+			if len(items) != expect {
+				t.Fatalf("%s: srandmember %d: expect %d items, got %d", tt.encoding, count, expect, len(items))
+			}
+			seen := make(map[string]bool)
+			for _, item := range items {
+				if !members[item] || seen[item] {
+					t.Fatalf("%s: srandmember %d: unexpected or duplicate item %q", tt.encoding, count, item)
+				}
+				seen[item] = true
+			}
+		}
+
+		// count为负数时允许重复，返回的元素个数正好是-count
+		for _, count := range []int{-1, -5, -20, -100} {
+			items := setReplyItems(testCommand(c, "srandmember", "s", strconv.Itoa(count)))
+			if len(items) != -count {
+				t.Fatalf("%s: srandmember %d: expect %d items, got %d", tt.encoding, count, -count, len(items))
+			}
+			for _, item := range items {
+				if !members[item] {
+					t.Fatalf("%s: srandmember %d: unexpected item %q", tt.encoding, count, item)
+				}
+			}
+		}
+		testRun(t, c, []testCase{
+			{"srandmember s 0", "[]"},
+			{"srandmember nokey 5", "[]"},
+			{"srandmember nokey -5", "[]"},
+			{"scard s", ":20"},
+		})
+
+		// SPOP返回的元素从集合中删除，最后一次只剩下很少的元素，会选出保留的元素组成新的集合
+		remaining := size
+		for _, count := range []int{1, 2, 3, 13} {
+			items := setReplyItems(testCommand(c, "spop", "s", strconv.Itoa(count)))
+			if len(items) != count {
+				t.Fatalf("%s: spop %d: expect %d items, got %d", tt.encoding, count, count, len(items))
+			}
+			for _, item := range items {
+				if !members[item] {
+					t.Fatalf("%s: spop %d: unexpected or duplicate item %q", tt.encoding, count, item)
+				}
+				delete(members, item)
+				if reply := testCommand(c, "sismember", "s", item); reply != ":0" {
+					t.Fatalf("%s: spop %d: %q should be removed", tt.encoding, count, item)
+				}
+			}
+			remaining -= count
+			if reply := testCommand(c, "scard", "s"); reply != ":"+strconv.Itoa(remaining) {
+				t.Fatalf("%s: spop %d: expect scard %d, got %s", tt.encoding, count, remaining, reply)
+			}
+		}
+
+		testRun(t, c, []testCase{
+			{"spop s 0", "[]"},
+			{"scard s", ":1"},
+			{"spop s -1", "-ERR value is out of range, must be positive"},
+			{"srandmember s x", "-ERR value is not an integer or out of range"},
+		})
+
+		// count大于等于集合的大小时返回整个集合并删除key
+		items := setReplyItems(testCommand(c, "spop", "s", "10"))
+		if len(items) != 1 || !members[items[0]] {
+			t.Fatalf("%s: spop the last item: got %q", tt.encoding, items)
+		}
+		testRun(t, c, []testCase{
+			{"exists s", ":0"},
+			{"spop nokey 3", "[]"},
+		})
+	}
+}
@@ -0,0 +1,2807 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/pengdafu/redis-golang/adlist"
+	"github.com/pengdafu/redis-golang/listpack"
+	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+	"math"
+	"strconv"
+	"unsafe"
+)
+
+/*-----------------------------------------------------------------------------
+ * Stream的底层实现
+ *
+ * stream使用rax保存，rax的key是节点中第一个元素的ID(16字节大端序)，value是listpack。
+ * 每个listpack的开头是master entry:
+ *
+ *   count | deleted | numfields | field_1 | ... | field_N | 0
+ *
+ * 之后每个元素的格式为:
+ *
+ *   flags | ms-diff | seq-diff | [numfields | field_1 |] value_1 | ... | lp-count
+ *
+ * 元素的field和master entry一样时设置SAMEFIELDS标记，只保存value。
+ * ID保存的是和master ID的差值，lp-count是元素占用的listpack元素个数(不包括它自己)，用来反向遍历
+ *----------------------------------------------------------------------------*/
+
+const (
+	streamItemFlagNone       = 0      // 没有特殊标记
+	streamItemFlagDeleted    = 1 << 0 // 元素已经被删除，只是还留在listpack中
+	streamItemFlagSameFields = 1 << 1 // 元素和master entry的field一样
+
+	streamListpackMaxSize = 1 << 30 // 单个listpack的最大字节数
+	streamDefaultLimit    = 10000   // 近似裁剪时默认最多删除的元素个数
+
+	scgInvalidEntriesRead = -1 // 消费组读取过的元素个数未知
+
+	xreadBlockedDefaultCount = 1000 // 阻塞的XREAD没有指定COUNT时最多返回的元素个数
+)
+
+// streamReplyWithRange的flags
+const (
+	streamRwrNoAck      = 1 << 0 // 不把元素加入PEL
+	streamRwrRawEntries = 1 << 1 // 不回复数组的长度
+	streamRwrHistory    = 1 << 2 // 只返回consumer的PEL中的元素
+)
+
+const (
+	trimStrategyNone = iota
+	trimStrategyMaxLen
+	trimStrategyMinID
+)
+
+type streamID struct {
+	ms  uint64 // unix时间戳，毫秒
+	seq uint64 // 同一毫秒内的序号
+}
+
+type stream struct {
+	rax               *rax     // 保存所有元素的基数树
+	length            uint64   // 元素个数
+	lastID            streamID // 最后一个元素的ID，空stream为0-0
+	firstID           streamID // 第一个未删除元素的ID，空stream为0-0
+	maxDeletedEntryID streamID // 被删除的元素中最大的ID
+	entriesAdded      uint64   // 一共添加过多少个元素
+	cgroups           *rax     // 消费组，没有消费组时为nil
+}
+
+// streamCG 消费组
+type streamCG struct {
+	lastID      streamID // 最后一个投递给consumer的ID
+	entriesRead int64    // 读取过的元素个数，用来计算lag，未知时为scgInvalidEntriesRead
+	pel         *rax     // 已经投递但是还没有确认的元素，ID -> *streamNACK
+	consumers   *rax     // consumer名称 -> *streamConsumer
+}
+
+// streamConsumer 消费组中的consumer
+type streamConsumer struct {
+	seenTime int64   // 最后一次活动的时间，毫秒
+	name     sds.SDS // consumer的名称
+	pel      *rax    // 投递给这个consumer但是还没有确认的元素，和消费组的PEL共享streamNACK
+}
+
+// streamNACK PEL中的元素
+type streamNACK struct {
+	deliveryTime  int64           // 最后一次投递的时间，毫秒
+	deliveryCount int64           // 投递的次数
+	consumer      *streamConsumer // 最后一次投递给了哪个consumer
+}
+
+// streamIterator 遍历stream中[start, end]范围内的元素
+type streamIterator struct {
+	stream            *stream
+	masterID          streamID // 当前listpack的master ID
+	masterFieldsCount int64    // master entry中field的个数
+	masterFieldsStart []byte   // master entry中第一个field
+	masterFieldsPtr   []byte   // SAMEFIELDS元素下一个要返回的field
+	entryFlags        int64    // 当前元素的flags
+	rev               bool     // 是否反向遍历
+	skipTombstones    bool     // 是否跳过已删除的元素
+	startKey          [16]byte
+	endKey            [16]byte
+	ri                raxIterator
+	lpp               *[]byte // 当前listpack在rax中保存的指针
+	lp                []byte  // 当前listpack，为nil时需要移动到下一个节点
+	lpEle             []byte  // 当前listpack元素
+	lpFlags           []byte  // 当前元素的flags
+}
+
+// streamAddTrimArgs XADD和XTRIM的参数
+type streamAddTrimArgs struct {
+	id         streamID // XADD指定的ID
+	idGiven    bool     // 是否指定了ID
+	seqGiven   bool     // 是否指定了seq，ms-*的形式为false
+	noMkStream bool     // key不存在时不创建stream
+
+	trimStrategy       int   // 裁剪策略
+	trimStrategyArgIdx int   // 裁剪参数的下标，用来重写命令
+	approxTrim         bool  // 是否使用了~
+	limit              int64 // 最多删除的元素个数，0表示不限制
+	maxlen             int64 // MAXLEN参数
+	minid              streamID
+}
+
+func streamEncodeID(buf []byte, id *streamID) {
+	binary.BigEndian.PutUint64(buf, id.ms)
+	binary.BigEndian.PutUint64(buf[8:], id.seq)
+}
+
+func streamDecodeID(buf []byte, id *streamID) {
+	id.ms = binary.BigEndian.Uint64(buf)
+	id.seq = binary.BigEndian.Uint64(buf[8:])
+}
+
+func streamCompareID(a, b *streamID) int {
+	if a.ms > b.ms {
+		return 1
+	} else if a.ms < b.ms {
+		return -1
+	} else if a.seq > b.seq {
+		return 1
+	} else if a.seq < b.seq {
+		return -1
+	}
+	return 0
+}
+
+// streamIncrID 把id加一，已经是最大值时返回C_ERR并把id设置为0-0
+func streamIncrID(id *streamID) error {
+	ret := C_OK
+	if id.seq == math.MaxUint64 {
+		if id.ms == math.MaxUint64 {
+			id.ms, id.seq = 0, 0
+			ret = C_ERR
+		} else {
+			id.ms++
+			id.seq = 0
+		}
+	} else {
+		id.seq++
+	}
+	return ret
+}
+
+// streamDecrID 把id减一，已经是最小值时返回C_ERR并把id设置为最大值
+func streamDecrID(id *streamID) error {
+	ret := C_OK
+	if id.seq == 0 {
+		if id.ms == 0 {
+			id.ms, id.seq = math.MaxUint64, math.MaxUint64
+			ret = C_ERR
+		} else {
+			id.ms--
+			id.seq = math.MaxUint64
+		}
+	} else {
+		id.seq--
+	}
+	return ret
+}
+
+// streamNextID 根据当前时间和lastID生成下一个ID
+func streamNextID(lastID, newID *streamID) {
+	ms := uint64(mstime())
+	if ms > lastID.ms {
+		newID.ms, newID.seq = ms, 0
+	} else {
+		*newID = *lastID
+		streamIncrID(newID)
+	}
+}
+
+// lpGetInteger 获取p指向的整数，stream只会在listpack中写入可以编码成整数的值
+func lpGetInteger(p []byte) int64 {
+	var sstr []byte
+	var slen int
+	var v int64
+	listpack.Get(p, &sstr, &slen, &v)
+	if sstr == nil {
+		return v
+	}
+	v, err := strconv.ParseInt(util.Bytes2String(sstr[:slen]), 10, 64)
+	if err != nil {
+		panic("stream: listpack entry is not an integer")
+	}
+	return v
+}
+
+// lpGetString 获取p指向的元素，整数会被转换成字符串
+func lpGetString(p []byte) []byte {
+	var sstr []byte
+	var slen int
+	var v int64
+	listpack.Get(p, &sstr, &slen, &v)
+	if sstr == nil {
+		return strconv.AppendInt(nil, v, 10)
+	}
+	return sstr[:slen]
+}
+
+// lpGetEdgeStreamID 获取listpack中第一个或者最后一个元素的ID，包括已经删除的元素
+func lpGetEdgeStreamID(lp []byte, first bool, masterID, edgeID *streamID) {
+	var p []byte
+	if first {
+		p = listpack.First(lp)   // count
+		p = listpack.Next(lp, p) // deleted
+		p = listpack.Next(lp, p) // numfields
+		masterFieldsCount := lpGetInteger(p)
+		p = listpack.Next(lp, p) // 第一个field
+		for i := int64(0); i < masterFieldsCount; i++ {
+			p = listpack.Next(lp, p)
+		}
+		p = listpack.Next(lp, p) // 跳过master entry的结束标记，指向flags
+	} else {
+		p = listpack.Last(lp) // lp-count
+		lpCount := lpGetInteger(p)
+		for ; lpCount > 0; lpCount-- {
+			p = listpack.Prev(lp, p)
+		}
+	}
+	p = listpack.Next(lp, p) // ms-diff
+	edgeID.ms = masterID.ms + uint64(lpGetInteger(p))
+	p = listpack.Next(lp, p) // seq-diff
+	edgeID.seq = masterID.seq + uint64(lpGetInteger(p))
+}
+
+func argvBytes(o *robj) []byte {
+	return (*sds.SDS)(o.ptr).BufData(0)
+}
+
+// streamAppendItem 把argv中的numfields个field-value添加到stream中。
+// useID为nil时自动生成ID，seqGiven为false时只使用useID的ms部分。
+// ID不大于lastID时返回errStreamIDTooSmall，元素太大时返回errStreamTooLarge
+func streamAppendItem(s *stream, argv []*robj, numfields int64, addedID, useID *streamID, seqGiven bool) error {
+	var id streamID
+	if useID != nil {
+		if seqGiven {
+			id = *useID
+		} else {
+			// 只指定了ms，和最后一个元素在同一毫秒时seq加一，否则从0开始
+			if s.lastID.ms == useID.ms {
+				if s.lastID.seq == math.MaxUint64 {
+					return errStreamIDTooSmall
+				}
+				id = s.lastID
+				id.seq++
+			} else {
+				id = *useID
+			}
+		}
+	} else {
+		streamNextID(&s.lastID, &id)
+	}
+
+	if streamCompareID(&id, &s.lastID) <= 0 {
+		return errStreamIDTooSmall
+	}
+
+	totelelen := 0
+	for i := int64(0); i < numfields*2; i++ {
+		totelelen += len(argvBytes(argv[i]))
+	}
+	if totelelen > streamListpackMaxSize {
+		return errStreamTooLarge
+	}
+
+	// 找到最后一个节点，判断是否可以继续添加
+	var ri raxIterator
+	raxStart(&ri, s.rax)
+	raxSeek(&ri, "$", nil)
+	var lpp *[]byte
+	var lp []byte
+	var raxKey [16]byte
+	if raxNext(&ri) {
+		lpp = (*[]byte)(ri.data)
+		lp = *lpp
+		copy(raxKey[:], ri.key)
+	}
+	raxStop(&ri)
+
+	if lp != nil {
+		nodeMaxBytes := server.streamNodeMaxBytes
+		if nodeMaxBytes == 0 || nodeMaxBytes > streamListpackMaxSize {
+			nodeMaxBytes = streamListpackMaxSize
+		}
+		newNode := false
+		if listpack.Bytes(lp)+totelelen >= nodeMaxBytes {
+			newNode = true
+		} else if server.streamNodeMaxEntries > 0 {
+			p := listpack.First(lp)
+			count := lpGetInteger(p) + lpGetInteger(listpack.Next(lp, p))
+			if count >= int64(server.streamNodeMaxEntries) {
+				newNode = true
+			}
+		}
+		if newNode {
+			lp = nil
+		}
+	}
+
+	var masterID streamID
+	flags := int64(streamItemFlagNone)
+	if lp == nil {
+		masterID = id
+		streamEncodeID(raxKey[:], &id)
+		lp = listpack.New()
+		lp = listpack.AppendInteger(lp, 1) // count，也就是当前要添加的元素
+		lp = listpack.AppendInteger(lp, 0) // deleted
+		lp = listpack.AppendInteger(lp, numfields)
+		for i := int64(0); i < numfields; i++ {
+			lp = listpack.Push(lp, argvBytes(argv[i*2]), listpack.Tail)
+		}
+		lp = listpack.AppendInteger(lp, 0) // master entry的结束标记
+		lpp = new([]byte)
+		raxInsert(s.rax, raxKey[:], unsafe.Pointer(lpp))
+		flags |= streamItemFlagSameFields
+	} else {
+		streamDecodeID(raxKey[:], &masterID)
+		p := listpack.First(lp)
+		count := lpGetInteger(p)
+		lp = listpack.ReplaceInteger(lp, &p, count+1)
+		p = listpack.Next(lp, p) // deleted
+		p = listpack.Next(lp, p) // numfields
+		masterFieldsCount := lpGetInteger(p)
+		p = listpack.Next(lp, p)
+		if numfields == masterFieldsCount {
+			i := int64(0)
+			for ; i < masterFieldsCount; i++ {
+				if !bytes.Equal(lpGetString(p), argvBytes(argv[i*2])) {
+					break
+				}
+				p = listpack.Next(lp, p)
+			}
+			if i == masterFieldsCount {
+				flags |= streamItemFlagSameFields
+			}
+		}
+	}
+
+	lp = listpack.AppendInteger(lp, flags)
+	lp = listpack.AppendInteger(lp, int64(id.ms-masterID.ms))
+	lp = listpack.AppendInteger(lp, int64(id.seq-masterID.seq))
+	if flags&streamItemFlagSameFields == 0 {
+		lp = listpack.AppendInteger(lp, numfields)
+	}
+	for i := int64(0); i < numfields; i++ {
+		if flags&streamItemFlagSameFields == 0 {
+			lp = listpack.Push(lp, argvBytes(argv[i*2]), listpack.Tail)
+		}
+		lp = listpack.Push(lp, argvBytes(argv[i*2+1]), listpack.Tail)
+	}
+	lpCount := numfields + 3
+	if flags&streamItemFlagSameFields == 0 {
+		lpCount += numfields + 1
+	}
+	lp = listpack.AppendInteger(lp, lpCount)
+	*lpp = lp
+
+	s.length++
+	s.entriesAdded++
+	s.lastID = id
+	if s.length == 1 {
+		s.firstID = id
+	}
+	if addedID != nil {
+		*addedID = id
+	}
+	return C_OK
+}
+
+var (
+	errStreamIDTooSmall = errors.New("stream id too small")
+	errStreamTooLarge   = errors.New("stream elements too large")
+)
+
+// streamTrim 按照MAXLEN或者MINID裁剪stream，返回删除的元素个数。
+// 近似裁剪时只删除整个节点，精确裁剪时还会把节点中的元素标记为删除
+func streamTrim(s *stream, args *streamAddTrimArgs) int64 {
+	maxlen := args.maxlen
+	id := &args.minid
+	approx := args.approxTrim
+	limit := args.limit
+	strategy := args.trimStrategy
+
+	if strategy == trimStrategyNone {
+		return 0
+	}
+
+	var ri raxIterator
+	raxStart(&ri, s.rax)
+	raxSeek(&ri, "^", nil)
+
+	var deleted int64
+	for raxNext(&ri) {
+		if strategy == trimStrategyMaxLen && s.length <= uint64(maxlen) {
+			break
+		}
+
+		lpp := (*[]byte)(ri.data)
+		lp := *lpp
+		p := listpack.First(lp)
+		entries := lpGetInteger(p)
+
+		// 超过了允许删除的元素个数
+		if limit > 0 && deleted+entries > limit {
+			break
+		}
+
+		var removeNode bool
+		var masterID streamID
+		if strategy == trimStrategyMaxLen {
+			removeNode = s.length-uint64(entries) >= uint64(maxlen)
+		} else {
+			streamDecodeID(ri.key, &masterID)
+			var lastID streamID
+			lpGetEdgeStreamID(lp, false, &masterID, &lastID)
+			// 节点的最后一个ID都比minid小，可以删除整个节点
+			removeNode = streamCompareID(&lastID, id) < 0
+		}
+
+		if removeNode {
+			key := append([]byte(nil), ri.key...)
+			raxRemove(s.rax, key)
+			raxSeek(&ri, ">=", key)
+			s.length -= uint64(entries)
+			deleted += entries
+			continue
+		}
+
+		// 不能删除整个节点，近似裁剪到这里就结束了
+		if approx {
+			break
+		}
+
+		// 逐个把元素标记为删除
+		var deletedFromLp int64
+		p = listpack.Next(lp, p) // deleted
+		p = listpack.Next(lp, p) // numfields
+		masterFieldsCount := lpGetInteger(p)
+		p = listpack.Next(lp, p) // 第一个field
+		for j := int64(0); j < masterFieldsCount; j++ {
+			p = listpack.Next(lp, p)
+		}
+		p = listpack.Next(lp, p) // 跳过master entry的结束标记
+
+		for p != nil {
+			pcopy := p
+			flags := lpGetInteger(p)
+			p = listpack.Next(lp, p) // ms-diff
+			msDelta := lpGetInteger(p)
+			p = listpack.Next(lp, p) // seq-diff
+			seqDelta := lpGetInteger(p)
+			p = listpack.Next(lp, p)
+
+			var stop bool
+			if strategy == trimStrategyMaxLen {
+				stop = s.length <= uint64(maxlen)
+			} else {
+				currID := streamID{masterID.ms + uint64(msDelta), masterID.seq + uint64(seqDelta)}
+				// 后面的ID只会更大，不需要继续了
+				stop = streamCompareID(&currID, id) >= 0
+			}
+			if stop {
+				break
+			}
+
+			var toSkip int64
+			if flags&streamItemFlagSameFields != 0 {
+				toSkip = masterFieldsCount
+			} else {
+				toSkip = lpGetInteger(p) * 2
+				p = listpack.Next(lp, p)
+			}
+			for ; toSkip > 0; toSkip-- {
+				p = listpack.Next(lp, p)
+			}
+			p = listpack.Next(lp, p) // 跳过lp-count
+
+			if flags&streamItemFlagDeleted == 0 {
+				// 替换之后p之后的内容不变，记录到结尾的距离来恢复p
+				tail := len(p)
+				flags |= streamItemFlagDeleted
+				lp = listpack.ReplaceInteger(lp, &pcopy, flags)
+				deletedFromLp++
+				s.length--
+				if p != nil {
+					p = lp[len(lp)-tail:]
+				}
+			}
+		}
+		deleted += deletedFromLp
+
+		// 更新master entry中的计数
+		p = listpack.First(lp)
+		lp = listpack.ReplaceInteger(lp, &p, entries-deletedFromLp)
+		p = listpack.Next(lp, p)
+		markedDeleted := lpGetInteger(p)
+		lp = listpack.ReplaceInteger(lp, &p, markedDeleted+deletedFromLp)
+		*lpp = lp
+
+		// 当前节点还有剩余的元素，后面的节点不需要处理
+		break
+	}
+	raxStop(&ri)
+
+	if s.length == 0 {
+		s.firstID = streamID{}
+	} else {
+		streamGetEdgeID(s, true, true, &s.firstID)
+	}
+	return deleted
+}
+
+/*-----------------------------------------------------------------------------
+ * Stream迭代器
+ *----------------------------------------------------------------------------*/
+
+// streamIteratorStart 初始化迭代器，start和end为nil时表示最小和最大的ID，rev为true时反向遍历
+func streamIteratorStart(si *streamIterator, s *stream, start, end *streamID, rev bool) {
+	if start != nil {
+		streamEncodeID(si.startKey[:], start)
+	} else {
+		si.startKey = [16]byte{}
+	}
+	if end != nil {
+		streamEncodeID(si.endKey[:], end)
+	} else {
+		streamEncodeID(si.endKey[:], &streamID{math.MaxUint64, math.MaxUint64})
+	}
+
+	// 找到可能包含start(或者end)的节点
+	raxStart(&si.ri, s.rax)
+	if !rev {
+		if start != nil && (start.ms != 0 || start.seq != 0) {
+			raxSeek(&si.ri, "<=", si.startKey[:])
+			if raxEOF(&si.ri) {
+				raxSeek(&si.ri, "^", nil)
+			}
+		} else {
+			raxSeek(&si.ri, "^", nil)
+		}
+	} else {
+		if end != nil && (end.ms != 0 || end.seq != 0) {
+			raxSeek(&si.ri, "<=", si.endKey[:])
+			if raxEOF(&si.ri) {
+				raxSeek(&si.ri, "$", nil)
+			}
+		} else {
+			raxSeek(&si.ri, "$", nil)
+		}
+	}
+	si.stream = s
+	si.lp = nil
+	si.lpEle = nil
+	si.rev = rev
+	si.skipTombstones = true
+}
+
+// streamIteratorGetID 返回下一个元素的ID和field的个数，没有更多元素时返回false。
+// 返回true之后需要调用numfields次streamIteratorGetField
+func streamIteratorGetID(si *streamIterator, id *streamID, numfields *int64) bool {
+	for {
+		if si.lp == nil || si.lpEle == nil {
+			// 移动到下一个节点
+			if !si.rev && !raxNext(&si.ri) {
+				return false
+			} else if si.rev && !raxPrev(&si.ri) {
+				return false
+			}
+			streamDecodeID(si.ri.key, &si.masterID)
+			si.lpp = (*[]byte)(si.ri.data)
+			si.lp = *si.lpp
+			si.lpEle = listpack.First(si.lp)          // count
+			si.lpEle = listpack.Next(si.lp, si.lpEle) // deleted
+			si.lpEle = listpack.Next(si.lp, si.lpEle) // numfields
+			si.masterFieldsCount = lpGetInteger(si.lpEle)
+			si.lpEle = listpack.Next(si.lp, si.lpEle)
+			si.masterFieldsStart = si.lpEle
+			for i := int64(0); i < si.masterFieldsCount; i++ {
+				si.lpEle = listpack.Next(si.lp, si.lpEle)
+			}
+			// 现在指向master entry的结束标记，反向遍历时需要移动到结尾
+			if si.rev {
+				si.lpEle = listpack.Last(si.lp)
+			}
+		} else if si.rev {
+			// 反向遍历时上一次返回的元素还没有跳过，回到它的lp-count之前
+			lpCount := lpGetInteger(si.lpEle)
+			for ; lpCount > 0; lpCount-- {
+				si.lpEle = listpack.Prev(si.lp, si.lpEle)
+			}
+			si.lpEle = listpack.Prev(si.lp, si.lpEle)
+		}
+
+		for {
+			if !si.rev {
+				// 跳过上一个元素的lp-count或者master entry的结束标记
+				si.lpEle = listpack.Next(si.lp, si.lpEle)
+				if si.lpEle == nil {
+					break
+				}
+			} else {
+				// 根据lp-count移动到元素的开头
+				lpCount := lpGetInteger(si.lpEle)
+				if lpCount == 0 { // 到了master entry
+					si.lp = nil
+					si.lpEle = nil
+					break
+				}
+				for ; lpCount > 0; lpCount-- {
+					si.lpEle = listpack.Prev(si.lp, si.lpEle)
+				}
+			}
+
+			si.lpFlags = si.lpEle
+			flags := lpGetInteger(si.lpEle)
+			si.lpEle = listpack.Next(si.lp, si.lpEle)
+
+			*id = si.masterID
+			id.ms += uint64(lpGetInteger(si.lpEle))
+			si.lpEle = listpack.Next(si.lp, si.lpEle)
+			id.seq += uint64(lpGetInteger(si.lpEle))
+			si.lpEle = listpack.Next(si.lp, si.lpEle)
+			var buf [16]byte
+			streamEncodeID(buf[:], id)
+
+			if flags&streamItemFlagSameFields != 0 {
+				*numfields = si.masterFieldsCount
+			} else {
+				*numfields = lpGetInteger(si.lpEle)
+				si.lpEle = listpack.Next(si.lp, si.lpEle)
+			}
+
+			if !si.rev {
+				if bytes.Compare(buf[:], si.startKey[:]) >= 0 &&
+					(!si.skipTombstones || flags&streamItemFlagDeleted == 0) {
+					if bytes.Compare(buf[:], si.endKey[:]) > 0 {
+						return false // 已经超出范围
+					}
+					si.entryFlags = flags
+					if flags&streamItemFlagSameFields != 0 {
+						si.masterFieldsPtr = si.masterFieldsStart
+					}
+					return true
+				}
+			} else {
+				if bytes.Compare(buf[:], si.endKey[:]) <= 0 &&
+					(!si.skipTombstones || flags&streamItemFlagDeleted == 0) {
+					if bytes.Compare(buf[:], si.startKey[:]) < 0 {
+						return false // 已经超出范围
+					}
+					si.entryFlags = flags
+					if flags&streamItemFlagSameFields != 0 {
+						si.masterFieldsPtr = si.masterFieldsStart
+					}
+					return true
+				}
+			}
+
+			// 不需要返回这个元素，正向遍历时跳过它，反向遍历时移动到前一个元素的lp-count
+			if !si.rev {
+				toDiscard := *numfields * 2
+				if flags&streamItemFlagSameFields != 0 {
+					toDiscard = *numfields
+				}
+				for i := int64(0); i < toDiscard; i++ {
+					si.lpEle = listpack.Next(si.lp, si.lpEle)
+				}
+			} else {
+				prevTimes := 4 // flags、ms-diff、seq-diff以及前一个元素的lp-count
+				if flags&streamItemFlagSameFields == 0 {
+					prevTimes++
+				}
+				for ; prevTimes > 0; prevTimes-- {
+					si.lpEle = listpack.Prev(si.lp, si.lpEle)
+				}
+			}
+		}
+		// 当前listpack遍历完了，继续下一个节点
+	}
+}
+
+// streamIteratorGetField 返回当前元素的下一对field-value
+func streamIteratorGetField(si *streamIterator) (field, value []byte) {
+	if si.entryFlags&streamItemFlagSameFields != 0 {
+		field = lpGetString(si.masterFieldsPtr)
+		si.masterFieldsPtr = listpack.Next(si.lp, si.masterFieldsPtr)
+	} else {
+		field = lpGetString(si.lpEle)
+		si.lpEle = listpack.Next(si.lp, si.lpEle)
+	}
+	value = lpGetString(si.lpEle)
+	si.lpEle = listpack.Next(si.lp, si.lpEle)
+	return
+}
+
+// streamIteratorRemoveEntry 删除迭代器当前指向的元素，current是这个元素的ID。
+// 删除之后迭代器会重新定位，可以继续遍历
+func streamIteratorRemoveEntry(si *streamIterator, current *streamID) {
+	lp := si.lp
+	flags := lpGetInteger(si.lpFlags)
+	flags |= streamItemFlagDeleted
+	lp = listpack.ReplaceInteger(lp, &si.lpFlags, flags)
+
+	p := listpack.First(lp)
+	aux := lpGetInteger(p)
+	if aux == 1 {
+		// 节点中最后一个元素，直接删除整个节点
+		raxRemove(si.stream.rax, si.ri.key)
+	} else {
+		lp = listpack.ReplaceInteger(lp, &p, aux-1)
+		p = listpack.Next(lp, p) // deleted
+		aux = lpGetInteger(p)
+		lp = listpack.ReplaceInteger(lp, &p, aux+1)
+		*si.lpp = lp
+	}
+	si.stream.length--
+
+	// 迭代器的状态已经失效，重新开始
+	var start, end streamID
+	if si.rev {
+		streamDecodeID(si.startKey[:], &start)
+		end = *current
+	} else {
+		start = *current
+		streamDecodeID(si.endKey[:], &end)
+	}
+	skipTombstones := si.skipTombstones
+	streamIteratorStop(si)
+	streamIteratorStart(si, si.stream, &start, &end, si.rev)
+	si.skipTombstones = skipTombstones
+}
+
+func streamIteratorStop(si *streamIterator) {
+	raxStop(&si.ri)
+}
+
+// streamGetEdgeID 获取第一个或者最后一个元素的ID，stream为空时返回最大或者最小的ID
+func streamGetEdgeID(s *stream, first, skipTombstones bool, edgeID *streamID) {
+	var si streamIterator
+	var numfields int64
+	streamIteratorStart(&si, s, nil, nil, !first)
+	si.skipTombstones = skipTombstones
+	if !streamIteratorGetID(&si, edgeID, &numfields) {
+		if first {
+			*edgeID = streamID{math.MaxUint64, math.MaxUint64}
+		} else {
+			*edgeID = streamID{}
+		}
+	}
+	streamIteratorStop(&si)
+}
+
+// streamDeleteItem 删除指定ID的元素，元素不存在时返回false
+func streamDeleteItem(s *stream, id *streamID) bool {
+	deleted := false
+	var si streamIterator
+	streamIteratorStart(&si, s, id, id, false)
+	var myid streamID
+	var numfields int64
+	if streamIteratorGetID(&si, &myid, &numfields) {
+		streamIteratorRemoveEntry(&si, &myid)
+		deleted = true
+	}
+	streamIteratorStop(&si)
+	return deleted
+}
+
+// streamEntryExists 判断ID为id的元素是否存在
+func streamEntryExists(s *stream, id *streamID) bool {
+	var si streamIterator
+	streamIteratorStart(&si, s, id, id, false)
+	var myid streamID
+	var numfields int64
+	found := streamIteratorGetID(&si, &myid, &numfields)
+	streamIteratorStop(&si)
+	return found
+}
+
+// streamLastValidID 获取最后一个没有被删除的元素的ID
+func streamLastValidID(s *stream, maxid *streamID) {
+	var si streamIterator
+	var numfields int64
+	streamIteratorStart(&si, s, nil, nil, true)
+	if !streamIteratorGetID(&si, maxid, &numfields) && s.length > 0 {
+		panic(fmt.Sprintf("Corrupt stream, length is %d, but no max id", s.length))
+	}
+	streamIteratorStop(&si)
+}
+
+// streamRangeHasTombstones 判断[start, end]范围内是否有被删除的元素，nil表示最小和最大的ID
+func streamRangeHasTombstones(s *stream, start, end *streamID) bool {
+	if s.length == 0 || (s.maxDeletedEntryID.ms == 0 && s.maxDeletedEntryID.seq == 0) {
+		// 空stream或者没有删除过元素
+		return false
+	}
+	if streamCompareID(&s.firstID, &s.maxDeletedEntryID) > 0 {
+		// 删除的元素都在第一个元素之前
+		return false
+	}
+
+	startID, endID := streamID{}, streamID{math.MaxUint64, math.MaxUint64}
+	if start != nil {
+		startID = *start
+	}
+	if end != nil {
+		endID = *end
+	}
+	return streamCompareID(&startID, &s.maxDeletedEntryID) <= 0 &&
+		streamCompareID(&s.maxDeletedEntryID, &endID) <= 0
+}
+
+// streamEstimateDistanceFromFirstEverEntry 估算id是stream中添加的第几个元素，无法确定时返回scgInvalidEntriesRead
+func streamEstimateDistanceFromFirstEverEntry(s *stream, id *streamID) int64 {
+	// 从来没有添加过元素
+	if s.entriesAdded == 0 {
+		return 0
+	}
+
+	// 空stream，id不大于lastID时就是添加过的元素个数
+	if s.length == 0 && streamCompareID(id, &s.lastID) < 1 {
+		return int64(s.entriesAdded)
+	}
+
+	cmpLast := streamCompareID(id, &s.lastID)
+	if cmpLast == 0 {
+		return int64(s.entriesAdded)
+	} else if cmpLast > 0 {
+		// 还没有添加的ID
+		return scgInvalidEntriesRead
+	}
+
+	cmpIDFirst := streamCompareID(id, &s.firstID)
+	cmpXdelFirst := streamCompareID(&s.maxDeletedEntryID, &s.firstID)
+	if (s.maxDeletedEntryID.ms == 0 && s.maxDeletedEntryID.seq == 0) || cmpXdelFirst < 0 {
+		// 第一个元素之后没有删除过元素
+		if cmpIDFirst < 0 {
+			return int64(s.entriesAdded - s.length)
+		} else if cmpIDFirst == 0 {
+			return int64(s.entriesAdded - s.length + 1)
+		}
+	}
+
+	// id在被删除的元素之后，或者是一个不存在的ID，无法计算
+	return scgInvalidEntriesRead
+}
+
+// streamDup 复制一个stream对象，包括所有的消费组、consumer和PEL
+func streamDup(o *robj) *robj {
+	if o.getEncoding() != ObjEncodingStream {
+		panic("Unknown stream encoding")
+	}
+	sobj := createStreamObject()
+	s := (*stream)(o.ptr)
+	newS := (*stream)(sobj.ptr)
+	newS.length = s.length
+	newS.firstID = s.firstID
+	newS.lastID = s.lastID
+	newS.maxDeletedEntryID = s.maxDeletedEntryID
+	newS.entriesAdded = s.entriesAdded
+
+	var ri raxIterator
+	raxStart(&ri, s.rax)
+	raxSeek(&ri, "^", nil)
+	for raxNext(&ri) {
+		lp := append([]byte(nil), *(*[]byte)(ri.data)...)
+		raxInsert(newS.rax, ri.key, unsafe.Pointer(&lp))
+	}
+	raxStop(&ri)
+
+	if s.cgroups == nil {
+		return sobj
+	}
+
+	// 消费组
+	var riCG raxIterator
+	raxStart(&riCG, s.cgroups)
+	raxSeek(&riCG, "^", nil)
+	for raxNext(&riCG) {
+		cg := (*streamCG)(riCG.data)
+		newCG := streamCreateCG(newS, riCG.key, &cg.lastID, cg.entriesRead)
+
+		// 消费组的PEL
+		var riPEL raxIterator
+		raxStart(&riPEL, cg.pel)
+		raxSeek(&riPEL, "^", nil)
+		for raxNext(&riPEL) {
+			nack := (*streamNACK)(riPEL.data)
+			newNack := streamCreateNACK(nil)
+			newNack.deliveryTime = nack.deliveryTime
+			newNack.deliveryCount = nack.deliveryCount
+			raxInsert(newCG.pel, riPEL.key, unsafe.Pointer(newNack))
+		}
+		raxStop(&riPEL)
+
+		// consumer，和消费组共享PEL中的streamNACK
+		var riConsumers raxIterator
+		raxStart(&riConsumers, cg.consumers)
+		raxSeek(&riConsumers, "^", nil)
+		for raxNext(&riConsumers) {
+			consumer := (*streamConsumer)(riConsumers.data)
+			newConsumer := &streamConsumer{
+				seenTime: consumer.seenTime,
+				name:     sds.Dup(consumer.name),
+				pel:      raxNew(),
+			}
+			raxInsert(newCG.consumers, riConsumers.key, unsafe.Pointer(newConsumer))
+
+			var riCPEL raxIterator
+			raxStart(&riCPEL, consumer.pel)
+			raxSeek(&riCPEL, "^", nil)
+			for raxNext(&riCPEL) {
+				p, _ := raxFind(newCG.pel, riCPEL.key)
+				newNack := (*streamNACK)(p)
+				newNack.consumer = newConsumer
+				raxInsert(newConsumer.pel, riCPEL.key, p)
+			}
+			raxStop(&riCPEL)
+		}
+		raxStop(&riConsumers)
+	}
+	raxStop(&riCG)
+	return sobj
+}
+
+/*-----------------------------------------------------------------------------
+ * 消费组的底层实现
+ *----------------------------------------------------------------------------*/
+
+// streamCreateNACK 创建一个投递给consumer的NACK，投递次数为1
+func streamCreateNACK(consumer *streamConsumer) *streamNACK {
+	return &streamNACK{
+		deliveryTime:  mstime(),
+		deliveryCount: 1,
+		consumer:      consumer,
+	}
+}
+
+// streamCreateCG 创建消费组，name已经存在时返回nil
+func streamCreateCG(s *stream, name []byte, id *streamID, entriesRead int64) *streamCG {
+	if s.cgroups == nil {
+		s.cgroups = raxNew()
+	}
+	if _, ok := raxFind(s.cgroups, name); ok {
+		return nil
+	}
+
+	cg := &streamCG{
+		lastID:      *id,
+		entriesRead: entriesRead,
+		pel:         raxNew(),
+		consumers:   raxNew(),
+	}
+	raxInsert(s.cgroups, name, unsafe.Pointer(cg))
+	return cg
+}
+
+// streamLookupCG 查找消费组，不存在时返回nil
+func streamLookupCG(s *stream, groupname sds.SDS) *streamCG {
+	if s.cgroups == nil {
+		return nil
+	}
+	cg, ok := raxFind(s.cgroups, groupname.BufData(0))
+	if !ok {
+		return nil
+	}
+	return (*streamCG)(cg)
+}
+
+// streamCreateConsumer 在消费组中创建consumer，已经存在时返回nil
+func streamCreateConsumer(cg *streamCG, name sds.SDS, key *robj, dbid int) *streamConsumer {
+	if cg == nil {
+		return nil
+	}
+	consumer := &streamConsumer{
+		name:     sds.Dup(name),
+		pel:      raxNew(),
+		seenTime: mstime(),
+	}
+	if ok, _ := raxTryInsert(cg.consumers, name.BufData(0), unsafe.Pointer(consumer)); !ok {
+		return nil
+	}
+	server.dirty++
+	notifyKeySpaceEvent(notifyStream, "xgroup-createconsumer", key, dbid)
+	return consumer
+}
+
+// streamLookupConsumer 查找consumer，不存在时返回nil。refresh为true时更新consumer的活动时间
+func streamLookupConsumer(cg *streamCG, name sds.SDS, refresh bool) *streamConsumer {
+	if cg == nil {
+		return nil
+	}
+	p, ok := raxFind(cg.consumers, name.BufData(0))
+	if !ok {
+		return nil
+	}
+	consumer := (*streamConsumer)(p)
+	if refresh {
+		consumer.seenTime = mstime()
+	}
+	return consumer
+}
+
+// streamDelConsumer 删除consumer，它的PEL中的元素也会从消费组的PEL中删除
+func streamDelConsumer(cg *streamCG, consumer *streamConsumer) {
+	var ri raxIterator
+	raxStart(&ri, consumer.pel)
+	raxSeek(&ri, "^", nil)
+	for raxNext(&ri) {
+		raxRemove(cg.pel, ri.key)
+	}
+	raxStop(&ri)
+	raxRemove(cg.consumers, consumer.name.BufData(0))
+}
+
+/*-----------------------------------------------------------------------------
+ * Stream命令的公共函数
+ *----------------------------------------------------------------------------*/
+
+func createObjectFromStreamID(id *streamID) *robj {
+	return createStringObject(fmt.Sprintf("%d-%d", id.ms, id.seq))
+}
+
+func addReplyStreamID(c *Client, id *streamID) {
+	addReplyBulkCString(c, fmt.Sprintf("%d-%d", id.ms, id.seq))
+}
+
+// streamReplyWithRange 返回[start, end]范围内最多count个元素，count为0表示不限制，返回元素个数。
+// group不为nil时是XREADGROUP，会更新消费组的lastID，没有设置NOACK时还会把元素加入消费组和consumer的PEL。
+// flags设置了streamRwrHistory时只返回consumer的PEL中的元素；设置了streamRwrRawEntries时不回复数组的长度
+func streamReplyWithRange(c *Client, s *stream, start, end *streamID, count int64, rev bool, group *streamCG, consumer *streamConsumer, flags int) int64 {
+	var arraylen int64
+	var si streamIterator
+	var numfields int64
+	var id streamID
+	noack := flags&streamRwrNoAck != 0
+
+	// 读取历史消息时只从consumer自己的PEL中返回，每个consumer只能看到投递给它的并且还没有确认的消息
+	if group != nil && flags&streamRwrHistory != 0 {
+		return streamReplyWithRangeFromConsumerPEL(c, s, start, end, count, consumer)
+	}
+
+	var arraylenPtr *adlist.ListNode
+	if flags&streamRwrRawEntries == 0 {
+		arraylenPtr = addReplyDeferredLen(c)
+	}
+	streamIteratorStart(&si, s, start, end, rev)
+	for streamIteratorGetID(&si, &id, &numfields) {
+		// 更新消费组的lastID
+		if group != nil && streamCompareID(&id, &group.lastID) > 0 {
+			if group.entriesRead != scgInvalidEntriesRead && !streamRangeHasTombstones(s, &id, nil) {
+				// 后面没有被删除的元素，计数仍然是准确的
+				group.entriesRead++
+			} else if s.entriesAdded > 0 {
+				group.entriesRead = streamEstimateDistanceFromFirstEverEntry(s, &id)
+			}
+			group.lastID = id
+		}
+
+		addReplyArrayLen(c, 2)
+		addReplyStreamID(c, &id)
+		addReplyArrayLen(c, int(numfields*2))
+		for ; numfields > 0; numfields-- {
+			field, value := streamIteratorGetField(&si)
+			addReplyBulkBuffer(c, field, len(field))
+			addReplyBulkBuffer(c, value, len(value))
+		}
+
+		// 把元素加入消费组和consumer的PEL。XGROUP SETID可以修改消费组的lastID，
+		// 所以元素可能已经在其它consumer的PEL中了，这时把它转移给当前的consumer
+		if group != nil && !noack {
+			var buf [16]byte
+			streamEncodeID(buf[:], &id)
+
+			nack := streamCreateNACK(consumer)
+			groupInserted, _ := raxTryInsert(group.pel, buf[:], unsafe.Pointer(nack))
+			consumerInserted, _ := raxTryInsert(consumer.pel, buf[:], unsafe.Pointer(nack))
+
+			if !groupInserted {
+				p, _ := raxFind(group.pel, buf[:])
+				nack = (*streamNACK)(p)
+				raxRemove(nack.consumer.pel, buf[:])
+				nack.consumer = consumer
+				nack.deliveryTime = mstime()
+				nack.deliveryCount = 1
+				raxInsert(consumer.pel, buf[:], unsafe.Pointer(nack))
+			} else if !consumerInserted {
+				panic("NACK half-created. Should not be possible.")
+			}
+		}
+
+		arraylen++
+		if count != 0 && count == arraylen {
+			break
+		}
+	}
+	streamIteratorStop(&si)
+	if arraylenPtr != nil {
+		setDeferredArrayLen(c, arraylenPtr, int(arraylen))
+	}
+	return arraylen
+}
+
+// streamReplyWithRangeFromConsumerPEL 返回consumer的PEL中从start开始的最多count个元素，
+// 并且更新它们的投递时间和次数。PEL中的元素可能已经被删除了，这时只回复ID，内容为null
+func streamReplyWithRangeFromConsumerPEL(c *Client, s *stream, start, end *streamID, count int64, consumer *streamConsumer) int64 {
+	var startkey, endkey [16]byte
+	streamEncodeID(startkey[:], start)
+	if end != nil {
+		streamEncodeID(endkey[:], end)
+	}
+
+	var arraylen int64
+	arraylenPtr := addReplyDeferredLen(c)
+	var ri raxIterator
+	raxStart(&ri, consumer.pel)
+	raxSeek(&ri, ">=", startkey[:])
+	for raxNext(&ri) && (count == 0 || arraylen < count) {
+		if end != nil && bytes.Compare(ri.key, endkey[:]) > 0 {
+			break
+		}
+		var thisid streamID
+		streamDecodeID(ri.key, &thisid)
+		if streamReplyWithRange(c, s, &thisid, &thisid, 1, false, nil, nil, streamRwrRawEntries) == 0 {
+			addReplyArrayLen(c, 2)
+			addReplyStreamID(c, &thisid)
+			addReply(c, shared.nullArray[c.resp])
+		} else {
+			nack := (*streamNACK)(ri.data)
+			nack.deliveryTime = mstime()
+			nack.deliveryCount++
+		}
+		arraylen++
+	}
+	raxStop(&ri)
+	setDeferredArrayLen(c, arraylenPtr, int(arraylen))
+	return arraylen
+}
+
+// streamTypeLookupWriteOrCreate 查找stream，不存在时创建，noCreate为true时返回null
+func streamTypeLookupWriteOrCreate(c *Client, key *robj, noCreate bool) *robj {
+	o := c.db.lookupKeyWrite(key)
+	if o != nil && o.checkType(c, ObjStream) {
+		return nil
+	}
+	if o == nil {
+		if noCreate {
+			addReplyNull(c)
+			return nil
+		}
+		o = createStreamObject()
+		c.db.dbAdd(key, o)
+	}
+	return o
+}
+
+// streamGenericParseIDOrReply 解析<ms>-<seq>格式的ID，没有seq时使用missingSeq。
+// strict为false时可以使用"-"和"+"表示最小和最大的ID；
+// seqGiven不为nil时允许<ms>-*的形式，此时seqGiven设置为false
+func streamGenericParseIDOrReply(c *Client, buf []byte, id *streamID, missingSeq uint64, strict bool, seqGiven *bool) error {
+	if len(buf) > 127 {
+		goto invalid
+	}
+	if strict && len(buf) == 1 && (buf[0] == '-' || buf[0] == '+') {
+		goto invalid
+	}
+
+	if seqGiven != nil {
+		*seqGiven = true
+	}
+
+	if len(buf) == 1 && buf[0] == '-' {
+		id.ms, id.seq = 0, 0
+		return C_OK
+	} else if len(buf) == 1 && buf[0] == '+' {
+		id.ms, id.seq = math.MaxUint64, math.MaxUint64
+		return C_OK
+	}
+
+	{
+		var ms, seq uint64
+		var err error
+		mspart, seqpart, hasSeq := bytes.Cut(buf, []byte("-"))
+		if ms, err = strconv.ParseUint(util.Bytes2String(mspart), 10, 64); err != nil {
+			goto invalid
+		}
+		if hasSeq {
+			if seqGiven != nil && len(seqpart) == 1 && seqpart[0] == '*' {
+				seq = 0
+				*seqGiven = false
+			} else if seq, err = strconv.ParseUint(util.Bytes2String(seqpart), 10, 64); err != nil {
+				goto invalid
+			}
+		} else {
+			seq = missingSeq
+		}
+		id.ms, id.seq = ms, seq
+		return C_OK
+	}
+
+invalid:
+	if c != nil {
+		addReplyError(c, "Invalid stream ID specified as stream command argument")
+	}
+	return C_ERR
+}
+
+func streamParseIDOrReply(c *Client, o *robj, id *streamID, missingSeq uint64, seqGiven *bool) error {
+	return streamGenericParseIDOrReply(c, argvBytes(o), id, missingSeq, false, seqGiven)
+}
+
+// streamParseStrictIDOrReply 和streamParseIDOrReply一样，但是不接受"-"和"+"
+func streamParseStrictIDOrReply(c *Client, o *robj, id *streamID, missingSeq uint64, seqGiven *bool) error {
+	return streamGenericParseIDOrReply(c, argvBytes(o), id, missingSeq, true, seqGiven)
+}
+
+// streamParseIntervalIDOrReply 解析范围查询的ID，以"("开头时表示不包含这个ID
+func streamParseIntervalIDOrReply(c *Client, o *robj, id *streamID, exclude *bool, missingSeq uint64) error {
+	p := argvBytes(o)
+	if exclude != nil {
+		*exclude = len(p) > 1 && p[0] == '('
+	}
+	if exclude != nil && *exclude {
+		return streamGenericParseIDOrReply(c, p[1:], id, missingSeq, true, nil)
+	}
+	return streamGenericParseIDOrReply(c, p, id, missingSeq, false, nil)
+}
+
+// streamRewriteApproxSpecifier 把"~"重写成"="，保证AOF和从库的裁剪结果一致
+func streamRewriteApproxSpecifier(c *Client, idx int) {
+	rewriteClientCommandArgument(c, idx, createStringObject("="))
+}
+
+// streamRewriteTrimArgument 把近似裁剪的参数重写成实际裁剪之后的结果
+func streamRewriteTrimArgument(c *Client, s *stream, trimStrategy, idx int) {
+	var arg *robj
+	if trimStrategy == trimStrategyMaxLen {
+		arg = createStringObjectFromLongLongWithOptions(int64(s.length), 0)
+	} else {
+		var firstID streamID
+		streamGetEdgeID(s, true, false, &firstID)
+		arg = createObjectFromStreamID(&firstID)
+	}
+	rewriteClientCommandArgument(c, idx, arg)
+	arg.decrRefCount()
+}
+
+// streamParseAddOrTrimArgsOrReply 解析XADD和XTRIM的参数，
+// 返回XADD的ID参数的下标(XTRIM为参数的个数)，出错时返回-1
+func streamParseAddOrTrimArgsOrReply(c *Client, args *streamAddTrimArgs, xadd bool) int {
+	*args = streamAddTrimArgs{maxlen: -1, limit: -1, trimStrategy: trimStrategyNone}
+	limitGiven := false
+
+	i := 2
+	for ; i < c.argc; i++ {
+		moreargs := c.argc - 1 - i
+		opt := argvBytes(c.argv[i])
+		if xadd && len(opt) == 1 && opt[0] == '*' {
+			// 自动生成ID
+			break
+		} else if util.StrCaseCmp(opt, "maxlen") && moreargs > 0 {
+			if args.trimStrategy != trimStrategyNone {
+				addReplyError(c, "syntax error, MAXLEN and MINID options at the same time are not compatible")
+				return -1
+			}
+			args.approxTrim = false
+			next := argvBytes(c.argv[i+1])
+			if moreargs >= 2 && len(next) == 1 && next[0] == '~' {
+				args.approxTrim = true
+				i++
+			} else if moreargs >= 2 && len(next) == 1 && next[0] == '=' {
+				i++
+			}
+			if c.argv[i+1].getLongLongFromObjectOrReply(c, &args.maxlen, "") != C_OK {
+				return -1
+			}
+			if args.maxlen < 0 {
+				addReplyError(c, "The MAXLEN argument must be >= 0.")
+				return -1
+			}
+			i++
+			args.trimStrategy = trimStrategyMaxLen
+			args.trimStrategyArgIdx = i
+		} else if util.StrCaseCmp(opt, "minid") && moreargs > 0 {
+			if args.trimStrategy != trimStrategyNone {
+				addReplyError(c, "syntax error, MAXLEN and MINID options at the same time are not compatible")
+				return -1
+			}
+			args.approxTrim = false
+			next := argvBytes(c.argv[i+1])
+			if moreargs >= 2 && len(next) == 1 && next[0] == '~' {
+				args.approxTrim = true
+				i++
+			} else if moreargs >= 2 && len(next) == 1 && next[0] == '=' {
+				i++
+			}
+			if streamParseStrictIDOrReply(c, c.argv[i+1], &args.minid, 0, nil) != C_OK {
+				return -1
+			}
+			i++
+			args.trimStrategy = trimStrategyMinID
+			args.trimStrategyArgIdx = i
+		} else if util.StrCaseCmp(opt, "limit") && moreargs > 0 {
+			// 没有指定LIMIT时近似裁剪最多删除100*streamNodeMaxEntries个元素，精确裁剪不限制
+			if c.argv[i+1].getLongLongFromObjectOrReply(c, &args.limit, "") != C_OK {
+				return -1
+			}
+			if args.limit < 0 {
+				addReplyError(c, "The LIMIT argument must be >= 0.")
+				return -1
+			}
+			limitGiven = true
+			i++
+		} else if xadd && util.StrCaseCmp(opt, "nomkstream") {
+			args.noMkStream = true
+		} else if xadd {
+			// 只可能是ID或者语法错误
+			if streamParseStrictIDOrReply(c, c.argv[i], &args.id, 0, &args.seqGiven) != C_OK {
+				return -1
+			}
+			args.idGiven = true
+			break
+		} else {
+			addReplyErrorObject(c, shared.syntaxErr)
+			return -1
+		}
+	}
+
+	if limitGiven && args.trimStrategy == trimStrategyNone {
+		addReplyError(c, "syntax error, LIMIT cannot be used without specifying a trimming strategy")
+		return -1
+	}
+
+	if !xadd && args.trimStrategy == trimStrategyNone {
+		addReplyError(c, "syntax error, XTRIM must be called with a trimming strategy")
+		return -1
+	}
+
+	if c.flags&CLIENT_MASTER > 0 {
+		// 主库发过来的命令已经重写过裁剪参数，不能再限制
+		args.limit = 0
+	} else if limitGiven {
+		if !args.approxTrim {
+			addReplyError(c, "syntax error, LIMIT cannot be used without the special ~ option")
+			return -1
+		}
+	} else if args.approxTrim {
+		args.limit = 100 * int64(server.streamNodeMaxEntries)
+		if args.limit <= 0 || args.limit > streamDefaultLimit {
+			args.limit = streamDefaultLimit
+		}
+	} else {
+		args.limit = 0
+	}
+	return i
+}
+
+/*-----------------------------------------------------------------------------
+ * Stream命令实现
+ *----------------------------------------------------------------------------*/
+
+// XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|ID field value [field value ...]
+func xaddCommand(c *Client) {
+	var args streamAddTrimArgs
+	idpos := streamParseAddOrTrimArgsOrReply(c, &args, true)
+	if idpos < 0 {
+		return
+	}
+	fieldPos := idpos + 1
+
+	if c.argc-fieldPos < 2 || (c.argc-fieldPos)%2 == 1 {
+		addReplyErrorFormat(c, "wrong number of arguments for '%s' command", c.cmd.name)
+		return
+	}
+
+	// 0-0不可能添加成功，提前返回避免创建一个空的stream
+	if args.idGiven && args.seqGiven && args.id.ms == 0 && args.id.seq == 0 {
+		addReplyError(c, "The ID specified in XADD must be greater than 0-0")
+		return
+	}
+
+	o := streamTypeLookupWriteOrCreate(c, c.argv[1], args.noMkStream)
+	if o == nil {
+		return
+	}
+	s := (*stream)(o.ptr)
+
+	if s.lastID.ms == math.MaxUint64 && s.lastID.seq == math.MaxUint64 {
+		addReplyError(c, "The stream has exhausted the last possible ID, unable to add more items")
+		return
+	}
+
+	var id streamID
+	var useID *streamID
+	if args.idGiven {
+		useID = &args.id
+	}
+	if err := streamAppendItem(s, c.argv[fieldPos:c.argc], int64(c.argc-fieldPos)/2, &id, useID, args.seqGiven); err != C_OK {
+		if err == errStreamIDTooSmall {
+			addReplyError(c, "The ID specified in XADD is equal or smaller than the target stream top item")
+		} else {
+			addReplyError(c, "Elements are too large to be stored")
+		}
+		return
+	}
+	addReplyStreamID(c, &id)
+
+	signalModifiedKey(c, c.db, c.argv[1])
+	notifyKeySpaceEvent(notifyStream, "xadd", c.argv[1], c.db.id)
+	server.dirty++
+
+	if args.trimStrategy != trimStrategyNone {
+		if streamTrim(s, &args) > 0 {
+			notifyKeySpaceEvent(notifyStream, "xtrim", c.argv[1], c.db.id)
+		}
+		if args.approxTrim {
+			// 近似裁剪的结果取决于节点的大小，重写成精确的参数传播给AOF和从库
+			streamRewriteApproxSpecifier(c, args.trimStrategyArgIdx-1)
+			streamRewriteTrimArgument(c, s, args.trimStrategy, args.trimStrategyArgIdx)
+		}
+	}
+
+	// 把ID参数重写成实际生成的ID
+	if !args.idGiven || !args.seqGiven {
+		idarg := createObjectFromStreamID(&id)
+		rewriteClientCommandArgument(c, idpos, idarg)
+		idarg.decrRefCount()
+	}
+
+	// 唤醒阻塞在这个stream上的客户端
+	signalKeyAsReady(c.db, c.argv[1])
+}
+
+// XRANGE key start end [COUNT count]
+func xrangeCommand(c *Client) {
+	xrangeGenericCommand(c, false)
+}
+
+// XREVRANGE key end start [COUNT count]
+func xrevrangeCommand(c *Client) {
+	xrangeGenericCommand(c, true)
+}
+
+func xrangeGenericCommand(c *Client, rev bool) {
+	var startid, endid streamID
+	var startex, endex bool
+	count := int64(-1)
+	startarg, endarg := c.argv[2], c.argv[3]
+	if rev {
+		startarg, endarg = c.argv[3], c.argv[2]
+	}
+
+	if streamParseIntervalIDOrReply(c, startarg, &startid, &startex, 0) != C_OK {
+		return
+	}
+	if startex && streamIncrID(&startid) != C_OK {
+		addReplyError(c, "invalid start ID for the interval")
+		return
+	}
+	if streamParseIntervalIDOrReply(c, endarg, &endid, &endex, math.MaxUint64) != C_OK {
+		return
+	}
+	if endex && streamDecrID(&endid) != C_OK {
+		addReplyError(c, "invalid end ID for the interval")
+		return
+	}
+
+	for j := 4; j < c.argc; j++ {
+		additional := c.argc - j - 1
+		if util.StrCaseCmp(argvBytes(c.argv[j]), "count") && additional >= 1 {
+			if c.argv[j+1].getLongLongFromObjectOrReply(c, &count, "") != C_OK {
+				return
+			}
+			if count < 0 {
+				count = 0
+			}
+			j++
+		} else {
+			addReplyErrorObject(c, shared.syntaxErr)
+			return
+		}
+	}
+
+	o := lookupKeyReadOrReply(c, c.argv[1], shared.emptyArray)
+	if o == nil || o.checkType(c, ObjStream) {
+		return
+	}
+	s := (*stream)(o.ptr)
+
+	if count == 0 {
+		addReply(c, shared.nullArray[c.resp])
+	} else {
+		if count == -1 {
+			count = 0
+		}
+		streamReplyWithRange(c, s, &startid, &endid, count, rev, nil, nil, 0)
+	}
+}
+
+// XLEN key
+func xlenCommand(c *Client) {
+	o := lookupKeyReadOrReply(c, c.argv[1], shared.czero)
+	if o == nil || o.checkType(c, ObjStream) {
+		return
+	}
+	addReplyLongLong(c, int((*stream)(o.ptr).length))
+}
+
+// XDEL key id [id ...]
+func xdelCommand(c *Client) {
+	o := lookupKeyWriteOrReply(c, c.argv[1], shared.czero)
+	if o == nil || o.checkType(c, ObjStream) {
+		return
+	}
+	s := (*stream)(o.ptr)
+
+	// 先检查所有的ID，不能删除了一部分之后才报错
+	ids := make([]streamID, c.argc-2)
+	for j := 2; j < c.argc; j++ {
+		if streamParseStrictIDOrReply(c, c.argv[j], &ids[j-2], 0, nil) != C_OK {
+			return
+		}
+	}
+
+	deleted := 0
+	firstEntry := false
+	for j := range ids {
+		id := &ids[j]
+		if streamDeleteItem(s, id) {
+			if streamCompareID(id, &s.firstID) == 0 {
+				firstEntry = true
+			}
+			if streamCompareID(id, &s.maxDeletedEntryID) > 0 {
+				s.maxDeletedEntryID = *id
+			}
+			deleted++
+		}
+	}
+
+	if deleted > 0 {
+		if s.length == 0 {
+			s.firstID = streamID{}
+		} else if firstEntry {
+			streamGetEdgeID(s, true, true, &s.firstID)
+		}
+		signalModifiedKey(c, c.db, c.argv[1])
+		notifyKeySpaceEvent(notifyStream, "xdel", c.argv[1], c.db.id)
+		server.dirty += deleted
+	}
+	addReplyLongLong(c, deleted)
+}
+
+// XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func xtrimCommand(c *Client) {
+	o := lookupKeyWriteOrReply(c, c.argv[1], shared.czero)
+	if o == nil || o.checkType(c, ObjStream) {
+		return
+	}
+	s := (*stream)(o.ptr)
+
+	var args streamAddTrimArgs
+	i := streamParseAddOrTrimArgsOrReply(c, &args, false)
+	if i < 0 {
+		return
+	}
+	if i < c.argc {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+
+	deleted := streamTrim(s, &args)
+	if deleted > 0 {
+		notifyKeySpaceEvent(notifyStream, "xtrim", c.argv[1], c.db.id)
+		if args.approxTrim {
+			streamRewriteApproxSpecifier(c, args.trimStrategyArgIdx-1)
+			streamRewriteTrimArgument(c, s, args.trimStrategy, args.trimStrategyArgIdx)
+		}
+		signalModifiedKey(c, c.db, c.argv[1])
+		server.dirty += int(deleted)
+	}
+	addReplyLongLong(c, int(deleted))
+}
+
+/*-----------------------------------------------------------------------------
+ * 消费组相关的命令
+ *----------------------------------------------------------------------------*/
+
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func xreadCommand(c *Client) {
+	timeout := int64(-1) // -1表示没有BLOCK参数
+	var count int64
+	streamsCount, streamsArg := 0, 0
+	noack := false
+	xreadgroup := len(argvBytes(c.argv[0])) == 10
+	var groupname, consumername *robj
+
+	for i := 1; i < c.argc; i++ {
+		moreargs := c.argc - i - 1
+		o := argvBytes(c.argv[i])
+		if util.StrCaseCmp(o, "block") && moreargs > 0 {
+			i++
+			if getTimeoutFromObjectOrReply(c, c.argv[i], &timeout, unitMilliSeconds) != C_OK {
+				return
+			}
+		} else if util.StrCaseCmp(o, "count") && moreargs > 0 {
+			i++
+			if c.argv[i].getLongLongFromObjectOrReply(c, &count, "") != C_OK {
+				return
+			}
+			if count < 0 {
+				count = 0
+			}
+		} else if util.StrCaseCmp(o, "streams") && moreargs > 0 {
+			streamsArg = i + 1
+			streamsCount = c.argc - streamsArg
+			if streamsCount%2 != 0 {
+				symbol := '$'
+				if xreadgroup {
+					symbol = '>'
+				}
+				addReplyErrorFormat(c, "Unbalanced '%s' list of streams: for each stream key an ID or '%c' must be specified.", c.cmd.name, symbol)
+				return
+			}
+			streamsCount /= 2
+			break
+		} else if util.StrCaseCmp(o, "group") && moreargs >= 2 {
+			if !xreadgroup {
+				addReplyError(c, "The GROUP option is only supported by XREADGROUP. You called XREAD instead.")
+				return
+			}
+			groupname = c.argv[i+1]
+			consumername = c.argv[i+2]
+			i += 2
+		} else if util.StrCaseCmp(o, "noack") {
+			if !xreadgroup {
+				addReplyError(c, "The NOACK option is only supported by XREADGROUP. You called XREAD instead.")
+				return
+			}
+			noack = true
+		} else {
+			addReplyErrorObject(c, shared.syntaxErr)
+			return
+		}
+	}
+
+	// STREAMS是必须的
+	if streamsArg == 0 {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+
+	if xreadgroup && groupname == nil {
+		addReplyError(c, "Missing GROUP option for XREADGROUP")
+		return
+	}
+
+	// 解析ID并且查找消费组
+	ids := make([]streamID, streamsCount)
+	var groups []*streamCG
+	if groupname != nil {
+		groups = make([]*streamCG, streamsCount)
+	}
+	for i := streamsArg + streamsCount; i < c.argc; i++ {
+		idIdx := i - streamsArg - streamsCount
+		key := c.argv[i-streamsCount]
+		o := c.db.lookupKeyRead(key)
+		if o != nil && o.checkType(c, ObjStream) {
+			return
+		}
+
+		if groupname != nil {
+			var group *streamCG
+			if o != nil {
+				group = streamLookupCG((*stream)(o.ptr), *(*sds.SDS)(groupname.ptr))
+			}
+			if group == nil {
+				addReplyErrorFormat(c, "-NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option",
+					argvBytes(key), argvBytes(groupname))
+				return
+			}
+			groups[idIdx] = group
+		}
+
+		arg := argvBytes(c.argv[i])
+		if len(arg) == 1 && arg[0] == '$' {
+			if xreadgroup {
+				addReplyError(c, "The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+				return
+			}
+			// 只读取之后添加的元素
+			if o != nil {
+				ids[idIdx] = (*stream)(o.ptr).lastID
+			}
+			continue
+		} else if len(arg) == 1 && arg[0] == '>' {
+			if !xreadgroup {
+				addReplyError(c, "The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+				return
+			}
+			// 用最大的ID表示">"，阻塞时会使用消费组的lastID
+			ids[idIdx] = streamID{math.MaxUint64, math.MaxUint64}
+			continue
+		}
+		if streamParseStrictIDOrReply(c, c.argv[i], &ids[idIdx], 0, nil) != C_OK {
+			return
+		}
+	}
+
+	// 先尝试直接返回
+	arraylen := 0
+	var arraylenPtr *adlist.ListNode
+	for i := 0; i < streamsCount; i++ {
+		key := c.argv[streamsArg+i]
+		o := c.db.lookupKeyRead(key)
+		if o == nil {
+			continue
+		}
+		s := (*stream)(o.ptr)
+		gt := &ids[i] // 只返回比它大的元素
+		serveSynchronously := false
+		serveHistory := false // XREADGROUP指定的ID不是">"
+		var consumer *streamConsumer
+
+		if groups != nil {
+			if gt.ms != math.MaxUint64 || gt.seq != math.MaxUint64 {
+				// 读取consumer的历史消息
+				serveSynchronously = true
+				serveHistory = true
+			} else if s.length > 0 {
+				// 有消费组还没有投递的元素
+				var maxid streamID
+				last := &groups[i].lastID
+				streamLastValidID(s, &maxid)
+				if streamCompareID(&maxid, last) > 0 {
+					serveSynchronously = true
+					*gt = *last
+				}
+			}
+			name := *(*sds.SDS)(consumername.ptr)
+			if consumer = streamLookupConsumer(groups[i], name, false); consumer == nil {
+				consumer = streamCreateConsumer(groups[i], name, key, c.db.id)
+			}
+			consumer.seenTime = mstime()
+		} else if s.length > 0 {
+			var maxid streamID
+			streamLastValidID(s, &maxid)
+			if streamCompareID(&maxid, gt) > 0 {
+				serveSynchronously = true
+			}
+		}
+
+		if serveSynchronously {
+			arraylen++
+			if arraylen == 1 {
+				arraylenPtr = addReplyDeferredLen(c)
+			}
+			// streamReplyWithRange包含start，所以从下一个ID开始
+			start := *gt
+			streamIncrID(&start)
+
+			if c.resp == 2 {
+				addReplyArrayLen(c, 2)
+			}
+			addReplyBulk(c, key)
+			flags := 0
+			if noack {
+				flags |= streamRwrNoAck
+			}
+			if serveHistory {
+				flags |= streamRwrHistory
+			}
+			var group *streamCG
+			if groups != nil {
+				group = groups[i]
+			}
+			streamReplyWithRange(c, s, &start, nil, count, false, group, consumer, flags)
+			if groups != nil {
+				server.dirty++
+			}
+		}
+	}
+
+	if arraylen > 0 {
+		if c.resp == 2 {
+			setDeferredArrayLen(c, arraylenPtr, arraylen)
+		} else {
+			setDeferredMapLen(c, arraylenPtr, arraylen)
+		}
+		return
+	}
+
+	if timeout != -1 {
+		// 不允许阻塞时只能当做超时处理
+		if c.flags&CLIENT_DENY_BLOCKING > 0 {
+			addReply(c, shared.nullArray[c.resp])
+			return
+		}
+		blockForKeys(c, BLOCKED_STREAM, c.argv[streamsArg:streamsArg+streamsCount], 0, timeout, nil, nil, ids)
+
+		// 阻塞时没有指定COUNT，避免ID太小的时候一次返回太多元素
+		c.bpop.xReadCount = int(count)
+		if count == 0 {
+			c.bpop.xReadCount = xreadBlockedDefaultCount
+		}
+
+		// 记录XREADGROUP的消费组和consumer，有数据之后才知道怎么回复
+		if groupname != nil {
+			groupname.incrRefCount()
+			consumername.incrRefCount()
+			c.bpop.xReadGroup = groupname
+			c.bpop.xReadConsumer = consumername
+			c.bpop.xReadGroupNoAck = 0
+			if noack {
+				c.bpop.xReadGroupNoAck = 1
+			}
+		} else {
+			c.bpop.xReadGroup = nil
+			c.bpop.xReadConsumer = nil
+		}
+		return
+	}
+
+	// 没有BLOCK参数，也没有可以返回的元素
+	addReply(c, shared.nullArray[c.resp])
+}
+
+// XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD entries_read]
+// XGROUP SETID key group id|$ [ENTRIESREAD entries_read]
+// XGROUP DESTROY key group
+// XGROUP CREATECONSUMER key group consumer
+// XGROUP DELCONSUMER key group consumer
+func xgroupCommand(c *Client) {
+	var s *stream
+	var grpname sds.SDS
+	var cg *streamCG
+	opt := argvBytes(c.argv[1])
+	mkstream := false
+	entriesRead := int64(scgInvalidEntriesRead)
+
+	// 除了HELP都需要key和消费组的名称
+	if c.argc >= 4 {
+		// 解析CREATE的选项
+		if util.StrCaseCmp(opt, "create") && c.argc >= 5 {
+			for i := 5; i < c.argc; {
+				if util.StrCaseCmp(argvBytes(c.argv[i]), "mkstream") {
+					mkstream = true
+					i++
+				} else if util.StrCaseCmp(argvBytes(c.argv[i]), "entriesread") && i+1 < c.argc {
+					if c.argv[i+1].getLongLongFromObjectOrReply(c, &entriesRead, "") != C_OK {
+						return
+					}
+					if entriesRead < 0 && entriesRead != scgInvalidEntriesRead {
+						addReplyError(c, "value for ENTRIESREAD must be positive or -1")
+						return
+					}
+					i += 2
+				} else {
+					addReplySubcommandSyntaxError(c)
+					return
+				}
+			}
+		}
+
+		o := c.db.lookupKeyWrite(c.argv[2])
+		if o != nil {
+			if o.checkType(c, ObjStream) {
+				return
+			}
+			s = (*stream)(o.ptr)
+		}
+		grpname = *(*sds.SDS)(c.argv[3].ptr)
+
+		if !mkstream {
+			if s == nil {
+				addReplyError(c, "The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+				return
+			}
+
+			// 这几个子命令要求消费组已经存在
+			if cg = streamLookupCG(s, grpname); cg == nil &&
+				(util.StrCaseCmp(opt, "setid") ||
+					util.StrCaseCmp(opt, "createconsumer") ||
+					util.StrCaseCmp(opt, "delconsumer")) {
+				addReplyErrorFormat(c, "-NOGROUP No such consumer group '%s' for key name '%s'",
+					grpname.BufData(0), argvBytes(c.argv[2]))
+				return
+			}
+		}
+	}
+
+	if c.argc == 2 && util.StrCaseCmp(opt, "help") {
+		addReplyHelp(c, []string{
+			"CREATE <key> <groupname> <id|$> [option]",
+			"    Create a new consumer group. Options are:",
+			"    * MKSTREAM",
+			"      Create the empty stream if it does not exist.",
+			"    * ENTRIESREAD entries_read",
+			"      Set the group's entries_read counter (internal use).",
+			"CREATECONSUMER <key> <groupname> <consumer>",
+			"    Create a new consumer in the specified group.",
+			"DELCONSUMER <key> <groupname> <consumer>",
+			"    Remove the specified consumer.",
+			"DESTROY <key> <groupname>",
+			"    Remove the specified group.",
+			"SETID <key> <groupname> <id|$> [ENTRIESREAD entries_read]",
+			"    Set the current group ID and entries_read counter.",
+		})
+	} else if util.StrCaseCmp(opt, "create") && c.argc >= 5 && c.argc <= 8 {
+		var id streamID
+		if arg := argvBytes(c.argv[4]); len(arg) == 1 && arg[0] == '$' {
+			if s != nil {
+				id = s.lastID
+			}
+		} else if streamParseStrictIDOrReply(c, c.argv[4], &id, 0, nil) != C_OK {
+			return
+		}
+
+		// 命令不会再失败了，处理MKSTREAM
+		if s == nil {
+			o := createStreamObject()
+			c.db.dbAdd(c.argv[2], o)
+			s = (*stream)(o.ptr)
+			signalModifiedKey(c, c.db, c.argv[2])
+		}
+
+		if streamCreateCG(s, grpname.BufData(0), &id, entriesRead) != nil {
+			addReply(c, shared.ok)
+			server.dirty++
+			notifyKeySpaceEvent(notifyStream, "xgroup-create", c.argv[2], c.db.id)
+		} else {
+			addReplyError(c, "-BUSYGROUP Consumer Group name already exists")
+		}
+	} else if util.StrCaseCmp(opt, "setid") && (c.argc == 5 || c.argc == 7) {
+		var id streamID
+		if arg := argvBytes(c.argv[4]); len(arg) == 1 && arg[0] == '$' {
+			id = s.lastID
+		} else if streamParseIDOrReply(c, c.argv[4], &id, 0, nil) != C_OK {
+			return
+		}
+		if c.argc == 7 {
+			if !util.StrCaseCmp(argvBytes(c.argv[5]), "entriesread") {
+				addReplyErrorObject(c, shared.syntaxErr)
+				return
+			}
+			if c.argv[6].getLongLongFromObjectOrReply(c, &entriesRead, "") != C_OK {
+				return
+			}
+			if entriesRead < 0 && entriesRead != scgInvalidEntriesRead {
+				addReplyError(c, "value for ENTRIESREAD must be positive or -1")
+				return
+			}
+		}
+		cg.lastID = id
+		cg.entriesRead = entriesRead
+		addReply(c, shared.ok)
+		server.dirty++
+		notifyKeySpaceEvent(notifyStream, "xgroup-setid", c.argv[2], c.db.id)
+	} else if util.StrCaseCmp(opt, "destroy") && c.argc == 4 {
+		if cg != nil {
+			raxRemove(s.cgroups, grpname.BufData(0))
+			addReply(c, shared.cone)
+			server.dirty++
+			notifyKeySpaceEvent(notifyStream, "xgroup-destroy", c.argv[2], c.db.id)
+			// 阻塞在这个消费组上的XREADGROUP会收到NOGROUP错误
+			signalKeyAsReady(c.db, c.argv[2])
+		} else {
+			addReply(c, shared.czero)
+		}
+	} else if util.StrCaseCmp(opt, "createconsumer") && c.argc == 5 {
+		created := streamCreateConsumer(cg, *(*sds.SDS)(c.argv[4].ptr), c.argv[2], c.db.id)
+		if created != nil {
+			addReplyLongLong(c, 1)
+		} else {
+			addReplyLongLong(c, 0)
+		}
+	} else if util.StrCaseCmp(opt, "delconsumer") && c.argc == 5 {
+		pending := 0
+		consumer := streamLookupConsumer(cg, *(*sds.SDS)(c.argv[4].ptr), false)
+		if consumer != nil {
+			// 返回consumer还没有确认的元素个数
+			pending = int(raxSize(consumer.pel))
+			streamDelConsumer(cg, consumer)
+			server.dirty++
+			notifyKeySpaceEvent(notifyStream, "xgroup-delconsumer", c.argv[2], c.db.id)
+		}
+		addReplyLongLong(c, pending)
+	} else {
+		addReplySubcommandSyntaxError(c)
+	}
+}
+
+// XACK key group id [id ...]
+func xackCommand(c *Client) {
+	var group *streamCG
+	o := c.db.lookupKeyRead(c.argv[1])
+	if o != nil {
+		if o.checkType(c, ObjStream) {
+			return
+		}
+		group = streamLookupCG((*stream)(o.ptr), *(*sds.SDS)(c.argv[2].ptr))
+	}
+
+	// key或者消费组不存在
+	if o == nil || group == nil {
+		addReply(c, shared.czero)
+		return
+	}
+
+	// 先解析所有的ID，要么全部确认，要么返回错误
+	ids := make([]streamID, c.argc-3)
+	for j := 3; j < c.argc; j++ {
+		if streamParseStrictIDOrReply(c, c.argv[j], &ids[j-3], 0, nil) != C_OK {
+			return
+		}
+	}
+
+	acknowledged := 0
+	for j := range ids {
+		var buf [16]byte
+		streamEncodeID(buf[:], &ids[j])
+
+		// 通过消费组PEL中的NACK找到consumer，从两个PEL中都删除
+		if p, ok := raxFind(group.pel, buf[:]); ok {
+			nack := (*streamNACK)(p)
+			raxRemove(group.pel, buf[:])
+			raxRemove(nack.consumer.pel, buf[:])
+			acknowledged++
+			server.dirty++
+		}
+	}
+	addReplyLongLong(c, acknowledged)
+}
+
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func xpendingCommand(c *Client) {
+	justinfo := c.argc == 3 // 没有范围时只返回PEL的概要
+	key := c.argv[1]
+	groupname := c.argv[2]
+	var consumername *robj
+	var startid, endid streamID
+	var count, minidle int64
+	var startex, endex bool
+
+	if c.argc != 3 && (c.argc < 6 || c.argc > 9) {
+		addReplyErrorObject(c, shared.syntaxErr)
+		return
+	}
+
+	// 先解析参数，语法错误优先于其它错误
+	if c.argc >= 6 {
+		startidx := 3
+		if util.StrCaseCmp(argvBytes(c.argv[3]), "idle") {
+			if c.argv[4].getLongLongFromObjectOrReply(c, &minidle, "") != C_OK {
+				return
+			}
+			// 指定了IDLE之后至少还要有start end count
+			if c.argc < 8 {
+				addReplyErrorObject(c, shared.syntaxErr)
+				return
+			}
+			startidx += 2
+		}
+
+		if c.argv[startidx+2].getLongLongFromObjectOrReply(c, &count, "") != C_OK {
+			return
+		}
+		if count < 0 {
+			count = 0
+		}
+
+		if streamParseIntervalIDOrReply(c, c.argv[startidx], &startid, &startex, 0) != C_OK {
+			return
+		}
+		if startex && streamIncrID(&startid) != C_OK {
+			addReplyError(c, "invalid start ID for the interval")
+			return
+		}
+		if streamParseIntervalIDOrReply(c, c.argv[startidx+1], &endid, &endex, math.MaxUint64) != C_OK {
+			return
+		}
+		if endex && streamDecrID(&endid) != C_OK {
+			addReplyError(c, "invalid end ID for the interval")
+			return
+		}
+
+		if startidx+3 < c.argc {
+			consumername = c.argv[startidx+3]
+		}
+	}
+
+	o := c.db.lookupKeyRead(key)
+	if o != nil && o.checkType(c, ObjStream) {
+		return
+	}
+	var group *streamCG
+	if o != nil {
+		group = streamLookupCG((*stream)(o.ptr), *(*sds.SDS)(groupname.ptr))
+	}
+	if group == nil {
+		addReplyErrorFormat(c, "-NOGROUP No such key '%s' or consumer group '%s'", argvBytes(key), argvBytes(groupname))
+		return
+	}
+
+	if justinfo {
+		// 数量、最小和最大的ID、每个consumer的数量
+		addReplyArrayLen(c, 4)
+		addReplyLongLong(c, int(raxSize(group.pel)))
+		if raxSize(group.pel) == 0 {
+			addReplyNull(c)
+			addReplyNull(c)
+			addReply(c, shared.nullArray[c.resp])
+			return
+		}
+
+		var ri raxIterator
+		raxStart(&ri, group.pel)
+		raxSeek(&ri, "^", nil)
+		raxNext(&ri)
+		streamDecodeID(ri.key, &startid)
+		addReplyStreamID(c, &startid)
+
+		raxSeek(&ri, "$", nil)
+		raxNext(&ri)
+		streamDecodeID(ri.key, &endid)
+		addReplyStreamID(c, &endid)
+		raxStop(&ri)
+
+		raxStart(&ri, group.consumers)
+		raxSeek(&ri, "^", nil)
+		arraylenPtr := addReplyDeferredLen(c)
+		arraylen := 0
+		for raxNext(&ri) {
+			consumer := (*streamConsumer)(ri.data)
+			if raxSize(consumer.pel) == 0 {
+				continue
+			}
+			addReplyArrayLen(c, 2)
+			addReplyBulkBuffer(c, ri.key, len(ri.key))
+			addReplyBulkLongLong(c, int64(raxSize(consumer.pel)))
+			arraylen++
+		}
+		setDeferredArrayLen(c, arraylenPtr, arraylen)
+		raxStop(&ri)
+		return
+	}
+
+	// 返回范围内的元素
+	var consumer *streamConsumer
+	if consumername != nil {
+		consumer = streamLookupConsumer(group, *(*sds.SDS)(consumername.ptr), false)
+		// consumer不存在时返回空数组
+		if consumer == nil {
+			addReplyArrayLen(c, 0)
+			return
+		}
+	}
+
+	pel := group.pel
+	if consumer != nil {
+		pel = consumer.pel
+	}
+	var startkey, endkey [16]byte
+	streamEncodeID(startkey[:], &startid)
+	streamEncodeID(endkey[:], &endid)
+	now := mstime()
+
+	var ri raxIterator
+	raxStart(&ri, pel)
+	raxSeek(&ri, ">=", startkey[:])
+	arraylenPtr := addReplyDeferredLen(c)
+	arraylen := 0
+	for count > 0 && raxNext(&ri) && bytes.Compare(ri.key, endkey[:]) <= 0 {
+		nack := (*streamNACK)(ri.data)
+		if minidle > 0 && now-nack.deliveryTime < minidle {
+			continue
+		}
+		arraylen++
+		count--
+
+		var id streamID
+		streamDecodeID(ri.key, &id)
+		addReplyArrayLen(c, 4)
+		addReplyStreamID(c, &id)
+		name := nack.consumer.name.BufData(0)
+		addReplyBulkBuffer(c, name, len(name))
+
+		// 距离最后一次投递的毫秒数
+		elapsed := now - nack.deliveryTime
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		addReplyLongLong(c, int(elapsed))
+		addReplyLongLong(c, int(nack.deliveryCount))
+	}
+	raxStop(&ri)
+	setDeferredArrayLen(c, arraylenPtr, arraylen)
+}
+
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func xclaimCommand(c *Client) {
+	var group *streamCG
+	o := c.db.lookupKeyRead(c.argv[1])
+	var minidle int64
+	retrycount := int64(-1)   // -1表示没有RETRYCOUNT参数
+	deliverytime := int64(-1) // -1表示没有IDLE和TIME参数
+	force, justid := false, false
+
+	if o != nil {
+		if o.checkType(c, ObjStream) {
+			return
+		}
+		group = streamLookupCG((*stream)(o.ptr), *(*sds.SDS)(c.argv[2].ptr))
+	}
+
+	// 消费组必须已经存在
+	if o == nil || group == nil {
+		addReplyErrorFormat(c, "-NOGROUP No such key '%s' or consumer group '%s'", argvBytes(c.argv[1]), argvBytes(c.argv[2]))
+		return
+	}
+	s := (*stream)(o.ptr)
+
+	if c.argv[4].getLongLongFromObjectOrReply(c, &minidle, "Invalid min-idle-time argument for XCLAIM") != C_OK {
+		return
+	}
+	if minidle < 0 {
+		minidle = 0
+	}
+
+	// 先解析ID，不能解析的可能是后面的选项
+	j := 5
+	for ; j < c.argc; j++ {
+		var id streamID
+		if streamParseStrictIDOrReply(nil, c.argv[j], &id, 0, nil) != C_OK {
+			break
+		}
+	}
+	lastIDArg := j - 1
+
+	now := mstime()
+	var lastID streamID
+	for ; j < c.argc; j++ {
+		moreargs := c.argc - 1 - j
+		opt := argvBytes(c.argv[j])
+		if util.StrCaseCmp(opt, "force") {
+			force = true
+		} else if util.StrCaseCmp(opt, "justid") {
+			justid = true
+		} else if util.StrCaseCmp(opt, "idle") && moreargs > 0 {
+			j++
+			if c.argv[j].getLongLongFromObjectOrReply(c, &deliverytime, "Invalid IDLE option argument for XCLAIM") != C_OK {
+				return
+			}
+			deliverytime = now - deliverytime
+		} else if util.StrCaseCmp(opt, "time") && moreargs > 0 {
+			j++
+			if c.argv[j].getLongLongFromObjectOrReply(c, &deliverytime, "Invalid TIME option argument for XCLAIM") != C_OK {
+				return
+			}
+		} else if util.StrCaseCmp(opt, "retrycount") && moreargs > 0 {
+			j++
+			if c.argv[j].getLongLongFromObjectOrReply(c, &retrycount, "Invalid RETRYCOUNT option argument for XCLAIM") != C_OK {
+				return
+			}
+		} else if util.StrCaseCmp(opt, "lastid") && moreargs > 0 {
+			j++
+			if streamParseStrictIDOrReply(c, c.argv[j], &lastID, 0, nil) != C_OK {
+				return
+			}
+		} else {
+			addReplyErrorFormat(c, "Unrecognized XCLAIM option '%s'", opt)
+			return
+		}
+	}
+
+	if streamCompareID(&lastID, &group.lastID) > 0 {
+		group.lastID = lastID
+	}
+
+	// 客户端可能是根据自己的时间计算的，时间不合理时使用当前时间，而不是返回错误
+	if deliverytime < 0 || deliverytime > now {
+		deliverytime = now
+	}
+
+	var consumer *streamConsumer
+	name := *(*sds.SDS)(c.argv[3].ptr)
+	arraylenPtr := addReplyDeferredLen(c)
+	arraylen := 0
+	for j := 5; j <= lastIDArg; j++ {
+		var id streamID
+		streamParseStrictIDOrReply(nil, c.argv[j], &id, 0, nil)
+
+		var buf [16]byte
+		streamEncodeID(buf[:], &id)
+		var nack *streamNACK
+		if p, ok := raxFind(group.pel, buf[:]); ok {
+			nack = (*streamNACK)(p)
+		}
+
+		// 元素已经被删除了，从PEL中删除
+		if !streamEntryExists(s, &id) {
+			if nack != nil {
+				server.dirty++
+				raxRemove(group.pel, buf[:])
+				raxRemove(nack.consumer.pel, buf[:])
+			}
+			continue
+		}
+
+		// 指定了FORCE时，即使元素不在PEL中也会创建
+		if force && nack == nil {
+			nack = streamCreateNACK(nil)
+			raxInsert(group.pel, buf[:], unsafe.Pointer(nack))
+		}
+
+		if nack == nil {
+			continue
+		}
+
+		// FORCE创建的NACK没有consumer，不需要检查空闲时间
+		if nack.consumer != nil && minidle > 0 && now-nack.deliveryTime < minidle {
+			continue
+		}
+
+		if consumer == nil {
+			if consumer = streamLookupConsumer(group, name, true); consumer == nil {
+				consumer = streamCreateConsumer(group, name, c.argv[1], c.db.id)
+			}
+		}
+		if nack.consumer != consumer && nack.consumer != nil {
+			raxRemove(nack.consumer.pel, buf[:])
+		}
+		nack.deliveryTime = deliverytime
+		// 指定了RETRYCOUNT时直接设置，否则除了JUSTID都加一
+		if retrycount >= 0 {
+			nack.deliveryCount = retrycount
+		} else if !justid {
+			nack.deliveryCount++
+		}
+		if nack.consumer != consumer {
+			raxInsert(consumer.pel, buf[:], unsafe.Pointer(nack))
+			nack.consumer = consumer
+		}
+
+		if justid {
+			addReplyStreamID(c, &id)
+		} else if streamReplyWithRange(c, s, &id, &id, 1, false, nil, nil, streamRwrRawEntries) != 1 {
+			panic("XCLAIM: claimed entry not found")
+		}
+		arraylen++
+		server.dirty++
+	}
+	setDeferredArrayLen(c, arraylenPtr, arraylen)
+}
+
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func xautoclaimCommand(c *Client) {
+	var group *streamCG
+	o := c.db.lookupKeyRead(c.argv[1])
+	var minidle int64
+	count := int64(100) // 最多转移的元素个数
+	const attemptsFactor = 10
+	var startid streamID
+	var startex bool
+	justid := false
+
+	if c.argv[4].getLongLongFromObjectOrReply(c, &minidle, "Invalid min-idle-time argument for XAUTOCLAIM") != C_OK {
+		return
+	}
+	if minidle < 0 {
+		minidle = 0
+	}
+
+	if streamParseIntervalIDOrReply(c, c.argv[5], &startid, &startex, 0) != C_OK {
+		return
+	}
+	if startex && streamIncrID(&startid) != C_OK {
+		addReplyError(c, "invalid start ID for the interval")
+		return
+	}
+
+	for j := 6; j < c.argc; j++ {
+		moreargs := c.argc - 1 - j
+		opt := argvBytes(c.argv[j])
+		if util.StrCaseCmp(opt, "count") && moreargs > 0 {
+			if c.argv[j+1].getRangeLongFromObjectOrReply(c, 1, math.MaxInt64/16, &count, "COUNT must be > 0") != C_OK {
+				return
+			}
+			j++
+		} else if util.StrCaseCmp(opt, "justid") {
+			justid = true
+		} else {
+			addReplyErrorObject(c, shared.syntaxErr)
+			return
+		}
+	}
+
+	if o != nil {
+		if o.checkType(c, ObjStream) {
+			return
+		}
+		group = streamLookupCG((*stream)(o.ptr), *(*sds.SDS)(c.argv[2].ptr))
+	}
+
+	// 消费组必须已经存在
+	if o == nil || group == nil {
+		addReplyErrorFormat(c, "-NOGROUP No such key '%s' or consumer group '%s'", argvBytes(c.argv[1]), argvBytes(c.argv[2]))
+		return
+	}
+	s := (*stream)(o.ptr)
+
+	// 最多检查count*attemptsFactor个PEL中的元素，避免阻塞太久
+	attempts := count * attemptsFactor
+
+	// 回复: 下一次调用的start、转移的元素、已经被删除的ID
+	addReplyArrayLen(c, 3)
+	endidPtr := addReplyDeferredLen(c)
+	arraylenPtr := addReplyDeferredLen(c)
+
+	var startkey [16]byte
+	streamEncodeID(startkey[:], &startid)
+	var ri raxIterator
+	raxStart(&ri, group.pel)
+	raxSeek(&ri, ">=", startkey[:])
+	arraylen := 0
+	now := mstime()
+	name := *(*sds.SDS)(c.argv[3].ptr)
+	var consumer *streamConsumer
+	var deletedIDs []streamID
+	for ; attempts > 0 && count > 0 && raxNext(&ri); attempts-- {
+		nack := (*streamNACK)(ri.data)
+		var id streamID
+		streamDecodeID(ri.key, &id)
+
+		// 元素已经被删除了，从PEL中删除，并且记录下来返回给客户端
+		if !streamEntryExists(s, &id) {
+			server.dirty++
+			key := append([]byte(nil), ri.key...)
+			raxRemove(group.pel, key)
+			raxRemove(nack.consumer.pel, key)
+			deletedIDs = append(deletedIDs, id)
+			raxSeek(&ri, ">=", key)
+			count--
+			continue
+		}
+
+		if minidle > 0 && now-nack.deliveryTime < minidle {
+			continue
+		}
+
+		if consumer == nil {
+			if consumer = streamLookupConsumer(group, name, true); consumer == nil {
+				consumer = streamCreateConsumer(group, name, c.argv[1], c.db.id)
+			}
+		}
+		if nack.consumer != consumer && nack.consumer != nil {
+			raxRemove(nack.consumer.pel, ri.key)
+		}
+
+		nack.deliveryTime = now
+		if !justid {
+			nack.deliveryCount++
+		}
+		if nack.consumer != consumer {
+			raxInsert(consumer.pel, ri.key, unsafe.Pointer(nack))
+			nack.consumer = consumer
+		}
+
+		if justid {
+			addReplyStreamID(c, &id)
+		} else if streamReplyWithRange(c, s, &id, &id, 1, false, nil, nil, streamRwrRawEntries) != 1 {
+			panic("XAUTOCLAIM: claimed entry not found")
+		}
+		arraylen++
+		count--
+		server.dirty++
+	}
+
+	// 返回下一个元素的ID作为下一次调用的游标，没有更多元素时为0-0
+	raxNext(&ri)
+	var endid streamID
+	if !raxEOF(&ri) {
+		streamDecodeID(ri.key, &endid)
+	}
+	raxStop(&ri)
+
+	setDeferredArrayLen(c, arraylenPtr, arraylen)
+	setDeferredReplyBulkCString(c, endidPtr, fmt.Sprintf("%d-%d", endid.ms, endid.seq))
+
+	addReplyArrayLen(c, len(deletedIDs))
+	for i := range deletedIDs {
+		addReplyStreamID(c, &deletedIDs[i])
+	}
+}
+
+// streamReplyWithCGLag 回复消费组的lag，也就是还没有读取的元素个数，无法计算时回复null
+func streamReplyWithCGLag(c *Client, s *stream, cg *streamCG) {
+	valid := false
+	var lag int64
+
+	if s.entriesAdded == 0 {
+		// 从来没有添加过元素
+		valid = true
+	} else if cg.entriesRead != scgInvalidEntriesRead && !streamRangeHasTombstones(s, &cg.lastID, nil) {
+		// 后面没有被删除的元素，entriesRead是准确的
+		lag = int64(s.entriesAdded) - cg.entriesRead
+		valid = true
+	} else {
+		entriesRead := streamEstimateDistanceFromFirstEverEntry(s, &cg.lastID)
+		if entriesRead != scgInvalidEntriesRead {
+			lag = int64(s.entriesAdded) - entriesRead
+			valid = true
+		}
+	}
+
+	if valid {
+		addReplyLongLong(c, int(lag))
+	} else {
+		addReplyNull(c)
+	}
+}
+
+func addReplyEntriesRead(c *Client, cg *streamCG) {
+	if cg.entriesRead != scgInvalidEntriesRead {
+		addReplyLongLong(c, int(cg.entriesRead))
+	} else {
+		addReplyNull(c)
+	}
+}
+
+// xinfoReplyWithStreamInfo XINFO STREAM key [FULL [COUNT count]]
+func xinfoReplyWithStreamInfo(c *Client, s *stream) {
+	full := true
+	count := int64(10) // 默认只返回10个，避免阻塞服务器
+	argv := c.argv[3:c.argc]
+
+	if len(argv) == 0 {
+		full = false
+	} else {
+		// 只支持FULL或者FULL COUNT count
+		if (len(argv) != 1 && len(argv) != 3) || !util.StrCaseCmp(argvBytes(argv[0]), "full") {
+			addReplySubcommandSyntaxError(c)
+			return
+		}
+		if len(argv) == 3 {
+			if !util.StrCaseCmp(argvBytes(argv[1]), "count") {
+				addReplySubcommandSyntaxError(c)
+				return
+			}
+			if argv[2].getLongLongFromObjectOrReply(c, &count, "") != C_OK {
+				return
+			}
+			if count < 0 {
+				count = 10
+			}
+		}
+	}
+
+	if full {
+		addReplyMapLen(c, 9)
+	} else {
+		addReplyMapLen(c, 10)
+	}
+	addReplyBulkCString(c, "length")
+	addReplyLongLong(c, int(s.length))
+	addReplyBulkCString(c, "radix-tree-keys")
+	addReplyLongLong(c, int(raxSize(s.rax)))
+	addReplyBulkCString(c, "radix-tree-nodes")
+	addReplyLongLong(c, int(s.rax.numnodes))
+	addReplyBulkCString(c, "last-generated-id")
+	addReplyStreamID(c, &s.lastID)
+	addReplyBulkCString(c, "max-deleted-entry-id")
+	addReplyStreamID(c, &s.maxDeletedEntryID)
+	addReplyBulkCString(c, "entries-added")
+	addReplyLongLong(c, int(s.entriesAdded))
+	addReplyBulkCString(c, "recorded-first-entry-id")
+	addReplyStreamID(c, &s.firstID)
+
+	if !full {
+		addReplyBulkCString(c, "groups")
+		if s.cgroups != nil {
+			addReplyLongLong(c, int(raxSize(s.cgroups)))
+		} else {
+			addReplyLongLong(c, 0)
+		}
+
+		start, end := streamID{}, streamID{math.MaxUint64, math.MaxUint64}
+		addReplyBulkCString(c, "first-entry")
+		if streamReplyWithRange(c, s, &start, &end, 1, false, nil, nil, streamRwrRawEntries) == 0 {
+			addReplyNull(c)
+		}
+		addReplyBulkCString(c, "last-entry")
+		if streamReplyWithRange(c, s, &start, &end, 1, true, nil, nil, streamRwrRawEntries) == 0 {
+			addReplyNull(c)
+		}
+		return
+	}
+
+	addReplyBulkCString(c, "entries")
+	streamReplyWithRange(c, s, nil, nil, count, false, nil, nil, 0)
+
+	addReplyBulkCString(c, "groups")
+	if s.cgroups == nil {
+		addReplyArrayLen(c, 0)
+		return
+	}
+	addReplyArrayLen(c, int(raxSize(s.cgroups)))
+	var riCgroups raxIterator
+	raxStart(&riCgroups, s.cgroups)
+	raxSeek(&riCgroups, "^", nil)
+	for raxNext(&riCgroups) {
+		cg := (*streamCG)(riCgroups.data)
+		addReplyMapLen(c, 7)
+		addReplyBulkCString(c, "name")
+		addReplyBulkBuffer(c, riCgroups.key, len(riCgroups.key))
+		addReplyBulkCString(c, "last-delivered-id")
+		addReplyStreamID(c, &cg.lastID)
+		addReplyBulkCString(c, "entries-read")
+		addReplyEntriesRead(c, cg)
+		addReplyBulkCString(c, "lag")
+		streamReplyWithCGLag(c, s, cg)
+		addReplyBulkCString(c, "pel-count")
+		addReplyLongLong(c, int(raxSize(cg.pel)))
+
+		// 消费组的PEL
+		addReplyBulkCString(c, "pending")
+		var arraylenCgPel int64
+		arrayptrCgPel := addReplyDeferredLen(c)
+		var riCgPel raxIterator
+		raxStart(&riCgPel, cg.pel)
+		raxSeek(&riCgPel, "^", nil)
+		for raxNext(&riCgPel) && (count == 0 || arraylenCgPel < count) {
+			nack := (*streamNACK)(riCgPel.data)
+			var id streamID
+			streamDecodeID(riCgPel.key, &id)
+			addReplyArrayLen(c, 4)
+			addReplyStreamID(c, &id)
+			name := nack.consumer.name.BufData(0)
+			addReplyBulkBuffer(c, name, len(name))
+			addReplyLongLong(c, int(nack.deliveryTime))
+			addReplyLongLong(c, int(nack.deliveryCount))
+			arraylenCgPel++
+		}
+		setDeferredArrayLen(c, arrayptrCgPel, int(arraylenCgPel))
+		raxStop(&riCgPel)
+
+		// consumer以及它们的PEL
+		addReplyBulkCString(c, "consumers")
+		addReplyArrayLen(c, int(raxSize(cg.consumers)))
+		var riConsumers raxIterator
+		raxStart(&riConsumers, cg.consumers)
+		raxSeek(&riConsumers, "^", nil)
+		for raxNext(&riConsumers) {
+			consumer := (*streamConsumer)(riConsumers.data)
+			addReplyMapLen(c, 4)
+			addReplyBulkCString(c, "name")
+			name := consumer.name.BufData(0)
+			addReplyBulkBuffer(c, name, len(name))
+			addReplyBulkCString(c, "seen-time")
+			addReplyLongLong(c, int(consumer.seenTime))
+			addReplyBulkCString(c, "pel-count")
+			addReplyLongLong(c, int(raxSize(consumer.pel)))
+
+			addReplyBulkCString(c, "pending")
+			var arraylenCpel int64
+			arrayptrCpel := addReplyDeferredLen(c)
+			var riCpel raxIterator
+			raxStart(&riCpel, consumer.pel)
+			raxSeek(&riCpel, "^", nil)
+			for raxNext(&riCpel) && (count == 0 || arraylenCpel < count) {
+				nack := (*streamNACK)(riCpel.data)
+				var id streamID
+				streamDecodeID(riCpel.key, &id)
+				addReplyArrayLen(c, 3)
+				addReplyStreamID(c, &id)
+				addReplyLongLong(c, int(nack.deliveryTime))
+				addReplyLongLong(c, int(nack.deliveryCount))
+				arraylenCpel++
+			}
+			setDeferredArrayLen(c, arrayptrCpel, int(arraylenCpel))
+			raxStop(&riCpel)
+		}
+		raxStop(&riConsumers)
+	}
+	raxStop(&riCgroups)
+}
+
+// XINFO CONSUMERS key group
+// XINFO GROUPS key
+// XINFO STREAM key [FULL [COUNT count]]
+func xinfoCommand(c *Client) {
+	if util.StrCaseCmp(argvBytes(c.argv[1]), "help") {
+		if c.argc != 2 {
+			addReplySubcommandSyntaxError(c)
+			return
+		}
+		addReplyHelp(c, []string{
+			"CONSUMERS <key> <groupname>",
+			"    Show consumers of <groupname>.",
+			"GROUPS <key>",
+			"    Show the stream consumer groups.",
+			"STREAM <key> [FULL [COUNT <count>]",
+			"    Show information about the stream.",
+		})
+		return
+	}
+
+	// 除了HELP都需要key
+	if c.argc < 3 {
+		addReplySubcommandSyntaxError(c)
+		return
+	}
+	opt := argvBytes(c.argv[1])
+	key := c.argv[2]
+	o := lookupKeyReadOrReply(c, key, shared.noKeyErr)
+	if o == nil || o.checkType(c, ObjStream) {
+		return
+	}
+	s := (*stream)(o.ptr)
+
+	if util.StrCaseCmp(opt, "consumers") && c.argc == 4 {
+		cg := streamLookupCG(s, *(*sds.SDS)(c.argv[3].ptr))
+		if cg == nil {
+			addReplyErrorFormat(c, "-NOGROUP No such consumer group '%s' for key name '%s'", argvBytes(c.argv[3]), argvBytes(key))
+			return
+		}
+
+		addReplyArrayLen(c, int(raxSize(cg.consumers)))
+		var ri raxIterator
+		raxStart(&ri, cg.consumers)
+		raxSeek(&ri, "^", nil)
+		now := mstime()
+		for raxNext(&ri) {
+			consumer := (*streamConsumer)(ri.data)
+			idle := now - consumer.seenTime
+			if idle < 0 {
+				idle = 0
+			}
+			addReplyMapLen(c, 3)
+			addReplyBulkCString(c, "name")
+			name := consumer.name.BufData(0)
+			addReplyBulkBuffer(c, name, len(name))
+			addReplyBulkCString(c, "pending")
+			addReplyLongLong(c, int(raxSize(consumer.pel)))
+			addReplyBulkCString(c, "idle")
+			addReplyLongLong(c, int(idle))
+		}
+		raxStop(&ri)
+	} else if util.StrCaseCmp(opt, "groups") && c.argc == 3 {
+		if s.cgroups == nil {
+			addReplyArrayLen(c, 0)
+			return
+		}
+
+		addReplyArrayLen(c, int(raxSize(s.cgroups)))
+		var ri raxIterator
+		raxStart(&ri, s.cgroups)
+		raxSeek(&ri, "^", nil)
+		for raxNext(&ri) {
+			cg := (*streamCG)(ri.data)
+			addReplyMapLen(c, 6)
+			addReplyBulkCString(c, "name")
+			addReplyBulkBuffer(c, ri.key, len(ri.key))
+			addReplyBulkCString(c, "consumers")
+			addReplyLongLong(c, int(raxSize(cg.consumers)))
+			addReplyBulkCString(c, "pending")
+			addReplyLongLong(c, int(raxSize(cg.pel)))
+			addReplyBulkCString(c, "last-delivered-id")
+			addReplyStreamID(c, &cg.lastID)
+			addReplyBulkCString(c, "entries-read")
+			addReplyEntriesRead(c, cg)
+			addReplyBulkCString(c, "lag")
+			streamReplyWithCGLag(c, s, cg)
+		}
+		raxStop(&ri)
+	} else if util.StrCaseCmp(opt, "stream") {
+		xinfoReplyWithStreamInfo(c, s)
+	} else {
+		addReplySubcommandSyntaxError(c)
+	}
+}
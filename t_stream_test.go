@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStreamAppendAndTrim(t *testing.T) {
+	server = &RedisServer{hz: 1, streamNodeMaxBytes: 4096, streamNodeMaxEntries: 10}
+
+	s := &stream{rax: raxNew()}
+	for i := 1; i <= 95; i++ {
+		argv := []*robj{createStringObject("f"), createStringObject(fmt.Sprint(i))}
+		if i%2 == 0 {
+			argv = append(argv, createStringObject("g"), createStringObject("x"))
+		}
+		id := streamID{uint64(i), 0}
+		if streamAppendItem(s, argv, int64(len(argv)/2), nil, &id, true) != C_OK {
+			t.Fatalf("append %d failed", i)
+		}
+	}
+	if s.length != 95 || raxSize(s.rax) != 10 {
+		t.Fatalf("expect 95 entries in 10 nodes, got %d in %d", s.length, raxSize(s.rax))
+	}
+
+	var si streamIterator
+	var id streamID
+	var numfields int64
+	streamIteratorStart(&si, s, &streamID{20, 0}, &streamID{30, 0}, true)
+	expect := uint64(30)
+	for streamIteratorGetID(&si, &id, &numfields) {
+		field, value := streamIteratorGetField(&si)
+		if id.ms != expect || string(field) != "f" || string(value) != fmt.Sprint(expect) {
+			t.Fatalf("expect %d, got %d %s=%s", expect, id.ms, field, value)
+		}
+		for numfields--; numfields > 0; numfields-- {
+			streamIteratorGetField(&si)
+		}
+		expect--
+	}
+	streamIteratorStop(&si)
+	if expect != 19 {
+		t.Fatalf("reverse iteration stopped at %d", expect)
+	}
+
+	if !streamDeleteItem(s, &streamID{1, 0}) || streamDeleteItem(s, &streamID{1, 0}) {
+		t.Fatal("delete 1-0 failed")
+	}
+	streamGetEdgeID(s, true, true, &s.firstID)
+	if s.firstID.ms != 2 {
+		t.Fatalf("expect first id 2-0, got %d", s.firstID.ms)
+	}
+
+	// 近似裁剪只删除整个节点，精确裁剪会标记删除节点中的元素
+	args := streamAddTrimArgs{trimStrategy: trimStrategyMaxLen, maxlen: 75, approxTrim: true}
+	if deleted := streamTrim(s, &args); deleted != 19 || s.length != 75 || s.firstID.ms != 21 {
+		t.Fatalf("approx trim: deleted %d, length %d, first %d", deleted, s.length, s.firstID.ms)
+	}
+	args = streamAddTrimArgs{trimStrategy: trimStrategyMinID, minid: streamID{25, 0}}
+	if deleted := streamTrim(s, &args); deleted != 4 || s.length != 71 || s.firstID.ms != 25 {
+		t.Fatalf("minid trim: deleted %d, length %d, first %d", deleted, s.length, s.firstID.ms)
+	}
+}
+
+// streamIdleRe 匹配XPENDING和XINFO CONSUMERS回复中的空闲时间，它和测试运行的快慢有关
+var streamIdleRe = regexp.MustCompile(`((?:\[\d+-\d+ \w+ )|(?:idle )):\d+`)
+
+// testStreamRun 和testRun一样，但是比较之前把空闲时间替换成:idle
+func testStreamRun(t *testing.T, c *Client, cases []testCase) {
+	t.Helper()
+	for _, tc := range cases {
+		reply := streamIdleRe.ReplaceAllString(testCommand(c, strings.Fields(tc.cmd)...), "$1:idle")
+		if reply != tc.expect {
+			t.Errorf("%s: expect %q, got %q", tc.cmd, tc.expect, reply)
+		}
+	}
+}
+
+func TestStreamConsumerGroups(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testStreamRun(t, c, []testCase{
+		{"xgroup create s g $", "-ERR The XGROUP subcommand requires the key to exist. " +
+			"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."},
+		{"xgroup create s g $ mkstream", "+OK"},
+		{"xgroup create s g $", "-BUSYGROUP Consumer Group name already exists"},
+		{"xadd s 1-0 a 1", "1-0"},
+		{"xadd s 2-0 b 2", "2-0"},
+		{"xadd s 3-0 c 3", "3-0"},
+		{"xgroup create s g2 0", "+OK"},
+		{"xgroup createconsumer s g alice", ":1"},
+		{"xgroup createconsumer s g alice", ":0"},
+		{"xgroup createconsumer s nog alice", "-NOGROUP No such consumer group 'nog' for key name 's'"},
+
+		// >读取新消息，具体的ID读取消费者自己的PEL
+		{"xreadgroup group g alice streams s >", "[[s [[1-0 [a 1]] [2-0 [b 2]] [3-0 [c 3]]]]]"},
+		{"xreadgroup group g alice streams s >", "(nil)"},
+		{"xreadgroup group g alice streams s 1", "[[s [[2-0 [b 2]] [3-0 [c 3]]]]]"},
+		{"xreadgroup group g bob streams s 0", "[[s []]]"},
+		{"xreadgroup group g2 alice count 2 streams s >", "[[s [[1-0 [a 1]] [2-0 [b 2]]]]]"},
+		{"xreadgroup group g2 bob streams s >", "[[s [[3-0 [c 3]]]]]"},
+		{"xreadgroup group g2 alice streams s 0", "[[s [[1-0 [a 1]] [2-0 [b 2]]]]]"},
+		{"xreadgroup group nog alice streams s >",
+			"-NOGROUP No such key 's' or consumer group 'nog' in XREADGROUP with GROUP option"},
+
+		{"xpending s g2", "[:3 1-0 3-0 [[alice 2] [bob 1]]]"},
+		{"xpending s g2 - + 10", "[[1-0 alice :idle :2] [2-0 alice :idle :2] [3-0 bob :idle :1]]"},
+		{"xpending s g2 - + 1", "[[1-0 alice :idle :2]]"},
+		{"xpending s g2 (1-0 + 10 bob", "[[3-0 bob :idle :1]]"},
+		{"xpending s g2 idle 100000 - + 10", "[]"},
+		{"xpending s g2 - + 0", "[]"},
+		{"xpending s nog", "-NOGROUP No such key 's' or consumer group 'nog'"},
+
+		{"xack s g2 1-0 9-0", ":1"},
+		{"xack s g2 1-0", ":0"},
+		{"xack s nog 1-0", ":0"},
+		{"xack s g2 bad", "-ERR Invalid stream ID specified as stream command argument"},
+		{"xpending s g2", "[:2 2-0 3-0 [[alice 1] [bob 1]]]"},
+	})
+}
+
+func TestStreamClaim(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testStreamRun(t, c, []testCase{
+		{"xadd s 1-0 a 1", "1-0"},
+		{"xadd s 2-0 b 2", "2-0"},
+		{"xadd s 3-0 c 3", "3-0"},
+		{"xgroup create s g 0", "+OK"},
+		{"xreadgroup group g alice streams s >", "[[s [[1-0 [a 1]] [2-0 [b 2]] [3-0 [c 3]]]]]"},
+
+		// JUSTID不增加投递次数
+		{"xclaim s g bob 0 2-0", "[[2-0 [b 2]]]"},
+		{"xclaim s g bob 0 2-0 justid", "[2-0]"},
+		{"xclaim s g carol 1000000 2-0", "[]"},
+		{"xclaim s g carol 0 9-0", "[]"},
+		{"xclaim s g carol 0 9-0 force", "[]"},
+		{"xclaim s g carol 0 3-0 retrycount 5", "[[3-0 [c 3]]]"},
+		{"xclaim s g carol 0 2-0 badopt", "-ERR Unrecognized XCLAIM option 'badopt'"},
+		{"xpending s g - + 10", "[[1-0 alice :idle :1] [2-0 bob :idle :2] [3-0 carol :idle :5]]"},
+
+		// XAUTOCLAIM返回下一次扫描的起点，0-0表示扫描完了
+		{"xautoclaim s g dave 0 0 count 2", "[3-0 [[1-0 [a 1]] [2-0 [b 2]]] []]"},
+		{"xautoclaim s g dave 0 3-0 justid", "[0-0 [3-0] []]"},
+		{"xautoclaim s g dave 1000000 0", "[0-0 [] []]"},
+		{"xautoclaim s g dave 0 0 count 0", "-ERR COUNT must be > 0"},
+		{"xpending s g", "[:3 1-0 3-0 [[dave 3]]]"},
+
+		// 已经被删除的消息从PEL中移除并返回它们的ID
+		{"xdel s 3-0", ":1"},
+		{"xautoclaim s g erin 0 0", "[0-0 [[1-0 [a 1]] [2-0 [b 2]]] [3-0]]"},
+		{"xpending s g", "[:2 1-0 2-0 [[erin 2]]]"},
+	})
+}
+
+func TestStreamInfoAndGroupAdmin(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testStreamRun(t, c, []testCase{
+		{"xadd s 1-0 a 1", "1-0"},
+		{"xadd s 2-0 b 2", "2-0"},
+		{"xgroup create s g 0", "+OK"},
+		{"xgroup create s g2 $", "+OK"},
+		{"xreadgroup group g alice count 1 streams s >", "[[s [[1-0 [a 1]]]]]"},
+		{"xgroup createconsumer s g bob", ":1"},
+
+		{"xinfo groups s", "[[name g consumers :2 pending :1 last-delivered-id 1-0 entries-read :1 lag :1] " +
+			"[name g2 consumers :0 pending :0 last-delivered-id 2-0 entries-read (nil) lag :0]]"},
+		{"xinfo consumers s g", "[[name alice pending :1 idle :idle] [name bob pending :0 idle :idle]]"},
+		{"xinfo consumers s nog", "-NOGROUP No such consumer group 'nog' for key name 's'"},
+		{"xinfo stream nokey", "-ERR no such key"},
+
+		// 删除有未确认消息的消费者返回它的PEL大小
+		{"xgroup delconsumer s g alice", ":1"},
+		{"xgroup delconsumer s g alice", ":0"},
+		{"xinfo groups s", "[[name g consumers :1 pending :0 last-delivered-id 1-0 entries-read :1 lag :1] " +
+			"[name g2 consumers :0 pending :0 last-delivered-id 2-0 entries-read (nil) lag :0]]"},
+		{"xgroup setid s g 0", "+OK"},
+		{"xreadgroup group g bob streams s >", "[[s [[1-0 [a 1]] [2-0 [b 2]]]]]"},
+		{"xgroup setid s nog 0", "-NOGROUP No such consumer group 'nog' for key name 's'"},
+		{"xgroup destroy s g", ":1"},
+		{"xgroup destroy s g", ":0"},
+		{"xinfo groups s", "[[name g2 consumers :0 pending :0 last-delivered-id 2-0 entries-read (nil) lag :0]]"},
+	})
+}
@@ -3,22 +3,27 @@ package main
 import (
 	"github.com/pengdafu/redis-golang/sds"
 	"github.com/pengdafu/redis-golang/util"
+	"math"
+	"strconv"
+	"unsafe"
 )
 
 func getCommand(c *Client) {
 	getGenericCommand(c)
 }
 
-func getGenericCommand(c *Client) {
+// getGenericCommand key不存在时回复null并返回C_OK，类型错误时返回C_ERR
+func getGenericCommand(c *Client) error {
 	var o *robj
 	if o = lookupKeyReadOrReply(c, c.argv[1], shared.null[c.resp]); o == nil {
-		return
+		return C_OK
 	}
 	if o.getType() != ObjString {
 		addReply(c, shared.wrongTypeErr)
-		return
+		return C_ERR
 	}
 	addReplyBulk(c, o)
+	return C_OK
 }
 
 const (
@@ -27,86 +32,157 @@ const (
 	objSetEX
 	objSetPX
 	objSetKeepTTL
+	objSetEXAT
+	objSetPXAT
+	objSetPersist
+	objSetGet
 	objSetNoFlags = 0
 )
 
-func setCommand(c *Client) {
-	flags := objSetNoFlags
-	var expire *robj
-	unit := unitSeconds
-	for i := 3; i < c.argc; i++ {
-		a := (*sds.SDS)(c.argv[i].ptr)
+const (
+	commandGet = iota
+	commandSet
+)
+
+// parseExtendedStringArgumentsOrReply 解析SET和GETEX的可选参数，commandType为commandGet或者commandSet
+func parseExtendedStringArgumentsOrReply(c *Client, flags *int, unit *int, expire **robj, commandType int) error {
+	j := 3
+	if commandType == commandGet {
+		j = 2
+	}
+
+	// 已经设置了其中任意一个过期时间参数
+	const expireFlags = objSetEX | objSetPX | objSetEXAT | objSetPXAT
+
+	for ; j < c.argc; j++ {
+		opt := (*sds.SDS)(c.argv[j].ptr).BufData(0)
 		var next *robj
-		if i != c.argc-1 {
-			next = c.argv[i+1]
-		}
-
-		buf := a.BufData(0)
-		if util.BytesCaseCmp(buf, []byte{'n', 'x'}) && flags&objSetXX == 0 {
-			flags |= objSetNX
-		} else if util.BytesCaseCmp(buf, []byte{'x', 'x'}) && flags&objSetNX == 0 {
-			flags |= objSetXX
-		} else if util.StrCaseCmp(buf, "keepttl") && flags&objSetEX == 0 && flags&objSetPX == 0 {
-			flags |= objSetKeepTTL
-		} else if util.BytesCaseCmp(buf, []byte{'e', 'x'}) && flags&objSetKeepTTL == 0 && flags&objSetPX == 0 && next != nil {
-			flags |= objSetEX
-			expire = next
-			i++
-			unit = unitSeconds
-		} else if util.BytesCaseCmp(buf, []byte{'p', 'x'}) && flags&objSetKeepTTL == 0 && flags&objSetEX == 0 && next != nil {
-			flags |= objSetPX
-			expire = next
-			i++
-			unit = unitMilliSeconds
+		if j != c.argc-1 {
+			next = c.argv[j+1]
+		}
+
+		if util.StrCaseCmp(opt, "nx") && *flags&objSetXX == 0 && commandType == commandSet {
+			*flags |= objSetNX
+		} else if util.StrCaseCmp(opt, "xx") && *flags&objSetNX == 0 && commandType == commandSet {
+			*flags |= objSetXX
+		} else if util.StrCaseCmp(opt, "get") && commandType == commandSet {
+			*flags |= objSetGet
+		} else if util.StrCaseCmp(opt, "keepttl") && *flags&(objSetPersist|expireFlags) == 0 &&
+			commandType == commandSet {
+			*flags |= objSetKeepTTL
+		} else if util.StrCaseCmp(opt, "persist") && *flags&(objSetKeepTTL|expireFlags) == 0 &&
+			commandType == commandGet {
+			*flags |= objSetPersist
+		} else if util.StrCaseCmp(opt, "ex") && *flags&(objSetKeepTTL|objSetPersist|expireFlags) == 0 && next != nil {
+			*flags |= objSetEX
+			*expire = next
+			j++
+		} else if util.StrCaseCmp(opt, "px") && *flags&(objSetKeepTTL|objSetPersist|expireFlags) == 0 && next != nil {
+			*flags |= objSetPX
+			*unit = unitMilliSeconds
+			*expire = next
+			j++
+		} else if util.StrCaseCmp(opt, "exat") && *flags&(objSetKeepTTL|objSetPersist|expireFlags) == 0 && next != nil {
+			*flags |= objSetEXAT
+			*expire = next
+			j++
+		} else if util.StrCaseCmp(opt, "pxat") && *flags&(objSetKeepTTL|objSetPersist|expireFlags) == 0 && next != nil {
+			*flags |= objSetPXAT
+			*unit = unitMilliSeconds
+			*expire = next
+			j++
 		} else {
-			addReply(c, shared.syntaxErr)
-			return
+			addReplyErrorObject(c, shared.syntaxErr)
+			return C_ERR
 		}
 	}
+	return C_OK
+}
+
+// SET <key> <value> [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|KEEPTTL]
+func setCommand(c *Client) {
+	var expire *robj
+	unit := unitSeconds
+	flags := objSetNoFlags
+
+	if parseExtendedStringArgumentsOrReply(c, &flags, &unit, &expire, commandSet) != C_OK {
+		return
+	}
 
 	c.argv[2] = c.argv[2].tryObjectEncoding()
 	setGenericCommand(c, flags, c.argv[1], c.argv[2], expire, unit, nil, nil)
 }
 
+// getExpireMillisecondsOrReply 把过期时间参数转换成毫秒时间戳，EX/PX是相对时间，EXAT/PXAT是绝对时间
+func getExpireMillisecondsOrReply(c *Client, expire *robj, flags int, unit int, milliseconds *int64) error {
+	if expire.getLongLongFromObjectOrReply(c, milliseconds, "") != C_OK {
+		return C_ERR
+	}
+
+	if *milliseconds <= 0 || (unit == unitSeconds && *milliseconds > math.MaxInt64/1000) {
+		// 负数或者乘以1000之后会溢出
+		addReplyErrorFormat(c, "invalid expire time in '%s' command", c.cmd.name)
+		return C_ERR
+	}
+
+	if unit == unitSeconds {
+		*milliseconds *= 1000
+	}
+
+	if flags&(objSetEX|objSetPX) > 0 {
+		*milliseconds += mstime()
+	}
+
+	// 加上当前时间之后溢出了
+	if *milliseconds <= 0 {
+		addReplyErrorFormat(c, "invalid expire time in '%s' command", c.cmd.name)
+		return C_ERR
+	}
+	return C_OK
+}
+
+// setGenericCommand 实现SET及其变种。okReply和abortReply为nil时分别回复OK和null，
+// 指定了GET时回复key原来的值
 func setGenericCommand(c *Client, flags int, key, val, expire *robj, unit int, okReply, abortReply *robj) {
-	milliseconds := int64(0)
-	if expire != nil {
-		if err := expire.getLongLongFromObjectOrReply(c, &milliseconds, ""); err != C_OK {
-			return
-		}
-		if milliseconds <= 0 {
-			addReplyErrorFormat(c, "invalid expire time in %s", c.cmd.name)
+	var milliseconds int64
+	if expire != nil && getExpireMillisecondsOrReply(c, expire, flags, unit, &milliseconds) != C_OK {
+		return
+	}
+
+	if flags&objSetGet > 0 {
+		if getGenericCommand(c) != C_OK {
 			return
 		}
-		if unit == unitSeconds {
-			milliseconds *= 1000
-		}
 	}
 
-	if (flags&objSetNX > 0 && c.db.lookupKeyWrite(key) != nil) ||
-		(flags&objSetXX > 0 && c.db.lookupKeyWrite(key) == nil) {
-		reply := abortReply
-		if reply == nil {
-			reply = shared.null[c.resp]
+	found := c.db.lookupKeyWrite(key) != nil
+	if (flags&objSetNX > 0 && found) ||
+		(flags&objSetXX > 0 && !found) {
+		if flags&objSetGet == 0 {
+			reply := abortReply
+			if reply == nil {
+				reply = shared.null[c.resp]
+			}
+			addReply(c, reply)
 		}
-		addReply(c, reply)
 		return
 	}
 
 	c.db.genericSetKey(c, key, val, flags&objSetKeepTTL > 0, true)
 	server.dirty++
-	if expire != nil {
-		c.db.setExpire(c, key, mstime()+milliseconds)
-	}
 	notifyKeySpaceEvent(notifyString, "set", key, c.db.id)
 	if expire != nil {
+		c.db.setExpire(c, key, milliseconds)
 		notifyKeySpaceEvent(notifyGeneric, "expire", key, c.db.id)
 	}
-	reply := okReply
-	if reply == nil {
-		reply = shared.ok
+
+	if flags&objSetGet == 0 {
+		reply := okReply
+		if reply == nil {
+			reply = shared.ok
+		}
+		addReply(c, reply)
 	}
-	addReply(c, reply)
 }
 
 func delCommand(c *Client) {
@@ -134,3 +210,420 @@ func delGenericCommand(c *Client, lazy bool) {
 	}
 	addReplyLongLong(c, numDel)
 }
+
+// checkStringLength 字符串的长度不能超过proto-max-bulk-len
+func checkStringLength(c *Client, size int64) error {
+	if size > server.protoMaxBulkLen {
+		addReplyError(c, "string exceeds maximum allowed size (proto-max-bulk-len)")
+		return C_ERR
+	}
+	return C_OK
+}
+
+// SETRANGE <key> <offset> <value>
+func setrangeCommand(c *Client) {
+	value := (*sds.SDS)(c.argv[3].ptr).BufData(0)
+
+	var offset int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &offset, "") != C_OK {
+		return
+	}
+	if offset < 0 {
+		addReplyError(c, "offset is out of range")
+		return
+	}
+
+	o := c.db.lookupKeyWrite(c.argv[1])
+	if o == nil {
+		// key不存在并且value为空，什么都不做
+		if len(value) == 0 {
+			addReply(c, shared.czero)
+			return
+		}
+
+		if checkStringLength(c, offset+int64(len(value))) != C_OK {
+			return
+		}
+
+		o = createObject(ObjString, sds.Empty())
+		c.db.dbAdd(c.argv[1], o)
+	} else {
+		if o.checkType(c, ObjString) {
+			return
+		}
+
+		// value为空时返回原来字符串的长度
+		olen := o.stringObjectLen()
+		if len(value) == 0 {
+			addReplyLongLong(c, olen)
+			return
+		}
+
+		if checkStringLength(c, offset+int64(len(value))) != C_OK {
+			return
+		}
+
+		// 对象是共享的或者是编码过的，复制一份
+		o = c.db.dbUnshareStringValue(c.argv[1], o)
+	}
+
+	s := sds.GrowZero(*(*sds.SDS)(o.ptr), int(offset)+len(value))
+	copy(s.BufData(0)[offset:], value)
+	o.ptr = unsafe.Pointer(&s)
+	signalModifiedKey(c, c.db, c.argv[1])
+	notifyKeySpaceEvent(notifyString, "setrange", c.argv[1], c.db.id)
+	server.dirty++
+	addReplyLongLong(c, sds.Len(s))
+}
+
+// GETRANGE <key> <start> <end>
+func getrangeCommand(c *Client) {
+	var start, end int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &start, "") != C_OK ||
+		c.argv[3].getLongLongFromObjectOrReply(c, &end, "") != C_OK {
+		return
+	}
+
+	var o *robj
+	if o = lookupKeyReadOrReply(c, c.argv[1], shared.emptybulk); o == nil || o.checkType(c, ObjString) {
+		return
+	}
+
+	var str []byte
+	if o.getEncoding() == ObjEncodingInt {
+		str = util.String2Bytes(strconv.Itoa(*(*int)(o.ptr)))
+	} else {
+		str = (*sds.SDS)(o.ptr).BufData(0)
+	}
+	strlen := int64(len(str))
+
+	// 转换负数的索引
+	if start < 0 && end < 0 && start > end {
+		addReply(c, shared.emptybulk)
+		return
+	}
+	if start < 0 {
+		start = strlen + start
+	}
+	if end < 0 {
+		end = strlen + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= strlen {
+		end = strlen - 1
+	}
+
+	// 此时end >= 0 && end < strlen，只有start > end时结果为空
+	if start > end || strlen == 0 {
+		addReply(c, shared.emptybulk)
+	} else {
+		addReplyBulkBuffer(c, str[start:], int(end-start+1))
+	}
+}
+
+// incrDecrCommand 实现INCR/DECR/INCRBY/DECRBY
+func incrDecrCommand(c *Client, incr int64) {
+	o := c.db.lookupKeyWrite(c.argv[1])
+	if o != nil && o.checkType(c, ObjString) {
+		return
+	}
+
+	var value int64
+	if o.getLongLongFromObjectOrReply(c, &value, "") != C_OK {
+		return
+	}
+
+	oldvalue := value
+	if (incr < 0 && oldvalue < 0 && incr < (math.MinInt64-oldvalue)) ||
+		(incr > 0 && oldvalue > 0 && incr > (math.MaxInt64-oldvalue)) {
+		addReplyError(c, "increment or decrement would overflow")
+		return
+	}
+	value += incr
+
+	if o != nil && o.refCount == 1 && o.getEncoding() == ObjEncodingInt &&
+		(value < 0 || value >= ObjSharedIntegers) {
+		// 没有被共享的整数对象，直接原地修改
+		v := int(value)
+		o.ptr = unsafe.Pointer(&v)
+	} else {
+		n := createStringObjFromLongLongForValue(value)
+		if o != nil {
+			c.db.dbOverwrite(c.argv[1], n)
+		} else {
+			c.db.dbAdd(c.argv[1], n)
+		}
+	}
+	signalModifiedKey(c, c.db, c.argv[1])
+	notifyKeySpaceEvent(notifyString, "incrby", c.argv[1], c.db.id)
+	server.dirty++
+	addReplyLongLong(c, int(value))
+}
+
+// INCR <key>
+func incrCommand(c *Client) {
+	incrDecrCommand(c, 1)
+}
+
+// DECR <key>
+func decrCommand(c *Client) {
+	incrDecrCommand(c, -1)
+}
+
+// INCRBY <key> <increment>
+func incrbyCommand(c *Client) {
+	var incr int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &incr, "") != C_OK {
+		return
+	}
+	incrDecrCommand(c, incr)
+}
+
+// DECRBY <key> <decrement>
+func decrbyCommand(c *Client) {
+	var incr int64
+	if c.argv[2].getLongLongFromObjectOrReply(c, &incr, "") != C_OK {
+		return
+	}
+	// -math.MinInt64会溢出
+	if incr == math.MinInt64 {
+		addReplyError(c, "decrement would overflow")
+		return
+	}
+	incrDecrCommand(c, -incr)
+}
+
+// INCRBYFLOAT <key> <increment>
+func incrbyfloatCommand(c *Client) {
+	o := c.db.lookupKeyWrite(c.argv[1])
+	if o != nil && o.checkType(c, ObjString) {
+		return
+	}
+
+	var value, incr float64
+	if o.getDoubleFromObjectOrReply(c, &value, "") != C_OK ||
+		c.argv[2].getDoubleFromObjectOrReply(c, &incr, "") != C_OK {
+		return
+	}
+
+	value += incr
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		addReplyError(c, "increment would produce NaN or Infinity")
+		return
+	}
+
+	n := createStringObjectFromLongDouble(value, true)
+	if o != nil {
+		c.db.dbOverwrite(c.argv[1], n)
+	} else {
+		c.db.dbAdd(c.argv[1], n)
+	}
+	signalModifiedKey(c, c.db, c.argv[1])
+	notifyKeySpaceEvent(notifyString, "incrbyfloat", c.argv[1], c.db.id)
+	server.dirty++
+	addReplyBulk(c, n)
+}
+
+// APPEND <key> <value>
+func appendCommand(c *Client) {
+	var totlen int
+
+	o := c.db.lookupKeyWrite(c.argv[1])
+	if o == nil {
+		// key不存在，直接创建
+		c.argv[2] = c.argv[2].tryObjectEncoding()
+		c.db.dbAdd(c.argv[1], c.argv[2])
+		c.argv[2].incrRefCount()
+		totlen = c.argv[2].stringObjectLen()
+	} else {
+		if o.checkType(c, ObjString) {
+			return
+		}
+
+		// append是命令参数，一定是sds
+		appendStr := (*sds.SDS)(c.argv[2].ptr).BufData(0)
+		if checkStringLength(c, int64(o.stringObjectLen()+len(appendStr))) != C_OK {
+			return
+		}
+
+		o = c.db.dbUnshareStringValue(c.argv[1], o)
+		s := sds.Catlen(*(*sds.SDS)(o.ptr), appendStr, len(appendStr))
+		o.ptr = unsafe.Pointer(&s)
+		totlen = sds.Len(s)
+	}
+	signalModifiedKey(c, c.db, c.argv[1])
+	notifyKeySpaceEvent(notifyString, "append", c.argv[1], c.db.id)
+	server.dirty++
+	addReplyLongLong(c, totlen)
+}
+
+// STRLEN <key>
+func strlenCommand(c *Client) {
+	var o *robj
+	if o = lookupKeyReadOrReply(c, c.argv[1], shared.czero); o == nil || o.checkType(c, ObjString) {
+		return
+	}
+	addReplyLongLong(c, o.stringObjectLen())
+}
+
+// SETNX <key> <value>
+func setnxCommand(c *Client) {
+	c.argv[2] = c.argv[2].tryObjectEncoding()
+	setGenericCommand(c, objSetNX, c.argv[1], c.argv[2], nil, 0, shared.cone, shared.czero)
+}
+
+// SETEX <key> <seconds> <value>
+func setexCommand(c *Client) {
+	c.argv[3] = c.argv[3].tryObjectEncoding()
+	setGenericCommand(c, objSetEX, c.argv[1], c.argv[3], c.argv[2], unitSeconds, nil, nil)
+}
+
+// PSETEX <key> <milliseconds> <value>
+func psetexCommand(c *Client) {
+	c.argv[3] = c.argv[3].tryObjectEncoding()
+	setGenericCommand(c, objSetPX, c.argv[1], c.argv[3], c.argv[2], unitMilliSeconds, nil, nil)
+}
+
+// GETEX <key> [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|PERSIST]
+func getexCommand(c *Client) {
+	var expire *robj
+	unit := unitSeconds
+	flags := objSetNoFlags
+
+	if parseExtendedStringArgumentsOrReply(c, &flags, &unit, &expire, commandGet) != C_OK {
+		return
+	}
+
+	var o *robj
+	if o = lookupKeyReadOrReply(c, c.argv[1], shared.null[c.resp]); o == nil || o.checkType(c, ObjString) {
+		return
+	}
+
+	// 先检查过期时间是否合法
+	var milliseconds int64
+	if expire != nil && getExpireMillisecondsOrReply(c, expire, flags, unit, &milliseconds) != C_OK {
+		return
+	}
+
+	// 要在设置过期或者删除key之前回复
+	addReplyBulk(c, o)
+
+	if flags&(objSetEXAT|objSetPXAT) > 0 && checkAlreadyExpired(milliseconds) {
+		// 指定的绝对时间已经过去了，直接删除key。删除失败说明key已经不在了，当作已经删除处理
+		deleteFn := dbASyncDelete
+		if !server.lazyFreeLazyExpire {
+			deleteFn = dbSyncDelete
+		}
+		if deleteFn(c.db, c.argv[1]) {
+			aux := shared.del
+			if server.lazyFreeLazyExpire {
+				aux = shared.unlink
+			}
+			rewriteClientCommandVector(c, 2, aux, c.argv[1])
+			signalModifiedKey(c, c.db, c.argv[1])
+			notifyKeySpaceEvent(notifyGeneric, "del", c.argv[1], c.db.id)
+			server.dirty++
+		}
+	} else if expire != nil {
+		c.db.setExpire(c, c.argv[1], milliseconds)
+		signalModifiedKey(c, c.db, c.argv[1])
+		notifyKeySpaceEvent(notifyGeneric, "expire", c.argv[1], c.db.id)
+		server.dirty++
+	} else if flags&objSetPersist > 0 {
+		if c.db.removeExpire(c.argv[1]) {
+			signalModifiedKey(c, c.db, c.argv[1])
+			notifyKeySpaceEvent(notifyGeneric, "persist", c.argv[1], c.db.id)
+			server.dirty++
+		}
+	}
+}
+
+// GETDEL <key>
+func getdelCommand(c *Client) {
+	if getGenericCommand(c) != C_OK {
+		return
+	}
+
+	deleteFn := dbASyncDelete
+	if !server.lazyFreeLazyUserDel {
+		deleteFn = dbSyncDelete
+	}
+	if deleteFn(c.db, c.argv[1]) {
+		aux := shared.del
+		if server.lazyFreeLazyUserDel {
+			aux = shared.unlink
+		}
+		rewriteClientCommandVector(c, 2, aux, c.argv[1])
+		signalModifiedKey(c, c.db, c.argv[1])
+		notifyKeySpaceEvent(notifyGeneric, "del", c.argv[1], c.db.id)
+		server.dirty++
+	}
+}
+
+// GETSET <key> <value>
+func getsetCommand(c *Client) {
+	if getGenericCommand(c) != C_OK {
+		return
+	}
+	c.argv[2] = c.argv[2].tryObjectEncoding()
+	c.db.genericSetKey(c, c.argv[1], c.argv[2], false, true)
+	notifyKeySpaceEvent(notifyString, "set", c.argv[1], c.db.id)
+	server.dirty++
+}
+
+// MGET <key> [<key> ...]
+func mgetCommand(c *Client) {
+	addReplyArrayLen(c, c.argc-1)
+	for j := 1; j < c.argc; j++ {
+		o := c.db.lookupKeyRead(c.argv[j])
+		if o == nil || o.getType() != ObjString {
+			addReplyNull(c)
+		} else {
+			addReplyBulk(c, o)
+		}
+	}
+}
+
+// msetGenericCommand 实现MSET和MSETNX，nx为true时只要有一个key存在就什么都不设置
+func msetGenericCommand(c *Client, nx bool) {
+	if c.argc%2 == 0 {
+		addReplyErrorFormat(c, "wrong number of arguments for '%s' command", c.cmd.name)
+		return
+	}
+
+	if nx {
+		for j := 1; j < c.argc; j += 2 {
+			if c.db.lookupKeyWrite(c.argv[j]) != nil {
+				addReply(c, shared.czero)
+				return
+			}
+		}
+	}
+
+	for j := 1; j < c.argc; j += 2 {
+		c.argv[j+1] = c.argv[j+1].tryObjectEncoding()
+		c.db.genericSetKey(c, c.argv[j], c.argv[j+1], false, true)
+		notifyKeySpaceEvent(notifyString, "set", c.argv[j], c.db.id)
+	}
+	server.dirty += (c.argc - 1) / 2
+	if nx {
+		addReply(c, shared.cone)
+	} else {
+		addReply(c, shared.ok)
+	}
+}
+
+// MSET <key> <value> [<key> <value> ...]
+func msetCommand(c *Client) {
+	msetGenericCommand(c, false)
+}
+
+// MSETNX <key> <value> [<key> <value> ...]
+func msetnxCommand(c *Client) {
+	msetGenericCommand(c, true)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIncrDecrCommands(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"incr n", ":1"},
+		{"incrby n 10", ":11"},
+		{"decr n", ":10"},
+		{"decrby n -5", ":15"},
+		{"get n", "15"},
+		{"set n 9223372036854775806", "+OK"},
+		{"incr n", ":9223372036854775807"},
+		{"incr n", "-ERR increment or decrement would overflow"},
+		{"set n -9223372036854775808", "+OK"},
+		{"decr n", "-ERR increment or decrement would overflow"},
+		{"decrby n -9223372036854775808", "-ERR decrement would overflow"},
+		{"incrby n x", "-ERR value is not an integer or out of range"},
+		{"set s abc", "+OK"},
+		{"incr s", "-ERR value is not an integer or out of range"},
+		{"rpush l a", ":1"},
+		{"incr l", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+
+		{"incrbyfloat f 10.5", "10.5"},
+		{"incrbyfloat f -0.5", "10"},
+		{"incrbyfloat f 5.0e3", "5010"},
+		{"incrbyfloat f 1.1", "5011.1"},
+		{"incrbyfloat f abc", "-ERR value is not a valid float"},
+		{"incrbyfloat f +inf", "-ERR increment would produce NaN or Infinity"},
+		{"get f", "5011.1"},
+	})
+
+	// 带空格的数字不是合法的整数
+	testCommand(c, "set", "s", " 1")
+	if reply := testCommand(c, "incr", "s"); reply != "-ERR value is not an integer or out of range" {
+		t.Fatalf("incr ' 1': unexpected reply %q", reply)
+	}
+
+	// 小整数使用共享对象
+	testRun(t, c, []testCase{{"set small 100", "+OK"}})
+	o := server.db[0].lookupKeyRead(createStringObject("small"))
+	if o != shared.integers[100] {
+		t.Fatal("small integer should use the shared object")
+	}
+}
+
+func TestAppendRangeCommands(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"append s hello", ":5"},
+		{"append s world", ":10"},
+		{"strlen s", ":10"},
+		{"strlen nokey", ":0"},
+		{"set n 123", "+OK"},
+		{"append n 4", ":4"},
+		{"get n", "1234"},
+		{"strlen n", ":4"},
+
+		// 负数下标和越界
+		{"getrange s 0 4", "hello"},
+		{"getrange s -5 -1", "world"},
+		{"getrange s -100 2", "hel"},
+		{"getrange s 5 100", "world"},
+		{"getrange s 8 2", ""},
+		{"getrange s 20 30", ""},
+		{"getrange nokey 0 -1", ""},
+		{"set n 12345", "+OK"},
+		{"getrange n 1 -2", "234"},
+
+		{"setrange s 5 WORLD", ":10"},
+		{"get s", "helloWORLD"},
+		{"setrange s 12 !", ":13"},
+		{"getrange s 10 12", "\x00\x00!"},
+		{"setrange n 0 9", ":5"},
+		{"get n", "92345"},
+		{"setrange new 2 ab", ":4"},
+		{"get new", "\x00\x00ab"},
+		{"setrange s -1 x", "-ERR offset is out of range"},
+		{"rpush l a", ":1"},
+		{"append l a", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"setrange l 0 a", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+	})
+
+	// value为空时不会创建key
+	if reply := testCommand(c, "setrange", "empty", "5", ""); reply != ":0" {
+		t.Fatalf("setrange empty: expect :0, got %q", reply)
+	}
+	testRun(t, c, []testCase{{"exists empty", ":0"}})
+
+	server.protoMaxBulkLen = 16
+	testRun(t, c, []testCase{
+		{"setrange s 16 x", "-ERR string exceeds maximum allowed size (proto-max-bulk-len)"},
+		{"append s " + strings.Repeat("x", 4), "-ERR string exceeds maximum allowed size (proto-max-bulk-len)"},
+		{"setrange s 15 x", ":16"},
+	})
+}
+
+func TestGetexCommand(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"set k v", "+OK"},
+		{"getex k ex 100", "v"},
+		{"ttl k", ":100"},
+		{"getex k persist", "v"},
+		{"ttl k", ":-1"},
+		{"getex k pxat 1", "v"},
+		{"exists k", ":0"},
+		{"getex k exat 1", "(nil)"},
+		{"set k v", "+OK"},
+		{"getex k ex 10 persist", "-ERR syntax error"},
+		{"getex nokey persist", "(nil)"},
+	})
+}
+
+func TestSetOptions(t *testing.T) {
+	testServerInit()
+	c := testClient()
+	testRun(t, c, []testCase{
+		{"set k v1 get", "(nil)"},
+		{"set k v2 get", "v1"},
+		{"set k v3 nx get", "v2"},
+		{"get k", "v2"},
+		{"set n v nx get", "(nil)"},
+		{"get n", "v"},
+		{"set x v xx get", "(nil)"},
+		{"exists x", ":0"},
+		{"set k v4 xx get", "v2"},
+		{"rpush l a", ":1"},
+		{"set l v get", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"lrange l 0 -1", "[a]"},
+
+		{"set k v ex 100", "+OK"},
+		{"ttl k", ":100"},
+		{"set k v keepttl", "+OK"},
+		{"ttl k", ":100"},
+		{"set k v", "+OK"},
+		{"ttl k", ":-1"},
+		{"set k v exat 4102444800", "+OK"},
+		{"expiretime k", ":4102444800"},
+		{"set k v pxat 4102444800123", "+OK"},
+		{"pexpiretime k", ":4102444800123"},
+		{"set k v pxat 1 get", "v"},
+		{"exists k", ":0"},
+
+		{"set k v ex 0", "-ERR invalid expire time in 'set' command"},
+		{"set k v px -1", "-ERR invalid expire time in 'set' command"},
+		{"set k v ex 9223372036854775807", "-ERR invalid expire time in 'set' command"},
+		{"set k v ex 10 px 10", "-ERR syntax error"},
+		{"set k v ex 10 keepttl", "-ERR syntax error"},
+		{"set k v nx xx", "-ERR syntax error"},
+		{"set k v persist", "-ERR syntax error"},
+		{"set k v ex", "-ERR syntax error"},
+		{"set k v exat x", "-ERR value is not an integer or out of range"},
+
+		{"setex k 0 v", "-ERR invalid expire time in 'setex' command"},
+		{"psetex k -5 v", "-ERR invalid expire time in 'psetex' command"},
+		{"set k v", "+OK"},
+		{"getex k ex 0", "-ERR invalid expire time in 'getex' command"},
+	})
+}
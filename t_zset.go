@@ -1 +1,2916 @@
 package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/pengdafu/redis-golang/adlist"
+	"github.com/pengdafu/redis-golang/dict"
+	"github.com/pengdafu/redis-golang/listpack"
+	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"unsafe"
+)
+
+/*-----------------------------------------------------------------------------
+ * Skiplist implementation of the low level API
+ *----------------------------------------------------------------------------*/
+
+const (
+	zskiplistMaxLevel = 32   // 2^64 个元素足够了
+	zskiplistP        = 0.25 // Skiplist P = 1/4
+)
+
+type zskiplistLevel struct {
+	forward *zskiplistNode
+	span    int // 到forward节点跨越了多少个节点，用来计算rank
+}
+
+type zskiplistNode struct {
+	ele      sds.SDS
+	score    float64
+	backward *zskiplistNode
+	level    []zskiplistLevel
+}
+
+type zskiplist struct {
+	header, tail *zskiplistNode
+	length       int
+	level        int
+}
+
+// zset 同时使用dict和skiplist，dict用来O(1)获取member的score，
+// skiplist用来做排序和范围查询，dict的val指向skiplist节点的score
+type zset struct {
+	dict *dict.Dict
+	zsl  *zskiplist
+}
+
+func zslCreateNode(level int, score float64, ele sds.SDS) *zskiplistNode {
+	return &zskiplistNode{
+		ele:   ele,
+		score: score,
+		level: make([]zskiplistLevel, level),
+	}
+}
+
+func zslCreate() *zskiplist {
+	zsl := new(zskiplist)
+	zsl.level = 1
+	zsl.length = 0
+	zsl.header = zslCreateNode(zskiplistMaxLevel, 0, sds.SDS{})
+	zsl.header.backward = nil
+	zsl.tail = nil
+	return zsl
+}
+
+// zslRandomLevel 返回新节点的层数，返回值在1到zskiplistMaxLevel之间，
+// 越高的层数出现的概率越低(幂律分布)
+func zslRandomLevel() int {
+	level := 1
+	for rand.Float64() < zskiplistP {
+		level++
+	}
+	if level < zskiplistMaxLevel {
+		return level
+	}
+	return zskiplistMaxLevel
+}
+
+// zslLessThan 判断节点x是否排在(score, ele)之前
+func zslLessThan(x *zskiplistNode, score float64, ele sds.SDS) bool {
+	return x.score < score || (x.score == score && sds.Cmp(x.ele, ele) < 0)
+}
+
+// zslInsert 插入一个新节点，调用者需要保证ele不在skiplist中，
+// skiplist会直接持有ele
+func zslInsert(zsl *zskiplist, score float64, ele sds.SDS) *zskiplistNode {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	var rank [zskiplistMaxLevel]int
+
+	if math.IsNaN(score) {
+		panic("zslInsert with NaN score")
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i == zsl.level-1 {
+			rank[i] = 0
+		} else {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && zslLessThan(x.level[i].forward, score, ele) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := zslRandomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+	x = zslCreateNode(level, score, ele)
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+	return x
+}
+
+func zslDeleteNode(zsl *zskiplist, x *zskiplistNode, update []*zskiplistNode) {
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+// zslDelete 删除score和ele都匹配的节点，node不为nil时通过node返回被删除的节点，
+// 否则节点直接被释放
+func zslDelete(zsl *zskiplist, score float64, ele sds.SDS, node **zskiplistNode) bool {
+	var update [zskiplistMaxLevel]*zskiplistNode
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslLessThan(x.level[i].forward, score, ele) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x != nil && score == x.score && sds.Cmp(x.ele, ele) == 0 {
+		zslDeleteNode(zsl, x, update[:])
+		if node != nil {
+			*node = x
+		}
+		return true
+	}
+	return false
+}
+
+// zslUpdateScore 更新ele的score，调用者需要保证curscore就是ele当前的score。
+// 如果更新后节点的位置不变，直接原地修改score，否则删除后重新插入
+func zslUpdateScore(zsl *zskiplist, curscore float64, ele sds.SDS, newscore float64) *zskiplistNode {
+	var update [zskiplistMaxLevel]*zskiplistNode
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslLessThan(x.level[i].forward, curscore, ele) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || curscore != x.score || sds.Cmp(x.ele, ele) != 0 {
+		panic("zslUpdateScore: element not found")
+	}
+
+	if (x.backward == nil || x.backward.score < newscore) &&
+		(x.level[0].forward == nil || x.level[0].forward.score > newscore) {
+		x.score = newscore
+		return x
+	}
+
+	zslDeleteNode(zsl, x, update[:])
+	newnode := zslInsert(zsl, newscore, x.ele)
+	x.ele = sds.SDS{}
+	return newnode
+}
+
+// zslGetRank 返回(score, ele)的排名，从1开始，找不到返回0
+func zslGetRank(zsl *zskiplist, score float64, ele sds.SDS) int {
+	rank := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.score < score ||
+				(x.level[i].forward.score == score && sds.Cmp(x.level[i].forward.ele, ele) <= 0)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+
+		if x != zsl.header && sds.Cmp(x.ele, ele) == 0 {
+			return rank
+		}
+	}
+	return 0
+}
+
+// zslGetElementByRank 根据排名获取节点，rank从1开始
+func zslGetElementByRank(zsl *zskiplist, rank int) *zskiplistNode {
+	traversed := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// zrangespec 表示score的范围，minex/maxex为true表示开区间
+type zrangespec struct {
+	min, max     float64
+	minex, maxex bool
+}
+
+// zlexrangespec 表示字典序的范围，min/max可以是shared.minString/shared.maxString，
+// 分别表示"-"和"+"
+type zlexrangespec struct {
+	min, max     sds.SDS
+	minex, maxex bool
+}
+
+func zslValueGteMin(value float64, spec *zrangespec) bool {
+	if spec.minex {
+		return value > spec.min
+	}
+	return value >= spec.min
+}
+
+func zslValueLteMax(value float64, spec *zrangespec) bool {
+	if spec.maxex {
+		return value < spec.max
+	}
+	return value <= spec.max
+}
+
+// zslIsInRange 判断zset中是否有元素在range范围内
+func zslIsInRange(zsl *zskiplist, r *zrangespec) bool {
+	if r.min > r.max || (r.min == r.max && (r.minex || r.maxex)) {
+		return false
+	}
+	x := zsl.tail
+	if x == nil || !zslValueGteMin(x.score, r) {
+		return false
+	}
+	x = zsl.header.level[0].forward
+	if x == nil || !zslValueLteMax(x.score, r) {
+		return false
+	}
+	return true
+}
+
+// zslFirstInRange 返回第一个在range范围内的节点，没有返回nil
+func zslFirstInRange(zsl *zskiplist, r *zrangespec) *zskiplistNode {
+	if !zslIsInRange(zsl, r) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !zslValueGteMin(x.level[i].forward.score, r) {
+			x = x.level[i].forward
+		}
+	}
+
+	x = x.level[0].forward
+	if !zslValueLteMax(x.score, r) {
+		return nil
+	}
+	return x
+}
+
+// zslLastInRange 返回最后一个在range范围内的节点，没有返回nil
+func zslLastInRange(zsl *zskiplist, r *zrangespec) *zskiplistNode {
+	if !zslIsInRange(zsl, r) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslValueLteMax(x.level[i].forward.score, r) {
+			x = x.level[i].forward
+		}
+	}
+
+	if !zslValueGteMin(x.score, r) {
+		return nil
+	}
+	return x
+}
+
+// zslDeleteRangeByScore 删除score在range范围内的所有元素，同时从dict中删除
+func zslDeleteRangeByScore(zsl *zskiplist, r *zrangespec, d *dict.Dict) int {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	removed := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !zslValueGteMin(x.level[i].forward.score, r) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	for x != nil && zslValueLteMax(x.score, r) {
+		next := x.level[0].forward
+		zslDeleteNode(zsl, x, update[:])
+		d.Delete(unsafe.Pointer(&x.ele))
+		removed++
+		x = next
+	}
+	return removed
+}
+
+func zslDeleteRangeByLex(zsl *zskiplist, r *zlexrangespec, d *dict.Dict) int {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	removed := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !zslLexValueGteMin(x.level[i].forward.ele, r) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	for x != nil && zslLexValueLteMax(x.ele, r) {
+		next := x.level[0].forward
+		zslDeleteNode(zsl, x, update[:])
+		d.Delete(unsafe.Pointer(&x.ele))
+		removed++
+		x = next
+	}
+	return removed
+}
+
+// zslDeleteRangeByRank 删除排名在[start, end]之间的元素，start和end都从1开始
+func zslDeleteRangeByRank(zsl *zskiplist, start, end int, d *dict.Dict) int {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	traversed, removed := 0, 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span < start {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	traversed++
+	x = x.level[0].forward
+	for x != nil && traversed <= end {
+		next := x.level[0].forward
+		zslDeleteNode(zsl, x, update[:])
+		d.Delete(unsafe.Pointer(&x.ele))
+		removed++
+		traversed++
+		x = next
+	}
+	return removed
+}
+
+// zslParseRangeItem 解析score范围的一端，"("开头表示开区间
+func zslParseRangeItem(item *robj, value *float64, ex *bool) error {
+	if item.getEncoding() == ObjEncodingInt {
+		*value = float64(*(*int)(item.ptr))
+		return C_OK
+	}
+
+	buf := (*sds.SDS)(item.ptr).BufData(0)
+	if len(buf) > 0 && buf[0] == '(' {
+		buf = buf[1:]
+		*ex = true
+	}
+	d, err := strconv.ParseFloat(util.Bytes2String(buf), 64)
+	if (err != nil && !errors.Is(err, strconv.ErrRange)) || math.IsNaN(d) {
+		return C_ERR
+	}
+	*value = d
+	return C_OK
+}
+
+// zslParseRange 解析ZRANGEBYSCORE这类命令的min和max参数
+func zslParseRange(min, max *robj, spec *zrangespec) error {
+	spec.minex, spec.maxex = false, false
+	if zslParseRangeItem(min, &spec.min, &spec.minex) != C_OK ||
+		zslParseRangeItem(max, &spec.max, &spec.maxex) != C_OK {
+		return C_ERR
+	}
+	return C_OK
+}
+
+// zslParseLexRangeItem 解析字典序范围的一端，合法的格式是"+"、"-"、"(xxx"和"[xxx"
+func zslParseLexRangeItem(item *robj, dest *sds.SDS, ex *bool) error {
+	c := (*sds.SDS)(item.ptr).BufData(0)
+	if len(c) == 0 {
+		return C_ERR
+	}
+
+	switch c[0] {
+	case '+':
+		if len(c) != 1 {
+			return C_ERR
+		}
+		*ex = true
+		*dest = shared.maxString
+	case '-':
+		if len(c) != 1 {
+			return C_ERR
+		}
+		*ex = true
+		*dest = shared.minString
+	case '(':
+		*ex = true
+		*dest = sds.NewLen(c[1:])
+	case '[':
+		*ex = false
+		*dest = sds.NewLen(c[1:])
+	default:
+		return C_ERR
+	}
+	return C_OK
+}
+
+func zslParseLexRange(min, max *robj, spec *zlexrangespec) error {
+	if min.getEncoding() == ObjEncodingInt || max.getEncoding() == ObjEncodingInt {
+		return C_ERR
+	}
+
+	if zslParseLexRangeItem(min, &spec.min, &spec.minex) != C_OK ||
+		zslParseLexRangeItem(max, &spec.max, &spec.maxex) != C_OK {
+		return C_ERR
+	}
+	return C_OK
+}
+
+// sdscmplex 和sds.Cmp一样，但是会处理shared.minString和shared.maxString这两个特殊值
+func sdscmplex(a, b sds.SDS) int {
+	if sds.Same(a, b) {
+		return 0
+	}
+	if sds.Same(a, shared.minString) || sds.Same(b, shared.maxString) {
+		return -1
+	}
+	if sds.Same(a, shared.maxString) || sds.Same(b, shared.minString) {
+		return 1
+	}
+	return sds.Cmp(a, b)
+}
+
+func zslLexValueGteMin(value sds.SDS, spec *zlexrangespec) bool {
+	if spec.minex {
+		return sdscmplex(value, spec.min) > 0
+	}
+	return sdscmplex(value, spec.min) >= 0
+}
+
+func zslLexValueLteMax(value sds.SDS, spec *zlexrangespec) bool {
+	if spec.maxex {
+		return sdscmplex(value, spec.max) < 0
+	}
+	return sdscmplex(value, spec.max) <= 0
+}
+
+func zslIsInLexRange(zsl *zskiplist, r *zlexrangespec) bool {
+	cmp := sdscmplex(r.min, r.max)
+	if cmp > 0 || (cmp == 0 && (r.minex || r.maxex)) {
+		return false
+	}
+	x := zsl.tail
+	if x == nil || !zslLexValueGteMin(x.ele, r) {
+		return false
+	}
+	x = zsl.header.level[0].forward
+	if x == nil || !zslLexValueLteMax(x.ele, r) {
+		return false
+	}
+	return true
+}
+
+func zslFirstInLexRange(zsl *zskiplist, r *zlexrangespec) *zskiplistNode {
+	if !zslIsInLexRange(zsl, r) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !zslLexValueGteMin(x.level[i].forward.ele, r) {
+			x = x.level[i].forward
+		}
+	}
+
+	x = x.level[0].forward
+	if !zslLexValueLteMax(x.ele, r) {
+		return nil
+	}
+	return x
+}
+
+func zslLastInLexRange(zsl *zskiplist, r *zlexrangespec) *zskiplistNode {
+	if !zslIsInLexRange(zsl, r) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslLexValueLteMax(x.level[i].forward.ele, r) {
+			x = x.level[i].forward
+		}
+	}
+
+	if !zslLexValueGteMin(x.ele, r) {
+		return nil
+	}
+	return x
+}
+
+/*-----------------------------------------------------------------------------
+ * Listpack-backed sorted set API
+ *----------------------------------------------------------------------------*/
+
+func zzlStrtod(vstr []byte) float64 {
+	if len(vstr) > 127 {
+		vstr = vstr[:127]
+	}
+	d, _ := strconv.ParseFloat(util.Bytes2String(vstr), 64)
+	return d
+}
+
+func zzlGetScore(sptr []byte) float64 {
+	var vstr []byte
+	var vlen int
+	var vlong int64
+
+	if sptr == nil {
+		panic("zzlGetScore with nil sptr")
+	}
+	if !listpack.Get(sptr, &vstr, &vlen, &vlong) {
+		panic("zzlGetScore: invalid listpack entry")
+	}
+	if vstr != nil {
+		return zzlStrtod(vstr)
+	}
+	return float64(vlong)
+}
+
+// listpackGetObject 把listpack中的元素作为一个新的sds返回
+func listpackGetObject(sptr []byte) sds.SDS {
+	var vstr []byte
+	var vlen int
+	var vlong int64
+
+	if sptr == nil {
+		panic("listpackGetObject with nil sptr")
+	}
+	if !listpack.Get(sptr, &vstr, &vlen, &vlong) {
+		panic("listpackGetObject: invalid listpack entry")
+	}
+	if vstr != nil {
+		return sds.NewLen(vstr)
+	}
+	return sds.FromLongLong(vlong)
+}
+
+// zzlCompareElements 比较eptr指向的元素和cstr，返回值同bytes.Compare
+func zzlCompareElements(eptr []byte, cstr []byte) int {
+	var vstr []byte
+	var vlen int
+	var vlong int64
+
+	if !listpack.Get(eptr, &vstr, &vlen, &vlong) {
+		panic("zzlCompareElements: invalid listpack entry")
+	}
+	if vstr == nil {
+		vstr = util.String2Bytes(strconv.FormatInt(vlong, 10))
+	}
+	return bytes.Compare(vstr, cstr)
+}
+
+func zzlLength(zl []byte) int {
+	return listpack.Len(zl) / 2
+}
+
+// zzlNext 移动到下一个(ele, score)对，到达末尾时eptr和sptr都为nil
+func zzlNext(zl []byte, eptr, sptr *[]byte) {
+	var _eptr, _sptr []byte
+	if *eptr == nil || *sptr == nil {
+		panic("zzlNext with nil pointer")
+	}
+
+	_eptr = listpack.Next(zl, *sptr)
+	if _eptr != nil {
+		_sptr = listpack.Next(zl, _eptr)
+		if _sptr == nil {
+			panic("zzlNext: listpack corruption detected")
+		}
+	}
+	*eptr = _eptr
+	*sptr = _sptr
+}
+
+// zzlPrev 移动到上一个(ele, score)对，到达开头时eptr和sptr都为nil
+func zzlPrev(zl []byte, eptr, sptr *[]byte) {
+	var _eptr, _sptr []byte
+	if *eptr == nil || *sptr == nil {
+		panic("zzlPrev with nil pointer")
+	}
+
+	_sptr = listpack.Prev(zl, *eptr)
+	if _sptr != nil {
+		_eptr = listpack.Prev(zl, _sptr)
+		if _eptr == nil {
+			panic("zzlPrev: listpack corruption detected")
+		}
+	}
+	*eptr = _eptr
+	*sptr = _sptr
+}
+
+func zzlFind(zl []byte, ele sds.SDS, score *float64) []byte {
+	eptr := listpack.Index(zl, 0)
+	for eptr != nil {
+		sptr := listpack.Next(zl, eptr)
+		if sptr == nil {
+			panic("zzlFind: listpack corruption detected")
+		}
+
+		if listpack.Compare(eptr, ele.BufData(0)) {
+			if score != nil {
+				*score = zzlGetScore(sptr)
+			}
+			return eptr
+		}
+		eptr = listpack.Next(zl, sptr)
+	}
+	return nil
+}
+
+// zzlDelete 删除eptr指向的元素和它的score
+func zzlDelete(zl []byte, eptr []byte) []byte {
+	p := eptr
+	zl = listpack.Delete(zl, &p)
+	zl = listpack.Delete(zl, &p)
+	return zl
+}
+
+func zzlInsertAt(zl []byte, eptr []byte, ele sds.SDS, score float64) []byte {
+	scorebuf := util.String2Bytes(util.D2String(score))
+
+	if eptr == nil {
+		zl = listpack.Push(zl, ele.BufData(0), listpack.Tail)
+		zl = listpack.Push(zl, scorebuf, listpack.Tail)
+	} else {
+		offset := len(zl) - len(eptr)
+		zl = listpack.Insert(zl, eptr, ele.BufData(0))
+		eptr = zl[offset:]
+
+		sptr := listpack.Next(zl, eptr)
+		if sptr == nil {
+			panic("zzlInsertAt: listpack corruption detected")
+		}
+		zl = listpack.Insert(zl, sptr, scorebuf)
+	}
+	return zl
+}
+
+// zzlInsert 按score和ele的顺序把元素插入到listpack中，调用者需要保证ele不存在
+func zzlInsert(zl []byte, ele sds.SDS, score float64) []byte {
+	eptr := listpack.Index(zl, 0)
+	for eptr != nil {
+		sptr := listpack.Next(zl, eptr)
+		if sptr == nil {
+			panic("zzlInsert: listpack corruption detected")
+		}
+		s := zzlGetScore(sptr)
+
+		if s > score {
+			return zzlInsertAt(zl, eptr, ele, score)
+		} else if s == score {
+			if zzlCompareElements(eptr, ele.BufData(0)) > 0 {
+				return zzlInsertAt(zl, eptr, ele, score)
+			}
+		}
+		eptr = listpack.Next(zl, sptr)
+	}
+	return zzlInsertAt(zl, nil, ele, score)
+}
+
+// zzlIsInRange 判断listpack编码的zset中是否有元素在range范围内
+func zzlIsInRange(zl []byte, r *zrangespec) bool {
+	if r.min > r.max || (r.min == r.max && (r.minex || r.maxex)) {
+		return false
+	}
+
+	p := listpack.Index(zl, -1) // 最后一个score
+	if p == nil {
+		return false
+	}
+	if !zslValueGteMin(zzlGetScore(p), r) {
+		return false
+	}
+
+	p = listpack.Index(zl, 1) // 第一个score
+	if !zslValueLteMax(zzlGetScore(p), r) {
+		return false
+	}
+	return true
+}
+
+func zzlFirstInRange(zl []byte, r *zrangespec) []byte {
+	if !zzlIsInRange(zl, r) {
+		return nil
+	}
+
+	eptr := listpack.Index(zl, 0)
+	for eptr != nil {
+		sptr := listpack.Next(zl, eptr)
+		score := zzlGetScore(sptr)
+		if zslValueGteMin(score, r) {
+			if zslValueLteMax(score, r) {
+				return eptr
+			}
+			return nil
+		}
+		eptr = listpack.Next(zl, sptr)
+	}
+	return nil
+}
+
+func zzlLastInRange(zl []byte, r *zrangespec) []byte {
+	if !zzlIsInRange(zl, r) {
+		return nil
+	}
+
+	eptr := listpack.Index(zl, -2)
+	for eptr != nil {
+		sptr := listpack.Next(zl, eptr)
+		score := zzlGetScore(sptr)
+		if zslValueLteMax(score, r) {
+			if zslValueGteMin(score, r) {
+				return eptr
+			}
+			return nil
+		}
+
+		if sptr = listpack.Prev(zl, eptr); sptr != nil {
+			if eptr = listpack.Prev(zl, sptr); eptr == nil {
+				panic("zzlLastInRange: listpack corruption detected")
+			}
+		} else {
+			eptr = nil
+		}
+	}
+	return nil
+}
+
+func zzlLexValueGteMin(p []byte, spec *zlexrangespec) bool {
+	return zslLexValueGteMin(listpackGetObject(p), spec)
+}
+
+func zzlLexValueLteMax(p []byte, spec *zlexrangespec) bool {
+	return zslLexValueLteMax(listpackGetObject(p), spec)
+}
+
+func zzlIsInLexRange(zl []byte, r *zlexrangespec) bool {
+	cmp := sdscmplex(r.min, r.max)
+	if cmp > 0 || (cmp == 0 && (r.minex || r.maxex)) {
+		return false
+	}
+
+	p := listpack.Index(zl, -2) // 最后一个元素
+	if p == nil {
+		return false
+	}
+	if !zzlLexValueGteMin(p, r) {
+		return false
+	}
+
+	p = listpack.Index(zl, 0) // 第一个元素
+	if !zzlLexValueLteMax(p, r) {
+		return false
+	}
+	return true
+}
+
+func zzlFirstInLexRange(zl []byte, r *zlexrangespec) []byte {
+	if !zzlIsInLexRange(zl, r) {
+		return nil
+	}
+
+	eptr := listpack.Index(zl, 0)
+	for eptr != nil {
+		if zzlLexValueGteMin(eptr, r) {
+			if zzlLexValueLteMax(eptr, r) {
+				return eptr
+			}
+			return nil
+		}
+
+		sptr := listpack.Next(zl, eptr)
+		eptr = listpack.Next(zl, sptr)
+	}
+	return nil
+}
+
+func zzlLastInLexRange(zl []byte, r *zlexrangespec) []byte {
+	if !zzlIsInLexRange(zl, r) {
+		return nil
+	}
+
+	eptr := listpack.Index(zl, -2)
+	for eptr != nil {
+		if zzlLexValueLteMax(eptr, r) {
+			if zzlLexValueGteMin(eptr, r) {
+				return eptr
+			}
+			return nil
+		}
+
+		if sptr := listpack.Prev(zl, eptr); sptr != nil {
+			if eptr = listpack.Prev(zl, sptr); eptr == nil {
+				panic("zzlLastInLexRange: listpack corruption detected")
+			}
+		} else {
+			eptr = nil
+		}
+	}
+	return nil
+}
+
+func zzlDeleteRangeByScore(zl []byte, r *zrangespec, deleted *int) []byte {
+	num := 0
+	if deleted != nil {
+		*deleted = 0
+	}
+
+	eptr := zzlFirstInRange(zl, r)
+	if eptr == nil {
+		return zl
+	}
+
+	// 删除尾部元素后，eptr会指向结束标记，listpack.Next会返回nil
+	for sptr := listpack.Next(zl, eptr); sptr != nil; sptr = listpack.Next(zl, eptr) {
+		if !zslValueLteMax(zzlGetScore(sptr), r) {
+			break
+		}
+		zl = listpack.Delete(zl, &eptr)
+		zl = listpack.Delete(zl, &eptr)
+		num++
+	}
+
+	if deleted != nil {
+		*deleted = num
+	}
+	return zl
+}
+
+func zzlDeleteRangeByLex(zl []byte, r *zlexrangespec, deleted *int) []byte {
+	num := 0
+	if deleted != nil {
+		*deleted = 0
+	}
+
+	eptr := zzlFirstInLexRange(zl, r)
+	if eptr == nil {
+		return zl
+	}
+
+	for sptr := listpack.Next(zl, eptr); sptr != nil; sptr = listpack.Next(zl, eptr) {
+		if !zzlLexValueLteMax(eptr, r) {
+			break
+		}
+		zl = listpack.Delete(zl, &eptr)
+		zl = listpack.Delete(zl, &eptr)
+		num++
+	}
+
+	if deleted != nil {
+		*deleted = num
+	}
+	return zl
+}
+
+// zzlDeleteRangeByRank 删除排名在[start, end]之间的元素，start和end都从1开始
+func zzlDeleteRangeByRank(zl []byte, start, end int, deleted *int) []byte {
+	num := end - start + 1
+	if deleted != nil {
+		*deleted = num
+	}
+	return listpack.DeleteRange(zl, 2*(start-1), 2*num)
+}
+
+/*-----------------------------------------------------------------------------
+ * Common sorted set API
+ *----------------------------------------------------------------------------*/
+
+func zsetLength(zobj *robj) (length int) {
+	if zobj.getEncoding() == ObjEncodingListPack {
+		length = zzlLength(*(*[]byte)(zobj.ptr))
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		length = (*zset)(zobj.ptr).zsl.length
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+	return length
+}
+
+// zsetDup 复制一个zset对象，新对象的编码和原对象相同
+func zsetDup(o *robj) *robj {
+	var zobj *robj
+	if o.getEncoding() == ObjEncodingListPack {
+		zl := append([]byte(nil), *(*[]byte)(o.ptr)...)
+		zobj = createObject(ObjZSet, zl)
+		zobj.setEncoding(ObjEncodingListPack)
+	} else if o.getEncoding() == ObjEncodingSkipList {
+		zobj = createZsetObject()
+		zs := (*zset)(o.ptr)
+		newZs := (*zset)(zobj.ptr)
+		newZs.dict.Expand(zs.dict.Size())
+		// 从后往前复制，每次都插入到skiplist的头部
+		for ln := zs.zsl.tail; ln != nil; ln = ln.backward {
+			ele := sds.Dup(ln.ele)
+			node := zslInsert(newZs.zsl, ln.score, ele)
+			newZs.dict.Add(unsafe.Pointer(&ele), unsafe.Pointer(&node.score))
+		}
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+	return zobj
+}
+
+func zsetConvert(zobj *robj, encoding uint32) {
+	if zobj.getEncoding() == encoding {
+		return
+	}
+
+	if zobj.getEncoding() == ObjEncodingListPack {
+		if encoding != ObjEncodingSkipList {
+			panic("Unknown target encoding")
+		}
+
+		zl := *(*[]byte)(zobj.ptr)
+		zs := &zset{
+			dict: dict.Create(zsetDictType, nil),
+			zsl:  zslCreate(),
+		}
+
+		eptr := listpack.Index(zl, 0)
+		var sptr []byte
+		if eptr != nil {
+			sptr = listpack.Next(zl, eptr)
+		}
+		for eptr != nil {
+			score := zzlGetScore(sptr)
+			ele := listpackGetObject(eptr)
+			node := zslInsert(zs.zsl, score, ele)
+			if !zs.dict.Add(unsafe.Pointer(&ele), unsafe.Pointer(&node.score)) {
+				panic("Listpack corruption detected")
+			}
+			zzlNext(zl, &eptr, &sptr)
+		}
+
+		zobj.ptr = unsafe.Pointer(zs)
+		zobj.setEncoding(ObjEncodingSkipList)
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		if encoding != ObjEncodingListPack {
+			panic("Unknown target encoding")
+		}
+
+		zl := listpack.New()
+		zs := (*zset)(zobj.ptr)
+		for node := zs.zsl.header.level[0].forward; node != nil; node = node.level[0].forward {
+			zl = zzlInsertAt(zl, nil, node.ele, node.score)
+		}
+
+		zobj.ptr = unsafe.Pointer(&zl)
+		zobj.setEncoding(ObjEncodingListPack)
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+}
+
+// zsetConvertToListpackIfNeeded 如果skiplist编码的zset满足listpack的限制，转换成listpack编码，
+// maxelelen是zset中最长元素的长度
+func zsetConvertToListpackIfNeeded(zobj *robj, maxelelen int) {
+	if zobj.getEncoding() == ObjEncodingListPack {
+		return
+	}
+	zs := (*zset)(zobj.ptr)
+	if zs.zsl.length <= server.zsetMaxListpackEntries &&
+		maxelelen <= server.zsetMaxListpackValue {
+		zsetConvert(zobj, ObjEncodingListPack)
+	}
+}
+
+func zsetScore(zobj *robj, member sds.SDS, score *float64) error {
+	if zobj == nil {
+		return C_ERR
+	}
+
+	if zobj.getEncoding() == ObjEncodingListPack {
+		if zzlFind(*(*[]byte)(zobj.ptr), member, score) == nil {
+			return C_ERR
+		}
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		de := (*zset)(zobj.ptr).dict.Find(unsafe.Pointer(&member))
+		if de == nil {
+			return C_ERR
+		}
+		*score = *(*float64)(dict.GetVal(de))
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+	return C_OK
+}
+
+const (
+	zaddInIncr = 1 << iota // 在当前score上增加
+	zaddInNx               // 只添加新元素
+	zaddInXx               // 只更新已存在的元素
+	zaddInGt               // 只在新score更大时更新
+	zaddInLt               // 只在新score更小时更新
+	zaddInNone = 0
+)
+
+const (
+	zaddOutNop     = 1 << iota // 因为条件不满足，什么都没做
+	zaddOutNan                 // 结果是NaN，什么都没做
+	zaddOutAdded               // 元素是新添加的
+	zaddOutUpdated             // 元素的score被更新了
+)
+
+// zsetAdd 添加或者更新有序集合中的元素，ele总是会被复制，调用者可以继续使用。
+// 只有在结果为NaN的时候返回false，其它情况通过outFlags说明执行的操作。
+// newscore不为nil时，如果元素被添加或者更新，用来返回元素新的score
+func zsetAdd(zobj *robj, score float64, ele sds.SDS, inFlags int, outFlags *int, newscore *float64) bool {
+	incr := inFlags&zaddInIncr > 0
+	nx := inFlags&zaddInNx > 0
+	xx := inFlags&zaddInXx > 0
+	gt := inFlags&zaddInGt > 0
+	lt := inFlags&zaddInLt > 0
+	*outFlags = 0
+
+	if math.IsNaN(score) {
+		*outFlags = zaddOutNan
+		return false
+	}
+
+	if zobj.getEncoding() == ObjEncodingListPack {
+		zl := *(*[]byte)(zobj.ptr)
+		var curscore float64
+
+		if eptr := zzlFind(zl, ele, &curscore); eptr != nil {
+			if nx {
+				*outFlags |= zaddOutNop
+				return true
+			}
+
+			if incr {
+				score += curscore
+				if math.IsNaN(score) {
+					*outFlags |= zaddOutNan
+					return false
+				}
+			}
+
+			if (lt && score >= curscore) || (gt && score <= curscore) {
+				*outFlags |= zaddOutNop
+				return true
+			}
+
+			if newscore != nil {
+				*newscore = score
+			}
+
+			if score != curscore {
+				zl = zzlDelete(zl, eptr)
+				zl = zzlInsert(zl, ele, score)
+				zobj.ptr = unsafe.Pointer(&zl)
+				*outFlags |= zaddOutUpdated
+			}
+			return true
+		} else if !xx {
+			zl = zzlInsert(zl, ele, score)
+			zobj.ptr = unsafe.Pointer(&zl)
+			if zzlLength(zl) > server.zsetMaxListpackEntries ||
+				sds.Len(ele) > server.zsetMaxListpackValue ||
+				!listpack.SafeToAdd(zl, sds.Len(ele)) {
+				zsetConvert(zobj, ObjEncodingSkipList)
+			}
+			if newscore != nil {
+				*newscore = score
+			}
+			*outFlags |= zaddOutAdded
+			return true
+		} else {
+			*outFlags |= zaddOutNop
+			return true
+		}
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		zs := (*zset)(zobj.ptr)
+
+		if de := zs.dict.Find(unsafe.Pointer(&ele)); de != nil {
+			if nx {
+				*outFlags |= zaddOutNop
+				return true
+			}
+
+			curscore := *(*float64)(dict.GetVal(de))
+			if incr {
+				score += curscore
+				if math.IsNaN(score) {
+					*outFlags |= zaddOutNan
+					return false
+				}
+			}
+
+			if (lt && score >= curscore) || (gt && score <= curscore) {
+				*outFlags |= zaddOutNop
+				return true
+			}
+
+			if newscore != nil {
+				*newscore = score
+			}
+
+			if score != curscore {
+				znode := zslUpdateScore(zs.zsl, curscore, ele, score)
+				dict.SetVal(de, unsafe.Pointer(&znode.score))
+				*outFlags |= zaddOutUpdated
+			}
+			return true
+		} else if !xx {
+			ele = sds.Dup(ele)
+			znode := zslInsert(zs.zsl, score, ele)
+			if !zs.dict.Add(unsafe.Pointer(&ele), unsafe.Pointer(&znode.score)) {
+				panic("zsetAdd: element already in dict")
+			}
+			*outFlags |= zaddOutAdded
+			if newscore != nil {
+				*newscore = score
+			}
+			return true
+		} else {
+			*outFlags |= zaddOutNop
+			return true
+		}
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+}
+
+func zsetRemoveFromSkiplist(zs *zset, ele sds.SDS) bool {
+	de := zs.dict.GenericDelete(unsafe.Pointer(&ele), true)
+	if de == nil {
+		return false
+	}
+
+	score := *(*float64)(dict.GetVal(de))
+	if !zslDelete(zs.zsl, score, ele, nil) {
+		panic("zsetRemoveFromSkiplist: element not in skiplist")
+	}
+	if htNeedResize(zs.dict) {
+		zs.dict.Resize()
+	}
+	return true
+}
+
+// zsetDel 删除ele，找到并删除返回true
+func zsetDel(zobj *robj, ele sds.SDS) bool {
+	if zobj.getEncoding() == ObjEncodingListPack {
+		zl := *(*[]byte)(zobj.ptr)
+		if eptr := zzlFind(zl, ele, nil); eptr != nil {
+			zl = zzlDelete(zl, eptr)
+			zobj.ptr = unsafe.Pointer(&zl)
+			return true
+		}
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		if zsetRemoveFromSkiplist((*zset)(zobj.ptr), ele) {
+			return true
+		}
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+	return false
+}
+
+// zsetRank 返回ele的排名(从0开始)，reverse为true时按score从大到小排名，
+// ele不存在时返回-1
+func zsetRank(zobj *robj, ele sds.SDS, reverse bool) int {
+	llen := zsetLength(zobj)
+
+	if zobj.getEncoding() == ObjEncodingListPack {
+		zl := *(*[]byte)(zobj.ptr)
+		eptr := listpack.Index(zl, 0)
+		if eptr == nil {
+			return -1
+		}
+		sptr := listpack.Next(zl, eptr)
+
+		rank := 1
+		for eptr != nil {
+			if listpack.Compare(eptr, ele.BufData(0)) {
+				break
+			}
+			rank++
+			zzlNext(zl, &eptr, &sptr)
+		}
+
+		if eptr != nil {
+			if reverse {
+				return llen - rank
+			}
+			return rank - 1
+		}
+		return -1
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		zs := (*zset)(zobj.ptr)
+		de := zs.dict.Find(unsafe.Pointer(&ele))
+		if de != nil {
+			score := *(*float64)(dict.GetVal(de))
+			rank := zslGetRank(zs.zsl, score, ele)
+			if reverse {
+				return llen - rank
+			}
+			return rank - 1
+		}
+		return -1
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+}
+
+/*-----------------------------------------------------------------------------
+ * Sorted set commands
+ *----------------------------------------------------------------------------*/
+
+// zaddGenericCommand 实现ZADD和ZINCRBY
+func zaddGenericCommand(c *Client, flags int) {
+	const nanerr = "resulting score is not a number (NaN)"
+	key := c.argv[1]
+
+	var ch bool
+	scoreidx := 2
+	for scoreidx < c.argc {
+		opt := (*sds.SDS)(c.argv[scoreidx].ptr).BufData(0)
+		if util.StrCaseCmp(opt, "nx") {
+			flags |= zaddInNx
+		} else if util.StrCaseCmp(opt, "xx") {
+			flags |= zaddInXx
+		} else if util.StrCaseCmp(opt, "ch") {
+			ch = true
+		} else if util.StrCaseCmp(opt, "incr") {
+			flags |= zaddInIncr
+		} else if util.StrCaseCmp(opt, "gt") {
+			flags |= zaddInGt
+		} else if util.StrCaseCmp(opt, "lt") {
+			flags |= zaddInLt
+		} else {
+			break
+		}
+		scoreidx++
+	}
+
+	incr := flags&zaddInIncr > 0
+	nx := flags&zaddInNx > 0
+	xx := flags&zaddInXx > 0
+	gt := flags&zaddInGt > 0
+	lt := flags&zaddInLt > 0
+
+	elements := c.argc - scoreidx
+	if elements%2 != 0 || elements == 0 {
+		addReply(c, shared.syntaxErr)
+		return
+	}
+	elements /= 2
+
+	if nx && xx {
+		addReplyError(c, "XX and NX options at the same time are not compatible")
+		return
+	}
+	if (gt && nx) || (lt && nx) || (gt && lt) {
+		addReplyError(c, "GT, LT, and/or NX options at the same time are not compatible")
+		return
+	}
+	if incr && elements > 1 {
+		addReplyError(c, "INCR option supports a single increment-element pair")
+		return
+	}
+
+	scores := make([]float64, elements)
+	for j := 0; j < elements; j++ {
+		if c.argv[scoreidx+j*2].getDoubleFromObjectOrReply(c, &scores[j], "") != C_OK {
+			return
+		}
+	}
+
+	zobj := c.db.lookupKeyWrite(key)
+	if zobj != nil && zobj.checkType(c, ObjZSet) {
+		return
+	}
+	if zobj == nil && !xx {
+		if server.zsetMaxListpackEntries == 0 ||
+			server.zsetMaxListpackValue < sds.Len(*(*sds.SDS)(c.argv[scoreidx+1].ptr)) {
+			zobj = createZsetObject()
+		} else {
+			zobj = createZsetListpackObject()
+		}
+		c.db.dbAdd(key, zobj)
+	}
+
+	var added, updated, processed int
+	var score float64
+	var nan bool
+	for j := 0; zobj != nil && j < elements; j++ {
+		var newscore float64
+		var retflags int
+		score = scores[j]
+		ele := *(*sds.SDS)(c.argv[scoreidx+1+j*2].ptr)
+
+		if !zsetAdd(zobj, score, ele, flags, &retflags, &newscore) {
+			nan = true
+			break
+		}
+		if retflags&zaddOutAdded > 0 {
+			added++
+		}
+		if retflags&zaddOutUpdated > 0 {
+			updated++
+		}
+		if retflags&zaddOutNop == 0 {
+			processed++
+		}
+		score = newscore
+	}
+	server.dirty += added + updated
+
+	if nan {
+		addReplyError(c, nanerr)
+	} else if incr {
+		if processed > 0 {
+			addReplyDouble(c, score)
+		} else {
+			addReplyNull(c)
+		}
+	} else {
+		if ch {
+			addReplyLongLong(c, added+updated)
+		} else {
+			addReplyLongLong(c, added)
+		}
+	}
+
+	if added+updated > 0 {
+		signalModifiedKey(c, c.db, key)
+		if incr {
+			notifyKeySpaceEvent(notifyZset, "zincr", key, c.db.id)
+		} else {
+			notifyKeySpaceEvent(notifyZset, "zadd", key, c.db.id)
+		}
+	}
+}
+
+func zaddCommand(c *Client) {
+	zaddGenericCommand(c, zaddInNone)
+}
+
+func zincrbyCommand(c *Client) {
+	zaddGenericCommand(c, zaddInIncr)
+}
+
+func zremCommand(c *Client) {
+	key := c.argv[1]
+
+	var zobj *robj
+	if zobj = lookupKeyWriteOrReply(c, key, shared.czero); zobj == nil || zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	var deleted int
+	var keyRemoved bool
+	for j := 2; j < c.argc; j++ {
+		if zsetDel(zobj, *(*sds.SDS)(c.argv[j].ptr)) {
+			deleted++
+		}
+		if zsetLength(zobj) == 0 {
+			dbDelete(c.db, key)
+			keyRemoved = true
+			break
+		}
+	}
+
+	if deleted > 0 {
+		notifyKeySpaceEvent(notifyZset, "zrem", key, c.db.id)
+		if keyRemoved {
+			notifyKeySpaceEvent(notifyGeneric, "del", key, c.db.id)
+		}
+		signalModifiedKey(c, c.db, key)
+		server.dirty += deleted
+	}
+	addReplyLongLong(c, deleted)
+}
+
+func zcardCommand(c *Client) {
+	var zobj *robj
+	if zobj = lookupKeyReadOrReply(c, c.argv[1], shared.czero); zobj == nil || zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	addReplyLongLong(c, zsetLength(zobj))
+}
+
+func zscoreCommand(c *Client) {
+	var zobj *robj
+	if zobj = lookupKeyReadOrReply(c, c.argv[1], shared.null[c.resp]); zobj == nil || zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	var score float64
+	if zsetScore(zobj, *(*sds.SDS)(c.argv[2].ptr), &score) == C_ERR {
+		addReplyNull(c)
+	} else {
+		addReplyDouble(c, score)
+	}
+}
+
+func zrankGenericCommand(c *Client, reverse bool) {
+	var zobj *robj
+	if zobj = lookupKeyReadOrReply(c, c.argv[1], shared.null[c.resp]); zobj == nil || zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	rank := zsetRank(zobj, *(*sds.SDS)(c.argv[2].ptr), reverse)
+	if rank >= 0 {
+		addReplyLongLong(c, rank)
+	} else {
+		addReplyNull(c)
+	}
+}
+
+func zrankCommand(c *Client) {
+	zrankGenericCommand(c, false)
+}
+
+func zrevrankCommand(c *Client) {
+	zrankGenericCommand(c, true)
+}
+
+/*-----------------------------------------------------------------------------
+ * Sorted set range commands
+ *----------------------------------------------------------------------------*/
+
+const (
+	zrangeDirectionAuto = iota
+	zrangeDirectionForward
+	zrangeDirectionReverse
+)
+
+const (
+	zrangeAuto = iota
+	zrangeRank
+	zrangeScore
+	zrangeLex
+)
+
+// zrangeResultHandler 抽象了range结果的输出方式，ZRANGE直接回复给客户端，
+// ZRANGESTORE则把结果写入目标key
+type zrangeResultHandler struct {
+	client *Client
+
+	dstkey *robj
+	dstobj *robj
+
+	userdata   *adlist.ListNode
+	withscores bool
+
+	beginResultEmission    func(handler *zrangeResultHandler)
+	finalizeResultEmission func(handler *zrangeResultHandler, resultCount int)
+	emitResultFromCBuffer  func(handler *zrangeResultHandler, value []byte, score float64)
+	emitResultFromLongLong func(handler *zrangeResultHandler, value int64, score float64)
+}
+
+func zrangeResultBeginClient(handler *zrangeResultHandler) {
+	handler.userdata = addReplyDeferredLen(handler.client)
+}
+
+func zrangeResultEmitCBufferToClient(handler *zrangeResultHandler, value []byte, score float64) {
+	c := handler.client
+	if handler.withscores && c.resp > 2 {
+		addReplyArrayLen(c, 2)
+	}
+	addReplyBulkBuffer(c, value, len(value))
+	if handler.withscores {
+		addReplyDouble(c, score)
+	}
+}
+
+func zrangeResultEmitLongLongToClient(handler *zrangeResultHandler, value int64, score float64) {
+	c := handler.client
+	if handler.withscores && c.resp > 2 {
+		addReplyArrayLen(c, 2)
+	}
+	addReplyBulkLongLong(c, value)
+	if handler.withscores {
+		addReplyDouble(c, score)
+	}
+}
+
+func zrangeResultFinalizeClient(handler *zrangeResultHandler, resultCount int) {
+	// RESP2下WITHSCORES的每个结果占两个元素，RESP3下则是一个二元数组
+	if handler.withscores && handler.client.resp == 2 {
+		resultCount *= 2
+	}
+	setDeferredArrayLen(handler.client, handler.userdata, resultCount)
+}
+
+func zrangeResultBeginStore(handler *zrangeResultHandler) {
+	handler.dstobj = createZsetListpackObject()
+}
+
+func zrangeResultEmitCBufferForStore(handler *zrangeResultHandler, value []byte, score float64) {
+	var retflags int
+	zsetAdd(handler.dstobj, score, sds.NewLen(value), zaddInNone, &retflags, nil)
+}
+
+func zrangeResultEmitLongLongForStore(handler *zrangeResultHandler, value int64, score float64) {
+	var retflags int
+	zsetAdd(handler.dstobj, score, sds.NewLen(strconv.FormatInt(value, 10)), zaddInNone, &retflags, nil)
+}
+
+func zrangeResultFinalizeStore(handler *zrangeResultHandler, resultCount int) {
+	c := handler.client
+	if resultCount > 0 {
+		c.db.genericSetKey(c, handler.dstkey, handler.dstobj, false, true)
+		addReplyLongLong(c, resultCount)
+		notifyKeySpaceEvent(notifyZset, "zrangestore", handler.dstkey, c.db.id)
+		server.dirty++
+	} else {
+		addReply(c, shared.czero)
+		if dbDelete(c.db, handler.dstkey) {
+			signalModifiedKey(c, c.db, handler.dstkey)
+			notifyKeySpaceEvent(notifyGeneric, "del", handler.dstkey, c.db.id)
+			server.dirty++
+		}
+	}
+	handler.dstobj.decrRefCount()
+}
+
+func zrangeResultHandlerInit(handler *zrangeResultHandler, client *Client, store bool) {
+	handler.client = client
+	if store {
+		handler.beginResultEmission = zrangeResultBeginStore
+		handler.finalizeResultEmission = zrangeResultFinalizeStore
+		handler.emitResultFromCBuffer = zrangeResultEmitCBufferForStore
+		handler.emitResultFromLongLong = zrangeResultEmitLongLongForStore
+	} else {
+		handler.beginResultEmission = zrangeResultBeginClient
+		handler.finalizeResultEmission = zrangeResultFinalizeClient
+		handler.emitResultFromCBuffer = zrangeResultEmitCBufferToClient
+		handler.emitResultFromLongLong = zrangeResultEmitLongLongToClient
+	}
+}
+
+// zrangeResultEmitListpackEntry 输出listpack中eptr指向的元素
+func zrangeResultEmitListpackEntry(handler *zrangeResultHandler, eptr []byte, score float64) {
+	var vstr []byte
+	var vlen int
+	var vlong int64
+	listpack.Get(eptr, &vstr, &vlen, &vlong)
+	if vstr == nil {
+		handler.emitResultFromLongLong(handler, vlong, score)
+	} else {
+		handler.emitResultFromCBuffer(handler, vstr, score)
+	}
+}
+
+// genericZrangebyrankCommand 实现按排名查询，start和end已经是合法的非负下标
+func genericZrangebyrankCommand(handler *zrangeResultHandler, zobj *robj, start, end int, withscores, reverse bool) {
+	llen := zsetLength(zobj)
+
+	if start < 0 {
+		start = llen + start
+	}
+	if end < 0 {
+		end = llen + end
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	// 结果为空时，end必然大于等于0，所以只需要检查start
+	if start > end || start >= llen {
+		handler.beginResultEmission(handler)
+		handler.finalizeResultEmission(handler, 0)
+		return
+	}
+	if end >= llen {
+		end = llen - 1
+	}
+	rangelen := end - start + 1
+	resultCardinality := rangelen
+
+	handler.beginResultEmission(handler)
+	if zobj.getEncoding() == ObjEncodingListPack {
+		zl := *(*[]byte)(zobj.ptr)
+		var eptr []byte
+		if reverse {
+			eptr = listpack.Index(zl, -2-2*start)
+		} else {
+			eptr = listpack.Index(zl, 2*start)
+		}
+		if eptr == nil {
+			panic("genericZrangebyrankCommand: listpack corruption detected")
+		}
+		sptr := listpack.Next(zl, eptr)
+
+		for ; rangelen > 0; rangelen-- {
+			if eptr == nil || sptr == nil {
+				panic("genericZrangebyrankCommand: listpack corruption detected")
+			}
+			zrangeResultEmitListpackEntry(handler, eptr, zzlGetScore(sptr))
+			if reverse {
+				zzlPrev(zl, &eptr, &sptr)
+			} else {
+				zzlNext(zl, &eptr, &sptr)
+			}
+		}
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		zsl := (*zset)(zobj.ptr).zsl
+
+		// 通过排名直接定位到第一个元素
+		var ln *zskiplistNode
+		if reverse {
+			ln = zsl.tail
+			if start > 0 {
+				ln = zslGetElementByRank(zsl, llen-start)
+			}
+		} else {
+			ln = zsl.header.level[0].forward
+			if start > 0 {
+				ln = zslGetElementByRank(zsl, start+1)
+			}
+		}
+
+		for ; rangelen > 0; rangelen-- {
+			if ln == nil {
+				panic("genericZrangebyrankCommand: skiplist corruption detected")
+			}
+			handler.emitResultFromCBuffer(handler, ln.ele.BufData(0), ln.score)
+			if reverse {
+				ln = ln.backward
+			} else {
+				ln = ln.level[0].forward
+			}
+		}
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+
+	handler.finalizeResultEmission(handler, resultCardinality)
+}
+
+// genericZrangebyscoreCommand 实现ZRANGEBYSCORE和ZREVRANGEBYSCORE，limit为-1表示不限制数量
+func genericZrangebyscoreCommand(handler *zrangeResultHandler, r *zrangespec, zobj *robj, offset, limit int, reverse bool) {
+	rangelen := 0
+
+	handler.beginResultEmission(handler)
+
+	// offset为负数时返回空结果
+	if offset > 0 && offset >= zsetLength(zobj) {
+		handler.finalizeResultEmission(handler, 0)
+		return
+	}
+
+	if zobj.getEncoding() == ObjEncodingListPack {
+		zl := *(*[]byte)(zobj.ptr)
+
+		var eptr []byte
+		if reverse {
+			eptr = zzlLastInRange(zl, r)
+		} else {
+			eptr = zzlFirstInRange(zl, r)
+		}
+
+		var sptr []byte
+		if eptr != nil {
+			sptr = listpack.Next(zl, eptr)
+		}
+
+		// 跳过offset个元素，因为还要检查score，所以没法直接跳过
+		for eptr != nil && offset != 0 {
+			offset--
+			if reverse {
+				zzlPrev(zl, &eptr, &sptr)
+			} else {
+				zzlNext(zl, &eptr, &sptr)
+			}
+		}
+
+		for eptr != nil && limit != 0 {
+			limit--
+			score := zzlGetScore(sptr)
+
+			if reverse {
+				if !zslValueGteMin(score, r) {
+					break
+				}
+			} else {
+				if !zslValueLteMax(score, r) {
+					break
+				}
+			}
+
+			rangelen++
+			zrangeResultEmitListpackEntry(handler, eptr, score)
+
+			if reverse {
+				zzlPrev(zl, &eptr, &sptr)
+			} else {
+				zzlNext(zl, &eptr, &sptr)
+			}
+		}
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		zsl := (*zset)(zobj.ptr).zsl
+
+		var ln *zskiplistNode
+		if reverse {
+			ln = zslLastInRange(zsl, r)
+		} else {
+			ln = zslFirstInRange(zsl, r)
+		}
+
+		for ln != nil && offset != 0 {
+			offset--
+			if reverse {
+				ln = ln.backward
+			} else {
+				ln = ln.level[0].forward
+			}
+		}
+
+		for ln != nil && limit != 0 {
+			limit--
+			if reverse {
+				if !zslValueGteMin(ln.score, r) {
+					break
+				}
+			} else {
+				if !zslValueLteMax(ln.score, r) {
+					break
+				}
+			}
+
+			rangelen++
+			handler.emitResultFromCBuffer(handler, ln.ele.BufData(0), ln.score)
+
+			if reverse {
+				ln = ln.backward
+			} else {
+				ln = ln.level[0].forward
+			}
+		}
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+
+	handler.finalizeResultEmission(handler, rangelen)
+}
+
+// genericZrangebylexCommand 实现ZRANGEBYLEX和ZREVRANGEBYLEX
+func genericZrangebylexCommand(handler *zrangeResultHandler, r *zlexrangespec, zobj *robj, withscores bool, offset, limit int, reverse bool) {
+	rangelen := 0
+
+	handler.beginResultEmission(handler)
+
+	if zobj.getEncoding() == ObjEncodingListPack {
+		zl := *(*[]byte)(zobj.ptr)
+
+		var eptr []byte
+		if reverse {
+			eptr = zzlLastInLexRange(zl, r)
+		} else {
+			eptr = zzlFirstInLexRange(zl, r)
+		}
+
+		var sptr []byte
+		if eptr != nil {
+			sptr = listpack.Next(zl, eptr)
+		}
+
+		for eptr != nil && offset != 0 {
+			offset--
+			if reverse {
+				zzlPrev(zl, &eptr, &sptr)
+			} else {
+				zzlNext(zl, &eptr, &sptr)
+			}
+		}
+
+		for eptr != nil && limit != 0 {
+			limit--
+			if reverse {
+				if !zzlLexValueGteMin(eptr, r) {
+					break
+				}
+			} else {
+				if !zzlLexValueLteMax(eptr, r) {
+					break
+				}
+			}
+
+			rangelen++
+			zrangeResultEmitListpackEntry(handler, eptr, zzlGetScore(sptr))
+
+			if reverse {
+				zzlPrev(zl, &eptr, &sptr)
+			} else {
+				zzlNext(zl, &eptr, &sptr)
+			}
+		}
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		zsl := (*zset)(zobj.ptr).zsl
+
+		var ln *zskiplistNode
+		if reverse {
+			ln = zslLastInLexRange(zsl, r)
+		} else {
+			ln = zslFirstInLexRange(zsl, r)
+		}
+
+		for ln != nil && offset != 0 {
+			offset--
+			if reverse {
+				ln = ln.backward
+			} else {
+				ln = ln.level[0].forward
+			}
+		}
+
+		for ln != nil && limit != 0 {
+			limit--
+			if reverse {
+				if !zslLexValueGteMin(ln.ele, r) {
+					break
+				}
+			} else {
+				if !zslLexValueLteMax(ln.ele, r) {
+					break
+				}
+			}
+
+			rangelen++
+			handler.emitResultFromCBuffer(handler, ln.ele.BufData(0), ln.score)
+
+			if reverse {
+				ln = ln.backward
+			} else {
+				ln = ln.level[0].forward
+			}
+		}
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+
+	handler.finalizeResultEmission(handler, rangelen)
+}
+
+// zrangeGenericCommand 是ZRANGE系列命令的公共实现，argcStart是key所在的参数下标，
+// rangetype和direction是旧命令隐含的选项，为auto时从参数中解析
+func zrangeGenericCommand(handler *zrangeResultHandler, argcStart int, store bool, rangetype, direction int) {
+	c := handler.client
+	key := c.argv[argcStart]
+	minidx, maxidx := argcStart+1, argcStart+2
+
+	var r zrangespec
+	var lexrange zlexrangespec
+	var optWithscores bool
+	optOffset, optLimit := 0, -1
+
+	// 解析可选参数
+	for j := argcStart + 3; j < c.argc; j++ {
+		leftargs := c.argc - j - 1
+		arg := (*sds.SDS)(c.argv[j].ptr).BufData(0)
+		if !store && util.StrCaseCmp(arg, "withscores") {
+			optWithscores = true
+		} else if util.StrCaseCmp(arg, "limit") && leftargs >= 2 {
+			var offset, limit int64
+			if c.argv[j+1].getLongLongFromObjectOrReply(c, &offset, "") != C_OK ||
+				c.argv[j+2].getLongLongFromObjectOrReply(c, &limit, "") != C_OK {
+				return
+			}
+			optOffset, optLimit = int(offset), int(limit)
+			j += 2
+		} else if direction == zrangeDirectionAuto && util.StrCaseCmp(arg, "rev") {
+			direction = zrangeDirectionReverse
+		} else if rangetype == zrangeAuto && util.StrCaseCmp(arg, "bylex") {
+			rangetype = zrangeLex
+		} else if rangetype == zrangeAuto && util.StrCaseCmp(arg, "byscore") {
+			rangetype = zrangeScore
+		} else {
+			addReply(c, shared.syntaxErr)
+			return
+		}
+	}
+
+	// 用默认值填充未指定的选项
+	if direction == zrangeDirectionAuto {
+		direction = zrangeDirectionForward
+	}
+	if rangetype == zrangeAuto {
+		rangetype = zrangeRank
+	}
+
+	if optOffset != 0 || optLimit != -1 {
+		if rangetype == zrangeRank {
+			addReplyError(c, "syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+			return
+		}
+	}
+	if optWithscores && rangetype == zrangeLex {
+		addReplyError(c, "syntax error, WITHSCORES not supported in combination with BYLEX")
+		return
+	}
+
+	// 反向查询时min和max的位置是相反的
+	if direction == zrangeDirectionReverse && (rangetype == zrangeScore || rangetype == zrangeLex) {
+		minidx, maxidx = maxidx, minidx
+	}
+
+	var start, end int64
+	switch rangetype {
+	case zrangeRank:
+		if c.argv[minidx].getLongLongFromObjectOrReply(c, &start, "") != C_OK ||
+			c.argv[maxidx].getLongLongFromObjectOrReply(c, &end, "") != C_OK {
+			return
+		}
+	case zrangeScore:
+		if zslParseRange(c.argv[minidx], c.argv[maxidx], &r) != C_OK {
+			addReplyError(c, "min or max is not a float")
+			return
+		}
+	case zrangeLex:
+		if zslParseLexRange(c.argv[minidx], c.argv[maxidx], &lexrange) != C_OK {
+			addReplyError(c, "min or max not valid string range item")
+			return
+		}
+	}
+
+	if optWithscores || store {
+		handler.withscores = true
+	}
+
+	zobj := c.db.lookupKeyRead(key)
+	if zobj == nil {
+		if store {
+			handler.beginResultEmission(handler)
+			handler.finalizeResultEmission(handler, 0)
+		} else {
+			addReply(c, shared.emptyArray)
+		}
+		return
+	}
+	if zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	reverse := direction == zrangeDirectionReverse
+	switch rangetype {
+	case zrangeRank:
+		genericZrangebyrankCommand(handler, zobj, int(start), int(end), optWithscores || store, reverse)
+	case zrangeScore:
+		genericZrangebyscoreCommand(handler, &r, zobj, optOffset, optLimit, reverse)
+	case zrangeLex:
+		genericZrangebylexCommand(handler, &lexrange, zobj, optWithscores || store, optOffset, optLimit, reverse)
+	}
+}
+
+// ZRANGESTORE <dst> <src> <min> <max> [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+func zrangestoreCommand(c *Client) {
+	var handler zrangeResultHandler
+	zrangeResultHandlerInit(&handler, c, true)
+	handler.dstkey = c.argv[1]
+	zrangeGenericCommand(&handler, 2, true, zrangeAuto, zrangeDirectionAuto)
+}
+
+// ZRANGE <key> <min> <max> [BYSCORE | BYLEX] [REV] [WITHSCORES] [LIMIT offset count]
+func zrangeCommand(c *Client) {
+	var handler zrangeResultHandler
+	zrangeResultHandlerInit(&handler, c, false)
+	zrangeGenericCommand(&handler, 1, false, zrangeAuto, zrangeDirectionAuto)
+}
+
+// ZREVRANGE <key> <start> <stop> [WITHSCORES]
+func zrevrangeCommand(c *Client) {
+	var handler zrangeResultHandler
+	zrangeResultHandlerInit(&handler, c, false)
+	zrangeGenericCommand(&handler, 1, false, zrangeRank, zrangeDirectionReverse)
+}
+
+// ZRANGEBYSCORE <key> <min> <max> [WITHSCORES] [LIMIT offset count]
+func zrangebyscoreCommand(c *Client) {
+	var handler zrangeResultHandler
+	zrangeResultHandlerInit(&handler, c, false)
+	zrangeGenericCommand(&handler, 1, false, zrangeScore, zrangeDirectionForward)
+}
+
+// ZREVRANGEBYSCORE <key> <max> <min> [WITHSCORES] [LIMIT offset count]
+func zrevrangebyscoreCommand(c *Client) {
+	var handler zrangeResultHandler
+	zrangeResultHandlerInit(&handler, c, false)
+	zrangeGenericCommand(&handler, 1, false, zrangeScore, zrangeDirectionReverse)
+}
+
+// ZRANGEBYLEX <key> <min> <max> [LIMIT offset count]
+func zrangebylexCommand(c *Client) {
+	var handler zrangeResultHandler
+	zrangeResultHandlerInit(&handler, c, false)
+	zrangeGenericCommand(&handler, 1, false, zrangeLex, zrangeDirectionForward)
+}
+
+// ZREVRANGEBYLEX <key> <max> <min> [LIMIT offset count]
+func zrevrangebylexCommand(c *Client) {
+	var handler zrangeResultHandler
+	zrangeResultHandlerInit(&handler, c, false)
+	zrangeGenericCommand(&handler, 1, false, zrangeLex, zrangeDirectionReverse)
+}
+
+func zcountCommand(c *Client) {
+	key := c.argv[1]
+
+	var r zrangespec
+	if zslParseRange(c.argv[2], c.argv[3], &r) != C_OK {
+		addReplyError(c, "min or max is not a float")
+		return
+	}
+
+	var zobj *robj
+	if zobj = lookupKeyReadOrReply(c, key, shared.czero); zobj == nil || zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	count := 0
+	if zobj.getEncoding() == ObjEncodingListPack {
+		zl := *(*[]byte)(zobj.ptr)
+
+		eptr := zzlFirstInRange(zl, &r)
+		if eptr == nil {
+			addReply(c, shared.czero)
+			return
+		}
+
+		sptr := listpack.Next(zl, eptr)
+		for eptr != nil {
+			if !zslValueLteMax(zzlGetScore(sptr), &r) {
+				break
+			}
+			count++
+			zzlNext(zl, &eptr, &sptr)
+		}
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		zsl := (*zset)(zobj.ptr).zsl
+
+		zn := zslFirstInRange(zsl, &r)
+		if zn != nil {
+			rank := zslGetRank(zsl, zn.score, zn.ele)
+			count = zsl.length - (rank - 1)
+
+			// 减去排在最后一个元素之后的元素
+			zn = zslLastInRange(zsl, &r)
+			if zn != nil {
+				rank = zslGetRank(zsl, zn.score, zn.ele)
+				count -= zsl.length - rank
+			}
+		}
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+
+	addReplyLongLong(c, count)
+}
+
+func zlexcountCommand(c *Client) {
+	key := c.argv[1]
+
+	var r zlexrangespec
+	if zslParseLexRange(c.argv[2], c.argv[3], &r) != C_OK {
+		addReplyError(c, "min or max not valid string range item")
+		return
+	}
+
+	var zobj *robj
+	if zobj = lookupKeyReadOrReply(c, key, shared.czero); zobj == nil || zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	count := 0
+	if zobj.getEncoding() == ObjEncodingListPack {
+		zl := *(*[]byte)(zobj.ptr)
+
+		eptr := zzlFirstInLexRange(zl, &r)
+		if eptr == nil {
+			addReply(c, shared.czero)
+			return
+		}
+
+		sptr := listpack.Next(zl, eptr)
+		for eptr != nil {
+			if !zzlLexValueLteMax(eptr, &r) {
+				break
+			}
+			count++
+			zzlNext(zl, &eptr, &sptr)
+		}
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		zsl := (*zset)(zobj.ptr).zsl
+
+		zn := zslFirstInLexRange(zsl, &r)
+		if zn != nil {
+			rank := zslGetRank(zsl, zn.score, zn.ele)
+			count = zsl.length - (rank - 1)
+
+			zn = zslLastInLexRange(zsl, &r)
+			if zn != nil {
+				rank = zslGetRank(zsl, zn.score, zn.ele)
+				count -= zsl.length - rank
+			}
+		}
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+
+	addReplyLongLong(c, count)
+}
+
+// zremrangeGenericCommand 实现ZREMRANGEBYRANK、ZREMRANGEBYSCORE和ZREMRANGEBYLEX
+func zremrangeGenericCommand(c *Client, rangetype int) {
+	key := c.argv[1]
+
+	var r zrangespec
+	var lexrange zlexrangespec
+	var start, end int64
+
+	// 先解析参数，参数错误时不需要查找key
+	switch rangetype {
+	case zrangeRank:
+		if c.argv[2].getLongLongFromObjectOrReply(c, &start, "") != C_OK ||
+			c.argv[3].getLongLongFromObjectOrReply(c, &end, "") != C_OK {
+			return
+		}
+	case zrangeScore:
+		if zslParseRange(c.argv[2], c.argv[3], &r) != C_OK {
+			addReplyError(c, "min or max is not a float")
+			return
+		}
+	case zrangeLex:
+		if zslParseLexRange(c.argv[2], c.argv[3], &lexrange) != C_OK {
+			addReplyError(c, "min or max not valid string range item")
+			return
+		}
+	}
+
+	var zobj *robj
+	if zobj = lookupKeyWriteOrReply(c, key, shared.czero); zobj == nil || zobj.checkType(c, ObjZSet) {
+		return
+	}
+
+	if rangetype == zrangeRank {
+		llen := int64(zsetLength(zobj))
+		if start < 0 {
+			start = llen + start
+		}
+		if end < 0 {
+			end = llen + end
+		}
+		if start < 0 {
+			start = 0
+		}
+
+		if start > end || start >= llen {
+			addReply(c, shared.czero)
+			return
+		}
+		if end >= llen {
+			end = llen - 1
+		}
+	}
+
+	var deleted int
+	var keyRemoved bool
+	if zobj.getEncoding() == ObjEncodingListPack {
+		zl := *(*[]byte)(zobj.ptr)
+		switch rangetype {
+		case zrangeRank:
+			zl = zzlDeleteRangeByRank(zl, int(start)+1, int(end)+1, &deleted)
+		case zrangeScore:
+			zl = zzlDeleteRangeByScore(zl, &r, &deleted)
+		case zrangeLex:
+			zl = zzlDeleteRangeByLex(zl, &lexrange, &deleted)
+		}
+		zobj.ptr = unsafe.Pointer(&zl)
+		if zzlLength(zl) == 0 {
+			dbDelete(c.db, key)
+			keyRemoved = true
+		}
+	} else if zobj.getEncoding() == ObjEncodingSkipList {
+		zs := (*zset)(zobj.ptr)
+		switch rangetype {
+		case zrangeRank:
+			deleted = zslDeleteRangeByRank(zs.zsl, int(start)+1, int(end)+1, zs.dict)
+		case zrangeScore:
+			deleted = zslDeleteRangeByScore(zs.zsl, &r, zs.dict)
+		case zrangeLex:
+			deleted = zslDeleteRangeByLex(zs.zsl, &lexrange, zs.dict)
+		}
+		if htNeedResize(zs.dict) {
+			zs.dict.Resize()
+		}
+		if zs.dict.Size() == 0 {
+			dbDelete(c.db, key)
+			keyRemoved = true
+		}
+	} else {
+		panic("Unknown sorted set encoding")
+	}
+
+	if deleted > 0 {
+		event := [...]string{zrangeRank: "zremrangebyrank", zrangeScore: "zremrangebyscore", zrangeLex: "zremrangebylex"}
+		signalModifiedKey(c, c.db, key)
+		notifyKeySpaceEvent(notifyZset, event[rangetype], key, c.db.id)
+		if keyRemoved {
+			notifyKeySpaceEvent(notifyGeneric, "del", key, c.db.id)
+		}
+	}
+	server.dirty += deleted
+	addReplyLongLong(c, deleted)
+}
+
+func zremrangebyrankCommand(c *Client) {
+	zremrangeGenericCommand(c, zrangeRank)
+}
+
+func zremrangebyscoreCommand(c *Client) {
+	zremrangeGenericCommand(c, zrangeScore)
+}
+
+func zremrangebylexCommand(c *Client) {
+	zremrangeGenericCommand(c, zrangeLex)
+}
+
+/*-----------------------------------------------------------------------------
+ * Sorted set union, intersection and difference
+ *----------------------------------------------------------------------------*/
+
+const (
+	setOpUnion = iota
+	setOpDiff
+	setOpInter
+)
+
+const (
+	redisAggrSum = iota
+	redisAggrMin
+	redisAggrMax
+)
+
+// zsetopsrc 是参与集合运算的一个输入，可以是set也可以是zset
+type zsetopsrc struct {
+	subject  *robj
+	typ      int
+	encoding uint32
+	weight   float64
+
+	si         *setTypeIterator // set
+	eptr, sptr []byte           // listpack编码的zset
+	node       *zskiplistNode   // skiplist编码的zset
+}
+
+const (
+	opvalValidEle = 1 << iota // ele有效
+	opvalValidLL              // ell有效
+	opvalDirtySds             // ele是新创建的，可以直接使用而不需要复制
+)
+
+// zsetopval 保存迭代时取到的当前元素，元素可能以sds、[]byte或者整数的形式存在
+type zsetopval struct {
+	flags int
+	ele   sds.SDS
+	estr  []byte
+	ell   int64
+	score float64
+}
+
+func zuiInitIterator(op *zsetopsrc) {
+	if op.subject == nil {
+		return
+	}
+
+	if op.typ == ObjSet {
+		op.si = setTypeInitIterator(op.subject)
+	} else if op.typ == ObjZSet {
+		if op.encoding == ObjEncodingListPack {
+			zl := *(*[]byte)(op.subject.ptr)
+			op.eptr = listpack.Index(zl, 0)
+			if op.eptr != nil {
+				op.sptr = listpack.Next(zl, op.eptr)
+			}
+		} else if op.encoding == ObjEncodingSkipList {
+			op.node = (*zset)(op.subject.ptr).zsl.header.level[0].forward
+		} else {
+			panic("Unknown sorted set encoding")
+		}
+	} else {
+		panic("Unsupported type")
+	}
+}
+
+func zuiClearIterator(op *zsetopsrc) {
+	if op.subject == nil {
+		return
+	}
+
+	if op.typ == ObjSet {
+		setTypeReleaseIterator(op.si)
+		op.si = nil
+	}
+}
+
+func zuiLength(op *zsetopsrc) int {
+	if op.subject == nil {
+		return 0
+	}
+
+	if op.typ == ObjSet {
+		return setTypeSize(op.subject)
+	} else if op.typ == ObjZSet {
+		return zsetLength(op.subject)
+	}
+	panic("Unsupported type")
+}
+
+// zuiNext 把迭代器的下一个元素保存到val中，没有更多元素时返回false
+func zuiNext(op *zsetopsrc, val *zsetopval) bool {
+	if op.subject == nil {
+		return false
+	}
+
+	*val = zsetopval{}
+
+	if op.typ == ObjSet {
+		var ele sds.SDS
+		var ell int64
+		encoding := setTypeNext(op.si, &ele, &ell)
+		if encoding == -1 {
+			return false
+		}
+		if encoding == ObjEncodingIntSet {
+			val.ell = ell
+			val.flags |= opvalValidLL
+		} else {
+			val.ele = ele
+			val.flags |= opvalValidEle
+		}
+		// set中的元素score都是1
+		val.score = 1.0
+	} else if op.typ == ObjZSet {
+		if op.encoding == ObjEncodingListPack {
+			if op.eptr == nil {
+				return false
+			}
+			var vlen int
+			listpack.Get(op.eptr, &val.estr, &vlen, &val.ell)
+			if val.estr == nil {
+				val.flags |= opvalValidLL
+			}
+			val.score = zzlGetScore(op.sptr)
+
+			zzlNext(*(*[]byte)(op.subject.ptr), &op.eptr, &op.sptr)
+		} else if op.encoding == ObjEncodingSkipList {
+			if op.node == nil {
+				return false
+			}
+			val.ele = op.node.ele
+			val.flags |= opvalValidEle
+			val.score = op.node.score
+
+			op.node = op.node.level[0].forward
+		} else {
+			panic("Unknown sorted set encoding")
+		}
+	} else {
+		panic("Unsupported type")
+	}
+	return true
+}
+
+// zuiSdsFromValue 返回val对应的sds，返回值只能在下一次zuiNext之前使用
+func zuiSdsFromValue(val *zsetopval) sds.SDS {
+	if val.flags&opvalValidEle == 0 {
+		if val.estr != nil {
+			val.ele = sds.NewLen(val.estr)
+		} else {
+			val.ele = sds.FromLongLong(val.ell)
+		}
+		val.flags |= opvalValidEle | opvalDirtySds
+	}
+	return val.ele
+}
+
+// zuiNewSdsFromValue 返回一个可以保存到目标zset中的sds
+func zuiNewSdsFromValue(val *zsetopval) sds.SDS {
+	if val.flags&opvalDirtySds > 0 {
+		// 已经是新创建的sds，直接转移给调用者
+		ele := val.ele
+		val.flags &^= opvalValidEle | opvalDirtySds
+		return ele
+	}
+	if val.flags&opvalValidEle > 0 {
+		return sds.Dup(val.ele)
+	}
+	if val.estr != nil {
+		return sds.NewLen(val.estr)
+	}
+	return sds.FromLongLong(val.ell)
+}
+
+// zuiFind 在op中查找val，找到时把score保存到score中
+func zuiFind(op *zsetopsrc, val *zsetopval, score *float64) bool {
+	if op.subject == nil {
+		return false
+	}
+
+	if op.typ == ObjSet {
+		if setTypeIsMember(op.subject, zuiSdsFromValue(val)) {
+			*score = 1.0
+			return true
+		}
+		return false
+	} else if op.typ == ObjZSet {
+		ele := zuiSdsFromValue(val)
+		if op.encoding == ObjEncodingListPack {
+			return zzlFind(*(*[]byte)(op.subject.ptr), ele, score) != nil
+		} else if op.encoding == ObjEncodingSkipList {
+			de := (*zset)(op.subject.ptr).dict.Find(unsafe.Pointer(&ele))
+			if de == nil {
+				return false
+			}
+			*score = *(*float64)(dict.GetVal(de))
+			return true
+		}
+		panic("Unknown sorted set encoding")
+	}
+	panic("Unsupported type")
+}
+
+func zunionInterAggregate(target *float64, val float64, aggregate int) {
+	switch aggregate {
+	case redisAggrSum:
+		*target = *target + val
+		// inf + -inf 的结果是nan，这里当作0处理
+		if math.IsNaN(*target) {
+			*target = 0.0
+		}
+	case redisAggrMin:
+		if val < *target {
+			*target = val
+		}
+	case redisAggrMax:
+		if val > *target {
+			*target = val
+		}
+	default:
+		panic("Unknown ZUNION/INTER aggregate type")
+	}
+}
+
+// zsetDictGetMaxElementLength 返回dict中最长的元素的长度
+func zsetDictGetMaxElementLength(d *dict.Dict) int {
+	maxelelen := 0
+
+	di := d.GetIterator()
+	for de := di.Next(); de != nil; de = di.Next() {
+		if l := sds.Len(*(*sds.SDS)(dict.GetKey(de))); l > maxelelen {
+			maxelelen = l
+		}
+	}
+	di.Release()
+	return maxelelen
+}
+
+// zsetInsertNew 把一个不存在的元素插入到skiplist编码的zset中
+func zsetInsertNew(zs *zset, score float64, ele sds.SDS) {
+	znode := zslInsert(zs.zsl, score, ele)
+	if !zs.dict.Add(unsafe.Pointer(&znode.ele), unsafe.Pointer(&znode.score)) {
+		panic("zsetInsertNew: element already in dict")
+	}
+}
+
+// zdiffAlgorithm1 遍历第一个集合的元素，逐个检查是否在其他集合中。
+// 复杂度是O(N*M)，N是第一个集合的大小，M是集合的数量
+func zdiffAlgorithm1(src []zsetopsrc, dstzset *zset, maxelelen *int) {
+	var zval zsetopval
+
+	// 先检查大的集合，元素更有可能在里面被找到
+	others := src[1:]
+	sort.SliceStable(others, func(i, j int) bool {
+		return zuiLength(&others[i]) > zuiLength(&others[j])
+	})
+
+	zuiInitIterator(&src[0])
+	for zuiNext(&src[0], &zval) {
+		var value float64
+		exists := false
+
+		for j := 1; j < len(src); j++ {
+			if src[j].subject == src[0].subject || zuiFind(&src[j], &zval, &value) {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			tmp := zuiNewSdsFromValue(&zval)
+			zsetInsertNew(dstzset, zval.score, tmp)
+			if sds.Len(tmp) > *maxelelen {
+				*maxelelen = sds.Len(tmp)
+			}
+		}
+	}
+	zuiClearIterator(&src[0])
+}
+
+// zdiffAlgorithm2 先把第一个集合的元素全部加入结果，再依次删除其他集合中的元素。
+// 复杂度是O(L)，L是所有集合的元素总数
+func zdiffAlgorithm2(src []zsetopsrc, dstzset *zset, maxelelen *int) {
+	var zval zsetopval
+	cardinality := 0
+
+	for j := 0; j < len(src); j++ {
+		if zuiLength(&src[j]) == 0 {
+			continue
+		}
+
+		zuiInitIterator(&src[j])
+		for zuiNext(&src[j], &zval) {
+			if j == 0 {
+				zsetInsertNew(dstzset, zval.score, zuiNewSdsFromValue(&zval))
+				cardinality++
+			} else if zsetRemoveFromSkiplist(dstzset, zuiSdsFromValue(&zval)) {
+				cardinality--
+			}
+
+			// 结果已经为空，后面的删除都不会有效果
+			if cardinality == 0 {
+				break
+			}
+		}
+		zuiClearIterator(&src[j])
+
+		if cardinality == 0 {
+			break
+		}
+	}
+
+	// 这个算法没法在插入时计算最长元素，只能最后遍历一次
+	*maxelelen = zsetDictGetMaxElementLength(dstzset.dict)
+}
+
+// zsetChooseDiffAlgorithm 估算两种算法的工作量，返回1或2，
+// 返回0表示结果一定为空
+func zsetChooseDiffAlgorithm(src []zsetopsrc) int {
+	var algoOneWork, algoTwoWork int
+
+	for j := 0; j < len(src); j++ {
+		// 和第一个集合相同的集合会删除所有元素
+		if j > 0 && src[0].subject == src[j].subject {
+			return 0
+		}
+
+		algoOneWork += zuiLength(&src[0])
+		algoTwoWork += zuiLength(&src[j])
+	}
+
+	// 算法1的常数更小，并且有共同元素时操作更少，所以给它一些优势
+	algoOneWork /= 2
+	if algoOneWork <= algoTwoWork {
+		return 1
+	}
+	return 2
+}
+
+func zdiff(src []zsetopsrc, dstzset *zset, maxelelen *int) {
+	// 第一个集合为空时结果一定为空
+	if zuiLength(&src[0]) == 0 {
+		return
+	}
+
+	switch zsetChooseDiffAlgorithm(src) {
+	case 1:
+		zdiffAlgorithm1(src, dstzset, maxelelen)
+	case 2:
+		zdiffAlgorithm2(src, dstzset, maxelelen)
+	}
+}
+
+// zunionInterDiffGenericCommand 实现ZUNION、ZINTER、ZDIFF以及对应的STORE命令，
+// numkeysIndex是numkeys参数的下标，dstkey为nil时直接把结果回复给客户端
+func zunionInterDiffGenericCommand(c *Client, dstkey *robj, numkeysIndex int, op int) {
+	var setnum int64
+	if c.argv[numkeysIndex].getLongLongFromObjectOrReply(c, &setnum, "") != C_OK {
+		return
+	}
+
+	if setnum < 1 {
+		addReplyErrorFormat(c, "at least 1 input key is needed for '%s' command", c.cmd.name)
+		return
+	}
+
+	// 参数数量不够
+	if setnum > int64(c.argc-(numkeysIndex+1)) {
+		addReply(c, shared.syntaxErr)
+		return
+	}
+
+	// 读取所有的key，不存在的key当作空集合
+	src := make([]zsetopsrc, setnum)
+	j := numkeysIndex + 1
+	for i := range src {
+		var obj *robj
+		if dstkey != nil {
+			obj = c.db.lookupKeyWrite(c.argv[j])
+		} else {
+			obj = c.db.lookupKeyRead(c.argv[j])
+		}
+		if obj != nil {
+			if obj.getType() != ObjZSet && obj.getType() != ObjSet {
+				addReply(c, shared.wrongTypeErr)
+				return
+			}
+
+			src[i].subject = obj
+			src[i].typ = obj.getType()
+			src[i].encoding = obj.getEncoding()
+		}
+
+		// 默认权重是1
+		src[i].weight = 1.0
+		j++
+	}
+
+	// 解析可选参数
+	aggregate := redisAggrSum
+	withscores := false
+	if j < c.argc {
+		remaining := c.argc - j
+
+		for remaining > 0 {
+			arg := (*sds.SDS)(c.argv[j].ptr).BufData(0)
+			if op != setOpDiff && remaining >= int(setnum)+1 && util.StrCaseCmp(arg, "weights") {
+				j++
+				remaining--
+				for i := range src {
+					if c.argv[j].getDoubleFromObjectOrReply(c, &src[i].weight, "weight value is not a float") != C_OK {
+						return
+					}
+					j++
+					remaining--
+				}
+			} else if op != setOpDiff && remaining >= 2 && util.StrCaseCmp(arg, "aggregate") {
+				j++
+				remaining--
+				arg = (*sds.SDS)(c.argv[j].ptr).BufData(0)
+				if util.StrCaseCmp(arg, "sum") {
+					aggregate = redisAggrSum
+				} else if util.StrCaseCmp(arg, "min") {
+					aggregate = redisAggrMin
+				} else if util.StrCaseCmp(arg, "max") {
+					aggregate = redisAggrMax
+				} else {
+					addReply(c, shared.syntaxErr)
+					return
+				}
+				j++
+				remaining--
+			} else if remaining >= 1 && dstkey == nil && util.StrCaseCmp(arg, "withscores") {
+				j++
+				remaining--
+				withscores = true
+			} else {
+				addReply(c, shared.syntaxErr)
+				return
+			}
+		}
+	}
+
+	if op != setOpDiff {
+		// 按集合大小从小到大排序，可以提升交集的性能
+		sort.SliceStable(src, func(i, j int) bool {
+			return zuiLength(&src[i]) < zuiLength(&src[j])
+		})
+	}
+
+	dstobj := createZsetObject()
+	dstzset := (*zset)(dstobj.ptr)
+	maxelelen := 0
+	var zval zsetopval
+
+	if op == setOpInter {
+		// 最小的集合为空时，交集一定为空
+		if zuiLength(&src[0]) > 0 {
+			zuiInitIterator(&src[0])
+			for zuiNext(&src[0], &zval) {
+				var value float64
+
+				score := src[0].weight * zval.score
+				if math.IsNaN(score) {
+					score = 0
+				}
+
+				j := 1
+				for ; j < len(src); j++ {
+					// 不能查找正在迭代的集合，相同的集合直接使用当前的score
+					if src[j].subject == src[0].subject {
+						value = zval.score * src[j].weight
+						zunionInterAggregate(&score, value, aggregate)
+					} else if zuiFind(&src[j], &zval, &value) {
+						value *= src[j].weight
+						zunionInterAggregate(&score, value, aggregate)
+					} else {
+						break
+					}
+				}
+
+				// 所有集合中都存在
+				if j == len(src) {
+					tmp := zuiNewSdsFromValue(&zval)
+					zsetInsertNew(dstzset, score, tmp)
+					if sds.Len(tmp) > maxelelen {
+						maxelelen = sds.Len(tmp)
+					}
+				}
+			}
+			zuiClearIterator(&src[0])
+		}
+	} else if op == setOpUnion {
+		accumulator := dict.Create(zsetDictType, nil)
+
+		// 预先按照最大的集合扩容，减少rehash
+		accumulator.Expand(int64(zuiLength(&src[len(src)-1])))
+
+		for i := range src {
+			if zuiLength(&src[i]) == 0 {
+				continue
+			}
+
+			zuiInitIterator(&src[i])
+			for zuiNext(&src[i], &zval) {
+				score := src[i].weight * zval.score
+				if math.IsNaN(score) {
+					score = 0
+				}
+
+				ele := zuiSdsFromValue(&zval)
+				if de := accumulator.Find(unsafe.Pointer(&ele)); de == nil {
+					tmp := zuiNewSdsFromValue(&zval)
+					if sds.Len(tmp) > maxelelen {
+						maxelelen = sds.Len(tmp)
+					}
+					accumulator.Add(unsafe.Pointer(&tmp), unsafe.Pointer(&score))
+				} else {
+					zunionInterAggregate((*float64)(dict.GetVal(de)), score, aggregate)
+				}
+			}
+			zuiClearIterator(&src[i])
+		}
+
+		// 把累加的结果插入到目标zset中
+		di := accumulator.GetIterator()
+		if accumulator.Size() > 0 {
+			dstzset.dict.Expand(accumulator.Size())
+		}
+		for de := di.Next(); de != nil; de = di.Next() {
+			zsetInsertNew(dstzset, *(*float64)(dict.GetVal(de)), *(*sds.SDS)(dict.GetKey(de)))
+		}
+		di.Release()
+	} else if op == setOpDiff {
+		zdiff(src, dstzset, &maxelelen)
+	} else {
+		panic("Unknown operator")
+	}
+
+	if dstkey != nil {
+		if dstzset.zsl.length > 0 {
+			zsetConvertToListpackIfNeeded(dstobj, maxelelen)
+			c.db.genericSetKey(c, dstkey, dstobj, false, true)
+			addReplyLongLong(c, zsetLength(dstobj))
+			event := [...]string{setOpUnion: "zunionstore", setOpDiff: "zdiffstore", setOpInter: "zinterstore"}
+			notifyKeySpaceEvent(notifyZset, event[op], dstkey, c.db.id)
+			server.dirty++
+		} else {
+			addReply(c, shared.czero)
+			if dbDelete(c.db, dstkey) {
+				signalModifiedKey(c, c.db, dstkey)
+				notifyKeySpaceEvent(notifyGeneric, "del", dstkey, c.db.id)
+				server.dirty++
+			}
+		}
+	} else {
+		zsl := dstzset.zsl
+		length := zsl.length
+		if withscores && c.resp == 2 {
+			addReplyArrayLen(c, length*2)
+		} else {
+			addReplyArrayLen(c, length)
+		}
+		for zn := zsl.header.level[0].forward; zn != nil; zn = zn.level[0].forward {
+			if withscores && c.resp > 2 {
+				addReplyArrayLen(c, 2)
+			}
+			addReplyBulkBuffer(c, zn.ele.BufData(0), sds.Len(zn.ele))
+			if withscores {
+				addReplyDouble(c, zn.score)
+			}
+		}
+	}
+	dstobj.decrRefCount()
+}
+
+// ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func zunionstoreCommand(c *Client) {
+	zunionInterDiffGenericCommand(c, c.argv[1], 2, setOpUnion)
+}
+
+// ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func zinterstoreCommand(c *Client) {
+	zunionInterDiffGenericCommand(c, c.argv[1], 2, setOpInter)
+}
+
+// ZDIFFSTORE destination numkeys key [key ...]
+func zdiffstoreCommand(c *Client) {
+	zunionInterDiffGenericCommand(c, c.argv[1], 2, setOpDiff)
+}
+
+// ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func zunionCommand(c *Client) {
+	zunionInterDiffGenericCommand(c, nil, 1, setOpUnion)
+}
+
+// ZINTER numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func zinterCommand(c *Client) {
+	zunionInterDiffGenericCommand(c, nil, 1, setOpInter)
+}
+
+// ZDIFF numkeys key [key ...] [WITHSCORES]
+func zdiffCommand(c *Client) {
+	zunionInterDiffGenericCommand(c, nil, 1, setOpDiff)
+}
+
+// ZSCAN key cursor [MATCH pattern] [COUNT count]
+func zscanCommand(c *Client) {
+	var cursor uint64
+	if parseScanCursorOrReply(c, c.argv[2], &cursor) != C_OK {
+		return
+	}
+	zobj := lookupKeyReadOrReply(c, c.argv[1], shared.emptyScan)
+	if zobj == nil || zobj.checkType(c, ObjZSet) {
+		return
+	}
+	scanGenericCommand(c, zobj, cursor)
+}
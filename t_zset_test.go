@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pengdafu/redis-golang/dict"
+	"github.com/pengdafu/redis-golang/sds"
+	"github.com/pengdafu/redis-golang/util"
+	"math"
+	"testing"
+)
+
+func TestZslRank(t *testing.T) {
+	zsl := zslCreate()
+	for i := 0; i < 100; i++ {
+		zslInsert(zsl, float64(i%10), sds.NewLen(fmt.Sprintf("m%02d", i)))
+	}
+	if zsl.length != 100 {
+		t.Fatalf("expect length 100, got %d", zsl.length)
+	}
+
+	rank := 1
+	for x := zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		if r := zslGetRank(zsl, x.score, x.ele); r != rank {
+			t.Fatalf("%s: expect rank %d, got %d", x.ele.BufData(0), rank, r)
+		}
+		if zslGetElementByRank(zsl, rank) != x {
+			t.Fatalf("rank %d: wrong element", rank)
+		}
+		rank++
+	}
+
+	node := zslUpdateScore(zsl, 0, sds.NewLen("m00"), 100)
+	if zsl.tail != node || zslGetRank(zsl, 100, node.ele) != 100 {
+		t.Fatal("m00 should be the last element after update")
+	}
+	if !zslDelete(zsl, 100, sds.NewLen("m00"), nil) || zsl.length != 99 {
+		t.Fatal("delete m00 failed")
+	}
+}
+
+// zslCheck 检查skiplist的顺序、backward指针、span和length是否一致
+func zslCheck(t *testing.T, zsl *zskiplist, expect []string) {
+	t.Helper()
+	if zsl.length != len(expect) {
+		t.Fatalf("expect length %d, got %d", len(expect), zsl.length)
+	}
+
+	var prev *zskiplistNode
+	i := 0
+	for x := zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		if string(x.ele.BufData(0)) != expect[i] {
+			t.Fatalf("position %d: expect %s, got %s", i, expect[i], x.ele.BufData(0))
+		}
+		if x.backward != prev {
+			t.Fatalf("%s: wrong backward pointer", expect[i])
+		}
+		prev = x
+		i++
+	}
+	if zsl.tail != prev {
+		t.Fatal("wrong tail")
+	}
+
+	// 每一层的span加起来都等于length
+	for level := 0; level < zsl.level; level++ {
+		span := 0
+		for x := zsl.header; x != nil; x = x.level[level].forward {
+			span += x.level[level].span
+		}
+		if span != zsl.length {
+			t.Fatalf("level %d: expect span %d, got %d", level, zsl.length, span)
+		}
+	}
+}
+
+func TestZslInsertDeleteUpdate(t *testing.T) {
+	zsl := zslCreate()
+	// 相同score按照member的字典序排列
+	for _, item := range []struct {
+		score float64
+		ele   string
+	}{{3, "c"}, {1, "b"}, {1, "a"}, {2, "d"}, {-1, "e"}, {3, "a"}} {
+		zslInsert(zsl, item.score, sds.NewLen(item.ele))
+	}
+	zslCheck(t, zsl, []string{"e", "a", "b", "d", "a", "c"})
+
+	tests := []struct {
+		name   string
+		op     func() bool
+		expect []string
+	}{
+		{"delete head", func() bool { return zslDelete(zsl, -1, sds.NewLen("e"), nil) }, []string{"a", "b", "d", "a", "c"}},
+		{"delete tail", func() bool { return zslDelete(zsl, 3, sds.NewLen("c"), nil) }, []string{"a", "b", "d", "a"}},
+		{"delete with wrong score", func() bool { return !zslDelete(zsl, 2, sds.NewLen("a"), nil) }, []string{"a", "b", "d", "a"}},
+		{"delete missing", func() bool { return !zslDelete(zsl, 1, sds.NewLen("x"), nil) }, []string{"a", "b", "d", "a"}},
+		{"update in place", func() bool {
+			x := zslUpdateScore(zsl, 2, sds.NewLen("d"), 2.5)
+			return x.score == 2.5
+		}, []string{"a", "b", "d", "a"}},
+		{"update to head", func() bool {
+			x := zslUpdateScore(zsl, 3, sds.NewLen("a"), 0)
+			return x.score == 0 && zsl.header.level[0].forward == x
+		}, []string{"a", "a", "b", "d"}},
+		{"update to tail", func() bool {
+			x := zslUpdateScore(zsl, 1, sds.NewLen("b"), 10)
+			return zsl.tail == x
+		}, []string{"a", "a", "d", "b"}},
+	}
+	for _, tt := range tests {
+		if !tt.op() {
+			t.Fatalf("%s: unexpected result", tt.name)
+		}
+		zslCheck(t, zsl, tt.expect)
+	}
+}
+
+func TestZsetAddConvert(t *testing.T) {
+	server = &RedisServer{hz: 1, zsetMaxListpackEntries: 4, zsetMaxListpackValue: 8}
+	dict.SetHashFunctionSeed(util.GetRandomBytes(16))
+
+	// 两种编码执行相同的操作，结果必须一致
+	tests := []struct {
+		name     string
+		score    float64
+		ele      string
+		flags    int
+		outFlags int
+		score2   float64
+	}{
+		{"add", 1, "a", zaddInNone, zaddOutAdded, 1},
+		{"update", 2, "a", zaddInNone, zaddOutUpdated, 2},
+		{"same score", 2, "a", zaddInNone, 0, 2},
+		{"nx existing", 5, "a", zaddInNx, zaddOutNop, 2},
+		{"xx missing", 5, "b", zaddInXx, zaddOutNop, 0},
+		{"incr", 3, "a", zaddInIncr, zaddOutUpdated, 5},
+		{"gt smaller", 1, "a", zaddInGt, zaddOutNop, 5},
+		{"gt bigger", 6, "a", zaddInGt, zaddOutUpdated, 6},
+		{"lt bigger", 7, "a", zaddInLt, zaddOutNop, 6},
+		{"lt incr", -2, "a", zaddInLt | zaddInIncr, zaddOutUpdated, 4},
+	}
+	for _, enc := range []uint32{ObjEncodingListPack, ObjEncodingSkipList} {
+		zobj := createZsetListpackObject()
+		if enc == ObjEncodingSkipList {
+			zobj = createZsetObject()
+		}
+		for _, tt := range tests {
+			var outFlags int
+			if !zsetAdd(zobj, tt.score, sds.NewLen(tt.ele), tt.flags, &outFlags, nil) || outFlags != tt.outFlags {
+				t.Fatalf("encoding %d, %s: expect flags %d, got %d", enc, tt.name, tt.outFlags, outFlags)
+			}
+			var score float64
+			if zsetScore(zobj, sds.NewLen(tt.ele), &score) == C_OK && score != tt.score2 {
+				t.Fatalf("encoding %d, %s: expect score %v, got %v", enc, tt.name, tt.score2, score)
+			}
+		}
+
+		var outFlags int
+		if !zsetAdd(zobj, math.Inf(1), sds.NewLen("a"), zaddInIncr, &outFlags, nil) ||
+			zsetAdd(zobj, math.Inf(-1), sds.NewLen("a"), zaddInIncr, &outFlags, nil) || outFlags != zaddOutNan {
+			t.Fatalf("encoding %d: inf + -inf should be NaN", enc)
+		}
+		if !zsetDel(zobj, sds.NewLen("a")) || zsetDel(zobj, sds.NewLen("a")) || zsetLength(zobj) != 0 {
+			t.Fatalf("encoding %d: delete failed", enc)
+		}
+	}
+
+	// 元素个数超过zsetMaxListpackEntries时转换成skiplist
+	zobj := createZsetListpackObject()
+	var outFlags int
+	for i := 0; i < 4; i++ {
+		zsetAdd(zobj, float64(i), sds.NewLen(fmt.Sprintf("m%d", i)), zaddInNone, &outFlags, nil)
+	}
+	if zobj.getEncoding() != ObjEncodingListPack {
+		t.Fatal("4 elements should stay listpack")
+	}
+	zsetAdd(zobj, 4, sds.NewLen("m4"), zaddInNone, &outFlags, nil)
+	if zobj.getEncoding() != ObjEncodingSkipList {
+		t.Fatal("5 elements should be converted to skiplist")
+	}
+	zslCheck(t, (*zset)(zobj.ptr).zsl, []string{"m0", "m1", "m2", "m3", "m4"})
+	if zsetRank(zobj, sds.NewLen("m3"), false) != 3 || zsetRank(zobj, sds.NewLen("m3"), true) != 1 {
+		t.Fatal("wrong rank after convert")
+	}
+
+	// 元素长度超过zsetMaxListpackValue时转换成skiplist
+	zobj = createZsetListpackObject()
+	zsetAdd(zobj, 1, sds.NewLen("short"), zaddInNone, &outFlags, nil)
+	zsetAdd(zobj, 2, sds.NewLen("longer than 8"), zaddInNone, &outFlags, nil)
+	if zobj.getEncoding() != ObjEncodingSkipList {
+		t.Fatal("long element should convert to skiplist")
+	}
+	zslCheck(t, (*zset)(zobj.ptr).zsl, []string{"short", "longer than 8"})
+
+	// 删除长元素之后可以转换回listpack
+	zsetDel(zobj, sds.NewLen("longer than 8"))
+	zsetConvertToListpackIfNeeded(zobj, 5)
+	if zobj.getEncoding() != ObjEncodingListPack || zsetLength(zobj) != 1 {
+		t.Fatal("should convert back to listpack")
+	}
+}
+
+// zsetEncodings 分别用listpack和skiplist编码执行f
+func zsetEncodings(t *testing.T, f func(t *testing.T, c *Client)) {
+	for _, maxEntries := range []int{128, 0} {
+		testServerInit()
+		server.zsetMaxListpackEntries = maxEntries
+		f(t, testClient())
+	}
+}
+
+func TestZrangeCommands(t *testing.T) {
+	zsetEncodings(t, func(t *testing.T, c *Client) {
+		testRun(t, c, []testCase{
+			{"zadd z 1 a 2 b 3 c 4 d 5 e", ":5"},
+			{"zadd l 0 a 0 b 0 c 0 d 0 e", ":5"},
+			{"set s x", "+OK"},
+
+			// 按下标，负数下标和越界
+			{"zrange z 0 -1", "[a b c d e]"},
+			{"zrange z -2 -1 withscores", "[d 4 e 5]"},
+			{"zrange z -100 1", "[a b]"},
+			{"zrange z 3 100", "[d e]"},
+			{"zrange z 5 10", "[]"},
+			{"zrange z 3 1", "[]"},
+			{"zrange z 0 1 rev", "[e d]"},
+			{"zrevrange z 0 1 withscores", "[e 5 d 4]"},
+			{"zrange nokey 0 -1", "[]"},
+			{"zrange s 0 -1", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+			{"zrange z 0 -1 limit 0 1", "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"},
+
+			// 按score，开区间和无穷
+			{"zrange z (1 3 byscore", "[b c]"},
+			{"zrange z -inf +inf byscore limit 1 2", "[b c]"},
+			{"zrange z +inf -inf byscore rev limit 0 2 withscores", "[e 5 d 4]"},
+			{"zrange z 2 (2 byscore", "[]"},
+			{"zrange z 4 2 byscore", "[]"},
+			{"zrangebyscore z (3 +inf", "[d e]"},
+			{"zrangebyscore z -inf +inf limit 4 10", "[e]"},
+			{"zrangebyscore z -inf +inf limit 10 10", "[]"},
+			{"zrangebyscore z -inf +inf limit 0 -1", "[a b c d e]"},
+			{"zrevrangebyscore z (5 (2", "[d c]"},
+			{"zrangebyscore z x 1", "-ERR min or max is not a float"},
+			{"zcount z (1 (5", ":3"},
+			{"zcount z 6 10", ":0"},
+
+			// 按字典序
+			{"zrange l [b (d bylex", "[b c]"},
+			{"zrange l + - bylex rev limit 1 2", "[d c]"},
+			{"zrangebylex l - +", "[a b c d e]"},
+			{"zrangebylex l (e +", "[]"},
+			{"zrevrangebylex l [c -", "[c b a]"},
+			{"zrangebylex l b c", "-ERR min or max not valid string range item"},
+			{"zlexcount l (a [c", ":2"},
+
+			// ZRANGESTORE，空结果会删除目标key
+			{"zrangestore dst z 1 2", ":2"},
+			{"zrange dst 0 -1 withscores", "[b 2 c 3]"},
+			{"zrangestore dst z 10 20", ":0"},
+			{"exists dst", ":0"},
+			{"zrangestore z z 0 0", ":1"},
+			{"zrange z 0 -1", "[a]"},
+		})
+	})
+}
+
+func TestZremrangeCommands(t *testing.T) {
+	zsetEncodings(t, func(t *testing.T, c *Client) {
+		testRun(t, c, []testCase{
+			{"zadd z 1 a 2 b 3 c 4 d 5 e", ":5"},
+			{"zremrangebyrank z 10 20", ":0"},
+			{"zremrangebyrank z -1 -1", ":1"},
+			{"zremrangebyrank z 2 1", ":0"},
+			{"zremrangebyscore z (1 2", ":1"},
+			{"zrange z 0 -1", "[a c d]"},
+			{"zremrangebyscore z -inf +inf", ":3"},
+			{"exists z", ":0"},
+			{"zadd l 0 a 0 b 0 c", ":3"},
+			{"zremrangebylex l [a (c", ":2"},
+			{"zremrangebylex l - +", ":1"},
+			{"exists l", ":0"},
+			{"zremrangebyrank nokey 0 -1", ":0"},
+		})
+	})
+}
+
+func TestZsetAlgebraCommands(t *testing.T) {
+	zsetEncodings(t, func(t *testing.T, c *Client) {
+		testRun(t, c, []testCase{
+			{"zadd z1 1 a 2 b 3 c", ":3"},
+			{"zadd z2 10 b 20 c 30 d", ":3"},
+			{"sadd s a d", ":2"},
+			{"set str x", "+OK"},
+
+			{"zunion 2 z1 z2 withscores", "[a 1 b 12 c 23 d 30]"},
+			{"zunion 2 z1 z2 weights 2 1 aggregate max withscores", "[a 2 b 10 c 20 d 30]"},
+			{"zinter 2 z1 z2 aggregate min withscores", "[b 2 c 3]"},
+			{"zdiff 2 z1 z2 withscores", "[a 1]"},
+			{"zdiff 2 z1 nokey", "[a b c]"},
+			{"zinter 2 z1 nokey", "[]"},
+
+			// 集合作为输入时score为1
+			{"zunion 2 z1 s withscores", "[d 1 a 2 b 2 c 3]"},
+			{"zinter 2 s z2 withscores", "[d 31]"},
+
+			// +inf和-inf相加的结果为0
+			{"zadd inf1 +inf x", ":1"},
+			{"zadd inf2 -inf x", ":1"},
+			{"zunion 2 inf1 inf2 withscores", "[x 0]"},
+
+			{"zunionstore dst 2 z1 z2", ":4"},
+			{"zrange dst 0 -1 withscores", "[a 1 b 12 c 23 d 30]"},
+			{"zinterstore dst 2 z1 nokey", ":0"},
+			{"exists dst", ":0"},
+			{"zdiffstore z1 2 z1 z2", ":1"},
+			{"zrange z1 0 -1", "[a]"},
+			{"zunionstore z1 1 z1 weights 3", ":1"},
+			{"zscore z1 a", "3"},
+
+			{"zunion 0 z1", "-ERR at least 1 input key is needed for 'zunion' command"},
+			{"zunion 3 z1 z2", "-ERR syntax error"},
+			{"zunion 2 z1 z2 weights 1", "-ERR syntax error"},
+			{"zunion 2 z1 z2 weights 1 x", "-ERR weight value is not a float"},
+			{"zunion 2 z1 z2 aggregate avg", "-ERR syntax error"},
+			{"zdiff 2 z1 z2 weights 1 1", "-ERR syntax error"},
+			{"zunion 2 z1 str", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+			{"zunionstore dst 1 z1 withscores", "-ERR syntax error"},
+		})
+
+		// 空字符串成员，参数中有空字符串时不能按空白拆分
+		tests := []struct {
+			args   []string
+			expect string
+		}{
+			{[]string{"zadd", "e1", "1", "", "2", "b"}, ":2"},
+			{[]string{"zadd", "e2", "5", "", "3", "c"}, ":2"},
+			{[]string{"zunion", "1", "e1", "withscores"}, "[ 1 b 2]"},
+			{[]string{"zunion", "2", "e1", "e2", "withscores"}, "[b 2 c 3  6]"},
+			{[]string{"zinter", "2", "e1", "e2", "withscores"}, "[ 6]"},
+			{[]string{"zdiff", "2", "e1", "e2", "withscores"}, "[b 2]"},
+			{[]string{"zdiff", "2", "e2", "e1"}, "[c]"},
+			{[]string{"zinterstore", "edst", "2", "e1", "e2"}, ":1"},
+			{[]string{"zscore", "edst", ""}, "6"},
+			{[]string{"zunionstore", "edst", "2", "e1", "e2"}, ":3"},
+			{[]string{"zrange", "edst", "0", "-1"}, "[b c ]"},
+			{[]string{"zdiffstore", "edst", "2", "e1", "e2"}, ":1"},
+			{[]string{"zrange", "edst", "0", "-1"}, "[b]"},
+		}
+		for _, tt := range tests {
+			if reply := testCommand(c, tt.args...); reply != tt.expect {
+				t.Errorf("%q: expect %q, got %q", tt.args, tt.expect, reply)
+			}
+		}
+	})
+}
+
+func TestZsetListpackConvertCommands(t *testing.T) {
+	testServerInit()
+	server.zsetMaxListpackEntries = 3
+	server.zsetMaxListpackValue = 8
+	c := testClient()
+
+	// 元素个数超过zsetMaxListpackEntries时转换成skiplist
+	testArgsRun(t, c, []testArgsCase{
+		{[]string{"zadd", "z", "1", "", "2", "a"}, ":2"},
+		{[]string{"object", "encoding", "z"}, "listpack"},
+		{[]string{"zadd", "z", "3", "b"}, ":1"},
+		{[]string{"object", "encoding", "z"}, "listpack"},
+		{[]string{"zadd", "z", "4", "c"}, ":1"},
+		{[]string{"object", "encoding", "z"}, "skiplist"},
+		{[]string{"zrange", "z", "0", "-1", "withscores"}, "[ 1 a 2 b 3 c 4]"},
+		{[]string{"zscore", "z", ""}, "1"},
+		{[]string{"zrank", "z", ""}, ":0"},
+		{[]string{"zincrby", "z", "10", ""}, "11"},
+		{[]string{"zrevrank", "z", ""}, ":0"},
+		{[]string{"zrem", "z", ""}, ":1"},
+		{[]string{"zrange", "z", "0", "-1"}, "[a b c]"},
+	})
+
+	// 元素长度超过zsetMaxListpackValue时转换成skiplist，结果集合按大小选择编码
+	testRun(t, c, []testCase{
+		{"zadd z2 1 a", ":1"},
+		{"zadd z2 2 abcdefghi", ":1"},
+		{"object encoding z2", "skiplist"},
+		{"zrange z2 0 -1 withscores", "[a 1 abcdefghi 2]"},
+		{"zincrby z3 1 abcdefghi", "1"},
+		{"object encoding z3", "skiplist"},
+		{"zrangestore z4 z 0 -1", ":3"},
+		{"object encoding z4", "listpack"},
+		{"zunionstore z5 2 z z2", ":4"},
+		{"object encoding z5", "skiplist"},
+		{"zrange z5 0 -1 withscores", "[abcdefghi 2 a 3 b 3 c 4]"},
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"unsafe"
+)
+
+// encodeTimeoutKey 把超时时间和客户端id编码成clientsTimeoutTable的key，
+// 都使用大端序，这样rax中的key按照超时时间排序，超时时间相同的按照id排序
+func encodeTimeoutKey(buf []byte, timeout int64, c *Client) {
+	binary.BigEndian.PutUint64(buf, uint64(timeout))
+	binary.BigEndian.PutUint64(buf[8:], c.id)
+}
+
+// decodeTimeoutKey 从clientsTimeoutTable的key中解析出超时时间
+func decodeTimeoutKey(buf []byte) int64 {
+	return int64(binary.BigEndian.Uint64(buf))
+}
+
+// addClientToTimeoutTable 把设置了超时时间的阻塞客户端加入server.clientsTimeoutTable
+func addClientToTimeoutTable(c *Client) {
+	if c.bpop.timeout == 0 {
+		return
+	}
+	if c.flags&CLIENT_IN_TO_TABLE == 0 {
+		var buf [16]byte
+		encodeTimeoutKey(buf[:], c.bpop.timeout, c)
+		if ok, _ := raxTryInsert(server.clientsTimeoutTable, buf[:], unsafe.Pointer(c)); ok {
+			c.flags |= CLIENT_IN_TO_TABLE
+		}
+	}
+}
+
+// removeClientFromTimeoutTable 把客户端从server.clientsTimeoutTable中移除
+func removeClientFromTimeoutTable(c *Client) {
+	if c.flags&CLIENT_IN_TO_TABLE == 0 {
+		return
+	}
+	c.flags &= ^CLIENT_IN_TO_TABLE
+	var buf [16]byte
+	encodeTimeoutKey(buf[:], c.bpop.timeout, c)
+	raxRemove(server.clientsTimeoutTable, buf[:])
+}
+
+// checkBlockedClientTimeout 如果客户端阻塞超时，回复客户端并解除阻塞，返回true
+func checkBlockedClientTimeout(c *Client, now int64) bool {
+	if c.flags&CLIENT_BLOCKED > 0 &&
+		c.bpop.timeout != 0 &&
+		c.bpop.timeout < now {
+		replyToBlockedClientTimedOut(c)
+		unblockClient(c)
+		return true
+	}
+	return false
+}
+
+// handleBlockedClientsTimeout 处理所有超时的阻塞客户端，在beforeSleep和serverCron中调用。
+// clientsTimeoutTable按照超时时间排序，遇到第一个没有超时的客户端就可以停止了
+func handleBlockedClientsTimeout() {
+	if raxSize(server.clientsTimeoutTable) == 0 {
+		return
+	}
+
+	now := mstime()
+	var ri raxIterator
+	raxStart(&ri, server.clientsTimeoutTable)
+	raxSeek(&ri, "^", nil)
+
+	for raxNext(&ri) {
+		if decodeTimeoutKey(ri.key) >= now {
+			break
+		}
+		c := (*Client)(ri.data)
+		// 先清除标记，这样unblockClient不会再去rax中删除
+		c.flags &= ^CLIENT_IN_TO_TABLE
+		checkBlockedClientTimeout(c, now)
+		raxRemove(server.clientsTimeoutTable, ri.key)
+		raxSeek(&ri, "^", nil)
+	}
+	raxStop(&ri)
+}
+
+// getTimeoutFromObjectOrReply 解析阻塞命令的超时时间，unit为unitSeconds时支持小数。
+// timeout为绝对的毫秒时间戳，0表示永不超时
+func getTimeoutFromObjectOrReply(c *Client, object *robj, timeout *int64, unit int) error {
+	var tval int64
+
+	if unit == unitSeconds {
+		var ftval float64
+		if object.getDoubleFromObjectOrReply(c, &ftval, "timeout is not a float or out of range") != C_OK {
+			return C_ERR
+		}
+		if math.IsNaN(ftval) {
+			addReplyError(c, "timeout is not a float or out of range")
+			return C_ERR
+		}
+		if ftval < 0 {
+			addReplyError(c, "timeout is negative")
+			return C_ERR
+		}
+		if ftval*1000 >= math.MaxInt64 {
+			addReplyError(c, "timeout is out of range")
+			return C_ERR
+		}
+		tval = int64(ftval * 1000)
+	} else {
+		if object.getLongLongFromObjectOrReply(c, &tval, "timeout is not an integer or out of range") != C_OK {
+			return C_ERR
+		}
+	}
+
+	if tval < 0 {
+		addReplyError(c, "timeout is negative")
+		return C_ERR
+	}
+
+	if tval > 0 {
+		now := mstime()
+		if tval > math.MaxInt64-now {
+			addReplyError(c, "timeout is out of range")
+			return C_ERR
+		}
+		tval += now
+	}
+	*timeout = tval
+	return C_OK
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"bytes"
+	"math"
 	"math/rand"
 	"strconv"
 	"strings"
@@ -79,3 +80,180 @@ func String2Int64[T []byte | string](str T, v *int64) bool {
 	*v = i
 	return true
 }
+
+// String2D 和strtod一样解析浮点数，但是不允许前导空白字符、尾部多余字符以及nan
+func String2D[T []byte | string](str T, v *float64) bool {
+	if len(str) == 0 || isSpace(str[0]) {
+		return false
+	}
+	d, err := strconv.ParseFloat(string(str), 64)
+	if err != nil || math.IsNaN(d) {
+		return false
+	}
+	if v != nil {
+		*v = d
+	}
+	return true
+}
+
+// D2String 把double转换成字符串，整数值会按%lld的格式输出，这样在ziplist中可以按整数编码
+func D2String(value float64) string {
+	if math.IsNaN(value) {
+		return "nan"
+	} else if math.IsInf(value, 1) {
+		return "inf"
+	} else if math.IsInf(value, -1) {
+		return "-inf"
+	} else if value == 0 {
+		if math.Signbit(value) {
+			return "-0"
+		}
+		return "0"
+	}
+
+	const min, max = -4503599627370495, 4503599627370496 // (2^52)
+	if value > min && value < max && value == float64(int64(value)) {
+		return strconv.FormatInt(int64(value), 10)
+	}
+	return strconv.FormatFloat(value, 'g', 17, 64)
+}
+
+// LD2String 把long double转换成字符串，humanfriendly为true时不使用指数形式并且去掉多余的0，
+// 用于INCRBYFLOAT等需要给用户展示的场景
+func LD2String(value float64, humanfriendly bool) string {
+	if math.IsInf(value, 1) {
+		return "inf"
+	} else if math.IsInf(value, -1) {
+		return "-inf"
+	}
+
+	if humanfriendly {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(value, 'g', 17, 64)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
+// StringMatchLen glob风格的模式匹配，支持*、?、[...]以及\转义
+func StringMatchLen(pattern, str []byte, nocase bool) bool {
+	skipLongerMatches := false
+	return stringMatchLenImpl(pattern, str, nocase, &skipLongerMatches, 0)
+}
+
+func stringMatchLenImpl(pattern, str []byte, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	// 避免恶意的模式导致递归太深
+	if nesting > 1000 {
+		return false
+	}
+
+	patAt := func(i int) byte {
+		if i < len(pattern) {
+			return pattern[i]
+		}
+		return 0
+	}
+	equal := func(a, b byte) bool {
+		if nocase {
+			return toLower(a) == toLower(b)
+		}
+		return a == b
+	}
+
+	p, s := 0, 0
+	for p < len(pattern) && s < len(str) {
+		switch pattern[p] {
+		case '*':
+			for patAt(p+1) == '*' {
+				p++
+			}
+			if p+1 == len(pattern) {
+				return true
+			}
+			for s < len(str) {
+				if stringMatchLenImpl(pattern[p+1:], str[s:], nocase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+				s++
+			}
+			// 剩下的模式从字符串的任何位置开始都匹配不了，前面的*匹配更长的子串也没有用，
+			// 所以可以直接结束整个匹配
+			*skipLongerMatches = true
+			return false
+		case '?':
+			s++
+		case '[':
+			p++
+			not := patAt(p) == '^'
+			if not {
+				p++
+			}
+			match := false
+			for {
+				if patAt(p) == '\\' && len(pattern)-p >= 2 {
+					p++
+					if pattern[p] == str[s] {
+						match = true
+					}
+				} else if patAt(p) == ']' {
+					break
+				} else if p >= len(pattern) {
+					p--
+					break
+				} else if len(pattern)-p >= 3 && pattern[p+1] == '-' {
+					start, end, c := pattern[p], pattern[p+2], str[s]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = toLower(start), toLower(end), toLower(c)
+					}
+					p += 2
+					if c >= start && c <= end {
+						match = true
+					}
+				} else if equal(pattern[p], str[s]) {
+					match = true
+				}
+				p++
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			s++
+		case '\\':
+			if len(pattern)-p >= 2 {
+				p++
+			}
+			fallthrough
+		default:
+			if !equal(pattern[p], str[s]) {
+				return false
+			}
+			s++
+		}
+		p++
+		if s == len(str) {
+			for patAt(p) == '*' {
+				p++
+			}
+			break
+		}
+	}
+	return p == len(pattern) && s == len(str)
+}
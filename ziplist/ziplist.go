@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"github.com/pengdafu/redis-golang/util"
 	"math"
+	"math/rand"
+	"sort"
+	"strconv"
 	"unsafe"
 )
 
@@ -146,7 +149,7 @@ func zipTryEncoding(entry []byte, entryLen int, v *int64, encoding *uint8) bool
 			*encoding = zipInt8B
 		} else if value >= math.MinInt16 && value <= math.MaxInt16 {
 			*encoding = zipInt16B
-		} else if value >= -1<<23 && value >= 1<<23-1 {
+		} else if value >= -1<<23 && value <= 1<<23-1 {
 			*encoding = zipInt24B
 		} else if value >= math.MinInt32 && value <= math.MaxInt32 {
 			*encoding = zipInt32B
@@ -172,21 +175,26 @@ func zipRawEntryLength(p []byte) int {
 }
 
 func zipLoadInteger(p []byte, encoding uint8) (ret int64) {
-	r := unsafe.Pointer(&ret)
 	if encoding == zipInt8B {
-		return int64(p[0])
+		return int64(int8(p[0]))
 	} else if encoding == zipInt16B {
-		util.TransBytes2Number(r, p, 2)
+		var i16 int16
+		util.TransBytes2Number(unsafe.Pointer(&i16), p, 2)
+		ret = int64(i16)
 	} else if encoding == zipInt32B {
-		util.TransBytes2Number(r, p, 4)
+		var i32 int32
+		util.TransBytes2Number(unsafe.Pointer(&i32), p, 4)
+		ret = int64(i32)
 	} else if encoding == zipInt24B {
-		util.TransBytes2Number(r, p, 3)
+		var i32 int32
+		util.TransBytes2Number(unsafe.Pointer(&i32), p, 3)
+		ret = int64(i32<<8) >> 8 // 24bit 符号扩展
 	} else if encoding == zipInt64B {
-		util.TransBytes2Number(r, p, 8)
+		util.TransBytes2Number(unsafe.Pointer(&ret), p, 8)
 	} else if encoding >= zipIntImmMin && encoding <= zipIntImmMax {
 		return int64(encoding&zipIntImmMask) - 1
 	} else {
-
+		panic(fmt.Sprintf("Invalid integer encoding %x", encoding))
 	}
 	return
 }
@@ -426,7 +434,7 @@ func __ziplistInsert(zl, p, s []byte) []byte { // p 是要被插入的位置
 		if forceLarge {
 			zipStorePrevEntryLengthLarge(p[reqLen:], reqLen)
 		} else {
-			zipStorePrevEntryLength(p[:reqLen], reqLen)
+			zipStorePrevEntryLength(p[reqLen:], reqLen)
 		}
 
 		*ziplistTailOffset(zl) = *ziplistTailOffset(zl) + uint32(reqLen)
@@ -508,7 +516,7 @@ func Index(zl []byte, index int) []byte {
 		p = ziplistEntryHead(zl)
 		for p[0] != zipEnd && index > 0 {
 			p = p[zipRawEntryLength(p):]
-			index++
+			index--
 		}
 	}
 	if p[0] == zipEnd || index > 0 {
@@ -607,6 +615,29 @@ func Insert(zl, p, s []byte) []byte {
 	return __ziplistInsert(zl, p, s)
 }
 
+// Replace 把p指向的元素替换成s，返回新的ziplist
+func Replace(zl, p, s []byte) []byte {
+	zl = Delete(zl, &p)
+	return __ziplistInsert(zl, p, s)
+}
+
+// Merge 把second中的所有元素追加到first的尾部，返回合并后的ziplist，second不会被修改
+func Merge(first, second []byte) []byte {
+	var sstr []byte
+	var slen int
+	var sval int64
+
+	for p := Index(second, 0); p != nil; p = Next(second, p) {
+		Get(p, &sstr, &slen, &sval)
+		if sstr != nil {
+			first = Push(first, sstr, Tail)
+		} else {
+			first = Push(first, []byte(strconv.FormatInt(sval, 10)), Tail)
+		}
+	}
+	return first
+}
+
 func Push(zl, s []byte, where int) []byte {
 	var p []byte
 	if where == Head {
@@ -616,3 +647,149 @@ func Push(zl, s []byte, where int) []byte {
 	}
 	return __ziplistInsert(zl, p, s)
 }
+
+func Prev(zl []byte, p []byte) []byte {
+	var prevlensize, prevlen int
+	if p[0] == zipEnd {
+		p = ziplistEntryTail(zl)
+		if p[0] == zipEnd {
+			return nil
+		}
+		return p
+	} else if len(zl)-len(p) == int(HeaderSize) {
+		return nil
+	}
+	zipDecodePrevLen(p, &prevlensize, &prevlen)
+	return zl[len(zl)-len(p)-prevlen:]
+}
+
+func DeleteRange(zl []byte, index, num int) []byte {
+	p := Index(zl, index)
+	if p == nil {
+		return zl
+	}
+	return __ziplistDelete(zl, p, num)
+}
+
+// Compare 比较p指向的元素和s是否相等，整数编码的元素会尝试把s按整数比较
+func Compare(p []byte, s []byte) bool {
+	var entry zlentry
+	if p[0] == zipEnd {
+		return false
+	}
+
+	zipEntry(p, &entry)
+	if zipIsStr(entry.encoding) {
+		return entry.len == len(s) && util.BytesCmp(p[entry.headerSize:entry.headerSize+entry.len], s)
+	}
+
+	var sval int64
+	var sencoding uint8
+	if zipTryEncoding(s, len(s), &sval, &sencoding) {
+		return zipLoadInteger(p[entry.headerSize:], entry.encoding) == sval
+	}
+	return false
+}
+
+// Entry 保存从ziplist中取出的元素，Sval为nil时元素是整数Lval
+type Entry struct {
+	Sval []byte
+	Slen int
+	Lval int64
+}
+
+// RandomPair 随机返回一对key-value，totalCount是ziplist中kv对的数量，val为nil时只返回key
+func RandomPair(zl []byte, totalCount int, key, val *Entry) {
+	if totalCount == 0 {
+		panic("RandomPair on empty ziplist")
+	}
+	// ziplist中保存的是kv对，所以下标是偶数
+	r := rand.Intn(totalCount) * 2
+	p := Index(zl, r)
+	if !Get(p, &key.Sval, &key.Slen, &key.Lval) {
+		panic("ziplist corrupted")
+	}
+	if val == nil {
+		return
+	}
+	p = Next(zl, p)
+	if !Get(p, &val.Sval, &val.Slen, &val.Lval) {
+		panic("ziplist corrupted")
+	}
+}
+
+// RandomPairs 随机返回count对key-value，可能会重复，vals为nil时只返回key
+func RandomPairs(zl []byte, count int, keys, vals []Entry) {
+	type randPick struct {
+		index int
+		order int
+	}
+	totalSize := Len(zl) / 2
+	if totalSize == 0 {
+		panic("RandomPairs on empty ziplist")
+	}
+
+	// 生成随机的下标，记下生成的顺序
+	picks := make([]randPick, count)
+	for i := range picks {
+		picks[i].index = rand.Intn(totalSize) * 2
+		picks[i].order = i
+	}
+
+	// 按下标排序之后只需要遍历一次ziplist
+	sort.Slice(picks, func(i, j int) bool {
+		return picks[i].index < picks[j].index
+	})
+
+	var key, value Entry
+	zipindex, pickindex := 0, 0
+	p := Index(zl, 0)
+	for pickindex < count && Get(p, &key.Sval, &key.Slen, &key.Lval) {
+		p = Next(zl, p)
+		if !Get(p, &value.Sval, &value.Slen, &value.Lval) {
+			panic("ziplist corrupted")
+		}
+		for pickindex < count && zipindex == picks[pickindex].index {
+			storeorder := picks[pickindex].order
+			keys[storeorder] = key
+			if vals != nil {
+				vals[storeorder] = value
+			}
+			pickindex++
+		}
+		zipindex += 2
+		p = Next(zl, p)
+	}
+}
+
+// RandomPairsUnique 随机返回最多count对不重复的key-value，返回实际的数量
+func RandomPairsUnique(zl []byte, count int, keys, vals []Entry) int {
+	totalSize := Len(zl) / 2
+	if count > totalSize {
+		count = totalSize
+	}
+
+	// 只遍历一次，每个元素被选中的概率是还需要选择的数量除以还没有访问的数量，
+	// 这样每个元素被选中的概率都是相同的
+	p := Index(zl, 0)
+	picked, remaining, index := 0, count, 0
+	for picked < count && p != nil {
+		threshold := float64(remaining) / float64(totalSize-index)
+		if rand.Float64() <= threshold {
+			if !Get(p, &keys[picked].Sval, &keys[picked].Slen, &keys[picked].Lval) {
+				panic("ziplist corrupted")
+			}
+			p = Next(zl, p)
+			if vals != nil && !Get(p, &vals[picked].Sval, &vals[picked].Slen, &vals[picked].Lval) {
+				panic("ziplist corrupted")
+			}
+			remaining--
+			picked++
+		} else {
+			p = Next(zl, p)
+		}
+		p = Next(zl, p)
+		index++
+	}
+	return picked
+}
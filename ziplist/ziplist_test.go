@@ -22,3 +22,81 @@ func TestNew(t *testing.T) {
 	fmt.Println(*ziplistLength(zl), *ziplistBytes(zl), *ziplistTailOffset(zl))
 	fmt.Println(string(zl))
 }
+
+func TestIntegerEncoding(t *testing.T) {
+	values := []int64{0, 12, -5, -300, 40000, -40000, 10000000, -10000000, 5000000000, -5000000000}
+	zl := New()
+	for _, v := range values {
+		zl = Push(zl, []byte(fmt.Sprintf("%d", v)), Tail)
+	}
+
+	i := 0
+	for p := Index(zl, Head); p != nil; p = Next(zl, p) {
+		var sstr []byte
+		var slen int
+		var sval int64
+		Get(p, &sstr, &slen, &sval)
+		if sstr != nil || sval != values[i] {
+			t.Fatalf("index %d: expect %d, got %d", i, values[i], sval)
+		}
+		i++
+	}
+
+	i = len(values) - 1
+	for p := Index(zl, -1); p != nil; p = Prev(zl, p) {
+		if !Compare(p, []byte(fmt.Sprintf("%d", values[i]))) {
+			t.Fatalf("index %d: compare failed", i)
+		}
+		i--
+	}
+	if i != -1 {
+		t.Fatalf("reverse iteration stopped at %d", i)
+	}
+}
+
+func TestInsertMiddle(t *testing.T) {
+	zl := New()
+	zl = Push(zl, []byte("a"), Tail)
+	zl = Push(zl, []byte("c"), Tail)
+	p := Index(zl, 1)
+	zl = Insert(zl, p, []byte("b"))
+
+	for i, s := range []string{"a", "b", "c"} {
+		if p = Index(zl, i); p == nil || !Compare(p, []byte(s)) {
+			t.Fatalf("index %d: expect %s", i, s)
+		}
+	}
+	if p = Prev(zl, Index(zl, 2)); !Compare(p, []byte("b")) {
+		t.Fatal("prev of c should be b")
+	}
+
+	zl = DeleteRange(zl, 0, 2)
+	if Len(zl) != 1 || !Compare(Index(zl, Head), []byte("c")) {
+		t.Fatal("delete range failed")
+	}
+}
+
+func TestRandomPairsUnique(t *testing.T) {
+	zl := New()
+	for i := 0; i < 50; i++ {
+		zl = Push(zl, []byte(fmt.Sprintf("f%d", i)), Tail)
+		zl = Push(zl, []byte(fmt.Sprintf("%d", i)), Tail)
+	}
+
+	keys := make([]Entry, 20)
+	vals := make([]Entry, 20)
+	if n := RandomPairsUnique(zl, 20, keys, vals); n != 20 {
+		t.Fatalf("expect 20 pairs, got %d", n)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		key := string(keys[i].Sval[:keys[i].Slen])
+		if seen[key] {
+			t.Fatalf("duplicate field %s", key)
+		}
+		seen[key] = true
+		if vals[i].Sval != nil || key != fmt.Sprintf("f%d", vals[i].Lval) {
+			t.Fatalf("field %s does not match value %d", key, vals[i].Lval)
+		}
+	}
+}